@@ -1,10 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"github.com/mattermost/cicd-sdk/pkg/build"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -66,23 +66,29 @@ func runBuild(opts *buildOpts) (err error) {
 		b, err = build.NewFromConfigFile(opts.configFile)
 	}
 	if err != nil {
-		return errors.Wrap(err, "creating new build")
+		return fmt.Errorf("creating new build: %w", err)
 	}
 	b.Options().SBOM = true
 	b.Options().Workdir = opts.workDir
 
 	run := b.Run()
-	return errors.Wrap(run.Execute(), "executing build run")
+	if err := run.Execute(); err != nil {
+		return fmt.Errorf("executing build run: %w", err)
+	}
+	return nil
 }
 
 func replayBuild(attestationPath string, ropts *replayOpts) (err error) {
 	opts := &build.Options{Workdir: ropts.workDir}
 	b, err := build.NewFromAttestation(attestationPath, opts)
 	if err != nil {
-		return errors.Wrap(err, "creating build")
+		return fmt.Errorf("creating build: %w", err)
 	}
 
-	return errors.Wrap(b.RunAttestation(attestationPath), "executing replay run")
+	if err := b.RunAttestation(attestationPath); err != nil {
+		return fmt.Errorf("executing replay run: %w", err)
+	}
+	return nil
 }
 
 func main() {
@@ -0,0 +1,227 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package apicheck lists the exported API of Go packages, to detect the
+// changes that would break the code depending on them. The API of the
+// stable packages of the SDK is recorded in api/v1.txt, at the root of the
+// repository.
+package apicheck
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StablePackages are the packages of the SDK covered by the v1 API
+// stability promise, relative to the module root
+var StablePackages = []string{
+	"pkg/build",
+	"pkg/build/runners",
+	"pkg/cherrypicker",
+	"pkg/git",
+	"pkg/github",
+	"pkg/object",
+	"pkg/object/backends",
+}
+
+// Surface returns the exported declarations of the package in dir, one
+// per line and sorted. Lines are prefixed with the import path, eg:
+//
+//	pkg github.com/mattermost/cicd-sdk/pkg/git, func New() *Git
+//
+// Struct fields and interface methods are listed on their own lines.
+// Test files are skipped.
+func Surface(importPath, dir string) ([]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parsing package in %s: %w", dir, err)
+	}
+
+	s := &surface{fset: fset, prefix: fmt.Sprintf("pkg %s, ", importPath)}
+	for name, pkg := range pkgs {
+		if strings.HasSuffix(name, "_test") {
+			continue
+		}
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				s.addDecl(decl)
+			}
+		}
+	}
+	sort.Strings(s.lines)
+	return s.lines, nil
+}
+
+// ModuleSurface returns the API of the stable packages of the module
+// rooted at root
+func ModuleSurface(module, root string) ([]string, error) {
+	lines := []string{}
+	for _, pkg := range StablePackages {
+		pkgLines, err := Surface(module+"/"+pkg, filepath.Join(root, filepath.FromSlash(pkg)))
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, pkgLines...)
+	}
+	return lines, nil
+}
+
+// Removed returns the lines of the recorded API that are not in the
+// current one, the declarations that were removed or changed
+func Removed(recorded, current []string) []string {
+	have := map[string]bool{}
+	for _, line := range current {
+		have[line] = true
+	}
+	removed := []string{}
+	for _, line := range recorded {
+		if line != "" && !have[line] {
+			removed = append(removed, line)
+		}
+	}
+	return removed
+}
+
+// ParseRecord returns the lines of a recorded API file
+func ParseRecord(data []byte) []string {
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// surface accumulates the API lines of a package
+type surface struct {
+	fset   *token.FileSet
+	prefix string
+	lines  []string
+}
+
+func (s *surface) add(format string, args ...interface{}) {
+	s.lines = append(s.lines, s.prefix+fmt.Sprintf(format, args...))
+}
+
+func (s *surface) addDecl(decl ast.Decl) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if !d.Name.IsExported() {
+			return
+		}
+		if d.Recv == nil {
+			s.add("func %s%s", d.Name.Name, s.signature(d.Type))
+			return
+		}
+		recv := s.expr(d.Recv.List[0].Type)
+		if !ast.IsExported(strings.TrimPrefix(strings.SplitN(recv, "[", 2)[0], "*")) {
+			return
+		}
+		s.add("method (%s) %s%s", recv, d.Name.Name, s.signature(d.Type))
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch sp := spec.(type) {
+			case *ast.TypeSpec:
+				s.addType(sp)
+			case *ast.ValueSpec:
+				for _, name := range sp.Names {
+					if !name.IsExported() {
+						continue
+					}
+					if sp.Type != nil {
+						s.add("%s %s %s", d.Tok, name.Name, s.expr(sp.Type))
+					} else {
+						s.add("%s %s", d.Tok, name.Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (s *surface) addType(sp *ast.TypeSpec) {
+	if !sp.Name.IsExported() {
+		return
+	}
+	name := sp.Name.Name
+	if sp.Assign.IsValid() {
+		s.add("type %s = %s", name, s.expr(sp.Type))
+		return
+	}
+	switch t := sp.Type.(type) {
+	case *ast.StructType:
+		s.add("type %s struct", name)
+		for _, field := range t.Fields.List {
+			if len(field.Names) == 0 {
+				s.add("type %s struct, embedded %s", name, s.expr(field.Type))
+				continue
+			}
+			for _, fn := range field.Names {
+				if fn.IsExported() {
+					s.add("type %s struct, %s %s", name, fn.Name, s.expr(field.Type))
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		s.add("type %s interface", name)
+		for _, method := range t.Methods.List {
+			if len(method.Names) == 0 {
+				s.add("type %s interface, embedded %s", name, s.expr(method.Type))
+				continue
+			}
+			for _, mn := range method.Names {
+				if ft, ok := method.Type.(*ast.FuncType); ok {
+					s.add("type %s interface, %s%s", name, mn.Name, s.signature(ft))
+				}
+			}
+		}
+	default:
+		s.add("type %s %s", name, s.expr(sp.Type))
+	}
+}
+
+// signature returns the parameters and results of a function without
+// their names, which can change without breaking the callers
+func (s *surface) signature(ft *ast.FuncType) string {
+	sig := "(" + strings.Join(s.fieldTypes(ft.Params), ", ") + ")"
+	results := s.fieldTypes(ft.Results)
+	switch {
+	case len(results) == 1:
+		sig += " " + results[0]
+	case len(results) > 1:
+		sig += " (" + strings.Join(results, ", ") + ")"
+	}
+	return sig
+}
+
+func (s *surface) fieldTypes(fields *ast.FieldList) []string {
+	types := []string{}
+	if fields == nil {
+		return types
+	}
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, s.expr(field.Type))
+		}
+	}
+	return types
+}
+
+// expr prints an expression in a single line
+func (s *surface) expr(e ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, s.fset, e); err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
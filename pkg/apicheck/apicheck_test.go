@@ -0,0 +1,124 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package apicheck
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const module = "github.com/mattermost/cicd-sdk"
+
+var update = flag.Bool("update", false, "record the additions to the current API in api/v1.txt")
+
+// baseRefEnv names the variable with the git ref of the API record the
+// changes are checked against, eg the base branch of a pull request
+const baseRefEnv = "APICHECK_BASE_REF"
+
+// TestStableAPI checks that the API recorded in api/v1.txt is still
+// there. New declarations are fine, removing or changing a recorded one
+// breaks the code depending on it: keep the old one as a deprecated shim.
+// The -update flag only records additions, it fails like the test when a
+// recorded declaration is gone.
+func TestStableAPI(t *testing.T) {
+	root := filepath.Join("..", "..")
+	apiFile := filepath.Join(root, "api", "v1.txt")
+	current, err := ModuleSurface(module, root)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(apiFile)
+	require.NoError(t, err)
+	missing := Removed(ParseRecord(data), current)
+	require.Empty(t, missing, "the v1 API changed, keep the recorded declarations and add new ones instead")
+
+	if *update {
+		require.NoError(t, os.WriteFile(apiFile, []byte(strings.Join(current, "\n")+"\n"), os.FileMode(0o644)))
+	}
+}
+
+// TestAPIRecordAppendOnly checks that no line was removed from api/v1.txt
+// since the ref in APICHECK_BASE_REF, so editing the record by hand does
+// not hide a change of the API. It is skipped when the variable is not set.
+func TestAPIRecordAppendOnly(t *testing.T) {
+	ref := os.Getenv(baseRefEnv)
+	if ref == "" {
+		t.Skipf("%s is not set", baseRefEnv)
+	}
+	root := filepath.Join("..", "..")
+	cmd := exec.Command("git", "show", ref+":api/v1.txt")
+	cmd.Dir = root
+	base, err := cmd.Output()
+	require.NoError(t, err, "reading api/v1.txt at %s", ref)
+	data, err := os.ReadFile(filepath.Join(root, "api", "v1.txt"))
+	require.NoError(t, err)
+	require.Empty(t, Removed(ParseRecord(base), ParseRecord(data)), "lines were removed from api/v1.txt since %s", ref)
+}
+
+func TestRemoved(t *testing.T) {
+	recorded := []string{"pkg example, func New() *Options", "pkg example, type Options struct", ""}
+	require.Empty(t, Removed(recorded, append(recorded, "pkg example, func Open() error")))
+	require.Equal(t,
+		[]string{"pkg example, func New() *Options"},
+		Removed(recorded, []string{"pkg example, func New(string) *Options", "pkg example, type Options struct"}),
+	)
+	require.Equal(t, []string{"a", "b"}, ParseRecord([]byte("a\nb\n")))
+}
+
+func TestSurface(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.go"), []byte(`package example
+
+const Version = "v1"
+
+var DefaultOptions = &Options{}
+
+type Options struct {
+	Workdir string
+	Env     map[string]string
+	private bool
+}
+
+type Runner interface {
+	Run(args ...string) error
+}
+
+type client struct{}
+
+func (c *client) Exported() {}
+
+func New(opts *Options, a, b int) (*Options, error) { return opts, nil }
+
+// Deprecated: use New
+func NewDefault() *Options { return DefaultOptions }
+
+func (o *Options) Copy() *Options { return o }
+`), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example_test.go"), []byte("package example\n\nfunc TestIgnored() {}\n"), os.FileMode(0o644)))
+
+	lines, err := Surface("example.com/example", dir)
+	require.NoError(t, err)
+	prefix := "pkg example.com/example, "
+	expected := []string{
+		"const Version",
+		"func New(*Options, int, int) (*Options, error)",
+		"func NewDefault() *Options",
+		"method (*Options) Copy() *Options",
+		"type Options struct",
+		"type Options struct, Env map[string]string",
+		"type Options struct, Workdir string",
+		"type Runner interface",
+		"type Runner interface, Run(...string) error",
+		"var DefaultOptions",
+	}
+	for i := range expected {
+		expected[i] = prefix + expected[i]
+	}
+	require.Equal(t, expected, lines)
+}
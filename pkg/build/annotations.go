@@ -0,0 +1,217 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/sirupsen/logrus"
+)
+
+// LogParser extracts a compiler error or warning from a line of a run
+// log. It returns nil if the line has none.
+type LogParser func(line string) *github.CheckAnnotation
+
+// LogParsers are the parsers applied to the logs of each runner, by
+// runner ID. Runners not listed use DefaultLogParsers.
+var LogParsers = map[string][]LogParser{
+	"npm":  {ParseTypeScriptLine, ParseCompilerLine},
+	"yarn": {ParseTypeScriptLine, ParseCompilerLine},
+}
+
+// DefaultLogParsers are used for runners without their own parsers
+var DefaultLogParsers = []LogParser{ParseCompilerLine}
+
+// RegisterLogParser adds a parser for the logs of a runner. Runners
+// without parsers of their own start from the default ones.
+func RegisterLogParser(runnerID string, parser LogParser) {
+	if _, ok := LogParsers[runnerID]; !ok {
+		LogParsers[runnerID] = append([]LogParser{}, DefaultLogParsers...)
+	}
+	LogParsers[runnerID] = append(LogParsers[runnerID], parser)
+}
+
+var (
+	// compilerRegexp matches the file:line:col: [level:] message format used
+	// by the go toolchain, gcc, clang and many linters
+	compilerRegexp = regexp.MustCompile(
+		`^\s*([^\s:]+\.[A-Za-z0-9]+):(\d+)(?::(\d+))?:\s+(?:(fatal error|error|warning|note):\s+)?(.+)$`,
+	)
+
+	// typeScriptRegexp matches tsc errors: file(line,col): error TS1234: message
+	typeScriptRegexp = regexp.MustCompile(`^\s*([^\s(]+)\((\d+),(\d+)\):\s+(error|warning)\s+(TS\d+:\s+.+)$`)
+)
+
+// ParseCompilerLine parses errors in the file:line:col: message format.
+// Lines without a level are reported as failures.
+func ParseCompilerLine(line string) *github.CheckAnnotation {
+	m := compilerRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	lineNumber, err := strconv.Atoi(m[2])
+	if err != nil {
+		return nil
+	}
+	level := github.AnnotationFailure
+	switch m[4] {
+	case "warning":
+		level = github.AnnotationWarning
+	case "note":
+		level = github.AnnotationNotice
+	}
+	return &github.CheckAnnotation{
+		Path:      m[1],
+		StartLine: lineNumber,
+		Level:     level,
+		Message:   m[5],
+	}
+}
+
+// ParseTypeScriptLine parses errors reported by the TypeScript compiler
+func ParseTypeScriptLine(line string) *github.CheckAnnotation {
+	m := typeScriptRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	lineNumber, err := strconv.Atoi(m[2])
+	if err != nil {
+		return nil
+	}
+	level := github.AnnotationFailure
+	if m[4] == "warning" {
+		level = github.AnnotationWarning
+	}
+	return &github.CheckAnnotation{
+		Path:      m[1],
+		StartLine: lineNumber,
+		Level:     level,
+		Message:   m[5],
+	}
+}
+
+// Annotations parses the logs of the last attempt of the run with the
+// log parsers of its runner. Paths are made relative to the workdir and
+// annotations on files outside of it are dropped.
+func (r *Run) Annotations() ([]*github.CheckAnnotation, error) {
+	if r.Attempts == 0 {
+		return nil, errors.New("run has not executed its runner yet")
+	}
+	if len(r.Logs) < r.Attempts {
+		return nil, fmt.Errorf("run has no log of attempt %d", r.Attempts)
+	}
+	parsers, ok := LogParsers[r.runner.ID()]
+	if !ok {
+		parsers = DefaultLogParsers
+	}
+	workdir, err := filepath.Abs(r.runner.Options().Workdir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving workdir path: %w", err)
+	}
+
+	annotations := []*github.CheckAnnotation{}
+	seen := map[string]bool{}
+	logs := []string{r.Logs[r.Attempts-1]}
+	if len(r.ErrorLogs) >= r.Attempts {
+		logs = append(logs, r.ErrorLogs[r.Attempts-1])
+	}
+	for _, log := range logs {
+		f, err := os.Open(log)
+		if err != nil {
+			return nil, fmt.Errorf("opening run log: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			for _, parse := range parsers {
+				a := parse(scanner.Text())
+				if a == nil {
+					continue
+				}
+				if a.Path, ok = repoPath(workdir, a.Path); !ok {
+					break
+				}
+				key := fmt.Sprintf("%s:%d:%s", a.Path, a.StartLine, a.Message)
+				if !seen[key] {
+					seen[key] = true
+					annotations = append(annotations, a)
+				}
+				break
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading run log %s: %w", log, err)
+		}
+	}
+	return annotations, nil
+}
+
+// repoPath returns the path relative to the workdir. The second value
+// is false when the path is outside the workdir.
+func repoPath(workdir, path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workdir, path)
+	}
+	rel, err := filepath.Rel(workdir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// PublishCheckRun creates a check run named name on the build point
+// commit in repo. The check run concludes with the result of the run and
+// includes the errors and warnings found in its log as annotations.
+func (r *Run) PublishCheckRun(ctx context.Context, repo *github.Repository, name string) (*github.CheckRun, error) {
+	if r.isSuccess == nil {
+		return nil, errors.New("unable to publish check run, run has not finished")
+	}
+	if r.opts.BuildPoint == "" {
+		return nil, errors.New("unable to publish check run, build point is not known")
+	}
+	annotations, err := r.Annotations()
+	if err != nil {
+		return nil, fmt.Errorf("parsing run logs: %w", err)
+	}
+
+	conclusion := github.CheckConclusionFailure
+	if *r.isSuccess {
+		conclusion = github.CheckConclusionSuccess
+	}
+
+	logrus.Infof("Publishing check run %s with %d annotations", name, len(annotations))
+	check, err := repo.CreateCheckRun(ctx, name, r.opts.BuildPoint, &github.CheckRunOptions{
+		Title:      fmt.Sprintf("%s build", r.runner.ID()),
+		Summary:    checkRunSummary(r, conclusion, annotations),
+		Conclusion: conclusion,
+	}, annotations)
+	if err != nil {
+		return nil, fmt.Errorf("creating check run: %w", err)
+	}
+	return check, nil
+}
+
+// checkRunSummary returns the summary of the check run of a finished run
+func checkRunSummary(r *Run, conclusion string, annotations []*github.CheckAnnotation) string {
+	counts := map[string]int{}
+	for _, a := range annotations {
+		counts[a.Level]++
+	}
+	return fmt.Sprintf(
+		"Run #%s finished with %s in %s: %d errors, %d warnings.",
+		r.ID(), conclusion, r.EndTime.Sub(r.StartTime).Round(time.Second),
+		counts[github.AnnotationFailure], counts[github.AnnotationWarning],
+	)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/mattermost/cicd-sdk/pkg/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogParsers(t *testing.T) {
+	for _, tc := range []struct {
+		parser   LogParser
+		line     string
+		expected *github.CheckAnnotation
+	}{
+		{ParseCompilerLine, "./pkg/build/run.go:42:5: undefined: foo", &github.CheckAnnotation{
+			Path: "./pkg/build/run.go", StartLine: 42, Level: github.AnnotationFailure, Message: "undefined: foo",
+		}},
+		{ParseCompilerLine, "src/main.c:7:3: warning: unused variable 'x'", &github.CheckAnnotation{
+			Path: "src/main.c", StartLine: 7, Level: github.AnnotationWarning, Message: "unused variable 'x'",
+		}},
+		{ParseCompilerLine, "    run_test.go:12: expected 1, got 2", &github.CheckAnnotation{
+			Path: "run_test.go", StartLine: 12, Level: github.AnnotationFailure, Message: "expected 1, got 2",
+		}},
+		{ParseCompilerLine, "make: *** [Makefile:3: build] Error 1", nil},
+		{ParseCompilerLine, "downloading https://example.com:443/file", nil},
+		{ParseTypeScriptLine, "src/app.ts(10,4): error TS2304: Cannot find name 'foo'.", &github.CheckAnnotation{
+			Path: "src/app.ts", StartLine: 10, Level: github.AnnotationFailure, Message: "TS2304: Cannot find name 'foo'.",
+		}},
+		{ParseTypeScriptLine, "./pkg/build/run.go:42:5: undefined: foo", nil},
+	} {
+		require.Equal(t, tc.expected, tc.parser(tc.line), tc.line)
+	}
+}
+
+func TestPublishCheckRun(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: build\nbuild:\n"+
+			"\t@echo './main.go:10:2: undefined: foo' >&2\n"+
+			"\t@echo '"+filepath.Join(dir, "util.go")+":3:1: warning: unused import' >&2\n"+
+			"\t@echo '/usr/lib/go/src/fmt/print.go:1:1: outside the repository' >&2\n"+
+			"\t@exit 1\n"),
+		os.FileMode(0o644)),
+	)
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake("build")
+	runner.Options().Workdir = dir
+
+	const sha = "46305d50a15717e2d224e38f2f2bdc9027a7cbc7"
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{BuildPoint: sha}}
+	require.Error(t, r.runWithRetries())
+	for _, l := range append(r.Logs, r.ErrorLogs...) {
+		defer os.Remove(l)
+	}
+	r.isSuccess = &RUNFAIL
+
+	annotations, err := r.Annotations()
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	require.Equal(t, "main.go", annotations[0].Path)
+	require.Equal(t, "util.go", annotations[1].Path)
+	require.Equal(t, github.AnnotationWarning, annotations[1].Level)
+
+	// Attempts without a log fail instead of indexing the logs
+	broken := &Run{impl: &defaultRunImplementation{}, runner: runner, Attempts: 1}
+	_, err = broken.Annotations()
+	require.Error(t, err)
+
+	var request map[string]interface{}
+	gh := testharness.New(t).GitHub()
+	gh.Handle("/repos/mattermost/cicd-sdk/check-runs", func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 1, "head_sha": "` + sha + `", "conclusion": "failure"}`)) //nolint:errcheck
+	})
+
+	check, err := r.PublishCheckRun(context.Background(), github.NewRepository("mattermost", "cicd-sdk"), "mmbuild")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), check.ID)
+	require.Equal(t, sha, request["head_sha"])
+	require.Equal(t, github.CheckConclusionFailure, request["conclusion"])
+	output := request["output"].(map[string]interface{})
+	require.Len(t, output["annotations"], 2)
+	require.Contains(t, output["summary"], "1 errors, 1 warnings")
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandArguments(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runners.DefaultOptions.EnvVars = map[string]string{}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  steps:
+    - id: make
+      params: ["VERSION=${COMMIT_SHA}", "package"]
+    - id: make
+      params: ["RUN=${MMBUILD_RUN_ID}"]
+env:
+  - var: COMMIT_SHA
+    value: d642f2cd18bf96a3da793d6e594da3b7029c6ca2
+  - var: TARGET
+    value: ${COMMIT_SHA}
+`), os.FileMode(0o644)))
+
+	// The rest of the configuration is replaced when loading it
+	c, err := LoadConfig(conf)
+	require.NoError(t, err)
+	require.Equal(t, "d642f2cd18bf96a3da793d6e594da3b7029c6ca2", c.Env[1].Value)
+	require.Equal(t, []string{"VERSION=${COMMIT_SHA}", "package"}, c.Runner.Steps[0].Parameters)
+
+	// The runner arguments are expanded when the run starts
+	b, err := NewFromConfigFile(conf)
+	require.NoError(t, err)
+	b.Options().Workdir = dir
+	r := b.Run()
+	r.setRunnerOptions()
+	require.NoError(t, r.expandArguments())
+	expected := []string{
+		"step:make", "VERSION=d642f2cd18bf96a3da793d6e594da3b7029c6ca2", "package",
+		"step:make", "RUN=" + r.ID(),
+	}
+	require.Equal(t, expected, r.Runner().Arguments())
+
+	// And recorded expanded in the provenance
+	statement, err := r.Provenance()
+	require.NoError(t, err)
+	params, err := ParseProvenanceParameters(statement.Predicate.BuildType, statement.Predicate.Invocation.Parameters)
+	require.NoError(t, err)
+	require.Equal(t, expected, params.Arguments)
+
+	// Like when loading the configuration, variables are read from the
+	// system environment too, even if the runner one is clean, and those
+	// without a value are replaced with an empty string
+	t.Setenv("MMBUILD_TEST_SYSTEM_VERSION", "7.1.0")
+	r.Runner().Options().CleanEnv = true
+	r.Options().Arguments = []string{
+		"step:make", "VERSION=${MMBUILD_TEST_SYSTEM_VERSION}", "SUFFIX=${UNDEFINED_SUFFIX}",
+		"step:make", "RUN=${MMBUILD_RUN_ID}",
+	}
+	require.NoError(t, r.expandArguments())
+	require.Equal(t, []string{
+		"step:make", "VERSION=7.1.0", "SUFFIX=",
+		"step:make", "RUN=" + r.ID(),
+	}, r.Runner().Arguments())
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/sirupsen/logrus"
+)
+
+// AttestationRecord is the summary of a provenance statement found in an
+// attestation store
+type AttestationRecord struct {
+	URL         string                       `json:"url"`                   // URL of the statement
+	BuildType   string                       `json:"buildType"`             // Runner of the build
+	Source      string                       `json:"source,omitempty"`      // URI of the source code material
+	BuildPoint  string                       `json:"buildPoint,omitempty"`  // Commit built
+	Subjects    map[string]map[string]string `json:"subjects"`              // Digest sets of the artifacts, by name
+	Started     time.Time                    `json:"started"`               // When the build started
+	Finished    time.Time                    `json:"finished"`              // When the build finished
+	Annotations map[string]string            `json:"annotations,omitempty"` // Annotations of the run
+	Size        int64                        `json:"size"`                  // Size of the statement, to detect changes
+	Modified    time.Time                    `json:"modified"`              // When the statement was written, to detect changes
+}
+
+// AttestationQuery selects records of an attestation index. Empty fields
+// match all the records.
+type AttestationQuery struct {
+	Digest     string    // Digest of an artifact, eg sha256:1d3f.. The algorithm is optional
+	BuildPoint string    // Commit built
+	Since      time.Time // Builds started at or after this time
+	Until      time.Time // Builds started before this time
+}
+
+// AttestationIndex indexes the provenance statements stored under a URL
+// prefix, like the artifacts destination of the builds, to find them by
+// artifact digest, commit or date without downloading them each time.
+// Records are kept in a local cache and only new or changed statements
+// are downloaded when the index is refreshed.
+type AttestationIndex struct {
+	Prefix   string          // URL prefix where the attestations are stored, eg s3://builds/server/
+	CacheDir string          // Directory of the local index cache. Empty disables the cache
+	Manager  *object.Manager // Object manager to list and download the statements. A default one if nil
+
+	records      []AttestationRecord
+	byDigest     map[string][]int
+	byBuildPoint map[string][]int
+}
+
+// NewAttestationIndex returns an empty index of the attestations under
+// prefixURL. Call Refresh to read them.
+func NewAttestationIndex(prefixURL, cacheDir string) *AttestationIndex {
+	return &AttestationIndex{Prefix: prefixURL, CacheDir: cacheDir}
+}
+
+// cacheFile returns the path of the cache of the index, named after the
+// prefix so indexes of several stores can share the directory
+func (ai *AttestationIndex) cacheFile() string {
+	if ai.CacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(ai.Prefix))
+	return filepath.Join(ai.CacheDir, "attestations-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// readCache returns the cached records by URL
+func (ai *AttestationIndex) readCache() (map[string]AttestationRecord, error) {
+	cached := map[string]AttestationRecord{}
+	if ai.cacheFile() == "" {
+		return cached, nil
+	}
+	data, err := os.ReadFile(ai.cacheFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cached, nil
+		}
+		return nil, fmt.Errorf("reading index cache: %w", err)
+	}
+	records := []AttestationRecord{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		logrus.Warnf("Discarding invalid attestation index cache %s: %v", ai.cacheFile(), err)
+		return cached, nil
+	}
+	for _, rec := range records {
+		cached[rec.URL] = rec
+	}
+	return cached, nil
+}
+
+func (ai *AttestationIndex) writeCache() error {
+	if ai.cacheFile() == "" {
+		return nil
+	}
+	data, err := json.Marshal(ai.records)
+	if err != nil {
+		return fmt.Errorf("marshaling index cache: %w", err)
+	}
+	if err := os.MkdirAll(ai.CacheDir, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating index cache directory: %w", err)
+	}
+	if err := os.WriteFile(ai.cacheFile(), data, os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing index cache: %w", err)
+	}
+	return nil
+}
+
+// Refresh lists the statements under the prefix and reads the ones not in
+// the cache or changed since they were cached. Statements which cannot be
+// parsed are skipped with a warning.
+func (ai *AttestationIndex) Refresh() error {
+	manager := ai.Manager
+	if manager == nil {
+		manager = object.NewManager()
+	}
+	cached, err := ai.readCache()
+	if err != nil {
+		return err
+	}
+	objects, err := manager.List(ai.Prefix)
+	if err != nil {
+		return fmt.Errorf("listing attestations: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "attestation-index-")
+	if err != nil {
+		return fmt.Errorf("creating download directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	records := []AttestationRecord{}
+	downloaded := 0
+	for _, o := range objects {
+		if path.Base(o.URL) != ProvenanceFilename {
+			continue
+		}
+		if rec, ok := cached[o.URL]; ok && rec.Size == o.Size && rec.Modified.Equal(o.Modified) {
+			records = append(records, rec)
+			continue
+		}
+		localPath := filepath.Join(dir, fmt.Sprintf("%d-%s", downloaded, ProvenanceFilename))
+		downloaded++
+		if err := manager.Copy(o.URL, object.FileURL(localPath)); err != nil {
+			return fmt.Errorf("downloading attestation: %w", err)
+		}
+		rec, err := readAttestationRecord(localPath)
+		if err != nil {
+			logrus.Warnf("Skipping attestation %s: %v", o.URL, err)
+			continue
+		}
+		rec.URL, rec.Size, rec.Modified = o.URL, o.Size, o.Modified
+		records = append(records, *rec)
+	}
+	logrus.Infof("Indexed %d attestations under %s, %d downloaded", len(records), ai.Prefix, downloaded)
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Started.Before(records[j].Started) })
+	ai.records = records
+	ai.byDigest = map[string][]int{}
+	ai.byBuildPoint = map[string][]int{}
+	for i, rec := range records {
+		for _, digests := range rec.Subjects {
+			for algo, d := range digests {
+				ai.byDigest[algo+":"+d] = append(ai.byDigest[algo+":"+d], i)
+				ai.byDigest[d] = append(ai.byDigest[d], i)
+			}
+		}
+		if rec.BuildPoint != "" {
+			ai.byBuildPoint[rec.BuildPoint] = append(ai.byBuildPoint[rec.BuildPoint], i)
+		}
+	}
+	return ai.writeCache()
+}
+
+// readAttestationRecord summarizes the provenance statement in a file
+func readAttestationRecord(path string) (*AttestationRecord, error) {
+	statement, err := loadAttestation(path)
+	if err != nil {
+		return nil, err
+	}
+	if statement.PredicateType == "" {
+		return nil, errors.New("file is not a provenance statement")
+	}
+	rec := &AttestationRecord{
+		BuildType: statement.Predicate.BuildType,
+		Subjects:  map[string]map[string]string{},
+	}
+	for _, s := range statement.Subject {
+		rec.Subjects[s.Name] = s.Digest
+	}
+	if len(statement.Predicate.Materials) > 0 {
+		rec.Source = statement.Predicate.Materials[0].URI
+		rec.BuildPoint = statement.Predicate.Materials[0].Digest["sha1"]
+	}
+	if md := statement.Predicate.Metadata; md != nil {
+		if md.BuildStartedOn != nil {
+			rec.Started = *md.BuildStartedOn
+		}
+		if md.BuildFinishedOn != nil {
+			rec.Finished = *md.BuildFinishedOn
+		}
+	}
+	if config, ok := statement.Predicate.BuildConfig.(map[string]interface{}); ok {
+		if annotations, ok := config["annotations"].(map[string]interface{}); ok {
+			rec.Annotations = map[string]string{}
+			for k, v := range annotations {
+				rec.Annotations[k] = fmt.Sprint(v)
+			}
+		}
+	}
+	return rec, nil
+}
+
+// Records returns all the records of the index, sorted by start time
+func (ai *AttestationIndex) Records() []AttestationRecord {
+	return append([]AttestationRecord{}, ai.records...)
+}
+
+// Search returns the records matching a query, sorted by start time
+func (ai *AttestationIndex) Search(q AttestationQuery) []AttestationRecord {
+	var candidates []int
+	switch {
+	case q.Digest != "":
+		candidates = ai.byDigest[strings.ToLower(q.Digest)]
+	case q.BuildPoint != "":
+		candidates = ai.byBuildPoint[q.BuildPoint]
+	default:
+		for i := range ai.records {
+			candidates = append(candidates, i)
+		}
+	}
+
+	// Digests of several algorithms may point to the same record
+	seen := map[int]bool{}
+	results := []AttestationRecord{}
+	for _, i := range candidates {
+		rec := ai.records[i]
+		if seen[i] ||
+			(q.BuildPoint != "" && rec.BuildPoint != q.BuildPoint) ||
+			(!q.Since.IsZero() && rec.Started.Before(q.Since)) ||
+			(!q.Until.IsZero() && !rec.Started.Before(q.Until)) {
+			continue
+		}
+		seen[i] = true
+		results = append(results, rec)
+	}
+	return results
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	v02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestStatement writes a provenance statement of a build of commit
+// to dir/provenance.json
+func writeTestStatement(t *testing.T, dir, commit, artifactDigest string, started time.Time) {
+	statement := intoto.ProvenanceStatement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: v02.PredicateSLSAProvenance,
+			Subject: []intoto.Subject{
+				{Name: "dist/server.tar.gz", Digest: map[string]string{"sha256": artifactDigest}},
+			},
+		},
+		Predicate: v02.ProvenancePredicate{
+			BuildType: "make",
+			Materials: []v02.ProvenanceMaterial{
+				{URI: "git+https://github.com/mattermost/server", Digest: map[string]string{"sha1": commit}},
+			},
+			Metadata:    &v02.ProvenanceMetadata{BuildStartedOn: &started, BuildFinishedOn: &started},
+			BuildConfig: map[string]interface{}{"annotations": map[string]string{"ticket": "MM-1234"}},
+		},
+	}
+	data, err := json.Marshal(statement)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(dir, os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ProvenanceFilename), data, os.FileMode(0o644)))
+}
+
+func TestAttestationIndex(t *testing.T) {
+	store, cache := t.TempDir(), t.TempDir()
+	day := time.Date(2021, 10, 4, 12, 0, 0, 0, time.UTC)
+	writeTestStatement(t, filepath.Join(store, "a"), "d642f2cd", "aaaa", day)
+	writeTestStatement(t, filepath.Join(store, "b"), "d642f2cd", "bbbb", day.Add(48*time.Hour))
+	writeTestStatement(t, filepath.Join(store, "c"), "5f1e3a21", "cccc", day.Add(24*time.Hour))
+	// Other objects in the store are not indexed
+	require.NoError(t, os.WriteFile(filepath.Join(store, "a", "server.tar.gz"), []byte("data"), os.FileMode(0o644)))
+
+	index := NewAttestationIndex(object.FileURL(store)+"/", cache)
+	require.NoError(t, index.Refresh())
+	require.Len(t, index.Records(), 3)
+
+	// All the builds of a commit, sorted by date
+	records := index.Search(AttestationQuery{BuildPoint: "d642f2cd"})
+	require.Len(t, records, 2)
+	require.Equal(t, object.FileURL(filepath.Join(store, "a", ProvenanceFilename)), records[0].URL)
+	require.Equal(t, object.FileURL(filepath.Join(store, "b", ProvenanceFilename)), records[1].URL)
+	require.Equal(t, "make", records[0].BuildType)
+	require.Equal(t, map[string]string{"ticket": "MM-1234"}, records[0].Annotations)
+
+	// Artifacts are found by digest, with or without the algorithm
+	records = index.Search(AttestationQuery{Digest: "sha256:cccc"})
+	require.Len(t, records, 1)
+	require.Equal(t, "5f1e3a21", records[0].BuildPoint)
+	require.Len(t, index.Search(AttestationQuery{Digest: "cccc"}), 1)
+	require.Empty(t, index.Search(AttestationQuery{Digest: "sha512:cccc"}))
+
+	// And by date
+	records = index.Search(AttestationQuery{Since: day.Add(time.Hour)})
+	require.Len(t, records, 2)
+	require.Equal(t, "5f1e3a21", records[0].BuildPoint)
+	records = index.Search(AttestationQuery{BuildPoint: "d642f2cd", Until: day.Add(time.Hour)})
+	require.Len(t, records, 1)
+	require.Equal(t, "aaaa", records[0].Subjects["dist/server.tar.gz"]["sha256"])
+
+	// Unchanged statements are read from the cache: a statement replaced
+	// keeping its size and time is not downloaded again
+	path := filepath.Join(store, "c", ProvenanceFilename)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for i := range data {
+		data[i] = ' '
+	}
+	require.NoError(t, os.WriteFile(path, data, os.FileMode(0o644)))
+	require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	index = NewAttestationIndex(object.FileURL(store)+"/", cache)
+	require.NoError(t, index.Refresh())
+	require.Len(t, index.Search(AttestationQuery{Digest: "sha256:cccc"}), 1)
+
+	// Changed statements are read again, invalid ones are skipped
+	require.NoError(t, os.Chtimes(path, info.ModTime().Add(time.Hour), info.ModTime().Add(time.Hour)))
+	require.NoError(t, index.Refresh())
+	require.Len(t, index.Records(), 2)
+	require.Empty(t, index.Search(AttestationQuery{Digest: "sha256:cccc"}))
+
+	// Without a cache, all statements are downloaded
+	writeTestStatement(t, filepath.Join(store, "c"), "5f1e3a21", "cccc", day.Add(24*time.Hour))
+	index = NewAttestationIndex(object.FileURL(store)+"/", "")
+	require.NoError(t, index.Refresh())
+	require.Len(t, index.Records(), 3)
+}
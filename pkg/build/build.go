@@ -5,14 +5,16 @@ package build
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/github"
 	"github.com/mattermost/cicd-sdk/pkg/replacement"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/release-utils/command"
 	"sigs.k8s.io/release-utils/hash"
@@ -32,11 +34,11 @@ func New(runner runners.Runner) *Build {
 func loadAttestation(path string) (*intoto.ProvenanceStatement, error) {
 	attestationData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "opening provenance attestation")
+		return nil, fmt.Errorf("opening provenance attestation: %w", err)
 	}
 	statement := &intoto.ProvenanceStatement{}
 	if err := json.Unmarshal(attestationData, statement); err != nil {
-		return nil, errors.Wrapf(err, "unmarshaling attestation from %s", path)
+		return nil, fmt.Errorf("unmarshaling attestation from %s: %w", path, err)
 	}
 
 	return statement, nil
@@ -45,7 +47,7 @@ func loadAttestation(path string) (*intoto.ProvenanceStatement, error) {
 func NewFromConfigFile(configPath string) (*Build, error) {
 	b := &Build{opts: &Options{}}
 	if err := b.Load(configPath); err != nil {
-		return nil, errors.Wrap(err, "loading build config file")
+		return nil, fmt.Errorf("loading build config file: %w", err)
 	}
 	return b, nil
 }
@@ -54,27 +56,21 @@ func NewFromConfigFile(configPath string) (*Build, error) {
 func NewFromAttestation(provenancePath string, extraOpts *Options) (*Build, error) {
 	statement, err := loadAttestation(provenancePath)
 	if err != nil {
-		return nil, errors.Wrap(err, "opening attestation metadata")
+		return nil, fmt.Errorf("opening attestation metadata: %w", err)
 	}
 
 	// Read the build parameters
-	params := []string{}
-	if ifs, ok := statement.Predicate.Invocation.Parameters.([]interface{}); ok {
-		for _, i := range ifs {
-			if v, ok := i.(string); ok {
-				params = append(params, v)
-			} else {
-				logrus.Info("Unknown params")
-			}
-		}
+	params, err := ParseProvenanceParameters(
+		statement.Predicate.BuildType, statement.Predicate.Invocation.Parameters,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reading build parameters: %w", err)
 	}
 
 	// Get the runn from the attestation
-	runner, err := runners.New(
-		statement.Predicate.BuildType, params...,
-	)
+	runner, err := runners.New(params.Runner, params.Arguments...)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting build runner")
+		return nil, fmt.Errorf("getting build runner: %w", err)
 	}
 
 	b := &Build{
@@ -83,7 +79,17 @@ func NewFromAttestation(provenancePath string, extraOpts *Options) (*Build, erro
 	}
 
 	// If there is a config source, load the configuration file
-	if statement.Predicate.Invocation.ConfigSource.URI != "" {
+	if uri := statement.Predicate.Invocation.ConfigSource.URI; isConfigURL(uri) {
+		// Configurations loaded from URLs are fetched again, they
+		// must not have changed since the build
+		if err := b.Load(uri); err != nil {
+			return nil, fmt.Errorf("loading configuration file: %w", err)
+		}
+		recorded := statement.Predicate.Invocation.ConfigSource.Digest["sha256"]
+		if recorded != "" && recorded != b.Options().ConfigDigest["sha256"] {
+			return nil, fmt.Errorf("configuration at %s does not match the attested digest", uri)
+		}
+	} else if uri != "" {
 		// When done, build should checkout the config file at the specified commit
 		// we need more test repos to implement and test this.
 		logrus.Warn("ConfigSource commit digest not supported yet")
@@ -93,10 +99,10 @@ func NewFromAttestation(provenancePath string, extraOpts *Options) (*Build, erro
 			if err := b.Load(
 				filepath.Join(extraOpts.Workdir, statement.Predicate.Invocation.ConfigSource.URI),
 			); err != nil {
-				return nil, errors.Wrap(err, "loading configuration file")
+				return nil, fmt.Errorf("loading configuration file: %w", err)
 			}
 		} else {
-			return nil, errors.Errorf(
+			return nil, fmt.Errorf(
 				"unable to load config source from %s", statement.Predicate.Invocation.ConfigSource.URI,
 			)
 		}
@@ -104,7 +110,12 @@ func NewFromAttestation(provenancePath string, extraOpts *Options) (*Build, erro
 
 	// Add material #0 (which we always interpret as the main source)
 	if len(statement.Predicate.Materials) > 0 && statement.Predicate.Materials[0].URI != "" {
-		b.Options().Source = strings.TrimPrefix(statement.Predicate.Materials[0].URI, "git+")
+		// Drop the ref name recorded when the build point was a branch or tag
+		source := strings.TrimPrefix(statement.Predicate.Materials[0].URI, "git+")
+		if i := strings.LastIndex(source, "@refs/"); i != -1 {
+			source = source[:i]
+		}
+		b.Options().Source = source
 	} else {
 		logrus.Warn("Attestation does not have a materials entry for source code")
 	}
@@ -117,10 +128,17 @@ func (b *Build) RunAttestation(path string) error {
 
 	statement, err := loadAttestation(path)
 	if err != nil {
-		return errors.Wrap(err, "opening attestation metadata")
+		return fmt.Errorf("opening attestation metadata: %w", err)
+	}
+	params, err := ParseProvenanceParameters(
+		statement.Predicate.BuildType, statement.Predicate.Invocation.Parameters,
+	)
+	if err != nil {
+		return fmt.Errorf("reading build parameters: %w", err)
 	}
 	ropts := &RunOptions{
 		Materials: MaterialsConfig{},
+		Matrix:    params.Matrix,
 	}
 
 	// TODO(puerco@) if running from directory, ensure material 0 URI and
@@ -132,8 +150,10 @@ func (b *Build) RunAttestation(path string) error {
 				continue
 			}
 			ropts.Materials = append(ropts.Materials, struct {
-				URI    string            "yaml:\"uri\""
-				Digest map[string]string "yaml:\"digest\""
+				URI      string            "yaml:\"uri\""
+				Digest   map[string]string "yaml:\"digest\""
+				Headers  map[string]string "yaml:\"headers\""
+				Checksum string            "yaml:\"checksum\""
 			}{
 				URI:    m.URI,
 				Digest: m.Digest,
@@ -144,7 +164,7 @@ func (b *Build) RunAttestation(path string) error {
 	run := b.RunWithOptions(ropts)
 
 	if err := run.Execute(); err != nil {
-		return errors.Wrap(err, "running attestation")
+		return fmt.Errorf("running attestation: %w", err)
 	}
 
 	// Check the expected artifacts
@@ -155,22 +175,18 @@ func (b *Build) RunAttestation(path string) error {
 
 	logrus.Infof("Checking %d artifacts from the build", len(statement.Subject))
 	for _, sub := range statement.Subject {
-		s256, err := hash.SHA256ForFile(filepath.Join(b.opts.Workdir, sub.Name))
+		// The artifacts were hashed for the provenance of the run
+		digests, err := run.digestCache().fileDigests(filepath.Join(b.opts.Workdir, sub.Name))
 		if err != nil {
-			return errors.Wrapf(err, "checking hash for %s ", sub.Name)
+			return fmt.Errorf("checking hash for %s : %w", sub.Name, err)
 		}
 
-		s512, err := hash.SHA512ForFile(filepath.Join(b.opts.Workdir, sub.Name))
-		if err != nil {
-			return errors.Wrapf(err, "checking hash for %s ", sub.Name)
+		if digests["sha256"] != sub.Digest["sha256"] {
+			return fmt.Errorf("SHA256 for %s does not match", sub.Name)
 		}
 
-		if s256 != sub.Digest["sha256"] {
-			return errors.Errorf("SHA256 for %s does not match", sub.Name)
-		}
-
-		if s512 != sub.Digest["sha512"] {
-			return errors.Errorf("SHA512 for %s does not match", sub.Name)
+		if digests["sha512"] != sub.Digest["sha512"] {
+			return fmt.Errorf("SHA512 for %s does not match", sub.Name)
 		}
 	}
 
@@ -191,20 +207,46 @@ type Build struct {
 	opts         *Options
 	Runs         []*Run
 	Replacements []replacement.Replacement
+
+	webhooks []func() // Unsubscribe the webhooks of the loaded configuration from the event bus
 }
 
 type Options struct {
-	ForceBuild    bool              // Execut the builder even if the expected artifacts are found
-	SBOM          bool              // If true, write an SPDX sbom describing the expected artifacts
-	Workdir       string            // Working directory. Usually the clone of the repo
-	Source        string            // Source is the URL for the code repository
-	EnvVars       map[string]string // Variables to set when running
-	ProvenanceDir string            // FIrectory to save the provenance attestations
-	ConfigFile    string            // If the build was bootstarpped from a build, this is it
-	ConfigPoint   string            // git ref of the config file
-	Transfers     []TransferConfig  // List of artifacts to transfer
-	Artifacts     ArtifactsConfig   // A list of expected artifacts to be produced by the build
-	Materials     MaterialsConfig   // List of materials to use for the build
+	ForceBuild     bool               // Execut the builder even if the expected artifacts are found
+	SBOM           bool               // If true, write an SPDX sbom describing the expected artifacts
+	Workdir        string             // Working directory. Usually the clone of the repo
+	Source         string             // Source is the URL for the code repository
+	EnvVars        map[string]string  // Variables to set when running
+	ProvenanceDir  string             // FIrectory to save the provenance attestations
+	ConfigFile     string             // If the build was bootstarpped from a build, this is it
+	ConfigPoint    string             // git ref of the config file
+	ConfigDigest   map[string]string  // Digest of a config file downloaded from a URL, recorded instead of the ConfigPoint
+	Branch         string             // Branch selecting the configuration profile. Detected from the CI or the repository if empty
+	Transfers      []TransferConfig   // List of artifacts to transfer
+	Artifacts      ArtifactsConfig    // A list of expected artifacts to be produced by the build
+	Materials      MaterialsConfig    // List of materials to use for the build
+	MaterialLimits MaterialLimits     // Download limits of the materials, by URI
+	Timeout        time.Duration      // Maximum duration of each build run. Zero means no limit
+	RetryCount     int                // Number of times a failed run is retried
+	RetryBackoff   time.Duration      // Time to wait before retrying, doubled on each retry
+	ExistenceCheck ExistenceChecker   // Strategy to decide if a run can be skipped
+	ExistsCacheTTL time.Duration      // Time the existence checks cache the objects they find. Zero disables the cache
+	CleanEnv       bool               // Run without inheriting the environment, only EnvVars and EnvAllowlist are set
+	EnvAllowlist   []string           // Variables passed from the environment when CleanEnv is set
+	Tests          TestsConfig        // Test reports to collect after the build
+	Coverage       CoverageConfig     // Coverage reports to collect after the build
+	DryRun         bool               // Only plan the runs, without building or copying anything
+	Cache          CacheConfig        // Build cache to restore the artifacts from instead of building them
+	Hooks          HooksConfig        // Shell commands to run at points of each run
+	Log            LogConfig          // Where the runs keep their logs
+	Annotations    map[string]string  // Metadata recorded in the provenance and the results of the runs
+	Events         *EventBus          // Bus where the runs publish their events. Nil disables them
+	GitHubStatus   GitHubStatusConfig // Commit statuses or check runs reporting the runs on GitHub
+	Secrets        SecretsProvider    // Provider of the secrets of the configuration. Defaults to the providers it defines
+	SecretVars     []string           // EnvVars holding secret or sensitive values, not recorded in the provenance
+	MaskedValues   []string           // Values masked in the runner output and the provenance, like the secrets
+	MaskedPatterns []string           // Regular expressions of other values masked in the runner output
+	Arguments      []string           // Runner arguments of the configuration, expanded when each run starts
 }
 
 var DefaultOptions = &Options{
@@ -223,27 +265,66 @@ func (b *Build) Options() *Options {
 
 // setRunnerOptions sets the runner options
 func (b *Build) setRunnerOptions() {
-	b.runner.Options().Workdir = b.Options().Workdir
-	b.runner.Options().EnvVars = b.Options().EnvVars
-	b.runner.Options().ProvenanceDir = b.Options().ProvenanceDir
-	b.runner.Options().Replacements = b.Replacements
-	b.runner.Options().Source = b.Options().Source
-	b.runner.Options().ConfigFile = b.Options().ConfigFile
-	b.runner.Options().ConfigPoint = b.Options().ConfigPoint
-	for i := range b.runner.Options().Replacements {
-		b.runner.Options().Replacements[i].Workdir = b.Options().Workdir
+	b.configureRunner(b.runner, b.Options().Workdir)
+}
+
+// configureRunner sets the options of runner from the build options,
+// running it in workdir
+func (b *Build) configureRunner(runner runners.Runner, workdir string) {
+	runner.Options().Workdir = workdir
+	runner.Options().EnvVars = map[string]string{}
+	for v, val := range b.Options().EnvVars {
+		runner.Options().EnvVars[v] = val
+	}
+	runner.Options().CleanEnv = b.Options().CleanEnv
+	runner.Options().EnvAllowlist = b.Options().EnvAllowlist
+	runner.Options().SecretVars = append([]string(nil), b.Options().SecretVars...)
+	runner.Options().MaskedValues = append([]string(nil), b.Options().MaskedValues...)
+	runner.Options().MaskedPatterns = append([]string(nil), b.Options().MaskedPatterns...)
+	runner.Options().ProvenanceDir = b.Options().ProvenanceDir
+	runner.Options().Replacements = append([]replacement.Replacement(nil), b.Replacements...)
+	runner.Options().Source = b.Options().Source
+	runner.Options().ConfigFile = b.Options().ConfigFile
+	runner.Options().ConfigPoint = b.Options().ConfigPoint
+	runner.Options().ConfigDigest = b.Options().ConfigDigest
+	for i := range runner.Options().Replacements {
+		runner.Options().Replacements[i].Workdir = workdir
 	}
 }
 
 // Run creates a new run
 func (b *Build) Run() *Run {
-	opts := DefaultRunOptions
+	return b.RunWithOptions(b.runOptions())
+}
+
+// runOptions returns a new set of run options from the build options
+func (b *Build) runOptions() *RunOptions {
+	opts := *DefaultRunOptions
 	opts.Transfers = b.Options().Transfers
 	opts.Materials = b.Options().Materials
+	opts.MaterialLimits = b.Options().MaterialLimits
 	opts.Artifacts = b.Options().Artifacts
+	// Runs add the artifacts they find or write, they get their own lists
+	opts.Artifacts.Files = append([]string(nil), opts.Artifacts.Files...)
+	opts.Artifacts.Images = append([]string(nil), opts.Artifacts.Images...)
 	opts.ForceBuild = b.Options().ForceBuild
 	opts.SBOM = b.Options().SBOM
-	return b.RunWithOptions(opts)
+	opts.Timeout = b.Options().Timeout
+	opts.RetryCount = b.Options().RetryCount
+	opts.RetryBackoff = b.Options().RetryBackoff
+	opts.ExistenceCheck = b.Options().ExistenceCheck
+	opts.ExistsCacheTTL = b.Options().ExistsCacheTTL
+	opts.Tests = b.Options().Tests
+	opts.Coverage = b.Options().Coverage
+	opts.DryRun = b.Options().DryRun
+	opts.Cache = b.Options().Cache
+	opts.Hooks = b.Options().Hooks
+	opts.Log = b.Options().Log
+	opts.Annotations = b.Options().Annotations
+	opts.Events = b.Options().Events
+	opts.GitHubStatus = b.Options().GitHubStatus
+	opts.Arguments = b.Options().Arguments
+	return &opts
 }
 
 func (b *Build) RunWithOptions(opts *RunOptions) *Run {
@@ -257,29 +338,57 @@ func (b *Build) RunWithOptions(opts *RunOptions) *Run {
 	// The ID is the new run position in the run array:
 	run.id = len(b.Runs)
 	b.Runs = append(b.Runs, run)
+
+	// Report the run on its commit when configured
+	if opts.GitHubStatus.Repository != "" {
+		owner, name, err := splitRepository(opts.GitHubStatus.Repository)
+		if err != nil {
+			logrus.Errorf("Not reporting run %s on GitHub: %v", run.ID(), err)
+			return run
+		}
+		run.ReportStatus(github.NewRepository(owner, name), opts.GitHubStatus)
+	}
 	return run
 }
 
-// LoadConfig loads the build configuration from a file
+// LoadConfig loads the build configuration from a file. The path can be
+// a URL supported by the object manager, the file is downloaded and its
+// URL and digest are recorded as the config source in the provenance.
 func (b *Build) Load(path string) error {
-	conf, err := LoadConfig(path)
+	configFile := path
+	b.Options().ConfigDigest = nil
+	if isConfigURL(path) {
+		localPath, digest, cleanup, err := fetchConfig(path)
+		defer cleanup()
+		if err != nil {
+			return fmt.Errorf("fetching remote config: %w", err)
+		}
+		path = localPath
+		b.Options().ConfigDigest = digest
+	}
+
+	conf, err := LoadConfigForBranch(path, b.Options().Branch)
 	if err != nil {
-		return errors.Wrap(err, "opening config")
+		return fmt.Errorf("opening config: %w", err)
 	}
 
 	// Initialize the runner from the configuration:
-	logrus.Infof("Runner (%s) parameters: %+v", conf.Runner.ID, conf.Runner.Parameters)
-	runner, err := runners.New(conf.Runner.ID, conf.Runner.Parameters...)
+	runnerID, runnerParams := conf.Runner.RunnerArguments()
+	logrus.Infof("Runner (%s) parameters: %+v", runnerID, runnerParams)
+	runner, err := runners.New(runnerID, runnerParams...)
 	if err != nil {
-		return errors.Wrap(err, "initializing runner from config file")
+		return fmt.Errorf("initializing runner from config file: %w", err)
 	}
 	b.runner = runner
+	b.Options().Arguments = append([]string{}, runnerParams...)
 
 	// Load the secrets, we do this before replacements
 	// because we are going to need them
-
-	// TODO: Merge secrets from branch
-	// Secrets      []SecretConfig      `yaml:"secrets"`      // Secrets required by the build
+	secrets, err := resolveSecrets(conf, b.Options().Secrets)
+	if err != nil {
+		return fmt.Errorf("resolving build secrets: %w", err)
+	}
+	logrus.Infof("Resolved %d build secrets", len(secrets))
 
 	// Build the replacement set:
 	if b.Replacements == nil {
@@ -293,25 +402,77 @@ func (b *Build) Load(path string) error {
 			Paths:         rdata.Paths,
 			PathsRequired: rdata.RequiredPaths,
 			Required:      rdata.Required,
+			Secret:        rdata.ValueFrom.Secret != "",
+			StateFile:     conf.ReplacementState,
+			FailOnReapply: conf.FailOnReapply,
+		}
+		if rep.Secret {
+			rep.Value = secrets[rdata.ValueFrom.Secret]
+		}
+		if rdata.NoSymlinks {
+			rep.Symlinks = replacement.SymlinksRefuse
 		}
 		reps = append(reps, rep)
 	}
 	b.Replacements = reps
 
 	for _, e := range conf.Env {
-		b.runner.Options().EnvVars[e.Var] = e.Value
+		b.runner.Options().EnvVars[e.Var] = envValue(&e, secrets)
 	}
 
 	b.Options().ProvenanceDir = conf.ProvenanceDir
-	b.Options().ConfigFile = path          // Check if its normalized to the repo dir
+	b.Options().ConfigFile = configFile    // Check if its normalized to the repo dir
 	b.Options().Transfers = conf.Transfers // Artifacts to transfer out
 	b.Options().Materials = conf.Materials // List of the build materials
+	b.Options().Tests = conf.Tests         // Test reports to collect
+	b.Options().Coverage = conf.Coverage   // Coverage reports to collect
+	b.Options().Hooks = conf.Hooks         // Commands to run during the build
+	b.Options().Log = conf.Log             // Where the run logs are kept
+	b.Options().Annotations = conf.Annotations
+	b.Options().MaterialLimits = conf.MaterialLimits
+
+	// The build cache location comes from the configuration, but the caller
+	// decides if the build is trusted to write to it
+	cache := conf.Cache
+	cache.ReadOnly = b.Options().Cache.ReadOnly
+	cache.PublicKey, cache.PrivateKey = b.Options().Cache.PublicKey, b.Options().Cache.PrivateKey
+	b.Options().Cache = cache
+
+	b.Options().GitHubStatus = conf.Notifications.GitHub
+
+	// Post the run events to the configured webhooks. The webhooks of a
+	// configuration loaded before are replaced, not added to
+	for _, unsubscribe := range b.webhooks {
+		unsubscribe()
+	}
+	b.webhooks = nil
+	if len(conf.Notifications.Webhooks) > 0 && b.Options().Events == nil {
+		b.Options().Events = NewEventBus()
+	}
+	for _, w := range conf.Notifications.Webhooks {
+		events := []EventType{}
+		for _, e := range w.Events {
+			events = append(events, EventType(e))
+		}
+		b.webhooks = append(b.webhooks, b.Options().Events.Subscribe(NewWebhook(w.URL, w.Format, events...).Handle))
+	}
 
 	// Assign the env variables found in the config
 	b.Options().EnvVars = map[string]string{}
+	b.Options().SecretVars = []string{}
 	for _, e := range conf.Env {
-		b.Options().EnvVars[e.Var] = e.Value
+		b.Options().EnvVars[e.Var] = envValue(&e, secrets)
+		if e.ValueFrom.Secret != "" || e.Sensitive {
+			b.Options().SecretVars = append(b.Options().SecretVars, e.Var)
+		}
+	}
+
+	// All secret values are masked, even those only used in replacements
+	b.Options().MaskedValues = []string{}
+	for _, s := range conf.Secrets {
+		b.Options().MaskedValues = append(b.Options().MaskedValues, secrets[s.Name])
 	}
+	b.Options().MaskedPatterns = conf.Log.Redact
 
 	if conf.Artifacts.Files != nil {
 		if conf.Artifacts.Files != nil {
@@ -328,7 +489,7 @@ func (b *Build) Load(path string) error {
 			filepath.Dir(path), "git", "log", "--pretty=format:%H", "-n1",
 		).RunSilentSuccessOutput()
 		if err != nil {
-			return errors.Wrap(err, "getting commit for configuration version")
+			return fmt.Errorf("getting commit for configuration version: %w", err)
 		}
 		b.Options().ConfigPoint = output.OutputTrimNL()
 		logrus.Infof("Recording build configuration at %s", b.Options().ConfigPoint)
@@ -353,7 +514,7 @@ func digestSetForFile(filePath string) (hashes map[string]string, err error) {
 	for algo, fn := range fs {
 		h, err := fn(filePath)
 		if err != nil {
-			return nil, errors.Wrapf(err, "generating digestset for %s", filePath)
+			return nil, fmt.Errorf("generating digestset for %s: %w", filePath, err)
 		}
 		hashes[algo] = h
 	}
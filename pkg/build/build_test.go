@@ -5,8 +5,10 @@ package build
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,3 +30,58 @@ func TestDigestSetForFile(t *testing.T) {
 	_, err = digestSetForFile("lskjdflskdjflkjs")
 	require.Error(t, err)
 }
+
+func TestRunOptionsArtifacts(t *testing.T) {
+	// Runs of the same build add artifacts to their own lists
+	files := make([]string, 1, 4)
+	files[0] = "app.bin"
+	b := NewWithOptions(nil, &Options{Artifacts: ArtifactsConfig{Files: files}})
+	first, second := b.runOptions(), b.runOptions()
+	first.Artifacts.Files = append(first.Artifacts.Files, "SHA256SUMS")
+	second.Artifacts.Files = append(second.Artifacts.Files, "app.bin.sig")
+	require.Equal(t, []string{"app.bin", "SHA256SUMS"}, first.Artifacts.Files)
+	require.Equal(t, []string{"app.bin", "app.bin.sig"}, second.Artifacts.Files)
+	require.Equal(t, []string{"app.bin"}, b.Options().Artifacts.Files)
+}
+
+func TestSequentialBuildsExpectedFiles(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	// Fake bazel that builds a file and reports it as the target output
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "bazel"), []byte(`#!/bin/sh
+case "$1" in
+--version) echo "bazel 5.0.0" ;;
+build) echo server > server.bin ;;
+cquery) echo server.bin ;;
+esac
+`), os.FileMode(0o755)))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile": "webapp:\n\techo webapp > webapp.bin\n",
+	})
+	opts := &Options{
+		Workdir: workdir, Source: "https://github.com/mattermost/cicd-sdk", EnvVars: map[string]string{},
+	}
+	runOpts := func() *RunOptions {
+		return &RunOptions{BuildPoint: head, ExistenceCheck: AlwaysBuild}
+	}
+
+	bazel, err := runners.New("bazel", "//cmd/server")
+	require.NoError(t, err)
+	first := NewWithOptions(bazel, opts).RunWithOptions(runOpts())
+	require.NoError(t, first.Execute())
+	require.Equal(t, []string{"server.bin"}, first.Options().Artifacts.Files)
+
+	// The files reported by bazel are not artifacts of the next build
+	require.NoError(t, os.Remove(filepath.Join(workdir, "server.bin")))
+	webapp, err := runners.New("make", "webapp")
+	require.NoError(t, err)
+	require.Empty(t, webapp.Options().ExpectedFiles)
+	second := NewWithOptions(webapp, opts).RunWithOptions(runOpts())
+	require.NoError(t, second.Execute())
+	require.Empty(t, second.Options().Artifacts.Files)
+	require.Empty(t, runners.DefaultOptions.ExpectedFiles)
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/sirupsen/logrus"
+)
+
+// Results of looking up the artifacts of a run in the build cache
+const (
+	CacheHit  = "hit"  // The artifacts were restored from the cache, the runner did not execute
+	CacheMiss = "miss" // The artifacts were not cached, the run built them
+)
+
+// CacheManifestFilename is the file describing a build cache entry. It is
+// written after the artifacts, an entry without it is incomplete.
+const CacheManifestFilename = "cache.json"
+
+// cacheManifest records when a cache entry was stored and the digests of
+// its artifacts, checked when they are restored. It is signed with the
+// cache private key, anyone able to write to the cache could change the
+// artifacts and their digests otherwise.
+type cacheManifest struct {
+	Key       string                       `json:"key"` // Path of the entry in the cache, so entries cannot be moved
+	Created   time.Time                    `json:"created"`
+	Artifacts map[string]map[string]string `json:"artifacts"`
+	Signature []byte                       `json:"signature,omitempty"` // ed25519 signature of the manifest without it
+}
+
+// signedData returns the data of the manifest covered by the signature
+func (cm *cacheManifest) signedData() ([]byte, error) {
+	unsigned := *cm
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// sign sets the signature of the manifest
+func (cm *cacheManifest) sign(key ed25519.PrivateKey) error {
+	data, err := cm.signedData()
+	if err != nil {
+		return err
+	}
+	cm.Signature = ed25519.Sign(key, data)
+	return nil
+}
+
+// verify checks the manifest was signed for the entry in key
+func (cm *cacheManifest) verify(publicKey ed25519.PublicKey, key string) error {
+	data, err := cm.signedData()
+	if err != nil {
+		return err
+	}
+	if len(cm.Signature) == 0 || !ed25519.Verify(publicKey, data, cm.Signature) {
+		return errors.New("the manifest signature is not valid")
+	}
+	if cm.Key != key {
+		return fmt.Errorf("the manifest was signed for the entry %s", cm.Key)
+	}
+	return nil
+}
+
+// cacheURL returns the URL where the artifacts of the run are cached. The
+// staging path addresses the build point and materials, and the cache key
+// the way the runner builds them, so any run of the same inputs with the
+// same runner finds the artifacts in the same place.
+func (dri *defaultRunImplementation) cacheURL(r *Run) (string, error) {
+	if err := r.objectManager().ValidateURL(r.opts.Cache.Destination); err != nil {
+		return "", fmt.Errorf("validating cache destination: %w", err)
+	}
+	entry, err := dri.cacheEntry(r)
+	if err != nil {
+		return "", err
+	}
+	return object.JoinURL(r.opts.Cache.Destination, entry)
+}
+
+// cacheEntry returns the path of the cache entry of the run, relative to
+// the cache destination
+func (dri *defaultRunImplementation) cacheEntry(r *Run) (string, error) {
+	stagingPath, err := dri.stagingPath(r)
+	if err != nil {
+		return "", fmt.Errorf("getting staging path: %w", err)
+	}
+	return stagingPath + "/" + cacheKey(r), nil
+}
+
+// cacheKeyExcludedVars are set by each run and change between runs of the
+// same inputs, they are not part of the cache key
+var cacheKeyExcludedVars = map[string]bool{
+	"PWD": true, "MMBUILD_MATERIALS_DIR": true, InputFingerprintEnvVar: true,
+}
+
+// cacheKey hashes the runner ID, its arguments and the variables of its
+// environment. Secret variables are left out, so rotating a token does not
+// invalidate the cache.
+func cacheKey(r *Run) string {
+	opts := r.runner.Options()
+	secrets := map[string]bool{}
+	for _, v := range opts.SecretVars {
+		secrets[v] = true
+	}
+	sensitive := map[string]bool{}
+	for _, v := range opts.SensitiveValues() {
+		sensitive[v] = true
+	}
+	vars := []string{}
+	for v, val := range opts.EnvVars {
+		if !secrets[v] && !sensitive[val] && !cacheKeyExcludedVars[v] {
+			vars = append(vars, v)
+		}
+	}
+	sort.Strings(vars)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "runner=%q\n", r.runner.ID())
+	for _, arg := range r.runner.Arguments() {
+		fmt.Fprintf(h, "arg=%q\n", arg)
+	}
+	for _, v := range vars {
+		fmt.Fprintf(h, "env=%q=%q\n", v, opts.EnvVars[v])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// restoreCache copies the artifacts of the run from the build cache to
+// the working directory. The run only counts as a hit if the cache entry
+// is signed with the cache key, has all the expected artifacts, has not
+// expired and the restored files match the digests recorded when they
+// were stored.
+func (dri *defaultRunImplementation) restoreCache(r *Run) error {
+	if r.opts.Cache.Destination == "" || len(r.opts.Artifacts.Files) == 0 {
+		return nil
+	}
+	r.Cache = CacheMiss
+	if r.opts.ForceBuild {
+		logrus.Info("ForceBuild option is set, not restoring artifacts from the build cache")
+		return nil
+	}
+	if len(r.opts.Cache.PublicKey) == 0 {
+		logrus.Info("No public key to verify the build cache entries, not restoring artifacts")
+		return nil
+	}
+
+	cacheURL, err := dri.cacheURL(r)
+	if err != nil {
+		return fmt.Errorf("getting cache URL: %w", err)
+	}
+	manifest, err := dri.readCacheManifest(r, cacheURL)
+	if err != nil {
+		return fmt.Errorf("reading cache manifest: %w", err)
+	}
+	if manifest == nil {
+		logrus.Infof("No build cache entry found in %s", cacheURL)
+		return nil
+	}
+	entry, err := dri.cacheEntry(r)
+	if err != nil {
+		return err
+	}
+	if err := manifest.verify(r.opts.Cache.PublicKey, entry); err != nil {
+		logrus.Warnf("Not restoring the build cache entry in %s: %v", cacheURL, err)
+		return nil
+	}
+	if r.opts.Cache.TTL != 0 && time.Since(manifest.Created) > r.opts.Cache.TTL {
+		logrus.Infof("Build cache entry in %s expired, it was stored %s", cacheURL, manifest.Created)
+		return nil
+	}
+
+	specs := []object.CopySpec{}
+	paths := map[string]string{}
+	for _, f := range r.opts.Artifacts.Files {
+		if _, ok := manifest.Artifacts[f]; !ok {
+			logrus.Infof("Artifact %s not found in the build cache", f)
+			return nil
+		}
+		artifactURL, err := object.JoinURL(cacheURL, f)
+		if err != nil {
+			return fmt.Errorf("building cache URL of %s: %w", f, err)
+		}
+		path, err := filepath.Abs(filepath.Join(r.runner.Options().Workdir, f))
+		if err != nil {
+			return fmt.Errorf("resolving artifact path: %w", err)
+		}
+		paths[f] = path
+		specs = append(specs, object.CopySpec{Source: artifactURL, Destination: object.FileURL(path)})
+	}
+
+	if err := copyBatch(r.context(), object.NewManager(), specs); err != nil {
+		return fmt.Errorf("restoring artifacts from %s: %w", cacheURL, err)
+	}
+
+	// Artifacts that do not match are rebuilt, the build overwrites them
+	for f, path := range paths {
+		digests, err := r.digestCache().fileDigests(path)
+		if err != nil {
+			return fmt.Errorf("hashing restored artifact %s: %w", f, err)
+		}
+		if !reflect.DeepEqual(digests, manifest.Artifacts[f]) {
+			logrus.Warnf("Artifact %s restored from the build cache does not match its digest, rebuilding", f)
+			return nil
+		}
+	}
+	r.Cache = CacheHit
+	logrus.Infof("Restored %d artifacts from the build cache in %s", len(specs), cacheURL)
+	return nil
+}
+
+// readCacheManifest downloads the manifest of the cache entry in cacheURL.
+// It returns nil if there is no entry.
+func (dri *defaultRunImplementation) readCacheManifest(r *Run, cacheURL string) (*cacheManifest, error) {
+	manifestURL, err := object.JoinURL(cacheURL, CacheManifestFilename)
+	if err != nil {
+		return nil, fmt.Errorf("building manifest URL: %w", err)
+	}
+	exists, err := r.objectManager().PathExists(manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("checking if cache manifest exists: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	dir, err := os.MkdirTemp("", "build-cache-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, CacheManifestFilename)
+	if err := object.NewManager().Copy(manifestURL, object.FileURL(path)); err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", manifestURL, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cache manifest: %w", err)
+	}
+	manifest := &cacheManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", manifestURL, err)
+	}
+	return manifest, nil
+}
+
+// populateCache copies the artifacts built by the run to the build cache
+// followed by the manifest of the entry
+func (dri *defaultRunImplementation) populateCache(r *Run) error {
+	if r.opts.Cache.Destination == "" || len(r.opts.Artifacts.Files) == 0 || r.Cache == CacheHit {
+		return nil
+	}
+	if r.opts.Cache.ReadOnly {
+		logrus.Info("Build cache is read only, not storing the artifacts")
+		return nil
+	}
+	if len(r.opts.Cache.PrivateKey) == 0 {
+		logrus.Info("No key to sign the build cache entries, not storing the artifacts")
+		return nil
+	}
+	cacheURL, err := dri.cacheURL(r)
+	if err != nil {
+		return fmt.Errorf("getting cache URL: %w", err)
+	}
+	entry, err := dri.cacheEntry(r)
+	if err != nil {
+		return err
+	}
+
+	manifest := &cacheManifest{Key: entry, Created: time.Now().UTC(), Artifacts: map[string]map[string]string{}}
+	specs := []object.CopySpec{}
+	for _, f := range r.opts.Artifacts.Files {
+		path, err := filepath.Abs(filepath.Join(r.runner.Options().Workdir, f))
+		if err != nil {
+			return fmt.Errorf("resolving artifact path: %w", err)
+		}
+		digests, err := r.digestCache().fileDigests(path)
+		if err != nil {
+			return fmt.Errorf("hashing artifact %s: %w", f, err)
+		}
+		manifest.Artifacts[f] = digests
+		artifactURL, err := object.JoinURL(cacheURL, f)
+		if err != nil {
+			return fmt.Errorf("building cache URL of %s: %w", f, err)
+		}
+		specs = append(specs, object.CopySpec{Source: object.FileURL(path), Destination: artifactURL})
+	}
+	manager := object.NewManager()
+	if err := copyBatch(r.context(), manager, specs); err != nil {
+		return fmt.Errorf("copying artifacts to the build cache in %s: %w", cacheURL, err)
+	}
+
+	dir, err := os.MkdirTemp("", "build-cache-")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := manifest.sign(r.opts.Cache.PrivateKey); err != nil {
+		return fmt.Errorf("signing cache manifest: %w", err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling cache manifest: %w", err)
+	}
+	path := filepath.Join(dir, CacheManifestFilename)
+	if err := os.WriteFile(path, data, os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing cache manifest: %w", err)
+	}
+	manifestURL, err := object.JoinURL(cacheURL, CacheManifestFilename)
+	if err != nil {
+		return fmt.Errorf("building manifest URL: %w", err)
+	}
+	if err := manager.Copy(object.FileURL(path), manifestURL); err != nil {
+		return fmt.Errorf("copying cache manifest: %w", err)
+	}
+	logrus.Infof("Stored %d artifacts in the build cache in %s", len(specs), cacheURL)
+	return nil
+}
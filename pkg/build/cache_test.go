@@ -0,0 +1,170 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCache(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	// Each build appends a line, restored artifacts keep the content
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile": "build:\n\techo built >> app.bin\n",
+	})
+
+	cache := t.TempDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	keys := func(conf CacheConfig) CacheConfig {
+		conf.PublicKey, conf.PrivateKey = publicKey, privateKey
+		return conf
+	}
+	newRun := func(force bool, conf ...CacheConfig) *Run {
+		runner := runners.NewMake("build")
+		require.NoError(t, runners.Isolate(runner))
+		runner.Options().Workdir = workdir
+		runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+		r := NewRun(runner)
+		r.opts = &RunOptions{
+			BuildPoint: head, ExistenceCheck: AlwaysBuild, ForceBuild: force,
+			Artifacts: ArtifactsConfig{Files: []string{"app.bin"}},
+			Cache:     keys(CacheConfig{Destination: object.FileURL(cache)}),
+		}
+		if len(conf) > 0 {
+			r.opts.Cache = conf[0]
+		}
+		return r
+	}
+
+	// The first run builds and populates the cache
+	r := newRun(false)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	require.Equal(t, 1, r.Attempts)
+	stagingPath, err := StagingPath(head, nil)
+	require.NoError(t, err)
+	entry := filepath.Join(cache, stagingPath, cacheKey(r))
+	require.FileExists(t, filepath.Join(entry, "app.bin"))
+	require.FileExists(t, filepath.Join(entry, CacheManifestFilename))
+
+	// The second one restores the artifact without running the build
+	require.NoError(t, os.Remove(filepath.Join(workdir, "app.bin")))
+	r = newRun(false)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheHit, r.Cache)
+	require.Equal(t, 0, r.Attempts)
+	data, err := os.ReadFile(filepath.Join(workdir, "app.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "built\n", string(data))
+	res := r.Result()
+	require.Equal(t, CacheHit, res.Cache)
+	require.Contains(t, res.Artifacts, "app.bin")
+
+	// Forced builds skip the cache
+	r = newRun(true)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	require.Equal(t, 1, r.Attempts)
+	data, err = os.ReadFile(filepath.Join(workdir, "app.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "built\nbuilt\n", string(data))
+
+	// Expired entries are rebuilt
+	r = newRun(false, keys(CacheConfig{Destination: object.FileURL(cache), TTL: time.Nanosecond}))
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	require.Equal(t, 1, r.Attempts)
+
+	// Tampered artifacts are rebuilt
+	require.NoError(t, os.WriteFile(filepath.Join(entry, "app.bin"), []byte("evil\n"), os.FileMode(0o644)))
+	r = newRun(false)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	require.Equal(t, 1, r.Attempts)
+
+	// Manifests not signed with the cache key are not trusted, even when
+	// the artifact digests match
+	manifestPath := filepath.Join(entry, CacheManifestFilename)
+	data, err = os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	manifest := &cacheManifest{}
+	require.NoError(t, json.Unmarshal(data, manifest))
+	_, forgedKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	require.NoError(t, manifest.sign(forgedKey))
+	data, err = json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(manifestPath, data, os.FileMode(0o644)))
+	r = newRun(false)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	require.Equal(t, 1, r.Attempts)
+
+	// Unsigned manifests neither
+	require.NoError(t, json.Unmarshal(data, manifest))
+	manifest.Signature = nil
+	data, err = json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(manifestPath, data, os.FileMode(0o644)))
+	r = newRun(false)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+
+	// Entries signed for another key cannot be moved
+	signed := &cacheManifest{Key: "other/entry", Created: time.Now().UTC()}
+	require.NoError(t, signed.sign(privateKey))
+	require.Error(t, signed.verify(publicKey, "some/entry"))
+	require.NoError(t, signed.verify(publicKey, "other/entry"))
+
+	// Without the public key nothing is restored
+	conf := keys(CacheConfig{Destination: object.FileURL(cache)})
+	conf.PublicKey = nil
+	r = newRun(false, conf)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	require.Equal(t, 1, r.Attempts)
+
+	// Runs with other arguments or variables do not share the entry,
+	// secret variables are not part of the key
+	keyed := func(args []string, env map[string]string, secrets ...string) string {
+		r := newRun(false)
+		r.runner.(runners.ArgumentsSetter).SetArguments(args...)
+		r.runner.Options().EnvVars = env
+		r.runner.Options().SecretVars = secrets
+		return cacheKey(r)
+	}
+	key := keyed([]string{"build"}, map[string]string{"GOOS": "linux", "TOKEN": "one", "PWD": "/tmp/a"}, "TOKEN")
+	require.Equal(t, key, keyed([]string{"build"}, map[string]string{"GOOS": "linux", "TOKEN": "two", "PWD": "/tmp/b"}, "TOKEN"))
+	require.NotEqual(t, key, keyed([]string{"package"}, map[string]string{"GOOS": "linux", "TOKEN": "one"}, "TOKEN"))
+	require.NotEqual(t, key, keyed([]string{"build"}, map[string]string{"GOOS": "darwin", "TOKEN": "one"}, "TOKEN"))
+
+	// Read only caches and builds without the private key do not
+	// populate the cache
+	readOnly := t.TempDir()
+	conf = keys(CacheConfig{Destination: object.FileURL(readOnly)})
+	conf.ReadOnly = true
+	r = newRun(false, conf)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	conf = keys(CacheConfig{Destination: object.FileURL(readOnly)})
+	conf.PrivateKey = nil
+	r = newRun(false, conf)
+	require.NoError(t, r.Execute())
+	require.Equal(t, CacheMiss, r.Cache)
+	entries, err := os.ReadDir(readOnly)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/sirupsen/logrus"
+)
+
+// ChecksumAlgorithms are the algorithms of the checksum files, with the
+// name of their aggregate file
+var ChecksumAlgorithms = map[string]string{
+	"sha256": "SHA256SUMS",
+	"sha512": "SHA512SUMS",
+}
+
+// writeChecksums writes the checksum files of the file artifacts in the
+// format of sha256sum: an aggregate file per algorithm in the working
+// directory and, if enabled, a sidecar file next to each artifact. The
+// checksum files are added to the artifacts and to the transfers sending
+// the files they cover to a prefix.
+func (dri *defaultRunImplementation) writeChecksums(r *Run) error {
+	conf := r.opts.Artifacts.Checksums
+	if len(conf.Algorithms) == 0 {
+		return nil
+	}
+	workdir := r.runner.Options().Workdir
+
+	// Directories are not covered, the sums list files by their name
+	files := []string{}
+	names := map[string]string{}
+	for _, path := range r.opts.Artifacts.Files {
+		info, err := os.Stat(filepath.Join(workdir, path))
+		if err != nil {
+			return fmt.Errorf("checking artifact %s: %w", path, err)
+		}
+		if info.IsDir() {
+			logrus.Infof("Not writing checksums of artifact directory %s", path)
+			continue
+		}
+		name := filepath.Base(path)
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("artifacts %s and %s have the same name, their checksums would be ambiguous", other, path)
+		}
+		names[name] = path
+		files = append(files, path)
+	}
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+
+	written, aggregates := []string{}, []string{}
+	sidecars := map[string][]string{} // Sidecar files by artifact
+	for _, algo := range conf.Algorithms {
+		sumsFile, ok := ChecksumAlgorithms[algo]
+		if !ok {
+			return fmt.Errorf("unsupported checksum algorithm %s", algo)
+		}
+		var sums strings.Builder
+		for _, path := range files {
+			digests, err := r.digestCache().fileDigests(filepath.Join(workdir, path))
+			if err != nil {
+				return fmt.Errorf("hashing artifact: %w", err)
+			}
+			line := fmt.Sprintf("%s  %s\n", digests[algo], filepath.Base(path))
+			sums.WriteString(line)
+			if !conf.Sidecars {
+				continue
+			}
+			sidecar := path + "." + algo
+			if err := os.WriteFile(filepath.Join(workdir, sidecar), []byte(line), os.FileMode(0o644)); err != nil {
+				return fmt.Errorf("writing checksum file: %w", err)
+			}
+			sidecars[path] = append(sidecars[path], sidecar)
+			written = append(written, sidecar)
+		}
+		if err := os.WriteFile(filepath.Join(workdir, sumsFile), []byte(sums.String()), os.FileMode(0o644)); err != nil {
+			return fmt.Errorf("writing %s: %w", sumsFile, err)
+		}
+		written = append(written, sumsFile)
+		aggregates = append(aggregates, sumsFile)
+	}
+	logrus.Infof("Wrote %d checksum files of %d artifacts", len(written), len(files))
+
+	for _, path := range written {
+		if !contains(r.opts.Artifacts.Files, path) {
+			r.opts.Artifacts.Files = append(r.opts.Artifacts.Files, path)
+		}
+	}
+	return addSidecarTransfers(r, files, sidecars, aggregates)
+}
+
+// addSidecarTransfers adds files written for the artifacts, like checksums
+// or signatures, to the transfers sending any of the artifacts to a prefix:
+// the sidecars of their files and the aggregate files. The transfers are
+// copied, the build options are not modified.
+func addSidecarTransfers(r *Run, files []string, sidecars map[string][]string, aggregates []string) error {
+	transfers := make([]TransferConfig, 0, len(r.opts.Transfers))
+	for _, td := range r.opts.Transfers {
+		td.Source = append([]string{}, td.Source...)
+		destURL, err := object.NormalizeURL(td.Destination)
+		if err != nil {
+			return fmt.Errorf("parsing transfer destination: %w", err)
+		}
+		covered := false
+		for _, f := range td.Source {
+			if contains(files, f) {
+				covered = true
+			}
+		}
+		if covered && backends.IsPrefixURL(destURL) {
+			extra := []string{}
+			for _, f := range td.Source {
+				extra = append(extra, sidecars[f]...)
+			}
+			for _, f := range append(extra, aggregates...) {
+				if !contains(td.Source, f) {
+					td.Source = append(td.Source, f)
+				}
+			}
+		}
+		transfers = append(transfers, td)
+	}
+	r.opts.Transfers = transfers
+	return nil
+}
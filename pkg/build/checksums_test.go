@@ -0,0 +1,72 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	dir := t.TempDir()
+	runner := runners.NewMake("build")
+	runner.Options().Workdir = dir
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "dist", "docs"), os.FileMode(0o755)))
+	for path, content := range map[string]string{"dist/server.tar.gz": "server\n", "mmctl": "mmctl\n"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), os.FileMode(0o644)))
+	}
+	transfers := []TransferConfig{
+		{Source: []string{"dist/server.tar.gz"}, Destination: "s3://releases/server/"},
+		{Source: []string{"mmctl"}, Destination: "s3://releases/mmctl-linux"},
+	}
+	r := &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts: &RunOptions{
+			Artifacts: ArtifactsConfig{
+				Files:     []string{"dist/server.tar.gz", "mmctl", "dist/docs"},
+				Checksums: ChecksumsConfig{Algorithms: []string{"sha256", "sha512"}, Sidecars: true},
+			},
+			Transfers: transfers,
+		},
+	}
+	require.NoError(t, r.impl.writeChecksums(r))
+
+	// Aggregate files list the files by name, sorted, directories are skipped
+	sums, err := os.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+	require.NoError(t, err)
+	require.Equal(t,
+		"3037bb1a1f7563d497466c02d72ab94db6cee18414932f62fe859f5a4e6a471e  mmctl\n"+
+			"4ad28e4a6461bd64b920f72f86c0d16edc544c4a1f26060518ebb900025d496a  server.tar.gz\n",
+		string(sums),
+	)
+	sidecar, err := os.ReadFile(filepath.Join(dir, "dist", "server.tar.gz.sha256"))
+	require.NoError(t, err)
+	require.Equal(t, "4ad28e4a6461bd64b920f72f86c0d16edc544c4a1f26060518ebb900025d496a  server.tar.gz\n", string(sidecar))
+	require.FileExists(t, filepath.Join(dir, "SHA512SUMS"))
+	require.FileExists(t, filepath.Join(dir, "mmctl.sha512"))
+
+	// Checksum files are artifacts too
+	require.Equal(t, []string{
+		"dist/server.tar.gz", "mmctl", "dist/docs",
+		"mmctl.sha256", "dist/server.tar.gz.sha256", "SHA256SUMS",
+		"mmctl.sha512", "dist/server.tar.gz.sha512", "SHA512SUMS",
+	}, r.opts.Artifacts.Files)
+
+	// They are sent by the transfers to a prefix, without changing the options
+	require.Equal(t, []string{
+		"dist/server.tar.gz", "dist/server.tar.gz.sha256", "dist/server.tar.gz.sha512", "SHA256SUMS", "SHA512SUMS",
+	}, r.opts.Transfers[0].Source)
+	require.Equal(t, []string{"mmctl"}, r.opts.Transfers[1].Source)
+	require.Equal(t, []string{"dist/server.tar.gz"}, transfers[0].Source)
+
+	// Artifacts with the same name cannot be listed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dist", "mmctl"), []byte("other\n"), os.FileMode(0o644)))
+	r.opts.Artifacts.Files = []string{"mmctl", "dist/mmctl"}
+	require.Error(t, r.impl.writeChecksums(r))
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidCondition is returned when a when: condition cannot be parsed
+var ErrInvalidCondition = errors.New("invalid condition")
+
+// conditionEnvPrefix is the prefix of the variables in the conditions
+const conditionEnvPrefix = "env."
+
+// EvaluateCondition evaluates the condition of a when: setting with the
+// values of env. Conditions compare variables and strings:
+//
+//	env.EDITION == "enterprise" && (env.GOOS != "windows" || !env.SKIP_WIN)
+//
+// Variables are referenced as env.NAME and are empty if not set. Strings
+// are single or double quoted. Operands alone are true if not empty, and
+// true and false are literals. Operators are ==, !=, !, && and ||, with
+// the usual precedence and parentheses to group them.
+func EvaluateCondition(condition string, env map[string]string) (bool, error) {
+	tokens, err := tokenizeCondition(condition)
+	if err != nil {
+		return false, err
+	}
+	p := &conditionParser{tokens: tokens, env: env}
+	result, err := p.parseOr()
+	if err != nil {
+		return false, fmt.Errorf("evaluating %q: %w", condition, err)
+	}
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf(
+			"evaluating %q: unexpected %s: %w", condition, p.tokens[p.pos].text, ErrInvalidCondition,
+		)
+	}
+	return result.bool(), nil
+}
+
+type conditionTokenKind int
+
+const (
+	tokenOperator conditionTokenKind = iota
+	tokenString
+	tokenIdentifier
+)
+
+type conditionToken struct {
+	kind conditionTokenKind
+	text string
+}
+
+// tokenizeCondition splits a condition in operators, strings and
+// identifiers
+func tokenizeCondition(condition string) ([]conditionToken, error) {
+	tokens := []conditionToken{}
+	runes := []rune(condition)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string in %q: %w", condition, ErrInvalidCondition)
+			}
+			tokens = append(tokens, conditionToken{tokenString, string(runes[i+1 : end])})
+			i = end + 1
+		case strings.HasPrefix(string(runes[i:]), "==") || strings.HasPrefix(string(runes[i:]), "!=") ||
+			strings.HasPrefix(string(runes[i:]), "&&") || strings.HasPrefix(string(runes[i:]), "||"):
+			tokens = append(tokens, conditionToken{tokenOperator, string(runes[i : i+2])})
+			i += 2
+		case r == '!' || r == '(' || r == ')':
+			tokens = append(tokens, conditionToken{tokenOperator, string(r)})
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) ||
+				runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, conditionToken{tokenIdentifier, string(runes[i:end])})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q: %w", r, condition, ErrInvalidCondition)
+		}
+	}
+	return tokens, nil
+}
+
+// conditionValue is the result of evaluating an operand or an operation
+type conditionValue struct {
+	isBool bool
+	b      bool
+	s      string
+}
+
+func (v conditionValue) bool() bool {
+	if v.isBool {
+		return v.b
+	}
+	return v.s != ""
+}
+
+func (v conditionValue) string() string {
+	if v.isBool {
+		if v.b {
+			return "true"
+		}
+		return "false"
+	}
+	return v.s
+}
+
+// conditionParser evaluates the tokens of a condition while parsing them
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+	env    map[string]string
+}
+
+// accept consumes the next token if it is the operator op
+func (p *conditionParser) accept(op string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOperator && p.tokens[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) parseOr() (conditionValue, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		left = conditionValue{isBool: true, b: left.bool() || right.bool()}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionValue, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return left, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return right, err
+		}
+		left = conditionValue{isBool: true, b: left.bool() && right.bool()}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseComparison() (conditionValue, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for {
+		switch {
+		case p.accept("=="):
+			right, err := p.parseUnary()
+			if err != nil {
+				return right, err
+			}
+			left = conditionValue{isBool: true, b: left.string() == right.string()}
+		case p.accept("!="):
+			right, err := p.parseUnary()
+			if err != nil {
+				return right, err
+			}
+			left = conditionValue{isBool: true, b: left.string() != right.string()}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *conditionParser) parseUnary() (conditionValue, error) {
+	if p.accept("!") {
+		v, err := p.parseUnary()
+		return conditionValue{isBool: true, b: !v.bool()}, err
+	}
+	if p.accept("(") {
+		v, err := p.parseOr()
+		if err != nil {
+			return v, err
+		}
+		if !p.accept(")") {
+			return v, fmt.Errorf("missing ): %w", ErrInvalidCondition)
+		}
+		return v, nil
+	}
+	if p.pos == len(p.tokens) {
+		return conditionValue{}, fmt.Errorf("unexpected end of condition: %w", ErrInvalidCondition)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokenString:
+		return conditionValue{s: t.text}, nil
+	case tokenIdentifier:
+		switch {
+		case t.text == "true" || t.text == "false":
+			return conditionValue{isBool: true, b: t.text == "true"}, nil
+		case strings.HasPrefix(t.text, conditionEnvPrefix):
+			return conditionValue{s: p.env[strings.TrimPrefix(t.text, conditionEnvPrefix)]}, nil
+		}
+		return conditionValue{}, fmt.Errorf("unknown identifier %s: %w", t.text, ErrInvalidCondition)
+	}
+	return conditionValue{}, fmt.Errorf("unexpected %s: %w", t.text, ErrInvalidCondition)
+}
+
+// conditionEnv returns the variables the conditions of a configuration
+// are evaluated with: the system environment and the env settings of the
+// configuration without conditions, which take precedence
+func (conf *Config) conditionEnv() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	for _, e := range conf.Env {
+		if e.When == "" && e.Value != "" {
+			env[e.Var] = e.Value
+		}
+	}
+	return env
+}
+
+// applyConditions removes the env vars, replacements, transfers and
+// runner steps whose when: condition is false. The env settings are
+// evaluated first, the rest of the conditions see the variables they set.
+func (conf *Config) applyConditions() error {
+	env := conf.conditionEnv()
+	keep := func(section string, i int, condition string) (bool, error) {
+		if condition == "" {
+			return true, nil
+		}
+		ok, err := EvaluateCondition(condition, env)
+		if err != nil {
+			return false, fmt.Errorf("%s #%d: %w", section, i, err)
+		}
+		if !ok {
+			logrus.Infof("Skipping %s #%d, condition %q is false", section, i, condition)
+		}
+		return ok, nil
+	}
+
+	envVars := []EnvConfig{}
+	for i, e := range conf.Env {
+		ok, err := keep("env var", i, e.When)
+		if err != nil {
+			return err
+		}
+		if ok {
+			envVars = append(envVars, e)
+		}
+	}
+	conf.Env = envVars
+	for _, e := range conf.Env {
+		if e.When != "" && e.Value != "" {
+			env[e.Var] = e.Value
+		}
+	}
+
+	replacements := []ReplacementConfig{}
+	for i, r := range conf.Replacements {
+		ok, err := keep("replacement", i, r.When)
+		if err != nil {
+			return err
+		}
+		if ok {
+			replacements = append(replacements, r)
+		}
+	}
+	conf.Replacements = replacements
+
+	transfers := []TransferConfig{}
+	for i, t := range conf.Transfers {
+		ok, err := keep("transfer", i, t.When)
+		if err != nil {
+			return err
+		}
+		if ok {
+			transfers = append(transfers, t)
+		}
+	}
+	conf.Transfers = transfers
+
+	if len(conf.Runner.Steps) > 0 {
+		steps := []RunnerConfig{}
+		for i, s := range conf.Runner.Steps {
+			ok, err := keep("runner step", i, s.When)
+			if err != nil {
+				return err
+			}
+			if ok {
+				steps = append(steps, s)
+			}
+		}
+		if len(steps) == 0 {
+			return errors.New("the conditions of all runner steps are false")
+		}
+		conf.Runner.Steps = steps
+	}
+	return nil
+}
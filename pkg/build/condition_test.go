@@ -0,0 +1,116 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	env := map[string]string{"EDITION": "enterprise", "GOOS": "linux", "EMPTY": ""}
+	for _, tc := range []struct {
+		Condition string
+		Expected  bool
+	}{
+		{`env.EDITION == "enterprise"`, true},
+		{`env.EDITION == 'team'`, false},
+		{`env.EDITION != "team"`, true},
+		{`env.GOOS`, true},
+		{`env.EMPTY`, false},
+		{`env.UNDEFINED == ""`, true},
+		{`!env.UNDEFINED`, true},
+		{`true && !false`, true},
+		{`env.EDITION == "team" || env.GOOS == "linux"`, true},
+		{`env.EDITION == "team" || env.GOOS == "linux" && env.EMPTY`, false},
+		{`(env.EDITION == "team" || env.GOOS == "linux") && !env.EMPTY`, true},
+		{`env.GOOS == "linux" == true`, true},
+	} {
+		result, err := EvaluateCondition(tc.Condition, env)
+		require.NoError(t, err, tc.Condition)
+		require.Equal(t, tc.Expected, result, tc.Condition)
+	}
+
+	for _, condition := range []string{
+		`env.EDITION == "enterprise`,
+		`env.EDITION = "enterprise"`,
+		`EDITION == "enterprise"`,
+		`(env.GOOS == "linux"`,
+		`env.GOOS == `,
+		`env.GOOS "linux"`,
+	} {
+		_, err := EvaluateCondition(condition, env)
+		require.Error(t, err, condition)
+		require.True(t, errors.Is(err, ErrInvalidCondition), condition)
+	}
+}
+
+func TestConfigConditions(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  steps:
+    - id: make
+      params: ["build"]
+    - id: make
+      params: ["package-ee"]
+      when: env.EDITION == "enterprise"
+env:
+  - var: EDITION
+    value: team
+    when: env.BUILD_EE != "true"
+  - var: EDITION
+    value: enterprise
+    when: env.BUILD_EE == "true"
+  - var: GOOS
+    value: linux
+replacements:
+  - tag: "%LICENSE%"
+    value: enterprise
+    paths: ["license.go"]
+    when: env.EDITION == "enterprise"
+transfers:
+  - source: ["dist/mattermost-team.tar.gz"]
+    destination: s3://releases/${EDITION}/
+    when: env.EDITION == "team"
+  - source: ["dist/mattermost-enterprise.tar.gz"]
+    destination: s3://releases/${EDITION}/
+    when: env.EDITION == "enterprise"
+`), os.FileMode(0o644)))
+
+	// Team edition
+	c, err := LoadConfig(conf)
+	require.NoError(t, err)
+	require.Len(t, c.Env, 2)
+	require.Equal(t, "team", c.Env[0].Value)
+	require.Len(t, c.Runner.Steps, 1)
+	require.Empty(t, c.Replacements)
+	require.Len(t, c.Transfers, 1)
+	require.Equal(t, "s3://releases/team/", c.Transfers[0].Destination)
+
+	// Enterprise edition
+	t.Setenv("BUILD_EE", "true")
+	c, err = LoadConfig(conf)
+	require.NoError(t, err)
+	require.Len(t, c.Env, 2)
+	require.Equal(t, "enterprise", c.Env[0].Value)
+	require.Len(t, c.Runner.Steps, 2)
+	require.Len(t, c.Replacements, 1)
+	require.Len(t, c.Transfers, 1)
+	require.Equal(t, "s3://releases/enterprise/", c.Transfers[0].Destination)
+
+	// Invalid conditions fail to load
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+transfers:
+  - source: ["app"]
+    destination: s3://bucket/
+    when: env.EDITION = "team"
+`), os.FileMode(0o644)))
+	_, err = LoadConfig(conf)
+	require.True(t, errors.Is(err, ErrInvalidCondition))
+}
@@ -2,18 +2,26 @@ package build
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
-	"github.com/pkg/errors"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/mattermost/cicd-sdk/pkg/replacement"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
 var varRegexp = regexp.MustCompile(`\$\{([_A-Z0-9]+)\}`)
 
-// replaceVariables replaces the yaml configuration variables
+// replaceVariables replaces the yaml configuration variables. The runner
+// parameters are left as they are, they are expanded when the run starts.
 func replaceVariables(yamlData []byte) ([]byte, error) {
 	vars := extractConfigVariables(yamlData)
 	if len(vars) == 0 {
@@ -28,7 +36,11 @@ func replaceVariables(yamlData []byte) ([]byte, error) {
 	// the replacements are defined inside of the conf itself (in env vars for example)
 	c, err := parseConf(yamlData)
 	if err != nil {
-		return nil, errors.Wrap(err, "parsing yaml configuration")
+		return nil, fmt.Errorf("parsing yaml configuration: %w", err)
+	}
+	// Env vars whose condition is false do not define variables
+	if err := c.applyConditions(); err != nil {
+		return nil, fmt.Errorf("evaluating configuration conditions: %w", err)
 	}
 
 	// Cycle all vars from the YAML conf and try to get a value for them
@@ -64,47 +76,117 @@ func replaceVariables(yamlData []byte) ([]byte, error) {
 			continue
 		}
 
-		return nil, errors.Errorf(
+		return nil, fmt.Errorf(
 			"unable to find a value for yaml config variable $%s", yamlVariable,
 		)
 	}
 
 	// Replace the values in the yaml data
-	for vr, vl := range valueVals {
-		yamlData = bytes.ReplaceAll(yamlData, []byte(fmt.Sprintf("${%s}", vr)), []byte(vl))
+	skip := runnerParamLines(yamlData)
+	lines := bytes.SplitAfter(yamlData, []byte("\n"))
+	for i := range lines {
+		if skip[i+1] {
+			continue
+		}
+		for vr, vl := range valueVals {
+			lines[i] = bytes.ReplaceAll(lines[i], []byte(fmt.Sprintf("${%s}", vr)), []byte(vl))
+		}
 	}
 
-	return yamlData, nil
+	return bytes.Join(lines, nil), nil
 }
 
-// Load reads a config file and return a config object
+// runnerParamLines returns the lines of the runner parameters in the
+// configuration data, including those of the composite steps
+func runnerParamLines(yamlData []byte) map[int]bool {
+	lines := map[int]bool{}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(yamlData, doc); err != nil || len(doc.Content) == 0 {
+		return lines
+	}
+	var addRunner func(*yaml.Node)
+	addRunner = func(runner *yaml.Node) {
+		if runner.Kind != yaml.MappingNode {
+			return
+		}
+		if i := mappingIndex(runner, "params"); i >= 0 {
+			for _, param := range runner.Content[i+1].Content {
+				lines[param.Line] = true
+			}
+		}
+		if i := mappingIndex(runner, "steps"); i >= 0 {
+			for _, step := range runner.Content[i+1].Content {
+				addRunner(step)
+			}
+		}
+	}
+	if i := mappingIndex(doc.Content[0], "runner"); i >= 0 {
+		addRunner(doc.Content[0].Content[i+1])
+	}
+	return lines
+}
+
+// Load reads a config file and return a config object. The profile of
+// the branch detected in the file directory is applied.
 func LoadConfig(path string) (*Config, error) {
+	return LoadConfigForBranch(path, "")
+}
+
+// LoadConfigForBranch reads a config file applying the profile that
+// matches branch. If branch is empty, it is detected with DetectBranch.
+func LoadConfigForBranch(path, branch string) (*Config, error) {
 	logrus.Infof("Loading build configuration from %s", path)
-	yamlData, err := os.ReadFile(path)
+	yamlData, err := ResolveConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving build configuration: %w", err)
+	}
+
+	if branch == "" {
+		branch = DetectBranch(filepath.Dir(path))
+	}
+	yamlData, profile, err := applyProfile(yamlData, branch)
+	if err != nil {
+		return nil, fmt.Errorf("applying configuration profile to %s: %w", path, err)
+	}
+
+	yamlData, err = applyDefaults(yamlData)
 	if err != nil {
-		return nil, errors.Wrap(err, "reading build configuration file")
+		return nil, fmt.Errorf("applying configuration defaults to %s: %w", path, err)
 	}
 
 	yamlData, err = replaceVariables(yamlData)
 	if err != nil {
-		return nil, errors.Wrap(err, "replacing configuration variables")
+		return nil, fmt.Errorf("replacing configuration variables: %w", err)
 	}
 	logrus.Infof("Build conf:\n%s", string(yamlData))
+	if err := ValidateConfigSchema(yamlData); err != nil {
+		return nil, fmt.Errorf("checking %s: %w", path, err)
+	}
 	conf, err := parseConf(yamlData)
 	if err != nil {
-		return nil, errors.Wrap(err, "parsing config yaml data")
+		return nil, fmt.Errorf("parsing config yaml data: %w", err)
+	}
+	conf.Profile = profile
+	if err := conf.applyConditions(); err != nil {
+		return nil, fmt.Errorf("evaluating configuration conditions: %w", err)
 	}
 
 	return conf, nil
 }
 
-// extractConfigVariables scans configuration data to search for variables
+// extractConfigVariables scans configuration data to search for variables,
+// skipping the runner parameters
 func extractConfigVariables(yamlData []byte) []string {
-	matches := varRegexp.FindAllSubmatch(yamlData, -1)
+	skip := runnerParamLines(yamlData)
 	vars := []string{}
 	foundVars := map[string]struct{}{}
-	for _, match := range matches {
-		foundVars[string(match[1])] = struct{}{}
+	for i, line := range bytes.SplitAfter(yamlData, []byte("\n")) {
+		if skip[i+1] {
+			continue
+		}
+		for _, match := range varRegexp.FindAllSubmatch(line, -1) {
+			foundVars[string(match[1])] = struct{}{}
+		}
 	}
 	for v := range foundVars {
 		vars = append(vars, v)
@@ -120,35 +202,60 @@ func parseConf(yamlData []byte) (*Config, error) {
 		Transfers:    []TransferConfig{},
 	}
 	if err := yaml.Unmarshal(yamlData, conf); err != nil {
-		return nil, errors.Wrap(err, "parsing config yaml data")
+		return nil, fmt.Errorf("parsing config yaml data: %w", err)
+	}
+	limits, err := parseMaterialLimits(yamlData)
+	if err != nil {
+		return nil, fmt.Errorf("parsing material limits: %w", err)
 	}
+	conf.MaterialLimits = limits
 	return conf, nil
 }
 
 type Config struct {
-	SBOM          bool                `yaml:"sbom"`         // When true, write an SBOM in the working dir
-	ProvenanceDir string              `yaml:"provenance"`   // Directory to write provenance data
-	Runner        RunnerConfig        `yaml:"runner"`       // Tag determining the runner to use
-	Artifacts     ArtifactsConfig     `yaml:"artifacts"`    // Data about artifacts expected to be built
-	Materials     MaterialsConfig     `yaml:"materials"`    // List of materials defined
-	Secrets       []SecretConfig      `yaml:"secrets"`      // Secrets required by the build
-	Env           []EnvConfig         `yaml:"env"`          // Environment vars to require/set
-	Replacements  []ReplacementConfig `yaml:"replacements"` // Replacements to perform before the run
-	Transfers     []TransferConfig    `yaml:"transfers"`    // List of artifacts to be transferred out after the build is done
+	SBOM             bool                    `yaml:"sbom"`             // When true, write an SBOM in the working dir
+	ProvenanceDir    string                  `yaml:"provenance"`       // Directory to write provenance data
+	Runner           RunnerConfig            `yaml:"runner"`           // Tag determining the runner to use
+	Artifacts        ArtifactsConfig         `yaml:"artifacts"`        // Data about artifacts expected to be built
+	Materials        MaterialsConfig         `yaml:"materials"`        // List of materials defined
+	MaterialLimits   MaterialLimits          `yaml:"-"`                // Download limits of the materials, read from their entries
+	Secrets          []SecretConfig          `yaml:"secrets"`          // Secrets required by the build
+	SecretsProviders []SecretsProviderConfig `yaml:"secretsProviders"` // Where to look up the secrets, in order. Defaults to the environment
+	Env              []EnvConfig             `yaml:"env"`              // Environment vars to require/set
+	Replacements     []ReplacementConfig     `yaml:"replacements"`     // Replacements to perform before the run
+	Transfers        []TransferConfig        `yaml:"transfers"`        // List of artifacts to be transferred out after the build is done
+	Tests            TestsConfig             `yaml:"tests"`            // Test reports produced by the build
+	Coverage         CoverageConfig          `yaml:"coverage"`         // Coverage reports produced by the build
+	Cache            CacheConfig             `yaml:"cache"`            // Build cache where artifacts are looked up before building
+	Hooks            HooksConfig             `yaml:"hooks"`            // Shell commands to run at points of the build
+	DelimitedTags    bool                    `yaml:"delimitedTags"`    // Require replacement tags to be enclosed in the delimiter, eg %VERSION%
+	ReplacementState string                  `yaml:"replacementState"` // File in the workdir recording the applied replacements so they are not applied twice
+	FailOnReapply    bool                    `yaml:"failOnReapply"`    // Fail instead of skipping replacements already recorded in the state file
+	Notifications    NotificationsConfig     `yaml:"notifications"`    // Where to send the events of the runs
+	Log              LogConfig               `yaml:"log"`              // Where the run logs are kept and if they are stored with the artifacts
+	Annotations      map[string]string       `yaml:"annotations"`      // Metadata recorded in the provenance and the run results, eg ticket=MM-1234
+	Profile          string                  `yaml:"-"`                // Name of the branch profile applied when loading the file
 }
 
 // Validate checks the configuration values to make sure they are complete
 func (conf *Config) Validate() error {
 	// Check we have a runner
-	if conf.Runner.ID == "" {
+	if conf.Runner.ID == "" && len(conf.Runner.Steps) == 0 {
 		return errors.New("runner ID is missing")
 	}
 
+	// Check all runner steps have an ID
+	for i, step := range conf.Runner.Steps {
+		if step.ID == "" {
+			return fmt.Errorf("runner step #%d ID is missing", i)
+		}
+	}
+
 	// Check all secrets have names
 	if conf.Secrets != nil {
 		for i, s := range conf.Secrets {
 			if s.Name == "" {
-				return errors.Errorf("secret #%d name is blank", i)
+				return fmt.Errorf("secret #%d name is blank", i)
 			}
 		}
 	}
@@ -156,28 +263,45 @@ func (conf *Config) Validate() error {
 	if conf.Env != nil {
 		for i, v := range conf.Env {
 			if v.Var == "" {
-				return errors.Errorf("envvar #%d name is blank", i)
+				return fmt.Errorf("envvar #%d name is blank", i)
 			}
 		}
 		// TODO: Check var name syntax
+		for i, v := range conf.Env {
+			if v.ValueFrom.Secret != "" && !conf.hasSecret(v.ValueFrom.Secret) {
+				return fmt.Errorf("envvar #%d has secret source %s but it is not defined", i, v.ValueFrom.Secret)
+			}
+		}
+	}
+
+	for i, p := range conf.SecretsProviders {
+		switch p.Type {
+		case SecretsProviderEnv:
+		case SecretsProviderFile, SecretsProviderDir:
+			if p.Path == "" {
+				return fmt.Errorf("secrets provider #%d has no path", i)
+			}
+		default:
+			return fmt.Errorf("secrets provider #%d has unknown type %q", i, p.Type)
+		}
 	}
 
 	// Check replacement configuration
 	if conf.Replacements != nil {
 		for i, r := range conf.Replacements {
 			if r.Paths == nil {
-				return errors.Errorf("replacement #%d path is blank", i)
+				return fmt.Errorf("replacement #%d path is blank", i)
 			}
 			if r.Tag == "" {
-				return errors.Errorf("replacement #%d tag is blank", i)
+				return fmt.Errorf("replacement #%d tag is blank", i)
 			}
 
 			if r.ValueFrom.Env == "" && r.ValueFrom.Secret == "" {
-				return errors.Errorf("replacement #%d has no secret or env source ", i)
+				return fmt.Errorf("replacement #%d has no secret or env source ", i)
 			}
 
 			if r.ValueFrom.Env != "" && r.ValueFrom.Secret != "" {
-				return errors.Errorf("replacement #%d has set sources from env and secret", i)
+				return fmt.Errorf("replacement #%d has set sources from env and secret", i)
 			}
 
 			if r.ValueFrom.Secret != "" {
@@ -188,7 +312,7 @@ func (conf *Config) Validate() error {
 						break
 					}
 					if !found {
-						return errors.Errorf("replacement #%d has secret source %s but it is not defined", i, r.ValueFrom.Secret)
+						return fmt.Errorf("replacement #%d has secret source %s but it is not defined", i, r.ValueFrom.Secret)
 					}
 				}
 			}
@@ -201,45 +325,154 @@ func (conf *Config) Validate() error {
 						break
 					}
 					if !found {
-						return errors.Errorf("replacement #%d has env source %s but it is not defined", i, r.ValueFrom.Env)
+						return fmt.Errorf("replacement #%d has env source %s but it is not defined", i, r.ValueFrom.Env)
 					}
 				}
 			}
 		}
 	}
 
+	// Check the replacement tags do not collide
+	set := replacement.Set{}
+	for i, r := range conf.Replacements {
+		if conf.DelimitedTags && !replacement.IsDelimited(r.Tag) {
+			return fmt.Errorf(
+				"replacement #%d tag %q is not enclosed in %s", i, r.Tag, replacement.TagDelimiter,
+			)
+		}
+		set = append(set, replacement.Replacement{Tag: r.Tag, Paths: r.Paths})
+	}
+	if err := set.CheckCollisions(); err != nil {
+		return fmt.Errorf("checking replacement tags: %w", err)
+	}
+
+	for i, w := range conf.Notifications.Webhooks {
+		if w.URL == "" {
+			return fmt.Errorf("webhook #%d has no URL", i)
+		}
+		if w.Format != "" && w.Format != WebhookFormatJSON && w.Format != WebhookFormatMattermost {
+			return fmt.Errorf("webhook #%d has unknown format %s", i, w.Format)
+		}
+	}
+	for _, algo := range conf.Artifacts.Checksums.Algorithms {
+		if _, ok := ChecksumAlgorithms[algo]; !ok {
+			return fmt.Errorf("unsupported checksum algorithm %s", algo)
+		}
+	}
+	if m := conf.Artifacts.Signing.Method; m != "" && m != SigningCosign && m != SigningGPG {
+		return fmt.Errorf("unsupported signing method %s", m)
+	}
+	if f := conf.Log.Format; f != "" && f != LogFormatText && f != LogFormatJSON {
+		return fmt.Errorf("unknown log format %s, must be %s or %s", f, LogFormatText, LogFormatJSON)
+	}
+	for _, p := range conf.Log.Redact {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid log redaction pattern %q: %w", p, err)
+		}
+	}
+	if repo := conf.Notifications.GitHub.Repository; repo != "" {
+		if _, _, err := splitRepository(repo); err != nil {
+			return fmt.Errorf("github notifications: %w", err)
+		}
+	}
+
+	manager := object.NewManager()
 	if conf.Transfers != nil {
 		for i, t := range conf.Transfers {
 			if t.Destination == "" {
-				return errors.Errorf("transfer #%d config has no destination URL", i)
+				return fmt.Errorf("transfer #%d config has no destination URL", i)
 			}
 			if len(t.Source) == 0 {
-				return errors.Errorf("transfer #%d config has empty list of artifacts", i)
+				return fmt.Errorf("transfer #%d config has empty list of artifacts", i)
+			}
+			if err := manager.ValidateURL(t.Destination); err != nil {
+				return fmt.Errorf("transfer #%d destination: %w", i, err)
+			}
+			if len(t.Source) > 1 && !backends.IsPrefixURL(t.Destination) {
+				return fmt.Errorf("transfer #%d copies %d files, its destination must end with a slash", i, len(t.Source))
+			}
+		}
+	}
+
+	if conf.Artifacts.Destination != "" {
+		if err := manager.ValidateURL(conf.Artifacts.Destination); err != nil {
+			return fmt.Errorf("artifacts destination: %w", err)
+		}
+	}
+
+	for i, m := range conf.Materials {
+		if err := manager.ValidateURL(m.URI); err != nil {
+			return fmt.Errorf("material #%d: %w", i, err)
+		}
+		if m.Checksum != "" {
+			if err := manager.ValidateURL(m.Checksum); err != nil {
+				return fmt.Errorf("material #%d checksum: %w", i, err)
 			}
 		}
+		if err := checkMaterialLimit(m.URI, conf.MaterialLimits[m.URI]); err != nil {
+			return fmt.Errorf("material #%d: %w", i, err)
+		}
 	}
 	logrus.Info("Build configuration is valid")
 	return nil
 }
 
+// hasSecret returns true if the secret is defined in the configuration
+func (conf *Config) hasSecret(name string) bool {
+	for _, s := range conf.Secrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 type RunnerConfig struct {
-	ID         string   `yaml:"id"`
-	Parameters []string `yaml:"params"`
+	ID         string         `yaml:"id"`
+	Parameters []string       `yaml:"params"`
+	Steps      []RunnerConfig `yaml:"steps"` // Ordered runners to execute as a composite run
+	When       string         `yaml:"when"`  // Condition to run the step, see EvaluateCondition
+}
+
+// RunnerArguments returns the runner ID and parameters to instanciate the
+// configured runner. When steps are defined, it returns the composite runner
+// ID and the step list encoded as its parameters.
+func (rc *RunnerConfig) RunnerArguments() (id string, params []string) {
+	if len(rc.Steps) == 0 {
+		return rc.ID, rc.Parameters
+	}
+	params = []string{}
+	for _, step := range rc.Steps {
+		params = append(params, "step:"+step.ID)
+		params = append(params, step.Parameters...)
+	}
+	return "composite", params
 }
 
 type SecretConfig struct {
 	Name string `yaml:"name"` // Name of the secret
 }
 
+type SecretsProviderConfig struct {
+	Type   string `yaml:"type"`   // Type of the provider: env, file or dir
+	Path   string `yaml:"path"`   // Secrets file of the file provider, or directory of the dir provider
+	Prefix string `yaml:"prefix"` // Prefix of the variables of the env provider
+}
+
 type EnvConfig struct {
-	Var   string `yaml:"var"`   // Env var name. Will be required
-	Value string `yaml:"value"` // Value. If set, the build system will set it before starting
-	// TODO(@puerco): Support valueFrom to load data from secrets
+	Var       string `yaml:"var"`   // Env var name. Will be required
+	Value     string `yaml:"value"` // Value. If set, the build system will set it before starting
+	ValueFrom struct {
+		Secret string `yaml:"secret"` // Name of the secret to set the value from
+	} `yaml:"valueFrom"`
+	Sensitive bool   `yaml:"sensitive"` // The value is masked in the logs and not recorded in the provenance
+	When      string `yaml:"when"`      // Condition to set the variable, see EvaluateCondition
 }
 
 type ReplacementConfig struct {
 	Required      bool     `yaml:"required"`
 	RequiredPaths bool     `yaml:"requiredPaths"`
+	NoSymlinks    bool     `yaml:"noSymlinks"` // Fail if a path is a symbolic link instead of replacing in its target
 	Tag           string   `yaml:"tag"`
 	Value         string   `yaml:"value"`
 	Paths         []string `yaml:"paths"`
@@ -247,20 +480,161 @@ type ReplacementConfig struct {
 		Secret string `yaml:"secret"`
 		Env    string `yaml:"env"`
 	} `yaml:"valueFrom"`
+	When string `yaml:"when"` // Condition to apply the replacement, see EvaluateCondition
 }
 
 type ArtifactsConfig struct {
-	Destination string   `yaml:"destination"` // URL to store all artifacts from the build
-	Files       []string `yaml:"files"`       // List of files expected from the build
-	Images      []string `yaml:"images"`      // List of container image references to be produced from this build
+	Destination string          `yaml:"destination"` // URL to store all artifacts from the build
+	Files       []string        `yaml:"files"`       // List of files expected from the build
+	Images      []string        `yaml:"images"`      // List of container image references to be produced from this build
+	CheckLeaks  bool            `yaml:"checkLeaks"`  // Fail if replacement tags or secret values are found in the files
+	Discover    []string        `yaml:"discover"`    // Directories where files created or modified by the runner are added to the files
+	Checksums   ChecksumsConfig `yaml:"checksums"`   // Checksum files written for the files
+	Signing     SigningConfig   `yaml:"signing"`     // How the files are signed
+}
+
+type SigningConfig struct {
+	Method string `yaml:"method"` // cosign or gpg. The files are not signed if empty
+	Key    string `yaml:"key"`    // Cosign key reference or GPG key ID. Cosign signs keyless and GPG with its default key if empty
+}
+
+type ChecksumsConfig struct {
+	Algorithms []string `yaml:"algorithms"` // sha256 and sha512 write SHA256SUMS and SHA512SUMS in the workdir. No checksums if empty
+	Sidecars   bool     `yaml:"sidecars"`   // Also write a checksum file next to each file, eg server.tar.gz.sha256
+}
+
+type TestsConfig struct {
+	Reports       []string `yaml:"reports"`       // Glob patterns of JUnit XML or go test JSON reports, relative to the workdir
+	FailOnFailure bool     `yaml:"failOnFailure"` // Fail the run when any test fails, even if the runner succeeded
+}
+
+type CoverageConfig struct {
+	Reports []string `yaml:"reports"` // Glob patterns of coverage reports, relative to the workdir
+}
+
+// CacheConfig defines the build cache. The configuration file only sets
+// where the cache is, the keys and the read only mode decide if the build
+// is trusted, so they are set by the caller.
+type CacheConfig struct {
+	Destination string             `yaml:"destination"` // Object URL prefix where artifacts are cached under the run staging path
+	TTL         time.Duration      `yaml:"ttl"`         // Cached artifacts older than this are rebuilt. Zero means they do not expire
+	ReadOnly    bool               `yaml:"-"`           // Restore artifacts but never store them, eg in builds of untrusted branches
+	PublicKey   ed25519.PublicKey  `yaml:"-"`           // Verifies the signature of the entries, unsigned ones are not restored
+	PrivateKey  ed25519.PrivateKey `yaml:"-"`           // Signs the entries stored. Only trusted builds must have it
+}
+
+// UnmarshalYAML reads the ttl as a Duration, so invalid and negative
+// values are rejected like in the other time settings. The field keeps
+// its time.Duration type for the code setting it.
+func (cc *CacheConfig) UnmarshalYAML(node *yaml.Node) error {
+	var ttl Duration
+	if i := mappingIndex(node, "ttl"); i >= 0 {
+		if err := node.Content[i+1].Decode(&ttl); err != nil {
+			return err
+		}
+	}
+	type plain CacheConfig
+	if err := node.Decode((*plain)(cc)); err != nil {
+		return err
+	}
+	cc.TTL = time.Duration(ttl)
+	return nil
+}
+
+type LogConfig struct {
+	Dir         string   `yaml:"dir"`         // Directory where the runs keep their logs, in a subdirectory each. A temporary directory if empty
+	MaxSize     ByteSize `yaml:"maxSize"`     // Size of the log files before rotating them. Zero disables the rotation
+	MaxFiles    int      `yaml:"maxFiles"`    // Number of rotated log files kept, the oldest are removed. Zero keeps all of them
+	Upload      bool     `yaml:"upload"`      // Store the run log with the artifacts, next to the provenance, and the runner logs
+	Destination string   `yaml:"destination"` // Object URL prefix where the runner logs are uploaded under the run staging path. The artifacts destination if empty
+	Format      string   `yaml:"format"`      // Format of the SDK log lines, text or json. Applied with Build.SetLogFormat()
+	Redact      []string `yaml:"redact"`      // Regular expressions of values masked in the runner output and the SDK logs, besides secrets and common credentials
+}
+
+type HooksConfig struct {
+	PreMaterials []string `yaml:"preMaterials"` // Commands to run before downloading the materials
+	PreRun       []string `yaml:"preRun"`       // Commands to run before executing the runner
+	PostRun      []string `yaml:"postRun"`      // Commands to run after the runner succeeds
+	PostTransfer []string `yaml:"postTransfer"` // Commands to run after the artifact transfers are sent
+}
+
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig    `yaml:"webhooks"` // Webhooks the run events are posted to
+	GitHub   GitHubStatusConfig `yaml:"github"`   // Commit statuses or check runs reporting the runs on GitHub
+}
+
+type GitHubStatusConfig struct {
+	Repository string `yaml:"repository"` // Repository of the build point commits, eg mattermost/mattermost-server. Reporting is off if empty
+	Context    string `yaml:"context"`    // Name of the status or check run, DefaultStatusContext if empty
+	CheckRun   bool   `yaml:"checkRun"`   // Report with a check run showing the end of the log. Needs a GitHub App token
+	TargetURL  string `yaml:"targetURL"`  // Link of the statuses or check runs, eg to the CI job
+}
+
+type WebhookConfig struct {
+	URL    string   `yaml:"url"`    // URL to post the events to
+	Format string   `yaml:"format"` // Payload format, json (the default) or mattermost for incoming webhooks
+	Events []string `yaml:"events"` // Types of the events to post, eg run.failed. All of them when empty
 }
 
 type TransferConfig struct {
 	Source      []string `yaml:"source"`      // List if files to transfer out
-	Destination string   `yaml:"destination"` // An object URL where files will be copied to
+	Destination string   `yaml:"destination"` // Object URL of the copy, or prefix to copy the files into if it ends with a slash
+	Region      string   `yaml:"region"`      // Region of the destination S3 bucket, detected if empty
+	When        string   `yaml:"when"`        // Condition to send the transfer, see EvaluateCondition
 }
 
 type MaterialsConfig []struct {
-	URI    string            `yaml:"uri"`    // URI to locate the source material
-	Digest map[string]string `yaml:"digest"` // String to validate the material
+	URI      string            `yaml:"uri"`      // URI to locate the source material
+	Digest   map[string]string `yaml:"digest"`   // String to validate the material
+	Headers  map[string]string `yaml:"headers"`  // HTTP headers sent when downloading the material, eg Authorization
+	Checksum string            `yaml:"checksum"` // URL of a checksum file (sha256sum format) with the digest of the material
+}
+
+// MaterialLimit are the download limits of a material, set in its entry
+// of the configuration next to the URI
+type MaterialLimit struct {
+	Timeout Duration `yaml:"timeout"` // Time limit to download the material, no limit if zero
+	MaxSize ByteSize `yaml:"maxSize"` // Largest download accepted, checked while receiving it. No limit if zero
+}
+
+// MaterialLimits are the download limits of the materials, by URI
+type MaterialLimits map[string]MaterialLimit
+
+// unlimitedMaterialPrefixes are the prefixes of the material URIs whose
+// downloads cannot be limited, like git clones
+var unlimitedMaterialPrefixes = []string{backends.URLPrefixGit, backends.URLPrefixGitArchive}
+
+// checkMaterialLimit returns an error if the material has download limits
+// but they cannot be enforced
+func checkMaterialLimit(uri string, limit MaterialLimit) error {
+	if limit == (MaterialLimit{}) {
+		return nil
+	}
+	for _, prefix := range unlimitedMaterialPrefixes {
+		if strings.HasPrefix(uri, prefix) {
+			return fmt.Errorf("timeout and maxSize are not supported by %s materials", strings.TrimSuffix(prefix, "+"))
+		}
+	}
+	return nil
+}
+
+// parseMaterialLimits reads the download limits from the materials of the
+// configuration data
+func parseMaterialLimits(yamlData []byte) (MaterialLimits, error) {
+	data := struct {
+		Materials []struct {
+			URI           string `yaml:"uri"`
+			MaterialLimit `yaml:",inline"`
+		} `yaml:"materials"`
+	}{}
+	if err := yaml.Unmarshal(yamlData, &data); err != nil {
+		return nil, err
+	}
+	limits := MaterialLimits{}
+	for _, m := range data.Materials {
+		if m.MaterialLimit != (MaterialLimit{}) {
+			limits[m.URI] = m.MaterialLimit
+		}
+	}
+	return limits, nil
 }
@@ -34,7 +34,7 @@ transfers:
   - source: ["mmctl", "mmctl.sha512"]
     destination: s3://bucket2/projectname/dir/
 materials:
-  - source: "git+https://github.com/foo/bar.git"
+  - uri: "git+https://github.com/foo/bar.git"
     digest:
       sha1: e97447134cd650ee9f9da5d705a06d3c548d3d6c
 `
@@ -83,7 +83,7 @@ materials:
 	require.Equal(t, conf.Transfers[1].Destination, "s3://bucket2/projectname/dir/")
 	require.Equal(t, conf.Transfers[1].Source, []string{"mmctl", "mmctl.sha512"})
 
-	require.Equal(t, conf.Materials[0].URI, "")
+	require.Equal(t, conf.Materials[0].URI, "git+https://github.com/foo/bar.git")
 	require.Len(t, conf.Materials, 1)
 	require.Len(t, conf.Materials[0].Digest, 1)
 	require.Equal(t, conf.Materials[0].Digest["sha1"], "e97447134cd650ee9f9da5d705a06d3c548d3d6c")
@@ -154,6 +154,85 @@ var sampleConfWithVars = `transfers:
     destination: s3://${BUCKET}/gitlab/${PROJECT_NAME}/te/${COMMIT_SHA}
 `
 
+func TestConfigValidateURLs(t *testing.T) {
+	for _, tc := range []struct {
+		Setup       func(*Config)
+		ShouldError bool
+	}{
+		{func(c *Config) {}, false},
+		{func(c *Config) { c.Artifacts.Destination = "s3://bucket/dir" }, false},
+		{func(c *Config) { c.Artifacts.Destination = "bucket/dir" }, true},       // No scheme
+		{func(c *Config) { c.Artifacts.Destination = "ftp://server/dir" }, true}, // No backend
+		{func(c *Config) {
+			c.Transfers = []TransferConfig{{Source: []string{"app"}, Destination: "s3:/bucket"}}
+		}, true},
+		{func(c *Config) {
+			c.Transfers = []TransferConfig{{Source: []string{"app", "app.sha256"}, Destination: "s3://bucket/app"}}
+		}, true}, // Several files need a prefix
+		{func(c *Config) {
+			c.Transfers = []TransferConfig{{Source: []string{"app", "app.sha256"}, Destination: "s3://bucket/app/"}}
+		}, false},
+		{func(c *Config) { c.Notifications.GitHub.Repository = "mattermost/mattermost-server" }, false},
+		{func(c *Config) { c.Notifications.GitHub.Repository = "mattermost-server" }, true}, // No owner
+		{func(c *Config) { c.Log.Redact = []string{`(password=)\S+`} }, false},
+		{func(c *Config) { c.Log.Redact = []string{`(password=`} }, true},
+		{func(c *Config) { c.Artifacts.Checksums.Algorithms = []string{"sha256", "sha512"} }, false},
+		{func(c *Config) { c.Artifacts.Checksums.Algorithms = []string{"md5"} }, true},
+		{func(c *Config) { c.Artifacts.Signing.Method = SigningGPG }, false},
+		{func(c *Config) { c.Artifacts.Signing.Method = "notary" }, true},
+	} {
+		conf := &Config{Runner: RunnerConfig{ID: "make"}}
+		tc.Setup(conf)
+		if tc.ShouldError {
+			require.Error(t, conf.Validate())
+		} else {
+			require.NoError(t, conf.Validate())
+		}
+	}
+}
+
+func TestConfigValidateReplacementTags(t *testing.T) {
+	replacement := func(tag string, paths ...string) ReplacementConfig {
+		r := ReplacementConfig{Tag: tag, Paths: paths}
+		r.ValueFrom.Env = "VERSION"
+		return r
+	}
+	for _, tc := range []struct {
+		Setup       func(*Config)
+		ShouldError bool
+	}{
+		{func(c *Config) {}, false},
+		{func(c *Config) {
+			c.Replacements = append(c.Replacements, replacement("VERSION_MAJOR", "version.go"))
+		}, false}, // Overlapping tags are applied longest first
+		{func(c *Config) {
+			c.Replacements = append(c.Replacements, replacement("VERSION", "main.go", "version.go"))
+		}, true}, // The same tag twice in the same file
+		{func(c *Config) {
+			c.Replacements = append(c.Replacements, replacement("VERSION", "main.go"))
+		}, false},
+		{func(c *Config) { c.DelimitedTags = true }, true}, // Tag not delimited
+		{func(c *Config) {
+			c.DelimitedTags = true
+			c.Replacements = []ReplacementConfig{
+				replacement("%VERSION%", "version.go"), replacement("%VERSION_MAJOR%", "version.go"),
+			}
+		}, false},
+	} {
+		conf := &Config{
+			Runner:       RunnerConfig{ID: "make"},
+			Env:          []EnvConfig{{Var: "VERSION"}},
+			Replacements: []ReplacementConfig{replacement("VERSION", "version.go")},
+		}
+		tc.Setup(conf)
+		if tc.ShouldError {
+			require.Error(t, conf.Validate())
+		} else {
+			require.NoError(t, conf.Validate())
+		}
+	}
+}
+
 func TestExtractConfigVariables(t *testing.T) {
 	flags := extractConfigVariables([]byte(sampleConfWithVars))
 	require.Len(t, flags, 3)
@@ -192,3 +271,27 @@ func TestReplaceVariables(t *testing.T) {
 	require.True(t, strings.Contains(string(newYaml), "destination: s3://mattermost-release/gitlab/project/te/d642f2cd18bf96a3da793d6e594da3b7029c6ca2"))
 	require.True(t, strings.Contains(string(newYaml), "destination: s3://mattermost-release/gitlab/project/ee/test/d642f2cd18bf96a3da793d6e594da3b7029c6ca2"))
 }
+
+func TestRunnerArguments(t *testing.T) {
+	conf, err := parseConf([]byte(`---
+runner:
+  steps:
+    - id: make
+      params: ["package"]
+    - id: npm
+      params: ["build", "--production"]
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.Validate())
+	require.Len(t, conf.Runner.Steps, 2)
+
+	id, params := conf.Runner.RunnerArguments()
+	require.Equal(t, "composite", id)
+	require.Equal(t, []string{"step:make", "package", "step:npm", "build", "--production"}, params)
+
+	// Without steps, the runner is returned as is
+	conf.Runner = RunnerConfig{ID: "make", Parameters: []string{"-v"}}
+	id, params = conf.Runner.RunnerArguments()
+	require.Equal(t, "make", id)
+	require.Equal(t, []string{"-v"}, params)
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the configuration files, detected by their extension
+const (
+	ConfigFormatYAML = "yaml"
+	ConfigFormatJSON = "json"
+	ConfigFormatCUE  = "cue"
+)
+
+// configAnchorPrefix is the prefix of the top level keys holding the
+// blocks reused with YAML aliases, eg x-upload: &upload
+const configAnchorPrefix = "x-"
+
+// CUECommand is the command used to export CUE configurations
+var CUECommand = "cue"
+
+// ConfigFormat returns the format of a configuration file from its
+// extension: .json files are JSON, .cue files are CUE and the rest YAML
+func ConfigFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ConfigFormatJSON
+	case ".cue":
+		return ConfigFormatCUE
+	}
+	return ConfigFormatYAML
+}
+
+// readConfigFile reads a configuration file and returns it as YAML. JSON
+// files are checked and converted, CUE files are evaluated and exported
+// with the cue command, which enforces the constraints they declare and
+// the #Config definition. The
+// aliases of YAML files are expanded.
+func readConfigFile(path string) ([]byte, error) {
+	switch ConfigFormat(path) {
+	case ConfigFormatJSON:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading build configuration file: %w", err)
+		}
+		data, err = jsonToYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		return data, nil
+	case ConfigFormatCUE:
+		return exportCUE(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading build configuration file: %w", err)
+	}
+	return expandConfigAliases(data)
+}
+
+// expandConfigAliases replaces the anchors, aliases and merge keys of
+// YAML data with the values they refer to, so the files can be merged
+// and checked key by key. The top level keys starting with x- only hold
+// anchors and are removed. Data without aliases is returned as it is.
+func expandConfigAliases(data []byte) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil || len(doc.Content) == 0 || !hasAliases(doc) {
+		// Parsing errors are reported when loading the configuration
+		return data, nil
+	}
+	node, err := expandAliases(doc.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("expanding configuration aliases: %w", err)
+	}
+	if node.Kind == yaml.MappingNode {
+		content := []*yaml.Node{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !strings.HasPrefix(node.Content[i].Value, configAnchorPrefix) {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+	}
+	data, err = yaml.Marshal(node)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling configuration: %w", err)
+	}
+	return data, nil
+}
+
+// jsonToYAML converts JSON data to block style YAML, so the rest of the
+// configuration code, which works line by line, handles it like a YAML
+// file. The order of the keys is preserved.
+func jsonToYAML(data []byte) ([]byte, error) {
+	// YAML parses more than JSON, check the syntax first
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	var blockStyle func(*yaml.Node)
+	blockStyle = func(n *yaml.Node) {
+		// The encoder still quotes the strings that look like other types
+		n.Style = 0
+		for _, c := range n.Content {
+			blockStyle(c)
+		}
+	}
+	blockStyle(doc)
+	if len(doc.Content) == 0 {
+		return []byte{}, nil
+	}
+	out, err := yaml.Marshal(doc.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("converting JSON to YAML: %w", err)
+	}
+	return out, nil
+}
+
+// exportCUE evaluates a CUE configuration and returns it as YAML. The
+// exported configuration is checked against the #Config definition.
+func exportCUE(path string) ([]byte, error) {
+	if _, err := exec.LookPath(CUECommand); err != nil {
+		return nil, fmt.Errorf("the %s command is needed to load %s but it was not found in the PATH", CUECommand, path)
+	}
+	data, err := runCUE("export", "--out", "yaml", path)
+	if err != nil {
+		return nil, fmt.Errorf("exporting CUE configuration %s: %w", path, err)
+	}
+
+	// The files vetted together must be in the same directory
+	dir, err := os.MkdirTemp("", "matterbuild-cue-")
+	if err != nil {
+		return nil, fmt.Errorf("creating CUE schema directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	cueSchema, err := ConfigCUESchema()
+	if err != nil {
+		return nil, err
+	}
+	schemaPath := filepath.Join(dir, "matterbuild.schema.cue")
+	if err := os.WriteFile(schemaPath, cueSchema, os.FileMode(0o644)); err != nil {
+		return nil, fmt.Errorf("writing CUE schema: %w", err)
+	}
+	exportPath := filepath.Join(dir, "matterbuild.yaml")
+	if err := os.WriteFile(exportPath, data, os.FileMode(0o644)); err != nil {
+		return nil, fmt.Errorf("writing exported CUE configuration: %w", err)
+	}
+	if _, err := runCUE("vet", "-d", ConfigCUEDefinition, schemaPath, exportPath); err != nil {
+		return nil, fmt.Errorf("checking CUE configuration %s against %s: %w", path, ConfigCUEDefinition, err)
+	}
+	return data, nil
+}
+
+// runCUE runs the cue command and returns its output, its error output
+// is part of the error
+func runCUE(args ...string) ([]byte, error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(CUECommand, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.Bytes(), nil
+}
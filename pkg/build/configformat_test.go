@@ -0,0 +1,149 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFormat(t *testing.T) {
+	require.Equal(t, ConfigFormatYAML, ConfigFormat("matterbuild.yaml"))
+	require.Equal(t, ConfigFormatYAML, ConfigFormat("matterbuild.yml"))
+	require.Equal(t, ConfigFormatJSON, ConfigFormat("ci/matterbuild.JSON"))
+	require.Equal(t, ConfigFormatCUE, ConfigFormat("matterbuild.cue"))
+}
+
+func TestLoadJSONConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(`env:
+  - var: BUCKET
+    value: mattermost-releases
+`), os.FileMode(0o644)))
+	conf := filepath.Join(dir, "matterbuild.json")
+	require.NoError(t, os.WriteFile(conf, []byte(`{
+	"extends": "base.yaml",
+	"runner": {"id": "make", "params": ["build", "VERSION=${MMBUILD_RUN_ID}"]},
+	"env": [{"var": "GOOS", "value": "linux"}, {"var": "RETRIES", "value": "3"}],
+	"transfers": [{"source": ["dist/app.tar.gz"], "destination": "s3://${BUCKET}/latest/"}]
+}`), os.FileMode(0o644)))
+
+	c, err := LoadConfigForBranch(conf, "master")
+	require.NoError(t, err)
+	require.Equal(t, "make", c.Runner.ID)
+	require.Equal(t, []string{"build", "VERSION=${MMBUILD_RUN_ID}"}, c.Runner.Parameters)
+	require.Len(t, c.Env, 3)
+	require.Equal(t, "3", c.Env[2].Value)
+	require.Equal(t, "s3://mattermost-releases/latest/", c.Transfers[0].Destination)
+
+	// YAML accepts the trailing comma, the JSON check does not
+	require.NoError(t, os.WriteFile(conf, []byte(`{"runner": {"id": "make",}}`), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid JSON")
+}
+
+func TestLoadCUEConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake cue command is a shell script")
+	}
+	dir := t.TempDir()
+	// Fake cue command printing the export of the file
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cue"), []byte(`#!/bin/sh
+if [ "$1 $2 $3" = "vet -d #Config" ]; then
+	grep -q '^#Config: {' "$4" || exit 1
+	grep -q unknown "$5" && { echo "unknown: field not allowed" >&2; exit 1; }
+	exit 0
+fi
+if [ "$1 $2 $3" != "export --out yaml" ]; then exit 1; fi
+grep -q invalid "$4" && { echo "runner.id: conflicting values" >&2; exit 1; }
+grep -q unknown "$4" && { printf 'runner:\n  id: make\nunknown: true\n'; exit 0; }
+printf 'runner:\n  id: make\n  params: ["build"]\n'
+`), os.FileMode(0o755)))
+	defer func(c string) { CUECommand = c }(CUECommand)
+	CUECommand = filepath.Join(dir, "cue")
+
+	conf := filepath.Join(dir, "matterbuild.cue")
+	require.NoError(t, os.WriteFile(conf, []byte("runner: id: \"make\"\n"), os.FileMode(0o644)))
+	c, err := LoadConfigForBranch(conf, "master")
+	require.NoError(t, err)
+	require.Equal(t, "make", c.Runner.ID)
+	require.Equal(t, []string{"build"}, c.Runner.Parameters)
+
+	require.NoError(t, os.WriteFile(conf, []byte("// invalid\n"), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "conflicting values")
+
+	// The export is checked against #Config
+	require.NoError(t, os.WriteFile(conf, []byte("// unknown\n"), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field not allowed")
+
+	CUECommand = filepath.Join(dir, "not-installed")
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found in the PATH")
+}
+
+func TestConfigCUESchema(t *testing.T) {
+	cueSchema, err := ConfigCUESchema()
+	require.NoError(t, err)
+	s := string(cueSchema)
+	require.Contains(t, s, "#Config: {\n")
+	require.Contains(t, s, "\trunner: #runner\n")
+	require.Contains(t, s, "\tsbom?: bool\n")
+	require.Contains(t, s, "\t\tformat?: \"text\" | \"json\"\n")
+	require.Contains(t, s, "\tvar: string & =~\"^.{1,}\"\n")
+	require.Contains(t, s, "\n#runner: {\n")
+	require.Contains(t, s, "\n#stringMap: {\n\t[string]: string\n}\n")
+}
+
+// TestLoadCUEConfigWithCUE evaluates configurations with the real cue
+// command, when it is installed
+func TestLoadCUEConfigWithCUE(t *testing.T) {
+	if _, err := exec.LookPath(CUECommand); err != nil {
+		t.Skip("the cue command is not installed")
+	}
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "matterbuild.cue")
+	require.NoError(t, os.WriteFile(conf, []byte(`goos: "linux" | "darwin"
+goos: "linux"
+runner: {id: "make", params: ["build", "GOOS=\(goos)"]}
+env: [{var: "GOOS", value: goos}]
+`), os.FileMode(0o644)))
+	_, err := LoadConfigForBranch(conf, "master")
+	require.Error(t, err, "goos is not a configuration setting")
+	require.Contains(t, err.Error(), ConfigCUEDefinition)
+
+	// Hidden fields are not exported
+	require.NoError(t, os.WriteFile(conf, []byte(`_goos: "linux" | "darwin"
+_goos: "linux"
+runner: {id: "make", params: ["build", "GOOS=\(_goos)"]}
+env: [{var: "GOOS", value: _goos}]
+`), os.FileMode(0o644)))
+	c, err := LoadConfigForBranch(conf, "master")
+	require.NoError(t, err)
+	require.Equal(t, []string{"build", "GOOS=linux"}, c.Runner.Parameters)
+	require.Equal(t, "linux", c.Env[0].Value)
+
+	// Nested settings are checked too
+	require.NoError(t, os.WriteFile(conf, []byte(`runner: {id: "make", param: ["build"]}
+`), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+
+	// And so are their types
+	require.NoError(t, os.WriteFile(conf, []byte(`runner: id: "make"
+sbom: "yes"
+`), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/hash"
+)
+
+// isConfigURL returns true if the configuration path is a URL to fetch
+// with the object manager instead of a local file
+func isConfigURL(configPath string) bool {
+	return strings.Contains(configPath, "://")
+}
+
+// fetchConfig downloads a configuration file from a URL to a temporary
+// directory and returns its local path and digest. Git URLs clone the
+// repository, the file is the one in the URL fragment or the default
+// configuration file at its root:
+//
+//	git+https://github.com/mattermost/mattermost-server@<sha>#build/matterbuild.yaml
+//
+// The digest of git configurations is the commit, read when loading the
+// file from the clone. The returned function removes the download.
+func fetchConfig(configURL string) (localPath string, digest map[string]string, cleanup func(), err error) {
+	cleanup = func() {}
+	dir, err := os.MkdirTemp("", "matterbuild-config-")
+	if err != nil {
+		return "", nil, cleanup, fmt.Errorf("creating configuration download directory: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	om := object.NewManager()
+	if strings.HasPrefix(configURL, backends.URLPrefixGit) {
+		repoURL, entryPoint := configURL, ConfigFileName
+		if i := strings.Index(configURL, "#"); i >= 0 {
+			repoURL, entryPoint = configURL[:i], configURL[i+1:]
+		}
+		clone := filepath.Join(dir, "repo")
+		logrus.Infof("Cloning build configuration from %s", repoURL)
+		if err := om.Copy(repoURL, backends.URLPrefixFilesystem+clone); err != nil {
+			return "", nil, cleanup, fmt.Errorf("cloning configuration repository %s: %w", repoURL, err)
+		}
+		localPath = filepath.Join(clone, filepath.FromSlash(path.Clean("/"+entryPoint)))
+		return localPath, nil, cleanup, nil
+	}
+
+	// Keep the extension of the URL, it gives the format of the file
+	localPath = filepath.Join(dir, ConfigFileName)
+	if u, err := url.Parse(configURL); err == nil && ConfigFormat(u.Path) != ConfigFormatYAML {
+		localPath = filepath.Join(dir, "matterbuild"+path.Ext(u.Path))
+	}
+	logrus.Infof("Downloading build configuration from %s", configURL)
+	if err := om.Copy(configURL, backends.URLPrefixFilesystem+localPath); err != nil {
+		return "", nil, cleanup, fmt.Errorf("downloading configuration from %s: %w", configURL, err)
+	}
+	sha256, err := hash.SHA256ForFile(localPath)
+	if err != nil {
+		return "", nil, cleanup, fmt.Errorf("hashing configuration file: %w", err)
+	}
+	return localPath, map[string]string{"sha256": sha256}, cleanup, nil
+}
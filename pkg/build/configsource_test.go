@@ -0,0 +1,51 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigURL(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runners.DefaultOptions.EnvVars = map[string]string{}
+
+	conf := "runner:\n  id: make\n  params: [\"package\"]\nenv:\n  - var: GOOS\n    value: linux\n"
+	sum := sha256.Sum256([]byte(conf))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ci/matterbuild.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(conf)) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	configURL := server.URL + "/ci/matterbuild.yaml"
+	b, err := NewFromConfigFile(configURL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"package"}, b.runner.Arguments())
+	require.Equal(t, "linux", b.Options().EnvVars["GOOS"])
+	require.Equal(t, configURL, b.Options().ConfigFile)
+	require.Equal(t, map[string]string{"sha256": hex.EncodeToString(sum[:])}, b.Options().ConfigDigest)
+
+	// The provenance attests the configuration URL and digest
+	b.Options().Workdir = t.TempDir()
+	statement, err := b.Run().Provenance()
+	require.NoError(t, err)
+	require.Equal(t, configURL, statement.Predicate.Invocation.ConfigSource.URI)
+	require.Equal(t, hex.EncodeToString(sum[:]), statement.Predicate.Invocation.ConfigSource.Digest["sha256"])
+
+	// Missing configurations fail to load
+	_, err = NewFromConfigFile(server.URL + "/missing.yaml")
+	require.Error(t, err)
+}
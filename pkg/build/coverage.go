@@ -0,0 +1,150 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const goCoverModePrefix = "mode:"
+
+// CoverageSummary counts the statements covered in go cover profiles
+type CoverageSummary struct {
+	Statements int // Number of statements found in the profiles
+	Covered    int // Statements executed at least once
+}
+
+// Percent returns the percentage of statements covered
+func (cs *CoverageSummary) Percent() float64 {
+	if cs.Statements == 0 {
+		return 0
+	}
+	return float64(cs.Covered) * 100 / float64(cs.Statements)
+}
+
+// coverageProfile accumulates the blocks of one or more go cover
+// profiles. Blocks found in more than one profile are counted once and
+// considered covered if any of the profiles executed them.
+type coverageProfile struct {
+	statements map[string]int
+	covered    map[string]bool
+}
+
+func newCoverageProfile() *coverageProfile {
+	return &coverageProfile{
+		statements: map[string]int{},
+		covered:    map[string]bool{},
+	}
+}
+
+// add parses a go cover profile. It returns false if the data is not
+// a go cover profile.
+func (cp *coverageProfile) add(data []byte) (bool, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), goCoverModePrefix) {
+		return false, nil
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		// Lines look like: file.go:10.2,12.16 2 1
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return true, fmt.Errorf("invalid cover profile line: %s", line)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return true, fmt.Errorf("reading statement count in %s: %w", line, err)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return true, fmt.Errorf("reading execution count in %s: %w", line, err)
+		}
+		cp.statements[fields[0]] = statements
+		if count > 0 {
+			cp.covered[fields[0]] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("reading cover profile: %w", err)
+	}
+	return true, nil
+}
+
+func (cp *coverageProfile) summary() *CoverageSummary {
+	s := &CoverageSummary{}
+	for block, statements := range cp.statements {
+		s.Statements += statements
+		if cp.covered[block] {
+			s.Covered += statements
+		}
+	}
+	return s
+}
+
+// ParseCoverProfile computes the coverage of a go cover profile
+func ParseCoverProfile(data []byte) (*CoverageSummary, error) {
+	profile := newCoverageProfile()
+	ok, err := profile.add(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("data is not a go cover profile")
+	}
+	return profile.summary(), nil
+}
+
+// collectCoverageReports finds the coverage reports configured for the
+// run and computes the coverage from the go cover profiles among them.
+// Other formats are stored with the artifacts but not computed.
+func (dri *defaultRunImplementation) collectCoverageReports(r *Run) error {
+	if len(r.opts.Coverage.Reports) == 0 {
+		return nil
+	}
+	workdir := r.runner.Options().Workdir
+	reports, err := findReports(workdir, r.opts.Coverage.Reports)
+	if err != nil {
+		return fmt.Errorf("searching for coverage reports: %w", err)
+	}
+
+	profile := newCoverageProfile()
+	profiles := 0
+	for _, report := range reports {
+		data, err := os.ReadFile(filepath.Join(workdir, report))
+		if err != nil {
+			return fmt.Errorf("reading coverage report %s: %w", report, err)
+		}
+		ok, err := profile.add(data)
+		if err != nil {
+			return fmt.Errorf("parsing coverage report %s: %w", report, err)
+		}
+		if !ok {
+			logrus.Infof("Coverage report %s is not a go cover profile, not computing it", report)
+			continue
+		}
+		profiles++
+	}
+	r.CoverageReports = reports
+	if profiles == 0 {
+		return nil
+	}
+	r.Coverage = profile.summary()
+	logrus.Infof(
+		"Coverage is %.1f%% (%d of %d statements) in %d profiles",
+		r.Coverage.Percent(), r.Coverage.Covered, r.Coverage.Statements, profiles,
+	)
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCoverProfile(t *testing.T) {
+	s, err := ParseCoverProfile([]byte(`mode: set
+example.com/pkg/file.go:10.2,12.16 2 1
+example.com/pkg/file.go:12.16,14.3 1 0
+example.com/pkg/file.go:16.2,16.10 1 1
+`))
+	require.NoError(t, err)
+	require.Equal(t, 4, s.Statements)
+	require.Equal(t, 3, s.Covered)
+	require.Equal(t, 75.0, s.Percent())
+
+	_, err = ParseCoverProfile([]byte("SF:src/index.js\nend_of_record\n"))
+	require.Error(t, err)
+
+	_, err = ParseCoverProfile([]byte("mode: set\nexample.com/pkg/file.go:10.2,12.16 two 1\n"))
+	require.Error(t, err)
+}
+
+func TestCollectCoverageReports(t *testing.T) {
+	dir := t.TempDir()
+	// Blocks in more than one profile are counted once
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unit.out"), []byte(
+		"mode: count\nexample.com/pkg/a.go:1.1,2.2 3 0\nexample.com/pkg/a.go:3.1,4.2 1 4\n",
+	), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "integration.out"), []byte(
+		"mode: count\nexample.com/pkg/a.go:1.1,2.2 3 1\n",
+	), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lcov.info"), []byte("SF:src/index.js\nend_of_record\n"), os.FileMode(0o644)))
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().Workdir = dir
+
+	r := &Run{
+		runner: runner,
+		opts: &RunOptions{
+			Coverage: CoverageConfig{Reports: []string{"*.out", "lcov.info"}},
+		},
+	}
+	ri := defaultRunImplementation{}
+	require.NoError(t, ri.collectCoverageReports(r))
+	require.Equal(t, []string{"integration.out", "lcov.info", "unit.out"}, r.CoverageReports)
+	require.Equal(t, 4, r.Coverage.Statements)
+	require.Equal(t, 4, r.Coverage.Covered)
+	require.Equal(t, 100.0, r.Coverage.Percent())
+}
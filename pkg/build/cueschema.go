@@ -0,0 +1,166 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigCUEDefinition is the name of the CUE definition of the build
+// configuration
+const ConfigCUEDefinition = "#Config"
+
+var (
+	cueIdentifier = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	cueKeywords   = map[string]bool{
+		"package": true, "import": true, "for": true, "in": true, "if": true,
+		"let": true, "true": true, "false": true, "null": true,
+	}
+)
+
+// ConfigCUESchema returns the build configuration schema as CUE. The
+// #Config definition is generated from ConfigSchema, the definitions
+// it uses are named after the JSON Schema ones, eg #runner.
+func ConfigCUESchema() ([]byte, error) {
+	root := &schema{}
+	if err := json.Unmarshal(ConfigSchema, root); err != nil {
+		return nil, fmt.Errorf("parsing configuration schema: %w", err)
+	}
+	g := &cueGenerator{buf: &bytes.Buffer{}}
+	g.buf.WriteString("// Code generated from matterbuild.schema.json. DO NOT EDIT.\n\n")
+	g.buf.WriteString(ConfigCUEDefinition + ": ")
+	if err := g.write(root, 0); err != nil {
+		return nil, err
+	}
+	g.buf.WriteString("\n")
+
+	names := []string{}
+	for name := range root.Defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(g.buf, "\n#%s: ", name)
+		if err := g.write(root.Defs[name], 0); err != nil {
+			return nil, fmt.Errorf("converting definition %s: %w", name, err)
+		}
+		g.buf.WriteString("\n")
+	}
+	return g.buf.Bytes(), nil
+}
+
+// cueGenerator writes the CUE expressions of the schema types
+type cueGenerator struct {
+	buf *bytes.Buffer
+}
+
+func (g *cueGenerator) write(s *schema, depth int) error {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/$defs/")
+		if name == s.Ref {
+			return fmt.Errorf("unsupported schema reference %s", s.Ref)
+		}
+		g.buf.WriteString("#" + name)
+		return nil
+	}
+
+	if len(s.Enum) > 0 {
+		values := []string{}
+		for _, e := range s.Enum {
+			values = append(values, strconv.Quote(e))
+		}
+		g.buf.WriteString(strings.Join(values, " | "))
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		return g.writeObject(s, depth)
+	case "array":
+		if s.Items == nil {
+			g.buf.WriteString("[...]")
+			return nil
+		}
+		g.buf.WriteString("[...")
+		if err := g.write(s.Items, depth); err != nil {
+			return err
+		}
+		g.buf.WriteString("]")
+	case "boolean":
+		g.buf.WriteString("bool")
+	case "integer":
+		g.buf.WriteString("int")
+	case "number":
+		g.buf.WriteString("number")
+	case "string":
+		// Formats are checked by the JSON Schema after exporting
+		if s.MinLength > 0 {
+			fmt.Fprintf(g.buf, "string & =~%s", strconv.Quote(fmt.Sprintf("^.{%d,}", s.MinLength)))
+			return nil
+		}
+		g.buf.WriteString("string")
+	case "":
+		g.buf.WriteString("_")
+	default:
+		return fmt.Errorf("unsupported schema type %s", s.Type)
+	}
+	return nil
+}
+
+func (g *cueGenerator) writeObject(s *schema, depth int) error {
+	indent := strings.Repeat("\t", depth+1)
+	g.buf.WriteString("{\n")
+
+	required := map[string]bool{}
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	names := []string{}
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop := s.Properties[name]
+		if prop.Description != "" {
+			fmt.Fprintf(g.buf, "%s// %s\n", indent, prop.Description)
+		}
+		label := name
+		if !cueIdentifier.MatchString(name) || cueKeywords[name] {
+			label = strconv.Quote(name)
+		}
+		if !required[name] {
+			label += "?"
+		}
+		g.buf.WriteString(indent + label + ": ")
+		if err := g.write(prop, depth+1); err != nil {
+			return err
+		}
+		g.buf.WriteString("\n")
+	}
+
+	// Objects are closed unless additionalProperties allows other keys
+	switch {
+	case len(s.AdditionalProperties) == 0 || string(s.AdditionalProperties) == "true":
+		g.buf.WriteString(indent + "...\n")
+	case string(s.AdditionalProperties) != "false":
+		additional := &schema{}
+		if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+			return fmt.Errorf("parsing additionalProperties: %w", err)
+		}
+		g.buf.WriteString(indent + "[string]: ")
+		if err := g.write(additional, depth+1); err != nil {
+			return err
+		}
+		g.buf.WriteString("\n")
+	}
+	g.buf.WriteString(strings.Repeat("\t", depth) + "}")
+	return nil
+}
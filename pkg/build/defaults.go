@@ -0,0 +1,180 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configDefaultsKey is the key of the settings shared by list entries
+const configDefaultsKey = "defaults"
+
+// yamlMergeKey is the YAML merge key, which copies the keys of a map
+// into another, eg <<: *transfer-defaults
+const yamlMergeKey = "<<"
+
+// defaultLists are the lists whose entries get the settings in defaults
+var defaultLists = map[string]bool{"transfers": true, "replacements": true, "materials": true}
+
+// applyDefaults merges the settings under defaults into every entry of
+// the lists of the same name, and removes the defaults from the data. The
+// settings of the entries win, maps are merged key by key. Data without
+// defaults is returned as it is.
+func applyDefaults(yamlData []byte) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(yamlData, doc); err != nil || len(doc.Content) == 0 {
+		// Parsing errors are reported when loading the configuration
+		return yamlData, nil
+	}
+	node := doc.Content[0]
+	i := mappingIndex(node, configDefaultsKey)
+	if i < 0 {
+		return yamlData, nil
+	}
+	defaults := node.Content[i+1]
+	node.Content = append(node.Content[:i], node.Content[i+2:]...)
+	if defaults.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: defaults must be a map of list names", defaults.Line)
+	}
+
+	for j := 0; j+1 < len(defaults.Content); j += 2 {
+		name, settings := defaults.Content[j], defaults.Content[j+1]
+		if !defaultLists[name.Value] {
+			return nil, fmt.Errorf("line %d: %s entries cannot have defaults", name.Line, name.Value)
+		}
+		if settings.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: defaults of %s must be a map of settings", settings.Line, name.Value)
+		}
+		k := mappingIndex(node, name.Value)
+		if k < 0 || node.Content[k+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		list := node.Content[k+1]
+		for n, item := range list.Content {
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			merged := copyNode(settings)
+			mergeConfigNodes(merged, item, false)
+			list.Content[n] = merged
+		}
+	}
+
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling configuration defaults: %w", err)
+	}
+	return data, nil
+}
+
+// hasAliases returns true if a node uses aliases or merge keys
+func hasAliases(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode || (node.Kind == yaml.ScalarNode && node.Tag == "!!merge") {
+		return true
+	}
+	for _, c := range node.Content {
+		if hasAliases(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxExpandedNodes caps the nodes written when expanding the aliases of a
+// configuration, so aliases of aliases cannot blow it up exponentially
+const maxExpandedNodes = 100000
+
+// aliasExpander replaces the aliases of a node, tracking the anchors being
+// expanded to reject aliases contained in the node they point to
+type aliasExpander struct {
+	visiting map[*yaml.Node]bool
+	nodes    int
+}
+
+// expandAliases returns a copy of a node with the aliases replaced by the
+// nodes they point to and the merge keys replaced by the keys they merge.
+// Keys set in a map win over the merged ones, and the first merged map
+// wins over the next ones. Recursive aliases and expansions larger than
+// maxExpandedNodes are errors.
+func expandAliases(node *yaml.Node) (*yaml.Node, error) {
+	e := &aliasExpander{visiting: map[*yaml.Node]bool{}}
+	return e.expand(node)
+}
+
+func (e *aliasExpander) expand(node *yaml.Node) (*yaml.Node, error) {
+	if node.Kind == yaml.AliasNode {
+		if e.visiting[node.Alias] {
+			return nil, fmt.Errorf("line %d: alias *%s refers to itself", node.Line, node.Value)
+		}
+		return e.expand(node.Alias)
+	}
+	e.nodes++
+	if e.nodes > maxExpandedNodes {
+		return nil, fmt.Errorf("line %d: aliases expand to more than %d values", node.Line, maxExpandedNodes)
+	}
+	if node.Anchor != "" {
+		// Aliases inside the anchored node cannot point back to it
+		e.visiting[node] = true
+		defer delete(e.visiting, node)
+	}
+	expanded := *node
+	expanded.Anchor = ""
+	expanded.Content = nil
+	if node.Kind != yaml.MappingNode {
+		for _, c := range node.Content {
+			ec, err := e.expand(c)
+			if err != nil {
+				return nil, err
+			}
+			expanded.Content = append(expanded.Content, ec)
+		}
+		return &expanded, nil
+	}
+
+	merged := []*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		ev, err := e.expand(value)
+		if err != nil {
+			return nil, err
+		}
+		if key.Value != yamlMergeKey || key.Tag != "!!merge" {
+			expanded.Content = append(expanded.Content, copyNode(key), ev)
+			continue
+		}
+		switch ev.Kind {
+		case yaml.MappingNode:
+			merged = append(merged, ev)
+		case yaml.SequenceNode:
+			for _, m := range ev.Content {
+				if m.Kind != yaml.MappingNode {
+					return nil, fmt.Errorf("line %d: merge key values must be maps", m.Line)
+				}
+				merged = append(merged, m)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: merge key values must be maps", value.Line)
+		}
+	}
+	for _, m := range merged {
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if mappingIndex(&expanded, m.Content[i].Value) < 0 {
+				expanded.Content = append(expanded.Content, copyNode(m.Content[i]), copyNode(m.Content[i+1]))
+			}
+		}
+	}
+	return &expanded, nil
+}
+
+// copyNode returns a deep copy of a node
+func copyNode(node *yaml.Node) *yaml.Node {
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, n := range node.Content {
+		c.Content[i] = copyNode(n)
+	}
+	return &c
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+defaults:
+  transfers:
+    destination: s3://mattermost-releases/latest/
+    region: us-east-1
+transfers:
+  - source: ["dist/app.tar.gz"]
+  - source: ["dist/app.zip"]
+    destination: s3://mattermost-releases-eu/latest/
+    region: eu-west-1
+`), os.FileMode(0o644)))
+
+	c, err := LoadConfigForBranch(conf, "master")
+	require.NoError(t, err)
+	require.Len(t, c.Transfers, 2)
+	require.Equal(t, "s3://mattermost-releases/latest/", c.Transfers[0].Destination)
+	require.Equal(t, "us-east-1", c.Transfers[0].Region)
+	require.Equal(t, "s3://mattermost-releases-eu/latest/", c.Transfers[1].Destination)
+	require.Equal(t, "eu-west-1", c.Transfers[1].Region)
+
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+defaults:
+  secrets:
+    name: TOKEN
+`), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+}
+
+func TestConfigAliases(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`x-upload: &upload
+  destination: s3://mattermost-releases/latest/
+  region: us-east-1
+runner:
+  id: make
+  params: &params ["build"]
+transfers:
+  - <<: *upload
+    source: ["dist/app.tar.gz"]
+  - <<: *upload
+    source: ["dist/app.zip"]
+    region: eu-west-1
+`), os.FileMode(0o644)))
+
+	c, err := LoadConfigForBranch(conf, "master")
+	require.NoError(t, err)
+	require.Equal(t, []string{"build"}, c.Runner.Parameters)
+	require.Len(t, c.Transfers, 2)
+	require.Equal(t, "s3://mattermost-releases/latest/", c.Transfers[0].Destination)
+	require.Equal(t, "us-east-1", c.Transfers[0].Region)
+	require.Equal(t, "s3://mattermost-releases/latest/", c.Transfers[1].Destination)
+	require.Equal(t, "eu-west-1", c.Transfers[1].Region)
+
+	// Aliases contained in their anchor are rejected
+	require.NoError(t, os.WriteFile(conf, []byte("runner:\n  id: make\n  params: &params [build, *params]\n"), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "refers to itself")
+
+	// And so are aliases expanding exponentially
+	laughs := "x-lol0: &lol0 [lol, lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+	for i := 1; i < 9; i++ {
+		laughs += fmt.Sprintf("x-lol%d: &lol%d [", i, i) + strings.Repeat(fmt.Sprintf("*lol%d, ", i-1), 9) + fmt.Sprintf("*lol%d]\n", i-1)
+	}
+	require.NoError(t, os.WriteFile(conf, []byte(laughs+"runner:\n  id: make\n  params: *lol8\n"), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expand to more than")
+}
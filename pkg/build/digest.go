@@ -0,0 +1,102 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+)
+
+// digestCache stores the digests computed during a run so the same
+// objects are not hashed again in later phases. Local files are keyed
+// by path, modification time and size, so a file modified during the
+// run is hashed again. Remote objects are keyed by their URL.
+type digestCache struct {
+	mu      sync.Mutex
+	files   map[fileKey]map[string]string
+	objects map[string]map[string]string
+	manager *object.Manager // Object manager used to hash remote objects
+}
+
+type fileKey struct {
+	path  string
+	mtime int64
+	size  int64
+}
+
+func newDigestCache() *digestCache {
+	return &digestCache{
+		files:   map[fileKey]map[string]string{},
+		objects: map[string]map[string]string{},
+	}
+}
+
+// digestCache returns the digest cache of the run
+func (r *Run) digestCache() *digestCache {
+	if r.digests == nil {
+		r.digests = newDigestCache()
+		r.digests.manager = r.materialsManager()
+	}
+	return r.digests
+}
+
+// fileDigests returns the digest set of a local file
+func (dc *digestCache) fileDigests(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("checking %s: %w", path, err)
+	}
+	key := fileKey{path: path, mtime: info.ModTime().UnixNano(), size: info.Size()}
+
+	dc.mu.Lock()
+	cached, ok := dc.files[key]
+	dc.mu.Unlock()
+	if ok {
+		return copyDigest(cached), nil
+	}
+
+	digests, err := digestSetForFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dc.mu.Lock()
+	dc.files[key] = copyDigest(digests)
+	dc.mu.Unlock()
+	return digests, nil
+}
+
+// objectHash returns the hashes of an object from the object manager
+func (dc *digestCache) objectHash(objectURL string) (map[string]string, error) {
+	dc.mu.Lock()
+	cached, ok := dc.objects[objectURL]
+	dc.mu.Unlock()
+	if ok {
+		return copyDigest(cached), nil
+	}
+
+	manager := dc.manager
+	if manager == nil {
+		manager = object.NewManager()
+	}
+	hashes, err := manager.GetObjectHash(objectURL)
+	if err != nil {
+		return nil, err
+	}
+	dc.mu.Lock()
+	dc.objects[objectURL] = copyDigest(hashes)
+	dc.mu.Unlock()
+	return hashes, nil
+}
+
+// copyDigest copies a digest set to keep the cached one from being modified
+func copyDigest(digest map[string]string) map[string]string {
+	c := make(map[string]string, len(digest))
+	for algo, h := range digest {
+		c[algo] = h
+	}
+	return c
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifact.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Hola amigos\n"), os.FileMode(0o644)))
+	mtime := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	r := &Run{}
+	first, err := r.digestCache().fileDigests(path)
+	require.NoError(t, err)
+	expected, err := digestSetForFile(path)
+	require.NoError(t, err)
+	require.Equal(t, expected, first)
+
+	// Modifying the returned set does not alter the cache
+	first["sha256"] = "modified"
+
+	// Same path, size and mtime hit the cache even if the data changed
+	require.NoError(t, os.WriteFile(path, []byte("Hola mundos\n"), os.FileMode(0o644)))
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	cached, err := r.digestCache().fileDigests(path)
+	require.NoError(t, err)
+	require.Equal(t, expected, cached)
+
+	// A new modification time invalidates the cached digests
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now()))
+	updated, err := r.digestCache().fileDigests(path)
+	require.NoError(t, err)
+	require.NotEqual(t, expected["sha256"], updated["sha256"])
+
+	_, err = r.digestCache().fileDigests(path + ".missing")
+	require.Error(t, err)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mattermost/cicd-sdk/pkg/snapshot"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshotArtifacts records the files in the artifact discovery
+// directories before the runner executes
+func (dri *defaultRunImplementation) snapshotArtifacts(r *Run) error {
+	if len(r.opts.Artifacts.Discover) == 0 {
+		return nil
+	}
+	s, err := snapshot.Take(r.runner.Options().Workdir, &snapshot.Options{Paths: r.opts.Artifacts.Discover})
+	if err != nil {
+		return fmt.Errorf("taking snapshot of the discovery directories: %w", err)
+	}
+	r.snapshot = s
+	return nil
+}
+
+// discoverArtifacts compares the discovery directories with the snapshot
+// taken before the runner executed. The files it created or modified are
+// added to the run artifacts.
+func (dri *defaultRunImplementation) discoverArtifacts(r *Run) error {
+	if len(r.opts.Artifacts.Discover) == 0 {
+		return nil
+	}
+	after, err := r.snapshot.Update(&snapshot.Options{Paths: r.opts.Artifacts.Discover})
+	if err != nil {
+		return fmt.Errorf("taking snapshot of the discovery directories: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, f := range r.opts.Artifacts.Files {
+		known[filepath.Clean(f)] = true
+	}
+	r.Discovered = []string{}
+	for _, path := range r.snapshot.Diff(after).Changed() {
+		r.Discovered = append(r.Discovered, filepath.FromSlash(path))
+	}
+	for _, path := range r.Discovered {
+		if !known[path] {
+			r.opts.Artifacts.Files = append(r.opts.Artifacts.Files, path)
+		}
+	}
+	logrus.Infof("Discovered %d artifacts produced by the run", len(r.Discovered))
+	return nil
+}
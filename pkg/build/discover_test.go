@@ -0,0 +1,67 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), os.FileMode(0o644)))
+	}
+	write("dist/old.tar.gz", "old")
+	write("dist/changed.txt", "v1")
+	write("src/main.go", "package main")
+
+	runner := runners.NewMake()
+	runner.Options().Workdir = dir
+	r := &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts: &RunOptions{
+			Artifacts: ArtifactsConfig{
+				Files:    []string{"dist/changed.txt"},
+				Discover: []string{"dist", "bin"},
+			},
+		},
+	}
+	ri := defaultRunImplementation{}
+	require.NoError(t, ri.snapshotArtifacts(r))
+
+	// What the build would do: write versioned files, modify others
+	// and touch files outside the discovery directories
+	write("dist/app-1.2.3.tar.gz", "new")
+	write("dist/changed.txt", "v2 of the file")
+	write("bin/linux/app", "binary")
+	write("src/main.go", "package main // changed")
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "dist/changed.txt"), future, future))
+
+	require.NoError(t, ri.discoverArtifacts(r))
+	require.Equal(t, []string{
+		filepath.Join("bin", "linux", "app"),
+		filepath.Join("dist", "app-1.2.3.tar.gz"),
+		filepath.Join("dist", "changed.txt"),
+	}, r.Discovered)
+
+	// Discovered files are added to the artifacts once
+	require.Equal(t, []string{
+		"dist/changed.txt",
+		filepath.Join("bin", "linux", "app"),
+		filepath.Join("dist", "app-1.2.3.tar.gz"),
+	}, r.opts.Artifacts.Files)
+	require.NoError(t, ri.checkExpectedArtifacts(r))
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package build runs builds from a runner or a matterbuild.yaml
+// configuration, producing their artifacts and provenance attestations.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt. Declarations are not removed or changed in
+// incompatible ways, the ones replaced are kept as shims marked
+// Deprecated until the next major version.
+package build
@@ -0,0 +1,112 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors to check the kind of a build failure with errors.Is.
+// The typed errors below carry the details and can be extracted with
+// errors.As.
+var (
+	ErrArtifactMissing        = errors.New("expected artifact not found")
+	ErrMaterialDigestMismatch = errors.New("material digest mismatch")
+	ErrTransferFailed         = errors.New("artifact transfer failed")
+	ErrTestsFailed            = errors.New("tests failed")
+	ErrArtifactLeak           = errors.New("artifact contains a replacement tag or secret")
+)
+
+// ArtifactMissingError is returned when a run does not produce one of
+// its expected artifacts
+type ArtifactMissingError struct {
+	Path string // Path of the artifact, relative to the working directory
+}
+
+func (e *ArtifactMissingError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrArtifactMissing, e.Path)
+}
+
+// Is makes the error match ErrArtifactMissing
+func (e *ArtifactMissingError) Is(target error) bool {
+	return target == ErrArtifactMissing
+}
+
+// ArtifactLeakError is returned when an artifact contains the tag of a
+// replacement or the value of a secret one. The value is never printed.
+type ArtifactLeakError struct {
+	Path   string // Path of the file, relative to the working directory
+	Tag    string // Tag of the replacement found
+	Secret bool   // True if the secret value was found instead of the tag
+}
+
+func (e *ArtifactLeakError) Error() string {
+	if e.Secret {
+		return fmt.Sprintf("%s: %s has the secret value of replacement %s", ErrArtifactLeak, e.Path, e.Tag)
+	}
+	return fmt.Sprintf("%s: %s has the replacement tag %s", ErrArtifactLeak, e.Path, e.Tag)
+}
+
+// Is makes the error match ErrArtifactLeak
+func (e *ArtifactLeakError) Is(target error) bool {
+	return target == ErrArtifactLeak
+}
+
+// MaterialDigestMismatchError is returned when a downloaded material
+// does not match the digest defined in the build configuration
+type MaterialDigestMismatchError struct {
+	URI       string // URI of the material
+	Algorithm string // Hash algorithm that failed to match
+	Expected  string // Digest in the material definition
+	Actual    string // Digest of the downloaded material
+}
+
+func (e *MaterialDigestMismatchError) Error() string {
+	return fmt.Sprintf(
+		"%s: %s %s is %s, expected %s", ErrMaterialDigestMismatch, e.URI, e.Algorithm, e.Actual, e.Expected,
+	)
+}
+
+// Is makes the error match ErrMaterialDigestMismatch
+func (e *MaterialDigestMismatchError) Is(target error) bool {
+	return target == ErrMaterialDigestMismatch
+}
+
+// TransferFailedError is returned when copying an artifact to its
+// destination fails
+type TransferFailedError struct {
+	URL string // Destination URL of the transfer
+	Err error  // Error returned by the object backend
+}
+
+func (e *TransferFailedError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrTransferFailed, e.URL, e.Err)
+}
+
+// Is makes the error match ErrTransferFailed
+func (e *TransferFailedError) Is(target error) bool {
+	return target == ErrTransferFailed
+}
+
+// Unwrap returns the underlying transfer error
+func (e *TransferFailedError) Unwrap() error {
+	return e.Err
+}
+
+// TestsFailedError is returned when the test reports of a run have
+// failures and the run is configured to fail on them
+type TestsFailedError struct {
+	Failed   int      // Number of failed tests
+	Failures []string // Names of the failed tests
+}
+
+func (e *TestsFailedError) Error() string {
+	return fmt.Sprintf("%s: %d tests failed", ErrTestsFailed, e.Failed)
+}
+
+// Is makes the error match ErrTestsFailed
+func (e *TestsFailedError) Is(target error) bool {
+	return target == ErrTestsFailed
+}
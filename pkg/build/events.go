@@ -0,0 +1,183 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventType identifies what happened in a run
+type EventType string
+
+const (
+	EventRunStarted         EventType = "run.started"         // The run started executing
+	EventReplacementApplied EventType = "replacement.applied" // A replacement was applied to the source
+	EventArtifactVerified   EventType = "artifact.verified"   // An expected artifact was found after the build
+	EventTransferDone       EventType = "transfer.done"       // An artifact was copied to its transfer destination
+	EventRunFailed          EventType = "run.failed"          // The run finished with an error
+	EventRunSucceeded       EventType = "run.succeeded"       // The run finished successfully
+)
+
+// Formats of the payloads posted to webhooks
+const (
+	WebhookFormatJSON       = "json"       // The event serialized as JSON
+	WebhookFormatMattermost = "mattermost" // A Mattermost incoming webhook message
+)
+
+const (
+	defaultWebhookTimeout = 10 * time.Second // Time to wait for a webhook to respond
+	webhookUserName       = "matterbuild"    // Name of the poster of Mattermost messages
+)
+
+// Event is something that happened in a run, published to its event bus
+type Event struct {
+	Type    EventType         `json:"type"`
+	Run     string            `json:"run"`            // ID of the run
+	Time    time.Time         `json:"time"`           // When the event happened
+	Message string            `json:"message"`        // Human readable description of the event
+	Data    map[string]string `json:"data,omitempty"` // Details of the event, eg the artifact path
+}
+
+// EventHandler is a function that gets the events published to a bus
+type EventHandler func(Event)
+
+// EventBus delivers the events of runs to its subscribers. Handlers are
+// called in the order they subscribed, from the goroutine executing the
+// run, so they should return quickly.
+type EventBus struct {
+	mu       sync.Mutex
+	next     int
+	handlers map[int]EventHandler
+	order    []int
+}
+
+// NewEventBus returns an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: map[int]EventHandler{}, order: []int{}}
+}
+
+// Subscribe registers a handler to get all the events published to the
+// bus. It returns a function to unsubscribe it.
+func (eb *EventBus) Subscribe(fn EventHandler) (unsubscribe func()) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	id := eb.next
+	eb.next++
+	eb.handlers[id] = fn
+	eb.order = append(eb.order, id)
+	return func() {
+		eb.mu.Lock()
+		defer eb.mu.Unlock()
+		delete(eb.handlers, id)
+		for i, o := range eb.order {
+			if o == id {
+				eb.order = append(eb.order[:i], eb.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Publish sends an event to all the subscribers of the bus
+func (eb *EventBus) Publish(e Event) {
+	eb.mu.Lock()
+	handlers := []EventHandler{}
+	for _, id := range eb.order {
+		handlers = append(handlers, eb.handlers[id])
+	}
+	eb.mu.Unlock()
+	for _, fn := range handlers {
+		fn(e)
+	}
+}
+
+// emit publishes an event of the run to its event bus, if it has one. The
+// secrets in the message and data, eg in error texts, are masked.
+func (r *Run) emit(t EventType, message string, data map[string]string) {
+	if r.runner != nil {
+		message = r.runner.Options().Mask(message)
+		if data != nil {
+			masked := make(map[string]string, len(data))
+			for k, v := range data {
+				masked[k] = r.runner.Options().Mask(v)
+			}
+			data = masked
+		}
+	}
+	r.logEvent(message)
+	if r.opts.Events == nil {
+		return
+	}
+	r.opts.Events.Publish(Event{
+		Type: t, Run: r.ID(), Time: time.Now().UTC(), Message: message, Data: data,
+	})
+}
+
+// Webhook posts the events it handles to a URL
+type Webhook struct {
+	URL    string       // URL the events are posted to
+	Format string       // WebhookFormatJSON or WebhookFormatMattermost. Defaults to JSON
+	Events []EventType  // Events to post. When empty, all of them are posted
+	Client *http.Client // HTTP client to use. Defaults to a client with a 10 second timeout
+}
+
+// NewWebhook returns a webhook posting to url in the specified format
+func NewWebhook(url, format string, events ...EventType) *Webhook {
+	return &Webhook{URL: url, Format: format, Events: events}
+}
+
+// Handle posts the event to the webhook. Errors are logged, a failing
+// webhook does not stop the run.
+func (w *Webhook) Handle(e Event) {
+	if len(w.Events) > 0 {
+		found := false
+		for _, t := range w.Events {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	if err := w.post(e); err != nil {
+		logrus.Warnf("Unable to send %s event to webhook: %v", e.Type, err)
+	}
+}
+
+// post sends the event to the webhook URL
+func (w *Webhook) post(e Event) error {
+	var payload interface{} = e
+	if w.Format == WebhookFormatMattermost {
+		payload = map[string]string{
+			"username": webhookUserName,
+			"text":     fmt.Sprintf("#### %s\n%s", e.Type, e.Message),
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling event: %w", err)
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("posting event: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
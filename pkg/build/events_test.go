@@ -0,0 +1,121 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/replacement"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	got := []string{}
+	bus.Subscribe(func(e Event) { got = append(got, "first:"+string(e.Type)) })
+	unsubscribe := bus.Subscribe(func(e Event) { got = append(got, "second:"+string(e.Type)) })
+
+	// Handlers get the events in the order they subscribed
+	bus.Publish(Event{Type: EventRunStarted})
+	require.Equal(t, []string{"first:run.started", "second:run.started"}, got)
+
+	got = []string{}
+	unsubscribe()
+	bus.Publish(Event{Type: EventRunFailed})
+	require.Equal(t, []string{"first:run.failed"}, got)
+}
+
+func TestWebhook(t *testing.T) {
+	payloads := []map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	// JSON webhooks get the event
+	NewWebhook(server.URL, WebhookFormatJSON).Handle(Event{
+		Type: EventTransferDone, Run: "make-0000", Data: map[string]string{"destination": "s3://bucket/app"},
+	})
+	require.Len(t, payloads, 1)
+	require.Equal(t, "transfer.done", payloads[0]["type"])
+	require.Equal(t, "make-0000", payloads[0]["run"])
+
+	// Mattermost webhooks get a message
+	NewWebhook(server.URL, WebhookFormatMattermost).Handle(Event{Type: EventRunFailed, Message: "Run make-0000 failed"})
+	require.Len(t, payloads, 2)
+	require.Equal(t, "#### run.failed\nRun make-0000 failed", payloads[1]["text"])
+
+	// Events not in the list are not posted
+	NewWebhook(server.URL, WebhookFormatMattermost, EventRunFailed).Handle(Event{Type: EventRunStarted})
+	require.Len(t, payloads, 2)
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		posts++
+	}))
+	defer server.Close()
+
+	conf := filepath.Join(t.TempDir(), "matterbuild.yaml")
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+  params: ["build"]
+notifications:
+  webhooks:
+    - url: `+server.URL+`
+      format: json
+`), os.FileMode(0o644)))
+
+	// Loading the configuration again replaces its webhooks
+	bus := NewEventBus()
+	b := NewWithOptions(nil, &Options{Events: bus})
+	require.NoError(t, b.Load(conf))
+	require.NoError(t, b.Load(conf))
+	bus.Publish(Event{Type: EventRunStarted, Run: "make-0000"})
+	require.Equal(t, 1, posts)
+}
+
+func TestRunEvents(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile":   "build:\n\techo VERSION > app.bin\n",
+		".gitignore": "app.bin\n",
+	})
+
+	runner := runners.NewMake("build")
+	require.NoError(t, runners.Isolate(runner))
+	runner.Options().Workdir = workdir
+	runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+	runner.Options().Replacements = []replacement.Replacement{
+		{Tag: "NOTFOUND", Value: "none", Paths: []string{"Makefile"}, Workdir: workdir},
+	}
+	transfers := t.TempDir()
+	bus := NewEventBus()
+	events := []EventType{}
+	bus.Subscribe(func(e Event) {
+		require.Equal(t, "make-0000", e.Run)
+		events = append(events, e.Type)
+	})
+	r := NewRun(runner)
+	r.opts = &RunOptions{
+		BuildPoint: head, ExistenceCheck: AlwaysBuild, Events: bus,
+		Artifacts: ArtifactsConfig{Files: []string{"app.bin"}},
+		Transfers: []TransferConfig{{Source: []string{"app.bin"}, Destination: "file://" + transfers + "/"}},
+	}
+	require.NoError(t, r.Execute())
+	require.Equal(t, []EventType{
+		EventRunStarted, EventReplacementApplied, EventArtifactVerified, EventTransferDone, EventRunSucceeded,
+	}, events)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/sirupsen/logrus"
+)
+
+// ExistenceChecker decides if the artifacts of a run already exist. When
+// they do, the run finishes without building unless ForceBuild is set.
+type ExistenceChecker interface {
+	ArtifactsExist(*Run) (bool, error)
+}
+
+// objectManager returns the object manager of the run used to check if
+// objects exist. With ExistsCacheTTL set, it caches the results as the
+// checkers may look for the same objects more than once.
+func (r *Run) objectManager() *object.Manager {
+	if r.objects == nil {
+		r.objects = object.NewManagerWithOptions(&object.Options{ExistsCacheTTL: r.opts.ExistsCacheTTL})
+	}
+	return r.objects
+}
+
+// ProvenanceExistenceCheck considers the artifacts exist when the
+// provenance attestation is found in the run staging URL. This is the
+// default strategy.
+type ProvenanceExistenceCheck struct{}
+
+// ArtifactsExist checks for the provenance file in the staging URL
+func (pe *ProvenanceExistenceCheck) ArtifactsExist(r *Run) (bool, error) {
+	dri := &defaultRunImplementation{}
+	stageURL, err := dri.stagingURL(r)
+	if err != nil {
+		return false, fmt.Errorf("getting staging URL: %w", err)
+	}
+	provenanceURL, err := object.JoinURL(stageURL, ProvenanceFilename)
+	if err != nil {
+		return false, fmt.Errorf("building provenance URL: %w", err)
+	}
+	exists, err := r.objectManager().PathExists(provenanceURL)
+	if err != nil {
+		return false, fmt.Errorf("checking if provenance file exists: %w", err)
+	}
+	return exists, nil
+}
+
+// StagingExistenceCheck considers the artifacts exist when every
+// expected artifact is found in the staging path derived from the run
+// materials digests
+type StagingExistenceCheck struct{}
+
+// ArtifactsExist looks for all the expected artifacts in the staging URL
+func (se *StagingExistenceCheck) ArtifactsExist(r *Run) (bool, error) {
+	if len(r.opts.Artifacts.Files) == 0 {
+		return false, nil
+	}
+	dri := &defaultRunImplementation{}
+	stageURL, err := dri.stagingURL(r)
+	if err != nil {
+		return false, fmt.Errorf("getting staging URL: %w", err)
+	}
+	manager := r.objectManager()
+	for _, f := range r.opts.Artifacts.Files {
+		artifactURL, err := object.JoinURL(stageURL, f)
+		if err != nil {
+			return false, fmt.Errorf("building URL of %s: %w", f, err)
+		}
+		exists, err := manager.PathExists(artifactURL)
+		if err != nil {
+			return false, fmt.Errorf("checking if %s exists: %w", f, err)
+		}
+		if !exists {
+			logrus.Infof("Artifact %s not found in staging path", f)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// StaticExistenceCheck always returns the same answer. Use
+// AlwaysBuild to disable the existence check.
+type StaticExistenceCheck struct {
+	Exists bool
+}
+
+// ArtifactsExist returns the static value
+func (se *StaticExistenceCheck) ArtifactsExist(*Run) (bool, error) {
+	return se.Exists, nil
+}
+
+var (
+	// AlwaysBuild never skips the build
+	AlwaysBuild = &StaticExistenceCheck{Exists: false}
+
+	// NeverBuild always considers the artifacts exist
+	NeverBuild = &StaticExistenceCheck{Exists: true}
+)
+
+// HTTPExistenceCheck asks an external service if the artifacts exist. The
+// staging path is replaced in the URL where ${MMBUILD_STAGEPATH} is found.
+// The artifacts exist if the service responds 200 and don't if it
+// responds 404. Any other response is an error.
+type HTTPExistenceCheck struct {
+	URL    string
+	Client *http.Client // HTTP client to use. Defaults to http.DefaultClient
+}
+
+// ArtifactsExist queries the HTTP service
+func (he *HTTPExistenceCheck) ArtifactsExist(r *Run) (bool, error) {
+	dri := &defaultRunImplementation{}
+	stagingPath, err := dri.stagingPath(r)
+	if err != nil {
+		return false, fmt.Errorf("getting staging path: %w", err)
+	}
+	client := he.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	checkURL := strings.ReplaceAll(he.URL, "${MMBUILD_STAGEPATH}", stagingPath)
+	resp, err := client.Get(checkURL) //nolint:gosec // URL is set by the user
+	if err != nil {
+		return false, fmt.Errorf("querying artifact existence service: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("artifact existence service returned HTTP %d", resp.StatusCode)
+	}
+}
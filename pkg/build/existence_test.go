@@ -0,0 +1,111 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistenceChecks(t *testing.T) {
+	dir := t.TempDir()
+	r := &Run{
+		opts: &RunOptions{
+			BuildPoint: "46305d50a15717e2d224e38f2f2bdc9027a7cbc7",
+			Artifacts: ArtifactsConfig{
+				Destination: "file:/" + dir,
+				Files:       []string{"app.tar.gz"},
+			},
+		},
+	}
+	stagingPath, err := (&defaultRunImplementation{}).stagingPath(r)
+	require.NoError(t, err)
+	stagingDir := filepath.Join(dir, stagingPath)
+
+	// Static checks
+	exists, err := AlwaysBuild.ArtifactsExist(r)
+	require.NoError(t, err)
+	require.False(t, exists)
+	exists, err = NeverBuild.ArtifactsExist(r)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Nothing has been staged yet
+	for _, checker := range []ExistenceChecker{&ProvenanceExistenceCheck{}, &StagingExistenceCheck{}} {
+		exists, err := checker.ArtifactsExist(r)
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+
+	// Artifacts without provenance only satisfy the staging check
+	require.NoError(t, os.MkdirAll(stagingDir, os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(stagingDir, "app.tar.gz"), []byte("app"), os.FileMode(0o644)))
+	exists, err = (&StagingExistenceCheck{}).ArtifactsExist(r)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = (&ProvenanceExistenceCheck{}).ArtifactsExist(r)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, os.WriteFile(filepath.Join(stagingDir, ProvenanceFilename), []byte("{}"), os.FileMode(0o644)))
+	exists, err = (&ProvenanceExistenceCheck{}).ArtifactsExist(r)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// The run uses the configured checker
+	r.opts.ExistenceCheck = AlwaysBuild
+	e, err := (&defaultRunImplementation{}).artifactsExist(r)
+	require.NoError(t, err)
+	require.False(t, *e)
+}
+
+func TestHTTPExistenceCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/builds/9241fbc43a90babf28912d4662580f8740e709237c1797a29ea5ee64558c7b9f":
+			w.WriteHeader(http.StatusOK)
+		case "/builds/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	r := &Run{
+		opts: &RunOptions{
+			BuildPoint: "46305d50a15717e2d224e38f2f2bdc9027a7cbc7",
+			Materials: MaterialsConfig{
+				{
+					URI:    "http://example.com/repo/go.mod",
+					Digest: map[string]string{"sha1": "61a7663a7c0f46ab149ec2cadd44fc3cc30f9403"},
+				},
+				{
+					URI:    "http://example.com/repo/go.sum",
+					Digest: map[string]string{"sha1": "ac74142d9394dc40c046eadc99b19c95b6f8d5d3"},
+				},
+				{
+					URI:    "http://example.com/repo/source.go",
+					Digest: map[string]string{"sha512": "efbedc70276435eaf861152cb139dccc91c31c5955385b6797feaf36f3ad7a974b07aec012a135c2105aefcb606fffd50b261efa8be7f993f5c55cf7fba703e9"},
+				},
+			},
+		},
+	}
+
+	exists, err := (&HTTPExistenceCheck{URL: server.URL + "/builds/${MMBUILD_STAGEPATH}"}).ArtifactsExist(r)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = (&HTTPExistenceCheck{URL: server.URL + "/other/${MMBUILD_STAGEPATH}"}).ArtifactsExist(r)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = (&HTTPExistenceCheck{URL: server.URL + "/builds/error"}).ArtifactsExist(r)
+	require.Error(t, err)
+}
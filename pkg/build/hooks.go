@@ -0,0 +1,67 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/sirupsen/logrus"
+)
+
+// hookCommand returns a phase function that runs a shell command in the
+// working directory of the runner. The command gets the runner
+// environment plus the run ID and build point.
+func hookCommand(hook, cmdLine string) PhaseFunc {
+	return func(r *Run) error {
+		logrus.Infof("Running %s hook: %s", hook, r.runner.Options().Mask(cmdLine))
+		cmd := exec.CommandContext(r.context(), "sh", "-c", cmdLine) //nolint:gosec // Hooks run commands from the build config
+		cmd.Dir = r.runner.Options().Workdir
+		cmd.Env = os.Environ()
+		for v, val := range r.runner.Options().EnvVars {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", v, val))
+		}
+		cmd.Env = append(cmd.Env,
+			"MMBUILD_RUN_ID="+r.ID(),
+			"MMBUILD_BUILD_POINT="+r.opts.BuildPoint,
+		)
+		// Hooks get the secrets in the environment, mask them in the output
+		values, patterns := r.runner.Options().SensitiveValues(), r.runner.Options().SensitivePatterns()
+		stdout := runners.NewPatternMaskWriter(os.Stdout, values, patterns...)
+		stderr := runners.NewPatternMaskWriter(os.Stderr, values, patterns...)
+		defer stdout.Close()
+		defer stderr.Close()
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running %s hook %q: %w", hook, r.runner.Options().Mask(cmdLine), err)
+		}
+		return nil
+	}
+}
+
+// registerConfigHooks adds the commands of the hooks configured in the
+// run options to the phases where they run, after any Go callbacks
+// already registered there:
+//
+//	preMaterials: before the materials phase
+//	preRun:       before the build phase
+//	postRun:      after the build phase
+//	postTransfer: after the transfers phase
+func (r *Run) registerConfigHooks() {
+	for _, c := range r.opts.Hooks.PreMaterials {
+		r.Before(PhaseMaterials, hookCommand("preMaterials", c))
+	}
+	for _, c := range r.opts.Hooks.PreRun {
+		r.Before(PhaseBuild, hookCommand("preRun", c))
+	}
+	for _, c := range r.opts.Hooks.PostRun {
+		r.After(PhaseBuild, hookCommand("postRun", c))
+	}
+	for _, c := range r.opts.Hooks.PostTransfer {
+		r.After(PhaseTransfers, hookCommand("postTransfer", c))
+	}
+}
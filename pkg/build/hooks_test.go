@@ -0,0 +1,75 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHooks(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	// Hooks and build write outside the repository to keep it clean
+	logFile := filepath.Join(t.TempDir(), "hooks.log")
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile": "build:\n\techo build >> " + logFile + "\n",
+	})
+
+	newRun := func(hooks HooksConfig) *Run {
+		runner := runners.NewMake("build")
+		require.NoError(t, runners.Isolate(runner))
+		runner.Options().Workdir = workdir
+		runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+		r := NewRun(runner)
+		r.opts = &RunOptions{BuildPoint: head, ExistenceCheck: AlwaysBuild, Hooks: hooks}
+		return r
+	}
+
+	// Hooks run in their phases with the run data in the environment
+	r := newRun(HooksConfig{
+		PreMaterials: []string{"echo materials >> " + logFile},
+		PreRun:       []string{"echo pre $MMBUILD_RUN_ID >> " + logFile},
+		PostRun:      []string{"echo post >> " + logFile},
+		PostTransfer: []string{"echo transfer >> " + logFile},
+	})
+	callbacks := 0
+	r.After(PhaseBuild, func(*Run) error {
+		callbacks++
+		return nil
+	})
+	require.NoError(t, r.Execute())
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	require.Equal(t, "materials\npre make-0000\nbuild\npost\ntransfer\n", string(data))
+	require.Equal(t, 1, callbacks)
+
+	// A failing hook fails the run
+	r = newRun(HooksConfig{PreRun: []string{"exit 1"}})
+	require.Error(t, r.Execute())
+	require.Equal(t, 0, r.Attempts)
+
+	// The secrets of the failed command are masked in the error and events
+	r = newRun(HooksConfig{PreRun: []string{"test s3cr3t = other"}})
+	r.runner.Options().MaskedValues = []string{"s3cr3t"}
+	r.opts.Events = NewEventBus()
+	failed := Event{}
+	r.opts.Events.Subscribe(func(e Event) {
+		if e.Type == EventRunFailed {
+			failed = e
+		}
+	})
+	err = r.Execute()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "s3cr3t")
+	require.Contains(t, err.Error(), runners.Masked)
+	require.Equal(t, EventRunFailed, failed.Type)
+	require.NotContains(t, failed.Message+fmt.Sprint(failed.Data), "s3cr3t")
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of the directives that pull other configuration files in
+const (
+	configExtendsKey = "extends"
+	configIncludeKey = "include"
+)
+
+// ErrConfigCycle is returned when configuration files extend or include
+// each other
+var ErrConfigCycle = errors.New("configuration include cycle")
+
+// keyedLists are the top level lists merged item by item when a file
+// overrides a file it extends or includes. Items are matched by the value
+// of the key, the rest of the lists are replaced.
+var keyedLists = map[string]string{
+	"env":          "var",
+	"secrets":      "name",
+	"replacements": "tag",
+	"materials":    "uri",
+}
+
+// ResolveConfigFile returns the YAML of a configuration file with the files
+// it extends and includes merged in. JSON and CUE files are converted. It is what LoadConfig parses, before
+// replacing the configuration variables, useful to debug inheritance.
+// Files without the directives are returned as they are.
+func ResolveConfigFile(path string) ([]byte, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil || len(doc.Content) == 0 ||
+		(mappingIndex(doc.Content[0], configExtendsKey) < 0 && mappingIndex(doc.Content[0], configIncludeKey) < 0) {
+		// Parsing errors are reported when loading the configuration
+		return data, nil
+	}
+
+	node, err := resolveConfigNode(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err = yaml.Marshal(node)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling resolved configuration: %w", err)
+	}
+	return data, nil
+}
+
+// resolveConfigNode reads a configuration file and merges it over the
+// file it extends and the files it includes, in order. Their paths are
+// relative to the file. stack has the files being resolved, to detect
+// cycles.
+func resolveConfigNode(path string, stack []string) (*yaml.Node, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving configuration path: %w", err)
+	}
+	for _, p := range stack {
+		if p == absPath {
+			return nil, fmt.Errorf("%s: %w", strings.Join(append(stack, absPath), " -> "), ErrConfigCycle)
+		}
+	}
+	stack = append(stack, absPath)
+
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		node = doc.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a map of settings", path)
+	}
+
+	parents, err := configParents(node, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(parents) == 0 {
+		return node, nil
+	}
+	resolved := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, parent := range parents {
+		parentNode, err := resolveConfigNode(parent, stack)
+		if err != nil {
+			return nil, err
+		}
+		mergeConfigNodes(resolved, parentNode, true)
+	}
+	mergeConfigNodes(resolved, node, true)
+	return resolved, nil
+}
+
+// configParents removes the extends and include directives from a file
+// node and returns the paths of the files they refer to, in merge order
+func configParents(node *yaml.Node, path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	parents := []string{}
+	content := []*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case configExtendsKey:
+			if value.Kind != yaml.ScalarNode || value.Value == "" {
+				return nil, fmt.Errorf("%s: line %d: extends must be the path of a file", path, value.Line)
+			}
+			// The extended file goes first, before any includes
+			parents = append([]string{filepath.Join(dir, value.Value)}, parents...)
+		case configIncludeKey:
+			if value.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("%s: line %d: include must be a list of files", path, value.Line)
+			}
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode || item.Value == "" {
+					return nil, fmt.Errorf("%s: line %d: include must be a list of files", path, item.Line)
+				}
+				parents = append(parents, filepath.Join(dir, item.Value))
+			}
+		default:
+			content = append(content, key, value)
+		}
+	}
+	node.Content = content
+	return parents, nil
+}
+
+// mergeConfigNodes merges src over dst. Maps are merged key by key, the
+// keyed lists of the top level item by item and any other value in src
+// replaces the one in dst.
+func mergeConfigNodes(dst, src *yaml.Node, top bool) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		j := mappingIndex(dst, key.Value)
+		if j < 0 {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+		current := dst.Content[j+1]
+		switch {
+		case current.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeConfigNodes(current, value, false)
+		case top && keyedLists[key.Value] != "" &&
+			current.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			mergeKeyedList(current, value, keyedLists[key.Value])
+		default:
+			dst.Content[j+1] = value
+		}
+	}
+}
+
+// mergeKeyedList merges the items of src into dst. Items with the same
+// key replace the ones in dst, in their position, new ones are appended.
+func mergeKeyedList(dst, src *yaml.Node, itemKey string) {
+	for _, item := range src.Content {
+		id := mappingValue(item, itemKey)
+		replaced := false
+		if id != "" {
+			for k, existing := range dst.Content {
+				if mappingValue(existing, itemKey) == id {
+					dst.Content[k] = item
+					replaced = true
+					break
+				}
+			}
+		}
+		if !replaced {
+			dst.Content = append(dst.Content, item)
+		}
+	}
+}
+
+// mappingIndex returns the index of a key in a mapping node, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns the scalar value of a key in a mapping node
+func mappingValue(node *yaml.Node, key string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	if i := mappingIndex(node, key); i >= 0 && node.Content[i+1].Kind == yaml.ScalarNode {
+		return node.Content[i+1].Value
+	}
+	return ""
+}
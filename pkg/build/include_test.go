@@ -0,0 +1,101 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigInheritance(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) string {
+		full := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(full, []byte(content), os.FileMode(0o644)))
+		return full
+	}
+	write("shared/base.yaml", `runner:
+  id: make
+  params: ["build"]
+env:
+  - var: GOOS
+    value: linux
+  - var: BUCKET
+    value: mattermost-releases
+secrets:
+  - name: SIGNING_KEY
+transfers:
+  - source: ["dist/app.tar.gz"]
+    destination: s3://${BUCKET}/base/
+`)
+	write("shared/notifications.yaml", `notifications:
+  webhooks:
+    - url: https://chat.example.com/hooks/abc
+      format: mattermost
+`)
+	conf := write("project/matterbuild.yaml", `extends: ../shared/base.yaml
+include: ["../shared/notifications.yaml"]
+runner:
+  params: ["package"]
+env:
+  - var: GOOS
+    value: darwin
+  - var: PROJECT
+    value: webapp
+transfers:
+  - source: ["dist/webapp.tar.gz"]
+    destination: s3://${BUCKET}/webapp/
+`)
+
+	c, err := LoadConfig(conf)
+	require.NoError(t, err)
+	// Maps are merged, values in the file override the base ones
+	require.Equal(t, "make", c.Runner.ID)
+	require.Equal(t, []string{"package"}, c.Runner.Parameters)
+	// Env vars are merged by name
+	require.Len(t, c.Env, 3)
+	require.Equal(t, "GOOS", c.Env[0].Var)
+	require.Equal(t, "darwin", c.Env[0].Value)
+	require.Equal(t, "BUCKET", c.Env[1].Var)
+	require.Equal(t, "PROJECT", c.Env[2].Var)
+	require.Len(t, c.Secrets, 1)
+	// Other lists are replaced, and variables defined in the base apply
+	require.Len(t, c.Transfers, 1)
+	require.Equal(t, "s3://mattermost-releases/webapp/", c.Transfers[0].Destination)
+	// Included settings are there
+	require.Len(t, c.Notifications.Webhooks, 1)
+
+	// The resolved configuration can be dumped
+	data, err := ResolveConfigFile(conf)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "extends")
+	require.Contains(t, string(data), "mattermost-releases")
+
+	// Files without directives are returned as they are
+	base, err := ResolveConfigFile(filepath.Join(dir, "shared", "base.yaml"))
+	require.NoError(t, err)
+	original, err := os.ReadFile(filepath.Join(dir, "shared", "base.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, original, base)
+
+	// Cycles are detected
+	write("cycle/a.yaml", "extends: b.yaml\nrunner:\n  id: make\n")
+	write("cycle/b.yaml", "include: [a.yaml]\n")
+	_, err = LoadConfig(filepath.Join(dir, "cycle", "a.yaml"))
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrConfigCycle))
+
+	// But files can be included twice through different paths
+	write("diamond/common.yaml", "sbom: true\n")
+	write("diamond/left.yaml", "extends: common.yaml\n")
+	write("diamond/right.yaml", "extends: common.yaml\n")
+	c, err = LoadConfig(write("diamond/matterbuild.yaml", "include: [left.yaml, right.yaml]\nrunner:\n  id: make\n"))
+	require.NoError(t, err)
+	require.True(t, c.SBOM)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// leakScanBufferSize is the size of the chunks read when scanning artifacts
+const leakScanBufferSize = 1 << 20
+
+// leakPattern is a string that must not be found in the artifacts
+type leakPattern struct {
+	tag    string // Tag of the replacement the pattern comes from
+	secret bool   // True if the pattern is the secret value of the replacement
+	data   []byte
+}
+
+// checkLeaks scans the expected artifacts for the tags of the run
+// replacements, left behind when a replacement did not apply, and for the
+// values of the secret ones.
+func (dri *defaultRunImplementation) checkLeaks(r *Run) error {
+	if !r.opts.Artifacts.CheckLeaks {
+		return nil
+	}
+	patterns := []leakPattern{}
+	for _, rep := range r.runner.Options().Replacements {
+		if rep.Tag != "" {
+			patterns = append(patterns, leakPattern{tag: rep.Tag, data: []byte(rep.Tag)})
+		}
+		if rep.Secret && rep.Value != "" {
+			patterns = append(patterns, leakPattern{tag: rep.Tag, secret: true, data: []byte(rep.Value)})
+		}
+	}
+	if len(patterns) == 0 {
+		logrus.Info("Run has no replacements, not scanning artifacts for leaks")
+		return nil
+	}
+
+	for _, artifact := range r.opts.Artifacts.Files {
+		root := filepath.Join(r.runner.Options().Workdir, artifact)
+		if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			p, err := scanFile(path, patterns)
+			if err != nil {
+				return fmt.Errorf("scanning %s: %w", path, err)
+			}
+			if p != nil {
+				rel, err := filepath.Rel(r.runner.Options().Workdir, path)
+				if err != nil {
+					rel = path
+				}
+				return &ArtifactLeakError{Path: rel, Tag: p.tag, Secret: p.secret}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("No replacement tags or secrets found in %d artifacts", len(r.opts.Artifacts.Files))
+	return nil
+}
+
+// scanFile returns the first pattern found in the file at path, or nil.
+// The file is read in chunks which overlap by the length of the longest
+// pattern, so matches across chunks are found too.
+func scanFile(path string, patterns []leakPattern) (*leakPattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	overlap := 0
+	for _, p := range patterns {
+		if len(p.data) > overlap {
+			overlap = len(p.data)
+		}
+	}
+	overlap--
+
+	reader := bufio.NewReaderSize(f, leakScanBufferSize)
+	buf := make([]byte, 0, leakScanBufferSize+overlap)
+	chunk := make([]byte, leakScanBufferSize)
+	for {
+		n, err := reader.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		for i := range patterns {
+			if bytes.Contains(buf, patterns[i].data) {
+				return &patterns[i], nil
+			}
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+		if len(buf) > overlap {
+			buf = append(buf[:0], buf[len(buf)-overlap:]...)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/replacement"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLeaks(t *testing.T) {
+	dir := t.TempDir()
+	runner := runners.NewMake("build")
+	runner.Options().Workdir = dir
+	runner.Options().Replacements = []replacement.Replacement{
+		{Tag: "%VERSION%", Value: "7.1.0"},
+		{Tag: "%TOKEN%", Value: "s3cr3t-t0k3n", Secret: true},
+	}
+	r := &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts:   &RunOptions{Artifacts: ArtifactsConfig{Files: []string{"app.bin", "docs"}, CheckLeaks: true}},
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), os.FileMode(0o755)))
+	write := func(path, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), os.FileMode(0o644)))
+	}
+
+	// Replaced artifacts are clean
+	write("app.bin", "version 7.1.0\n")
+	write("docs/README", "Version 7.1.0\n")
+	require.NoError(t, r.impl.checkLeaks(r))
+
+	// Tags that were not replaced are found in directories too
+	write("docs/README", "Version %VERSION%\n")
+	err := r.impl.checkLeaks(r)
+	var leakErr *ArtifactLeakError
+	require.True(t, errors.As(err, &leakErr))
+	require.Equal(t, filepath.Join("docs", "README"), leakErr.Path)
+	require.Equal(t, "%VERSION%", leakErr.Tag)
+	require.False(t, leakErr.Secret)
+	write("docs/README", "Version 7.1.0\n")
+
+	// Secret values are found across read chunks, and never printed
+	write("app.bin", strings.Repeat("x", leakScanBufferSize-4)+"s3cr3t-t0k3n")
+	err = r.impl.checkLeaks(r)
+	require.True(t, errors.Is(err, ErrArtifactLeak))
+	require.True(t, errors.As(err, &leakErr))
+	require.True(t, leakErr.Secret)
+	require.NotContains(t, err.Error(), "s3cr3t")
+
+	// The check is disabled by default
+	r.opts.Artifacts.CheckLeaks = false
+	require.NoError(t, r.impl.checkLeaks(r))
+}
+
+func TestScanFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	patterns := []leakPattern{{tag: "Z", data: []byte("Z")}, {tag: "TAG", data: []byte("TAG")}}
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("x"), 3*leakScanBufferSize), os.FileMode(0o644)))
+	p, err := scanFile(path, patterns)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	require.NoError(t, os.WriteFile(path, append(bytes.Repeat([]byte("x"), 2*leakScanBufferSize-1), []byte("TAG")...), os.FileMode(0o644)))
+	p, err = scanFile(path, patterns)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	require.Equal(t, "TAG", p.tag)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Formats of the log lines of the SDK
+const (
+	LogFormatText = "text" // Human readable lines, the logrus default
+	LogFormatJSON = "json" // One JSON object per line, with the fields of the message
+)
+
+// Fields added to the log lines of runs. In JSON mode they are keys of
+// the log objects, so aggregators can index them without parsing.
+const (
+	LogFieldRun      = "run"      // ID of the run
+	LogFieldPhase    = "phase"    // Phase of the run, eg build
+	LogFieldArtifact = "artifact" // Path of the artifact the line is about
+	LogFieldDuration = "duration" // Seconds a phase took to finish
+)
+
+// SetLogFormat switches the format of all the log lines of the SDK. The
+// SDK logs through the standard logrus logger, so the format applies to
+// the whole process.
+func SetLogFormat(format string) error {
+	switch format {
+	case LogFormatText, "":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case LogFormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	default:
+		return fmt.Errorf("unknown log format %q, must be %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
+// SetLogFormat switches the format of the SDK log lines to the one of the
+// loaded configuration. Loading a configuration never changes the format,
+// the process logger is only touched when the caller asks for it.
+func (b *Build) SetLogFormat() error {
+	if b.Options().Log.Format == "" {
+		return nil
+	}
+	return SetLogFormat(b.Options().Log.Format)
+}
+
+// logger returns a log entry with the ID of the run. Its lines mask the
+// sensitive values of the run and the ones registered with RedactLogs.
+func (r *Run) logger() *logrus.Entry {
+	if r.runner == nil {
+		return logrus.NewEntry(redactor.with(nil, nil).logger())
+	}
+	opts := r.runner.Options()
+	lr := redactor.with(opts.SensitiveValues(), opts.SensitivePatterns())
+	return lr.logger().WithField(LogFieldRun, r.ID())
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLogFormat(t *testing.T) {
+	logger := logrus.StandardLogger()
+	formatter, out, level := logger.Formatter, logger.Out, logger.Level
+	defer func() {
+		logger.SetFormatter(formatter)
+		logger.SetOutput(out)
+		logger.SetLevel(level)
+	}()
+	buf := &bytes.Buffer{}
+	logger.SetOutput(buf)
+	logger.SetLevel(logrus.InfoLevel)
+
+	require.Error(t, SetLogFormat("xml"))
+	require.NoError(t, SetLogFormat(LogFormatJSON))
+
+	r := &Run{opts: &RunOptions{}, runner: runners.NewMake()}
+	require.NoError(t, r.runPhase(PhaseVerify, func(r *Run) error {
+		r.logger().WithField(LogFieldArtifact, "bin/server").Info("Artifact stored")
+		return nil
+	}))
+	require.Error(t, r.runPhase(PhaseStore, func(*Run) error { return errors.New("store is down") }))
+
+	// Every line is a JSON object with the fields of the run
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+		require.Equal(t, r.ID(), line[LogFieldRun])
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 3)
+	require.Equal(t, "bin/server", lines[0][LogFieldArtifact])
+	require.Equal(t, "Phase verify finished", lines[1]["msg"])
+	require.Equal(t, string(PhaseVerify), lines[1][LogFieldPhase])
+	require.IsType(t, float64(0), lines[1][LogFieldDuration])
+	require.Equal(t, "Phase store failed", lines[2]["msg"])
+	require.Equal(t, string(PhaseStore), lines[2][LogFieldPhase])
+
+	// Back to text lines
+	buf.Reset()
+	require.NoError(t, SetLogFormat(LogFormatText))
+	r.logger().Info("Plain line")
+	require.Contains(t, buf.String(), `msg="Plain line"`)
+	require.Contains(t, buf.String(), "run="+r.ID())
+}
+
+func TestBuildSetLogFormat(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runners.DefaultOptions.EnvVars = map[string]string{}
+	logger := logrus.StandardLogger()
+	formatter := logger.Formatter
+	defer logger.SetFormatter(formatter)
+	logger.SetFormatter(&logrus.TextFormatter{})
+
+	conf := filepath.Join(t.TempDir(), "matterbuild.yaml")
+	require.NoError(t, os.WriteFile(conf, []byte(
+		"runner:\n  id: make\n  params: [\"package\"]\nlog:\n  format: json\n",
+	), os.FileMode(0o644)))
+	b, err := NewFromConfigFile(conf)
+	require.NoError(t, err)
+
+	// Loading the configuration does not touch the process logger
+	require.IsType(t, &logrus.TextFormatter{}, logger.Formatter)
+	require.NoError(t, b.SetLogFormat())
+	require.IsType(t, &logrus.JSONFormatter{}, logger.Formatter)
+
+	// Unknown formats are rejected when loading
+	require.NoError(t, os.WriteFile(conf, []byte(
+		"runner:\n  id: make\nlog:\n  format: xml\n",
+	), os.FileMode(0o644)))
+	_, err = NewFromConfigFile(conf)
+	require.Error(t, err)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MaterialsManifestFilename is the file in the materials directory listing
+// where each material was downloaded
+const MaterialsManifestFilename = "materials.json"
+
+// materialDirLength is the number of hex digits naming material directories
+const materialDirLength = 16
+
+// materialDir returns the directory a material is downloaded into,
+// relative to the materials directory. It is derived from the SHA256 of
+// the material URI, so materials named alike do not collide and each one
+// is always at the same depth.
+func materialDir(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return hex.EncodeToString(sum[:])[:materialDirLength]
+}
+
+// writeMaterialsManifest writes the paths of the materials, keyed by URI,
+// to the manifest file in the materials directory
+func writeMaterialsManifest(dir string, paths map[string]string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(paths, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling materials manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, MaterialsManifestFilename), data, os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing materials manifest: %w", err)
+	}
+	return nil
+}
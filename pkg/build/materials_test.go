@@ -0,0 +1,107 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterialDir(t *testing.T) {
+	// Materials with the same name from different sources do not collide
+	a := materialDir("https://example.com/server/7.1/mattermost.tar.gz")
+	b := materialDir("https://example.com/server/7.2/mattermost.tar.gz")
+	require.NotEqual(t, a, b)
+	require.Len(t, a, materialDirLength)
+	require.Equal(t, a, materialDir("https://example.com/server/7.1/mattermost.tar.gz"))
+}
+
+func TestDownloadMaterialLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.tar.gz" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 2048))) //nolint:errcheck
+	}))
+	defer server.Close()
+	runner := runners.NewMake("build")
+	newRun := func(uri string, limit MaterialLimit) *Run {
+		return &Run{
+			impl: &defaultRunImplementation{}, runner: runner,
+			opts: &RunOptions{
+				Materials: MaterialsConfig{{URI: uri}}, MaterialLimits: MaterialLimits{uri: limit},
+				MaterialsDir: t.TempDir(),
+			},
+		}
+	}
+
+	// Materials within their size limit are downloaded
+	r := newRun(server.URL+"/deps.tar.gz", MaterialLimit{MaxSize: ByteSize(2048)})
+	require.NoError(t, r.impl.downloadMaterials(r))
+
+	// Larger ones fail the run, without leaving a partial file
+	r = newRun(server.URL+"/deps.tar.gz", MaterialLimit{MaxSize: ByteSize(1024)})
+	err := r.impl.downloadMaterials(r)
+	require.True(t, errors.Is(err, backends.ErrTooLarge))
+	require.Contains(t, err.Error(), "1KiB limit")
+	require.NoFileExists(t, filepath.Join(r.opts.MaterialsDir, materialDir(server.URL+"/deps.tar.gz"), "deps.tar.gz"))
+
+	// And so do slow downloads
+	start := time.Now()
+	r = newRun(server.URL+"/slow.tar.gz", MaterialLimit{Timeout: Duration(100 * time.Millisecond)})
+	err = r.impl.downloadMaterials(r)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out after 100ms")
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// Git clones cannot be limited, the limits are not ignored silently
+	r = newRun("git+https://github.com/mattermost/cicd-sdk.git", MaterialLimit{MaxSize: ByteSize(1024)})
+	err = r.impl.downloadMaterials(r)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not supported by git materials")
+}
+
+func TestMaterialLimitsConfig(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+materials:
+  - uri: https://example.com/deps.tar.gz
+    timeout: 5m
+    maxSize: 2GB
+  - uri: https://example.com/docs.tar.gz
+`), os.FileMode(0o644)))
+	b, err := NewFromConfigFile(conf)
+	require.NoError(t, err)
+	expected := MaterialLimits{
+		"https://example.com/deps.tar.gz": {Timeout: Duration(5 * time.Minute), MaxSize: ByteSize(2_000_000_000)},
+	}
+	require.Equal(t, expected, b.Options().MaterialLimits)
+	require.Equal(t, expected, b.runOptions().MaterialLimits)
+
+	// Git clones and archives cannot be limited
+	for _, uri := range []string{"git+https://github.com/mattermost/cicd-sdk.git", "gitarchive+https://github.com/mattermost/cicd-sdk.git"} {
+		require.NoError(t, os.WriteFile(conf, []byte("runner:\n  id: make\nmaterials:\n  - uri: "+uri+"\n    timeout: 5m\n"), os.FileMode(0o644)))
+		c, err := LoadConfig(conf)
+		require.NoError(t, err)
+		err = c.Validate()
+		require.Error(t, err, uri)
+		require.Contains(t, err.Error(), "are not supported by")
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	v02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/util"
+)
+
+// ParallelBuildType is the build type of the provenance statement that
+// aggregates the runs of a parallel build
+const ParallelBuildType = "parallel"
+
+// ParallelRun defines one of the runs executed by RunParallel
+type ParallelRun struct {
+	Runner  runners.Runner // Runner to execute
+	Options *RunOptions    // Options of the run. If nil, they are taken from the build options
+}
+
+// ParallelResult holds the outcome of the runs of a parallel build, in
+// the same order as they were defined
+type ParallelResult struct {
+	Runs       []*Run
+	Errors     []error                     // Error of each run, nil if it succeeded
+	Provenance *intoto.ProvenanceStatement // Provenance aggregating the successful runs, nil if none succeeded
+	Duration   time.Duration               // Wall clock time of the whole build
+}
+
+// Successful returns true if all the runs succeeded
+func (pr *ParallelResult) Successful() bool {
+	return pr.Err() == nil
+}
+
+// Err returns the error of the first failed run, or nil if all of them
+// succeeded
+func (pr *ParallelResult) Err() error {
+	failed := 0
+	var first error
+	var firstID string
+	for i, err := range pr.Errors {
+		if err == nil {
+			continue
+		}
+		if first == nil {
+			first = err
+			firstID = pr.Runs[i].ID()
+		}
+		failed++
+	}
+	if first == nil {
+		return nil
+	}
+	return &ParallelRunError{RunID: firstID, Err: first, Failed: failed}
+}
+
+// ParallelRunError is returned by ParallelResult.Err() when runs failed
+type ParallelRunError struct {
+	RunID  string // ID of the first run that failed
+	Err    error  // Error of the first failed run
+	Failed int    // Number of runs that failed
+}
+
+func (e *ParallelRunError) Error() string {
+	return fmt.Sprintf("%d parallel runs failed, run %s: %v", e.Failed, e.RunID, e.Err)
+}
+
+// Unwrap returns the error of the first failed run
+func (e *ParallelRunError) Unwrap() error {
+	return e.Err
+}
+
+// RunParallel executes several runs at the same time. Each run gets an
+// isolated copy of the working directory so the runners do not step on
+// each other. When the runs finish, the artifacts of the successful ones
+// are copied back to the working directory and their provenance is
+// aggregated into a single statement.
+//
+// The returned error is only set when the runs could not be started,
+// check the result Err() to find out if any of them failed.
+func (b *Build) RunParallel(specs ...ParallelRun) (*ParallelResult, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no runs to execute in parallel")
+	}
+	start := time.Now()
+	workdir, err := filepath.Abs(b.Options().Workdir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving working directory: %w", err)
+	}
+
+	// The copies of the workdir are removed when done, the
+	// artifacts have been copied back by then
+	dirs := make([]string, len(specs))
+	defer func() {
+		for _, dir := range dirs {
+			if dir == "" {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				logrus.Warnf("Unable to remove run working directory %s: %v", dir, err)
+			}
+		}
+	}()
+
+	runs := make([]*Run, len(specs))
+	for i, spec := range specs {
+		if spec.Runner == nil {
+			return nil, fmt.Errorf("parallel run #%d has no runner", i)
+		}
+		// Runners created from the catalog share their options
+		if err := runners.Isolate(spec.Runner); err != nil {
+			return nil, fmt.Errorf("isolating runner of parallel run #%d: %w", i, err)
+		}
+
+		dir, err := os.MkdirTemp("", "mmbuild-parallel-")
+		if err != nil {
+			return nil, fmt.Errorf("creating run working directory: %w", err)
+		}
+		dirs[i] = dir
+		if err := copyTree(workdir, dir); err != nil {
+			return nil, fmt.Errorf("copying working directory for parallel run #%d: %w", i, err)
+		}
+		b.configureRunner(spec.Runner, dir)
+
+		opts := b.runOptions()
+		if spec.Options != nil {
+			o := *spec.Options
+			opts = &o
+		}
+		// Runs add the files and images reported by their runner
+		opts.Artifacts.Files = append([]string(nil), opts.Artifacts.Files...)
+		opts.Artifacts.Images = append([]string(nil), opts.Artifacts.Images...)
+
+		run := NewRun(spec.Runner)
+		run.opts = opts
+		run.id = len(b.Runs)
+		b.Runs = append(b.Runs, run)
+		runs[i] = run
+	}
+
+	result := &ParallelResult{Runs: runs, Errors: make([]error, len(runs))}
+	logrus.Infof("Executing %d runs in parallel", len(runs))
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result.Errors[i] = runs[i].Execute()
+		}(i)
+	}
+	wg.Wait()
+
+	// Collect the provenance and artifacts of the successful runs
+	statements := []*intoto.ProvenanceStatement{}
+	producers := map[string]string{}
+	for i, run := range runs {
+		if result.Errors[i] != nil {
+			logrus.Errorf("Parallel run %s failed: %v", run.ID(), result.Errors[i])
+			continue
+		}
+		statement, err := run.Provenance()
+		if err != nil {
+			result.Errors[i] = fmt.Errorf("generating run provenance: %w", err)
+			continue
+		}
+		if err := collectParallelArtifacts(run, dirs[i], workdir, producers); err != nil {
+			result.Errors[i] = err
+			continue
+		}
+		if err := collectParallelDotEnv(run, workdir); err != nil {
+			result.Errors[i] = err
+			continue
+		}
+		statements = append(statements, statement)
+	}
+
+	// From now on, the runs refer to the build working directory
+	for _, run := range runs {
+		b.configureRunner(run.runner, workdir)
+	}
+
+	result.Provenance = aggregateProvenance(ParallelBuildType, statements)
+	result.Duration = time.Since(start)
+	logrus.Infof("Parallel build finished in %s", result.Duration.Round(time.Millisecond))
+	return result, nil
+}
+
+// collectParallelArtifacts copies the artifacts of a run from its working
+// directory to the build workdir. producers records the run that produced
+// each artifact, two runs cannot produce the same one. Absolute paths in
+// the run directory, like the SBOM, are changed to point to the workdir.
+func collectParallelArtifacts(run *Run, runDir, workdir string, producers map[string]string) error {
+	// Runs skipped because their artifacts already exist have no files
+	// in their working directory
+	produced := run.Attempts > 0 || run.Cache == CacheHit
+	for i, path := range run.opts.Artifacts.Files {
+		if filepath.IsAbs(path) {
+			rel, err := filepath.Rel(runDir, path)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				// Artifacts outside of the run directory are not removed
+				continue
+			}
+			run.opts.Artifacts.Files[i] = filepath.Join(workdir, rel)
+			path = rel
+		}
+		if producer, ok := producers[path]; ok {
+			return fmt.Errorf("artifact %s was also produced by run %s", path, producer)
+		}
+		producers[path] = run.ID()
+		if !produced {
+			continue
+		}
+		src := filepath.Join(runDir, path)
+		if !util.Exists(src) {
+			return fmt.Errorf("collecting artifacts of run %s: %w", run.ID(), &ArtifactMissingError{Path: path})
+		}
+		if err := copyTree(src, filepath.Join(workdir, path)); err != nil {
+			return fmt.Errorf("copying artifact %s to the working directory: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// collectParallelDotEnv copies the dotenv file of a run to the build
+// workdir. All runs write the same file name, so each copy is named
+// after the run that wrote it.
+func collectParallelDotEnv(run *Run, workdir string) error {
+	if run.DotEnvPath == "" || !util.Exists(run.DotEnvPath) {
+		return nil
+	}
+	data, err := os.ReadFile(run.DotEnvPath)
+	if err != nil {
+		return fmt.Errorf("reading dotenv file of run %s: %w", run.ID(), err)
+	}
+	path := filepath.Join(workdir, fmt.Sprintf("%s-%s.env", strings.TrimSuffix(DotEnvFilename, ".env"), run.ID()))
+	if err := os.WriteFile(path, data, os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("copying dotenv file of run %s: %w", run.ID(), err)
+	}
+	run.DotEnvPath = path
+	return nil
+}
+
+// aggregateProvenance combines the provenance statements of several runs
+// into one of buildType. Subjects and materials are only recorded once.
+func aggregateProvenance(buildType string, statements []*intoto.ProvenanceStatement) *intoto.ProvenanceStatement {
+	if len(statements) == 0 {
+		return nil
+	}
+	aggregated := &intoto.ProvenanceStatement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: v02.PredicateSLSAProvenance,
+			Subject:       []intoto.Subject{},
+		},
+		Predicate: v02.ProvenancePredicate{
+			Builder:   v02.ProvenanceBuilder{ID: BuilderID},
+			BuildType: buildType,
+			Metadata:  &v02.ProvenanceMetadata{},
+			Materials: []v02.ProvenanceMaterial{},
+		},
+	}
+
+	params := []interface{}{}
+	subjects := map[string]bool{}
+	materials := map[string]bool{}
+	for _, s := range statements {
+		// Each run is recorded with its runner and arguments
+		params = append(params, map[string]interface{}{
+			"buildType":  s.Predicate.BuildType,
+			"parameters": s.Predicate.Invocation.Parameters,
+		})
+		for _, sub := range s.Subject {
+			if !subjects[sub.Name] {
+				subjects[sub.Name] = true
+				aggregated.Subject = append(aggregated.Subject, sub)
+			}
+		}
+		for _, m := range s.Predicate.Materials {
+			if !materials[m.URI] {
+				materials[m.URI] = true
+				aggregated.Predicate.Materials = append(aggregated.Predicate.Materials, m)
+			}
+		}
+		if s.Predicate.Invocation.ConfigSource.URI != "" {
+			aggregated.Predicate.Invocation.ConfigSource = s.Predicate.Invocation.ConfigSource
+		}
+		if md := s.Predicate.Metadata; md != nil {
+			if md.BuildStartedOn != nil && (aggregated.Predicate.Metadata.BuildStartedOn == nil ||
+				md.BuildStartedOn.Before(*aggregated.Predicate.Metadata.BuildStartedOn)) {
+				aggregated.Predicate.Metadata.BuildStartedOn = md.BuildStartedOn
+			}
+			if md.BuildFinishedOn != nil && (aggregated.Predicate.Metadata.BuildFinishedOn == nil ||
+				md.BuildFinishedOn.After(*aggregated.Predicate.Metadata.BuildFinishedOn)) {
+				aggregated.Predicate.Metadata.BuildFinishedOn = md.BuildFinishedOn
+			}
+		}
+	}
+	aggregated.Predicate.Invocation.Parameters = params
+	return aggregated
+}
+
+// copyTree copies a file or directory to dst, keeping the file modes
+// and symbolic links
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.FileMode(0o755)); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunParallel(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile": "server:\n\techo server > server.bin\n" +
+			"webapp:\n\techo webapp > webapp.bin\n" +
+			"broken:\n\texit 1\n",
+	})
+	runOpts := func(files ...string) *RunOptions {
+		return &RunOptions{
+			BuildPoint: head, ExistenceCheck: AlwaysBuild,
+			Artifacts: ArtifactsConfig{Files: files},
+		}
+	}
+
+	b := NewWithOptions(nil, &Options{
+		Workdir: workdir, Source: "https://github.com/mattermost/cicd-sdk", EnvVars: map[string]string{},
+	})
+	res, err := b.RunParallel(
+		ParallelRun{
+			Runner:  runners.NewMake("server"),
+			Options: runOpts("server.bin"),
+		},
+		ParallelRun{
+			Runner:  runners.NewMake("webapp"),
+			Options: runOpts("webapp.bin"),
+		},
+	)
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	require.True(t, res.Successful())
+	require.Len(t, b.Runs, 2)
+
+	// The artifacts are copied back to the working directory
+	for _, name := range []string{"server", "webapp"} {
+		data, err := os.ReadFile(filepath.Join(workdir, name+".bin"))
+		require.NoError(t, err)
+		require.Equal(t, name+"\n", string(data))
+	}
+
+	// Each run gets its own dotenv file in the working directory
+	for _, run := range res.Runs {
+		require.Equal(t, filepath.Join(workdir, "build-"+run.ID()+".env"), run.DotEnvPath)
+		require.FileExists(t, run.DotEnvPath)
+	}
+
+	// The runners were isolated from the shared default options
+	require.Equal(t, workdir, res.Runs[0].Runner().Options().Workdir)
+	require.NotSame(t, res.Runs[0].Runner().Options(), res.Runs[1].Runner().Options())
+
+	// The provenance aggregates both runs
+	require.NotNil(t, res.Provenance)
+	require.Equal(t, ParallelBuildType, res.Provenance.Predicate.BuildType)
+	require.Len(t, res.Provenance.Subject, 2)
+	require.Len(t, res.Provenance.Predicate.Invocation.Parameters, 2)
+
+	// A failing run does not stop the others
+	res, err = b.RunParallel(
+		ParallelRun{Runner: runners.NewMake("server"), Options: runOpts()},
+		ParallelRun{Runner: runners.NewMake("broken"), Options: runOpts()},
+	)
+	require.NoError(t, err)
+	require.False(t, res.Successful())
+	require.NoError(t, res.Errors[0])
+	require.Error(t, res.Errors[1])
+	var runErr *ParallelRunError
+	require.True(t, errors.As(res.Err(), &runErr))
+	require.Equal(t, res.Runs[1].ID(), runErr.RunID)
+	require.Equal(t, 1, runErr.Failed)
+
+	// Two runs cannot produce the same artifact
+	res, err = b.RunParallel(
+		ParallelRun{
+			Runner:  runners.NewMake("server"),
+			Options: runOpts("server.bin"),
+		},
+		ParallelRun{
+			Runner:  runners.NewMake("server"),
+			Options: runOpts("server.bin"),
+		},
+	)
+	require.NoError(t, err)
+	require.Error(t, res.Err())
+
+	_, err = b.RunParallel()
+	require.Error(t, err)
+	_, err = b.RunParallel(ParallelRun{})
+	require.Error(t, err)
+}
+
+func TestCollectParallelArtifacts(t *testing.T) {
+	runDir, workdir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, "server.bin"), []byte("server"), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, SBOMFileName), []byte("sbom"), os.FileMode(0o644)))
+
+	// Absolute paths in the run directory are collected too
+	run := NewRun(runners.NewMake("server"))
+	run.Attempts = 1
+	run.opts = &RunOptions{Artifacts: ArtifactsConfig{
+		Files: []string{"server.bin", filepath.Join(runDir, SBOMFileName)},
+	}}
+	require.NoError(t, collectParallelArtifacts(run, runDir, workdir, map[string]string{}))
+	require.FileExists(t, filepath.Join(workdir, "server.bin"))
+	require.FileExists(t, filepath.Join(workdir, SBOMFileName))
+	require.Equal(t, []string{"server.bin", filepath.Join(workdir, SBOMFileName)}, run.opts.Artifacts.Files)
+
+	// Missing artifacts fail the collection
+	run.opts.Artifacts.Files = []string{"webapp.bin"}
+	err := collectParallelArtifacts(run, runDir, workdir, map[string]string{})
+	require.True(t, errors.Is(err, ErrArtifactMissing))
+
+	// Unless the run did not build them
+	run.Attempts = 0
+	require.NoError(t, collectParallelArtifacts(run, runDir, workdir, map[string]string{}))
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProvenanceParameters are the invocation parameters recorded in the
+// provenance of a run, enough to instantiate its runner again
+type ProvenanceParameters struct {
+	Runner      string             `json:"runner"`           // ID of the runner
+	Arguments   []string           `json:"arguments"`        // Runner arguments, after expanding their variables
+	Environment EnvironmentSummary `json:"environment"`      // What the build environment was made of
+	Matrix      map[string]string  `json:"matrix,omitempty"` // Matrix cell of the run, eg os=linux
+}
+
+// EnvironmentSummary describes the environment of a run without its
+// values, which are recorded in the provenance environment
+type EnvironmentSummary struct {
+	Clean     bool     `json:"clean"`             // The runner did not inherit the environment
+	Variables []string `json:"variables"`         // Names of the variables set for the build
+	Secrets   []string `json:"secrets,omitempty"` // Names of the variables holding secrets, not recorded
+}
+
+// provenanceParameters returns the parameters of a run for its provenance
+func provenanceParameters(r *Run) ProvenanceParameters {
+	opts := r.runner.Options()
+	params := ProvenanceParameters{
+		Runner:    r.runner.ID(),
+		Arguments: maskedArguments(r.runner),
+		Environment: EnvironmentSummary{
+			Clean:     opts.CleanEnv,
+			Variables: []string{},
+		},
+		Matrix: r.opts.Matrix,
+	}
+	for v := range opts.EnvVars {
+		if v == "PWD" || strings.HasPrefix(v, "MMBUILD_") {
+			continue
+		}
+		if isSecretVar(opts, v) {
+			params.Environment.Secrets = append(params.Environment.Secrets, v)
+			continue
+		}
+		params.Environment.Variables = append(params.Environment.Variables, v)
+	}
+	sort.Strings(params.Environment.Variables)
+	sort.Strings(params.Environment.Secrets)
+	return params
+}
+
+// ParseProvenanceParameters reads the invocation parameters of a
+// provenance statement. Attestations written before the parameters were
+// structured recorded only the runner arguments, the runner is then taken
+// from the build type.
+func ParseProvenanceParameters(buildType string, parameters interface{}) (*ProvenanceParameters, error) {
+	switch p := parameters.(type) {
+	case nil:
+		return &ProvenanceParameters{Runner: buildType, Arguments: []string{}}, nil
+	case ProvenanceParameters:
+		return &p, nil
+	case *ProvenanceParameters:
+		return p, nil
+	case []string:
+		return &ProvenanceParameters{Runner: buildType, Arguments: p}, nil
+	case []interface{}:
+		params := &ProvenanceParameters{Runner: buildType, Arguments: []string{}}
+		for i, arg := range p {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("parameter #%d is not a string", i)
+			}
+			params.Arguments = append(params.Arguments, s)
+		}
+		return params, nil
+	}
+
+	// Parameters unmarshaled from JSON are maps
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling provenance parameters: %w", err)
+	}
+	params := &ProvenanceParameters{}
+	if err := json.Unmarshal(data, params); err != nil {
+		return nil, fmt.Errorf("parsing provenance parameters: %w", err)
+	}
+	if params.Runner == "" {
+		params.Runner = buildType
+	}
+	return params, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenanceParameters(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runners.DefaultOptions.EnvVars = map[string]string{}
+
+	dir := t.TempDir()
+	b := NewWithOptions(runners.NewMake("package", "GOOS=linux"), &Options{})
+	b.Options().Workdir = dir
+	b.Options().EnvVars = map[string]string{"GOOS": "linux", "TOKEN": "s3cr3t", "CHANNEL": "stable"}
+	b.Options().SecretVars = []string{"TOKEN"}
+	opts := b.runOptions()
+	opts.Matrix = map[string]string{"os": "linux"}
+	statement, err := b.RunWithOptions(opts).Provenance()
+	require.NoError(t, err)
+
+	// Parameters are serialized as a structure
+	data, err := json.Marshal(statement)
+	require.NoError(t, err)
+	decoded := &intoto.ProvenanceStatement{}
+	require.NoError(t, json.Unmarshal(data, decoded))
+	params, err := ParseProvenanceParameters(decoded.Predicate.BuildType, decoded.Predicate.Invocation.Parameters)
+	require.NoError(t, err)
+	require.Equal(t, &ProvenanceParameters{
+		Runner:    "make",
+		Arguments: []string{"package", "GOOS=linux"},
+		Environment: EnvironmentSummary{
+			Variables: []string{"CHANNEL", "GOOS"},
+			Secrets:   []string{"TOKEN"},
+		},
+		Matrix: map[string]string{"os": "linux"},
+	}, params)
+
+	// Attestations recording the raw arguments are still read
+	var legacy interface{}
+	require.NoError(t, json.Unmarshal([]byte(`["step:make", "build", "step:npm"]`), &legacy))
+	params, err = ParseProvenanceParameters("composite", legacy)
+	require.NoError(t, err)
+	require.Equal(t, "composite", params.Runner)
+	require.Equal(t, []string{"step:make", "build", "step:npm"}, params.Arguments)
+
+	require.NoError(t, json.Unmarshal([]byte(`["build", 1]`), &legacy))
+	_, err = ParseProvenanceParameters("make", legacy)
+	require.Error(t, err)
+
+	// Builds are recreated from both kinds of attestations
+	for i, parameters := range []string{
+		`["package", "GOOS=linux"]`,
+		`{"runner": "make", "arguments": ["package", "GOOS=linux"], "environment": {"clean": false, "variables": []}}`,
+	} {
+		path := filepath.Join(dir, "provenance.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{
+  "_type": "https://in-toto.io/Statement/v0.1",
+  "predicateType": "https://slsa.dev/provenance/v0.2",
+  "subject": [],
+  "predicate": {
+    "builder": {"id": "MatterBuild/v0.1"},
+    "buildType": "make",
+    "invocation": {"configSource": {}, "parameters": `+parameters+`}
+  }
+}`), os.FileMode(0o644)))
+		rebuilt, err := NewFromAttestation(path, &Options{Workdir: dir})
+		require.NoError(t, err, i)
+		require.Equal(t, "make", rebuilt.runner.ID(), i)
+		require.Equal(t, []string{"package", "GOOS=linux"}, rebuilt.runner.Arguments(), i)
+	}
+}
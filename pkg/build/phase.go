@@ -0,0 +1,118 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/trace"
+)
+
+// Phase identifies a step in the execution of a run. Phases execute in
+// the order they are declared here. Any error returned in a phase stops
+// the run and marks it as failed.
+type Phase string
+
+const (
+	PhaseCache        Phase = "cache"        // Restore the artifacts from the build cache, skipping the build on a hit
+	PhaseMaterials    Phase = "materials"    // Download the build materials
+	PhaseCheckout     Phase = "checkout"     // Check out the build point in the working directory
+	PhaseReplacements Phase = "replacements" // Apply the replacements to the source
+	PhaseBuild        Phase = "build"        // Execute the runner, retrying it if configured
+	PhaseTests        Phase = "tests"        // Collect the test reports produced by the build
+	PhaseCoverage     Phase = "coverage"     // Collect the coverage reports produced by the build
+	PhaseVerify       Phase = "verify"       // Check the expected artifacts were produced
+	PhaseLeaks        Phase = "leaks"        // Scan the artifacts for replacement tags and secrets, if enabled
+	PhaseChecksums    Phase = "checksums"    // Write the checksum files of the artifacts, if enabled
+	PhaseSign         Phase = "sign"         // Sign the artifacts, if enabled
+	PhaseTransfers    Phase = "transfers"    // Copy artifacts to the transfer destinations
+	PhaseProvenance   Phase = "provenance"   // Write the provenance attestation
+	PhaseSBOM         Phase = "sbom"         // Write the SBOM, if enabled
+	PhaseStore        Phase = "store"        // Copy the artifacts and provenance to the artifact store and the build cache
+	PhaseDotEnv       Phase = "dotenv"       // Write the dotenv file with the run data
+)
+
+// PhaseFunc is a function that runs as part of a phase
+type PhaseFunc func(*Run) error
+
+// runHooks holds the functions registered for the phases of a run
+type runHooks struct {
+	before  map[Phase][]PhaseFunc
+	after   map[Phase][]PhaseFunc
+	replace map[Phase]PhaseFunc
+}
+
+func (r *Run) getHooks() *runHooks {
+	if r.hooks == nil {
+		r.hooks = &runHooks{
+			before:  map[Phase][]PhaseFunc{},
+			after:   map[Phase][]PhaseFunc{},
+			replace: map[Phase]PhaseFunc{},
+		}
+	}
+	return r.hooks
+}
+
+// Before registers a function to run before a phase. Functions run in the
+// order they were registered.
+func (r *Run) Before(phase Phase, fn PhaseFunc) {
+	r.getHooks().before[phase] = append(r.getHooks().before[phase], fn)
+}
+
+// After registers a function to run after a phase completes successfully.
+// Functions run in the order they were registered.
+func (r *Run) After(phase Phase, fn PhaseFunc) {
+	r.getHooks().after[phase] = append(r.getHooks().after[phase], fn)
+}
+
+// Replace substitutes the built in implementation of a phase with fn, for
+// example to store artifacts in a custom system. Before and after hooks
+// still run around the replacement.
+func (r *Run) Replace(phase Phase, fn PhaseFunc) {
+	r.getHooks().replace[phase] = fn
+}
+
+// runPhase executes a phase with its hooks. defaultFn is the built in
+// implementation, used unless the phase was replaced. The phase is a
+// span of the run trace, the parent of the spans started within it.
+func (r *Run) runPhase(phase Phase, defaultFn PhaseFunc) (err error) {
+	if err := r.context().Err(); err != nil {
+		return fmt.Errorf("starting phase %s: %w", phase, err)
+	}
+	ctx, span := trace.Start(r.context(), "build."+string(phase), trace.String(LogFieldPhase, string(phase)))
+	runCtx := r.ctx
+	r.ctx = ctx
+	defer func() {
+		r.ctx = runCtx
+		span.End(err)
+	}()
+	log := r.logger().WithField(LogFieldPhase, string(phase))
+	start := time.Now()
+	log.Debugf("Starting phase %s", phase)
+	hooks := r.getHooks()
+	for i, fn := range hooks.before[phase] {
+		if err := fn(r); err != nil {
+			return fmt.Errorf("running before hook #%d of phase %s: %w", i, phase, err)
+		}
+	}
+
+	fn := defaultFn
+	if replacement, ok := hooks.replace[phase]; ok {
+		log.Infof("Running custom implementation of phase %s", phase)
+		fn = replacement
+	}
+	if err := fn(r); err != nil {
+		log.WithField(LogFieldDuration, time.Since(start).Seconds()).Infof("Phase %s failed", phase)
+		return err
+	}
+
+	for i, fn := range hooks.after[phase] {
+		if err := fn(r); err != nil {
+			return fmt.Errorf("running after hook #%d of phase %s: %w", i, phase, err)
+		}
+	}
+	log.WithField(LogFieldDuration, time.Since(start).Seconds()).Infof("Phase %s finished", phase)
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPhase(t *testing.T) {
+	calls := []string{}
+	record := func(name string) PhaseFunc {
+		return func(*Run) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	r := &Run{opts: &RunOptions{}}
+	r.Before(PhaseStore, record("before1"))
+	r.Before(PhaseStore, record("before2"))
+	r.After(PhaseStore, record("after"))
+
+	// Hooks run around the default implementation
+	require.NoError(t, r.runPhase(PhaseStore, record("default")))
+	require.Equal(t, []string{"before1", "before2", "default", "after"}, calls)
+
+	// Hooks of other phases don't run
+	calls = []string{}
+	require.NoError(t, r.runPhase(PhaseSBOM, record("default")))
+	require.Equal(t, []string{"default"}, calls)
+
+	// Replaced phases don't call the default implementation
+	calls = []string{}
+	r.Replace(PhaseStore, record("custom"))
+	require.NoError(t, r.runPhase(PhaseStore, record("default")))
+	require.Equal(t, []string{"before1", "before2", "custom", "after"}, calls)
+
+	// Errors stop the phase
+	calls = []string{}
+	r.Replace(PhaseStore, func(*Run) error { return errors.New("store is down") })
+	require.Error(t, r.runPhase(PhaseStore, record("default")))
+	require.Equal(t, []string{"before1", "before2"}, calls)
+
+	calls = []string{}
+	r.Before(PhaseVerify, func(*Run) error { return errors.New("hook failed") })
+	r.Before(PhaseVerify, record("before"))
+	require.Error(t, r.runPhase(PhaseVerify, record("default")))
+	require.Empty(t, calls)
+}
+
+func TestRunPhaseTrace(t *testing.T) {
+	rec := trace.NewRecorder()
+	trace.SetTracer(rec)
+	defer trace.SetTracer(nil)
+
+	r := &Run{opts: &RunOptions{}, runner: runners.NewMake()}
+	ctx, span := trace.Start(context.Background(), "build.run")
+	r.ctx = ctx
+
+	// Spans started in a phase are its children
+	require.NoError(t, r.runPhase(PhaseTransfers, func(r *Run) error {
+		_, span := trace.Start(r.context(), "build.transfer")
+		span.End(nil)
+		return nil
+	}))
+	require.Error(t, r.runPhase(PhaseStore, func(*Run) error { return errors.New("store is down") }))
+	span.End(nil)
+
+	// The run context is restored after each phase
+	require.Equal(t, ctx, r.context())
+
+	run, ok := rec.Find("build.run")
+	require.True(t, ok)
+	phase, ok := rec.Find("build.transfers")
+	require.True(t, ok)
+	require.Equal(t, run.ID, phase.Parent)
+	require.Equal(t, string(PhaseTransfers), phase.Attributes[LogFieldPhase])
+	transfer, ok := rec.Find("build.transfer")
+	require.True(t, ok)
+	require.Equal(t, phase.ID, transfer.Parent)
+	store, ok := rec.Find("build.store")
+	require.True(t, ok)
+	require.Equal(t, run.ID, store.Parent)
+	require.EqualError(t, store.Err, "store is down")
+}
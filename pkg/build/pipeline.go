@@ -0,0 +1,338 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/sirupsen/logrus"
+)
+
+// PipelineBuildType is the build type of the provenance statement that
+// chains the builds of a pipeline
+const PipelineBuildType = "pipeline"
+
+// ErrDependencyFailed is the error of the pipeline nodes that were not
+// executed because one of their dependencies failed
+var ErrDependencyFailed = errors.New("pipeline dependency failed")
+
+// Pipeline composes builds into a directed acyclic graph. A build starts
+// when the builds it depends on finish, and their artifacts are added to
+// its materials with their digests. Builds without pending dependencies
+// run in parallel.
+type Pipeline struct {
+	nodes []*PipelineNode
+}
+
+// PipelineNode is a build in a pipeline
+type PipelineNode struct {
+	Name      string   // Name of the node, unique in the pipeline
+	Build     *Build   // Build executed by the node
+	DependsOn []string // Nodes whose artifacts are materials of this one
+}
+
+// NewPipeline returns an empty pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{nodes: []*PipelineNode{}}
+}
+
+// Add adds a build to the pipeline that runs after the nodes in dependsOn
+func (p *Pipeline) Add(name string, b *Build, dependsOn ...string) error {
+	if name == "" {
+		return errors.New("pipeline nodes need a name")
+	}
+	if b == nil {
+		return fmt.Errorf("pipeline node %s has no build", name)
+	}
+	if p.node(name) != nil {
+		return fmt.Errorf("pipeline already has a node named %s", name)
+	}
+	p.nodes = append(p.nodes, &PipelineNode{
+		Name: name, Build: b, DependsOn: append([]string(nil), dependsOn...),
+	})
+	return nil
+}
+
+// Nodes returns the nodes of the pipeline in the order they were added
+func (p *Pipeline) Nodes() []*PipelineNode {
+	return p.nodes
+}
+
+// node returns the node named name, nil if not found
+func (p *Pipeline) node(name string) *PipelineNode {
+	for _, n := range p.nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// Validate checks the dependencies of the nodes exist and do not form a
+// cycle. Builds that can run at the same time cannot share a workdir.
+func (p *Pipeline) Validate() error {
+	if len(p.nodes) == 0 {
+		return errors.New("pipeline has no builds")
+	}
+	for _, n := range p.nodes {
+		for _, d := range n.DependsOn {
+			if p.node(d) == nil {
+				return fmt.Errorf("node %s depends on unknown node %s", n.Name, d)
+			}
+		}
+	}
+
+	ancestors, err := p.ancestors()
+	if err != nil {
+		return err
+	}
+
+	workdirs := map[string]string{}
+	for _, n := range p.nodes {
+		workdir, err := filepath.Abs(n.Build.Options().Workdir)
+		if err != nil {
+			return fmt.Errorf("resolving working directory of %s: %w", n.Name, err)
+		}
+		workdirs[n.Name] = workdir
+	}
+	for i, a := range p.nodes {
+		for _, b := range p.nodes[i+1:] {
+			if workdirs[a.Name] != workdirs[b.Name] || ancestors[a.Name][b.Name] || ancestors[b.Name][a.Name] {
+				continue
+			}
+			return fmt.Errorf(
+				"builds %s and %s can run at the same time in the same working directory %s",
+				a.Name, b.Name, workdirs[a.Name],
+			)
+		}
+	}
+	return nil
+}
+
+// ancestors returns the set of nodes each node depends on, directly or
+// through other nodes. It fails if the dependencies have a cycle.
+func (p *Pipeline) ancestors() (map[string]map[string]bool, error) {
+	ancestors := map[string]map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(n *PipelineNode) (map[string]bool, error)
+	visit = func(n *PipelineNode) (map[string]bool, error) {
+		if set, ok := ancestors[n.Name]; ok {
+			return set, nil
+		}
+		if visiting[n.Name] {
+			return nil, fmt.Errorf("pipeline has a dependency cycle through %s", n.Name)
+		}
+		visiting[n.Name] = true
+		set := map[string]bool{}
+		for _, d := range n.DependsOn {
+			set[d] = true
+			deps, err := visit(p.node(d))
+			if err != nil {
+				return nil, err
+			}
+			for a := range deps {
+				set[a] = true
+			}
+		}
+		visiting[n.Name] = false
+		ancestors[n.Name] = set
+		return set, nil
+	}
+	for _, n := range p.nodes {
+		if _, err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+	return ancestors, nil
+}
+
+// PipelineResult holds the outcome of the builds of a pipeline
+type PipelineResult struct {
+	Runs       map[string]*Run             // Run of each node. Nodes skipped after a failed dependency have none
+	Errors     map[string]error            // Error of each node, nil if it succeeded
+	Provenance *intoto.ProvenanceStatement // Provenance chaining the successful builds, nil if none succeeded
+	Duration   time.Duration               // Wall clock time of the whole pipeline
+	order      []string                    // Names of the nodes in pipeline order
+}
+
+// Successful returns true if all the builds succeeded
+func (pr *PipelineResult) Successful() bool {
+	return pr.Err() == nil
+}
+
+// Err returns the error of the first node that failed, not counting the
+// ones skipped after a dependency failed, or nil if all succeeded
+func (pr *PipelineResult) Err() error {
+	failed := 0
+	var first *PipelineNodeError
+	for _, name := range pr.order {
+		err := pr.Errors[name]
+		if err == nil {
+			continue
+		}
+		failed++
+		if first == nil || (errors.Is(first.Err, ErrDependencyFailed) && !errors.Is(err, ErrDependencyFailed)) {
+			first = &PipelineNodeError{Node: name, Err: err}
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	first.Failed = failed
+	return first
+}
+
+// PipelineNodeError is returned by PipelineResult.Err() when builds failed
+type PipelineNodeError struct {
+	Node   string // Name of the node that failed
+	Err    error  // Error of the node
+	Failed int    // Number of nodes that failed or were skipped
+}
+
+func (e *PipelineNodeError) Error() string {
+	return fmt.Sprintf("%d pipeline builds failed, %s: %v", e.Failed, e.Node, e.Err)
+}
+
+// Unwrap returns the error of the failed node
+func (e *PipelineNodeError) Unwrap() error {
+	return e.Err
+}
+
+// Execute runs the builds of the pipeline. Each one starts as soon as its
+// dependencies succeed, nodes depending on a failed build are skipped.
+// The provenance of the builds is chained in a single statement.
+//
+// The returned error is only set when the pipeline is not valid, check
+// the result Err() to find out if any of the builds failed.
+func (p *Pipeline) Execute() (*PipelineResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("validating pipeline: %w", err)
+	}
+	for _, n := range p.nodes {
+		// Runners created from the catalog share their options
+		if err := runners.Isolate(n.Build.runner); err != nil {
+			return nil, fmt.Errorf("isolating runner of %s: %w", n.Name, err)
+		}
+	}
+
+	start := time.Now()
+	result := &PipelineResult{
+		Runs: map[string]*Run{}, Errors: map[string]error{}, order: []string{},
+	}
+	outputs := map[string]MaterialsConfig{}
+	done := map[string]chan struct{}{}
+	for _, n := range p.nodes {
+		result.order = append(result.order, n.Name)
+		done[n.Name] = make(chan struct{})
+	}
+
+	logrus.Infof("Executing pipeline of %d builds", len(p.nodes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, n := range p.nodes {
+		wg.Add(1)
+		go func(n *PipelineNode) {
+			defer wg.Done()
+			defer close(done[n.Name])
+			for _, d := range n.DependsOn {
+				<-done[d]
+			}
+
+			mu.Lock()
+			upstream := MaterialsConfig{}
+			var err error
+			for _, d := range n.DependsOn {
+				if result.Errors[d] != nil {
+					err = fmt.Errorf("%s depends on %s: %w", n.Name, d, ErrDependencyFailed)
+					break
+				}
+				upstream = append(upstream, outputs[d]...)
+			}
+			mu.Unlock()
+			if err != nil {
+				logrus.Errorf("Skipping pipeline build %s: %v", n.Name, err)
+				mu.Lock()
+				result.Errors[n.Name] = err
+				mu.Unlock()
+				return
+			}
+
+			run, materials, err := executeNode(n, upstream)
+			mu.Lock()
+			defer mu.Unlock()
+			if run != nil {
+				result.Runs[n.Name] = run
+			}
+			result.Errors[n.Name] = err
+			outputs[n.Name] = materials
+		}(n)
+	}
+	wg.Wait()
+
+	// Chain the provenance of the builds in pipeline order
+	statements := []*intoto.ProvenanceStatement{}
+	nodes := []*PipelineNode{}
+	for _, n := range p.nodes {
+		if result.Errors[n.Name] != nil {
+			continue
+		}
+		statement, err := result.Runs[n.Name].Provenance()
+		if err != nil {
+			result.Errors[n.Name] = fmt.Errorf("generating build provenance: %w", err)
+			continue
+		}
+		statements = append(statements, statement)
+		nodes = append(nodes, n)
+	}
+	result.Provenance = aggregateProvenance(PipelineBuildType, statements)
+	if result.Provenance != nil {
+		// Record the node and dependencies of each build
+		params := result.Provenance.Predicate.Invocation.Parameters.([]interface{})
+		for i, n := range nodes {
+			params[i].(map[string]interface{})["node"] = n.Name
+			params[i].(map[string]interface{})["dependsOn"] = n.DependsOn
+		}
+	}
+
+	result.Duration = time.Since(start)
+	logrus.Infof("Pipeline finished in %s", result.Duration.Round(time.Millisecond))
+	return result, nil
+}
+
+// executeNode runs the build of a node adding the artifacts of its
+// dependencies to its materials. It returns the run and the artifacts
+// it produced as materials for the nodes depending on it.
+func executeNode(n *PipelineNode, upstream MaterialsConfig) (*Run, MaterialsConfig, error) {
+	opts := n.Build.runOptions()
+	opts.Materials = append(append(MaterialsConfig{}, opts.Materials...), upstream...)
+	opts.Artifacts.Files = append([]string(nil), opts.Artifacts.Files...)
+	opts.Artifacts.Images = append([]string(nil), opts.Artifacts.Images...)
+	run := n.Build.RunWithOptions(opts)
+
+	logrus.Infof("Starting pipeline build %s with %d upstream materials", n.Name, len(upstream))
+	if err := run.Execute(); err != nil {
+		return run, nil, err
+	}
+
+	materials := MaterialsConfig{}
+	for _, path := range run.opts.Artifacts.Files {
+		artifact, err := filepath.Abs(filepath.Join(run.runner.Options().Workdir, path))
+		if err != nil {
+			return run, nil, fmt.Errorf("resolving path of artifact %s: %w", path, err)
+		}
+		digests, err := run.digestCache().fileDigests(artifact)
+		if err != nil {
+			return run, nil, fmt.Errorf("hashing artifact %s: %w", path, err)
+		}
+		materials = append(materials, MaterialsConfig{{URI: object.FileURL(artifact), Digest: digests}}...)
+	}
+	return run, materials, nil
+}
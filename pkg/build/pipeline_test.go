@@ -0,0 +1,118 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	makefile := "server:\n\techo server > server.bin\n" +
+		"webapp:\n\techo webapp > webapp.bin\n" +
+		"package:\n\tcat $$MMBUILD_MATERIALS_DIR/*/server.bin $$MMBUILD_MATERIALS_DIR/*/webapp.bin > package.bin\n" +
+		"broken:\n\texit 1\n"
+	newBuild := func(target string, files ...string) *Build {
+		workdir, _ := newTestRepo(t, map[string]string{
+			"Makefile": makefile,
+		})
+		return NewWithOptions(runners.NewMake(target), &Options{
+			Workdir: workdir, Source: "https://github.com/mattermost/cicd-sdk",
+			EnvVars: map[string]string{}, ExistenceCheck: AlwaysBuild,
+			Artifacts: ArtifactsConfig{Files: files},
+		})
+	}
+
+	server := newBuild("server", "server.bin")
+	p := NewPipeline()
+	require.NoError(t, p.Add("server", server))
+	require.NoError(t, p.Add("webapp", newBuild("webapp", "webapp.bin")))
+	pkg := newBuild("package", "package.bin")
+	require.NoError(t, p.Add("package", pkg, "server", "webapp"))
+	require.Error(t, p.Add("package", pkg))
+
+	res, err := p.Execute()
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	require.True(t, res.Successful())
+
+	// The artifacts of the dependencies are materials of the package
+	data, err := os.ReadFile(filepath.Join(pkg.Options().Workdir, "package.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "server\nwebapp\n", string(data))
+	serverBin := filepath.Join(server.Options().Workdir, "server.bin")
+	digests, err := digestSetForFile(serverBin)
+	require.NoError(t, err)
+	pkgMaterials := res.Runs["package"].Options().Materials
+	require.Len(t, pkgMaterials, 2)
+	require.Equal(t, object.FileURL(serverBin), pkgMaterials[0].URI)
+	require.Equal(t, digests, pkgMaterials[0].Digest)
+	require.Empty(t, pkg.Options().Materials)
+
+	// Each material is staged in its own directory, listed in the manifest
+	serverURI := object.FileURL(serverBin)
+	pkgRun := res.Runs["package"]
+	require.Len(t, pkgRun.MaterialPaths, 2)
+	require.Equal(t, filepath.Join(materialDir(serverURI), "server.bin"), pkgRun.MaterialPaths[serverURI])
+	data, err = os.ReadFile(filepath.Join(pkgRun.Options().MaterialsDir, MaterialsManifestFilename))
+	require.NoError(t, err)
+	manifest := map[string]string{}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, pkgRun.MaterialPaths, manifest)
+
+	// The provenance chains the builds
+	require.NotNil(t, res.Provenance)
+	require.Equal(t, PipelineBuildType, res.Provenance.Predicate.BuildType)
+	require.Len(t, res.Provenance.Subject, 3)
+	params := res.Provenance.Predicate.Invocation.Parameters.([]interface{})
+	require.Len(t, params, 3)
+	require.Equal(t, "package", params[2].(map[string]interface{})["node"])
+	require.Equal(t, []string{"server", "webapp"}, params[2].(map[string]interface{})["dependsOn"])
+
+	// Nodes depending on a failed build are skipped
+	p = NewPipeline()
+	require.NoError(t, p.Add("server", newBuild("broken")))
+	require.NoError(t, p.Add("package", newBuild("package"), "server"))
+	res, err = p.Execute()
+	require.NoError(t, err)
+	require.False(t, res.Successful())
+	require.True(t, errors.Is(res.Errors["package"], ErrDependencyFailed))
+	require.Nil(t, res.Runs["package"])
+	var nodeErr *PipelineNodeError
+	require.True(t, errors.As(res.Err(), &nodeErr))
+	require.Equal(t, "server", nodeErr.Node)
+	require.Equal(t, 2, nodeErr.Failed)
+
+	// Invalid pipelines are not executed
+	for _, tc := range []struct {
+		name  string
+		nodes map[string][]string
+	}{
+		{"unknown dependency", map[string][]string{"a": {"missing"}}},
+		{"cycle", map[string][]string{"a": {"b"}, "b": {"a"}}},
+	} {
+		p = NewPipeline()
+		for name, deps := range tc.nodes {
+			require.NoError(t, p.Add(name, newBuild("server"), deps...))
+		}
+		_, err := p.Execute()
+		require.Error(t, err, tc.name)
+	}
+
+	// Independent builds cannot share a working directory
+	p = NewPipeline()
+	require.NoError(t, p.Add("server", server))
+	require.NoError(t, p.Add("webapp", NewWithOptions(runners.NewMake("webapp"), server.Options())))
+	require.Error(t, p.Validate())
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/util"
+)
+
+// RunPlan describes what a run would do. It is produced by dry runs,
+// which resolve and validate everything the run needs without executing
+// the runner or copying any data.
+type RunPlan struct {
+	Runner       string               // ID of the runner
+	Arguments    []string             // Arguments passed to the runner
+	Workdir      string               // Directory where the runner would execute
+	BuildPoint   string               // Commit the build point resolved to
+	BuildRef     string               // Full name of the ref the build point was resolved from
+	Clone        bool                 // The source would be cloned into the workdir
+	Skip         bool                 // The build would be skipped, its artifacts already exist
+	Materials    []PlannedMaterial    // Materials to download, with their digests
+	Replacements []PlannedReplacement // Replacements and the files they would modify
+	Environment  map[string]string    // Variables set for the runner
+	Artifacts    []string             // Files expected from the build
+	Images       []string             // Container images expected from the build
+	StagingURL   string               // URL where the artifacts would be stored
+	Transfers    []object.CopySpec    // Artifact transfers to execute after the build
+}
+
+// PlannedMaterial is a material a run would download
+type PlannedMaterial struct {
+	URI    string
+	Digest map[string]string
+	Path   string // Where it would be downloaded, relative to the materials directory
+}
+
+// PlannedReplacement is a replacement a run would apply
+type PlannedReplacement struct {
+	Tag   string
+	Paths []string // Files where the tag was found, relative to the workdir
+}
+
+// String returns the plan in a human readable form
+func (p *RunPlan) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Runner: %s %s\n", p.Runner, strings.Join(p.Arguments, " "))
+	fmt.Fprintf(&sb, "Working directory: %s\n", p.Workdir)
+	if p.Clone {
+		sb.WriteString("Source would be cloned into the working directory\n")
+	}
+	if p.BuildPoint != "" {
+		fmt.Fprintf(&sb, "Build point: %s", p.BuildPoint)
+		if p.BuildRef != "" {
+			fmt.Fprintf(&sb, " (%s)", p.BuildRef)
+		}
+		sb.WriteString("\n")
+	}
+	if p.Skip {
+		sb.WriteString("Artifacts already exist, the build would be skipped\n")
+	}
+	for _, m := range p.Materials {
+		algos := []string{}
+		for algo := range m.Digest {
+			algos = append(algos, algo)
+		}
+		sort.Strings(algos)
+		digest := ""
+		if len(algos) > 0 {
+			digest = fmt.Sprintf(" (%s:%s)", algos[0], m.Digest[algos[0]])
+		}
+		fmt.Fprintf(&sb, "Material: %s%s\n", m.URI, digest)
+	}
+	for _, r := range p.Replacements {
+		fmt.Fprintf(&sb, "Replacement: %s in %s\n", r.Tag, strings.Join(r.Paths, ", "))
+	}
+	vars := []string{}
+	for v := range p.Environment {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	for _, v := range vars {
+		fmt.Fprintf(&sb, "Environment: %s=%s\n", v, p.Environment[v])
+	}
+	for _, a := range p.Artifacts {
+		fmt.Fprintf(&sb, "Artifact: %s\n", a)
+	}
+	for _, i := range p.Images {
+		fmt.Fprintf(&sb, "Image: %s\n", i)
+	}
+	if p.StagingURL != "" {
+		fmt.Fprintf(&sb, "Artifacts stored in: %s\n", p.StagingURL)
+	}
+	for _, t := range p.Transfers {
+		fmt.Fprintf(&sb, "Transfer: %s to %s\n", t.Source, t.Destination)
+	}
+	return sb.String()
+}
+
+// plan resolves what the run would do and checks it can be done
+func (dri *defaultRunImplementation) plan(r *Run) (*RunPlan, error) {
+	opts := r.runner.Options()
+	plan := &RunPlan{
+		Runner:       r.runner.ID(),
+		Arguments:    maskedArguments(r.runner),
+		Workdir:      opts.Workdir,
+		BuildPoint:   r.opts.BuildPoint,
+		BuildRef:     r.BuildRef,
+		Materials:    []PlannedMaterial{},
+		Replacements: []PlannedReplacement{},
+		Environment:  map[string]string{},
+		Artifacts:    append([]string{}, r.opts.Artifacts.Files...),
+		Images:       append([]string{}, r.opts.Artifacts.Images...),
+		Transfers:    []object.CopySpec{},
+	}
+
+	// The source is cloned when the workdir is empty
+	if opts.Source != "" && !util.Exists(filepath.Join(opts.Workdir, ".git")) {
+		entries, err := os.ReadDir(opts.Workdir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading workdir: %w", err)
+		}
+		plan.Clone = len(entries) == 0
+	}
+
+	exists, err := dri.artifactsExist(r)
+	if err != nil {
+		return nil, fmt.Errorf("checking if artifacts already exist: %w", err)
+	}
+	plan.Skip = exists != nil && *exists && !r.opts.ForceBuild
+
+	manager := r.materialsManager()
+	for i, m := range r.opts.Materials {
+		if err := manager.ValidateURL(m.URI); err != nil {
+			return nil, fmt.Errorf("checking material #%d: %w", i, err)
+		}
+		plan.Materials = append(plan.Materials, PlannedMaterial{
+			URI: m.URI, Digest: m.Digest, Path: filepath.Join(materialDir(m.URI), backends.ObjectName(m.URI)),
+		})
+	}
+
+	for i := range opts.Replacements {
+		paths, err := opts.Replacements[i].Plan()
+		if err != nil {
+			return nil, fmt.Errorf("checking replacement #%d: %w", i, err)
+		}
+		plan.Replacements = append(plan.Replacements, PlannedReplacement{
+			Tag: opts.Replacements[i].Tag, Paths: paths,
+		})
+	}
+
+	// Like in the provenance, the complete environment is only
+	// listed when the runner does not inherit it
+	env := opts.EnvVars
+	if opts.CleanEnv {
+		env = opts.Environment()
+	}
+	for v, val := range env {
+		// Secret values are not shown
+		if isSecretVar(opts, v) {
+			val = redactedSecret
+		}
+		plan.Environment[v] = opts.Mask(val)
+	}
+	plan.Environment["PWD"] = opts.Workdir
+	if r.opts.MaterialsDir != "" {
+		plan.Environment["MMBUILD_MATERIALS_DIR"] = r.opts.MaterialsDir
+	}
+	if fingerprint, err := r.InputFingerprint(); err == nil {
+		plan.Environment[InputFingerprintEnvVar] = fingerprint
+	}
+
+	// Files the runner knows it will produce
+	listed := map[string]bool{}
+	for _, f := range plan.Artifacts {
+		listed[f] = true
+	}
+	for _, f := range opts.ExpectedFiles {
+		if !listed[f] {
+			plan.Artifacts = append(plan.Artifacts, f)
+		}
+	}
+
+	if r.opts.Artifacts.Destination != "" {
+		plan.StagingURL, err = dri.stagingURL(r)
+		if err != nil {
+			return nil, fmt.Errorf("getting staging url: %w", err)
+		}
+		if err := manager.ValidateURL(plan.StagingURL); err != nil {
+			return nil, fmt.Errorf("checking artifacts destination: %w", err)
+		}
+	}
+
+	plan.Transfers, err = dri.transferSpecs(r)
+	if err != nil {
+		return nil, fmt.Errorf("computing transfers: %w", err)
+	}
+	for _, spec := range plan.Transfers {
+		if err := manager.ValidateURL(spec.Destination); err != nil {
+			return nil, fmt.Errorf("checking transfer destination: %w", err)
+		}
+	}
+
+	logrus.Infof("Run plan:\n%s", plan)
+	return plan, nil
+}
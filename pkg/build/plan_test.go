@@ -0,0 +1,81 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/mattermost/cicd-sdk/pkg/replacement"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Makefile"), []byte(
+		"build:\n\techo built > app.bin\n",
+	), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "version.go"), []byte(
+		"const Version = \"VERSION\"\n",
+	), os.FileMode(0o644)))
+
+	runner := runners.NewMake("build")
+	runner.Options().Workdir = dir
+	runner.Options().EnvVars = map[string]string{"GOOS": "linux"}
+	runner.Options().Replacements = []replacement.Replacement{
+		{Tag: "VERSION", Value: "v1.0.0", Paths: []string{"version.go"}, Workdir: dir},
+	}
+	newRun := func() *Run {
+		r := NewRun(runner)
+		r.opts = &RunOptions{
+			DryRun:         true,
+			BuildPoint:     "46305d50a15717e2d224e38f2f2bdc9027a7cbc7",
+			ExistenceCheck: AlwaysBuild,
+			Artifacts: ArtifactsConfig{
+				Destination: "file:/" + t.TempDir(),
+				Files:       []string{"app.bin"},
+			},
+			Transfers: []TransferConfig{{Source: []string{"app.bin"}, Destination: "s3://bucket/app/"}},
+		}
+		return r
+	}
+
+	r := newRun()
+	require.NoError(t, r.Execute())
+	require.NotNil(t, r.Plan)
+
+	// Nothing was built or modified
+	require.NoFileExists(t, filepath.Join(dir, "app.bin"))
+	data, err := os.ReadFile(filepath.Join(dir, "version.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "VERSION")
+
+	require.Equal(t, "make", r.Plan.Runner)
+	require.Equal(t, []string{"build"}, r.Plan.Arguments)
+	require.False(t, r.Plan.Skip)
+	require.Equal(t, []PlannedReplacement{{Tag: "VERSION", Paths: []string{"version.go"}}}, r.Plan.Replacements)
+	require.Equal(t, "linux", r.Plan.Environment["GOOS"])
+	require.Equal(t, []string{"app.bin"}, r.Plan.Artifacts)
+	require.NotEmpty(t, r.Plan.StagingURL)
+	require.Equal(t, []object.CopySpec{{
+		Source: object.FileURL(filepath.Join(dir, "app.bin")), Destination: "s3://bucket/app/",
+	}}, r.Plan.Transfers)
+	require.Contains(t, r.Plan.String(), "Transfer: ")
+
+	// Plans are validated
+	r = newRun()
+	r.opts.Transfers[0].Destination = "ftp://example.com/app/"
+	require.Error(t, r.Execute())
+
+	runner.Options().Replacements[0].Required = true
+	runner.Options().Replacements[0].Tag = "NOTFOUND"
+	r = newRun()
+	require.Error(t, r.Execute())
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/release-utils/command"
+)
+
+// configProfilesKey is the key of the per-branch settings
+const configProfilesKey = "profiles"
+
+// BranchEnvVar overrides the branch detected to select the configuration
+// profile
+const BranchEnvVar = "MMBUILD_BRANCH"
+
+// pullRequestPrefix is the prefix of the branch names of pull and merge
+// requests, eg pull/1234
+const pullRequestPrefix = "pull/"
+
+// profileKeys are the settings a profile can override
+var profileKeys = map[string]bool{"env": true, "transfers": true, "artifacts": true}
+
+// DetectBranch returns the branch being built, to select the profile of
+// the configuration. It is read from BranchEnvVar, the variables of the
+// CI systems or the repository in dir. Pull and merge requests are named
+// pull/<number>. It returns an empty string if the branch is unknown.
+func DetectBranch(dir string) string {
+	if branch := os.Getenv(BranchEnvVar); branch != "" {
+		return branch
+	}
+
+	// GitHub Actions
+	if ref := os.Getenv("GITHUB_REF"); ref != "" {
+		if strings.HasPrefix(ref, "refs/pull/") {
+			return pullRequestPrefix + strings.Split(strings.TrimPrefix(ref, "refs/pull/"), "/")[0]
+		}
+		if strings.HasPrefix(ref, "refs/heads/") {
+			return strings.TrimPrefix(ref, "refs/heads/")
+		}
+	}
+
+	// GitLab CI and Jenkins
+	for _, vars := range [][2]string{
+		{"CI_MERGE_REQUEST_IID", "CI_COMMIT_BRANCH"},
+		{"CHANGE_ID", "BRANCH_NAME"},
+	} {
+		if id := os.Getenv(vars[0]); id != "" {
+			return pullRequestPrefix + id
+		}
+		if branch := os.Getenv(vars[1]); branch != "" {
+			return branch
+		}
+	}
+
+	output, err := command.NewWithWorkDir(
+		dir, "git", "symbolic-ref", "--short", "HEAD",
+	).RunSilentSuccessOutput()
+	if err != nil {
+		return ""
+	}
+	return output.OutputTrimNL()
+}
+
+// applyProfile merges the settings of the first profile matching the
+// branch into the configuration data and removes the profiles from it.
+// Profile names are path.Match patterns, eg release-* or pull/*. It
+// returns the name of the profile applied, if any. Data without profiles
+// is returned as it is.
+func applyProfile(yamlData []byte, branch string) (data []byte, profile string, err error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(yamlData, doc); err != nil || len(doc.Content) == 0 {
+		// Parsing errors are reported when loading the configuration
+		return yamlData, "", nil
+	}
+	node := doc.Content[0]
+	i := mappingIndex(node, configProfilesKey)
+	if i < 0 {
+		return yamlData, "", nil
+	}
+	profiles := node.Content[i+1]
+	node.Content = append(node.Content[:i], node.Content[i+2:]...)
+	if profiles.Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("line %d: profiles must be a map of branch patterns", profiles.Line)
+	}
+
+	var settings *yaml.Node
+	for j := 0; j+1 < len(profiles.Content); j += 2 {
+		name, value := profiles.Content[j], profiles.Content[j+1]
+		if value.Kind != yaml.MappingNode {
+			return nil, "", fmt.Errorf("line %d: profile %s must be a map of settings", value.Line, name.Value)
+		}
+		for k := 0; k+1 < len(value.Content); k += 2 {
+			if !profileKeys[value.Content[k].Value] {
+				return nil, "", fmt.Errorf(
+					"line %d: profile %s cannot override %s", value.Content[k].Line, name.Value, value.Content[k].Value,
+				)
+			}
+		}
+		matched, err := path.Match(name.Value, branch)
+		if err != nil {
+			return nil, "", fmt.Errorf("line %d: invalid profile pattern %s: %w", name.Line, name.Value, err)
+		}
+		if matched && branch != "" && settings == nil {
+			profile, settings = name.Value, value
+		}
+	}
+
+	if settings != nil {
+		logrus.Infof("Applying configuration profile %s for branch %s", profile, branch)
+		mergeConfigNodes(node, settings, true)
+	} else {
+		logrus.Infof("No configuration profile matches branch %q", branch)
+	}
+	data, err = yaml.Marshal(node)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling configuration profile: %w", err)
+	}
+	return data, profile, nil
+}
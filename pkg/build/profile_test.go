@@ -0,0 +1,96 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigProfiles(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+env:
+  - var: GOOS
+    value: linux
+  - var: CHANNEL
+    value: dev
+artifacts:
+  destination: s3://mattermost-dev/builds/
+  files: ["dist/app.tar.gz"]
+transfers:
+  - source: ["dist/app.tar.gz"]
+    destination: s3://mattermost-dev/latest/
+profiles:
+  master:
+    env:
+      - var: CHANNEL
+        value: nightly
+  release-*:
+    env:
+      - var: CHANNEL
+        value: stable
+    artifacts:
+      destination: s3://mattermost-releases/builds/
+    transfers:
+      - source: ["dist/app.tar.gz"]
+        destination: s3://mattermost-releases/${CHANNEL}/
+  pull/*:
+    transfers: []
+`), os.FileMode(0o644)))
+
+	for _, tc := range []struct {
+		Branch      string
+		Profile     string
+		Channel     string
+		Destination string
+		Transfers   int
+	}{
+		{"master", "master", "nightly", "s3://mattermost-dev/builds/", 1},
+		{"release-7.1", "release-*", "stable", "s3://mattermost-releases/builds/", 1},
+		{"pull/1234", "pull/*", "dev", "s3://mattermost-dev/builds/", 0},
+		{"feature", "", "dev", "s3://mattermost-dev/builds/", 1},
+	} {
+		c, err := LoadConfigForBranch(conf, tc.Branch)
+		require.NoError(t, err, tc.Branch)
+		require.Equal(t, tc.Profile, c.Profile, tc.Branch)
+		require.Len(t, c.Env, 2, tc.Branch)
+		require.Equal(t, "linux", c.Env[0].Value, tc.Branch)
+		require.Equal(t, tc.Channel, c.Env[1].Value, tc.Branch)
+		// Artifacts are merged with the profile, transfers replaced
+		require.Equal(t, tc.Destination, c.Artifacts.Destination, tc.Branch)
+		require.Equal(t, []string{"dist/app.tar.gz"}, c.Artifacts.Files, tc.Branch)
+		require.Len(t, c.Transfers, tc.Transfers, tc.Branch)
+	}
+
+	// Variables in profiles are replaced too
+	c, err := LoadConfigForBranch(conf, "release-7.1")
+	require.NoError(t, err)
+	require.Equal(t, "s3://mattermost-releases/stable/", c.Transfers[0].Destination)
+
+	// The branch is read from the environment
+	t.Setenv(BranchEnvVar, "release-7.2")
+	c, err = LoadConfig(conf)
+	require.NoError(t, err)
+	require.Equal(t, "release-*", c.Profile)
+
+	t.Setenv(BranchEnvVar, "")
+	t.Setenv("GITHUB_REF", "refs/pull/1234/merge")
+	require.Equal(t, "pull/1234", DetectBranch(t.TempDir()))
+
+	// Profiles only override env vars, transfers and artifacts
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+profiles:
+  master:
+    runner:
+      id: go
+`), os.FileMode(0o644)))
+	_, err = LoadConfigForBranch(conf, "master")
+	require.Error(t, err)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/sirupsen/logrus"
+)
+
+// logRedactor is a logrus hook masking the sensitive values and the
+// credentials in the messages and fields of the SDK log lines, before
+// they are formatted and written
+type logRedactor struct {
+	mu       sync.RWMutex
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// redactor holds the values registered with RedactLogs, masked in the log
+// lines of all the runs. The global logrus logger is never hooked.
+var redactor = &logRedactor{patterns: append([]*regexp.Regexp{}, runners.CredentialPatterns...)}
+
+// RedactLogs masks values in the SDK log lines of all the runs written
+// from now on. The secrets of each build are masked in the lines of its
+// runs, common credentials (see runners.CredentialPatterns) are always
+// masked.
+func RedactLogs(values ...string) {
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	seen := map[string]bool{}
+	for _, v := range redactor.values {
+		seen[v] = true
+	}
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		redactor.values = append(redactor.values, v)
+	}
+	// Longest first so a value containing another one is masked completely
+	sort.SliceStable(redactor.values, func(i, j int) bool {
+		return len(redactor.values[i]) > len(redactor.values[j])
+	})
+}
+
+// RedactLogPatterns masks the matches of regular expressions in the SDK
+// log lines of all the runs written from now on
+func RedactLogPatterns(patterns ...string) error {
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	seen := map[string]bool{}
+	for _, re := range redactor.patterns {
+		seen[re.String()] = true
+	}
+	compiled := []*regexp.Regexp{}
+	for _, p := range patterns {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("compiling redaction pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	redactor.patterns = append(redactor.patterns, compiled...)
+	return nil
+}
+
+// with returns a new redactor masking the values and patterns of lr and
+// the ones passed
+func (lr *logRedactor) with(values []string, patterns []*regexp.Regexp) *logRedactor {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+	combined := &logRedactor{
+		values:   append(append([]string{}, values...), lr.values...),
+		patterns: append(append([]*regexp.Regexp{}, patterns...), lr.patterns...),
+	}
+	sort.SliceStable(combined.values, func(i, j int) bool {
+		return len(combined.values[i]) > len(combined.values[j])
+	})
+	return combined
+}
+
+// logger returns an SDK owned logger that writes like the standard logrus
+// logger, with its output, format, level and hooks, masking the lines first
+func (lr *logRedactor) logger() *logrus.Logger {
+	std := logrus.StandardLogger()
+	hooks := logrus.LevelHooks{}
+	hooks.Add(lr)
+	for level, levelHooks := range std.Hooks {
+		hooks[level] = append(hooks[level], levelHooks...)
+	}
+	return &logrus.Logger{
+		Out:          std.Out,
+		Formatter:    std.Formatter,
+		Hooks:        hooks,
+		Level:        std.GetLevel(),
+		ExitFunc:     std.ExitFunc,
+		ReportCaller: std.ReportCaller,
+	}
+}
+
+// Levels returns the levels the hook is fired for: all of them
+func (lr *logRedactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks the message and the text fields of a log entry
+func (lr *logRedactor) Fire(entry *logrus.Entry) error {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+	entry.Message = runners.MaskString(entry.Message, lr.values, lr.patterns)
+	for k, v := range entry.Data {
+		switch value := v.(type) {
+		case string:
+			entry.Data[k] = runners.MaskString(value, lr.values, lr.patterns)
+		case error:
+			entry.Data[k] = runners.MaskString(value.Error(), lr.values, lr.patterns)
+		}
+	}
+	return nil
+}
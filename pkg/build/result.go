@@ -0,0 +1,93 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/sirupsen/logrus"
+)
+
+// RunResult is the outcome of a run in a form orchestrators can consume
+// without reading its logs. It serializes to JSON.
+type RunResult struct {
+	ID               string                       `json:"id"`
+	Success          bool                         `json:"success"`
+	Error            string                       `json:"error,omitempty"`
+	ExitCode         int                          `json:"exitCode"`                   // Exit code of the last runner attempt, -1 if unknown
+	Duration         time.Duration                `json:"duration"`                   // Time the run took to execute
+	Attempts         int                          `json:"attempts"`                   // Number of times the runner was executed
+	InputFingerprint string                       `json:"inputFingerprint,omitempty"` // Fingerprint of the build point and materials, see Run.InputFingerprint
+	Log              string                       `json:"log,omitempty"`              // Output log of the last attempt
+	ErrorLog         string                       `json:"errorLog,omitempty"`         // Error output log of the last attempt
+	UploadedLogs     []LogObject                  `json:"uploadedLogs,omitempty"`     // Runner logs copied to the object store
+	Artifacts        map[string]map[string]string `json:"artifacts,omitempty"`        // Digest sets of the artifacts, by path relative to the workdir
+	Transfers        []string                     `json:"transfers,omitempty"`        // URLs of the objects sent by the run transfers
+	ProvenancePath   string                       `json:"provenancePath,omitempty"`   // Provenance attestation written by the run
+	Cache            string                       `json:"cache,omitempty"`            // Build cache lookup result, hit or miss. Empty without a cache
+	Annotations      map[string]string            `json:"annotations,omitempty"`      // Metadata of the run, from RunOptions.Annotations
+}
+
+// Result returns the result of the run. It returns nil if the
+// run has not executed yet.
+func (r *Run) Result() *RunResult {
+	if r.isSuccess == nil {
+		return nil
+	}
+
+	res := &RunResult{
+		ID:             r.ID(),
+		Success:        *r.isSuccess,
+		ExitCode:       exitCode(r.err),
+		Duration:       r.EndTime.Sub(r.StartTime),
+		Attempts:       r.Attempts,
+		Transfers:      r.Transferred,
+		UploadedLogs:   r.UploadedLogs,
+		ProvenancePath: r.ProvenancePath,
+		Cache:          r.Cache,
+		Annotations:    r.opts.Annotations,
+		Artifacts:      map[string]map[string]string{},
+	}
+	if r.err != nil {
+		res.Error = r.err.Error()
+	}
+	if fingerprint, err := r.InputFingerprint(); err == nil {
+		res.InputFingerprint = fingerprint
+	}
+	if len(r.Logs) > 0 {
+		res.Log = r.Logs[len(r.Logs)-1]
+	}
+	if len(r.ErrorLogs) > 0 {
+		res.ErrorLog = r.ErrorLogs[len(r.ErrorLogs)-1]
+	}
+
+	// Artifacts are only reported when the run produced or restored them
+	if res.Success && (r.Attempts > 0 || r.Cache == CacheHit) {
+		for _, path := range r.opts.Artifacts.Files {
+			digests, err := r.digestCache().fileDigests(filepath.Join(r.runner.Options().Workdir, path))
+			if err != nil {
+				logrus.Warnf("Unable to hash artifact %s for the run result: %v", path, err)
+				continue
+			}
+			res.Artifacts[path] = digests
+		}
+	}
+	return res
+}
+
+// exitCode returns the exit code of the command that caused err. Nil
+// errors exit with zero, errors not caused by a command exit are -1.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *runners.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return -1
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunResult(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile": "build:\n\techo $$MMBUILD_INPUT_FINGERPRINT > app.bin\n" +
+			"broken:\n\texit 1\n",
+	})
+
+	dest := t.TempDir()
+	newRun := func(target string) *Run {
+		runner := runners.NewMake(target)
+		require.NoError(t, runners.Isolate(runner))
+		runner.Options().Workdir = workdir
+		runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+		r := NewRun(runner)
+		r.opts = &RunOptions{
+			BuildPoint: head, ExistenceCheck: AlwaysBuild,
+			Artifacts: ArtifactsConfig{Files: []string{"app.bin"}},
+			Transfers: []TransferConfig{{Source: []string{"app.bin"}, Destination: object.FileURL(dest) + "/"}},
+		}
+		return r
+	}
+
+	r := newRun("build")
+	require.Nil(t, r.Result())
+	require.NoError(t, r.Execute())
+	res := r.Result()
+	require.NotNil(t, res)
+	require.True(t, res.Success)
+	require.Empty(t, res.Error)
+	require.Equal(t, 0, res.ExitCode)
+	require.Equal(t, 1, res.Attempts)
+	require.FileExists(t, res.Log)
+	require.NotEmpty(t, res.ProvenancePath)
+	require.Equal(t, []string{object.FileURL(filepath.Join(dest, "app.bin"))}, res.Transfers)
+	expected, err := digestSetForFile(filepath.Join(workdir, "app.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, res.Artifacts["app.bin"])
+
+	// The runner gets the input fingerprint, eg to embed it in binaries
+	fingerprint, err := StagingPath(head, nil)
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, res.InputFingerprint)
+	data, err := os.ReadFile(filepath.Join(workdir, "app.bin"))
+	require.NoError(t, err)
+	require.Equal(t, fingerprint+"\n", string(data))
+
+	data, err = json.Marshal(res)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"exitCode":0`)
+
+	// Failed runs report the exit code of the runner
+	require.NoError(t, os.Remove(filepath.Join(workdir, "app.bin")))
+	r = newRun("broken")
+	require.Error(t, r.Execute())
+	res = r.Result()
+	require.False(t, res.Success)
+	require.NotEmpty(t, res.Error)
+	require.Equal(t, 2, res.ExitCode) // make exits with 2 when a recipe fails
+	require.Empty(t, res.Artifacts)
+	require.Empty(t, res.Transfers)
+}
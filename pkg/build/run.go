@@ -4,13 +4,17 @@
 package build
 
 import (
-	"crypto/sha256"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
@@ -18,11 +22,12 @@ import (
 	"github.com/mattermost/cicd-sdk/pkg/build/runners"
 	"github.com/mattermost/cicd-sdk/pkg/git"
 	"github.com/mattermost/cicd-sdk/pkg/object"
-	"github.com/pkg/errors"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/mattermost/cicd-sdk/pkg/replacement"
+	"github.com/mattermost/cicd-sdk/pkg/snapshot"
+	"github.com/mattermost/cicd-sdk/pkg/trace"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/bom/pkg/spdx"
-	"sigs.k8s.io/release-utils/command"
-	"sigs.k8s.io/release-utils/hash"
 	"sigs.k8s.io/release-utils/util"
 )
 
@@ -39,26 +44,71 @@ const (
 
 // Run asbtracts a build run
 type Run struct {
-	impl           runImplementation
-	id             int
-	opts           *RunOptions
-	Created        time.Time
-	StartTime      time.Time
-	EndTime        time.Time
-	runner         runners.Runner
-	isSuccess      *bool
-	ProvenancePath string
+	impl            runImplementation
+	id              int
+	opts            *RunOptions
+	Created         time.Time
+	StartTime       time.Time
+	EndTime         time.Time
+	runner          runners.Runner
+	isSuccess       *bool
+	ProvenancePath  string
+	DotEnvPath      string            // Dotenv file written by the run, in its working directory
+	Attempts        int               // Number of times the runner was executed
+	Logs            []string          // Output log of each attempt
+	ErrorLogs       []string          // Error output log of each attempt
+	UploadedLogs    []LogObject       // Runner logs copied to the object store
+	MaterialPaths   map[string]string // Where each material was downloaded, by URI, relative to the materials directory
+	hooks           *runHooks
+	digests         *digestCache         // Digests computed during the run
+	objects         *object.Manager      // Object manager caching existence checks
+	originalRef     string               // Ref checked out in the workdir before the build point
+	BuildRef        string               // Full name of the ref the build point was resolved from
+	TestResults     *TestSummary         // Results of the test reports found after the build, nil if none are configured
+	TestReports     []string             // Test report files found, relative to the workdir
+	Coverage        *CoverageSummary     // Coverage computed from the go cover profiles found, nil if none are configured
+	CoverageReports []string             // Coverage report files found, relative to the workdir
+	Plan            *RunPlan             // What the run would do, set by dry runs
+	Transferred     []string             // URLs of the objects sent by the run transfers
+	Cache           string               // Result of the build cache lookup, CacheHit or CacheMiss. Empty when there is no cache
+	ReplacedFiles   []replacement.Change // Files modified by the replacements, with their digests before and after
+	Discovered      []string             // Artifacts found by the discovery, new or modified files relative to the workdir
+	Signatures      []Signature          // Signatures of the artifacts, when signing is configured
+	Signer          *SignerIdentity      // Who signed the artifacts, recorded in the provenance
+	snapshot        *snapshot.Snapshot   // Files in the discovery directories before the runner executed
+	err             error                // Error returned by Execute
+	ctx             context.Context      // Context of the execution, nil until it starts
+	logMu           sync.Mutex           // Guards log
+	log             *RunLog              // Log of the run, nil until opened
 }
 
 // RunOptions control specific bits of a build run
 type RunOptions struct {
-	ForceBuild   bool             // When true, build will run even if artifacts exist already
-	SBOM         bool             // Write an SBOM for the run when true
-	BuildPoint   string           // git build point where the build will run
-	MaterialsDir string           // Directory to store materials
-	Materials    MaterialsConfig  // List of materials for the build
-	Artifacts    ArtifactsConfig  // Artifacts configuration
-	Transfers    []TransferConfig // Artifacts to transfer out
+	ForceBuild     bool               // When true, build will run even if artifacts exist already
+	SBOM           bool               // Write an SBOM for the run when true
+	BuildPoint     string             // git build point where the build will run. A commit SHA, branch, tag or remote ref
+	MaterialsDir   string             // Directory to store materials
+	Materials      MaterialsConfig    // List of materials for the build
+	MaterialLimits MaterialLimits     // Download limits of the materials, by URI
+	Artifacts      ArtifactsConfig    // Artifacts configuration
+	Transfers      []TransferConfig   // Artifacts to transfer out
+	Timeout        time.Duration      // Kill the runner if the run takes longer than this. Zero disables it
+	RetryCount     int                // Number of times to retry the runner if it fails
+	RetryBackoff   time.Duration      // Wait before the first retry, doubled on each subsequent one
+	ExistenceCheck ExistenceChecker   // Decides if the build can be skipped. Defaults to the provenance check
+	ExistsCacheTTL time.Duration      // Time the existence checks cache the objects they find. Zero disables the cache
+	KeepCheckout   bool               // Leave the build point checked out after the run instead of restoring the original ref
+	DryRun         bool               // Resolve and validate the run, recording its Plan, without building or copying anything
+	Tests          TestsConfig        // Test reports to collect after the build
+	Coverage       CoverageConfig     // Coverage reports to collect after the build
+	Cache          CacheConfig        // Build cache to restore the artifacts from instead of building them
+	Hooks          HooksConfig        // Shell commands to run at points of the run
+	Log            LogConfig          // Where the run keeps its log
+	Events         *EventBus          // Bus where the run publishes its events. Nil disables them
+	Arguments      []string           // Runner arguments from the configuration, their ${VARS} are expanded when the run starts
+	Matrix         map[string]string  // Matrix cell the run builds, eg os=linux, recorded in the provenance
+	Annotations    map[string]string  // Metadata recorded in the provenance and the run result, eg ticket=MM-1234
+	GitHubStatus   GitHubStatusConfig // Commit statuses or check runs reporting the run on GitHub
 }
 
 var DefaultRunOptions = &RunOptions{}
@@ -77,8 +127,44 @@ func (r *Run) ID() string {
 	return fmt.Sprintf("%s-%04d", r.runner.ID(), r.id)
 }
 
+// Options returns the run options
+func (r *Run) Options() *RunOptions {
+	return r.opts
+}
+
+// Runner returns the runner executed by the run
+func (r *Run) Runner() runners.Runner {
+	return r.runner
+}
+
+// gitContext returns the context for the git operations of the run. When
+// the run has a timeout, git commands are killed if they run past it.
+func (r *Run) gitContext() (context.Context, context.CancelFunc) {
+	if r.opts.Timeout == 0 || r.StartTime.IsZero() {
+		return context.WithCancel(r.context())
+	}
+	return context.WithDeadline(r.context(), r.StartTime.Add(r.opts.Timeout))
+}
+
+// context returns the context the run executes with
+func (r *Run) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// workdirRepository returns the git repository in the run workdir
+func (r *Run) workdirRepository() *git.Repository {
+	return git.NewRepositoryWithOptions(&git.RepoOptions{
+		Path: r.runner.Options().Workdir, DefaultRemote: "origin",
+	})
+}
+
 func (r *Run) setRunnerOptions() {
 	r.runner.Options().BuildPoint = r.opts.BuildPoint
+	r.runner.Options().Timeout = r.opts.Timeout
+	r.runner.Options().Context = r.context()
 
 	// Add to the environment
 	if r.runner.Options().EnvVars == nil {
@@ -86,121 +172,409 @@ func (r *Run) setRunnerOptions() {
 	}
 	r.runner.Options().EnvVars["PWD"] = r.runner.Options().Workdir
 	r.runner.Options().EnvVars["MMBUILD_MATERIALS_DIR"] = r.opts.MaterialsDir
+	if fingerprint, err := r.InputFingerprint(); err == nil {
+		r.runner.Options().EnvVars[InputFingerprintEnvVar] = fingerprint
+	} else {
+		r.logger().Debugf("Run has no input fingerprint: %v", err)
+	}
+}
+
+// InputFingerprint returns the fingerprint of the inputs of the run: the
+// build point and the digests of the materials. It is the staging path
+// of the run, see StagingPath. Runners get it in InputFingerprintEnvVar,
+// eg to embed it in binaries and trace them back to their inputs.
+func (r *Run) InputFingerprint() (string, error) {
+	return StagingPath(r.opts.BuildPoint, r.opts.Materials)
+}
+
+// expandArguments sets the runner arguments from the configured ones,
+// replacing the ${VARS} they reference with the values of the run
+// environment. Like the variables replaced when loading the configuration,
+// those not in the run environment are read from the system environment
+// and the rest are replaced with an empty string. The expanded arguments
+// are recorded in the provenance.
+func (r *Run) expandArguments() error {
+	if r.opts.Arguments == nil {
+		return nil
+	}
+	setter, ok := r.runner.(runners.ArgumentsSetter)
+	if !ok {
+		return fmt.Errorf("arguments of runner %s cannot be set", r.runner.ID())
+	}
+	env := r.runner.Options().Environment()
+	env["MMBUILD_RUN_ID"] = r.ID()
+	env["MMBUILD_BUILD_POINT"] = r.opts.BuildPoint
+
+	args := []string{}
+	for _, arg := range r.opts.Arguments {
+		args = append(args, varRegexp.ReplaceAllStringFunc(arg, func(v string) string {
+			name := varRegexp.FindStringSubmatch(v)[1]
+			if val, ok := env[name]; ok {
+				return val
+			}
+			// The runner environment may be clean, fall back to the system one
+			if val := os.Getenv(name); val != "" {
+				return val
+			}
+			r.logger().Warnf("Runner argument variable $%s has no value, replacing it with an empty string", name)
+			return ""
+		}))
+	}
+	setter.SetArguments(args...)
+	return nil
 }
 
 // Execute executes the run
 func (r *Run) Execute() error {
+	return r.ExecuteWithContext(context.Background())
+}
+
+// ExecuteWithContext executes the run. When ctx is done, the runner
+// commands are killed, the git commands and copies in progress stop and
+// the run fails with the context error.
+func (r *Run) ExecuteWithContext(ctx context.Context) (err error) {
 	if r.isSuccess != nil {
-		logrus.Warnf("Run #%s already ran", r.ID())
+		r.logger().Warnf("Run #%s already ran", r.ID())
 		return nil
 	}
 
 	// Record the start time
 	r.StartTime = time.Now()
+	ctx, span := trace.Start(ctx, "build.run", trace.String(LogFieldRun, r.ID()))
+	r.ctx = ctx
+	r.emit(EventRunStarted, fmt.Sprintf("Run %s started", r.ID()), map[string]string{
+		"buildPoint": r.opts.BuildPoint,
+	})
 
-	// Defer setting the status and endtime
+	// Defer setting the status, error and endtime
 	defer func() {
 		r.EndTime = time.Now()
+		r.err = err
 		if r.isSuccess == nil {
 			r.isSuccess = &RUNFAIL
 		}
+		if err != nil {
+			r.emit(EventRunFailed, fmt.Sprintf("Run %s failed: %v", r.ID(), err), map[string]string{
+				"error": err.Error(),
+			})
+		} else {
+			r.emit(EventRunSucceeded, fmt.Sprintf("Run %s succeeded", r.ID()), nil)
+		}
+		if l := r.openedLog(); l != nil {
+			if err := l.Close(); err != nil {
+				r.logger().Warnf("Closing run log: %v", err)
+			}
+		}
+		span.End(err)
 	}()
 
+	// Fail before doing any work if the runner cannot execute
+	if err := runners.Validate(r.runner); err != nil {
+		return fmt.Errorf("validating runner: %w", err)
+	}
+	if r.opts.RetryCount < 0 {
+		return fmt.Errorf("invalid retry count %d, it cannot be negative", r.opts.RetryCount)
+	}
+
 	// Before checking if artifacts exist, ensure we have all artifact
 	// hashes. For example, for artifacts not pinned to a hash we need to
 	// get their hashes dynamically
 	if err := r.impl.getMissingMaterialHashes(r); err != nil {
-		return errors.Wrap(err, "getting missing artifact hashes")
+		return fmt.Errorf("getting missing artifact hashes: %w", err)
+	}
+
+	// Dry runs stop once they know what the run would do
+	if r.opts.DryRun {
+		if err := r.impl.resolveBuildPoint(r); err != nil {
+			return fmt.Errorf("resolving build point %s: %w", r.opts.BuildPoint, err)
+		}
+		if err := r.expandArguments(); err != nil {
+			return fmt.Errorf("expanding runner arguments: %w", err)
+		}
+		plan, err := r.impl.plan(r)
+		if err != nil {
+			return fmt.Errorf("planning run: %w", err)
+		}
+		r.Plan = plan
+		r.isSuccess = &RUNSUCCESS
+		return nil
+	}
+
+	if _, err := r.Log(); err != nil {
+		return fmt.Errorf("opening run log: %w", err)
+	}
+
+	// Clone the source code if the workdir has no repository
+	if err := r.impl.cloneSource(r); err != nil {
+		return fmt.Errorf("cloning source from %s: %w", r.runner.Options().Source, err)
+	}
+
+	// Resolve the build point to a commit before using it to
+	// compute the staging path or check out the code
+	if err := r.impl.resolveBuildPoint(r); err != nil {
+		return fmt.Errorf("resolving build point %s: %w", r.opts.BuildPoint, err)
 	}
 
 	// Check if the expected materials exist in the destination
 	// if they do, finish the run now.
 	exists, err := r.impl.artifactsExist(r)
 	if err != nil {
-		return errors.Wrap(err, "checking if artifacts already exist")
+		return fmt.Errorf("checking if artifacts already exist: %w", err)
 	}
 	if exists != nil {
 		if *exists {
 			if !r.opts.ForceBuild {
 				r.isSuccess = &RUNSUCCESS
-				logrus.Info("Artifacts found in the bucket, not running build again")
+				r.logger().Info("Artifacts found in the bucket, not running build again")
 				return nil
 			}
-			logrus.Info("Artifacts exist, but ForceBuild option is set, running build.")
+			r.logger().Info("Artifacts exist, but ForceBuild option is set, running build.")
 		}
 	}
 
+	// Uploads without credentials would only fail after the build
+	if err := r.checkDestinations(); err != nil {
+		return err
+	}
+
+	r.registerConfigHooks()
+
+	// Restore the artifacts from the build cache instead of building them
+	if err := r.runPhase(PhaseCache, r.impl.restoreCache); err != nil {
+		return fmt.Errorf("restoring artifacts from the build cache: %w", err)
+	}
+
 	// Download the materials to run the build
-	if err := r.impl.downloadMaterials(r); err != nil {
-		return errors.Wrap(err, "downloading materials")
+	if r.Cache != CacheHit {
+		if err := r.runPhase(PhaseMaterials, r.impl.downloadMaterials); err != nil {
+			return fmt.Errorf("downloading materials: %w", err)
+		}
 	}
 
 	r.setRunnerOptions()
+	if err := r.expandArguments(); err != nil {
+		return fmt.Errorf("expanding runner arguments: %w", err)
+	}
 
 	// Checkout the build point
-	if err := r.impl.checkoutBuildPoint(r); err != nil {
-		return errors.Wrapf(err, "checking out build point %s", r.runner.Options().BuildPoint)
+	if err := r.runPhase(PhaseCheckout, r.impl.checkoutBuildPoint); err != nil {
+		return fmt.Errorf("checking out build point %s: %w", r.runner.Options().BuildPoint, err)
 	}
 
-	// Process the run replacements
-	if err := r.impl.processReplacements(r.runner.Options()); err != nil {
-		logrus.Error("Error applying replacement data")
-		return errors.Wrap(err, "applying run replacement data")
+	// Return the repository to where it was when the run finishes
+	if !r.opts.KeepCheckout {
+		defer func() {
+			if err := r.impl.restoreCheckout(r); err != nil {
+				r.logger().Error(err)
+			}
+		}()
 	}
 
-	// Add a logfile. For now just a temporary file
-	outputFile, err := os.CreateTemp("", "builder-run-*.log")
-	if err != nil {
-		return errors.Wrap(err, "creating temporary file for log")
+	if r.Cache == CacheHit {
+		r.logger().Info("Artifacts restored from the build cache, not running build again")
+	} else if err := r.build(); err != nil {
+		return err
 	}
-	logrus.Infof("Build run output will be logged to %s", outputFile.Name())
-	r.runner.Options().Log = outputFile.Name()
 
-	// Call the runner Run method to execute the build
-	if err := r.runner.Run(); err != nil {
-		logrus.Errorf("[exec error in run #%s] %s", r.ID(), err)
-		return errors.Wrapf(err, "[exec error in run #%s]", r.ID())
+	if err := r.runPhase(PhaseVerify, r.impl.checkExpectedArtifacts); err != nil {
+		r.logger().Error("Error verifying expected artifacts")
+		return fmt.Errorf("verifying artifacts: %w", err)
 	}
 
-	if err := r.impl.checkExpectedArtifacts(r); err != nil {
-		logrus.Error("Error verifying expected artifacts")
-		return errors.Wrap(err, "verifying artifacts")
+	if err := r.runPhase(PhaseLeaks, r.impl.checkLeaks); err != nil {
+		return fmt.Errorf("scanning artifacts for leaks: %w", err)
 	}
 
-	if err := r.impl.sendTransfers(r); err != nil {
-		return errors.Wrap(err, "processing specific artifact transfers")
+	if err := r.runPhase(PhaseChecksums, r.impl.writeChecksums); err != nil {
+		return fmt.Errorf("writing artifact checksums: %w", err)
+	}
+
+	if err := r.runPhase(PhaseSign, r.impl.signArtifacts); err != nil {
+		return fmt.Errorf("signing artifacts: %w", err)
+	}
+
+	if err := r.runPhase(PhaseTransfers, r.impl.sendTransfers); err != nil {
+		return fmt.Errorf("processing specific artifact transfers: %w", err)
+	}
+
+	// The logs are final once the runner is done, the provenance
+	// links them
+	if err := r.impl.uploadLogs(r); err != nil {
+		return fmt.Errorf("uploading runner logs: %w", err)
 	}
 
 	// TODO(@puerco): normalize provenance artifacts to their
 	// transferred locations
-	if err := r.impl.writeProvenance(r); err != nil {
-		return errors.Wrap(err, "writing provenance metadata")
+	if err := r.runPhase(PhaseProvenance, r.impl.writeProvenance); err != nil {
+		return fmt.Errorf("writing provenance metadata: %w", err)
 	}
 
-	if err := r.impl.generateSBOM(r); err != nil {
-		return errors.Wrap(err, "writing sbom")
+	if err := r.runPhase(PhaseSBOM, r.impl.generateSBOM); err != nil {
+		return fmt.Errorf("writing sbom: %w", err)
 	}
 
-	if err := r.impl.storeArtifacts(r); err != nil {
-		return errors.Wrap(err, "transferring artifacts to destination")
+	if err := r.runPhase(PhaseStore, func(r *Run) error {
+		if err := r.impl.storeArtifacts(r); err != nil {
+			return err
+		}
+		return r.impl.populateCache(r)
+	}); err != nil {
+		return fmt.Errorf("transferring artifacts to destination: %w", err)
 	}
 
-	if err := r.impl.writeDotEnvArtifact(r); err != nil {
-		return errors.Wrap(err, "writing dotenv report artifact")
+	if err := r.runPhase(PhaseDotEnv, r.impl.writeDotEnvArtifact); err != nil {
+		return fmt.Errorf("writing dotenv report artifact: %w", err)
 	}
-
 	r.isSuccess = &RUNSUCCESS
 
 	return nil
 }
 
+// build applies the replacements and executes the runner, then collects
+// the test and coverage reports it produced
+func (r *Run) build() error {
+	// Process the run replacements
+	if err := r.runPhase(PhaseReplacements, func(r *Run) error {
+		changes, err := r.impl.processReplacements(r.runner.Options())
+		if err != nil {
+			return err
+		}
+		r.ReplacedFiles = changes
+		for _, rep := range replacement.Set(r.runner.Options().Replacements).Sorted() {
+			r.emit(EventReplacementApplied, fmt.Sprintf("Replaced %s", rep.Tag), map[string]string{
+				"tag": rep.Tag, "paths": strings.Join(rep.Paths, ","),
+			})
+		}
+		return nil
+	}); err != nil {
+		r.logger().Error("Error applying replacement data")
+		return fmt.Errorf("applying run replacement data: %w", err)
+	}
+
+	// Call the runner Run method to execute the build
+	if err := r.runPhase(PhaseBuild, func(r *Run) error {
+		if err := r.impl.snapshotArtifacts(r); err != nil {
+			return err
+		}
+		if err := r.runWithRetries(); err != nil {
+			return err
+		}
+		return r.impl.discoverArtifacts(r)
+	}); err != nil {
+		// Collect the test results anyway, they explain why the build failed
+		if terr := r.impl.collectTestReports(r); terr != nil && !errors.Is(terr, ErrTestsFailed) {
+			r.logger().Warnf("Unable to collect test reports: %v", terr)
+		}
+		return fmt.Errorf("[exec error in run #%s]: %w", r.ID(), err)
+	}
+
+	if err := r.runPhase(PhaseTests, r.impl.collectTestReports); err != nil {
+		return fmt.Errorf("collecting test reports: %w", err)
+	}
+
+	if err := r.runPhase(PhaseCoverage, r.impl.collectCoverageReports); err != nil {
+		return fmt.Errorf("collecting coverage reports: %w", err)
+	}
+	return nil
+}
+
+// runWithRetries executes the runner, retrying it as many times as
+// defined in the run options. Each attempt writes to its own log file.
+func (r *Run) runWithRetries() error {
+	backoff := r.opts.RetryBackoff
+	// The runner executes at least once
+	attempts := r.opts.RetryCount + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			r.logger().Infof("Retrying run #%s in %s (attempt %d of %d)", r.ID(), backoff, attempt, attempts)
+			select {
+			case <-time.After(backoff):
+			case <-r.context().Done():
+				return fmt.Errorf("waiting to retry run: %w", r.context().Err())
+			}
+			backoff *= 2
+		}
+
+		err := r.runAttempt(attempt)
+		if err == nil {
+			return nil
+		}
+		r.logger().Errorf("[exec error in run #%s attempt %d] %s", r.ID(), attempt, err)
+
+		// If the runner was killed, remove any partial artifacts it
+		// may have left behind in the working directory
+		var timeoutErr *runners.TimeoutError
+		var canceledErr *runners.CanceledError
+		if errors.As(err, &timeoutErr) || errors.As(err, &canceledErr) {
+			if cerr := r.impl.cleanupArtifacts(r); cerr != nil {
+				r.logger().Error(cerr)
+			}
+		}
+
+		// Cancelled runs are not retried
+		if attempt == attempts || r.context().Err() != nil {
+			return fmt.Errorf("run failed after %d attempts: %w", attempt, err)
+		}
+	}
+	return nil
+}
+
+// runAttempt executes the runner once. Its output goes to the run log and
+// to the plain text logs of the attempt, in the run log directory.
+func (r *Run) runAttempt(attempt int) error {
+	l, err := r.Log()
+	if err != nil {
+		return fmt.Errorf("opening run log: %w", err)
+	}
+	outputLog := filepath.Join(l.Dir(), fmt.Sprintf("attempt%d.log", attempt))
+	errorLog := filepath.Join(l.Dir(), fmt.Sprintf("attempt%d.err.log", attempt))
+	r.logger().Infof("Build run output will be logged to %s", outputLog)
+	r.runner.Options().Log = outputLog
+	r.runner.Options().ErrorLog = errorLog
+	r.Logs = append(r.Logs, outputLog)
+	r.ErrorLogs = append(r.ErrorLogs, errorLog)
+	// The attempt is counted once its logs are registered
+	r.Attempts = attempt
+
+	// Send the output to the run log during this attempt only
+	outputWriters, errorWriters := r.runner.Options().OutputWriters, r.runner.Options().ErrorWriters
+	ow, ew := l.Writer(attempt, LogStreamStdout), l.Writer(attempt, LogStreamStderr)
+	r.runner.Options().OutputWriters = append(append([]io.Writer{}, outputWriters...), ow)
+	r.runner.Options().ErrorWriters = append(append([]io.Writer{}, errorWriters...), ew)
+	defer func() {
+		r.runner.Options().OutputWriters, r.runner.Options().ErrorWriters = outputWriters, errorWriters
+		for _, w := range []io.Closer{ow, ew} {
+			if err := w.Close(); err != nil {
+				r.logger().Warnf("Writing runner output to the run log: %v", err)
+			}
+		}
+	}()
+
+	r.logEvent(fmt.Sprintf("Starting attempt %d of run %s", attempt, r.ID()))
+	_, span := trace.Start(r.context(), "build.attempt", trace.String("attempt", fmt.Sprint(attempt)))
+	err = r.runner.Run()
+	span.End(err)
+	if err != nil {
+		r.logEvent(fmt.Sprintf("Attempt %d failed: %v", attempt, err))
+	}
+	return err
+}
+
 func (r *Run) Provenance() (*intoto.ProvenanceStatement, error) {
 	return r.impl.provenance(r)
 }
 
 type runImplementation interface {
-	processReplacements(*runners.Options) error
+	processReplacements(*runners.Options) ([]replacement.Change, error)
 	checkExpectedArtifacts(*Run) error
+	snapshotArtifacts(*Run) error
+	discoverArtifacts(*Run) error
+	checkLeaks(*Run) error
+	writeChecksums(*Run) error
+	signArtifacts(*Run) error
 	provenance(*Run) (*intoto.ProvenanceStatement, error)
 	writeProvenance(*Run) error
 	checkoutBuildPoint(*Run) error
@@ -212,43 +586,124 @@ type runImplementation interface {
 	writeDotEnvArtifact(*Run) error
 	generateSBOM(*Run) error
 	getMissingMaterialHashes(*Run) error
+	cleanupArtifacts(*Run) error
+	restoreCheckout(*Run) error
+	resolveBuildPoint(*Run) error
+	cloneSource(*Run) error
+	plan(*Run) (*RunPlan, error)
+	transferSpecs(*Run) ([]object.CopySpec, error)
+	collectTestReports(*Run) error
+	collectCoverageReports(*Run) error
+	restoreCache(*Run) error
+	populateCache(*Run) error
+	uploadLogs(*Run) error
 }
 
 type defaultRunImplementation struct{}
 
-// processReplacements applies all replacements defined for the run
-func (dri *defaultRunImplementation) processReplacements(opts *runners.Options) error {
+// processReplacements applies all replacements defined for the run and
+// returns the changes they made to the files
+func (dri *defaultRunImplementation) processReplacements(opts *runners.Options) ([]replacement.Change, error) {
 	if opts.Replacements == nil || len(opts.Replacements) == 0 {
 		logrus.Info("Run has no replacements defined")
-		return nil
-	}
-	for i, r := range opts.Replacements {
-		if err := r.Apply(); err != nil {
-			return errors.Wrapf(err, "applying replacement #%d", i)
-		}
+		return nil, nil
 	}
-	return nil
+	// Longer tags are replaced first, so no tag is replaced inside another
+	return replacement.Set(opts.Replacements).ApplyChanges()
 }
 
 // checkExpectedArtifacts verifies a list of expected artifacts
 func (dri *defaultRunImplementation) checkExpectedArtifacts(r *Run) error {
+	// Files the runner reported as expected are added to the run artifacts
+	for _, path := range r.runner.Options().ExpectedFiles {
+		found := false
+		for _, f := range r.opts.Artifacts.Files {
+			if f == path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.opts.Artifacts.Files = append(r.opts.Artifacts.Files, path)
+		}
+	}
+
+	// Images pushed by the runner are added too. They live in a
+	// registry so they are not checked like files
+	for _, image := range r.runner.Options().ExpectedImages {
+		found := false
+		for _, i := range r.opts.Artifacts.Images {
+			if i == image {
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.opts.Artifacts.Images = append(r.opts.Artifacts.Images, image)
+		}
+	}
+
 	if r.opts.Artifacts.Files == nil {
-		logrus.Info("Run has no expected artifacts")
+		r.logger().Info("Run has no expected artifacts")
 		return nil
 	}
 	for _, path := range r.opts.Artifacts.Files {
 		if !util.Exists(filepath.Join(r.runner.Options().Workdir, path)) {
-			return errors.Errorf("expected artifact not found: %s", path)
+			return &ArtifactMissingError{Path: path}
 		}
+		r.logger().WithField(LogFieldArtifact, path).Debug("Expected artifact found")
+		r.emit(EventArtifactVerified, fmt.Sprintf("Artifact %s verified", path), map[string]string{
+			"path": path,
+		})
 	}
-	logrus.Infof("Successfully confirmed %d expected artifacts", len(r.opts.Artifacts.Files))
+	r.logger().Infof("Successfully confirmed %d expected artifacts", len(r.opts.Artifacts.Files))
+	return nil
+}
+
+// cleanupArtifacts removes the expected artifacts from the working
+// directory. It is used to discard incomplete outputs of a killed run.
+func (dri *defaultRunImplementation) cleanupArtifacts(r *Run) error {
+	paths := append([]string{}, r.opts.Artifacts.Files...)
+	paths = append(paths, r.runner.Options().ExpectedFiles...)
+	for _, path := range paths {
+		fullPath := filepath.Join(r.runner.Options().Workdir, path)
+		if !util.Exists(fullPath) {
+			continue
+		}
+		r.logger().Infof("Removing partial artifact %s", path)
+		if err := os.RemoveAll(fullPath); err != nil {
+			return fmt.Errorf("removing partial artifact %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// restoreCheckout checks out the branch or commit the repository was at
+// before checking out the build point
+func (dri *defaultRunImplementation) restoreCheckout(r *Run) error {
+	if r.originalRef == "" {
+		return nil
+	}
+	r.logger().Infof("Restoring repository checkout to %s", r.originalRef)
+	ctx, cancel := r.gitContext()
+	defer cancel()
+	if err := r.workdirRepository().CheckoutContext(ctx, r.originalRef); err != nil {
+		return fmt.Errorf("checking out original ref %s: %w", r.originalRef, err)
+	}
+	r.originalRef = ""
 	return nil
 }
 
 func (dri *defaultRunImplementation) provenance(r *Run) (*intoto.ProvenanceStatement, error) {
-	// Generate the environment struct
+	// Generate the environment struct. Builds running in a clean
+	// environment record all of it. Otherwise only the variables set
+	// for the build are recorded, to avoid leaking the host environment.
+	env := r.runner.Options().EnvVars
+	if r.runner.Options().CleanEnv {
+		env = r.runner.Options().Environment()
+	}
 	envData := map[string]string{}
-	for v, val := range r.runner.Options().EnvVars {
+	for v, val := range env {
 		// Synthetic environment vars are not recorded:
 		if v == "PWD" {
 			continue
@@ -257,7 +712,12 @@ func (dri *defaultRunImplementation) provenance(r *Run) (*intoto.ProvenanceState
 		if strings.HasPrefix(v, "MMBUILD_") {
 			continue
 		}
-		envData[v] = val
+		// Neither are secrets
+		if isSecretVar(r.runner.Options(), v) {
+			continue
+		}
+		// Sensitive values in other variables are masked
+		envData[v] = r.runner.Options().Mask(val)
 	}
 
 	// Add the parameters
@@ -274,12 +734,12 @@ func (dri *defaultRunImplementation) provenance(r *Run) (*intoto.ProvenanceState
 			BuildType: r.runner.ID(),
 			Invocation: v02.ProvenanceInvocation{
 				ConfigSource: v02.ConfigSource{},
-				Parameters:   r.runner.Arguments(),
+				Parameters:   provenanceParameters(r),
 				Environment:  envData,
 			},
-			BuildConfig: nil,
+			BuildConfig: provenanceBuildConfig(r),
 			Metadata: &v02.ProvenanceMetadata{
-				BuildInvocationID: "",
+				BuildInvocationID: fmt.Sprintf("%s/attempt-%d", r.ID(), r.Attempts),
 				BuildStartedOn:    &r.StartTime,
 				BuildFinishedOn:   &r.EndTime,
 				Completeness:      v02.ProvenanceComplete{},
@@ -291,32 +751,32 @@ func (dri *defaultRunImplementation) provenance(r *Run) (*intoto.ProvenanceState
 	}
 
 	if r.runner.Options().Source != "" && r.runner.Options().BuildPoint != "" {
+		// When built from a branch or tag, its name is recorded in the URI
+		uri := "git+" + r.runner.Options().Source
+		if r.BuildRef != "" {
+			uri += "@" + r.BuildRef
+		}
 		statement.Predicate.Materials = append(statement.Predicate.Materials, v02.ProvenanceMaterial{
-			URI: "git+" + r.runner.Options().Source,
+			URI: uri,
 			Digest: map[string]string{
 				"sha1": r.runner.Options().BuildPoint,
 			},
 		})
 	} else {
-		logrus.Warn("Source code and/or buildpint not set. Not adding to predicate materials")
+		r.logger().Warn("Source code and/or buildpint not set. Not adding to predicate materials")
 	}
 
 	for _, path := range r.opts.Artifacts.Files {
-		ch256, err := hash.SHA256ForFile(filepath.Join(r.runner.Options().Workdir, path))
+		digests, err := r.digestCache().fileDigests(filepath.Join(r.runner.Options().Workdir, path))
 		if err != nil {
-			return nil, errors.Wrap(err, "hashing expected artifacts to provenance subject")
-		}
-
-		ch512, err := hash.SHA512ForFile(filepath.Join(r.runner.Options().Workdir, path))
-		if err != nil {
-			return nil, errors.Wrap(err, "hashing expected artifacts to provenance subject")
+			return nil, fmt.Errorf("hashing expected artifacts to provenance subject: %w", err)
 		}
 
 		sub := intoto.Subject{
 			Name: path,
 			Digest: map[string]string{
-				"sha256": ch256,
-				"sha512": ch512,
+				"sha256": digests["sha256"],
+				"sha512": digests["sha512"],
 			},
 		}
 
@@ -325,14 +785,31 @@ func (dri *defaultRunImplementation) provenance(r *Run) (*intoto.ProvenanceState
 		)
 	}
 
+	// Images are attested by their digest, references without one
+	// cannot be recorded as subjects
+	for _, image := range r.opts.Artifacts.Images {
+		parts := strings.SplitN(image, "@", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "sha256:") {
+			r.logger().Warnf("Image %s is not pinned to a digest, not adding it to the provenance subjects", image)
+			continue
+		}
+		statement.StatementHeader.Subject = append(statement.StatementHeader.Subject, intoto.Subject{
+			Name:   parts[0],
+			Digest: map[string]string{"sha256": strings.TrimPrefix(parts[1], "sha256:")},
+		})
+	}
+
 	// Add the configuration file if we have one
 	if r.runner.Options().ConfigFile != "" {
 		statement.Predicate.Invocation.ConfigSource = v02.ConfigSource{
 			URI: strings.TrimPrefix(r.runner.Options().ConfigFile, r.runner.Options().Workdir),
 		}
 
-		// If the rundata has the git config point, record it
-		if r.runner.Options().ConfigPoint != "" {
+		// Configurations downloaded from a URL record their digest,
+		// otherwise if the rundata has the git config point, record it
+		if len(r.runner.Options().ConfigDigest) > 0 {
+			statement.Predicate.Invocation.ConfigSource.Digest = r.runner.Options().ConfigDigest
+		} else if r.runner.Options().ConfigPoint != "" {
 			statement.Predicate.Invocation.ConfigSource.Digest = map[string]string{
 				"sha1": r.runner.Options().ConfigPoint,
 			}
@@ -349,6 +826,25 @@ func (dri *defaultRunImplementation) provenance(r *Run) (*intoto.ProvenanceState
 		)
 	}
 
+	// The replaced files are built from their contents after the
+	// replacements, not the ones in the source commit
+	statement.Predicate.Materials = append(statement.Predicate.Materials, replacedMaterials(r.ReplacedFiles)...)
+
+	// Materials reported by the runner, eg container images
+	uris := []string{}
+	for uri := range r.runner.Options().Materials {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		statement.Predicate.Materials = append(statement.Predicate.Materials,
+			v02.ProvenanceMaterial{
+				URI:    uri,
+				Digest: r.runner.Options().Materials[uri],
+			},
+		)
+	}
+
 	return &statement, nil
 }
 
@@ -358,11 +854,11 @@ func (dri *defaultRunImplementation) writeProvenance(r *Run) error {
 	// Generate the attestation
 	statement, err := dri.provenance(r)
 	if err != nil {
-		return errors.Wrap(err, "generating provenance attestation")
+		return fmt.Errorf("generating provenance attestation: %w", err)
 	}
 	data, err := json.MarshalIndent(statement, "", "  ")
 	if err != nil {
-		logrus.Fatal(errors.Wrap(err, "marshalling provenance attestation"))
+		r.logger().Fatal(fmt.Errorf("marshalling provenance attestation: %w", err))
 	}
 
 	dir := os.TempDir()
@@ -373,10 +869,67 @@ func (dri *defaultRunImplementation) writeProvenance(r *Run) error {
 		dir, fmt.Sprintf("provenance-%d-%s.json", os.Getpid(), r.ID()),
 	)
 	if err := os.WriteFile(filename, data, os.FileMode(0o644)); err != nil {
-		return errors.Wrap(err, "writing provenance metadata to file")
+		return fmt.Errorf("writing provenance metadata to file: %w", err)
 	}
 	r.ProvenancePath = filename
-	logrus.Infof("Provenance metadata written to %s", filename)
+	r.logger().Infof("Provenance metadata written to %s", filename)
+	return nil
+}
+
+// cloneSource makes a shallow clone of the source repository at the
+// build point when the workdir does not exist or is empty. This lets
+// builds run from nothing but a configuration file and the source URL.
+func (dri *defaultRunImplementation) cloneSource(r *Run) error {
+	workdir := r.runner.Options().Workdir
+	if r.runner.Options().Source == "" || util.Exists(filepath.Join(workdir, ".git")) {
+		return nil
+	}
+	entries, err := os.ReadDir(workdir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading workdir: %w", err)
+	}
+	if len(entries) > 0 {
+		r.logger().Warnf("Not cloning source, workdir %s is not empty", workdir)
+		return nil
+	}
+	r.logger().Infof("Cloning %s into %s", r.runner.Options().Source, workdir)
+	ctx, cancel := r.gitContext()
+	defer cancel()
+	if _, err := git.New().ShallowCloneContext(
+		ctx, r.runner.Options().Source, workdir, r.opts.BuildPoint,
+	); err != nil {
+		return fmt.Errorf("cloning source repository: %w", err)
+	}
+	return nil
+}
+
+// resolveBuildPoint replaces the build point with the commit SHA it
+// points to. Branches, tags and remote refs not found in the workdir
+// repository are fetched from its default remote.
+func (dri *defaultRunImplementation) resolveBuildPoint(r *Run) error {
+	if r.opts.BuildPoint == "" {
+		return nil
+	}
+	if !util.Exists(filepath.Join(r.runner.Options().Workdir, ".git")) {
+		r.logger().Warnf("Not resolving build point %s, workdir is not a git repository", r.opts.BuildPoint)
+		return nil
+	}
+	repo, err := git.New().OpenRepo(r.runner.Options().Workdir)
+	if err != nil {
+		return fmt.Errorf("opening source repository: %w", err)
+	}
+	ctx, cancel := r.gitContext()
+	defer cancel()
+	sha, ref, err := repo.ResolveRefContext(ctx, r.opts.BuildPoint)
+	if err != nil {
+		return fmt.Errorf("resolving ref to a commit: %w", err)
+	}
+	if sha != r.opts.BuildPoint {
+		r.logger().Infof("Build point %s resolved to commit %s", r.opts.BuildPoint, sha)
+	}
+	r.BuildRef = ref
+	r.opts.BuildPoint = sha
+	r.runner.Options().BuildPoint = sha
 	return nil
 }
 
@@ -387,49 +940,55 @@ func (dri *defaultRunImplementation) checkoutBuildPoint(r *Run) error {
 		if util.Exists(filepath.Join(r.runner.Options().Workdir, ".git")) {
 			repo, err := git.New().OpenRepo(r.runner.Options().Workdir)
 			if err != nil {
-				return errors.Wrap(err, "opening source repository to check for source and buildporint")
+				return fmt.Errorf("opening source repository to check for source and buildporint: %w", err)
 			}
 			sourceURL, err := repo.MainRemoteURL()
 			if err != nil {
-				return errors.Wrap(err, "unable to determine source URL from local git repo")
+				return fmt.Errorf("unable to determine source URL from local git repo: %w", err)
 			}
 			r.runner.Options().Source = sourceURL
-			logrus.Infof("Source URL determined from WorkDir git repository: %s", sourceURL)
+			r.logger().Infof("Source URL determined from WorkDir git repository: %s", sourceURL)
 		} else {
-			logrus.Info("Not gettting build point, not working in a git repo")
+			r.logger().Info("Not gettting build point, not working in a git repo")
 		}
 	}
 
+	ctx, cancel := r.gitContext()
+	defer cancel()
+	repo := r.workdirRepository()
+
 	// If buildpoint is blank, we assume we are about to run the
 	// build at HEAD. Here, we get the HEAD commit sha to record
 	// it in the provenance attestation.
 	if r.runner.Options().BuildPoint == "" {
-		logrus.Info("BuildPoint not set, building at HEAD")
+		r.logger().Info("BuildPoint not set, building at HEAD")
 
 		// Get the current build point:
-		// TODO(puerco@): Move this code to the git package
-		output, err := command.NewWithWorkDir(
-			r.runner.Options().Workdir,
-			"git", "log", "--pretty=format:%H", "-n1",
-		).RunSilentSuccessOutput()
+		commitSha, _, err := repo.ResolveRefContext(ctx, "HEAD")
 		if err != nil {
-			return errors.Wrap(err, "getting HEAD commit for build point")
+			return fmt.Errorf("getting HEAD commit for build point: %w", err)
 		}
-		commitSha := output.OutputTrimNL()
 		r.runner.Options().BuildPoint = commitSha
 		r.opts.BuildPoint = commitSha
-		logrus.Infof("HEAD commit is %s", commitSha)
+		r.logger().Infof("HEAD commit is %s", commitSha)
 		return nil
 	}
 
+	// Record the current branch (or commit if HEAD is detached)
+	// to restore the repository after the run
+	commitSha, headRef, err := repo.ResolveRefContext(ctx, "HEAD")
+	if err != nil {
+		return fmt.Errorf("reading current commit: %w", err)
+	}
+	r.originalRef = commitSha
+	if strings.HasPrefix(headRef, "refs/heads/") {
+		r.originalRef = strings.TrimPrefix(headRef, "refs/heads/")
+	}
+
 	// Otherwise, we checkout the commit specified by BuildPoint
 	// to run the build at that point in the GIT history.
-	// Get the current build point:
-	if err := command.NewWithWorkDir(
-		r.runner.Options().Workdir,
-		"git", "checkout", r.runner.Options().BuildPoint,
-	).RunSilentSuccess(); err != nil {
-		return errors.Wrapf(err, "checking out build point (commit %s)", r.runner.Options().BuildPoint)
+	if err := repo.CheckoutContext(ctx, r.runner.Options().BuildPoint); err != nil {
+		return fmt.Errorf("checking out build point (commit %s): %w", r.runner.Options().BuildPoint, err)
 	}
 
 	return nil
@@ -438,44 +997,133 @@ func (dri *defaultRunImplementation) checkoutBuildPoint(r *Run) error {
 // sendTransfers copy the specified artifacts to their destinations
 func (dri *defaultRunImplementation) sendTransfers(r *Run) error {
 	if r.opts.Transfers == nil || len(r.opts.Transfers) == 0 {
-		logrus.Info("No artifact transfers defined in run")
+		r.logger().Info("No artifact transfers defined in run")
 		return nil
 	}
 
+	specs, err := dri.transferSpecs(r)
+	if err != nil {
+		return err
+	}
+
 	// Create a new object manager to transfer the artifacts
-	manager := object.NewManager()
+	manager := object.NewManagerWithOptions(&object.Options{
+		S3: &backends.S3Options{BucketRegions: transferRegions(r.opts.Transfers)},
+	})
+	if err := copyBatch(r.context(), manager, specs); err != nil {
+		return fmt.Errorf("processing transfers: %w", err)
+	}
+
+	for _, spec := range specs {
+		destURL, err := backends.ResolveDestination(spec.Source, spec.Destination)
+		if err != nil {
+			return fmt.Errorf("resolving transfer destination: %w", err)
+		}
+		r.Transferred = append(r.Transferred, destURL)
+		r.logger().WithFields(logrus.Fields{
+			LogFieldArtifact: spec.Source, "destination": destURL,
+		}).Info("Artifact transferred")
+		r.emit(EventTransferDone, fmt.Sprintf("Transferred %s to %s", spec.Source, destURL), map[string]string{
+			"source": spec.Source, "destination": destURL,
+		})
+	}
+	return nil
+}
+
+// transferSpecs returns the copies needed to send the run transfers
+func (dri *defaultRunImplementation) transferSpecs(r *Run) ([]object.CopySpec, error) {
+	specs := []object.CopySpec{}
 	for _, td := range r.opts.Transfers {
+		destURL, err := object.NormalizeURL(td.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("parsing transfer destination: %w", err)
+		}
+		if len(td.Source) > 1 && !backends.IsPrefixURL(destURL) {
+			return nil, fmt.Errorf(
+				"transfer of %d files to %s needs a prefix destination ending with a slash", len(td.Source), destURL,
+			)
+		}
 		for _, f := range td.Source {
 			rpath, err := filepath.Abs(filepath.Join(r.runner.Options().Workdir, f))
 			if err != nil {
-				return errors.Wrap(err, "resolving absolute path to artifact")
-			}
-			if err := manager.Copy(
-				"file:/"+rpath, td.Destination,
-			); err != nil {
-				return errors.Wrap(err, "processing transfer")
+				return nil, fmt.Errorf("resolving absolute path to artifact: %w", err)
 			}
+			specs = append(specs, object.CopySpec{Source: object.FileURL(rpath), Destination: destURL})
+		}
+	}
+	return specs, nil
+}
+
+// transferRegions returns the regions set in the transfers, keyed by the
+// bucket of their S3 destination
+func transferRegions(transfers []TransferConfig) map[string]string {
+	regions := map[string]string{}
+	for _, td := range transfers {
+		if td.Region == "" || !strings.HasPrefix(td.Destination, backends.URLPrefixS3) {
+			continue
+		}
+		if u, err := url.Parse(td.Destination); err == nil {
+			regions[u.Host] = td.Region
+		}
+	}
+	return regions
+}
+
+// checkDestinations checks that the artifacts, transfers and logs can be
+// written to their destinations, eg that there are S3 credentials
+func (r *Run) checkDestinations() error {
+	destinations := []string{}
+	if r.opts.Artifacts.Destination != "" && r.opts.Artifacts.Files != nil {
+		destinations = append(destinations, r.opts.Artifacts.Destination)
+	}
+	for _, td := range r.opts.Transfers {
+		destinations = append(destinations, td.Destination)
+	}
+	if r.opts.Log.Upload && r.opts.Log.Destination != "" {
+		destinations = append(destinations, r.opts.Log.Destination)
+	}
+	if len(destinations) == 0 {
+		return nil
+	}
+	manager := object.NewManagerWithOptions(&object.Options{
+		S3: &backends.S3Options{BucketRegions: transferRegions(r.opts.Transfers)},
+	})
+	for _, dest := range destinations {
+		if err := manager.CheckWrite(dest); err != nil {
+			return fmt.Errorf("checking artifact destination: %w", err)
 		}
 	}
 	return nil
 }
 
+func copyBatch(ctx context.Context, manager *object.Manager, specs []object.CopySpec) error {
+	err := manager.CopyBatchContext(ctx, specs).Err()
+	if err == nil {
+		return nil
+	}
+	var copyErr *object.CopyError
+	if errors.As(err, &copyErr) {
+		return &TransferFailedError{URL: copyErr.Spec.Destination, Err: copyErr}
+	}
+	return err
+}
+
 // downloadMaterials downloads the build materials
 func (dri *defaultRunImplementation) downloadMaterials(r *Run) error {
 	if r.opts.Materials == nil {
-		logrus.Info("no materials defined in the run")
+		r.logger().Info("no materials defined in the run")
 		return nil
 	}
 
 	if r.opts.MaterialsDir == "" {
 		materialsDir, err := os.MkdirTemp("", "materials-download-")
 		if err != nil {
-			return errors.Wrap(err, "creating materials directory")
+			return fmt.Errorf("creating materials directory: %w", err)
 		}
 		r.opts.MaterialsDir = materialsDir
 	}
 
-	logrus.Infof(
+	r.logger().Infof(
 		"Fetching %d artifacts from materials list to %s",
 		len(r.opts.Materials), r.opts.MaterialsDir,
 	)
@@ -493,193 +1141,284 @@ func (dri *defaultRunImplementation) downloadMaterials(r *Run) error {
 		}
 	}
 
-	manager := object.NewManager()
+	manager := r.materialsManager()
 
 	// TODO: Parallelize downloads
 	for i, m := range r.opts.Materials {
-		logrus.Infof("Downloading from %s", m.URI)
-		if err := manager.Copy(m.URI, "file:/"+r.opts.MaterialsDir); err != nil {
-			return errors.Wrap(err, "copying material")
+		if err := r.context().Err(); err != nil {
+			return fmt.Errorf("downloading materials: %w", err)
+		}
+		r.logger().Infof("Downloading from %s", m.URI)
+		// The trailing slash copies the material into its directory
+		dir := filepath.Join(r.opts.MaterialsDir, materialDir(m.URI))
+		if err := downloadMaterial(r, manager, m.URI, dir, r.opts.MaterialLimits[m.URI]); err != nil {
+			return err
+		}
+		if r.MaterialPaths == nil {
+			r.MaterialPaths = map[string]string{}
+		}
+		r.MaterialPaths[m.URI] = filepath.Join(materialDir(m.URI), backends.ObjectName(m.URI))
+
+		// Materials with a checksum file are verified against its digest
+		if _, ok := needHash[m.URI]; ok && m.Checksum != "" {
+			digestSet, err := manager.FetchChecksum(m.URI, m.Checksum)
+			if err != nil {
+				return fmt.Errorf("reading checksum of %s: %w", m.URI, err)
+			}
+			r.opts.Materials[i].Digest = digestSet
+			m.Digest = digestSet
+			delete(needHash, m.URI)
 		}
 
 		// Check if we need to fetch the latest hash from the material
 		if _, ok := needHash[m.URI]; ok {
 			digestSet, err := dri.getLatestMaterialHash(r, m.URI)
 			if err != nil {
-				return errors.Wrapf(err, "getting latest hash for %s", m.URI)
+				return fmt.Errorf("getting latest hash for %s: %w", m.URI, err)
 			}
-			logrus.Infof("Got latest hashes for material #%d: %+v", i, digestSet)
+			r.logger().Infof("Got latest hashes for material #%d: %+v", i, digestSet)
 			r.opts.Materials[i].Digest = digestSet
+			continue
+		}
+
+		if err := dri.verifyMaterialDigest(r, m.URI, m.Digest); err != nil {
+			return fmt.Errorf("verifying material #%d: %w", i, err)
+		}
+	}
+
+	return writeMaterialsManifest(r.opts.MaterialsDir, r.MaterialPaths)
+}
+
+// downloadMaterial copies a material into dir, within its time and size
+// limits
+func downloadMaterial(r *Run, manager *object.Manager, uri, dir string, limit MaterialLimit) (err error) {
+	ctx, span := trace.Start(r.context(), "build.material", trace.String("uri", uri))
+	defer func() { span.End(err) }()
+	if err := checkMaterialLimit(uri, limit); err != nil {
+		return fmt.Errorf("downloading %s: %w", uri, err)
+	}
+	timeout, maxSize := limit.Timeout, limit.MaxSize
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout))
+		defer cancel()
+	}
+	if maxSize > 0 {
+		ctx = backends.WithMaxSize(ctx, int64(maxSize))
+	}
+	if err := manager.CopyContext(ctx, uri, object.FileURL(dir)+"/"); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && r.context().Err() == nil {
+			return fmt.Errorf("copying material: download of %s timed out after %s: %w", uri, timeout, err)
+		}
+		if errors.Is(err, backends.ErrTooLarge) {
+			return fmt.Errorf("copying material: %s is larger than its %s limit: %w", uri, maxSize, err)
+		}
+		return fmt.Errorf("copying material: %w", err)
+	}
+	return nil
+}
+
+// materialsManager returns an object manager that sends the headers
+// defined for each material when downloading it over HTTP
+func (r *Run) materialsManager() *object.Manager {
+	headers := map[string]map[string]string{}
+	if r.opts != nil {
+		for _, m := range r.opts.Materials {
+			if len(m.Headers) > 0 {
+				headers[m.URI] = m.Headers
+			}
 		}
 	}
+	return object.NewManagerWithOptions(&object.Options{
+		HTTP: &backends.HTTPOptions{Headers: headers},
+	})
+}
 
+// verifyMaterialDigest checks a downloaded material file against the
+// digests defined in its configuration. Materials which are not
+// downloaded as a single file (eg git clones, unlike git archives) are
+// not checked.
+func (dri *defaultRunImplementation) verifyMaterialDigest(r *Run, uri string, digest map[string]string) error {
+	path := filepath.Join(r.opts.MaterialsDir, materialDir(uri), backends.ObjectName(uri))
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		r.logger().Debugf("Material %s is not a regular file, not verifying its digest", uri)
+		return nil
+	}
+
+	digestSet, err := r.digestCache().fileDigests(path)
+	if err != nil {
+		return fmt.Errorf("hashing downloaded material: %w", err)
+	}
+	for algo, expected := range digest {
+		actual, ok := digestSet[algo]
+		if !ok {
+			continue
+		}
+		if actual != expected {
+			return &MaterialDigestMismatchError{
+				URI: uri, Algorithm: algo, Expected: expected, Actual: actual,
+			}
+		}
+	}
 	return nil
 }
 
 func (dri *defaultRunImplementation) stagingURL(r *Run) (string, error) {
+	return dri.stagedURL(r, r.opts.Artifacts.Destination)
+}
+
+// stagedURL returns the URL where the run stores its files under
+// targetURL: the staging path is appended to it or replaces the
+// ${MMBUILD_STAGEPATH} variable in it. It is empty if targetURL is.
+func (dri *defaultRunImplementation) stagedURL(r *Run, targetURL string) (string, error) {
+	if targetURL == "" {
+		return "", nil
+	}
 	stagingPath, err := dri.stagingPath(r)
 	if err != nil {
-		return "", errors.Wrap(err, "getting staging directory")
+		return "", fmt.Errorf("getting staging directory: %w", err)
 	}
-
-	// Determine the artifacts detination
-	targetURL := r.opts.Artifacts.Destination
 	if strings.Contains(targetURL, "${MMBUILD_STAGEPATH}") {
-		targetURL = strings.ReplaceAll(targetURL, "${MMBUILD_STAGEPATH}", stagingPath)
-	} else {
-		targetURL = targetURL + string(filepath.Separator) + stagingPath
+		return object.NormalizeURL(strings.ReplaceAll(targetURL, "${MMBUILD_STAGEPATH}", stagingPath))
 	}
-	return targetURL, nil
+	return object.JoinURL(targetURL, stagingPath)
 }
 
 // storeArtifacts stores the builds artifacts into the expected bucket
 func (dri *defaultRunImplementation) storeArtifacts(r *Run) error {
 	if r.opts.Artifacts.Destination == "" {
-		logrus.Info("No artifacts store defined. Not copying")
+		r.logger().Info("No artifacts store defined. Not copying")
 		return nil
 	}
 
 	if r.opts.Artifacts.Files == nil {
-		logrus.Info("No artifacts expected, not copying to store")
+		r.logger().Info("No artifacts expected, not copying to store")
 		return nil
 	}
 
 	targetURL, err := dri.stagingURL(r)
 	if err != nil {
-		return errors.Wrap(err, "getting staging url")
+		return fmt.Errorf("getting staging url: %w", err)
 	}
 
 	// Create an object manager to copy the files
 	manager := object.NewManager()
-
-	// TODO(@puerco): This should be parallelized in the object manager
+	specs := []object.CopySpec{}
 	for _, fname := range r.opts.Artifacts.Files {
 		rpath, err := filepath.Abs(filepath.Join(r.runner.Options().Workdir, fname))
 		if err != nil {
-			return errors.Wrap(err, "resolving artifact path")
+			return fmt.Errorf("resolving artifact path: %w", err)
 		}
 		// Copy the file to the artifact destination
-		if err := manager.Copy(
-			"file:/"+rpath,
-			targetURL+string(filepath.Separator)+fname,
-		); err != nil {
-			return errors.Wrapf(
-				err, "copying %s to %s",
-				fname, targetURL,
-			)
+		destURL, err := object.JoinURL(targetURL, fname)
+		if err != nil {
+			return fmt.Errorf("building artifact URL: %w", err)
 		}
+		specs = append(specs, object.CopySpec{Source: object.FileURL(rpath), Destination: destURL})
 	}
 
-	return errors.Wrap(
-		manager.Copy(
-			"file:/"+r.ProvenancePath,
-			targetURL+string(filepath.Separator)+ProvenanceFilename,
-		),
-		"copying provenance metadata to artifact destination",
-	)
+	// Test and coverage reports are stored next to the artifacts
+	reports := map[string][]string{"tests": r.TestReports, "coverage": r.CoverageReports}
+	for _, dir := range []string{"tests", "coverage"} {
+		for _, fname := range reports[dir] {
+			rpath, err := filepath.Abs(filepath.Join(r.runner.Options().Workdir, fname))
+			if err != nil {
+				return fmt.Errorf("resolving report path: %w", err)
+			}
+			destURL, err := object.JoinURL(targetURL, dir, fname)
+			if err != nil {
+				return fmt.Errorf("building report URL: %w", err)
+			}
+			specs = append(specs, object.CopySpec{Source: object.FileURL(rpath), Destination: destURL})
+		}
+	}
+
+	if err := copyBatch(r.context(), manager, specs); err != nil {
+		return fmt.Errorf("copying artifacts to %s: %w", targetURL, err)
+	}
+	for _, fname := range r.opts.Artifacts.Files {
+		r.logger().WithFields(logrus.Fields{
+			LogFieldArtifact: fname, "destination": targetURL,
+		}).Info("Artifact stored")
+	}
+
+	if err := r.uploadLog(manager, targetURL); err != nil {
+		return fmt.Errorf("copying run log to artifact destination: %w", err)
+	}
+
+	// The provenance is copied last, its presence marks the artifacts
+	// as stored for the existence checks
+	provenanceURL, err := object.JoinURL(targetURL, ProvenanceFilename)
+	if err != nil {
+		return fmt.Errorf("building provenance URL: %w", err)
+	}
+	if err := manager.Copy(object.FileURL(r.ProvenancePath), provenanceURL); err != nil {
+		return fmt.Errorf(
+			"copying provenance metadata to artifact destination: %w", &TransferFailedError{URL: provenanceURL, Err: err},
+		)
+	}
+	return nil
 }
 
 // artifactsExist checks if the provenance file exists in the bucket
 func (dri *defaultRunImplementation) artifactsExist(r *Run) (exists *bool, err error) {
-	stageURL, err := dri.stagingURL(r)
-	if err != nil {
-		return nil, errors.Wrap(err, "getting staging URL")
+	var checker ExistenceChecker = &ProvenanceExistenceCheck{}
+	if r.opts.ExistenceCheck != nil {
+		checker = r.opts.ExistenceCheck
 	}
-	manager := object.NewManager()
-	e, err := manager.PathExists(stageURL + string(filepath.Separator) + ProvenanceFilename)
+	e, err := checker.ArtifactsExist(r)
 	if err != nil {
-		return exists, errors.Wrap(err, "checking if artifacts exist")
+		return exists, fmt.Errorf("checking if artifacts exist: %w", err)
 	}
-	logrus.Infof("Manager returned %v when checking if artifacts exist", e)
+	r.logger().Infof("Existence check returned %v when checking if artifacts exist", e)
 	return &e, nil
 }
 
 // stagingPath returns a predictable path for the run where the run
-// can stage its artifacts. These paths can be recomputed based on
-// the build materials.
-//
-// Note that this hash is intended only for the staging directories
-// where the build system stores its artifacts. They are not intended
-// for human use.
+// can stage its artifacts, computed with StagingPath.
 func (dri *defaultRunImplementation) stagingPath(r *Run) (string, error) {
-	if r.opts.BuildPoint == "" && r.opts.Materials == nil {
-		return "", errors.New("unable to produce satging path without buildpoint or artifacts")
-	}
-	if r.opts.BuildPoint == "" && len(r.opts.Materials) == 0 {
-		return "", errors.New("unable to produce satging path without buildpoint or artifacts")
-	}
-
-	// The algorithm to determine the staging path is:
-	// 1. Sort the materials by URI
-	// 2. Concat: buildpoint + (materials.URL[n]+materials.Sha[n])
-	// 2a: Sha should be the first sha found using: this order: sha1 sha256 sha512 (else fail)
-	// 3. Hash the whole string sha256
-
-	str := r.opts.BuildPoint
-	list := []string{}
-	arts := map[string]string{}
-	// Cycle the shas and pickup the first hash defined according
-	// to the criteria above
-	if r.opts.Materials != nil {
-		for _, m := range r.opts.Materials {
-			list = append(list, m.URI)
-			arts[m.URI] = ""
-			for _, algo := range []string{"sha1", "sha256", "sha512"} {
-				if v, ok := m.Digest[algo]; ok {
-					arts[m.URI] = v
-					break
-				}
-			}
-			if arts[m.URI] == "" {
-				return "", errors.Errorf("unable to locate sha for %s in materials config", m.URI)
-			}
-		}
-	}
-
-	// Sort the URIs to make the list predictable
-	sort.Strings(list)
-
-	// Concat the strings and hashes
-	for _, u := range list {
-		str += u + arts[u]
-	}
-
-	// Hash the string
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(str))), nil
+	return StagingPath(r.opts.BuildPoint, r.opts.Materials)
 }
 
 func (dri *defaultRunImplementation) getLatestMaterialHash(r *Run, url string) (map[string]string, error) {
-	return object.NewManager().GetObjectHash(url)
+	return r.digestCache().objectHash(url)
 }
 
 // writeDotEnvArtifact writes some metadata generated during the run
-// to a dotenv artifact to consume it in later steps as gitlab variables
+// to a dotenv artifact to consume it in later steps as gitlab variables.
+// The file is written in the working directory of the run.
 func (dri *defaultRunImplementation) writeDotEnvArtifact(r *Run) error {
 	// We will store the staging path, get it:
 	spath, err := dri.stagingPath(r)
 	if err != nil {
-		return errors.Wrap(err, "reading run staging path")
+		return fmt.Errorf("reading run staging path: %w", err)
 	}
 
 	surl, err := dri.stagingURL(r)
 	if err != nil {
-		return errors.Wrap(err, "getting staging url")
+		return fmt.Errorf("getting staging url: %w", err)
 	}
 
 	// These are the vars we write now:
 	dotenv := fmt.Sprintf("MMBUILD_STAGING_PATH=%s\n", spath)
 	dotenv += fmt.Sprintf("MMBUILD_STAGING_URL=%s\n", surl)
+	if r.Coverage != nil {
+		dotenv += fmt.Sprintf("MMBUILD_COVERAGE=%.1f\n", r.Coverage.Percent())
+	}
 
-	return errors.Wrap(
-		os.WriteFile(DotEnvFilename, []byte(dotenv), os.FileMode(0o644)),
-		"writing dotenv report file",
-	)
+	path := filepath.Join(r.runner.Options().Workdir, DotEnvFilename)
+	if err := os.WriteFile(path, []byte(dotenv), os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing dotenv report file: %w", err)
+	}
+	r.DotEnvPath = path
+	return nil
 }
 
 // generateSBOM writes a SPDX sbom describing the artifacts produced by the run
 func (dri *defaultRunImplementation) generateSBOM(r *Run) error {
 	if !r.opts.SBOM {
-		logrus.Info("No SBOM requested, skipping")
+		r.logger().Info("No SBOM requested, skipping")
+		return nil
 	}
 	docbuilder := spdx.NewDocBuilder()
 	builderOpts := &spdx.DocGenerateOptions{
@@ -693,7 +1432,7 @@ func (dri *defaultRunImplementation) generateSBOM(r *Run) error {
 	// Create the document:
 	doc, err := docbuilder.Generate(builderOpts)
 	if err != nil {
-		return errors.Wrap(err, "generating initial SBOM")
+		return fmt.Errorf("generating initial SBOM: %w", err)
 	}
 
 	// List all artifacts and add them
@@ -702,12 +1441,12 @@ func (dri *defaultRunImplementation) generateSBOM(r *Run) error {
 	for _, path := range r.opts.Artifacts.Files {
 		spdxFile, err := spdxClient.FileFromPath(filepath.Join(r.runner.Options().Workdir, path))
 		if err != nil {
-			return errors.Wrapf(err, "adding %s to SBOM", path)
+			return fmt.Errorf("adding %s to SBOM: %w", path, err)
 		}
 		spdxFile.Name = path
 		spdxFile.BuildID() // Manual, for now
 		if err := doc.AddFile(spdxFile); err != nil {
-			return errors.Wrapf(err, "adding file %s to sbom", path)
+			return fmt.Errorf("adding file %s to sbom: %w", path, err)
 		}
 	}
 
@@ -715,35 +1454,43 @@ func (dri *defaultRunImplementation) generateSBOM(r *Run) error {
 
 	// Write the sbom in the artifacts dir
 	if err := doc.Write(sbomPath); err != nil {
-		return errors.Wrap(err, "writing sbom to disk")
+		return fmt.Errorf("writing sbom to disk: %w", err)
 	}
 
 	// Add the sbom to the build artifacts
 	r.opts.Artifacts.Files = append(r.opts.Artifacts.Files, sbomPath)
-	logrus.Infof("SPDX SBOM written to %s", sbomPath)
+	r.logger().Infof("SPDX SBOM written to %s", sbomPath)
 	return nil
 }
 
 // getMissingMaterialHashes checks the materials list
 func (dri *defaultRunImplementation) getMissingMaterialHashes(r *Run) error {
-	manager := object.NewManager()
 	for i := range r.opts.Materials {
 		if len(r.opts.Materials[i].Digest) > 0 {
 			continue
 		}
-		logrus.Infof(
+		// Upstream publishes the digest in a checksum file
+		if r.opts.Materials[i].Checksum != "" {
+			hashes, err := r.materialsManager().FetchChecksum(r.opts.Materials[i].URI, r.opts.Materials[i].Checksum)
+			if err != nil {
+				return fmt.Errorf("reading checksum of %s: %w", r.opts.Materials[i].URI, err)
+			}
+			r.opts.Materials[i].Digest = hashes
+			r.logger().Infof("%s digest read from %s", r.opts.Materials[i].URI, r.opts.Materials[i].Checksum)
+			continue
+		}
+		r.logger().Infof(
 			"Material %s has missing hashes. Checksumming.",
 			r.opts.Materials[i].URI,
 		)
-		hashes, err := manager.GetObjectHash(r.opts.Materials[i].URI)
+		hashes, err := r.digestCache().objectHash(r.opts.Materials[i].URI)
 		if err != nil {
-			return errors.Wrapf(
-				err, "getting hashes for %s",
-				r.opts.Materials[i].URI,
+			return fmt.Errorf(
+				"getting hashes for %s: %w", r.opts.Materials[i].URI, err,
 			)
 		}
 		r.opts.Materials[i].Digest = hashes
-		logrus.Infof(
+		r.logger().Infof(
 			"%s hashed at %+v",
 			r.opts.Materials[i].URI,
 			r.opts.Materials[i].Digest,
@@ -751,3 +1498,50 @@ func (dri *defaultRunImplementation) getMissingMaterialHashes(r *Run) error {
 	}
 	return nil
 }
+
+// replacedMaterials returns a provenance material for each file modified
+// by the replacements, with the digest of its final contents
+func replacedMaterials(changes []replacement.Change) []v02.ProvenanceMaterial {
+	materials := []v02.ProvenanceMaterial{}
+	index := map[string]int{}
+	for _, c := range changes {
+		if i, ok := index[c.Path]; ok {
+			materials[i].Digest["sha256"] = c.After
+			continue
+		}
+		index[c.Path] = len(materials)
+		materials = append(materials, v02.ProvenanceMaterial{
+			URI:    "file:" + c.Path,
+			Digest: map[string]string{"sha256": c.After},
+		})
+	}
+	return materials
+}
+
+// provenanceBuildConfig returns the build config recorded in the
+// provenance: the changes of the replacements, so verifiers can check the
+// source mutations the build performed, the uploaded runner logs, where
+// each material was staged and the annotations of the run. It is nil if
+// there are none.
+func provenanceBuildConfig(r *Run) interface{} {
+	config := map[string]interface{}{}
+	if len(r.ReplacedFiles) > 0 {
+		config["replacements"] = r.ReplacedFiles
+	}
+	if len(r.UploadedLogs) > 0 {
+		config["logs"] = r.UploadedLogs
+	}
+	if len(r.MaterialPaths) > 0 {
+		config["materialPaths"] = r.MaterialPaths
+	}
+	if len(r.opts.Annotations) > 0 {
+		config["annotations"] = r.opts.Annotations
+	}
+	if r.Signer != nil {
+		config["signing"] = map[string]interface{}{"signer": r.Signer, "signatures": r.Signatures}
+	}
+	if len(config) == 0 {
+		return nil
+	}
+	return config
+}
@@ -4,12 +4,48 @@
 package build
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/mattermost/cicd-sdk/pkg/replacement"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/release-utils/command"
 )
 
+// newTestRepo creates a git repository with files committed on main and
+// returns its directory and the commit sha
+func newTestRepo(t *testing.T, files map[string]string) (workdir, head string) {
+	workdir = t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(workdir, name), []byte(content), os.FileMode(0o644)))
+	}
+	for _, args := range [][]string{
+		{"init", "--initial-branch=main"},
+		{"config", "user.email", "user@example.com"},
+		{"config", "user.name", "Example User"},
+		{"add", "-A"},
+		{"commit", "--allow-empty", "-m", "First commit"},
+	} {
+		runTestGit(t, workdir, args...)
+	}
+	return workdir, runTestGit(t, workdir, "rev-parse", "HEAD")
+}
+
+// runTestGit runs a git command in dir and returns its output
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	output, err := command.NewWithWorkDir(dir, "git", args...).RunSilentSuccessOutput()
+	require.NoError(t, err)
+	return output.OutputTrimNL()
+}
+
 // TestStagingPath checks the hashing function to generate a path
 func TestStagingPath(t *testing.T) {
 	r := &Run{
@@ -102,17 +138,414 @@ MMBUILD_STAGING_URL=s3://sample-bucket/test-directory/9241fbc43a90babf28912d4662
 		},
 	}
 
-	d, err := os.MkdirTemp("", "temp-dotenv-")
-	require.NoError(t, err)
-	defer os.RemoveAll(d)
-	curDir, err := os.Getwd()
-	require.NoError(t, err)
-	require.NoError(t, os.Chdir(d))
-	defer require.NoError(t, os.Chdir(curDir))
+	// The file is written in the working directory of the run
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	r.runner = runners.NewMake()
+	r.runner.Options().Workdir = t.TempDir()
 
 	require.NoError(t, ri.writeDotEnvArtifact(r))
-	require.FileExists(t, DotEnvFilename)
-	data, err := os.ReadFile(DotEnvFilename)
+	require.Equal(t, filepath.Join(r.runner.Options().Workdir, DotEnvFilename), r.DotEnvPath)
+	data, err := os.ReadFile(r.DotEnvPath)
 	require.NoError(t, err)
 	require.Equal(t, string(data), sampleFile)
 }
+
+func TestRunWithRetries(t *testing.T) {
+	dir, err := os.MkdirTemp("", "run-retries-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// This target fails the first time it runs and succeeds after
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: flaky\nflaky:\n\ttest -f marker || (touch marker && exit 1)\n"),
+		os.FileMode(0o644)),
+	)
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	runner := runners.NewMake("flaky")
+	runner.Options().Workdir = dir
+
+	// Without retries, the run fails
+	r := &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts:   &RunOptions{},
+	}
+	require.Error(t, r.runWithRetries())
+	require.Equal(t, 1, r.Attempts)
+	defer os.Remove(r.Logs[0])
+	require.NoError(t, os.Remove(filepath.Join(dir, "marker")))
+
+	// With a retry, the second attempt succeeds
+	r = &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts:   &RunOptions{RetryCount: 2, RetryBackoff: 10 * time.Millisecond},
+	}
+	require.NoError(t, r.runWithRetries())
+	require.Equal(t, 2, r.Attempts)
+	require.Len(t, r.Logs, 2)
+	for _, l := range r.Logs {
+		require.FileExists(t, l)
+		defer os.Remove(l)
+	}
+	require.NotEqual(t, r.Logs[0], r.Logs[1])
+
+	statement, err := r.impl.provenance(r)
+	require.NoError(t, err)
+	require.Equal(t, "make-0000/attempt-2", statement.Predicate.Metadata.BuildInvocationID)
+
+	// Negative retry counts still execute the runner once, and the
+	// runs reject them before doing any work
+	r = &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts:   &RunOptions{RetryCount: -1},
+	}
+	require.NoError(t, r.runWithRetries())
+	require.Equal(t, 1, r.Attempts)
+	defer os.Remove(r.Logs[0])
+	r = NewRun(runner)
+	r.opts = &RunOptions{RetryCount: -1}
+	err = r.Execute()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "retry count")
+}
+
+func TestRunWithRetriesCanceled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "run-canceled-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: slow\nslow:\n\tsleep 30\n"),
+		os.FileMode(0o644)),
+	)
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := runners.NewMake("slow")
+	runner.Options().Workdir = dir
+	runner.Options().Context = ctx
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// Cancelling kills the runner and the run is not retried
+	r := &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts:   &RunOptions{RetryCount: 2, RetryBackoff: 10 * time.Millisecond},
+		ctx:    ctx,
+	}
+	start := time.Now()
+	err = r.runWithRetries()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.Equal(t, 1, r.Attempts)
+	for _, l := range r.Logs {
+		defer os.Remove(l)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	dir := t.TempDir()
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	runner := runners.NewMake()
+	runner.Options().Workdir = dir
+	r := &Run{
+		impl:   &defaultRunImplementation{},
+		runner: runner,
+		opts: &RunOptions{
+			MaterialsDir: dir,
+			Artifacts:    ArtifactsConfig{Files: []string{"missing.tar.gz"}},
+		},
+	}
+	ri := defaultRunImplementation{}
+
+	// Missing artifacts
+	err := ri.checkExpectedArtifacts(r)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrArtifactMissing))
+	var missingErr *ArtifactMissingError
+	require.True(t, errors.As(err, &missingErr))
+	require.Equal(t, "missing.tar.gz", missingErr.Path)
+
+	// Material digests
+	uri := "http://example.com/repo/go.mod"
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, materialDir(uri)), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, materialDir(uri), "go.mod"), []byte("module test\n"), os.FileMode(0o644)))
+	require.NoError(t, ri.verifyMaterialDigest(r, uri, map[string]string{
+		"sha1": "65fab8adff58cf088cf815312999ac04c95b68d6",
+	}))
+	err = ri.verifyMaterialDigest(r, uri, map[string]string{"sha1": "61a7663a7c0f46ab149ec2cadd44fc3cc30f9403"})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrMaterialDigestMismatch))
+	var digestErr *MaterialDigestMismatchError
+	require.True(t, errors.As(err, &digestErr))
+	require.Equal(t, uri, digestErr.URI)
+	require.Equal(t, "sha1", digestErr.Algorithm)
+
+	// Materials not downloaded as files are not verified
+	require.NoError(t, ri.verifyMaterialDigest(r, "git+https://github.com/mattermost/cicd-sdk", map[string]string{
+		"sha1": "61a7663a7c0f46ab149ec2cadd44fc3cc30f9403",
+	}))
+
+	// Transfer errors wrap the backend error
+	backendErr := errors.New("access denied")
+	err = fmt.Errorf("processing transfer: %w", &TransferFailedError{URL: "s3://bucket/file", Err: backendErr})
+	require.True(t, errors.Is(err, ErrTransferFailed))
+	require.True(t, errors.Is(err, backendErr))
+	var transferErr *TransferFailedError
+	require.True(t, errors.As(err, &transferErr))
+	require.Equal(t, "s3://bucket/file", transferErr.URL)
+
+	// Failed copies of a batch are transfer errors
+	dir = t.TempDir()
+	err = copyBatch(context.Background(), object.NewManager(), []object.CopySpec{
+		{Source: "file://" + filepath.Join(dir, "missing"), Destination: "file://" + filepath.Join(dir, "copy")},
+	})
+	require.True(t, errors.As(err, &transferErr))
+	require.Equal(t, "file://"+filepath.Join(dir, "copy"), transferErr.URL)
+}
+
+func TestRestoreCheckout(t *testing.T) {
+	dir, first := newTestRepo(t, nil)
+	runTestGit(t, dir, "commit", "--allow-empty", "-m", "Second commit")
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().Workdir = dir
+	runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+	runner.Options().BuildPoint = first
+
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{}}
+	ri := defaultRunImplementation{}
+	currentRef := func() string {
+		o, err := command.NewWithWorkDir(dir, "git", "rev-parse", "--abbrev-ref", "HEAD").RunSilentSuccessOutput()
+		require.NoError(t, err)
+		return o.OutputTrimNL()
+	}
+
+	// Checking out the build point detaches HEAD
+	require.NoError(t, ri.checkoutBuildPoint(r))
+	require.Equal(t, "HEAD", currentRef())
+	require.Equal(t, "main", r.originalRef)
+
+	// Restoring returns the repo to the branch
+	require.NoError(t, ri.restoreCheckout(r))
+	require.Equal(t, "main", currentRef())
+	require.Empty(t, r.originalRef)
+}
+
+func TestResolveBuildPoint(t *testing.T) {
+	dir, tagged := newTestRepo(t, nil)
+	runTestGit(t, dir, "tag", "v0.1.0")
+	runTestGit(t, dir, "commit", "--allow-empty", "-m", "Second commit")
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().Workdir = dir
+	runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{BuildPoint: "v0.1.0"}}
+	ri := defaultRunImplementation{}
+	require.NoError(t, ri.resolveBuildPoint(r))
+	require.Equal(t, tagged, r.opts.BuildPoint)
+	require.Equal(t, tagged, runner.Options().BuildPoint)
+	require.Equal(t, "refs/tags/v0.1.0", r.BuildRef)
+
+	// The ref is recorded in the source material
+	statement, err := ri.provenance(r)
+	require.NoError(t, err)
+	require.Equal(t, "git+https://github.com/mattermost/cicd-sdk@refs/tags/v0.1.0", statement.Predicate.Materials[0].URI)
+	require.Equal(t, tagged, statement.Predicate.Materials[0].Digest["sha1"])
+
+	// Git operations are stopped when the run deadline has passed
+	r = &Run{
+		impl: &defaultRunImplementation{}, runner: runner, StartTime: time.Now().Add(-time.Minute),
+		opts: &RunOptions{BuildPoint: "v0.1.0", Timeout: time.Second},
+	}
+	err = ri.resolveBuildPoint(r)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestProvenanceEnvironment(t *testing.T) {
+	t.Setenv("MMTEST_HOST_VAR", "host")
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().EnvVars = map[string]string{"GOOS": "linux", "PWD": "/tmp", "MMBUILD_MATERIALS_DIR": "/tmp"}
+
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{}}
+	ri := defaultRunImplementation{}
+
+	// By default only the build variables are recorded
+	statement, err := ri.provenance(r)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"GOOS": "linux"}, statement.Predicate.Invocation.Environment)
+
+	// In a clean environment, the effective environment is recorded
+	runner.Options().CleanEnv = true
+	runner.Options().EnvAllowlist = []string{"MMTEST_HOST_VAR"}
+	statement, err = ri.provenance(r)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"GOOS": "linux", "MMTEST_HOST_VAR": "host",
+	}, statement.Predicate.Invocation.Environment)
+}
+
+func TestProvenanceReplacements(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "version.go"), []byte("%MAJOR%.%MINOR%\n"), os.FileMode(0o644)))
+	runner := runners.NewMake()
+	runner.Options().Replacements = []replacement.Replacement{
+		{Tag: "%MAJOR%", Value: "7", Paths: []string{"version.go"}, Workdir: dir},
+		{Tag: "%MINOR%", Value: "1", Paths: []string{"version.go", "missing.go"}, Workdir: dir},
+	}
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{}}
+	ri := defaultRunImplementation{}
+
+	// Without replacements, there is no build config
+	statement, err := ri.provenance(r)
+	require.NoError(t, err)
+	require.Nil(t, statement.Predicate.BuildConfig)
+
+	// Each change is recorded with the digests of the file
+	changes, err := ri.processReplacements(runner.Options())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, changes[0].After, changes[1].Before)
+	r.ReplacedFiles = changes
+	statement, err = ri.provenance(r)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"replacements": changes}, statement.Predicate.BuildConfig)
+
+	// The replaced file is a material with its final digest
+	digests, err := r.digestCache().fileDigests(filepath.Join(dir, "version.go"))
+	require.NoError(t, err)
+	require.Len(t, statement.Predicate.Materials, 1)
+	require.Equal(t, "file:version.go", statement.Predicate.Materials[0].URI)
+	require.Equal(t, digests["sha256"], statement.Predicate.Materials[0].Digest["sha256"])
+}
+
+func TestProvenanceAnnotations(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	dir := t.TempDir()
+	conf := filepath.Join(dir, ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+env:
+  - var: PIPELINE_ID
+    value: "4821"
+annotations:
+  ticket: MM-1234
+  releaseTrain: "7.1"
+  pipeline: https://ci.example.com/pipelines/${PIPELINE_ID}
+`), os.FileMode(0o644)))
+
+	// Annotations are loaded with the config variables replaced
+	b, err := NewFromConfigFile(conf)
+	require.NoError(t, err)
+	b.Options().Workdir = dir
+	expected := map[string]string{
+		"ticket": "MM-1234", "releaseTrain": "7.1", "pipeline": "https://ci.example.com/pipelines/4821",
+	}
+	r := b.Run()
+	require.Equal(t, expected, r.Options().Annotations)
+
+	// They are recorded in the provenance build config
+	r.setRunnerOptions()
+	statement, err := r.Provenance()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"annotations": expected}, statement.Predicate.BuildConfig)
+
+	// And in the run result
+	r.isSuccess = &RUNSUCCESS
+	require.Equal(t, expected, r.Result().Annotations)
+}
+
+func TestCloneSource(t *testing.T) {
+	remote, tagged := newTestRepo(t, nil)
+	runTestGit(t, remote, "tag", "v0.1.0")
+	runTestGit(t, remote, "commit", "--allow-empty", "-m", "Second commit")
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().Workdir = filepath.Join(t.TempDir(), "src")
+	runner.Options().Source = "file://" + remote
+
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{BuildPoint: "v0.1.0"}}
+	ri := defaultRunImplementation{}
+	require.NoError(t, ri.cloneSource(r))
+	require.NoError(t, ri.resolveBuildPoint(r))
+	require.Equal(t, tagged, r.opts.BuildPoint)
+	require.Equal(t, tagged, runTestGit(t, runner.Options().Workdir, "rev-parse", "HEAD"))
+
+	// Workdirs with files are not cloned into
+	runner.Options().Workdir = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(runner.Options().Workdir, "README"), []byte("hi"), os.FileMode(0o644)))
+	require.NoError(t, ri.cloneSource(r))
+	require.NoDirExists(t, filepath.Join(runner.Options().Workdir, ".git"))
+}
+
+func TestProvenanceImageSubjects(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().ExpectedImages = []string{
+		"ghcr.io/mattermost/app@sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+	}
+
+	r := &Run{impl: &defaultRunImplementation{}, runner: runner, opts: &RunOptions{
+		Artifacts: ArtifactsConfig{Images: []string{"ghcr.io/mattermost/app:latest"}},
+	}}
+	ri := defaultRunImplementation{}
+	require.NoError(t, ri.checkExpectedArtifacts(r))
+	require.Len(t, r.opts.Artifacts.Images, 2)
+
+	// Only the image pinned to a digest is attested
+	statement, err := ri.provenance(r)
+	require.NoError(t, err)
+	require.Len(t, statement.Subject, 1)
+	require.Equal(t, "ghcr.io/mattermost/app", statement.Subject[0].Name)
+	require.Equal(t, "6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b", statement.Subject[0].Digest["sha256"])
+}
+
+func TestTransferRegions(t *testing.T) {
+	require.Equal(t, map[string]string{"releases-eu": "eu-west-1"}, transferRegions([]TransferConfig{
+		{Destination: "s3://releases-eu/server/", Region: "eu-west-1"},
+		{Destination: "s3://releases/server/"},
+		{Destination: "file:///tmp/server/", Region: "us-east-1"},
+	}))
+}
+
+func TestCheckDestinations(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	r := &Run{opts: &RunOptions{
+		Artifacts: ArtifactsConfig{Destination: "file:///tmp/artifacts/", Files: []string{"app.bin"}},
+	}}
+	require.NoError(t, r.checkDestinations())
+	r.opts.Transfers = []TransferConfig{{Source: []string{"app.bin"}, Destination: "s3://releases/"}}
+	require.ErrorIs(t, r.checkDestinations(), backends.ErrNoCredentials)
+}
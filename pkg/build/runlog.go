@@ -0,0 +1,485 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/sirupsen/logrus"
+)
+
+// RunLogFilename is the name of the run log stored with the artifacts
+const RunLogFilename = "run-log.jsonl"
+
+// Streams of the log entries
+const (
+	LogStreamStdout = "stdout" // Output of the runner
+	LogStreamStderr = "stderr" // Error output of the runner
+	LogStreamBuild  = "build"  // Messages of the builder, like the run events
+)
+
+// LogEntry is a line of the run log
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Attempt int       `json:"attempt,omitempty"` // Runner attempt, zero before the runner starts
+	Stream  string    `json:"stream"`
+	Line    string    `json:"line"`
+}
+
+// LogObject is a runner log copied to the object store. The provenance
+// of the run links it with its digest.
+type LogObject struct {
+	Attempt int               `json:"attempt"`
+	Stream  string            `json:"stream"` // LogStreamStdout or LogStreamStderr
+	URI     string            `json:"uri"`
+	Digest  map[string]string `json:"digest"`
+}
+
+// RunLog is the persistent log of a run. It records the runner output and
+// the run events as JSON lines in its directory, rotating the files when
+// they reach the maximum size. Readers can follow it while the run
+// writes to it.
+type RunLog struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	first  int      // Sequence number of the oldest file kept
+	last   int      // Sequence number of the file being written
+	file   *os.File // File being written
+	size   int64    // Size of the file being written
+	closed bool
+}
+
+// NewRunLog opens a log writing to dir, which is created if needed. Files
+// are rotated when they reach maxSize bytes, and only the newest maxFiles
+// are kept. Zero values disable the rotation and the cleanup.
+func NewRunLog(dir string, maxSize int64, maxFiles int) (*RunLog, error) {
+	if err := os.MkdirAll(dir, os.FileMode(0o755)); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+	l := &RunLog{dir: dir, maxSize: maxSize, maxFiles: maxFiles, first: 1}
+	l.cond = sync.NewCond(&l.mu)
+	if err := l.openFile(1); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Dir returns the directory of the log files
+func (l *RunLog) Dir() string {
+	return l.dir
+}
+
+// Files returns the paths of the log files kept, oldest first
+func (l *RunLog) Files() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files := []string{}
+	for seq := l.first; seq <= l.last; seq++ {
+		files = append(files, l.filePath(seq))
+	}
+	return files
+}
+
+func (l *RunLog) filePath(seq int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("run-log-%06d.jsonl", seq))
+}
+
+// openFile starts the log file seq. Must be called with the lock held.
+func (l *RunLog) openFile(seq int) error {
+	f, err := os.OpenFile(l.filePath(seq), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0o644))
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	l.file, l.last, l.size = f, seq, 0
+	return nil
+}
+
+// rotate closes the log file and starts the next one, removing the
+// oldest files beyond the limit. Must be called with the lock held.
+func (l *RunLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("closing log file: %w", err)
+	}
+	if err := l.openFile(l.last + 1); err != nil {
+		return err
+	}
+	for l.maxFiles > 0 && l.last-l.first+1 > l.maxFiles {
+		if err := os.Remove(l.filePath(l.first)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing rotated log file: %w", err)
+		}
+		l.first++
+	}
+	return nil
+}
+
+// Add writes an entry to the log. Entries without a time are stamped
+// with the current one.
+func (l *RunLog) Add(entry LogEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshaling log entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("log is closed")
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	l.cond.Broadcast()
+	if err != nil {
+		return fmt.Errorf("writing log entry: %w", err)
+	}
+	return nil
+}
+
+// Writer returns a writer adding each line written to it as an entry of
+// the stream. Close it to add the last line if it does not end in a
+// newline.
+func (l *RunLog) Writer(attempt int, stream string) io.WriteCloser {
+	return &logWriter{log: l, attempt: attempt, stream: stream}
+}
+
+// Close stops the log. Readers following it get io.EOF once they read
+// the last entry.
+func (l *RunLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	l.cond.Broadcast()
+	return l.file.Close()
+}
+
+// NewReader returns a reader of the log, as JSON lines, from its oldest
+// file kept. If follow is true, the reader waits for new entries when it
+// reaches the end until the log is closed, like tail -f, otherwise it
+// stops at the end. Closing the reader stops a pending read.
+func (l *RunLog) NewReader(follow bool) io.ReadCloser {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return &logReader{log: l, follow: follow, seq: l.first}
+}
+
+// ReadLogEntries decodes the entries read from a run log
+func ReadLogEntries(r io.Reader) ([]LogEntry, error) {
+	entries := []LogEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := LogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parsing log entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading log: %w", err)
+	}
+	return entries, nil
+}
+
+// logWriter splits what is written to it in lines and adds them to the
+// log
+type logWriter struct {
+	log     *RunLog
+	attempt int
+	stream  string
+	buffer  []byte
+	err     error // First error adding a line, returned by Close
+}
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	lw.buffer = append(lw.buffer, p...)
+	for {
+		i := bytes.IndexByte(lw.buffer, '\n')
+		if i < 0 {
+			break
+		}
+		// A failing log must not break the output of the runner
+		if err := lw.add(string(lw.buffer[:i])); err != nil && lw.err == nil {
+			lw.err = err
+		}
+		lw.buffer = lw.buffer[i+1:]
+	}
+	return len(p), nil
+}
+
+func (lw *logWriter) add(line string) error {
+	return lw.log.Add(LogEntry{Attempt: lw.attempt, Stream: lw.stream, Line: strings.TrimSuffix(line, "\r")})
+}
+
+// Close adds any pending partial line to the log and returns the first
+// error found adding the lines
+func (lw *logWriter) Close() error {
+	if len(lw.buffer) > 0 {
+		if err := lw.add(string(lw.buffer)); err != nil && lw.err == nil {
+			lw.err = err
+		}
+		lw.buffer = nil
+	}
+	return lw.err
+}
+
+// logReader reads the log files in sequence
+type logReader struct {
+	log     *RunLog
+	follow  bool
+	seq     int      // Sequence number of the file being read
+	offset  int64    // Position in the file being read
+	file    *os.File // File being read, nil until opened
+	closed  bool
+	reading bool // A read is in progress, the file is closed when it returns
+}
+
+func (lr *logReader) Read(p []byte) (int, error) {
+	lr.log.mu.Lock()
+	lr.reading = true
+	lr.log.mu.Unlock()
+	defer func() {
+		lr.log.mu.Lock()
+		lr.reading = false
+		if lr.closed {
+			lr.closeFile()
+		}
+		lr.log.mu.Unlock()
+	}()
+	return lr.read(p)
+}
+
+func (lr *logReader) read(p []byte) (int, error) {
+	for {
+		lr.log.mu.Lock()
+		if lr.closed {
+			lr.log.mu.Unlock()
+			return 0, io.EOF
+		}
+		if lr.seq < lr.log.first {
+			// The file being read was rotated out, skip to the oldest kept
+			lr.closeFile()
+			lr.seq, lr.offset = lr.log.first, 0
+		}
+		last, size := lr.log.last, lr.log.size
+		lr.log.mu.Unlock()
+
+		if lr.file == nil {
+			f, err := os.Open(lr.log.filePath(lr.seq))
+			if os.IsNotExist(err) && lr.seq < last {
+				// Rotated out since the check, the next loop skips it
+				continue
+			}
+			if err != nil {
+				return 0, fmt.Errorf("opening log file: %w", err)
+			}
+			lr.file = f
+		}
+		n, err := lr.file.ReadAt(p, lr.offset)
+		lr.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("reading log file: %w", err)
+		}
+
+		// End of the file: go to the next one or wait for more entries
+		if lr.seq < last {
+			lr.closeFile()
+			lr.seq, lr.offset = lr.seq+1, 0
+			continue
+		}
+		lr.log.mu.Lock()
+		for lr.follow && !lr.log.closed && !lr.closed && lr.log.last == lr.seq && lr.log.size == size {
+			lr.log.cond.Wait()
+		}
+		done := !lr.follow || lr.closed || (lr.log.closed && lr.log.last == lr.seq && lr.log.size == lr.offset)
+		lr.log.mu.Unlock()
+		if done {
+			return 0, io.EOF
+		}
+	}
+}
+
+func (lr *logReader) closeFile() {
+	if lr.file != nil {
+		lr.file.Close()
+		lr.file = nil
+	}
+}
+
+// Close stops the reader, a pending read returns io.EOF
+func (lr *logReader) Close() error {
+	lr.log.mu.Lock()
+	defer lr.log.mu.Unlock()
+	lr.closed = true
+	lr.log.cond.Broadcast()
+	if !lr.reading {
+		lr.closeFile()
+	}
+	return nil
+}
+
+// Log returns the log of the run. It is opened when the run starts, or
+// before if Log is called first, to follow it from the beginning.
+func (r *Run) Log() (*RunLog, error) {
+	r.logMu.Lock()
+	defer r.logMu.Unlock()
+	if r.log != nil {
+		return r.log, nil
+	}
+
+	var dir string
+	var err error
+	if r.opts.Log.Dir == "" {
+		dir, err = os.MkdirTemp("", fmt.Sprintf("builder-run-%s-", r.ID()))
+	} else {
+		if err := os.MkdirAll(r.opts.Log.Dir, os.FileMode(0o755)); err != nil {
+			return nil, fmt.Errorf("creating log directory: %w", err)
+		}
+		dir, err = os.MkdirTemp(r.opts.Log.Dir, r.ID()+"-")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating run log directory: %w", err)
+	}
+	l, err := NewRunLog(dir, int64(r.opts.Log.MaxSize), r.opts.Log.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Run #%s will be logged to %s", r.ID(), dir)
+	r.log = l
+	return l, nil
+}
+
+// openedLog returns the log of the run, nil if it is not open
+func (r *Run) openedLog() *RunLog {
+	r.logMu.Lock()
+	defer r.logMu.Unlock()
+	return r.log
+}
+
+// logEvent adds a message of the builder to the run log, if it is open
+func (r *Run) logEvent(message string) {
+	l := r.openedLog()
+	if l == nil {
+		return
+	}
+	if r.runner != nil {
+		message = r.runner.Options().Mask(message)
+	}
+	if err := l.Add(LogEntry{Attempt: r.Attempts, Stream: LogStreamBuild, Line: message}); err != nil {
+		logrus.Debugf("Unable to add message to the run log: %v", err)
+	}
+}
+
+// uploadLog stores the run log at targetURL, in a single file
+func (r *Run) uploadLog(manager *object.Manager, targetURL string) error {
+	l := r.openedLog()
+	if !r.opts.Log.Upload || l == nil {
+		return nil
+	}
+	f, err := os.Create(filepath.Join(l.Dir(), RunLogFilename))
+	if err != nil {
+		return fmt.Errorf("creating run log file: %w", err)
+	}
+	reader := l.NewReader(false)
+	defer reader.Close()
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return fmt.Errorf("writing run log file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing run log file: %w", err)
+	}
+	logURL, err := object.JoinURL(targetURL, RunLogFilename)
+	if err != nil {
+		return fmt.Errorf("building run log URL: %w", err)
+	}
+	if err := manager.Copy(object.FileURL(f.Name()), logURL); err != nil {
+		return &TransferFailedError{URL: logURL, Err: err}
+	}
+	return nil
+}
+
+// uploadLogs copies the output and error logs of the runner attempts to
+// the logs destination, or to the artifacts destination if there is
+// none, and records them in Run.UploadedLogs
+func (dri *defaultRunImplementation) uploadLogs(r *Run) error {
+	if !r.opts.Log.Upload || r.Attempts == 0 {
+		return nil
+	}
+	destination := r.opts.Log.Destination
+	if destination == "" {
+		destination = r.opts.Artifacts.Destination
+	}
+	targetURL, err := dri.stagedURL(r, destination)
+	if err != nil {
+		return fmt.Errorf("getting logs URL: %w", err)
+	}
+	if targetURL == "" {
+		logrus.Info("No logs destination defined, not uploading runner logs")
+		return nil
+	}
+
+	manager := object.NewManager()
+	for i := range r.Logs {
+		for _, log := range []struct {
+			stream string
+			paths  []string
+		}{{LogStreamStdout, r.Logs}, {LogStreamStderr, r.ErrorLogs}} {
+			if i >= len(log.paths) {
+				continue
+			}
+			path := log.paths[i]
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			digests, err := r.digestCache().fileDigests(path)
+			if err != nil {
+				return fmt.Errorf("hashing runner log: %w", err)
+			}
+			logURL, err := object.JoinURL(targetURL, filepath.Base(path))
+			if err != nil {
+				return fmt.Errorf("building runner log URL: %w", err)
+			}
+			if err := manager.Copy(object.FileURL(path), logURL); err != nil {
+				return &TransferFailedError{URL: logURL, Err: err}
+			}
+			r.UploadedLogs = append(r.UploadedLogs, LogObject{
+				Attempt: i + 1, Stream: log.stream, URI: logURL,
+				Digest: map[string]string{"sha256": digests["sha256"], "sha512": digests["sha512"]},
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLog(t *testing.T) {
+	l, err := NewRunLog(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, l.Add(LogEntry{Stream: LogStreamBuild, Line: "Run started"}))
+
+	// Writers split the output in lines, partial lines are kept until
+	// the next write or the writer is closed
+	w := l.Writer(1, LogStreamStdout)
+	_, err = w.Write([]byte("first line\nsec"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("ond line\nno newline"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, l.Close())
+	require.Error(t, l.Add(LogEntry{Line: "too late"}))
+
+	reader := l.NewReader(false)
+	entries, err := ReadLogEntries(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Len(t, entries, 4)
+	require.Equal(t, LogEntry{Time: entries[0].Time, Stream: LogStreamBuild, Line: "Run started"}, entries[0])
+	for i, line := range []string{"first line", "second line", "no newline"} {
+		require.Equal(t, 1, entries[i+1].Attempt)
+		require.Equal(t, LogStreamStdout, entries[i+1].Stream)
+		require.Equal(t, line, entries[i+1].Line)
+		require.False(t, entries[i+1].Time.IsZero())
+	}
+}
+
+func TestRunLogFollow(t *testing.T) {
+	l, err := NewRunLog(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	reader := l.NewReader(true)
+	defer reader.Close()
+
+	// The reader blocks until the log is closed
+	done := make(chan []LogEntry)
+	go func() {
+		entries, err := ReadLogEntries(reader)
+		require.NoError(t, err)
+		done <- entries
+	}()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Add(LogEntry{Stream: LogStreamBuild, Line: fmt.Sprintf("line %d", i)}))
+	}
+	require.NoError(t, l.Close())
+	entries := <-done
+	require.Len(t, entries, 3)
+	require.Equal(t, "line 2", entries[2].Line)
+}
+
+func TestRunLogRotation(t *testing.T) {
+	l, err := NewRunLog(t.TempDir(), 100, 2)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.Add(LogEntry{Stream: LogStreamBuild, Line: fmt.Sprintf("line %d", i)}))
+	}
+	require.NoError(t, l.Close())
+
+	// Only the newest files are kept
+	require.Len(t, l.Files(), 2)
+	data, err := io.ReadAll(l.NewReader(false))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"line":"line 9"`)
+	require.NotContains(t, string(data), `"line":"line 0"`)
+}
+
+func TestRunLogUpload(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile":   "build:\n\techo VERSION > app.bin\n",
+		".gitignore": "app.bin\n",
+	})
+
+	runner := runners.NewMake("build")
+	require.NoError(t, runners.Isolate(runner))
+	runner.Options().Workdir = workdir
+	runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+	artifacts, logs := t.TempDir(), t.TempDir()
+	r := NewRun(runner)
+	r.opts = &RunOptions{
+		BuildPoint: head, ExistenceCheck: AlwaysBuild,
+		Artifacts: ArtifactsConfig{Files: []string{"app.bin"}, Destination: "file://" + artifacts + "/"},
+		Log:       LogConfig{Dir: logs, Upload: true},
+	}
+	require.NoError(t, r.Execute())
+
+	// The log is kept in its directory and the attempt logs next to it
+	l, err := r.Log()
+	require.NoError(t, err)
+	require.Equal(t, logs, filepath.Dir(l.Dir()))
+	require.Equal(t, []string{filepath.Join(l.Dir(), "attempt1.log")}, r.Logs)
+
+	// The uploaded log has the runner output and the run events
+	uploaded := ""
+	require.NoError(t, filepath.WalkDir(artifacts, func(path string, d fs.DirEntry, err error) error {
+		if d.Name() == RunLogFilename {
+			uploaded = path
+		}
+		return err
+	}))
+	require.NotEmpty(t, uploaded)
+	f, err := os.Open(uploaded)
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := ReadLogEntries(f)
+	require.NoError(t, err)
+	streams := map[string]bool{}
+	for _, e := range entries {
+		streams[e.Stream] = true
+		if e.Stream == LogStreamStdout {
+			require.Equal(t, 1, e.Attempt)
+		}
+	}
+	require.True(t, streams[LogStreamStdout])
+	require.True(t, streams[LogStreamBuild])
+
+	// The runner logs are uploaded and the provenance links them
+	require.Len(t, r.UploadedLogs, 2)
+	require.Equal(t, LogStreamStdout, r.UploadedLogs[0].Stream)
+	require.Equal(t, LogStreamStderr, r.UploadedLogs[1].Stream)
+	uploadedLog := filepath.Join(filepath.Dir(uploaded), "attempt1.log")
+	require.Equal(t, "file://"+strings.TrimPrefix(uploadedLog, "/"), r.UploadedLogs[0].URI)
+	digests, err := r.digestCache().fileDigests(uploadedLog)
+	require.NoError(t, err)
+	require.Equal(t, digests["sha256"], r.UploadedLogs[0].Digest["sha256"])
+	statement, err := r.Provenance()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"logs": r.UploadedLogs}, statement.Predicate.BuildConfig)
+}
@@ -0,0 +1,476 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	actionsMoniker     = "github-actions"
+	actionsWorkflowDir = ".github/workflows"
+	actionsShell       = "bash"
+	actionsStateDir    = ".mmbuild-actions" // Directory in the workdir for step scripts and command files
+
+	// actionsUploadArtifact is the action whose paths are collected as artifacts
+	actionsUploadArtifact = "actions/upload-artifact"
+)
+
+// actionsShells are the command templates of the shells supported in
+// steps, {0} is replaced with the path to the step script
+var actionsShells = map[string]string{
+	"bash":   "bash --noprofile --norc -eo pipefail {0}",
+	"sh":     "sh -e {0}",
+	"python": "python3 {0}",
+}
+
+// actionsExpression matches the ${{ }} expressions in workflow values
+var actionsExpression = regexp.MustCompile(`\$\{\{\s*(.*?)\s*\}\}`)
+
+func init() {
+	MustRegister(actionsMoniker, NewGitHubActions, "Runs a job from a GitHub Actions workflow file")
+}
+
+// GitHubActions runs a job defined in a GitHub Actions workflow. The
+// first argument is the job ID, the second one the path to the workflow
+// file relative to the workdir. If the workflow is not specified, it is
+// searched for in .github/workflows.
+//
+// Each run step executes in its own shell with the workflow, job and step
+// env set, the runner EnvVars take precedence over them. Steps can use
+// $GITHUB_ENV and $GITHUB_PATH to modify the environment of the following
+// steps. Steps that use actions are skipped, except the paths uploaded
+// with actions/upload-artifact which are added to the expected files.
+type GitHubActions struct {
+	baseRunner
+}
+
+func NewGitHubActions(args ...string) Runner {
+	return &GitHubActions{
+		baseRunner: baseRunner{
+			id:   actionsMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// ActionsJob is a job from a GitHub Actions workflow with the workflow
+// defaults applied to it
+type ActionsJob struct {
+	ID    string
+	Env   map[string]string // Workflow and job env
+	Steps []ActionsStep
+}
+
+// ActionsStep is a step of a GitHub Actions job
+type ActionsStep struct {
+	Name             string            `yaml:"name"`
+	If               string            `yaml:"if"`
+	Run              string            `yaml:"run"`
+	Uses             string            `yaml:"uses"`
+	Shell            string            `yaml:"shell"`
+	WorkingDirectory string            `yaml:"working-directory"`
+	ContinueOnError  bool              `yaml:"continue-on-error"`
+	Env              map[string]string `yaml:"env"`
+	With             map[string]string `yaml:"with"`
+}
+
+type actionsDefaults struct {
+	Run struct {
+		Shell            string `yaml:"shell"`
+		WorkingDirectory string `yaml:"working-directory"`
+	} `yaml:"run"`
+}
+
+type actionsWorkflow struct {
+	Env      map[string]string `yaml:"env"`
+	Defaults actionsDefaults   `yaml:"defaults"`
+	Jobs     map[string]struct {
+		Env      map[string]string `yaml:"env"`
+		Defaults actionsDefaults   `yaml:"defaults"`
+		Steps    []ActionsStep     `yaml:"steps"`
+	} `yaml:"jobs"`
+}
+
+// ParseActionsJob reads a job from GitHub Actions workflow data. The
+// default shell and working directory of the workflow and the job are
+// set in the steps that do not define them.
+func ParseActionsJob(data []byte, id string) (*ActionsJob, error) {
+	workflow := &actionsWorkflow{}
+	if err := yaml.Unmarshal(data, workflow); err != nil {
+		return nil, fmt.Errorf("parsing workflow: %w", err)
+	}
+	definition, ok := workflow.Jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job %s not found in workflow", id)
+	}
+	if len(definition.Steps) == 0 {
+		return nil, fmt.Errorf("job %s has no steps", id)
+	}
+
+	job := &ActionsJob{ID: id, Env: map[string]string{}, Steps: definition.Steps}
+	for _, env := range []map[string]string{workflow.Env, definition.Env} {
+		for k, v := range env {
+			job.Env[k] = v
+		}
+	}
+	for i := range job.Steps {
+		step := &job.Steps[i]
+		for _, defaults := range []actionsDefaults{definition.Defaults, workflow.Defaults} {
+			if step.Shell == "" {
+				step.Shell = defaults.Run.Shell
+			}
+			if step.WorkingDirectory == "" {
+				step.WorkingDirectory = defaults.Run.WorkingDirectory
+			}
+		}
+		if step.Shell == "" {
+			step.Shell = actionsShell
+		}
+	}
+	return job, nil
+}
+
+// findActionsWorkflow returns the workflow file in the workdir that
+// defines the job. It fails if none or more than one define it.
+func findActionsWorkflow(workdir, id string) (string, error) {
+	found := []string{}
+	for _, ext := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(workdir, actionsWorkflowDir, ext))
+		if err != nil {
+			return "", fmt.Errorf("searching for workflows: %w", err)
+		}
+		for _, path := range matches {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("reading workflow: %w", err)
+			}
+			workflow := &actionsWorkflow{}
+			if err := yaml.Unmarshal(data, workflow); err != nil {
+				logrus.Warnf("Unable to parse workflow %s: %v", path, err)
+				continue
+			}
+			if _, ok := workflow.Jobs[id]; ok {
+				found = append(found, path)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no workflow in %s defines job %s", actionsWorkflowDir, id)
+	case 1:
+		return filepath.Rel(workdir, found[0])
+	}
+	return "", fmt.Errorf("job %s is defined in more than one workflow, specify the file", id)
+}
+
+// Run parses the job and executes its steps
+func (a *GitHubActions) Run() error {
+	if len(a.args) == 0 {
+		return errors.New("github-actions runner needs the ID of the job to run")
+	}
+	workflowFile := ""
+	if len(a.args) > 1 {
+		workflowFile = a.args[1]
+	} else {
+		f, err := findActionsWorkflow(a.Options().Workdir, a.args[0])
+		if err != nil {
+			return err
+		}
+		workflowFile = f
+	}
+	data, err := os.ReadFile(filepath.Join(a.Options().Workdir, workflowFile))
+	if err != nil {
+		return fmt.Errorf("reading workflow file: %w", err)
+	}
+	job, err := ParseActionsJob(data, a.args[0])
+	if err != nil {
+		return fmt.Errorf("reading job from %s: %w", workflowFile, err)
+	}
+
+	// The workflow file defines the build, record it as a material
+	if err := recordFileMaterial(a.Options(), workflowFile); err != nil {
+		return err
+	}
+
+	workspace, err := filepath.Abs(a.Options().Workdir)
+	if err != nil {
+		return fmt.Errorf("resolving workdir path: %w", err)
+	}
+	stateDir := filepath.Join(workspace, actionsStateDir)
+	if err := os.MkdirAll(stateDir, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating steps directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(stateDir); err != nil {
+			logrus.Warnf("Unable to remove steps directory: %v", err)
+		}
+	}()
+
+	// Options are shared, so the step environment is only set while each
+	// step runs
+	savedEnv := a.Options().EnvVars
+	defer func() { a.Options().EnvVars = savedEnv }()
+
+	logrus.Infof("Running GitHub Actions job %s from %s", job.ID, workflowFile)
+	session, err := a.newSession(nil)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+	state := &actionsState{job: job, workspace: workspace, dir: stateDir, env: map[string]string{}}
+	var jobErr error
+	artifacts := []string{}
+	for i := range job.Steps {
+		step := &job.Steps[i]
+		if !state.shouldRun(step, jobErr != nil) {
+			logrus.Infof("Skipping step #%d (%s)", i, step.name(i))
+			continue
+		}
+
+		if step.Run == "" {
+			if strings.HasPrefix(step.Uses, actionsUploadArtifact+"@") {
+				artifacts = append(artifacts, strings.Split(step.With["path"], "\n")...)
+			}
+			logrus.Infof("Step #%d uses %s, actions are not run", i, step.Uses)
+			continue
+		}
+
+		logrus.Infof("Running step #%d (%s)", i, step.name(i))
+		err := state.runStep(a, session, i, step, savedEnv)
+		a.Options().EnvVars = savedEnv
+		if err != nil {
+			if step.ContinueOnError {
+				logrus.Warnf("Step #%d failed, continuing: %v", i, err)
+				continue
+			}
+			if jobErr == nil {
+				jobErr = fmt.Errorf("running step #%d (%s): %w", i, step.name(i), err)
+			}
+		}
+	}
+	if jobErr != nil {
+		return fmt.Errorf("running GitHub Actions job %s: %w", job.ID, jobErr)
+	}
+
+	// upload-artifact paths are globs, the ones starting with ! exclude files
+	paths, exclude := []string{}, []string{}
+	for _, p := range artifacts {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "":
+		case strings.HasPrefix(p, "!"):
+			exclude = append(exclude, strings.TrimPrefix(p, "!"))
+		default:
+			paths = append(paths, p)
+		}
+	}
+	files, err := findArtifactFiles(a.Options().Workdir, paths, exclude)
+	if err != nil {
+		return fmt.Errorf("collecting job artifacts: %w", err)
+	}
+	logrus.Infof("GitHub Actions job %s produced %d artifacts", job.ID, len(files))
+	a.Options().ExpectedFiles = append(a.Options().ExpectedFiles, files...)
+	return nil
+}
+
+// actionsState keeps the environment modified by the steps of a job
+type actionsState struct {
+	job       *ActionsJob
+	workspace string
+	dir       string            // Directory of the step scripts and command files
+	env       map[string]string // Variables added with $GITHUB_ENV
+	path      []string          // Directories added with $GITHUB_PATH, last added first
+}
+
+// shouldRun evaluates the status functions of the step condition. Other
+// expressions in conditions are not evaluated, those steps run.
+func (s *actionsState) shouldRun(step *ActionsStep, failed bool) bool {
+	cond := strings.TrimSpace(step.If)
+	if m := actionsExpression.FindStringSubmatch(cond); m != nil && m[0] == cond {
+		cond = m[1]
+	}
+	switch {
+	case strings.Contains(cond, "always()"):
+		return true
+	case strings.Contains(cond, "failure()"):
+		return failed
+	case strings.Contains(cond, "cancelled()"):
+		return false
+	case cond != "" && cond != "success()":
+		logrus.Warnf("Step condition %q is not evaluated", step.If)
+	}
+	return !failed
+}
+
+// runStep writes the step script and runs it with the step shell
+func (s *actionsState) runStep(a *GitHubActions, session *session, i int, step *ActionsStep, runnerEnv map[string]string) error {
+	env, err := s.stepEnvironment(a, step, runnerEnv)
+	if err != nil {
+		return err
+	}
+	script, err := s.expand(step.Run, env)
+	if err != nil {
+		return err
+	}
+
+	template := step.Shell
+	if t, ok := actionsShells[step.Shell]; ok {
+		template = t
+	} else if !strings.Contains(template, "{0}") {
+		return fmt.Errorf("unsupported shell %s", step.Shell)
+	}
+	scriptPath := filepath.Join(s.dir, fmt.Sprintf("step-%02d", i))
+	if err := os.WriteFile(scriptPath, []byte(script), os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing step script: %w", err)
+	}
+	cmdLine := strings.Fields(template)
+	for j := range cmdLine {
+		cmdLine[j] = strings.ReplaceAll(cmdLine[j], "{0}", scriptPath)
+	}
+
+	// The runner workdir is not changed as it is the one mounted when
+	// running in a container, the shell is started in the step directory
+	if step.WorkingDirectory != "" {
+		dir, err := s.expand(step.WorkingDirectory, env)
+		if err != nil {
+			return err
+		}
+		cmdLine = append([]string{"sh", "-c", `cd "$0" && exec "$@"`, filepath.Join(s.workspace, dir)}, cmdLine...)
+	}
+
+	for _, f := range []string{"GITHUB_ENV", "GITHUB_PATH", "GITHUB_OUTPUT"} {
+		if err := os.WriteFile(env[f], []byte{}, os.FileMode(0o644)); err != nil {
+			return fmt.Errorf("creating step command file: %w", err)
+		}
+	}
+
+	a.Options().EnvVars = env
+	runErr := session.run(cmdLine)
+	if err := s.readCommandFiles(env["GITHUB_ENV"], env["GITHUB_PATH"]); err != nil {
+		return fmt.Errorf("reading step command files: %w", err)
+	}
+	return runErr
+}
+
+// stepEnvironment returns the environment of a step: the job env, the
+// variables added by previous steps, the step env and the runner EnvVars
+func (s *actionsState) stepEnvironment(a *GitHubActions, step *ActionsStep, runnerEnv map[string]string) (map[string]string, error) {
+	env := map[string]string{
+		"CI":                  "true",
+		"GITHUB_JOB":          s.job.ID,
+		"GITHUB_WORKSPACE":    s.workspace,
+		"GITHUB_ENV":          filepath.Join(s.dir, "env"),
+		"GITHUB_PATH":         filepath.Join(s.dir, "path"),
+		"GITHUB_OUTPUT":       filepath.Join(s.dir, "output"),
+		"GITHUB_STEP_SUMMARY": filepath.Join(s.dir, "summary"),
+	}
+	for _, vars := range []map[string]string{s.job.Env, s.env, step.Env} {
+		for k, v := range vars {
+			expanded, err := s.expand(v, env)
+			if err != nil {
+				return nil, fmt.Errorf("setting %s: %w", k, err)
+			}
+			env[k] = expanded
+		}
+	}
+	for k, v := range runnerEnv {
+		env[k] = v
+	}
+	if len(s.path) > 0 {
+		path, ok := env["PATH"]
+		if !ok {
+			path = a.Options().Environment()["PATH"]
+		}
+		env["PATH"] = strings.Join(append(append([]string{}, s.path...), path), string(os.PathListSeparator))
+	}
+	return env, nil
+}
+
+// expand replaces the ${{ }} expressions in a workflow value. Only env
+// variables and the github.workspace and github.job contexts are supported.
+func (s *actionsState) expand(value string, env map[string]string) (string, error) {
+	var expandErr error
+	expanded := actionsExpression.ReplaceAllStringFunc(value, func(match string) string {
+		expr := actionsExpression.FindStringSubmatch(match)[1]
+		switch {
+		case strings.HasPrefix(expr, "env."):
+			return env[strings.TrimPrefix(expr, "env.")]
+		case expr == "github.workspace":
+			return s.workspace
+		case expr == "github.job":
+			return s.job.ID
+		}
+		if expandErr == nil {
+			expandErr = fmt.Errorf("unsupported expression %s", match)
+		}
+		return match
+	})
+	return expanded, expandErr
+}
+
+// readCommandFiles reads the variables and paths written by a step to
+// the $GITHUB_ENV and $GITHUB_PATH files
+func (s *actionsState) readCommandFiles(envFile, pathFile string) error {
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "<<"); i > 0 && !strings.Contains(line[:i], "=") {
+			// Multiline values: NAME<<DELIMITER ... DELIMITER
+			name, delimiter := line[:i], line[i+2:]
+			lines := []string{}
+			for scanner.Scan() && scanner.Text() != delimiter {
+				lines = append(lines, scanner.Text())
+			}
+			s.env[name] = strings.Join(lines, "\n")
+			continue
+		}
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			s.env[parts[0]] = parts[1]
+		}
+	}
+
+	data, err = os.ReadFile(pathFile)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			s.path = append([]string{line}, s.path...)
+		}
+	}
+	return nil
+}
+
+// name returns the name of the step to show in the logs
+func (step *ActionsStep) name(i int) string {
+	switch {
+	case step.Name != "":
+		return step.Name
+	case step.Uses != "":
+		return step.Uses
+	}
+	return fmt.Sprintf("run #%d", i)
+}
+
+// Describe returns the metadata of the runner
+func (a *GitHubActions) Describe() *Description {
+	d := a.describe(actionsShell)
+	d.RequiresArgs = true
+	return d
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testActionsWorkflow = `
+name: CI
+on: [push]
+env:
+  GOFLAGS: -mod=readonly
+defaults:
+  run:
+    shell: sh
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    env:
+      TARGET: linux
+    defaults:
+      run:
+        working-directory: src
+    steps:
+      - uses: actions/checkout@v2
+      - name: Set version
+        run: |
+          echo "VERSION=1.0" >> $GITHUB_ENV
+          echo "NOTES<<EOF" >> $GITHUB_ENV
+          echo "line 1" >> $GITHUB_ENV
+          echo "line 2" >> $GITHUB_ENV
+          echo "EOF" >> $GITHUB_ENV
+          mkdir -p $GITHUB_WORKSPACE/tools && printf '#!/bin/sh\necho tool\n' > $GITHUB_WORKSPACE/tools/mytool
+          chmod +x $GITHUB_WORKSPACE/tools/mytool
+          echo "$GITHUB_WORKSPACE/tools" >> $GITHUB_PATH
+      - name: Build
+        shell: bash
+        env:
+          TARGET: darwin
+          OUT: ${{ github.workspace }}/dist
+        run: |
+          mkdir -p $OUT
+          echo "$TARGET $VERSION $GOFLAGS $(mytool) $(basename $PWD) ${{ env.TARGET }}" > $OUT/app
+          echo "$NOTES" > $OUT/notes.txt
+      - name: Optional
+        continue-on-error: true
+        run: exit 1
+      - uses: actions/upload-artifact@v3
+        with:
+          name: binaries
+          path: |
+            dist/
+            !dist/*.txt
+  fail:
+    runs-on: ubuntu-latest
+    steps:
+      - run: exit 2
+      - run: echo skipped > skipped.log
+      - if: ${{ always() }}
+        run: echo always > always.log
+      - if: failure()
+        run: echo failure > failure.log
+      - run: echo ${{ matrix.os }}
+        if: always()
+`
+
+func TestParseActionsJob(t *testing.T) {
+	job, err := ParseActionsJob([]byte(testActionsWorkflow), "build")
+	require.NoError(t, err)
+	require.Equal(t, "build", job.ID)
+	require.Equal(t, map[string]string{"GOFLAGS": "-mod=readonly", "TARGET": "linux"}, job.Env)
+	require.Len(t, job.Steps, 5)
+	require.Equal(t, "actions/checkout@v2", job.Steps[0].Uses)
+	require.Equal(t, "sh", job.Steps[1].Shell)
+	require.Equal(t, "src", job.Steps[1].WorkingDirectory)
+	require.Equal(t, "bash", job.Steps[2].Shell)
+	require.True(t, job.Steps[3].ContinueOnError)
+
+	_, err = ParseActionsJob([]byte(testActionsWorkflow), "deploy")
+	require.Error(t, err)
+}
+
+func TestGitHubActionsRun(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, actionsWorkflowDir), os.FileMode(0o755)))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, actionsWorkflowDir, "ci.yml"), []byte(testActionsWorkflow), os.FileMode(0o644),
+	))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	// The workflow is found from the job ID
+	a := NewGitHubActions("build")
+	a.Options().Workdir = dir
+	a.Options().ExpectedFiles = nil
+	a.Options().Materials = nil
+	a.Options().EnvVars = map[string]string{"GOFLAGS": "-mod=vendor"}
+	require.NoError(t, a.Run())
+	require.Equal(t, []string{filepath.Join("dist", "app")}, a.Options().ExpectedFiles)
+	require.Contains(t, a.Options().Materials, "file:.github/workflows/ci.yml")
+	require.Equal(t, map[string]string{"GOFLAGS": "-mod=vendor"}, a.Options().EnvVars)
+	require.NoDirExists(t, filepath.Join(dir, actionsStateDir))
+
+	data, err := os.ReadFile(filepath.Join(dir, "dist", "app"))
+	require.NoError(t, err)
+	require.Equal(t, "darwin 1.0 -mod=vendor tool src darwin\n", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "dist", "notes.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "line 1\nline 2\n", string(data))
+
+	// Steps after a failure only run with always() or failure()
+	a = NewGitHubActions("fail", filepath.Join(actionsWorkflowDir, "ci.yml"))
+	a.Options().Workdir = dir
+	require.Error(t, a.Run())
+	require.NoFileExists(t, filepath.Join(dir, "skipped.log"))
+	require.FileExists(t, filepath.Join(dir, "always.log"))
+	require.FileExists(t, filepath.Join(dir, "failure.log"))
+
+	require.Error(t, NewGitHubActions().Run())
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import "strings"
+
+// ArgumentsSetter is implemented by the runners whose arguments can be
+// changed after they are created, eg to expand the variables they
+// reference when the run starts
+type ArgumentsSetter interface {
+	SetArguments(args ...string)
+}
+
+// SetArguments replaces the runner arguments
+func (br *baseRunner) SetArguments(args ...string) {
+	br.args = append([]string{}, args...)
+}
+
+// SetArguments replaces the arguments of bazel. The expected version
+// is read from them like when creating the runner.
+func (b *Bazel) SetArguments(args ...string) {
+	b.args = []string{}
+	for _, a := range args {
+		if strings.HasPrefix(a, bazelVersionParam) {
+			b.expectedVersion = strings.TrimPrefix(a, bazelVersionParam)
+			continue
+		}
+		b.args = append(b.args, a)
+	}
+}
+
+// SetArguments replaces the arguments of the steps. The arguments are
+// encoded like when creating the composite runner, each step preceded by
+// its runner ID. Steps are matched by position.
+func (c *Composite) SetArguments(args ...string) {
+	groups := [][]string{}
+	for _, a := range args {
+		if strings.HasPrefix(a, compositeStepPrefix) {
+			groups = append(groups, []string{})
+			continue
+		}
+		if len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], a)
+		}
+	}
+	for i, step := range c.Steps {
+		if setter, ok := step.(ArgumentsSetter); ok && i < len(groups) {
+			setter.SetArguments(groups[i]...)
+		}
+	}
+}
+
+// SetArguments replaces the arguments of the wrapped runner
+func (c *Containerized) SetArguments(args ...string) {
+	if setter, ok := c.Runner.(ArgumentsSetter); ok {
+		setter.SetArguments(args...)
+	}
+}
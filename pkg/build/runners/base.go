@@ -4,8 +4,22 @@
 package runners
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/mattermost/cicd-sdk/pkg/replacement"
-	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/hash"
 )
 
 type Runner interface {
@@ -14,39 +28,75 @@ type Runner interface {
 	Output() string
 	Options() *Options
 	Arguments() []string
+	Describe() *Description
 }
 
 type Options struct {
-	Workdir       string
-	ProvenanceDir string
-	BuildPoint    string
-	Source        string
-	ConfigFile    string
-	ConfigPoint   string
-	Log           string            // Path to file where the log will be stored
-	ErrorLog      string            // Path to file where errors will be logged to
-	EnvVars       map[string]string // String map of environment variables in var=value form
-	Replacements  []replacement.Replacement
+	Workdir        string
+	ProvenanceDir  string
+	BuildPoint     string
+	Source         string
+	ConfigFile     string
+	ConfigPoint    string
+	ConfigDigest   map[string]string            // Digest of a config file downloaded from a URL
+	Log            string                       // Path to file where the log will be stored
+	ErrorLog       string                       // Path to file where errors will be logged to
+	EnvVars        map[string]string            // String map of environment variables in var=value form
+	ExpectedFiles  []string                     // Files the runner knows it will produce, added to the run artifacts
+	ExpectedImages []string                     // Container images the runner pushed as repo@sha256:digest, added to the run artifacts
+	Timeout        time.Duration                // Maximum time the runner can execute. Zero means no timeout
+	OutputWriters  []io.Writer                  // Additional writers that receive the runner output as it is produced
+	ErrorWriters   []io.Writer                  // Additional writers that receive the runner error output
+	LineCallback   LineCallback                 // Function called with each line of output
+	Container      *ContainerOptions            // When set, commands run inside this container
+	Materials      map[string]map[string]string // Materials used by the runner (URI to digest), recorded in the provenance
+	Limits         ResourceLimits               // CPU, memory and process limits of the runner processes
+	CleanEnv       bool                         // Do not inherit the parent environment, only EnvVars and EnvAllowlist are set
+	EnvAllowlist   []string                     // Parent environment variables passed to the runner when CleanEnv is set
+	Input          *InputOptions                // Standard input of the commands. When nil they get no input
+	Context        context.Context              // When done, the running command is killed. Commands are not cancelled when nil
+	SecretVars     []string                     // EnvVars holding secret values, not recorded in the provenance and masked in the output
+	MaskedValues   []string                     // Other sensitive values masked in the output, like secrets used in replacements
+	MaskedPatterns []string                     // Regular expressions of other values masked in the output, besides the CredentialPatterns
+	Replacements   []replacement.Replacement
 }
 
+// OutputStream identifies the stream a line of output was written to
+type OutputStream int
+
+const (
+	StreamStdout OutputStream = iota
+	StreamStderr
+)
+
+// LineCallback receives each line of output of a runner as it is written
+type LineCallback func(stream OutputStream, line string)
+
 var DefaultOptions = &Options{
 	Workdir: ".",
 	EnvVars: map[string]string{},
 }
 
-var Catalog = make(map[string]func(args ...string) Runner)
-
 func New(builderID string, args ...string) (Runner, error) {
-	if _, ok := Catalog[builderID]; !ok {
-		return nil, errors.Errorf("no runner with id '%s' found", builderID)
+	factory, ok := Lookup(builderID)
+	if !ok {
+		return nil, fmt.Errorf("no runner with id '%s' found", builderID)
 	}
-	runner := Catalog[builderID](args...)
+	runner := factory(args...)
 	if runner == nil {
-		return nil, errors.Errorf("unable to initialize new runner")
+		return nil, fmt.Errorf("unable to initialize new runner")
+	}
+	// Factories without an error result, like the composite one, can
+	// report why the runner is not usable
+	if f, ok := runner.(interface{ factoryError() error }); ok && f.factoryError() != nil {
+		return nil, f.factoryError()
 	}
 
 	runner.Options().Workdir = DefaultOptions.Workdir
-	runner.Options().EnvVars = DefaultOptions.EnvVars
+	runner.Options().EnvVars = map[string]string{}
+	for v, val := range DefaultOptions.EnvVars {
+		runner.Options().EnvVars[v] = val
+	}
 
 	return runner, nil
 }
@@ -73,3 +123,448 @@ func (br *baseRunner) Options() *Options {
 func (br *baseRunner) Arguments() []string {
 	return br.args
 }
+
+// Environment returns the effective environment of the runner commands:
+// the parent process environment (or only its allowlisted variables when
+// CleanEnv is set) overridden by EnvVars.
+func (o *Options) Environment() map[string]string {
+	env := map[string]string{}
+	allowed := map[string]bool{}
+	for _, v := range o.EnvAllowlist {
+		allowed[v] = true
+	}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || (o.CleanEnv && !allowed[parts[0]]) {
+			continue
+		}
+		env[parts[0]] = parts[1]
+	}
+	for v, val := range o.EnvVars {
+		env[v] = val
+	}
+	return env
+}
+
+// Copy returns a copy of the options that does not share its maps and
+// slices with the original
+func (o *Options) Copy() *Options {
+	c := *o
+	if o.EnvVars != nil {
+		c.EnvVars = map[string]string{}
+		for v, val := range o.EnvVars {
+			c.EnvVars[v] = val
+		}
+	}
+	if o.ConfigDigest != nil {
+		c.ConfigDigest = map[string]string{}
+		for algo, h := range o.ConfigDigest {
+			c.ConfigDigest[algo] = h
+		}
+	}
+	if o.Materials != nil {
+		c.Materials = map[string]map[string]string{}
+		for uri, digest := range o.Materials {
+			c.Materials[uri] = map[string]string{}
+			for algo, h := range digest {
+				c.Materials[uri][algo] = h
+			}
+		}
+	}
+	c.ExpectedFiles = append([]string(nil), o.ExpectedFiles...)
+	c.ExpectedImages = append([]string(nil), o.ExpectedImages...)
+	c.OutputWriters = append([]io.Writer(nil), o.OutputWriters...)
+	c.ErrorWriters = append([]io.Writer(nil), o.ErrorWriters...)
+	c.EnvAllowlist = append([]string(nil), o.EnvAllowlist...)
+	c.SecretVars = append([]string(nil), o.SecretVars...)
+	c.MaskedValues = append([]string(nil), o.MaskedValues...)
+	c.MaskedPatterns = append([]string(nil), o.MaskedPatterns...)
+	c.Replacements = append([]replacement.Replacement(nil), o.Replacements...)
+	if o.Input != nil {
+		in := *o.Input
+		in.Responses = append([]InputResponse(nil), o.Input.Responses...)
+		c.Input = &in
+	}
+	return &c
+}
+
+// Isolate gives runner its own copy of its options. The runners start with
+// a copy of DefaultOptions but a runner can be reused, it needs to be
+// isolated before running more than one build with it at the same time.
+func Isolate(runner Runner) error {
+	switch r := runner.(type) {
+	case *Containerized:
+		return Isolate(r.Runner)
+	case *Composite:
+		r.opts = r.opts.Copy()
+		for _, step := range r.Steps {
+			if err := Isolate(step); err != nil {
+				return err
+			}
+		}
+		return nil
+	case interface{ isolate() }:
+		r.isolate()
+		return nil
+	}
+	return fmt.Errorf("unable to isolate the options of runner %s", runner.ID())
+}
+
+func (br *baseRunner) isolate() {
+	br.opts = br.opts.Copy()
+}
+
+// processEnvironment returns the effective environment of the runner
+// commands in var=value form, sorted to make it stable
+func (br *baseRunner) processEnvironment() []string {
+	envStr := []string{}
+	for v, val := range br.Options().Environment() {
+		envStr = append(envStr, fmt.Sprintf("%s=%s", v, val))
+	}
+	sort.Strings(envStr)
+	return envStr
+}
+
+// commandOutput runs a command in the runner working directory and returns
+// its output. The output is not written to the run logs.
+func (br *baseRunner) commandOutput(cmd string, args ...string) (string, error) {
+	if br.Options().Container != nil {
+		cmdLine := br.containerCommand(append([]string{cmd}, args...))
+		cmd, args = cmdLine[0], cmdLine[1:]
+	}
+	ctx := br.Options().Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := exec.CommandContext(ctx, cmd, args...) //nolint:gosec // Runners execute variable commands
+	c.Dir = br.Options().Workdir
+	c.Env = br.processEnvironment()
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	output, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("running %s: %s: %w", cmd, strings.TrimSpace(stderr.String()), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// execute runs a sequence of command lines in the runner working directory.
+// Each command gets the runner environment and its output is written to the
+// log files defined in the options. Execution stops at the first failure.
+//
+// If the options define a timeout, it applies to the whole sequence. When
+// exceeded, the running command and its children are killed and a
+// TimeoutError is returned.
+func (br *baseRunner) execute(cmdLines ...[]string) error {
+	return br.executeCapture(nil, cmdLines...)
+}
+
+// executeCapture works like execute but also copies the standard output
+// of the commands to capture, if not nil
+func (br *baseRunner) executeCapture(capture io.Writer, cmdLines ...[]string) error {
+	s, err := br.newSession(capture)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	for _, cmdLine := range cmdLines {
+		if err := s.run(cmdLine); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// session runs commands that write to the same outputs and share the
+// runner timeout. Each command gets the workdir and environment set in
+// the options when it starts.
+type session struct {
+	br             *baseRunner
+	stdout, stderr io.Writer
+	closeOutputs   func()
+	timer          *time.Timer
+	deadline       <-chan time.Time
+	expired        bool // The timeout expired, no more commands can run
+}
+
+// newSession opens the runner outputs and starts the timeout clock. The
+// standard output of the commands is copied to capture, if not nil.
+func (br *baseRunner) newSession(capture io.Writer) (*session, error) {
+	if err := br.Options().Input.validate(); err != nil {
+		return nil, err
+	}
+	stdout, stderr, closeOutputs, err := br.outputWriters()
+	if err != nil {
+		return nil, err
+	}
+	if capture != nil {
+		stdout = io.MultiWriter(stdout, capture)
+	}
+	s := &session{br: br, stdout: stdout, stderr: stderr, closeOutputs: closeOutputs}
+	if br.Options().Timeout > 0 {
+		s.timer = time.NewTimer(br.Options().Timeout)
+		s.deadline = s.timer.C
+	}
+	return s, nil
+}
+
+// run executes a command line in the session
+func (s *session) run(cmdLine []string) error {
+	if s.expired {
+		return &TimeoutError{Command: strings.Join(cmdLine, " "), Timeout: s.br.Options().Timeout}
+	}
+	if ctx := s.br.Options().Context; ctx != nil && ctx.Err() != nil {
+		return &CanceledError{Command: strings.Join(cmdLine, " "), Err: ctx.Err()}
+	}
+	if s.br.Options().Container != nil {
+		cmdLine = s.br.containerCommand(cmdLine)
+	}
+	cmd := exec.Command(cmdLine[0], cmdLine[1:]...) //nolint:gosec // Runners execute variable commands
+	cmd.Dir = s.br.Options().Workdir
+	cmd.Env = s.br.processEnvironment()
+	cmd.Stdout = s.stdout
+	cmd.Stderr = s.stderr
+
+	logrus.Infof("+ %s", s.br.Options().Mask(strings.Join(cmdLine, " ")))
+	cmd.Stdin = s.br.commandInput(s.stdout)
+	err := s.br.startAndWait(cmd, s.deadline)
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		s.expired = true
+	}
+	return err
+}
+
+// close stops the timeout clock and closes the outputs
+func (s *session) close() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.closeOutputs()
+}
+
+// outputWriters returns the writers for the output and error streams of
+// the runner commands. Output goes to the console, the log files and the
+// writers and line callback set in the options, with the sensitive values
+// masked. The returned function flushes and closes them.
+func (br *baseRunner) outputWriters() (stdout, stderr io.Writer, closer func(), err error) {
+	closers := []io.Closer{}
+	closer = func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+	stdoutWriters := append([]io.Writer{os.Stdout}, br.Options().OutputWriters...)
+	stderrWriters := append([]io.Writer{os.Stderr}, br.Options().ErrorWriters...)
+
+	if br.Options().Log != "" {
+		oLog, err := os.Create(br.Options().Log)
+		if err != nil {
+			return nil, nil, closer, fmt.Errorf("opening output log: %w", err)
+		}
+		closers = append(closers, oLog)
+		stdoutWriters = append(stdoutWriters, oLog)
+	}
+
+	if br.Options().ErrorLog != "" {
+		eLog, err := os.Create(br.Options().ErrorLog)
+		if err != nil {
+			closer()
+			return nil, nil, closer, fmt.Errorf("opening error log: %w", err)
+		}
+		closers = append(closers, eLog)
+		stderrWriters = append(stderrWriters, eLog)
+	}
+
+	if br.Options().LineCallback != nil {
+		// Line writers go first in the closers to flush them before the logs
+		ow := &lineWriter{stream: StreamStdout, callback: br.Options().LineCallback}
+		ew := &lineWriter{stream: StreamStderr, callback: br.Options().LineCallback}
+		closers = append([]io.Closer{ow, ew}, closers...)
+		stdoutWriters = append(stdoutWriters, ow)
+		stderrWriters = append(stderrWriters, ew)
+	}
+
+	stdout, stderr = io.MultiWriter(stdoutWriters...), io.MultiWriter(stderrWriters...)
+	// Masking writers go first in the closers to flush them before the rest
+	values, patterns := br.Options().SensitiveValues(), br.Options().SensitivePatterns()
+	ow, ew := NewPatternMaskWriter(stdout, values, patterns...), NewPatternMaskWriter(stderr, values, patterns...)
+	closers = append([]io.Closer{ow, ew}, closers...)
+	return ow, ew, closer, nil
+}
+
+// lineWriter is an io.Writer that splits its input in lines and sends
+// them to a callback
+type lineWriter struct {
+	stream   OutputStream
+	callback LineCallback
+	buffer   []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buffer = append(lw.buffer, p...)
+	for {
+		i := bytes.IndexByte(lw.buffer, '\n')
+		if i < 0 {
+			break
+		}
+		lw.callback(lw.stream, strings.TrimSuffix(string(lw.buffer[:i]), "\r"))
+		lw.buffer = lw.buffer[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close sends any pending partial line to the callback
+func (lw *lineWriter) Close() error {
+	if len(lw.buffer) > 0 {
+		lw.callback(lw.stream, string(lw.buffer))
+		lw.buffer = nil
+	}
+	return nil
+}
+
+// startAndWait starts a command and waits for it to finish. If the deadline
+// channel fires first, the command and its children are killed and a
+// TimeoutError is returned. If the context in the options is done first,
+// they are killed too and a CanceledError is returned.
+func (br *baseRunner) startAndWait(cmd *exec.Cmd, deadline <-chan time.Time) error {
+	cmdLine := strings.Join(cmd.Args, " ")
+	setProcessGroup(cmd)
+
+	var canceled <-chan struct{}
+	if ctx := br.Options().Context; ctx != nil {
+		canceled = ctx.Done()
+	}
+
+	var limits limiter
+	// Containerized commands get the limits as engine flags
+	if br.Options().Limits.enabled() && br.Options().Container == nil {
+		l, err := newLimiter(br.Options().Limits)
+		if err != nil {
+			return fmt.Errorf("applying resource limits to %s: %w", cmdLine, err)
+		}
+		limits = l
+		defer func() {
+			if err := limits.close(); err != nil {
+				logrus.Warnf("Unable to release resource limits: %v", err)
+			}
+		}()
+		limits.prepare(cmd)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return startError(cmd, err)
+	}
+
+	if limits != nil {
+		if err := limits.attach(cmd.Process.Pid); err != nil {
+			if err := killProcessGroup(cmd); err != nil {
+				logrus.Errorf("Unable to kill %s: %v", cmd.Path, err)
+			}
+			cmd.Wait() //nolint:errcheck
+			return fmt.Errorf("applying resource limits to %s: %w", cmdLine, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if limits != nil {
+				if lerr := limits.violation(); lerr != nil {
+					return lerr
+				}
+			}
+			return commandError(cmdLine, err)
+		}
+		return nil
+	case <-deadline:
+		if err := killProcessGroup(cmd); err != nil {
+			logrus.Errorf("Unable to kill %s after timeout: %v", cmd.Path, err)
+		}
+		<-done
+		return &TimeoutError{
+			Command: cmdLine,
+			Timeout: br.Options().Timeout,
+		}
+	case <-canceled:
+		if err := killProcessGroup(cmd); err != nil {
+			logrus.Errorf("Unable to kill %s after cancellation: %v", cmd.Path, err)
+		}
+		<-done
+		return &CanceledError{Command: cmdLine, Err: br.Options().Context.Err()}
+	}
+}
+
+// TimeoutError is returned when a runner exceeds its timeout
+type TimeoutError struct {
+	Command string        // Command line that was running when the timeout expired
+	Timeout time.Duration // Timeout set in the runner options
+}
+
+func (te *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s running %s", te.Timeout, te.Command)
+}
+
+// recordFileMaterial hashes a file in the workdir and adds it to the
+// runner materials as file:<path>
+func recordFileMaterial(opts *Options, path string) error {
+	digest, err := hash.SHA256ForFile(filepath.Join(opts.Workdir, path))
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", path, err)
+	}
+	if opts.Materials == nil {
+		opts.Materials = map[string]map[string]string{}
+	}
+	opts.Materials["file:"+filepath.ToSlash(filepath.Clean(path))] = map[string]string{"sha256": digest}
+	return nil
+}
+
+// findArtifactFiles returns the files matching the artifact paths (glob
+// patterns), relative to the workdir. Directories are added with all their
+// files. Files matching any of the exclude patterns are left out.
+func findArtifactFiles(workdir string, paths, exclude []string) ([]string, error) {
+	found := map[string]struct{}{}
+	for _, pattern := range paths {
+		matches, err := filepath.Glob(filepath.Join(workdir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("searching for %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			logrus.Warnf("No files found matching artifact path %s", pattern)
+		}
+		for _, match := range matches {
+			if err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(workdir, path)
+				if err != nil {
+					return fmt.Errorf("getting path relative to workdir: %w", err)
+				}
+				found[rel] = struct{}{}
+				return nil
+			}); err != nil {
+				return nil, fmt.Errorf("reading artifact path %s: %w", match, err)
+			}
+		}
+	}
+
+	files := []string{}
+	for file := range found {
+		excluded := false
+		for _, pattern := range exclude {
+			if m, err := filepath.Match(filepath.Clean(pattern), file); err == nil && m {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bazelCmd     = "bazel"
+	bazelMoniker = "bazel"
+
+	// bazelVersionParam is the parameter used to record the bazel version
+	// in the provenance invocation. It is never passed to bazel.
+	bazelVersionParam = "--mmbuild-bazel-version="
+)
+
+func init() {
+	MustRegister(bazelMoniker, NewBazel, "Builds bazel targets and collects their output files")
+}
+
+// Bazel runs bazel build on a list of targets. Arguments starting with a
+// dash are passed as flags, the rest are considered targets. After the
+// build, the runner queries bazel for the files produced by the targets
+// and adds them to the expected files.
+type Bazel struct {
+	baseRunner
+	version         string
+	expectedVersion string
+}
+
+func NewBazel(args ...string) Runner {
+	b := &Bazel{
+		baseRunner: baseRunner{
+			id:   bazelMoniker,
+			opts: DefaultOptions.Copy(),
+			args: []string{},
+		},
+	}
+	for _, a := range args {
+		if strings.HasPrefix(a, bazelVersionParam) {
+			b.expectedVersion = strings.TrimPrefix(a, bazelVersionParam)
+			continue
+		}
+		b.args = append(b.args, a)
+	}
+	return b
+}
+
+// Arguments returns the runner arguments and the bazel version, if known
+func (b *Bazel) Arguments() []string {
+	if b.version == "" {
+		return b.args
+	}
+	return append(append([]string{}, b.args...), bazelVersionParam+b.version)
+}
+
+// Run executes bazel build and queries the output files of the targets
+func (b *Bazel) Run() error {
+	version, err := b.commandOutput(bazelCmd, "--version")
+	if err != nil {
+		return fmt.Errorf("reading bazel version: %w", err)
+	}
+	b.version = strings.TrimSpace(strings.TrimPrefix(version, "bazel"))
+	if b.expectedVersion != "" && b.expectedVersion != b.version {
+		logrus.Warnf(
+			"Bazel version %s differs from expected version %s", b.version, b.expectedVersion,
+		)
+	}
+
+	if err := b.execute(append([]string{bazelCmd, "build"}, b.args...)); err != nil {
+		return err
+	}
+
+	output, err := b.commandOutput(
+		bazelCmd, append([]string{"cquery", "--output=files"}, b.args...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("querying bazel for target output files: %w", err)
+	}
+	files := parseBazelFiles(output)
+	logrus.Infof("Bazel targets produced %d files", len(files))
+	b.Options().ExpectedFiles = append(b.Options().ExpectedFiles, files...)
+	return nil
+}
+
+// parseBazelFiles reads the output of cquery --output=files
+func parseBazelFiles(output string) []string {
+	files := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "INFO:") || strings.HasPrefix(line, "Loading:") {
+			continue
+		}
+		files = append(files, line)
+	}
+	return files
+}
+
+// Describe returns the metadata of the runner. Bazel needs the targets
+// to build in its arguments.
+func (b *Bazel) Describe() *Description {
+	d := b.describe(bazelCmd)
+	d.RequiresArgs = true
+	return d
+}
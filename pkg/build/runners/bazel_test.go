@@ -0,0 +1,36 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBazelArguments(t *testing.T) {
+	b := NewBazel("--config=release", "//cmd/mattermost", bazelVersionParam+"5.0.0")
+	bz, ok := b.(*Bazel)
+	require.True(t, ok)
+
+	// The version parameter must not be passed to bazel
+	require.Equal(t, []string{"--config=release", "//cmd/mattermost"}, bz.args)
+	require.Equal(t, "5.0.0", bz.expectedVersion)
+
+	// Once the version is known, it is recorded in the arguments
+	require.Equal(t, []string{"--config=release", "//cmd/mattermost"}, b.Arguments())
+	bz.version = "5.0.0"
+	require.Equal(t, []string{"--config=release", "//cmd/mattermost", bazelVersionParam + "5.0.0"}, b.Arguments())
+}
+
+func TestParseBazelFiles(t *testing.T) {
+	output := "INFO: Analyzed target //cmd/mattermost:mattermost (0 packages loaded).\n" +
+		"bazel-out/k8-fastbuild/bin/cmd/mattermost/mattermost_/mattermost\n" +
+		"\n" +
+		"bazel-out/k8-fastbuild/bin/cmd/mattermost/mattermost.tar.gz\n"
+	require.Equal(t, []string{
+		"bazel-out/k8-fastbuild/bin/cmd/mattermost/mattermost_/mattermost",
+		"bazel-out/k8-fastbuild/bin/cmd/mattermost/mattermost.tar.gz",
+	}, parseBazelFiles(output))
+}
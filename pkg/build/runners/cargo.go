@@ -0,0 +1,109 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	cargoCmd     = "cargo"
+	cargoMoniker = "cargo"
+	cargoBuild   = "build" // Subcommand to run when none is specified
+
+	// cargoMessageFormat makes cargo report the artifacts it builds as
+	// JSON in stdout, while diagnostics are still rendered to stderr
+	cargoMessageFormat = "--message-format=json-render-diagnostics"
+)
+
+func init() {
+	MustRegister(cargoMoniker, NewCargo, "Builds and tests rust components with cargo")
+}
+
+// Cargo runs cargo to build or test rust components. The first argument
+// is the cargo subcommand (build by default), the rest are passed to it,
+// eg "build --release --target x86_64-unknown-linux-musl". When building,
+// the binaries produced by cargo are added to the expected files.
+type Cargo struct {
+	baseRunner
+}
+
+func NewCargo(args ...string) Runner {
+	return &Cargo{
+		baseRunner: baseRunner{
+			id:   cargoMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// Run executes cargo and collects the binaries it built
+func (c *Cargo) Run() error {
+	args := c.args
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{cargoBuild}, args...)
+	}
+	cmdLine := append([]string{cargoCmd, args[0], cargoMessageFormat}, args[1:]...)
+	output := &bytes.Buffer{}
+	if err := c.executeCapture(output, cmdLine); err != nil {
+		return err
+	}
+
+	// Only binaries from builds are artifacts, not test executables
+	if args[0] != cargoBuild {
+		return nil
+	}
+	files, err := parseCargoExecutables(output.String(), c.Options().Workdir)
+	if err != nil {
+		return fmt.Errorf("reading cargo build artifacts: %w", err)
+	}
+	logrus.Infof("Cargo built %d binaries", len(files))
+	c.Options().ExpectedFiles = append(c.Options().ExpectedFiles, files...)
+	return nil
+}
+
+// parseCargoExecutables reads the compiler-artifact messages printed by
+// cargo and returns the executables built, relative to the workdir
+func parseCargoExecutables(output, workdir string) ([]string, error) {
+	absWorkdir, err := filepath.Abs(workdir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving workdir path: %w", err)
+	}
+	files := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		msg := struct {
+			Reason     string  `json:"reason"`
+			Executable *string `json:"executable"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("parsing cargo message: %w", err)
+		}
+		if msg.Reason != "compiler-artifact" || msg.Executable == nil {
+			continue
+		}
+		rel, err := filepath.Rel(absWorkdir, *msg.Executable)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			logrus.Warnf("Cargo executable %s is outside of the workdir, not adding it", *msg.Executable)
+			continue
+		}
+		files = append(files, rel)
+	}
+	return files, nil
+}
+
+// Describe returns the metadata of the runner
+func (c *Cargo) Describe() *Description {
+	return c.describe(cargoCmd)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCargoRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// Fake cargo that records its arguments and reports a binary and a library
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cargo"), []byte(`#!/bin/sh
+echo "$@" >> cargo.log
+echo "   Compiling app v0.1.0" >&2
+echo '{"reason":"compiler-artifact","target":{"name":"applib"},"filenames":["`+dir+`/target/x86_64-unknown-linux-musl/release/libapp.rlib"],"executable":null}'
+echo '{"reason":"compiler-artifact","target":{"name":"app"},"filenames":["`+dir+`/target/x86_64-unknown-linux-musl/release/app"],"executable":"`+dir+`/target/x86_64-unknown-linux-musl/release/app"}'
+echo '{"reason":"build-finished","success":true}'
+`), os.FileMode(0o755)))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	c := NewCargo("--release", "--target", "x86_64-unknown-linux-musl")
+	c.Options().Workdir = dir
+	c.Options().ExpectedFiles = nil
+	require.NoError(t, c.Run())
+	require.Equal(t, []string{"target/x86_64-unknown-linux-musl/release/app"}, c.Options().ExpectedFiles)
+
+	// Test binaries are not artifacts
+	c = NewCargo("test", "--release")
+	c.Options().Workdir = dir
+	c.Options().ExpectedFiles = nil
+	require.NoError(t, c.Run())
+	require.Empty(t, c.Options().ExpectedFiles)
+
+	data, err := os.ReadFile(filepath.Join(dir, "cargo.log"))
+	require.NoError(t, err)
+	require.Equal(t,
+		"build "+cargoMessageFormat+" --release --target x86_64-unknown-linux-musl\n"+
+			"test "+cargoMessageFormat+" --release\n",
+		string(data),
+	)
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	compositeMoniker = "composite"
+
+	// compositeStepPrefix marks the start of a step in the composite
+	// runner arguments, eg: step:make package step:npm build
+	compositeStepPrefix = "step:"
+)
+
+func init() {
+	MustRegister(compositeMoniker, NewComposite, "Runs a sequence of runners as a single run")
+}
+
+// Composite is a runner that executes an ordered list of runners as a
+// single run. Execution stops at the first step that fails.
+type Composite struct {
+	baseRunner
+	Steps []Runner
+	err   error // Error creating the steps from the arguments
+}
+
+// NewComposite returns a composite runner from a list of arguments, see
+// ParseComposite. If the steps cannot be created, New returns the error
+// and the composite fails to run with it.
+func NewComposite(args ...string) Runner {
+	c, err := ParseComposite(args...)
+	if err != nil {
+		c = NewCompositeWithSteps()
+		c.err = err
+	}
+	return c
+}
+
+// ParseComposite returns a composite runner from a list of arguments. Each
+// step starts with an argument of the form step:<runner id>, followed by
+// the step arguments. Each step gets its own copy of the options.
+func ParseComposite(args ...string) (*Composite, error) {
+	c := NewCompositeWithSteps()
+	if len(args) > 0 && !strings.HasPrefix(args[0], compositeStepPrefix) {
+		return nil, fmt.Errorf("composite arguments must start with %s<runner id>, found %q", compositeStepPrefix, args[0])
+	}
+	for i := 0; i < len(args); {
+		stepID := strings.TrimPrefix(args[i], compositeStepPrefix)
+		stepArgs := []string{}
+		for i++; i < len(args) && !strings.HasPrefix(args[i], compositeStepPrefix); i++ {
+			stepArgs = append(stepArgs, args[i])
+		}
+		step, err := New(stepID, stepArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("creating composite step #%d (%s): %w", len(c.Steps), stepID, err)
+		}
+		if err := Isolate(step); err != nil {
+			return nil, fmt.Errorf("creating composite step #%d (%s): %w", len(c.Steps), stepID, err)
+		}
+		c.Steps = append(c.Steps, step)
+	}
+	return c, nil
+}
+
+// factoryError returns the error of creating the composite in New
+func (c *Composite) factoryError() error {
+	return c.err
+}
+
+// NewCompositeWithSteps returns a composite runner that executes steps
+func NewCompositeWithSteps(steps ...Runner) *Composite {
+	// The composite runner needs its own options as the step
+	// options are overwritten before running each step
+	return &Composite{
+		baseRunner: baseRunner{
+			id:   compositeMoniker,
+			opts: DefaultOptions.Copy(),
+			args: []string{},
+		},
+		Steps: steps,
+	}
+}
+
+// Arguments returns the arguments of all steps, each one preceded by the
+// step runner ID so the composite can be recreated from them
+func (c *Composite) Arguments() []string {
+	args := []string{}
+	for _, step := range c.Steps {
+		args = append(args, compositeStepPrefix+step.ID())
+		args = append(args, step.Arguments()...)
+	}
+	return args
+}
+
+// Run executes the steps in order. When logging is enabled, each step
+// writes to its own log file and its output is appended to the main log.
+func (c *Composite) Run() error {
+	if c.err != nil {
+		return c.err
+	}
+	if len(c.Steps) == 0 {
+		return errors.New("composite runner has no steps defined")
+	}
+	var deadline time.Time
+	if c.Options().Timeout > 0 {
+		deadline = time.Now().Add(c.Options().Timeout)
+	}
+	for i, step := range c.Steps {
+		stepOpts := *c.Options()
+		// Steps share the composite timeout, each gets the time left
+		if !deadline.IsZero() {
+			stepOpts.Timeout = time.Until(deadline)
+			if stepOpts.Timeout <= 0 {
+				return &TimeoutError{Command: step.ID(), Timeout: c.Options().Timeout}
+			}
+		}
+		stepOpts.ExpectedFiles = []string{}
+		stepOpts.ExpectedImages = []string{}
+		stepOpts.Log = stepLogPath(c.Options().Log, i, step.ID())
+		stepOpts.ErrorLog = stepLogPath(c.Options().ErrorLog, i, step.ID())
+		*step.Options() = stepOpts
+
+		logrus.Infof("Running composite step #%d (%s)", i, step.ID())
+		err := step.Run()
+		if lerr := c.appendStepLog(step.Options().Log); lerr != nil {
+			logrus.Warn(lerr)
+		}
+		c.output += step.Output()
+		if err != nil {
+			return fmt.Errorf("running step #%d (%s): %w", i, step.ID(), err)
+		}
+		c.Options().ExpectedFiles = append(c.Options().ExpectedFiles, step.Options().ExpectedFiles...)
+		c.Options().ExpectedImages = append(c.Options().ExpectedImages, step.Options().ExpectedImages...)
+	}
+	return nil
+}
+
+// appendStepLog copies the log of a step to the composite log
+func (c *Composite) appendStepLog(stepLog string) error {
+	if c.Options().Log == "" || stepLog == "" {
+		return nil
+	}
+	src, err := os.Open(stepLog)
+	if err != nil {
+		return fmt.Errorf("opening step log: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(c.Options().Log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.FileMode(0o644))
+	if err != nil {
+		return fmt.Errorf("opening composite log: %w", err)
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("appending step log: %w", err)
+	}
+	return nil
+}
+
+// stepLogPath returns the path to a step log derived from the main log
+func stepLogPath(logPath string, i int, id string) string {
+	if logPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-step%02d-%s.log", strings.TrimSuffix(logPath, ".log"), i, id)
+}
+
+// Describe merges the descriptions of the steps. It requires arguments
+// as it cannot run without steps.
+func (c *Composite) Describe() *Description {
+	d := c.describe()
+	d.RequiresArgs = true
+	tools := map[string]struct{}{}
+	artifacts := map[ArtifactType]struct{}{}
+	for _, step := range c.Steps {
+		sd := step.Describe()
+		for _, t := range sd.Tools {
+			tools[t] = struct{}{}
+		}
+		for _, a := range sd.Artifacts {
+			artifacts[a] = struct{}{}
+		}
+	}
+	d.Tools = []string{}
+	for t := range tools {
+		d.Tools = append(d.Tools, t)
+	}
+	sort.Strings(d.Tools)
+	d.Artifacts = []ArtifactType{}
+	for a := range artifacts {
+		d.Artifacts = append(d.Artifacts, a)
+	}
+	sort.Slice(d.Artifacts, func(i, j int) bool { return d.Artifacts[i] < d.Artifacts[j] })
+	return d
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompositeRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "composite-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: first second\nfirst:\n\techo \"first\" > first.txt\nsecond:\n\tcat first.txt > second.txt\n"),
+		os.FileMode(0o644)),
+	)
+
+	logFile, err := os.CreateTemp("", "composite-test-*.log")
+	require.NoError(t, err)
+	defer os.Remove(logFile.Name())
+
+	c := NewComposite("step:make", "first", "step:make", "second")
+	require.Len(t, c.(*Composite).Steps, 2)
+	require.Equal(t, []string{"step:make", "first", "step:make", "second"}, c.Arguments())
+
+	c.Options().Workdir = dir
+	c.Options().Log = logFile.Name()
+	require.NoError(t, c.Run())
+
+	// The second step reads the output of the first one
+	data, err := os.ReadFile(filepath.Join(dir, "second.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(data))
+
+	// Each step writes its own log
+	for i := range []int{0, 1} {
+		stepLog := stepLogPath(logFile.Name(), i, "make")
+		require.FileExists(t, stepLog)
+		os.Remove(stepLog)
+	}
+}
+
+func TestParseComposite(t *testing.T) {
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	// Steps that cannot be created are errors, not dropped
+	for _, args := range [][]string{
+		{"step:make", "build", "step:unknown-runner"},
+		{"build", "step:make"},
+	} {
+		_, err := ParseComposite(args...)
+		require.Error(t, err, args)
+		_, err = New(compositeMoniker, args...)
+		require.Error(t, err, args)
+		require.Error(t, NewComposite(args...).Run(), args)
+	}
+
+	// Each step has its own options, running the composite does not
+	// write them through the default options
+	c, err := ParseComposite("step:make", "build", "step:make", "package")
+	require.NoError(t, err)
+	require.Len(t, c.Steps, 2)
+	require.NotSame(t, DefaultOptions, c.Steps[0].Options())
+	require.NotSame(t, c.Steps[0].Options(), c.Steps[1].Options())
+	c.Options().Workdir = t.TempDir()
+	require.Error(t, c.Run())
+	require.Equal(t, defaultOpts.Workdir, DefaultOptions.Workdir)
+}
+
+func TestIsolate(t *testing.T) {
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	first := NewMake("build")
+	second := Containerize(NewMake("package"), "golang:1.17")
+	composite := NewCompositeWithSteps(NewMake("test"))
+
+	// Each runner starts with its own copy of the default options
+	require.NotSame(t, DefaultOptions, first.Options())
+	require.NotSame(t, first.Options(), second.Options())
+	first.Options().ExpectedFiles = append(first.Options().ExpectedFiles, "server.bin")
+	require.Empty(t, DefaultOptions.ExpectedFiles)
+	require.Empty(t, second.Options().ExpectedFiles)
+
+	for _, r := range []Runner{first, second, composite} {
+		require.NoError(t, Isolate(r))
+	}
+	require.NotSame(t, DefaultOptions, first.Options())
+	require.NotSame(t, first.Options(), second.Options())
+	require.NotSame(t, DefaultOptions, composite.Steps[0].Options())
+
+	// The isolated options do not share their maps
+	first.Options().EnvVars["VAR"] = "value"
+	require.NotContains(t, DefaultOptions.EnvVars, "VAR")
+	require.NotContains(t, second.Options().EnvVars, "VAR")
+}
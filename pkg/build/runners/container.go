@@ -0,0 +1,190 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/command"
+)
+
+const (
+	// ContainerEngineVar sets the container engine used by containerized
+	// runners when none is defined in their options
+	ContainerEngineVar     = "MMBUILD_CONTAINER_ENGINE"
+	defaultContainerEngine = "docker"
+)
+
+// ContainerOptions configures the container where runner commands execute
+type ContainerOptions struct {
+	Image  string   // Container image to run the commands in
+	Engine string   // Container engine CLI: docker, podman. Defaults to docker
+	Mounts []string // Additional volumes to mount in the container in src:dst[:opts] form
+}
+
+// engine returns the container engine command
+func (co *ContainerOptions) engine() string {
+	if co.Engine != "" {
+		return co.Engine
+	}
+	if e := os.Getenv(ContainerEngineVar); e != "" {
+		return e
+	}
+	return defaultContainerEngine
+}
+
+// rootless returns true if the containers run in a rootless podman
+func (co *ContainerOptions) rootless() bool {
+	return strings.TrimSuffix(filepath.Base(co.engine()), ".exe") == "podman" && os.Getuid() != 0
+}
+
+// Containerized is a runner decorator that executes the commands of the
+// runner it wraps inside a container. The working directory is bind
+// mounted at the same path in the container and the digest of the image
+// is recorded as a provenance material.
+type Containerized struct {
+	Runner
+	container ContainerOptions
+}
+
+// Containerize wraps runner so that its commands run in a container
+// created from image
+func Containerize(runner Runner, image string) *Containerized {
+	return &Containerized{
+		Runner:    runner,
+		container: ContainerOptions{Image: image},
+	}
+}
+
+// ContainerOptions returns the options of the runner container
+func (c *Containerized) ContainerOptions() *ContainerOptions {
+	return &c.container
+}
+
+// Run resolves the image digest and runs the wrapped runner with its
+// commands redirected to the container
+func (c *Containerized) Run() error {
+	return runInContainer(c.Options(), &c.container, c.Runner.Run)
+}
+
+// runInContainer records the digest of the container image in the
+// runner materials and calls run with the runner commands redirected
+// to the container
+func runInContainer(opts *Options, co *ContainerOptions, run func() error) error {
+	if co.Image == "" {
+		return errors.New("unable to run containerized runner, no image defined")
+	}
+	uri, digest, err := co.imageDigest()
+	if err != nil {
+		return fmt.Errorf("resolving container image digest: %w", err)
+	}
+	if opts.Materials == nil {
+		opts.Materials = map[string]map[string]string{}
+	}
+	opts.Materials[uri] = digest
+
+	opts.Container = co
+	defer func() { opts.Container = nil }()
+	return run()
+}
+
+// imageDigest pulls the image and returns its URI and digest
+func (co *ContainerOptions) imageDigest() (uri string, digest map[string]string, err error) {
+	engine := co.engine()
+	if err := command.New(engine, "pull", co.Image).RunSilentSuccess(); err != nil {
+		return "", nil, fmt.Errorf("pulling image %s: %w", co.Image, err)
+	}
+	output, err := command.New(
+		engine, "image", "inspect", "--format", "{{index .RepoDigests 0}}", co.Image,
+	).RunSilentSuccessOutput()
+	if err != nil {
+		return "", nil, fmt.Errorf("inspecting image %s: %w", co.Image, err)
+	}
+	return parseImageDigest(output.OutputTrimNL())
+}
+
+// parseImageDigest splits a repo digest (repo@sha256:hash) into a
+// material URI and its digest set
+func parseImageDigest(repoDigest string) (uri string, digest map[string]string, err error) {
+	parts := strings.SplitN(repoDigest, "@", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid image digest: %s", repoDigest)
+	}
+	hashParts := strings.SplitN(parts[1], ":", 2)
+	if len(hashParts) != 2 || hashParts[1] == "" {
+		return "", nil, fmt.Errorf("invalid image digest: %s", repoDigest)
+	}
+	return "docker://" + parts[0], map[string]string{hashParts[0]: hashParts[1]}, nil
+}
+
+// containerCommand returns the command line that executes cmdLine in the
+// container defined in the options
+func (br *baseRunner) containerCommand(cmdLine []string) []string {
+	co := br.Options().Container
+	wrapped := []string{
+		co.engine(), "run", "--rm",
+		"-v", fmt.Sprintf("%s:%s", br.Options().Workdir, br.Options().Workdir),
+		"-w", br.Options().Workdir,
+	}
+	for _, m := range co.Mounts {
+		wrapped = append(wrapped, "-v", m)
+	}
+
+	// Keep stdin open when the commands get input
+	if br.Options().Input.enabled() {
+		wrapped = append(wrapped, "--interactive")
+	}
+
+	// Run as the current user to keep the ownership of the files written
+	// to the workdir. Rootless podman maps it with a user namespace.
+	switch uid := os.Getuid(); {
+	case uid < 0:
+		// No uids on windows
+	case co.rootless():
+		wrapped = append(wrapped, "--userns=keep-id")
+	default:
+		wrapped = append(wrapped, "--user", fmt.Sprintf("%d:%d", uid, os.Getgid()))
+	}
+
+	// Limits on the engine client would not reach the container processes
+	if limits := br.Options().Limits; limits.enabled() {
+		if limits.CPUs > 0 {
+			wrapped = append(wrapped, "--cpus", strconv.FormatFloat(limits.CPUs, 'f', -1, 64))
+		}
+		if limits.MemoryBytes > 0 {
+			wrapped = append(wrapped, "--memory", strconv.FormatInt(limits.MemoryBytes, 10))
+		}
+		if limits.MaxProcesses > 0 {
+			wrapped = append(wrapped, "--pids-limit", strconv.Itoa(limits.MaxProcesses))
+		}
+	}
+
+	// Pass the runner environment to the container in a stable order
+	vars := []string{}
+	for v := range br.Options().EnvVars {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	for _, v := range vars {
+		wrapped = append(wrapped, "-e", fmt.Sprintf("%s=%s", v, br.Options().EnvVars[v]))
+	}
+	wrapped = append(wrapped, co.Image)
+	logrus.Debugf("Running %v in container %s", cmdLine, co.Image)
+	return append(wrapped, cmdLine...)
+}
+
+// Describe returns the description of the wrapped runner. Its tools run
+// in the container, so only the container engine is needed in the host.
+func (c *Containerized) Describe() *Description {
+	d := c.Runner.Describe()
+	d.Tools = []string{c.container.engine()}
+	return d
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageDigest(t *testing.T) {
+	uri, digest, err := parseImageDigest("registry.example.com/builder@sha256:abc123")
+	require.NoError(t, err)
+	require.Equal(t, "docker://registry.example.com/builder", uri)
+	require.Equal(t, map[string]string{"sha256": "abc123"}, digest)
+
+	for _, invalid := range []string{"", "registry.example.com/builder", "builder@sha256", "builder@sha256:"} {
+		_, _, err := parseImageDigest(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestContainerizedRun(t *testing.T) {
+	dir := t.TempDir()
+	const image = "registry.example.com/builder:1.0"
+
+	// The fake engine records its arguments and runs the
+	// command after the image name in the host
+	engine := filepath.Join(dir, "engine.sh")
+	require.NoError(t, os.WriteFile(engine, []byte(`#!/bin/sh
+echo "$@" >> `+filepath.Join(dir, "engine.log")+`
+case "$1" in
+pull) exit 0 ;;
+image) echo "registry.example.com/builder@sha256:abc123" ;;
+run)
+	while [ "$1" != "`+image+`" ]; do shift; done
+	shift
+	exec "$@" ;;
+esac
+`), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: build\nbuild:\n\techo $$TARGET > output.txt\n"),
+		os.FileMode(0o644)),
+	)
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	c := Containerize(NewMake("build"), image)
+	c.ContainerOptions().Engine = engine
+	c.Options().Workdir = dir
+	c.Options().EnvVars = map[string]string{"TARGET": "linux"}
+	require.Equal(t, makeMoniker, c.ID())
+	require.NoError(t, c.Run())
+	require.Nil(t, c.Options().Container)
+
+	data, err := os.ReadFile(filepath.Join(dir, "output.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "linux\n", string(data))
+
+	// The image digest is recorded as a material
+	require.Equal(t, map[string]string{"sha256": "abc123"}, c.Options().Materials["docker://registry.example.com/builder"])
+
+	log, err := os.ReadFile(filepath.Join(dir, "engine.log"))
+	require.NoError(t, err)
+	require.Contains(t, string(log), "pull "+image)
+	require.Contains(t, string(log), "run --rm -v "+dir+":"+dir+" -w "+dir)
+	require.Contains(t, string(log), "-e TARGET=linux "+image+" make build")
+}
+
+func TestPodmanRun(t *testing.T) {
+	dir := t.TempDir()
+	const image = "registry.example.com/builder:1.0"
+
+	// Fake podman engine that runs the command in the host
+	engine := filepath.Join(dir, "podman")
+	require.NoError(t, os.WriteFile(engine, []byte(`#!/bin/sh
+echo "$@" >> `+filepath.Join(dir, "engine.log")+`
+case "$1" in
+pull) exit 0 ;;
+image) echo "registry.example.com/builder@sha256:def456" ;;
+run)
+	while [ "$1" != "`+image+`" ]; do shift; done
+	shift
+	exec "$@" ;;
+esac
+`), os.FileMode(0o755)))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	r, err := New(podmanMoniker, image, "sh", "-c", "echo $TARGET > output.txt")
+	require.NoError(t, err)
+	p, ok := r.(*Podman)
+	require.True(t, ok)
+	require.Equal(t, podmanCmd, p.ContainerOptions().Engine)
+	p.ContainerOptions().Engine = engine
+	p.ContainerOptions().Mounts = []string{"/var/cache/go:/go/pkg:ro"}
+	p.Options().Workdir = dir
+	p.Options().EnvVars = map[string]string{"TARGET": "linux"}
+	require.NoError(t, p.Run())
+
+	data, err := os.ReadFile(filepath.Join(dir, "output.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "linux\n", string(data))
+	require.Equal(t, map[string]string{"sha256": "def456"}, p.Options().Materials["docker://registry.example.com/builder"])
+
+	log, err := os.ReadFile(filepath.Join(dir, "engine.log"))
+	require.NoError(t, err)
+	require.Contains(t, string(log), "-v /var/cache/go:/go/pkg:ro")
+	require.Contains(t, string(log), "-e TARGET=linux "+image+" sh -c echo $TARGET > output.txt")
+
+	// An image is required
+	require.Error(t, NewPodman().Run())
+}
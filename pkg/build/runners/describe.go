@@ -0,0 +1,65 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// ArtifactType is a kind of artifact a runner can produce
+type ArtifactType string
+
+const (
+	ArtifactFiles  ArtifactType = "files"  // Files written to the working directory
+	ArtifactImages ArtifactType = "images" // Container images pushed to a registry
+)
+
+// Description is the metadata of a runner. It lets the build system
+// check a runner can work before executing it.
+type Description struct {
+	ID           string         // ID of the runner
+	Tools        []string       // Executables the runner calls, they must be found in the PATH
+	Options      []string       // Names of the Options fields the runner honors
+	Artifacts    []ArtifactType // Kinds of artifacts the runner produces
+	RequiresArgs bool           // True if the runner cannot run without arguments
+}
+
+// commandOptions are the options honored by the runners that execute
+// their commands with the base runner
+var commandOptions = []string{
+	"Workdir", "EnvVars", "CleanEnv", "EnvAllowlist", "Log", "ErrorLog", "Timeout",
+	"OutputWriters", "ErrorWriters", "LineCallback", "Container", "Limits", "Input",
+	"SecretVars", "MaskedValues", "MaskedPatterns",
+}
+
+// describe returns the description of a runner executing tools with
+// the base runner and producing files
+func (br *baseRunner) describe(tools ...string) *Description {
+	return &Description{
+		ID:        br.id,
+		Tools:     tools,
+		Options:   append([]string{}, commandOptions...),
+		Artifacts: []ArtifactType{ArtifactFiles},
+	}
+}
+
+// Validate checks a runner can be executed: its tools are found in the
+// PATH and it has the arguments it requires
+func Validate(r Runner) error {
+	d := r.Describe()
+	if d.RequiresArgs && len(r.Arguments()) == 0 {
+		return fmt.Errorf("runner %s requires arguments but none are set", d.ID)
+	}
+	missing := []string{}
+	for _, tool := range d.Tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	if len(missing) > 0 {
+		return &ToolNotFoundError{Runner: d.ID, Tools: missing}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	d := NewKo().Describe()
+	require.Equal(t, koMoniker, d.ID)
+	require.Equal(t, []string{koCmd}, d.Tools)
+	require.Equal(t, []ArtifactType{ArtifactImages}, d.Artifacts)
+	require.Contains(t, d.Options, "Timeout")
+
+	// Composites merge the descriptions of their steps
+	d = NewCompositeWithSteps(NewMake(), NewNPM(), NewKo(), NewMake()).Describe()
+	require.Equal(t, []string{koCmd, makeCmd, npmCmd}, d.Tools)
+	require.Equal(t, []ArtifactType{ArtifactFiles, ArtifactImages}, d.Artifacts)
+	require.True(t, d.RequiresArgs)
+
+	// Containerized runners only need the engine in the host
+	c := Containerize(NewCargo(), "rust:1.57")
+	c.ContainerOptions().Engine = podmanCmd
+	d = c.Describe()
+	require.Equal(t, cargoMoniker, d.ID)
+	require.Equal(t, []string{podmanCmd}, d.Tools)
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bazel"), []byte("#!/bin/sh\n"), os.FileMode(0o755)))
+	t.Setenv("PATH", dir)
+
+	require.NoError(t, Validate(NewBazel("//cmd/server")))
+
+	// Bazel needs targets
+	err := Validate(NewBazel())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires arguments")
+
+	// Missing tools are reported
+	err = Validate(NewCompositeWithSteps(NewBazel("//..."), NewCargo(), NewTox()))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "needs cargo, tox")
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package runners implements the tools that execute the builds, like
+// make, npm or the container runners.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt. New runners can be added at any time, existing
+// ones keep their IDs and arguments.
+package runners
@@ -0,0 +1,105 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import "fmt"
+
+const (
+	dockerCmd     = "docker"
+	dockerMoniker = "docker"
+	podmanCmd     = "podman"
+	podmanMoniker = "podman"
+)
+
+func init() {
+	MustRegister(dockerMoniker, NewDocker, "Runs a command in a docker container")
+	MustRegister(podmanMoniker, NewPodman, "Runs a command in a podman container")
+}
+
+// Docker is a runner that executes a command in a container. The first
+// argument is the image, the rest are the command to run in it. When no
+// command is given, the image default command runs. The working directory
+// is mounted in the container and the environment variables are passed
+// to it.
+type Docker struct {
+	baseRunner
+	container ContainerOptions
+}
+
+func NewDocker(args ...string) Runner {
+	return &Docker{
+		baseRunner: baseRunner{
+			id:   dockerMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+		container: ContainerOptions{Engine: dockerCmd},
+	}
+}
+
+// ContainerOptions returns the options of the runner container
+func (d *Docker) ContainerOptions() *ContainerOptions {
+	return &d.container
+}
+
+// Run executes the command in the container
+func (d *Docker) Run() error {
+	return d.runContainer(&d.container)
+}
+
+// Podman is the podman variant of the docker runner. It supports rootless
+// builds on hosts where docker is not available.
+type Podman struct {
+	baseRunner
+	container ContainerOptions
+}
+
+func NewPodman(args ...string) Runner {
+	return &Podman{
+		baseRunner: baseRunner{
+			id:   podmanMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+		container: ContainerOptions{Engine: podmanCmd},
+	}
+}
+
+// ContainerOptions returns the options of the runner container
+func (p *Podman) ContainerOptions() *ContainerOptions {
+	return &p.container
+}
+
+// Run executes the command in the container
+func (p *Podman) Run() error {
+	return p.runContainer(&p.container)
+}
+
+// runContainer runs the command in the arguments inside the image
+// set in the first one
+func (br *baseRunner) runContainer(co *ContainerOptions) error {
+	if len(br.args) == 0 || br.args[0] == "" {
+		return fmt.Errorf("%s runner needs an image to run", br.ID())
+	}
+	co.Image = br.args[0]
+	return runInContainer(br.Options(), co, func() error {
+		return br.execute(br.args[1:])
+	})
+}
+
+// Describe returns the metadata of the runner. The first argument, the
+// image, is required.
+func (d *Docker) Describe() *Description {
+	desc := d.describe(d.container.engine())
+	desc.RequiresArgs = true
+	return desc
+}
+
+// Describe returns the metadata of the runner. The first argument, the
+// image, is required.
+func (p *Podman) Describe() *Description {
+	desc := p.describe(p.container.engine())
+	desc.RequiresArgs = true
+	return desc
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// Sentinel errors to classify runner failures with errors.Is, eg to
+// decide if a failed build should be retried. The typed errors carry the
+// details and can be extracted with errors.As.
+var (
+	ErrToolNotFound  = errors.New("runner tool not found")
+	ErrExitCode      = errors.New("runner command exited with an error")
+	ErrSignaled      = errors.New("runner command was killed by a signal")
+	ErrTimeout       = errors.New("runner timed out")
+	ErrResourceLimit = errors.New("runner exceeded a resource limit")
+)
+
+// ToolNotFoundError is returned when the executables a runner calls
+// cannot be found
+type ToolNotFoundError struct {
+	Runner string   // ID of the runner, empty if the error was found when running a command
+	Tools  []string // Executables not found
+	Err    error    // Error returned when starting the command, if any
+}
+
+func (e *ToolNotFoundError) Error() string {
+	if e.Runner != "" {
+		return fmt.Sprintf("runner %s needs %s but it was not found in the PATH", e.Runner, strings.Join(e.Tools, ", "))
+	}
+	return fmt.Sprintf("%s: %s: %v", ErrToolNotFound, strings.Join(e.Tools, ", "), e.Err)
+}
+
+// Is makes the error match ErrToolNotFound
+func (e *ToolNotFoundError) Is(target error) bool {
+	return target == ErrToolNotFound
+}
+
+func (e *ToolNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// ExitError is returned when a runner command exits with a non-zero code
+type ExitError struct {
+	Command string // Command line that failed
+	Code    int    // Exit code of the command
+	Err     error  // Error returned by the command
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("running %s: exit status %d", e.Command, e.Code)
+}
+
+// Is makes the error match ErrExitCode
+func (e *ExitError) Is(target error) bool {
+	return target == ErrExitCode
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// SignalError is returned when a runner command is killed by a signal
+// it did not expect, eg by the OOM killer
+type SignalError struct {
+	Command string         // Command line that was killed
+	Signal  syscall.Signal // Signal that terminated the command
+	Err     error          // Error returned by the command
+}
+
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("running %s: killed by signal %s", e.Command, e.Signal)
+}
+
+// Is makes the error match ErrSignaled
+func (e *SignalError) Is(target error) bool {
+	return target == ErrSignaled
+}
+
+func (e *SignalError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is returned when the context of the runner is done while
+// a command runs. It wraps the context error, so it matches
+// context.Canceled or context.DeadlineExceeded.
+type CanceledError struct {
+	Command string // Command line that was killed
+	Err     error  // Error of the context
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("running %s: %v", e.Command, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the error match ErrTimeout
+func (te *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// Is makes the error match ErrResourceLimit
+func (re *ResourceLimitError) Is(target error) bool {
+	return target == ErrResourceLimit
+}
+
+// startError classifies the error returned when starting a command
+func startError(cmd *exec.Cmd, err error) error {
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return &ToolNotFoundError{Tools: []string{cmd.Path}, Err: err}
+	}
+	return fmt.Errorf("starting %s: %w", cmd.Path, err)
+}
+
+// commandError classifies the error returned when a command fails
+func commandError(cmdLine string, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("running %s: %w", cmdLine, err)
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return &SignalError{Command: cmdLine, Signal: status.Signal(), Err: err}
+	}
+	return &ExitError{Command: cmdLine, Code: exitErr.ExitCode(), Err: err}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+//go:build !windows
+// +build !windows
+
+package runners
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerErrors(t *testing.T) {
+	br := &baseRunner{id: "test", opts: &Options{Workdir: t.TempDir()}}
+
+	err := br.execute([]string{"mmbuild-missing-tool"})
+	require.True(t, errors.Is(err, ErrToolNotFound))
+	var toolErr *ToolNotFoundError
+	require.True(t, errors.As(err, &toolErr))
+	require.Equal(t, []string{"mmbuild-missing-tool"}, toolErr.Tools)
+
+	err = br.execute([]string{"sh", "-c", "exit 3"})
+	require.True(t, errors.Is(err, ErrExitCode))
+	var exitErr *ExitError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, 3, exitErr.Code)
+	require.Equal(t, "sh -c exit 3", exitErr.Command)
+
+	err = br.execute([]string{"sh", "-c", "kill -KILL $$"})
+	require.True(t, errors.Is(err, ErrSignaled))
+	require.False(t, errors.Is(err, ErrExitCode))
+	var signalErr *SignalError
+	require.True(t, errors.As(err, &signalErr))
+	require.Equal(t, syscall.SIGKILL, signalErr.Signal)
+
+	br.opts.Timeout = 100 * time.Millisecond
+	err = br.execute([]string{"sleep", "5"})
+	require.True(t, errors.Is(err, ErrTimeout))
+
+	// Commands are killed when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	br.opts.Timeout = 0
+	br.opts.Context = ctx
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = br.execute([]string{"sleep", "5"}, []string{"true"})
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.True(t, errors.Is(err, context.Canceled))
+	var canceledErr *CanceledError
+	require.True(t, errors.As(err, &canceledErr))
+	require.Equal(t, "sleep 5", canceledErr.Command)
+	require.Error(t, br.execute([]string{"true"}))
+
+	// Runners are validated before running
+	m := NewMake("build")
+	defaultOpts := *m.Options()
+	defer func() { *m.Options() = defaultOpts }()
+	t.Setenv("PATH", t.TempDir())
+	err = Validate(m)
+	require.True(t, errors.As(err, &toolErr))
+	require.Equal(t, "make", toolErr.Runner)
+	require.Equal(t, []string{"make"}, toolErr.Tools)
+}
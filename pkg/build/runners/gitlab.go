@@ -0,0 +1,317 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	gitlabMoniker = "gitlab"
+	gitlabShell   = "bash"
+	gitlabCIFile  = ".gitlab-ci.yml" // Pipeline file read when none is specified
+
+	// gitlabMaxExtends is the maximum nesting of extends, same as GitLab
+	gitlabMaxExtends = 11
+)
+
+// gitlabGlobalKeys are the top level keys of a pipeline that are not jobs
+var gitlabGlobalKeys = map[string]bool{
+	"default": true, "include": true, "stages": true, "variables": true,
+	"workflow": true, "image": true, "services": true, "cache": true,
+	"before_script": true, "after_script": true,
+}
+
+func init() {
+	MustRegister(gitlabMoniker, NewGitLab, "Runs a job from a GitLab CI pipeline file")
+}
+
+// GitLab runs a job defined in a GitLab CI pipeline file. The first
+// argument is the job name, the second one the path to the pipeline file
+// relative to the workdir (.gitlab-ci.yml by default).
+//
+// The job before_script and script run in a single shell session, the
+// after_script runs afterwards even if the script fails. The job variables
+// are set in the environment, the runner EnvVars take precedence over
+// them. The files matching artifacts:paths are added to the expected files.
+type GitLab struct {
+	baseRunner
+}
+
+func NewGitLab(args ...string) Runner {
+	return &GitLab{
+		baseRunner: baseRunner{
+			id:   gitlabMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// GitLabJob is the part of a GitLab CI job definition the runner executes
+type GitLabJob struct {
+	Name         string            `yaml:"-"`
+	BeforeScript gitlabScript      `yaml:"before_script"`
+	Script       gitlabScript      `yaml:"script"`
+	AfterScript  gitlabScript      `yaml:"after_script"`
+	Variables    map[string]string `yaml:"-"`
+	Artifacts    struct {
+		Paths   []string `yaml:"paths"`
+		Exclude []string `yaml:"exclude"`
+	} `yaml:"artifacts"`
+}
+
+// gitlabScript is a list of script lines. GitLab accepts a single string
+// or a list of lines, which can be nested when using YAML anchors.
+type gitlabScript []string
+
+func (s *gitlabScript) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		*s = append(*s, value.Value)
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if err := s.UnmarshalYAML(item); err != nil {
+				return err
+			}
+		}
+	case yaml.AliasNode:
+		return s.UnmarshalYAML(value.Alias)
+	default:
+		return fmt.Errorf("line %d: script must be a string or a list of strings", value.Line)
+	}
+	return nil
+}
+
+// ParseGitLabJob reads the definition of a job from GitLab CI pipeline
+// data. Templates pulled with extends are merged into the job, and the
+// global variables and default scripts are applied to it.
+func ParseGitLabJob(data []byte, name string) (*GitLabJob, error) {
+	pipeline := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &pipeline); err != nil {
+		return nil, fmt.Errorf("parsing pipeline: %w", err)
+	}
+	if _, ok := pipeline["include"]; ok {
+		logrus.Warn("GitLab pipeline includes other files, they are not read by the runner")
+	}
+	if gitlabGlobalKeys[name] {
+		return nil, fmt.Errorf("%s is not a job name", name)
+	}
+	definition, err := resolveGitLabJob(pipeline, name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the global definitions the job does not override
+	defaults, ok := pipeline["default"].(map[string]interface{})
+	if !ok {
+		defaults = map[string]interface{}{}
+	}
+	for _, key := range []string{"before_script", "after_script"} {
+		if _, ok := definition[key]; ok {
+			continue
+		}
+		if v, ok := defaults[key]; ok {
+			definition[key] = v
+		} else if v, ok := pipeline[key]; ok {
+			definition[key] = v
+		}
+	}
+
+	// Decode the merged definition into the job
+	merged, err := yaml.Marshal(definition)
+	if err != nil {
+		return nil, fmt.Errorf("encoding job definition: %w", err)
+	}
+	job := &GitLabJob{Name: name}
+	if err := yaml.Unmarshal(merged, job); err != nil {
+		return nil, fmt.Errorf("parsing job %s: %w", name, err)
+	}
+	if len(job.Script) == 0 {
+		return nil, fmt.Errorf("job %s has no script", name)
+	}
+
+	job.Variables = map[string]string{}
+	for _, vars := range []interface{}{pipeline["variables"], definition["variables"]} {
+		if err := parseGitLabVariables(vars, job.Variables); err != nil {
+			return nil, fmt.Errorf("parsing variables of job %s: %w", name, err)
+		}
+	}
+	return job, nil
+}
+
+// resolveGitLabJob returns the definition of a job with the jobs and
+// templates it extends merged into it
+func resolveGitLabJob(pipeline map[string]interface{}, name string, depth int) (map[string]interface{}, error) {
+	if depth > gitlabMaxExtends {
+		return nil, fmt.Errorf("job %s: extends nesting is too deep", name)
+	}
+	definition, ok := pipeline[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("job %s not found in pipeline", name)
+	}
+
+	parents := []string{}
+	switch extends := definition["extends"].(type) {
+	case nil:
+	case string:
+		parents = append(parents, extends)
+	case []interface{}:
+		for _, p := range extends {
+			parents = append(parents, fmt.Sprint(p))
+		}
+	default:
+		return nil, fmt.Errorf("job %s: extends must be a string or a list", name)
+	}
+
+	// Parents are merged in order, the job definition goes last
+	resolved := map[string]interface{}{}
+	for _, parent := range parents {
+		pdef, err := resolveGitLabJob(pipeline, parent, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("extending job %s: %w", name, err)
+		}
+		mergeGitLabMaps(resolved, pdef)
+	}
+	mergeGitLabMaps(resolved, definition)
+	delete(resolved, "extends")
+	return resolved, nil
+}
+
+// mergeGitLabMaps deep merges src into dst like GitLab does with extends:
+// maps are merged, any other value (lists included) is replaced
+func mergeGitLabMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeGitLabMaps(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			copied := map[string]interface{}{}
+			mergeGitLabMaps(copied, srcMap)
+			v = copied
+		}
+		dst[k] = v
+	}
+}
+
+// parseGitLabVariables adds the variables defined in vars to values.
+// Variables are defined as a value or as a map with a value key.
+func parseGitLabVariables(vars interface{}, values map[string]string) error {
+	if vars == nil {
+		return nil
+	}
+	varMap, ok := vars.(map[string]interface{})
+	if !ok {
+		return errors.New("variables must be a map")
+	}
+	for name, v := range varMap {
+		if detailed, ok := v.(map[string]interface{}); ok {
+			v = detailed["value"]
+		}
+		if v == nil {
+			values[name] = ""
+			continue
+		}
+		values[name] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// Run parses the job and executes its scripts
+func (g *GitLab) Run() error {
+	if len(g.args) == 0 {
+		return errors.New("gitlab runner needs the name of the job to run")
+	}
+	ciFile := gitlabCIFile
+	if len(g.args) > 1 {
+		ciFile = g.args[1]
+	}
+	ciPath := filepath.Join(g.Options().Workdir, ciFile)
+	data, err := os.ReadFile(ciPath)
+	if err != nil {
+		return fmt.Errorf("reading GitLab pipeline file: %w", err)
+	}
+	job, err := ParseGitLabJob(data, g.args[0])
+	if err != nil {
+		return fmt.Errorf("reading job from %s: %w", ciFile, err)
+	}
+
+	// The pipeline file defines the build, record it as a material
+	if err := recordFileMaterial(g.Options(), ciFile); err != nil {
+		return err
+	}
+
+	// Options are shared, so the job environment is set only while it runs
+	env, err := g.jobEnvironment(job)
+	if err != nil {
+		return err
+	}
+	savedEnv := g.Options().EnvVars
+	g.Options().EnvVars = env
+	defer func() { g.Options().EnvVars = savedEnv }()
+
+	logrus.Infof("Running GitLab job %s from %s", job.Name, ciFile)
+	session, err := g.newSession(nil)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+	script := append(append([]string{}, job.BeforeScript...), job.Script...)
+	runErr := session.run([]string{gitlabShell, "-e", "-o", "pipefail", "-c", strings.Join(script, "\n")})
+	if len(job.AfterScript) > 0 {
+		// GitLab does not fail the job when after_script fails
+		if err := session.run([]string{gitlabShell, "-c", strings.Join(job.AfterScript, "\n")}); err != nil {
+			logrus.Warnf("GitLab job after_script failed: %v", err)
+		}
+	}
+	if runErr != nil {
+		return fmt.Errorf("running GitLab job %s: %w", job.Name, runErr)
+	}
+
+	files, err := findArtifactFiles(g.Options().Workdir, job.Artifacts.Paths, job.Artifacts.Exclude)
+	if err != nil {
+		return fmt.Errorf("collecting job artifacts: %w", err)
+	}
+	logrus.Infof("GitLab job %s produced %d artifacts", job.Name, len(files))
+	g.Options().ExpectedFiles = append(g.Options().ExpectedFiles, files...)
+	return nil
+}
+
+// jobEnvironment returns the variables of the job merged with the
+// predefined CI variables and the runner EnvVars
+func (g *GitLab) jobEnvironment(job *GitLabJob) (map[string]string, error) {
+	projectDir, err := filepath.Abs(g.Options().Workdir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving workdir path: %w", err)
+	}
+	env := map[string]string{
+		"CI":             "true",
+		"CI_JOB_NAME":    job.Name,
+		"CI_PROJECT_DIR": projectDir,
+	}
+	for k, v := range job.Variables {
+		env[k] = v
+	}
+	for k, v := range g.Options().EnvVars {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// Describe returns the metadata of the runner
+func (g *GitLab) Describe() *Description {
+	d := g.describe(gitlabShell)
+	d.RequiresArgs = true
+	return d
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testGitLabPipeline = `
+variables:
+  GOFLAGS: -mod=readonly
+  VERSION: "1.0"
+
+default:
+  before_script:
+    - echo default before
+
+.build-template:
+  variables:
+    TARGET: linux
+    VERSION:
+      value: "2.0"
+      description: Version to build
+  artifacts:
+    paths:
+      - dist/
+    exclude:
+      - dist/*.tmp
+
+build:
+  extends: .build-template
+  variables:
+    TARGET: darwin
+  script:
+    - mkdir -p dist
+    - echo "$TARGET $VERSION $GOFLAGS $CI_JOB_NAME" > dist/app
+    - touch dist/scratch.tmp
+  after_script: echo cleanup > after.log
+
+test:
+  before_script: []
+  script: exit 3
+  after_script:
+    - echo ran >> after.log
+`
+
+func TestParseGitLabJob(t *testing.T) {
+	job, err := ParseGitLabJob([]byte(testGitLabPipeline), "build")
+	require.NoError(t, err)
+	require.Equal(t, "build", job.Name)
+	require.Equal(t, gitlabScript{"echo default before"}, job.BeforeScript)
+	require.Len(t, job.Script, 3)
+	require.Equal(t, gitlabScript{"echo cleanup > after.log"}, job.AfterScript)
+	require.Equal(t, map[string]string{
+		"GOFLAGS": "-mod=readonly", "VERSION": "2.0", "TARGET": "darwin",
+	}, job.Variables)
+	require.Equal(t, []string{"dist/"}, job.Artifacts.Paths)
+	require.Equal(t, []string{"dist/*.tmp"}, job.Artifacts.Exclude)
+
+	// An empty before_script in the job overrides the default
+	job, err = ParseGitLabJob([]byte(testGitLabPipeline), "test")
+	require.NoError(t, err)
+	require.Empty(t, job.BeforeScript)
+	require.Equal(t, gitlabScript{"exit 3"}, job.Script)
+
+	for _, name := range []string{"deploy", "variables"} {
+		_, err = ParseGitLabJob([]byte(testGitLabPipeline), name)
+		require.Error(t, err, name)
+	}
+	_, err = ParseGitLabJob([]byte("a:\n  extends: b\nb:\n  extends: a\n"), "a")
+	require.Error(t, err)
+}
+
+func TestGitLabRun(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ci.yml"), []byte(testGitLabPipeline), os.FileMode(0o644)))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	g := NewGitLab("build", "ci.yml")
+	g.Options().Workdir = dir
+	g.Options().ExpectedFiles = nil
+	g.Options().Materials = nil
+	g.Options().EnvVars = map[string]string{"GOFLAGS": "-mod=vendor"}
+	require.NoError(t, g.Run())
+	require.Equal(t, []string{filepath.Join("dist", "app")}, g.Options().ExpectedFiles)
+	require.Contains(t, g.Options().Materials, "file:ci.yml")
+
+	// Runner variables take precedence over the job ones and are restored
+	data, err := os.ReadFile(filepath.Join(dir, "dist", "app"))
+	require.NoError(t, err)
+	require.Equal(t, "darwin 2.0 -mod=vendor build\n", string(data))
+	require.Equal(t, map[string]string{"GOFLAGS": "-mod=vendor"}, g.Options().EnvVars)
+
+	// after_script runs even when the script fails
+	require.NoError(t, os.Remove(filepath.Join(dir, "after.log")))
+	g = NewGitLab("test", "ci.yml")
+	g.Options().Workdir = dir
+	require.Error(t, g.Run())
+	data, err = os.ReadFile(filepath.Join(dir, "after.log"))
+	require.NoError(t, err)
+	require.Equal(t, "ran\n", string(data))
+
+	require.Error(t, NewGitLab().Run())
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// redactedInput replaces secret responses in the run log
+const redactedInput = "********"
+
+// InputOptions control the standard input of the runner commands. By
+// default commands get no input, scripts prompting for confirmation can
+// be attached to the stdin of the build process or fed canned responses.
+type InputOptions struct {
+	Passthrough bool            // Attach the stdin of the build process to the commands. The input is not recorded
+	Responses   []InputResponse // Responses written to the stdin of each command, one per line
+}
+
+// InputResponse is a line written to the standard input of a command
+type InputResponse struct {
+	Text   string // Text of the response, without the line feed
+	Secret bool   // When true, the response is redacted in the run log
+}
+
+// enabled returns true if the commands get any input
+func (in *InputOptions) enabled() bool {
+	return in != nil && (in.Passthrough || len(in.Responses) > 0)
+}
+
+// validate checks the input options are consistent
+func (in *InputOptions) validate() error {
+	if in != nil && in.Passthrough && len(in.Responses) > 0 {
+		return errors.New("runner input cannot be passed through and have canned responses at the same time")
+	}
+	return nil
+}
+
+// commandInput returns the reader to use as the standard input of a
+// command. The responses it feeds are recorded in log, redacting the
+// secret ones.
+func (br *baseRunner) commandInput(log io.Writer) io.Reader {
+	in := br.Options().Input
+	switch {
+	case !in.enabled():
+		return nil
+	case in.Passthrough:
+		fmt.Fprintln(log, "[stdin] attached to the terminal, input is not recorded")
+		return os.Stdin
+	}
+	input := strings.Builder{}
+	for _, r := range in.Responses {
+		input.WriteString(r.Text + "\n")
+		if r.Secret {
+			fmt.Fprintln(log, "[stdin] "+redactedInput)
+		} else {
+			fmt.Fprintln(log, "[stdin] "+r.Text)
+		}
+	}
+	return strings.NewReader(input.String())
+}
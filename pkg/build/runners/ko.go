@@ -0,0 +1,84 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	koCmd       = "ko"
+	koMoniker   = "ko"
+	koPackages  = "./..." // Packages to build when none are specified
+	koRepoVar   = "KO_DOCKER_REPO"
+	koBuildVerb = "build"
+)
+
+// imageDigestRegexp matches a digest pinned image reference
+var imageDigestRegexp = regexp.MustCompile(`^\S+@sha256:[0-9a-f]{64}$`)
+
+func init() {
+	MustRegister(koMoniker, NewKo, "Builds and pushes container images of go applications with ko")
+}
+
+// Ko builds and pushes container images of go applications using ko.
+// The arguments are passed to ko build: the import paths of the main
+// packages and any flags. The registry is read from $KO_DOCKER_REPO.
+// The references of the pushed images are added to the expected images.
+type Ko struct {
+	baseRunner
+}
+
+func NewKo(args ...string) Runner {
+	return &Ko{
+		baseRunner: baseRunner{
+			id:   koMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// Run executes ko build and records the digests of the images it pushed
+func (k *Ko) Run() error {
+	if _, ok := k.Options().Environment()[koRepoVar]; !ok {
+		logrus.Warnf("%s is not set, ko will fail unless the repository is set in the arguments", koRepoVar)
+	}
+	args := k.args
+	if len(args) == 0 {
+		args = []string{koPackages}
+	}
+	output := &bytes.Buffer{}
+	if err := k.executeCapture(output, append([]string{koCmd, koBuildVerb}, args...)); err != nil {
+		return err
+	}
+	images := parseImageReferences(output.String())
+	logrus.Infof("ko pushed %d images", len(images))
+	k.Options().ExpectedImages = append(k.Options().ExpectedImages, images...)
+	return nil
+}
+
+// parseImageReferences returns the digest pinned image references
+// printed in the output of an image build
+func parseImageReferences(output string) []string {
+	images := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if imageDigestRegexp.MatchString(line) {
+			images = append(images, line)
+		}
+	}
+	return images
+}
+
+// Describe returns the metadata of the runner. Ko produces images only.
+func (k *Ko) Describe() *Description {
+	d := k.describe(koCmd)
+	d.Artifacts = []ArtifactType{ArtifactImages}
+	return d
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testImageDigest = "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+
+func TestKoRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// Fake ko that logs to stderr and prints the image reference
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ko"), []byte(`#!/bin/sh
+echo "$@" > `+filepath.Join(dir, "ko.log")+`
+echo "Publishing $KO_DOCKER_REPO/app:latest" >&2
+echo "$KO_DOCKER_REPO/app@`+testImageDigest+`"
+`), os.FileMode(0o755)))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	k := NewKo("./cmd/app", "--bare")
+	k.Options().Workdir = dir
+	k.Options().EnvVars = map[string]string{"KO_DOCKER_REPO": "ghcr.io/mattermost"}
+	require.NoError(t, k.Run())
+	require.Equal(t, []string{"ghcr.io/mattermost/app@" + testImageDigest}, k.Options().ExpectedImages)
+
+	args, err := os.ReadFile(filepath.Join(dir, "ko.log"))
+	require.NoError(t, err)
+	require.Equal(t, "build ./cmd/app --bare\n", string(args))
+}
+
+func TestParseImageReferences(t *testing.T) {
+	require.Equal(t, []string{
+		"ghcr.io/mattermost/app@" + testImageDigest,
+		"localhost:5000/tool@" + testImageDigest,
+	}, parseImageReferences(
+		"ghcr.io/mattermost/app@"+testImageDigest+"\n"+
+			"2021/12/20 Building github.com/mattermost/app\n"+
+			"ghcr.io/mattermost/app:latest\n"+
+			"  localhost:5000/tool@"+testImageDigest+"  \n",
+	))
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const (
+	ResourceCPU       = "cpu"
+	ResourceMemory    = "memory"
+	ResourceProcesses = "processes"
+)
+
+// ResourceLimits caps the resources the runner processes can use. Limits
+// are enforced with cgroups on Linux and job objects on Windows. Zero
+// values mean no limit.
+type ResourceLimits struct {
+	CPUs         float64 // Number of CPUs the processes can use, eg 1.5
+	MemoryBytes  int64   // Maximum memory the processes can allocate
+	MaxProcesses int     // Maximum number of processes. Threads count as processes on Linux
+}
+
+// enabled returns true if any limit is set
+func (rl *ResourceLimits) enabled() bool {
+	return rl.CPUs > 0 || rl.MemoryBytes > 0 || rl.MaxProcesses > 0
+}
+
+// ResourceLimitError is returned when a runner fails after exceeding
+// one of its resource limits
+type ResourceLimitError struct {
+	Resource string // Resource that hit its limit: memory or processes
+	Limit    int64  // The configured limit
+}
+
+func (re *ResourceLimitError) Error() string {
+	return fmt.Sprintf("runner exceeded its %s limit (%d)", re.Resource, re.Limit)
+}
+
+// limiter enforces the resource limits of a process tree. It is created
+// with newLimiter before the command starts.
+type limiter interface {
+	// prepare modifies the command before it starts to run it limited
+	prepare(cmd *exec.Cmd)
+	// attach places the started process under the limits
+	attach(pid int) error
+	// violation returns a ResourceLimitError if a limit was hit
+	violation() error
+	// close releases the limiter resources once the processes exited
+	close() error
+}
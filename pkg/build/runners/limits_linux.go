@@ -0,0 +1,213 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"sigs.k8s.io/release-utils/util"
+)
+
+const (
+	cgroupRoot      = "/sys/fs/cgroup"
+	cgroupParent    = "mmbuild"
+	cpuPeriodMicros = 100000
+)
+
+// cgroupCounter makes the cgroup names of concurrent runners unique
+var cgroupCounter uint64
+
+// cgroupLimiter places a process in new cgroups configured with the limits
+type cgroupLimiter struct {
+	limits ResourceLimits
+	v2     bool
+	dirs   map[string]string // cgroup directory by controller. v2 uses a single one
+}
+
+// newLimiter creates the cgroups to run a command with the limits applied
+func newLimiter(limits ResourceLimits) (limiter, error) {
+	cl := &cgroupLimiter{
+		limits: limits,
+		v2:     util.Exists(filepath.Join(cgroupRoot, "cgroup.controllers")),
+		dirs:   map[string]string{},
+	}
+	name := fmt.Sprintf("%d-%d", os.Getpid(), atomic.AddUint64(&cgroupCounter, 1))
+
+	var err error
+	if cl.v2 {
+		err = cl.setupV2(name)
+	} else {
+		err = cl.setupV1(name)
+	}
+	if err != nil {
+		cl.close() //nolint:errcheck
+		return nil, err
+	}
+	return cl, nil
+}
+
+// prepare wraps the command in a shell that joins the cgroups before
+// executing it. Moving the process after it starts would let any
+// children it forks early escape the limits.
+func (cl *cgroupLimiter) prepare(cmd *exec.Cmd) {
+	script := ""
+	for _, dir := range cl.dirs {
+		script += fmt.Sprintf("echo $$ > %s || exit 125; ", filepath.Join(dir, "cgroup.procs"))
+	}
+	cmd.Args = append([]string{"sh", "-c", script + `exec "$@"`, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
+
+// attach checks the process joined the cgroups, the wrapper may not
+// have run yet so the pid is written again
+func (cl *cgroupLimiter) attach(pid int) error {
+	for _, dir := range cl.dirs {
+		if err := writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return fmt.Errorf("adding process to cgroup: %w", err)
+		}
+	}
+	return nil
+}
+
+// setupV2 creates the cgroup in the unified hierarchy
+func (cl *cgroupLimiter) setupV2(name string) error {
+	parent := filepath.Join(cgroupRoot, cgroupParent)
+	if err := os.MkdirAll(parent, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating parent cgroup: %w", err)
+	}
+	// Enable the controllers for the children. Failures surface below
+	// when writing to the controller files.
+	for _, dir := range []string{cgroupRoot, parent} {
+		writeCgroupFile(dir, "cgroup.subtree_control", "+cpu +memory +pids") //nolint:errcheck
+	}
+	dir := filepath.Join(parent, name)
+	if err := os.Mkdir(dir, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating cgroup: %w", err)
+	}
+	cl.dirs["unified"] = dir
+
+	if cl.limits.MemoryBytes > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(cl.limits.MemoryBytes, 10)); err != nil {
+			return fmt.Errorf("setting memory limit: %w", err)
+		}
+		// Without swap, going over the limit triggers the OOM killer
+		writeCgroupFile(dir, "memory.swap.max", "0") //nolint:errcheck
+	}
+	if cl.limits.MaxProcesses > 0 {
+		if err := writeCgroupFile(dir, "pids.max", strconv.Itoa(cl.limits.MaxProcesses)); err != nil {
+			return fmt.Errorf("setting process limit: %w", err)
+		}
+	}
+	if cl.limits.CPUs > 0 {
+		quota := int(cl.limits.CPUs * cpuPeriodMicros)
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriodMicros)); err != nil {
+			return fmt.Errorf("setting cpu limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// setupV1 creates a cgroup in each of the controller hierarchies needed
+func (cl *cgroupLimiter) setupV1(name string) error {
+	mkdir := func(controller string) (string, error) {
+		dir := filepath.Join(cgroupRoot, controller, cgroupParent, name)
+		if err := os.MkdirAll(dir, os.FileMode(0o755)); err != nil {
+			return "", fmt.Errorf("creating %s cgroup: %w", controller, err)
+		}
+		cl.dirs[controller] = dir
+		return dir, nil
+	}
+
+	if cl.limits.MemoryBytes > 0 {
+		dir, err := mkdir("memory")
+		if err != nil {
+			return err
+		}
+		if err := writeCgroupFile(dir, "memory.limit_in_bytes", strconv.FormatInt(cl.limits.MemoryBytes, 10)); err != nil {
+			return fmt.Errorf("setting memory limit: %w", err)
+		}
+		writeCgroupFile(dir, "memory.swappiness", "0") //nolint:errcheck
+	}
+	if cl.limits.MaxProcesses > 0 {
+		dir, err := mkdir("pids")
+		if err != nil {
+			return err
+		}
+		if err := writeCgroupFile(dir, "pids.max", strconv.Itoa(cl.limits.MaxProcesses)); err != nil {
+			return fmt.Errorf("setting process limit: %w", err)
+		}
+	}
+	if cl.limits.CPUs > 0 {
+		dir, err := mkdir("cpu")
+		if err != nil {
+			return err
+		}
+		if err := writeCgroupFile(dir, "cpu.cfs_period_us", strconv.Itoa(cpuPeriodMicros)); err != nil {
+			return fmt.Errorf("setting cpu period: %w", err)
+		}
+		if err := writeCgroupFile(dir, "cpu.cfs_quota_us", strconv.Itoa(int(cl.limits.CPUs*cpuPeriodMicros))); err != nil {
+			return fmt.Errorf("setting cpu limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// violation checks the cgroup event counters for OOM kills and forks
+// denied by the process limit
+func (cl *cgroupLimiter) violation() error {
+	memDir, memEvents, pidsDir := cl.dirs["memory"], "memory.oom_control", cl.dirs["pids"]
+	if cl.v2 {
+		memDir, memEvents, pidsDir = cl.dirs["unified"], "memory.events", cl.dirs["unified"]
+	}
+	if cl.limits.MemoryBytes > 0 && readCgroupCounter(memDir, memEvents, "oom_kill") > 0 {
+		return &ResourceLimitError{Resource: ResourceMemory, Limit: cl.limits.MemoryBytes}
+	}
+	if cl.limits.MaxProcesses > 0 && readCgroupCounter(pidsDir, "pids.events", "max") > 0 {
+		return &ResourceLimitError{Resource: ResourceProcesses, Limit: int64(cl.limits.MaxProcesses)}
+	}
+	return nil
+}
+
+// close removes the cgroups. All the processes must have exited.
+func (cl *cgroupLimiter) close() error {
+	for controller, dir := range cl.dirs {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s cgroup: %w", controller, err)
+		}
+	}
+	return nil
+}
+
+// writeCgroupFile writes a value to a cgroup control file
+func writeCgroupFile(dir, file, value string) error {
+	return os.WriteFile(filepath.Join(dir, file), []byte(value), os.FileMode(0o644))
+}
+
+// readCgroupCounter reads a counter from a flat keyed cgroup file
+func readCgroupCounter(dir, file, key string) int64 {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return n
+		}
+	}
+	return 0
+}
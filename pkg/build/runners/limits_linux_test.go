@@ -0,0 +1,42 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeRunLimits(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: fork ok\nfork:\n\tfor i in 1 2 3 4 5 6 7 8 9 10; do sleep 2 & done; wait\nok:\n\ttrue\n"),
+		os.FileMode(0o644)),
+	)
+
+	m := NewMake("fork")
+	m.Options().Workdir = dir
+	m.Options().Limits = ResourceLimits{MaxProcesses: 4, CPUs: 0.5}
+
+	err := m.Run()
+	if err != nil && strings.Contains(err.Error(), "applying resource limits") {
+		t.Skipf("cgroups not available: %v", err)
+	}
+	require.Error(t, err)
+	var limitErr *ResourceLimitError
+	require.True(t, errors.As(err, &limitErr), err.Error())
+	require.Equal(t, ResourceProcesses, limitErr.Resource)
+	require.Equal(t, int64(4), limitErr.Limit)
+
+	// Builds within the limits are not affected
+	ok := NewMake("ok")
+	ok.Options().Workdir = dir
+	require.NoError(t, ok.Run())
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package runners
+
+import (
+	"os/exec"
+
+	"github.com/sirupsen/logrus"
+)
+
+// noopLimiter is used on platforms without resource limit support
+type noopLimiter struct{}
+
+// newLimiter returns a limiter that does nothing, resource limits are
+// not supported on this platform
+func newLimiter(limits ResourceLimits) (limiter, error) {
+	logrus.Warn("Resource limits are not supported on this platform, running without them")
+	return &noopLimiter{}, nil
+}
+
+func (nl *noopLimiter) prepare(cmd *exec.Cmd) {}
+
+func (nl *noopLimiter) attach(pid int) error { return nil }
+
+func (nl *noopLimiter) violation() error { return nil }
+
+func (nl *noopLimiter) close() error { return nil }
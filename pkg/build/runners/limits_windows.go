@@ -0,0 +1,107 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// jobObjectCPURateControlInformation mirrors JOBOBJECT_CPU_RATE_CONTROL_INFORMATION
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+const (
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
+)
+
+// jobLimiter enforces the limits with a job object
+type jobLimiter struct {
+	limits ResourceLimits
+	job    windows.Handle
+}
+
+// newLimiter creates a job object with the limits applied
+func newLimiter(limits ResourceLimits) (limiter, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating job object: %w", err)
+	}
+	jl := &jobLimiter{limits: limits, job: job}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if limits.MemoryBytes > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(limits.MemoryBytes)
+	}
+	if limits.MaxProcesses > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		info.BasicLimitInformation.ActiveProcessLimit = uint32(limits.MaxProcesses)
+	}
+	if _, err := windows.SetInformationJobObject(
+		job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)),
+	); err != nil {
+		jl.close() //nolint:errcheck
+		return nil, fmt.Errorf("setting job object limits: %w", err)
+	}
+
+	if limits.CPUs > 0 {
+		// The CPU rate is expressed in 1/100th of a percent of all CPUs
+		rate := uint32(limits.CPUs * 10000 / float64(runtime.NumCPU()))
+		if rate > 10000 {
+			rate = 10000
+		}
+		cpuInfo := jobObjectCPURateControlInformation{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CPURate:      rate,
+		}
+		if _, err := windows.SetInformationJobObject(
+			job, windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&cpuInfo)), uint32(unsafe.Sizeof(cpuInfo)),
+		); err != nil {
+			jl.close() //nolint:errcheck
+			return nil, fmt.Errorf("setting job object cpu rate: %w", err)
+		}
+	}
+
+	return jl, nil
+}
+
+// prepare is a noop, processes are assigned to the job after starting
+func (jl *jobLimiter) prepare(cmd *exec.Cmd) {}
+
+// attach assigns the process to the job object. Processes spawned
+// before the call are not limited.
+func (jl *jobLimiter) attach(pid int) error {
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return fmt.Errorf("opening runner process: %w", err)
+	}
+	defer windows.CloseHandle(process) //nolint:errcheck
+	if err := windows.AssignProcessToJobObject(jl.job, process); err != nil {
+		return fmt.Errorf("assigning process to job object: %w", err)
+	}
+	return nil
+}
+
+// violation is not detected on windows. Processes hitting the limits
+// fail to allocate memory or spawn children and the runner fails with
+// their error.
+func (jl *jobLimiter) violation() error {
+	return nil
+}
+
+// close releases the job object
+func (jl *jobLimiter) close() error {
+	return windows.CloseHandle(jl.job)
+}
@@ -6,9 +6,11 @@ package runners
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
-	"github.com/pkg/errors"
-	"sigs.k8s.io/release-utils/command"
+	"sigs.k8s.io/release-utils/util"
 )
 
 // https://git.internal.mattermost.com/mattermost/ci/mattermost-server/-/blob/master/master/te.yml
@@ -19,7 +21,7 @@ const (
 )
 
 func init() {
-	Catalog[makeMoniker] = NewMake
+	MustRegister(makeMoniker, NewMake, "Runs make targets")
 }
 
 type Make struct {
@@ -30,7 +32,7 @@ func NewMake(args ...string) Runner {
 	return &Make{
 		baseRunner: baseRunner{
 			id:   makeMoniker,
-			opts: DefaultOptions,
+			opts: DefaultOptions.Copy(),
 			args: args,
 		},
 	}
@@ -38,32 +40,144 @@ func NewMake(args ...string) Runner {
 
 // Run executes make
 func (m *Make) Run() error {
-	envStr := []string{}
-	for v, val := range m.Options().EnvVars {
-		envStr = append(envStr, fmt.Sprintf("%s=%s", v, val))
-	}
+	return m.execute(append([]string{makeCmd}, m.args...))
+}
+
+// Describe returns the metadata of the runner
+func (m *Make) Describe() *Description {
+	return m.describe(makeCmd)
+}
+
+// MakeTarget is a target defined in a Makefile
+type MakeTarget struct {
+	Name        string
+	Description string // Text of the ## comment above the target or the comment in its line
+}
 
-	cmd := command.NewWithWorkDir(m.Options().Workdir, makeCmd, m.args...).Env(envStr...)
+// makefileNames are the files make reads when none is specified, in order
+var makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
 
-	if m.Options().Log != "" {
-		oLog, err := os.Create(m.Options().Log)
-		if err != nil {
-			return errors.Wrap(err, "opening output log")
+// Targets parses the Makefile the runner would use and returns the
+// targets defined in it and in the files it includes, sorted by name.
+// Special targets (eg .PHONY) and pattern rules are not listed. The
+// makefile is read from the -C and -f arguments if set.
+func (m *Make) Targets() ([]MakeTarget, error) {
+	dir := m.Options().Workdir
+	files := []string{}
+	for i := 0; i < len(m.args); i++ {
+		arg := m.args[i]
+		switch {
+		case (arg == "-C" || arg == "--directory" || arg == "-f" || arg == "--file" || arg == "--makefile") && i+1 < len(m.args):
+			i++
+			if arg == "-C" || arg == "--directory" {
+				dir = filepath.Join(dir, m.args[i])
+			} else {
+				files = append(files, m.args[i])
+			}
+		case strings.HasPrefix(arg, "--directory="):
+			dir = filepath.Join(dir, strings.TrimPrefix(arg, "--directory="))
+		case strings.HasPrefix(arg, "--file="), strings.HasPrefix(arg, "--makefile="):
+			files = append(files, arg[strings.Index(arg, "=")+1:])
+		}
+	}
+	if len(files) == 0 {
+		for _, name := range makefileNames {
+			if util.Exists(filepath.Join(dir, name)) {
+				files = append(files, name)
+				break
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no makefile found in %s", dir)
 		}
-		cmd.AddOutputWriter(oLog)
 	}
 
-	if m.Options().ErrorLog != "" {
-		eLog, err := os.Create(m.Options().ErrorLog)
-		if err != nil {
-			return errors.Wrap(err, "opening error log")
+	targets := map[string]string{}
+	for _, f := range files {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(dir, f)
 		}
-		cmd.AddOutputWriter(eLog)
+		if err := parseMakefile(f, dir, targets, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+
+	list := []MakeTarget{}
+	for name, desc := range targets {
+		list = append(list, MakeTarget{Name: name, Description: desc})
 	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
 
-	if err := cmd.RunSuccess(); err != nil {
-		return err
+// parseMakefile adds the targets defined in a makefile to targets.
+// Include directives without variables are followed, relative to dir.
+func parseMakefile(path, dir string, targets map[string]string, seen map[string]bool) error {
+	if seen[path] {
+		return nil
+	}
+	seen[path] = true
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading makefile: %w", err)
 	}
 
+	// Join continued lines before parsing
+	lines := strings.Split(strings.ReplaceAll(string(data), "\\\n", " "), "\n")
+	docComment := ""
+	for _, line := range lines {
+		// Recipes start with a tab
+		if strings.HasPrefix(line, "\t") {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "##") {
+			docComment = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			continue
+		}
+		comment := docComment
+		docComment = ""
+
+		// Included makefiles are parsed too
+		for _, directive := range []string{"include ", "-include ", "sinclude "} {
+			if !strings.HasPrefix(trimmed, directive) || strings.Contains(trimmed, "$") {
+				continue
+			}
+			for _, pattern := range strings.Fields(strings.TrimPrefix(trimmed, directive)) {
+				matches, err := filepath.Glob(filepath.Join(dir, pattern))
+				if err != nil {
+					return fmt.Errorf("searching included makefile %s: %w", pattern, err)
+				}
+				for _, match := range matches {
+					if err := parseMakefile(match, dir, targets, seen); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// A rule is "targets: prerequisites # comment", skip variable
+		// assignments (=, :=, ::=, ?=, +=, !=)
+		code := trimmed
+		if i := strings.Index(code, "#"); i >= 0 {
+			comment = strings.TrimSpace(strings.TrimLeft(code[i:], "#"))
+			code = code[:i]
+		}
+		i := strings.Index(code, ":")
+		if i <= 0 || strings.HasPrefix(code[i:], ":=") || strings.HasPrefix(code[i:], "::=") {
+			continue
+		}
+		if strings.ContainsAny(code[:i], "=$") {
+			continue
+		}
+		for _, name := range strings.Fields(code[:i]) {
+			if strings.HasPrefix(name, ".") || strings.Contains(name, "%") {
+				continue
+			}
+			if desc, ok := targets[name]; !ok || desc == "" {
+				targets[name] = comment
+			}
+		}
+	}
 	return nil
 }
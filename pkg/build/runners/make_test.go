@@ -4,10 +4,14 @@
 package runners
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -44,3 +48,200 @@ func TestMakeRun(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "Hola amigos\n", string(data))
 }
+
+func TestMakeRunTimeout(t *testing.T) {
+	dir, err := os.MkdirTemp("", "make-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Write a make file with a target that hangs
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: hang\nhang:\n\tsleep 30\n"),
+		os.FileMode(0o644)),
+	)
+
+	m := NewMake("hang")
+	m.Options().Workdir = dir
+	m.Options().Timeout = time.Second
+	defer func() { m.Options().Timeout = 0 }()
+
+	start := time.Now()
+	err = m.Run()
+	require.Error(t, err)
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr))
+	require.Equal(t, time.Second, timeoutErr.Timeout)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestMakeRunStreaming(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: stream\nstream:\n\t@echo line one\n\t@echo line two\n\t@echo oops >&2\n"),
+		os.FileMode(0o644)),
+	)
+
+	output := &bytes.Buffer{}
+	lines := map[OutputStream][]string{}
+	m := NewMake("stream")
+	m.Options().Workdir = dir
+	m.Options().OutputWriters = []io.Writer{output}
+	m.Options().LineCallback = func(stream OutputStream, line string) {
+		lines[stream] = append(lines[stream], line)
+	}
+	defer func() {
+		m.Options().OutputWriters = nil
+		m.Options().LineCallback = nil
+	}()
+
+	require.NoError(t, m.Run())
+	require.Equal(t, "line one\nline two\n", output.String())
+	require.Equal(t, []string{"line one", "line two"}, lines[StreamStdout])
+	require.Equal(t, []string{"oops"}, lines[StreamStderr])
+}
+
+func TestLineWriter(t *testing.T) {
+	lines := []string{}
+	lw := &lineWriter{callback: func(_ OutputStream, line string) {
+		lines = append(lines, line)
+	}}
+	_, err := lw.Write([]byte("first\r\nsec"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"first"}, lines)
+	_, err = lw.Write([]byte("ond\nthird"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second"}, lines)
+	require.NoError(t, lw.Close())
+	require.Equal(t, []string{"first", "second", "third"}, lines)
+}
+
+func TestMakeRunCleanEnv(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: env\nenv:\n\t@echo \"$$MMTEST_ALLOWED|$$MMTEST_DENIED|$$MMTEST_SET\"\n"),
+		os.FileMode(0o644)),
+	)
+	t.Setenv("MMTEST_ALLOWED", "allowed")
+	t.Setenv("MMTEST_DENIED", "denied")
+
+	output := &bytes.Buffer{}
+	m := NewMake("env")
+	defaultOpts := *m.Options()
+	defer func() { *m.Options() = defaultOpts }()
+	m.Options().Workdir = dir
+	m.Options().OutputWriters = []io.Writer{output}
+	m.Options().EnvVars = map[string]string{"MMTEST_SET": "set"}
+	m.Options().CleanEnv = true
+	m.Options().EnvAllowlist = []string{"MMTEST_ALLOWED"}
+
+	require.NoError(t, m.Run())
+	require.Equal(t, "allowed||set\n", output.String())
+	require.Equal(t, map[string]string{
+		"MMTEST_ALLOWED": "allowed", "MMTEST_SET": "set",
+	}, m.Options().Environment())
+
+	// Without a clean environment, everything is inherited
+	m.Options().CleanEnv = false
+	require.Equal(t, "denied", m.Options().Environment()["MMTEST_DENIED"])
+}
+
+func TestMakeTargets(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "build"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Makefile"), []byte(`GO ?= go
+BUILD_FLAGS := -trimpath
+VERSION = $(shell git describe)
+include build/*.mk
+-include $(CONFIG_FILE)
+
+.PHONY: build test clean
+
+## Build the server binary
+build: deps
+	$(GO) build $(BUILD_FLAGS) ./...
+
+test: build ## Run the unit tests
+	$(GO) test ./...
+
+clean lint: # Remove or check things
+	rm -rf dist
+
+%.o: %.c
+	cc -c $<
+
+deps::
+	$(GO) mod download
+`), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "build", "release.mk"), []byte(`
+## Package the release
+package: build \
+		test
+	tar czf dist/app.tgz dist/app
+`), os.FileMode(0o644)))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	m := NewMake("build").(*Make)
+	m.Options().Workdir = dir
+	targets, err := m.Targets()
+	require.NoError(t, err)
+	require.Equal(t, []MakeTarget{
+		{Name: "build", Description: "Build the server binary"},
+		{Name: "clean", Description: "Remove or check things"},
+		{Name: "deps"},
+		{Name: "lint", Description: "Remove or check things"},
+		{Name: "package", Description: "Package the release"},
+		{Name: "test", Description: "Run the unit tests"},
+	}, targets)
+
+	// Makefiles set in the arguments are read instead
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "build", "other.make"), []byte("other:\n\techo\n"), os.FileMode(0o644)))
+	m = NewMake("-C", "build", "-f", "other.make", "other").(*Make)
+	m.Options().Workdir = dir
+	targets, err = m.Targets()
+	require.NoError(t, err)
+	require.Equal(t, []MakeTarget{{Name: "other"}}, targets)
+
+	m.Options().Workdir = t.TempDir()
+	m = NewMake().(*Make)
+	_, err = m.Targets()
+	require.Error(t, err)
+}
+
+func TestMakeRunInput(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "Makefile"),
+		[]byte(".PHONY: migrate\nmigrate:\n\t@read confirm && read token && echo \"$$confirm:$${#token}\" > answers.txt\n"),
+		os.FileMode(0o644)),
+	)
+
+	m := NewMake("migrate")
+	defaultOpts := *m.Options()
+	defer func() { *m.Options() = defaultOpts }()
+	m.Options().Workdir = dir
+	m.Options().Log = filepath.Join(dir, "make.log")
+	m.Options().Input = &InputOptions{Responses: []InputResponse{
+		{Text: "yes"}, {Text: "s3cr3t", Secret: true},
+	}}
+	require.NoError(t, m.Run())
+
+	data, err := os.ReadFile(filepath.Join(dir, "answers.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "yes:6\n", string(data))
+
+	// Responses are recorded in the log, secrets redacted
+	log, err := os.ReadFile(m.Options().Log)
+	require.NoError(t, err)
+	require.Contains(t, string(log), "[stdin] yes\n")
+	require.Contains(t, string(log), "[stdin] "+redactedInput+"\n")
+	require.NotContains(t, string(log), "s3cr3t")
+
+	// Input is either passed through or canned
+	m.Options().Input.Passthrough = true
+	require.Error(t, m.Run())
+}
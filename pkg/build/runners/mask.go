@@ -0,0 +1,203 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Masked replaces the sensitive values in the runner output
+const Masked = "[redacted]"
+
+// maskFlushSize is the size of pending output after which a masking writer
+// writes it even if the line is not complete, to not hold long lines
+const maskFlushSize = 64 * 1024
+
+// maskTemplate replaces the matches of the masked patterns, keeping the
+// text of their first and second groups around the mask
+const maskTemplate = "${1}" + Masked + "${2}"
+
+// CredentialPatterns match common credentials, masked in the runner output
+// even when they are not configured as secrets: GitHub, GitLab and Slack
+// tokens, AWS keys, bearer tokens and passwords in URLs.
+var CredentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`(?i)(aws_secret_access_key["']?\s*[=:]\s*["']?)[A-Za-z0-9/+=]{40}`),
+	regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{16,}`),
+	regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+}
+
+// SensitiveValues returns the values that are masked in the runner output:
+// the values of the SecretVars and the MaskedValues, longest first so a
+// value containing another one is masked completely.
+func (o *Options) SensitiveValues() []string {
+	seen := map[string]bool{}
+	values := []string{}
+	add := func(v string) {
+		if v == "" || seen[v] {
+			return
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	for _, v := range o.SecretVars {
+		add(o.EnvVars[v])
+	}
+	for _, v := range o.MaskedValues {
+		add(v)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return values
+}
+
+// SensitivePatterns returns the patterns masked in the runner output: the
+// CredentialPatterns and the MaskedPatterns. Invalid MaskedPatterns are
+// skipped with a warning.
+func (o *Options) SensitivePatterns() []*regexp.Regexp {
+	patterns := append([]*regexp.Regexp{}, CredentialPatterns...)
+	for _, p := range o.MaskedPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			logrus.Warnf("Not masking invalid pattern %q: %v", p, err)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns
+}
+
+// Mask returns s with the sensitive values and patterns of the options
+// replaced
+func (o *Options) Mask(s string) string {
+	return MaskString(s, o.SensitiveValues(), o.SensitivePatterns())
+}
+
+// MaskString returns s with the values and the matches of the patterns
+// replaced with Masked. The text matched by the first and second groups
+// of a pattern is kept, eg `(password=)\S+` masks only the password.
+func MaskString(s string, values []string, patterns []*regexp.Regexp) string {
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, Masked)
+	}
+	for _, re := range patterns {
+		s = re.ReplaceAllString(s, maskTemplate)
+	}
+	return s
+}
+
+// maskWriter is an io.WriteCloser that replaces sensitive values in the
+// data before writing it. Output is written by complete lines so values
+// split across writes are still masked. Values spanning several lines,
+// like PEM keys, hold back the lines that could be their beginning.
+type maskWriter struct {
+	w        io.Writer
+	values   [][]byte
+	patterns []*regexp.Regexp
+	buffer   []byte
+	multi    [][]byte // Values spanning several lines
+}
+
+// NewMaskWriter returns a writer that masks the values in the data it
+// writes to w. It must be closed to write the last incomplete line.
+func NewMaskWriter(w io.Writer, values []string) io.WriteCloser {
+	return NewPatternMaskWriter(w, values)
+}
+
+// NewPatternMaskWriter returns a writer that masks the values and the
+// matches of the patterns in the data it writes to w. Patterns are matched
+// line by line. It must be closed to write the last incomplete line.
+func NewPatternMaskWriter(w io.Writer, values []string, patterns ...*regexp.Regexp) io.WriteCloser {
+	mw := &maskWriter{w: w, patterns: patterns}
+	for _, v := range values {
+		mw.values = append(mw.values, []byte(v))
+		if strings.Contains(v, "\n") {
+			mw.multi = append(mw.multi, []byte(v))
+		}
+	}
+	return mw
+}
+
+func (mw *maskWriter) Write(p []byte) (int, error) {
+	mw.buffer = mw.mask(append(mw.buffer, p...))
+	n := bytes.LastIndexByte(mw.buffer[:mw.partial()], '\n') + 1
+	if n == 0 && len(mw.buffer) > maskFlushSize {
+		// Keep enough data to mask a value starting at the end
+		n = len(mw.buffer) - mw.longest() + 1
+	}
+	if n <= 0 {
+		return len(p), nil
+	}
+	if err := mw.flush(n); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes any pending output
+func (mw *maskWriter) Close() error {
+	return mw.flush(len(mw.buffer))
+}
+
+// partial returns where the end of the buffer that could be the first part
+// of a multi-line value starts, or the buffer length if there is none
+func (mw *maskWriter) partial() int {
+	start := len(mw.buffer)
+	for _, v := range mw.multi {
+		if len(mw.buffer)-len(v)+1 < start {
+			start = len(mw.buffer) - len(v) + 1
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(mw.buffer); i++ {
+		for _, v := range mw.multi {
+			if len(v) > len(mw.buffer)-i && bytes.HasPrefix(v, mw.buffer[i:]) {
+				return i
+			}
+		}
+	}
+	return len(mw.buffer)
+}
+
+// mask replaces the sensitive values in data
+func (mw *maskWriter) mask(data []byte) []byte {
+	for _, v := range mw.values {
+		data = bytes.ReplaceAll(data, v, []byte(Masked))
+	}
+	return data
+}
+
+// flush writes the first n bytes of the buffer
+func (mw *maskWriter) flush(n int) error {
+	data := mw.buffer[:n]
+	mw.buffer = append([]byte(nil), mw.buffer[n:]...)
+	for _, re := range mw.patterns {
+		data = re.ReplaceAll(data, []byte(maskTemplate))
+	}
+	_, err := mw.w.Write(data)
+	return err
+}
+
+func (mw *maskWriter) longest() int {
+	l := 0
+	for _, v := range mw.values {
+		if len(v) > l {
+			l = len(v)
+		}
+	}
+	return l
+}
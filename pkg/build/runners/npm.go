@@ -0,0 +1,124 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/release-utils/util"
+)
+
+const (
+	npmCmd         = "npm"
+	npmMoniker     = "npm"
+	yarnCmd        = "yarn"
+	yarnMoniker    = "yarn"
+	npmLockFile    = "package-lock.json"
+	yarnLockFile   = "yarn.lock"
+	npmScript      = "build" // Script to run when none is specified
+	npmArgsDivider = "--"
+)
+
+func init() {
+	MustRegister(npmMoniker, NewNPM, "Installs dependencies and runs a package.json script with npm")
+	MustRegister(yarnMoniker, NewYarn, "Installs dependencies and runs a package.json script with yarn")
+}
+
+// NPM is a runner that installs the project dependencies and then
+// runs a script defined in package.json. The first argument is the
+// name of the script, the rest are passed to it.
+type NPM struct {
+	baseRunner
+}
+
+func NewNPM(args ...string) Runner {
+	return &NPM{
+		baseRunner: baseRunner{
+			id:   npmMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// Run executes npm install and the configured script
+func (n *NPM) Run() error {
+	// Use a clean install when the project has a lockfile
+	install := []string{npmCmd, "install"}
+	if util.Exists(filepath.Join(n.Options().Workdir, npmLockFile)) {
+		install = []string{npmCmd, "ci"}
+	}
+	script, args := scriptArgs(n.args)
+	run := []string{npmCmd, "run", script}
+	if len(args) > 0 {
+		run = append(append(run, npmArgsDivider), args...)
+	}
+	return n.execute(install, run)
+}
+
+// Yarn is the yarn variant of the npm runner
+type Yarn struct {
+	baseRunner
+}
+
+func NewYarn(args ...string) Runner {
+	return &Yarn{
+		baseRunner: baseRunner{
+			id:   yarnMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// Run executes yarn install and the configured script
+func (y *Yarn) Run() error {
+	// Refuse to update the lockfile when the project has one. Yarn 2
+	// and later replaced --frozen-lockfile with --immutable
+	install := []string{yarnCmd, "install"}
+	if util.Exists(filepath.Join(y.Options().Workdir, yarnLockFile)) {
+		version, err := y.commandOutput(yarnCmd, "--version")
+		if err != nil {
+			return fmt.Errorf("reading yarn version: %w", err)
+		}
+		if yarnMajorVersion(version) >= 2 {
+			install = append(install, "--immutable")
+		} else {
+			install = append(install, "--frozen-lockfile")
+		}
+	}
+	script, args := scriptArgs(y.args)
+	return y.execute(install, append([]string{yarnCmd, "run", script}, args...))
+}
+
+// yarnMajorVersion returns the major number of a yarn version, or 0 if
+// it cannot be parsed
+func yarnMajorVersion(version string) int {
+	major, err := strconv.Atoi(strings.SplitN(strings.TrimSpace(version), ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// scriptArgs splits the runner arguments into the script name and its arguments
+func scriptArgs(args []string) (script string, scriptArgs []string) {
+	if len(args) == 0 || args[0] == "" {
+		return npmScript, []string{}
+	}
+	return args[0], args[1:]
+}
+
+// Describe returns the metadata of the runner
+func (n *NPM) Describe() *Description {
+	return n.describe(npmCmd)
+}
+
+// Describe returns the metadata of the runner
+func (y *Yarn) Describe() *Description {
+	return y.describe(yarnCmd)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNPMRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "npm-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Write a package.json with a script that creates a file
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "package.json"),
+		[]byte(`{"name": "npm-test", "version": "1.0.0", "scripts": {"dist": "echo \"Hola amigos\" > dist.txt"}}`),
+		os.FileMode(0o644)),
+	)
+
+	n := NewNPM("dist")
+	n.Options().Workdir = dir
+	require.NoError(t, n.Run())
+	require.FileExists(t, filepath.Join(dir, "dist.txt"))
+	data, err := os.ReadFile(filepath.Join(dir, "dist.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "Hola amigos\n", string(data))
+}
+
+func TestYarnRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// Fake yarn that records its arguments and reports its version
+	version := filepath.Join(dir, "version")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "yarn"), []byte(`#!/bin/sh
+if [ "$1" = "--version" ]; then cat `+version+`; exit; fi
+echo "$@" >> yarn.log
+`), os.FileMode(0o755)))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+	run := func() {
+		y := NewYarn("dist", "--verbose")
+		y.Options().Workdir = dir
+		require.NoError(t, y.Run())
+	}
+
+	// Without a lockfile there is nothing to freeze
+	run()
+
+	// Yarn 1 freezes the lockfile, later versions make the install immutable
+	require.NoError(t, os.WriteFile(filepath.Join(dir, yarnLockFile), []byte{}, os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(version, []byte("1.22.19\n"), os.FileMode(0o644)))
+	run()
+	require.NoError(t, os.WriteFile(version, []byte("3.6.4\n"), os.FileMode(0o644)))
+	run()
+
+	data, err := os.ReadFile(filepath.Join(dir, "yarn.log"))
+	require.NoError(t, err)
+	require.Equal(t,
+		"install\nrun dist --verbose\n"+
+			"install --frozen-lockfile\nrun dist --verbose\n"+
+			"install --immutable\nrun dist --verbose\n",
+		string(data),
+	)
+}
+
+func TestScriptArgs(t *testing.T) {
+	script, args := scriptArgs([]string{})
+	require.Equal(t, npmScript, script)
+	require.Empty(t, args)
+
+	script, args = scriptArgs([]string{"package", "--verbose"})
+	require.Equal(t, "package", script)
+	require.Equal(t, []string{"--verbose"}, args)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PluginPrefix is the filename prefix of runner plugins. The rest of
+	// the filename is used as the runner ID: mmbuild-runner-<id>
+	PluginPrefix = "mmbuild-runner-"
+
+	// PluginDirVar is the environment variable that defines the
+	// directory where runner plugins are discovered from
+	PluginDirVar = "MMBUILD_PLUGIN_DIR"
+)
+
+func init() {
+	if dir := os.Getenv(PluginDirVar); dir != "" {
+		if err := LoadPlugins(dir); err != nil {
+			logrus.Error(fmt.Errorf("loading runner plugins: %w", err))
+		}
+	}
+}
+
+// PluginRequest is the message written to the plugin standard input
+type PluginRequest struct {
+	ID      string            `json:"id"`      // ID of the runner
+	Args    []string          `json:"args"`    // Runner arguments
+	Env     map[string]string `json:"env"`     // Environment variables set for the run
+	Workdir string            `json:"workdir"` // Directory where the build runs
+}
+
+// PluginResult is the message the plugin writes to its standard output
+// when it finishes. Anything the plugin wants in the run log must be
+// written to standard error.
+type PluginResult struct {
+	Success        bool     `json:"success"`                   // True if the build succeeded
+	Output         string   `json:"output,omitempty"`          // Output of the runner
+	Error          string   `json:"error,omitempty"`           // Error message when the build failed
+	ExpectedFiles  []string `json:"expected_files,omitempty"`  // Artifacts the build produced
+	ExpectedImages []string `json:"expected_images,omitempty"` // Container images the build pushed, as repo@sha256:digest
+}
+
+// Plugin is a runner implemented by an external executable. The plugin
+// receives a PluginRequest encoded as JSON in its standard input and
+// must reply with a PluginResult in its standard output.
+type Plugin struct {
+	baseRunner
+	path string
+}
+
+// NewPlugin returns a runner that executes the plugin in path
+func NewPlugin(id, path string, args ...string) *Plugin {
+	return &Plugin{
+		baseRunner: baseRunner{
+			id:   id,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+		path: path,
+	}
+}
+
+// LoadPlugins registers in the catalog all the runner plugins found in
+// dir. Plugins cannot replace the runners built into the SDK.
+func LoadPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading plugin directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), PluginPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("checking plugin %s: %w", entry.Name(), err)
+		}
+		if info.Mode()&0o111 == 0 {
+			logrus.Warnf("Skipping runner plugin %s, file is not executable", entry.Name())
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), PluginPrefix), filepath.Ext(entry.Name()))
+		path := filepath.Join(dir, entry.Name())
+		if err := register(RunnerInfo{
+			ID: id, Description: "Runner plugin " + path, Plugin: true,
+		}, func(args ...string) Runner {
+			return NewPlugin(id, path, args...)
+		}); err != nil {
+			logrus.Warnf("Skipping runner plugin %s: %v", entry.Name(), err)
+			continue
+		}
+		logrus.Infof("Registered runner plugin %s from %s", id, path)
+	}
+	return nil
+}
+
+// Run executes the plugin and processes its result
+func (p *Plugin) Run() error {
+	request, err := json.Marshal(&PluginRequest{
+		ID:      p.ID(),
+		Args:    p.args,
+		Env:     p.Options().EnvVars,
+		Workdir: p.Options().Workdir,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding plugin request: %w", err)
+	}
+
+	// The plugin standard output is reserved for the protocol, its
+	// standard error is treated as the runner output
+	output, _, closeOutputs, err := p.outputWriters()
+	if err != nil {
+		return err
+	}
+	defer closeOutputs()
+
+	var deadline <-chan time.Time
+	if p.Options().Timeout > 0 {
+		timer := time.NewTimer(p.Options().Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command(p.path) //nolint:gosec // Plugins are executables installed by the user
+	cmd.Dir = p.Options().Workdir
+	cmd.Env = p.processEnvironment()
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = stdout
+	cmd.Stderr = output
+
+	logrus.Infof("+ [plugin %s] %s", p.ID(), strings.Join(p.args, " "))
+	runErr := p.startAndWait(cmd, deadline)
+	var timeoutErr *TimeoutError
+	var canceledErr *CanceledError
+	if errors.As(runErr, &timeoutErr) || errors.As(runErr, &canceledErr) {
+		return runErr
+	}
+
+	result := &PluginResult{}
+	if err := json.Unmarshal(stdout.Bytes(), result); err != nil {
+		if runErr != nil {
+			return fmt.Errorf("executing plugin %s: %w", p.ID(), runErr)
+		}
+		return fmt.Errorf("decoding result from plugin %s: %w", p.ID(), err)
+	}
+
+	p.output = result.Output
+	if !result.Success {
+		if result.Error == "" {
+			result.Error = "plugin reported a failed build"
+		}
+		return fmt.Errorf("plugin %s: %s", p.ID(), result.Error)
+	}
+	if runErr != nil {
+		return fmt.Errorf("executing plugin %s: %w", p.ID(), runErr)
+	}
+	p.Options().ExpectedFiles = append(p.Options().ExpectedFiles, result.ExpectedFiles...)
+	p.Options().ExpectedImages = append(p.Options().ExpectedImages, result.ExpectedImages...)
+	return nil
+}
+
+// Describe returns the metadata of the plugin. Plugins can report
+// files and images, they are not run in containers.
+func (p *Plugin) Describe() *Description {
+	d := p.describe(p.path)
+	d.Options = []string{}
+	for _, o := range commandOptions {
+		if o != "Container" {
+			d.Options = append(d.Options, o)
+		}
+	}
+	d.Artifacts = []ArtifactType{ArtifactFiles, ArtifactImages}
+	return d
+}
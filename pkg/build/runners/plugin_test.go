@@ -0,0 +1,76 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginRun(t *testing.T) {
+	pluginDir := t.TempDir()
+	workdir := t.TempDir()
+
+	// The test plugin saves the request and reports an artifact
+	require.NoError(t, os.WriteFile(
+		filepath.Join(pluginDir, PluginPrefix+"testtool"),
+		[]byte("#!/bin/sh\ncat > request.json\necho building >&2\n"+
+			`echo '{"success": true, "output": "done", "expected_files": ["out.bin"]}'`+"\n"),
+		os.FileMode(0o755)),
+	)
+	require.NoError(t, os.WriteFile(
+		filepath.Join(pluginDir, PluginPrefix+"failtool"),
+		[]byte("#!/bin/sh\n"+`echo '{"success": false, "error": "license server unreachable"}'`+"\n"),
+		os.FileMode(0o755)),
+	)
+	// Plugins cannot shadow the built in runners
+	require.NoError(t, os.WriteFile(
+		filepath.Join(pluginDir, PluginPrefix+makeMoniker), []byte("#!/bin/sh\n"), os.FileMode(0o755)),
+	)
+	defer func() {
+		for _, id := range []string{"testtool", "failtool"} {
+			Unregister(id)
+		}
+	}()
+
+	require.NoError(t, LoadPlugins(pluginDir))
+	_, ok := Lookup("testtool")
+	require.True(t, ok)
+	_, ok = Lookup("failtool")
+	require.True(t, ok)
+	factory, ok := Lookup(makeMoniker)
+	require.True(t, ok)
+	_, isPlugin := factory().(*Plugin)
+	require.False(t, isPlugin)
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	runner, err := New("testtool", "--target", "linux")
+	require.NoError(t, err)
+	runner.Options().Workdir = workdir
+	runner.Options().EnvVars = map[string]string{"BUILD_NUMBER": "12"}
+	require.NoError(t, runner.Run())
+	require.Equal(t, "done", runner.Output())
+	require.Equal(t, []string{"out.bin"}, runner.Options().ExpectedFiles)
+
+	data, err := os.ReadFile(filepath.Join(workdir, "request.json"))
+	require.NoError(t, err)
+	request := &PluginRequest{}
+	require.NoError(t, json.Unmarshal(data, request))
+	require.Equal(t, "testtool", request.ID)
+	require.Equal(t, []string{"--target", "linux"}, request.Args)
+	require.Equal(t, "12", request.Env["BUILD_NUMBER"])
+	require.Equal(t, workdir, request.Workdir)
+
+	runner, err = New("failtool")
+	require.NoError(t, err)
+	err = runner.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "license server unreachable")
+}
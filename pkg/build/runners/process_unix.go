@@ -0,0 +1,23 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+//go:build !windows
+// +build !windows
+
+package runners
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command start a new process group so
+// that its children can be terminated with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the command and all its children
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
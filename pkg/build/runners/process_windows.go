@@ -0,0 +1,17 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+//go:build windows
+// +build windows
+
+package runners
+
+import "os/exec"
+
+// setProcessGroup is a noop on windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command process
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
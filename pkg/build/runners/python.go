@@ -0,0 +1,148 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/hash"
+	"sigs.k8s.io/release-utils/util"
+)
+
+const (
+	pythonCmd        = "python3"
+	pythonMoniker    = "python"
+	toxCmd           = "tox"
+	toxMoniker       = "tox"
+	pythonVenvDir    = ".mmbuild-venv" // Virtualenv created in the workdir for the run
+	pythonReqsFile   = "requirements.txt"
+	pythonURIPrefix  = "file:"
+	pythonVenvBinDir = "bin"
+)
+
+// pythonDependencyFiles are the files defining the dependencies of a
+// python project. Those found in the workdir are recorded as materials.
+var pythonDependencyFiles = []string{
+	"requirements*.txt", "constraints*.txt", "tox.ini", "setup.py",
+	"setup.cfg", "pyproject.toml", "Pipfile.lock", "poetry.lock",
+}
+
+func init() {
+	MustRegister(pythonMoniker, NewPython, "Runs python in a new virtualenv")
+	MustRegister(toxMoniker, NewTox, "Runs tox")
+}
+
+// Python runs python in a new virtualenv. The arguments are passed to
+// the interpreter, eg "-m build" or "setup.py bdist_wheel". If the project
+// has a requirements.txt file, it is installed in the virtualenv first.
+// The virtualenv is removed when the run finishes.
+type Python struct {
+	baseRunner
+}
+
+func NewPython(args ...string) Runner {
+	return &Python{
+		baseRunner: baseRunner{
+			id:   pythonMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// Run creates the virtualenv, installs the requirements and runs python
+func (p *Python) Run() error {
+	if err := recordPythonMaterials(p.Options()); err != nil {
+		return fmt.Errorf("recording python dependency files: %w", err)
+	}
+
+	venv := filepath.Join(p.Options().Workdir, pythonVenvDir)
+	defer func() {
+		if err := os.RemoveAll(venv); err != nil {
+			logrus.Warnf("Unable to remove virtualenv: %v", err)
+		}
+	}()
+
+	// Commands run from the workdir so the virtualenv path is relative
+	python := filepath.Join(pythonVenvDir, pythonVenvBinDir, "python")
+	if runtime.GOOS == "windows" {
+		python = filepath.Join(pythonVenvDir, "Scripts", "python.exe")
+	}
+	cmdLines := [][]string{{pythonCmd, "-m", "venv", "--clear", pythonVenvDir}}
+	if util.Exists(filepath.Join(p.Options().Workdir, pythonReqsFile)) {
+		cmdLines = append(cmdLines, []string{python, "-m", "pip", "install", "-r", pythonReqsFile})
+	}
+	cmdLines = append(cmdLines, append([]string{python}, p.args...))
+	return p.execute(cmdLines...)
+}
+
+// Tox runs tox in the working directory. The arguments are passed to
+// tox, eg "-e py39". Tox creates the virtualenvs of its environments.
+type Tox struct {
+	baseRunner
+}
+
+func NewTox(args ...string) Runner {
+	return &Tox{
+		baseRunner: baseRunner{
+			id:   toxMoniker,
+			opts: DefaultOptions.Copy(),
+			args: args,
+		},
+	}
+}
+
+// Run executes tox
+func (t *Tox) Run() error {
+	if err := recordPythonMaterials(t.Options()); err != nil {
+		return fmt.Errorf("recording python dependency files: %w", err)
+	}
+	return t.execute(append([]string{toxCmd}, t.args...))
+}
+
+// recordPythonMaterials hashes the dependency files found in the
+// workdir and adds them to the runner materials
+func recordPythonMaterials(opts *Options) error {
+	files := []string{}
+	for _, pattern := range pythonDependencyFiles {
+		matches, err := filepath.Glob(filepath.Join(opts.Workdir, pattern))
+		if err != nil {
+			return fmt.Errorf("searching for %s: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	if opts.Materials == nil {
+		opts.Materials = map[string]map[string]string{}
+	}
+	for _, path := range files {
+		digest, err := hash.SHA256ForFile(path)
+		if err != nil {
+			return fmt.Errorf("hashing %s: %w", path, err)
+		}
+		rel, err := filepath.Rel(opts.Workdir, path)
+		if err != nil {
+			return fmt.Errorf("getting path relative to workdir: %w", err)
+		}
+		opts.Materials[pythonURIPrefix+filepath.ToSlash(rel)] = map[string]string{"sha256": digest}
+	}
+	logrus.Infof("Recorded %d python dependency files as materials", len(files))
+	return nil
+}
+
+// Describe returns the metadata of the runner
+func (p *Python) Describe() *Description {
+	return p.describe(pythonCmd)
+}
+
+// Describe returns the metadata of the runner
+func (t *Tox) Describe() *Description {
+	return t.describe(toxCmd)
+}
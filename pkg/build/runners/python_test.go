@@ -0,0 +1,69 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPythonRun(t *testing.T) {
+	if _, err := exec.LookPath(pythonCmd); err != nil {
+		t.Skip("python3 not found")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "build.py"), []byte(`import sys
+open("dist.txt", "w").write(sys.prefix)
+`), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pyproject.toml"), []byte("[project]\nname = \"test\"\n"), os.FileMode(0o644)))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	p := NewPython("build.py")
+	p.Options().Workdir = dir
+	p.Options().Materials = nil
+	require.NoError(t, p.Run())
+
+	// The script ran in the virtualenv, which is removed afterwards
+	data, err := os.ReadFile(filepath.Join(dir, "dist.txt"))
+	require.NoError(t, err)
+	require.Equal(t, pythonVenvDir, filepath.Base(string(data)))
+	require.NoDirExists(t, filepath.Join(dir, pythonVenvDir))
+
+	require.Equal(t, map[string]map[string]string{
+		"file:pyproject.toml": {"sha256": "f9584df963a468a766eb1c88842992819471831e7f48ac57b6c060b6148ef39a"},
+	}, p.Options().Materials)
+}
+
+func TestToxRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// Fake tox that records its arguments
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tox"), []byte(`#!/bin/sh
+echo "$@" > tox.log
+`), os.FileMode(0o755)))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tox.ini"), []byte("[tox]\nenvlist = py39\n"), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements-dev.txt"), []byte("pytest==6.2.5\n"), os.FileMode(0o644)))
+
+	defaultOpts := *DefaultOptions
+	defer func() { *DefaultOptions = defaultOpts }()
+
+	tx := NewTox("-e", "py39")
+	tx.Options().Workdir = dir
+	tx.Options().Materials = nil
+	require.NoError(t, tx.Run())
+
+	data, err := os.ReadFile(filepath.Join(dir, "tox.log"))
+	require.NoError(t, err)
+	require.Equal(t, "-e py39\n", string(data))
+	require.Len(t, tx.Options().Materials, 2)
+	require.Contains(t, tx.Options().Materials, "file:tox.ini")
+	require.Contains(t, tx.Options().Materials, "file:requirements-dev.txt")
+}
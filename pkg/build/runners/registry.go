@@ -0,0 +1,118 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Factory returns a new runner initialized with a list of arguments
+type Factory func(args ...string) Runner
+
+// RunnerInfo describes a runner registered in the catalog
+type RunnerInfo struct {
+	ID          string // ID used to instanciate the runner
+	Description string // Short description of the runner
+	Plugin      bool   // True if the runner is an external plugin
+}
+
+type registration struct {
+	info    RunnerInfo
+	factory Factory
+}
+
+var (
+	runnerIDRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	catalogMutex sync.RWMutex
+	catalog      = map[string]registration{}
+)
+
+// Catalog maps the IDs of the registered runners to their factories.
+//
+// Deprecated: use Register, Lookup and List, which are safe for concurrent
+// use. Catalog mirrors the registered runners, and the runners added to
+// it directly are still found by New, Lookup and List.
+var Catalog = map[string]func(args ...string) Runner{}
+
+// Register adds a runner to the catalog. It returns an error if the ID
+// is not valid or a runner with the same ID is already registered.
+// Runners built into the SDK take the place of plugins with their ID.
+func Register(id string, factory Factory, description string) error {
+	return register(RunnerInfo{ID: id, Description: description}, factory)
+}
+
+// MustRegister works like Register but panics on error. It is intended
+// to register runners in init functions.
+func MustRegister(id string, factory Factory, description string) {
+	if err := Register(id, factory, description); err != nil {
+		panic(err)
+	}
+}
+
+// Unregister removes a runner from the catalog
+func Unregister(id string) {
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+	delete(catalog, id)
+	delete(Catalog, id)
+}
+
+func register(info RunnerInfo, factory Factory) error {
+	if !runnerIDRegexp.MatchString(info.ID) {
+		return fmt.Errorf("invalid runner id '%s'", info.ID)
+	}
+	if factory == nil {
+		return fmt.Errorf("runner %s has no factory function", info.ID)
+	}
+
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+	if existing, ok := catalog[info.ID]; ok {
+		switch {
+		case !existing.info.Plugin:
+			return fmt.Errorf("a runner with id '%s' is already registered", info.ID)
+		case !info.Plugin:
+			logrus.Warnf("Runner %s replaces the plugin registered with the same id", info.ID)
+		}
+	}
+	catalog[info.ID] = registration{info: info, factory: factory}
+	Catalog[info.ID] = factory
+	return nil
+}
+
+// Lookup returns the factory of a runner in the catalog
+func Lookup(id string) (Factory, bool) {
+	catalogMutex.RLock()
+	defer catalogMutex.RUnlock()
+	if reg, ok := catalog[id]; ok {
+		return reg.factory, true
+	}
+	if factory, ok := Catalog[id]; ok && factory != nil {
+		return factory, true
+	}
+	return nil, false
+}
+
+// List returns the runners in the catalog sorted by ID
+func List() []RunnerInfo {
+	catalogMutex.RLock()
+	defer catalogMutex.RUnlock()
+	list := make([]RunnerInfo, 0, len(catalog))
+	for _, reg := range catalog {
+		list = append(list, reg.info)
+	}
+	for id, factory := range Catalog {
+		if _, ok := catalog[id]; !ok && factory != nil {
+			list = append(list, RunnerInfo{ID: id})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package runners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	factory := func(args ...string) Runner { return NewMake(args...) }
+	defer Unregister("custom-make")
+
+	require.NoError(t, Register("custom-make", factory, "Custom make"))
+	require.Error(t, Register("custom-make", factory, "Duplicate"))
+	require.Error(t, Register(makeMoniker, factory, "Shadows a builtin runner"))
+	require.Error(t, Register("bad id", factory, "Invalid ID"))
+	require.Error(t, Register("", factory, "Empty ID"))
+	require.Error(t, Register("nofactory", nil, "No factory"))
+
+	r, err := New("custom-make", "build")
+	require.NoError(t, err)
+	require.Equal(t, []string{"build"}, r.Arguments())
+
+	list := List()
+	found := false
+	for i, info := range list {
+		if i > 0 {
+			require.Less(t, list[i-1].ID, info.ID)
+		}
+		if info.ID == "custom-make" {
+			found = true
+			require.Equal(t, "Custom make", info.Description)
+			require.False(t, info.Plugin)
+		}
+	}
+	require.True(t, found)
+
+	// Builtin runners replace plugins with the same ID
+	defer Unregister("plugged")
+	require.NoError(t, register(RunnerInfo{ID: "plugged", Plugin: true}, factory))
+	require.NoError(t, register(RunnerInfo{ID: "plugged", Plugin: true}, factory))
+	require.NoError(t, Register("plugged", factory, "Builtin"))
+	require.Error(t, register(RunnerInfo{ID: "plugged", Plugin: true}, factory))
+}
+
+func TestCatalog(t *testing.T) {
+	// The registered runners are mirrored in the deprecated catalog map
+	require.NotNil(t, Catalog[makeMoniker])
+
+	// And the runners added to it directly can still be created
+	Catalog["legacy-make"] = func(args ...string) Runner { return NewMake(args...) }
+	defer Unregister("legacy-make")
+	_, ok := Lookup("legacy-make")
+	require.True(t, ok)
+	r, err := New("legacy-make", "build")
+	require.NoError(t, err)
+	require.Equal(t, []string{"build"}, r.Arguments())
+	require.Contains(t, List(), RunnerInfo{ID: "legacy-make"})
+
+	Unregister("legacy-make")
+	_, ok = Lookup("legacy-make")
+	require.False(t, ok)
+	require.NotContains(t, Catalog, "legacy-make")
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	_ "embed" // The configuration schema is embedded in the package
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigSchema is the JSON Schema of the build configuration file. It is
+// published in the repository as matterbuild.schema.json for editors and
+// linters, and enforced when the configuration is loaded.
+//
+//go:embed matterbuild.schema.json
+var ConfigSchema []byte
+
+// ErrInvalidConfig is returned when the configuration does not match the
+// schema
+var ErrInvalidConfig = errors.New("invalid build configuration")
+
+// SchemaError is a violation of the configuration schema
+type SchemaError struct {
+	Path    string // Path of the invalid value, eg transfers[1].destination
+	Line    int    // Line of the value in the configuration file
+	Message string // What is wrong with the value, eg "must be a URL"
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("line %d: %s %s", e.Line, e.Path, e.Message)
+}
+
+// SchemaErrors are all the schema violations of a configuration
+type SchemaErrors []*SchemaError
+
+func (e SchemaErrors) Error() string {
+	msgs := []string{}
+	for _, se := range e {
+		msgs = append(msgs, se.Error())
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidConfig, strings.Join(msgs, "; "))
+}
+
+// Is makes the errors match ErrInvalidConfig
+func (e SchemaErrors) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+// schema is the subset of JSON Schema used to describe the configuration
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Description          string             `json:"description"`
+	Format               string             `json:"format"`
+	Enum                 []string           `json:"enum"`
+	MinLength            int                `json:"minLength"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Defs                 map[string]*schema `json:"$defs"`
+}
+
+// schemaValidator checks YAML documents against a schema, recording the
+// violations with the path and line where they are found
+type schemaValidator struct {
+	root    *schema
+	errors  SchemaErrors
+	aliases map[*yaml.Node]bool // Anchored nodes being validated through an alias
+	nodes   int                 // Nodes validated, aliased ones once per alias
+}
+
+// ValidateConfigSchema checks configuration data against ConfigSchema.
+// Unknown keys, wrong types and invalid values are reported together.
+func ValidateConfigSchema(yamlData []byte) error {
+	root := &schema{}
+	if err := json.Unmarshal(ConfigSchema, root); err != nil {
+		return fmt.Errorf("parsing configuration schema: %w", err)
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(yamlData, doc); err != nil {
+		return fmt.Errorf("parsing config yaml data: %w", err)
+	}
+	// An empty document has no content
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	v := &schemaValidator{root: root, aliases: map[*yaml.Node]bool{}}
+	if err := v.validate(root, doc.Content[0], ""); err != nil {
+		return err
+	}
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+func (v *schemaValidator) fail(node *yaml.Node, path, format string, args ...interface{}) {
+	if path == "" {
+		path = "configuration"
+	}
+	v.errors = append(v.errors, &SchemaError{
+		Path: path, Line: node.Line, Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// resolve returns the schema a $ref points to
+func (v *schemaValidator) resolve(s *schema) (*schema, error) {
+	for s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/$defs/")
+		def, ok := v.root.Defs[name]
+		if !ok || name == s.Ref {
+			return nil, fmt.Errorf("unresolved schema reference %s", s.Ref)
+		}
+		s = def
+	}
+	return s, nil
+}
+
+// validate checks a node against a schema. Null values are treated as
+// unset, like when unmarshaling the configuration.
+func (v *schemaValidator) validate(s *schema, node *yaml.Node, path string) error {
+	s, err := v.resolve(s)
+	if err != nil {
+		return err
+	}
+	if node.Kind == yaml.AliasNode {
+		if v.aliases[node.Alias] {
+			v.fail(node, path, "refers to itself through alias *%s", node.Value)
+			return nil
+		}
+		v.aliases[node.Alias] = true
+		defer delete(v.aliases, node.Alias)
+		node = node.Alias
+	}
+	v.nodes++
+	if v.nodes > maxExpandedNodes {
+		return fmt.Errorf("configuration aliases expand to more than %d values", maxExpandedNodes)
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+
+	if len(s.Enum) > 0 {
+		if node.Kind != yaml.ScalarNode || !contains(s.Enum, node.Value) {
+			v.fail(node, path, "must be one of %s", strings.Join(s.Enum, ", "))
+		}
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		return v.validateObject(s, node, path)
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			v.fail(node, path, "must be a list")
+			return nil
+		}
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range node.Content {
+			if err := v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "boolean":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.fail(node, path, "must be true or false")
+		}
+	case "integer":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.fail(node, path, "must be a whole number")
+		}
+	case "string":
+		// YAML numbers are accepted as strings, like when unmarshaling
+		if node.Kind != yaml.ScalarNode {
+			v.fail(node, path, "must be a string")
+			return nil
+		}
+		v.validateString(s, node, path)
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateObject(s *schema, node *yaml.Node, path string) error {
+	if node.Kind != yaml.MappingNode {
+		v.fail(node, path, "must be a map")
+		return nil
+	}
+	var additional *schema
+	allowAdditional := true
+	if len(s.AdditionalProperties) > 0 {
+		if err := json.Unmarshal(s.AdditionalProperties, &allowAdditional); err != nil {
+			additional = &schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+				return fmt.Errorf("parsing additionalProperties schema: %w", err)
+			}
+		}
+	}
+
+	found := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		found[key.Value] = true
+		keyPath := key.Value
+		if path != "" {
+			keyPath = path + "." + key.Value
+		}
+		prop, ok := s.Properties[key.Value]
+		switch {
+		case ok:
+		case additional != nil:
+			prop = additional
+		case !allowAdditional:
+			v.fail(key, keyPath, "is not a known setting%s", suggestKey(key.Value, s.Properties))
+			continue
+		default:
+			continue
+		}
+		if err := v.validate(prop, value, keyPath); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range s.Required {
+		if !found[r] {
+			p := r
+			if path != "" {
+				p = path + "." + r
+			}
+			v.fail(node, p, "is required")
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateString(s *schema, node *yaml.Node, path string) {
+	if len(node.Value) < s.MinLength {
+		v.fail(node, path, "must not be empty")
+		return
+	}
+	switch s.Format {
+	case "uri":
+		u, err := url.Parse(node.Value)
+		if err != nil || u.Scheme == "" {
+			v.fail(node, path, "must be a URL")
+		}
+	case "duration":
+		if d, err := time.ParseDuration(node.Value); err != nil || d < 0 {
+			v.fail(node, path, "must be a duration, eg 24h")
+		}
+	case "size":
+		if _, err := ParseByteSize(node.Value); err != nil {
+			v.fail(node, path, "must be a size, eg 500MB")
+		}
+	}
+}
+
+// suggestKey returns a hint with the known key closest to a misspelled one
+func suggestKey(key string, properties map[string]*schema) string {
+	known := []string{}
+	for k := range properties {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	for _, k := range known {
+		if strings.EqualFold(k, key) || editDistance(k, key) <= 2 {
+			return fmt.Sprintf(" (did you mean %s?)", k)
+		}
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigSchema(t *testing.T) {
+	// The published schema is valid JSON
+	require.True(t, json.Valid(ConfigSchema))
+
+	// The example configurations match it
+	examples, err := filepath.Glob("../../examples/*/" + ConfigFileName)
+	require.NoError(t, err)
+	require.NotEmpty(t, examples)
+	for _, path := range examples {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data, err = replaceVariables(data)
+		require.NoError(t, err)
+		require.NoError(t, ValidateConfigSchema(data), path)
+	}
+}
+
+func TestValidateConfigSchema(t *testing.T) {
+	for _, tc := range []struct {
+		conf     string
+		messages []string
+	}{
+		{"runner:\n  id: make\n", nil},
+		{"runner:\n  id: make\ncache:\n  ttl: 24h\n", nil},
+		{
+			"runner:\n  id: make\ntransfers:\n  - source: [a]\n    destination: s3://bucket/\n  - source: [b]\n    destination: bucket/\n",
+			[]string{"line 7: transfers[1].destination must be a URL"},
+		},
+		{
+			"runner:\n  id: make\nartifact:\n  files: [bin]\n",
+			[]string{"line 3: artifact is not a known setting (did you mean artifacts?)"},
+		},
+		{
+			"runner:\n  id: make\nenv:\n  - name: GOOS\n    value: linux\n",
+			[]string{"line 4: env[0].name is not a known setting", "line 4: env[0].var is required"},
+		},
+		{
+			"runner:\n  id: make\nsbom: sure\nsecretsProviders:\n  - type: vault\n",
+			[]string{"line 3: sbom must be true or false", "line 5: secretsProviders[0].type must be one of env, file, dir"},
+		},
+		{
+			"runner:\n  steps:\n    - id: make\n      param: [build]\n",
+			[]string{"line 4: runner.steps[0].param is not a known setting (did you mean params?)"},
+		},
+		{
+			"runner:\n  id: make\ncache:\n  ttl: a day\n",
+			[]string{"line 4: cache.ttl must be a duration, eg 24h"},
+		},
+		{
+			"runner:\n  id: make\ncache:\n  destination: s3://bucket/cache/\n  readOnly: false\n",
+			[]string{"line 5: cache.readOnly is not a known setting"},
+		},
+		{"runner:\n  id: make\nlog:\n  maxSize: 10MB\n  maxFiles: 5\n", nil},
+		{
+			"runner:\n  id: make\nlog:\n  maxFiles: some\n",
+			[]string{"line 4: log.maxFiles must be a whole number"},
+		},
+		{"runner:\n  id: make\nlog:\n  format: json\n", nil},
+		{"runner:\n  id: make\nartifacts:\n  signing:\n    method: cosign\n    key: cosign.key\n", nil},
+		{
+			"runner:\n  id: make\nartifacts:\n  signing:\n    method: notary\n",
+			[]string{"line 5: artifacts.signing.method must be one of cosign, gpg"},
+		},
+		{"runner:\n  id: make\nmaterials:\n  - uri: https://example.com/deps.tar.gz\n    timeout: 5m\n    maxSize: 2GB\n", nil},
+		{
+			"runner:\n  id: make\nmaterials:\n  - uri: https://example.com/deps.tar.gz\n    maxSize: huge\n",
+			[]string{"line 5: materials[0].maxSize must be a size, eg 500MB"},
+		},
+		{"runner:\n  id: make\nartifacts:\n  checksums:\n    algorithms: [sha256]\n    sidecars: true\n", nil},
+		{
+			"runner:\n  id: make\nartifacts:\n  checksums:\n    algorithms: [md5]\n",
+			[]string{"line 5: artifacts.checksums.algorithms[0] must be one of sha256, sha512"},
+		},
+		{"runner:\n  id: make\nlog:\n  redact: ['(password=)\\S+']\n", nil},
+		{"runner:\n  id: make\nnotifications:\n  github:\n    repository: mattermost/mattermost-server\n    checkRun: true\n", nil},
+		{
+			"runner:\n  id: make\nnotifications:\n  github:\n    checkRun: yes please\n",
+			[]string{"line 5: notifications.github.checkRun must be true or false"},
+		},
+		{"runner:\n  id: make\nannotations:\n  ticket: MM-1234\n", nil},
+		{
+			"runner:\n  id: make\nannotations:\n  tickets: [MM-1, MM-2]\n",
+			[]string{"line 4: annotations.tickets must be a string"},
+		},
+		{
+			"runner:\n  id: make\nlog:\n  format: xml\n",
+			[]string{"line 4: log.format must be one of text, json"},
+		},
+		{"sbom: true\n", []string{"line 1: runner is required"}},
+	} {
+		err := ValidateConfigSchema([]byte(tc.conf))
+		if tc.messages == nil {
+			require.NoError(t, err, tc.conf)
+			continue
+		}
+		require.True(t, errors.Is(err, ErrInvalidConfig), tc.conf)
+		var schemaErrs SchemaErrors
+		require.True(t, errors.As(err, &schemaErrs))
+		messages := []string{}
+		for _, e := range schemaErrs {
+			messages = append(messages, e.Error())
+		}
+		require.Equal(t, tc.messages, messages, tc.conf)
+	}
+}
+
+func TestValidateSchemaAliases(t *testing.T) {
+	// A recursive schema follows aliases as deep as the data goes
+	root := &schema{}
+	require.NoError(t, json.Unmarshal([]byte(
+		`{"$ref": "#/$defs/list", "$defs": {"list": {"type": "array", "items": {"$ref": "#/$defs/list"}}}}`,
+	), root))
+	validate := func(data string) (*schemaValidator, error) {
+		doc := &yaml.Node{}
+		require.NoError(t, yaml.Unmarshal([]byte(data), doc))
+		v := &schemaValidator{root: root, aliases: map[*yaml.Node]bool{}}
+		return v, v.validate(root, doc.Content[0], "")
+	}
+
+	// Aliases contained in their anchor are reported instead of looping
+	v, err := validate("&list [[], *list]\n")
+	require.NoError(t, err)
+	require.Len(t, v.errors, 1)
+	require.Equal(t, "line 1: [1][1] refers to itself through alias *list", v.errors[0].Error())
+
+	// Aliases of aliases cannot expand without bounds
+	laughs := "- &l0 [[], [], [], [], [], [], [], [], [], []]\n"
+	for i := 1; i < 7; i++ {
+		laughs += fmt.Sprintf("- &l%d [", i) + strings.Repeat(fmt.Sprintf("*l%d, ", i-1), 9) + fmt.Sprintf("*l%d]\n", i-1)
+	}
+	_, err = validate(laughs)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expand to more than")
+}
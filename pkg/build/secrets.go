@@ -0,0 +1,193 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+)
+
+// Types of the secrets providers that can be defined in the configuration
+const (
+	SecretsProviderEnv  = "env"  // Secrets read from environment variables
+	SecretsProviderFile = "file" // Secrets read from a file of NAME=value lines
+	SecretsProviderDir  = "dir"  // Secrets read from a directory with a file per secret, eg a mounted Kubernetes secret
+)
+
+// redactedSecret replaces the values of secrets where they would be shown
+const redactedSecret = runners.Masked
+
+// ErrSecretNotFound is returned when no provider has a secret required by
+// the build
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretsProvider looks up the values of the secrets of a build
+type SecretsProvider interface {
+	// GetSecret returns the value of the secret and true, or false if the
+	// provider does not have it
+	GetSecret(name string) (string, bool, error)
+}
+
+// EnvSecretsProvider reads secrets from the environment variables named
+// as the secrets, with an optional prefix
+type EnvSecretsProvider struct {
+	Prefix string
+}
+
+// GetSecret returns the value of the environment variable
+func (ep *EnvSecretsProvider) GetSecret(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(ep.Prefix + name)
+	return value, ok, nil
+}
+
+// FileSecretsProvider reads secrets from a file with a NAME=value line
+// per secret. Empty lines and lines starting with # are ignored.
+type FileSecretsProvider struct {
+	Path string
+}
+
+// GetSecret returns the value of the secret in the file
+func (fp *FileSecretsProvider) GetSecret(name string) (string, bool, error) {
+	data, err := os.ReadFile(fp.Path)
+	if err != nil {
+		return "", false, fmt.Errorf("reading secrets file: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == name {
+			return parts[1], true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", false, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	return "", false, nil
+}
+
+// DirSecretsProvider reads each secret from the file named as the secret
+// in a directory. A trailing newline is trimmed from the value.
+type DirSecretsProvider struct {
+	Path string
+}
+
+// GetSecret returns the contents of the secret file
+func (dp *DirSecretsProvider) GetSecret(name string) (string, bool, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", false, fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(dp.Path, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("reading secret %s: %w", name, err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), true, nil
+}
+
+// SecretsProviders looks up secrets in a list of providers, in order. The
+// first one that has a secret sets its value.
+type SecretsProviders []SecretsProvider
+
+// GetSecret returns the value of the secret in the first provider that has it
+func (sp SecretsProviders) GetSecret(name string) (string, bool, error) {
+	for _, p := range sp {
+		value, ok, err := p.GetSecret(name)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// NewSecretsProvider returns the provider defined in the configuration
+func NewSecretsProvider(conf *SecretsProviderConfig) (SecretsProvider, error) {
+	switch conf.Type {
+	case SecretsProviderEnv:
+		return &EnvSecretsProvider{Prefix: conf.Prefix}, nil
+	case SecretsProviderFile:
+		return &FileSecretsProvider{Path: conf.Path}, nil
+	case SecretsProviderDir:
+		return &DirSecretsProvider{Path: conf.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets provider type %q", conf.Type)
+	}
+}
+
+// envValue returns the value of an environment variable of the
+// configuration, taken from its secret if it has one
+func envValue(e *EnvConfig, secrets map[string]string) string {
+	if e.ValueFrom.Secret != "" {
+		return secrets[e.ValueFrom.Secret]
+	}
+	return e.Value
+}
+
+// isSecretVar returns true if the environment variable holds a secret
+func isSecretVar(opts *runners.Options, name string) bool {
+	for _, v := range opts.SecretVars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecrets returns the values of the secrets defined in the
+// configuration. It uses provider if set, or the providers in the
+// configuration. Without either, secrets are read from the environment.
+func resolveSecrets(conf *Config, provider SecretsProvider) (map[string]string, error) {
+	if provider == nil {
+		providers := SecretsProviders{}
+		for i := range conf.SecretsProviders {
+			p, err := NewSecretsProvider(&conf.SecretsProviders[i])
+			if err != nil {
+				return nil, fmt.Errorf("secrets provider #%d: %w", i, err)
+			}
+			providers = append(providers, p)
+		}
+		if len(providers) == 0 {
+			providers = append(providers, &EnvSecretsProvider{})
+		}
+		provider = providers
+	}
+
+	secrets := map[string]string{}
+	for _, s := range conf.Secrets {
+		value, ok, err := provider.GetSecret(s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("getting secret %s: %w", s.Name, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", s.Name, ErrSecretNotFound)
+		}
+		secrets[s.Name] = value
+	}
+	return secrets, nil
+}
+
+// maskedArguments returns the arguments of a runner with the sensitive
+// values they may have been expanded with masked
+func maskedArguments(runner runners.Runner) []string {
+	args := []string{}
+	for _, a := range runner.Arguments() {
+		args = append(args, runner.Options().Mask(a))
+	}
+	return args
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretsProviders(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "TOKEN"), []byte("from-dir\n"), os.FileMode(0o600)))
+	file := filepath.Join(t.TempDir(), "secrets.env")
+	require.NoError(t, os.WriteFile(file, []byte("# Build secrets\nTOKEN=from=file\nKEY=abc\n"), os.FileMode(0o600)))
+	t.Setenv("TEST_TOKEN", "from-env")
+
+	for _, tc := range []struct {
+		provider SecretsProvider
+		name     string
+		value    string
+		found    bool
+	}{
+		{&EnvSecretsProvider{Prefix: "TEST_"}, "TOKEN", "from-env", true},
+		{&EnvSecretsProvider{Prefix: "TEST_"}, "KEY", "", false},
+		{&FileSecretsProvider{Path: file}, "TOKEN", "from=file", true},
+		{&FileSecretsProvider{Path: file}, "MISSING", "", false},
+		{&DirSecretsProvider{Path: dir}, "TOKEN", "from-dir", true},
+		{&DirSecretsProvider{Path: dir}, "KEY", "", false},
+		// The first provider with the secret sets its value
+		{SecretsProviders{&DirSecretsProvider{Path: dir}, &FileSecretsProvider{Path: file}}, "KEY", "abc", true},
+		{SecretsProviders{&DirSecretsProvider{Path: dir}, &FileSecretsProvider{Path: file}}, "TOKEN", "from-dir", true},
+	} {
+		value, found, err := tc.provider.GetSecret(tc.name)
+		require.NoError(t, err)
+		require.Equal(t, tc.found, found)
+		require.Equal(t, tc.value, value)
+	}
+
+	// Secret names cannot leave the secrets directory
+	_, _, err := (&DirSecretsProvider{Path: dir}).GetSecret("../TOKEN")
+	require.Error(t, err)
+}
+
+func TestLoadSecrets(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runners.DefaultOptions.EnvVars = map[string]string{}
+
+	dir := t.TempDir()
+	secretsDir := filepath.Join(dir, "secrets")
+	require.NoError(t, os.Mkdir(secretsDir, os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "API_TOKEN"), []byte("s3cr3t\n"), os.FileMode(0o600)))
+	conf := filepath.Join(dir, ConfigFileName)
+	require.NoError(t, os.WriteFile(conf, []byte(`runner:
+  id: make
+secrets:
+  - name: API_TOKEN
+secretsProviders:
+  - type: dir
+    path: `+secretsDir+`
+env:
+  - var: TOKEN
+    valueFrom:
+      secret: API_TOKEN
+  - var: GOOS
+    value: linux
+  - var: SIGNING_KEY
+    value: k3y
+    sensitive: true
+  - var: AUTH
+    value: "Bearer s3cr3t"
+replacements:
+  - tag: "%TOKEN%"
+    paths: ["config.go"]
+    valueFrom:
+      secret: API_TOKEN
+`), os.FileMode(0o644)))
+
+	// Secrets are set in the replacements and the environment
+	b, err := NewFromConfigFile(conf)
+	require.NoError(t, err)
+	require.Len(t, b.Replacements, 1)
+	require.Equal(t, "s3cr3t", b.Replacements[0].Value)
+	require.True(t, b.Replacements[0].Secret)
+	require.Equal(t, "s3cr3t", b.Options().EnvVars["TOKEN"])
+	require.Equal(t, []string{"TOKEN", "SIGNING_KEY"}, b.Options().SecretVars)
+	require.Equal(t, []string{"s3cr3t"}, b.Options().MaskedValues)
+
+	// But they are not recorded in the provenance
+	b.Options().Workdir = dir
+	statement, err := b.Run().Provenance()
+	require.NoError(t, err)
+	env, ok := statement.Predicate.Invocation.Environment.(map[string]string)
+	require.True(t, ok)
+	require.NotContains(t, env, "TOKEN")
+	require.NotContains(t, env, "SIGNING_KEY")
+	require.Equal(t, "linux", env["GOOS"])
+	// Secret values in other variables are masked
+	require.Equal(t, "Bearer [redacted]", env["AUTH"])
+
+	// Builds fail to load if a secret is missing
+	require.NoError(t, os.Remove(filepath.Join(secretsDir, "API_TOKEN")))
+	_, err = NewFromConfigFile(conf)
+	require.True(t, errors.Is(err, ErrSecretNotFound))
+}
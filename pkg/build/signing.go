@@ -0,0 +1,230 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/sirupsen/logrus"
+)
+
+// Methods to sign the artifacts
+const (
+	SigningCosign = "cosign" // cosign sign-blob, with a key or keyless with a Fulcio certificate
+	SigningGPG    = "gpg"    // GPG detached ASCII armored signatures
+)
+
+// oidFulcioIssuer is the certificate extension of Fulcio holding the OIDC
+// issuer which authenticated the signer
+var oidFulcioIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+// Signature is the signature of an artifact, written next to it
+type Signature struct {
+	Artifact    string `json:"artifact"`              // Artifact signed, relative to the workdir
+	Signature   string `json:"signature"`             // Signature file, relative to the workdir
+	Certificate string `json:"certificate,omitempty"` // Signing certificate of keyless cosign signatures
+}
+
+// SignerIdentity is who signed the artifacts of a run, recorded in the
+// provenance
+type SignerIdentity struct {
+	Method   string `json:"method"`             // SigningCosign or SigningGPG
+	Key      string `json:"key,omitempty"`      // Cosign key reference or GPG key fingerprint
+	Identity string `json:"identity,omitempty"` // Email or URI of the keyless certificate, or GPG user ID
+	Issuer   string `json:"issuer,omitempty"`   // OIDC issuer of the keyless certificate
+}
+
+// signArtifacts signs the file artifacts with the configured method. The
+// signatures are added to the artifacts, so they are stored next to them,
+// and to the transfers sending the files they sign to a prefix.
+func (dri *defaultRunImplementation) signArtifacts(r *Run) error {
+	conf := r.opts.Artifacts.Signing
+	if conf.Method == "" {
+		return nil
+	}
+	workdir := r.runner.Options().Workdir
+	files := []string{}
+	for _, path := range r.opts.Artifacts.Files {
+		info, err := os.Stat(filepath.Join(workdir, path))
+		if err != nil {
+			return fmt.Errorf("checking artifact %s: %w", path, err)
+		}
+		if info.IsDir() {
+			logrus.Infof("Not signing artifact directory %s", path)
+			continue
+		}
+		files = append(files, path)
+	}
+
+	r.Signatures = []Signature{}
+	sidecars := map[string][]string{}
+	for _, path := range files {
+		sig, err := signFile(r, conf, path)
+		if err != nil {
+			return fmt.Errorf("signing %s: %w", path, err)
+		}
+		r.Signatures = append(r.Signatures, *sig)
+		sidecars[path] = append(sidecars[path], sig.Signature)
+		if sig.Certificate != "" {
+			sidecars[path] = append(sidecars[path], sig.Certificate)
+		}
+	}
+
+	signer, err := signerIdentity(r, conf)
+	if err != nil {
+		return fmt.Errorf("reading signer identity: %w", err)
+	}
+	r.Signer = signer
+	logrus.Infof("Signed %d artifacts with %s as %s", len(files), conf.Method, signer.Identity)
+
+	for _, path := range files {
+		for _, f := range sidecars[path] {
+			if !contains(r.opts.Artifacts.Files, f) {
+				r.opts.Artifacts.Files = append(r.opts.Artifacts.Files, f)
+			}
+		}
+	}
+	return addSidecarTransfers(r, files, sidecars, nil)
+}
+
+// signFile signs an artifact, writing the signature next to it
+func signFile(r *Run, conf SigningConfig, path string) (*Signature, error) {
+	switch conf.Method {
+	case SigningCosign:
+		sig := &Signature{Artifact: path, Signature: path + ".sig"}
+		args := []string{"sign-blob", "--yes", "--output-signature", sig.Signature}
+		if conf.Key != "" {
+			args = append(args, "--key", conf.Key)
+		} else {
+			sig.Certificate = path + ".pem"
+			args = append(args, "--output-certificate", sig.Certificate)
+		}
+		return sig, signCommand(r, "cosign", append(args, path)...)
+	case SigningGPG:
+		sig := &Signature{Artifact: path, Signature: path + ".asc"}
+		args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", sig.Signature}
+		if conf.Key != "" {
+			args = append(args, "--local-user", conf.Key)
+		}
+		return sig, signCommand(r, "gpg", append(args, path)...)
+	}
+	return nil, fmt.Errorf("unsupported signing method %s", conf.Method)
+}
+
+// signCommand runs a signing tool in the working directory of the runner,
+// with its environment so keys and passwords can come from secrets. The
+// output is returned in the error when the command fails.
+func signCommand(r *Run, name string, args ...string) error {
+	cmd := exec.CommandContext(r.context(), name, args...)
+	cmd.Dir = r.runner.Options().Workdir
+	cmd.Env = os.Environ()
+	for v, val := range r.runner.Options().EnvVars {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", v, val))
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(
+			"running %s: %w: %s", name, err,
+			runners.MaskString(strings.TrimSpace(string(output)), r.runner.Options().SensitiveValues(), r.runner.Options().SensitivePatterns()),
+		)
+	}
+	return nil
+}
+
+// signerIdentity returns who signed the artifacts: the subject of the
+// keyless certificate, the cosign key or the GPG key and its user
+func signerIdentity(r *Run, conf SigningConfig) (*SignerIdentity, error) {
+	signer := &SignerIdentity{Method: conf.Method, Key: conf.Key}
+	switch {
+	case conf.Method == SigningCosign && conf.Key == "":
+		if len(r.Signatures) == 0 {
+			return signer, nil
+		}
+		cert, err := readCertificate(filepath.Join(r.runner.Options().Workdir, r.Signatures[0].Certificate))
+		if err != nil {
+			return nil, err
+		}
+		if len(cert.EmailAddresses) > 0 {
+			signer.Identity = cert.EmailAddresses[0]
+		} else if len(cert.URIs) > 0 {
+			signer.Identity = cert.URIs[0].String()
+		}
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oidFulcioIssuer) {
+				signer.Issuer = string(ext.Value)
+			}
+		}
+	case conf.Method == SigningGPG:
+		args := []string{"--batch", "--with-colons", "--fingerprint", "--list-secret-keys"}
+		if conf.Key != "" {
+			args = append(args, conf.Key)
+		}
+		cmd := exec.CommandContext(r.context(), "gpg", args...)
+		cmd.Env = os.Environ()
+		for v, val := range r.runner.Options().EnvVars {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", v, val))
+		}
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("listing gpg keys: %w", err)
+		}
+		signer.Key, signer.Identity = parseGPGKey(string(output))
+	}
+	return signer, nil
+}
+
+// parseGPGKey returns the fingerprint and user ID of the first key in the
+// colon listing of gpg
+func parseGPGKey(listing string) (fingerprint, uid string) {
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "fpr":
+			if fingerprint == "" {
+				fingerprint = fields[9]
+			}
+		case "uid":
+			if uid == "" {
+				uid = fields[9]
+			}
+		}
+	}
+	return fingerprint, uid
+}
+
+// readCertificate reads a PEM certificate. Some cosign versions write it
+// base64 encoded.
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+			block, _ = pem.Decode(decoded)
+		}
+	}
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing certificate: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a keyless signing certificate of an email
+// to path
+func writeTestCertificate(t *testing.T, path, email string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(10 * time.Minute),
+		EmailAddresses: []string{email},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidFulcioIssuer, Value: []byte("https://accounts.google.com")},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), os.FileMode(0o644)))
+}
+
+// fakeSigningTools puts cosign and gpg scripts in the PATH which log their
+// arguments and write the files they are asked for
+func fakeSigningTools(t *testing.T, cert string) (logFile string) {
+	bin := t.TempDir()
+	logFile = filepath.Join(bin, "args.log")
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "cosign"), []byte(`#!/bin/sh
+echo "cosign $@" >> `+logFile+`
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --output-signature) echo signature > "$2"; shift;;
+    --output-certificate) cp `+cert+` "$2"; shift;;
+  esac
+  shift
+done
+`), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "gpg"), []byte(`#!/bin/sh
+echo "gpg $@" >> `+logFile+`
+case "$*" in
+  *--list-secret-keys*)
+    echo "sec:u:255:22:6A1B2C3D4E5F6071:1633000000:::u:::scESC:::+:::ed25519:::0:"
+    echo "fpr:::::::::0F1E2D3C4B5A69788796A5B46A1B2C3D4E5F6071:"
+    echo "uid:u::::1633000000::ABCDEF::Release Bot <release@example.com>::::::::::0:"
+    exit 0;;
+esac
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --output) echo "-----BEGIN PGP SIGNATURE-----" > "$2"; shift;;
+  esac
+  shift
+done
+`), os.FileMode(0o755)))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logFile
+}
+
+func TestSignArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	writeTestCertificate(t, cert, "release@example.com")
+	logFile := fakeSigningTools(t, cert)
+
+	runner := runners.NewMake("build")
+	runner.Options().Workdir = dir
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "dist", "docs"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dist", "server.tar.gz"), []byte("server\n"), os.FileMode(0o644)))
+	newRun := func(signing SigningConfig) *Run {
+		return &Run{
+			impl:   &defaultRunImplementation{},
+			runner: runner,
+			opts: &RunOptions{
+				Artifacts: ArtifactsConfig{Files: []string{"dist/server.tar.gz", "dist/docs"}, Signing: signing},
+				Transfers: []TransferConfig{{Source: []string{"dist/server.tar.gz"}, Destination: "s3://releases/server/"}},
+			},
+		}
+	}
+
+	// Keyless cosign signatures come with the certificate of the signer
+	r := newRun(SigningConfig{Method: SigningCosign})
+	require.NoError(t, r.impl.signArtifacts(r))
+	require.Equal(t, []Signature{{
+		Artifact: "dist/server.tar.gz", Signature: "dist/server.tar.gz.sig", Certificate: "dist/server.tar.gz.pem",
+	}}, r.Signatures)
+	require.Equal(t, &SignerIdentity{
+		Method: SigningCosign, Identity: "release@example.com", Issuer: "https://accounts.google.com",
+	}, r.Signer)
+	require.Equal(t, []string{
+		"dist/server.tar.gz", "dist/docs", "dist/server.tar.gz.sig", "dist/server.tar.gz.pem",
+	}, r.opts.Artifacts.Files)
+	require.Equal(t, []string{
+		"dist/server.tar.gz", "dist/server.tar.gz.sig", "dist/server.tar.gz.pem",
+	}, r.opts.Transfers[0].Source)
+
+	// The signer is recorded in the provenance
+	config, ok := provenanceBuildConfig(r).(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, r.Signer, config["signing"].(map[string]interface{})["signer"])
+
+	// Key based cosign signatures have no certificate
+	r = newRun(SigningConfig{Method: SigningCosign, Key: "awskms:///alias/release"})
+	require.NoError(t, r.impl.signArtifacts(r))
+	require.Equal(t, "", r.Signatures[0].Certificate)
+	require.Equal(t, &SignerIdentity{Method: SigningCosign, Key: "awskms:///alias/release"}, r.Signer)
+
+	// GPG signatures are detached and armored, the key is identified by
+	// its fingerprint and user
+	r = newRun(SigningConfig{Method: SigningGPG, Key: "release@example.com"})
+	require.NoError(t, r.impl.signArtifacts(r))
+	require.Equal(t, "dist/server.tar.gz.asc", r.Signatures[0].Signature)
+	require.FileExists(t, filepath.Join(dir, "dist", "server.tar.gz.asc"))
+	require.Equal(t, &SignerIdentity{
+		Method: SigningGPG, Key: "0F1E2D3C4B5A69788796A5B46A1B2C3D4E5F6071", Identity: "Release Bot <release@example.com>",
+	}, r.Signer)
+
+	args, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"cosign sign-blob --yes --output-signature dist/server.tar.gz.sig --output-certificate dist/server.tar.gz.pem dist/server.tar.gz",
+		"cosign sign-blob --yes --output-signature dist/server.tar.gz.sig --key awskms:///alias/release dist/server.tar.gz",
+		"gpg --batch --yes --armor --detach-sign --output dist/server.tar.gz.asc --local-user release@example.com dist/server.tar.gz",
+		"gpg --batch --with-colons --fingerprint --list-secret-keys release@example.com",
+	}, strings.Split(strings.TrimSpace(string(args)), "\n"))
+
+	// Without a method, nothing is signed
+	r = newRun(SigningConfig{})
+	require.NoError(t, r.impl.signArtifacts(r))
+	require.Nil(t, r.Signer)
+}
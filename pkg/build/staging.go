@@ -0,0 +1,93 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// StagingScheme identifies a version of the algorithm that computes
+// staging paths
+type StagingScheme int
+
+const (
+	// StagingSchemeV1 hashes the build point and the materials:
+	//  1. Sort the materials by URI
+	//  2. Concat: buildpoint + (materials.URL[n]+materials.Sha[n])
+	//  2a: Sha is the first digest found in this order: sha1 sha256 sha512 (else fail)
+	//  3. Hash the whole string with sha256 and hex encode it
+	StagingSchemeV1 StagingScheme = 1
+
+	// CurrentStagingScheme is the scheme used by StagingPath and runs
+	CurrentStagingScheme = StagingSchemeV1
+)
+
+// InputFingerprintEnvVar is the variable with the input fingerprint of
+// the run in the runner environment
+const InputFingerprintEnvVar = "MMBUILD_INPUT_FINGERPRINT"
+
+// StagingPath returns the path where a build of buildPoint with materials
+// stages its artifacts, relative to the artifacts destination. External
+// tools can use it to predict where the artifacts of a build will land.
+//
+// The path is computed with CurrentStagingScheme. The paths a scheme
+// produces never change: modifying the algorithm requires a new scheme,
+// and the current one only changes in a new major version of the module.
+// Use StagingPathWithScheme to pin a scheme.
+//
+// Note that these paths are intended only for the staging directories
+// where the build system stores its artifacts, not for human use.
+func StagingPath(buildPoint string, materials MaterialsConfig) (string, error) {
+	return StagingPathWithScheme(CurrentStagingScheme, buildPoint, materials)
+}
+
+// StagingPathWithScheme returns the staging path of a build computed
+// with a specific version of the algorithm
+func StagingPathWithScheme(scheme StagingScheme, buildPoint string, materials MaterialsConfig) (string, error) {
+	if buildPoint == "" && len(materials) == 0 {
+		return "", errors.New("unable to produce staging path without buildpoint or artifacts")
+	}
+	switch scheme {
+	case StagingSchemeV1:
+		return stagingPathV1(buildPoint, materials)
+	default:
+		return "", fmt.Errorf("unknown staging path scheme %d", scheme)
+	}
+}
+
+// stagingPathV1 implements StagingSchemeV1
+func stagingPathV1(buildPoint string, materials MaterialsConfig) (string, error) {
+	str := buildPoint
+	list := []string{}
+	arts := map[string]string{}
+	// Cycle the shas and pickup the first hash defined according
+	// to the criteria above
+	for _, m := range materials {
+		list = append(list, m.URI)
+		arts[m.URI] = ""
+		for _, algo := range []string{"sha1", "sha256", "sha512"} {
+			if v, ok := m.Digest[algo]; ok {
+				arts[m.URI] = v
+				break
+			}
+		}
+		if arts[m.URI] == "" {
+			return "", fmt.Errorf("unable to locate sha for %s in materials config", m.URI)
+		}
+	}
+
+	// Sort the URIs to make the list predictable
+	sort.Strings(list)
+
+	// Concat the strings and hashes
+	for _, u := range list {
+		str += u + arts[u]
+	}
+
+	// Hash the string
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(str))), nil
+}
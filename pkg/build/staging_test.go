@@ -0,0 +1,46 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagingPathScheme(t *testing.T) {
+	buildPoint := "46305d50a15717e2d224e38f2f2bdc9027a7cbc7"
+	materials := MaterialsConfig{
+		{
+			URI:    "http://example.com/repo/go.sum",
+			Digest: map[string]string{"sha1": "ac74142d9394dc40c046eadc99b19c95b6f8d5d3"},
+		},
+		{
+			URI:    "http://example.com/repo/go.mod",
+			Digest: map[string]string{"sha1": "61a7663a7c0f46ab149ec2cadd44fc3cc30f9403"},
+		},
+		{
+			URI:    "http://example.com/repo/source.go",
+			Digest: map[string]string{"sha512": "efbedc70276435eaf861152cb139dccc91c31c5955385b6797feaf36f3ad7a974b07aec012a135c2105aefcb606fffd50b261efa8be7f993f5c55cf7fba703e9"},
+		},
+	}
+
+	// Paths computed by a scheme must never change
+	path, err := StagingPathWithScheme(StagingSchemeV1, buildPoint, materials)
+	require.NoError(t, err)
+	require.Equal(t, "9241fbc43a90babf28912d4662580f8740e709237c1797a29ea5ee64558c7b9f", path)
+
+	current, err := StagingPath(buildPoint, materials)
+	require.NoError(t, err)
+	require.Equal(t, path, current)
+
+	_, err = StagingPathWithScheme(StagingScheme(0), buildPoint, materials)
+	require.Error(t, err)
+	_, err = StagingPath("", nil)
+	require.Error(t, err)
+
+	// Materials without a digest cannot be staged
+	_, err = StagingPath(buildPoint, MaterialsConfig{{URI: "http://example.com/repo/go.mod"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultStatusContext is the name of the commit statuses and check runs
+// reporting the runs on GitHub
+const DefaultStatusContext = "matterbuild"
+
+const (
+	statusLogLines   = 50               // Lines of the end of the runner log shown in check runs
+	statusAPITimeout = 30 * time.Second // Time to wait for GitHub to take a status
+)
+
+// splitRepository returns the owner and name of a repository written as
+// owner/name
+func splitRepository(repo string) (owner, name string, err error) {
+	parts := strings.Split(repo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("repository %q is not in owner/name form", repo)
+	}
+	return parts[0], parts[1], nil
+}
+
+// statusReporter posts the progress of a run to the build point commit
+type statusReporter struct {
+	run   *Run
+	repo  *github.Repository
+	conf  GitHubStatusConfig
+	check *github.CheckRun // Check run created when the build started
+}
+
+// ReportStatus reports the progress of the run on its build point commit
+// in repo: a pending commit status when the runner is about to execute,
+// and success or failure when the run finishes. With conf.CheckRun, a
+// check run is reported instead, ending with the annotations and the
+// end of the log of the run. Failures to reach GitHub are logged, they
+// do not fail the run. Dry runs are not reported.
+func (r *Run) ReportStatus(repo *github.Repository, conf GitHubStatusConfig) {
+	if r.opts.DryRun {
+		logrus.Infof("Not reporting dry run %s on GitHub", r.ID())
+		return
+	}
+	if conf.Context == "" {
+		conf.Context = DefaultStatusContext
+	}
+	sr := &statusReporter{run: r, repo: repo, conf: conf}
+	r.Before(PhaseBuild, func(*Run) error {
+		sr.started()
+		return nil
+	})
+
+	// The run may fail in any phase, its end is known from its events
+	if r.opts.Events == nil {
+		r.opts.Events = NewEventBus()
+	}
+	var unsubscribe func()
+	unsubscribe = r.opts.Events.Subscribe(func(e Event) {
+		if e.Run != r.ID() || (e.Type != EventRunSucceeded && e.Type != EventRunFailed) {
+			return
+		}
+		unsubscribe()
+		sr.finished(e.Type == EventRunSucceeded)
+	})
+}
+
+// apiContext returns the context of the GitHub calls. It does not derive
+// from the run context so canceled runs still report their failure.
+func (sr *statusReporter) apiContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), statusAPITimeout)
+}
+
+func (sr *statusReporter) started() {
+	r := sr.run
+	if r.opts.BuildPoint == "" {
+		logrus.Warnf("Not reporting run %s on GitHub, its build point commit is not known", r.ID())
+		return
+	}
+	ctx, cancel := sr.apiContext()
+	defer cancel()
+	if sr.conf.CheckRun {
+		check, err := sr.repo.CreateCheckRun(ctx, sr.conf.Context, r.opts.BuildPoint, &github.CheckRunOptions{
+			Title:      fmt.Sprintf("%s build", r.runner.ID()),
+			Summary:    fmt.Sprintf("Run #%s is building.", r.ID()),
+			Status:     github.CheckStatusInProgress,
+			DetailsURL: sr.conf.TargetURL,
+		}, nil)
+		if err != nil {
+			logrus.Warnf("Unable to report run %s on GitHub: %v", r.ID(), err)
+			return
+		}
+		sr.check = check
+		return
+	}
+	if err := sr.repo.SetCommitStatus(ctx, r.opts.BuildPoint, sr.conf.Context, github.CommitStatePending, &github.CommitStatusOptions{
+		Description: fmt.Sprintf("Run %s is building", r.ID()),
+		TargetURL:   sr.conf.TargetURL,
+	}); err != nil {
+		logrus.Warnf("Unable to report run %s on GitHub: %v", r.ID(), err)
+	}
+}
+
+func (sr *statusReporter) finished(success bool) {
+	r := sr.run
+	if r.opts.BuildPoint == "" {
+		logrus.Warnf("Not reporting run %s on GitHub, its build point commit is not known", r.ID())
+		return
+	}
+	ctx, cancel := sr.apiContext()
+	defer cancel()
+
+	if !sr.conf.CheckRun {
+		state, description := github.CommitStateSuccess, fmt.Sprintf("Run %s succeeded", r.ID())
+		if !success {
+			state, description = github.CommitStateFailure, fmt.Sprintf("Run %s failed: %s", r.ID(), sr.runError())
+		}
+		if err := sr.repo.SetCommitStatus(ctx, r.opts.BuildPoint, sr.conf.Context, state, &github.CommitStatusOptions{
+			Description: description, TargetURL: sr.conf.TargetURL,
+		}); err != nil {
+			logrus.Warnf("Unable to report run %s on GitHub: %v", r.ID(), err)
+		}
+		return
+	}
+
+	conclusion := github.CheckConclusionSuccess
+	if !success {
+		conclusion = github.CheckConclusionFailure
+	}
+	annotations := []*github.CheckAnnotation{}
+	text := ""
+	if r.Attempts > 0 && len(r.Logs) >= r.Attempts {
+		var err error
+		if annotations, err = r.Annotations(); err != nil {
+			logrus.Warnf("Unable to parse the logs of run %s: %v", r.ID(), err)
+		}
+		text = statusLogExcerpt(r)
+	}
+	summary := checkRunSummary(r, conclusion, annotations)
+	if r.err != nil {
+		summary += "\n\n" + sr.runError()
+	}
+	opts := &github.CheckRunOptions{
+		Title:      fmt.Sprintf("%s build", r.runner.ID()),
+		Summary:    summary,
+		Text:       text,
+		Conclusion: conclusion,
+		DetailsURL: sr.conf.TargetURL,
+	}
+	var err error
+	if sr.check != nil {
+		_, err = sr.repo.UpdateCheckRun(ctx, sr.check.ID, sr.conf.Context, opts, annotations)
+	} else {
+		// The run failed before the runner executed
+		_, err = sr.repo.CreateCheckRun(ctx, sr.conf.Context, r.opts.BuildPoint, opts, annotations)
+	}
+	if err != nil {
+		logrus.Warnf("Unable to report run %s on GitHub: %v", r.ID(), err)
+	}
+}
+
+// runError returns the error of the run with its secrets masked
+func (sr *statusReporter) runError() string {
+	if sr.run.err == nil {
+		return ""
+	}
+	return sr.run.runner.Options().Mask(sr.run.err.Error())
+}
+
+// statusLogExcerpt returns the end of the output and error logs of the
+// last attempt of the run as markdown
+func statusLogExcerpt(r *Run) string {
+	sections := []string{}
+	if r.Attempts == 0 || len(r.Logs) < r.Attempts {
+		return ""
+	}
+	logs := map[string]string{"Output": r.Logs[r.Attempts-1]}
+	if len(r.ErrorLogs) >= r.Attempts {
+		logs["Errors"] = r.ErrorLogs[r.Attempts-1]
+	}
+	for _, title := range []string{"Output", "Errors"} {
+		path, ok := logs[title]
+		if !ok {
+			continue
+		}
+		lines, err := tailLines(path, statusLogLines)
+		if err != nil {
+			logrus.Warnf("Unable to read run log: %v", err)
+			continue
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		sections = append(sections, fmt.Sprintf(
+			"### %s (last %d lines)\n\n```\n%s\n```", title, len(lines), strings.Join(lines, "\n"),
+		))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// tailLines returns the last n lines of a file
+func tailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening log: %w", err)
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading log: %w", err)
+	}
+	return lines, nil
+}
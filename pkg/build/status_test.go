@@ -0,0 +1,113 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/mattermost/cicd-sdk/pkg/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+// newStatusTestRun returns a run of a git repository with a Makefile
+func newStatusTestRun(t *testing.T, makefile string) *Run {
+	workdir, head := newTestRepo(t, map[string]string{
+		"Makefile": makefile,
+	})
+
+	runner := runners.NewMake("build")
+	require.NoError(t, runners.Isolate(runner))
+	runner.Options().Workdir = workdir
+	runner.Options().Source = "https://github.com/mattermost/cicd-sdk"
+	r := NewRun(runner)
+	r.opts = &RunOptions{BuildPoint: head, ExistenceCheck: AlwaysBuild}
+	return r
+}
+
+func TestReportStatus(t *testing.T) {
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+
+	gh := testharness.New(t).GitHub()
+	repo := github.NewRepository("mattermost", "cicd-sdk")
+
+	// Commit statuses go from pending to success
+	r := newStatusTestRun(t, "build:\n\techo done\n")
+	statuses := []map[string]interface{}{}
+	gh.Handle("/repos/mattermost/cicd-sdk/statuses/"+r.opts.BuildPoint, func(w http.ResponseWriter, req *http.Request) {
+		status := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&status))
+		statuses = append(statuses, status)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 1}`)) //nolint:errcheck
+	})
+	r.ReportStatus(repo, GitHubStatusConfig{TargetURL: "https://ci.example.com/jobs/1"})
+	require.NoError(t, r.Execute())
+	require.Len(t, statuses, 2)
+	require.Equal(t, github.CommitStatePending, statuses[0]["state"])
+	require.Equal(t, DefaultStatusContext, statuses[0]["context"])
+	require.Equal(t, "https://ci.example.com/jobs/1", statuses[0]["target_url"])
+	require.Equal(t, github.CommitStateSuccess, statuses[1]["state"])
+
+	// Failures are reported with the secrets of the error masked
+	r = newStatusTestRun(t, "build:\n\techo done\n")
+	r.runner.Options().MaskedValues = []string{"s3cr3t"}
+	r.Before(PhaseBuild, func(*Run) error { return errors.New("login with s3cr3t rejected") })
+	statuses = statuses[:0]
+	r.ReportStatus(repo, GitHubStatusConfig{})
+	require.Error(t, r.Execute())
+	require.Len(t, statuses, 1)
+	require.Equal(t, github.CommitStateFailure, statuses[0]["state"])
+	require.NotContains(t, statuses[0]["description"], "s3cr3t")
+	require.Contains(t, statuses[0]["description"], runners.Masked)
+
+	// Dry runs are not reported
+	r = newStatusTestRun(t, "build:\n\techo done\n")
+	r.opts.DryRun = true
+	statuses = statuses[:0]
+	r.ReportStatus(repo, GitHubStatusConfig{})
+	require.NoError(t, r.Execute())
+	require.Empty(t, statuses)
+
+	// Check runs are created in progress and completed with the end of the log
+	r = newStatusTestRun(t, "build:\n\t@echo './main.go:10:2: undefined: foo' >&2\n\t@exit 1\n")
+	var created, updated map[string]interface{}
+	gh.Handle("/repos/mattermost/cicd-sdk/check-runs", func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&created))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 7, "status": "in_progress"}`)) //nolint:errcheck
+	})
+	gh.Handle("/repos/mattermost/cicd-sdk/check-runs/7", func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodPatch, req.Method)
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&updated))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 7, "conclusion": "failure"}`)) //nolint:errcheck
+	})
+	r.ReportStatus(repo, GitHubStatusConfig{Context: "server-build", CheckRun: true})
+	require.Error(t, r.Execute())
+	for _, l := range append(r.Logs, r.ErrorLogs...) {
+		defer os.Remove(l)
+	}
+	require.Equal(t, github.CheckStatusInProgress, created["status"])
+	require.Equal(t, "server-build", created["name"])
+	require.Equal(t, github.CheckConclusionFailure, updated["conclusion"])
+	output := updated["output"].(map[string]interface{})
+	require.Len(t, output["annotations"], 1)
+	require.Contains(t, output["text"], "undefined: foo")
+}
+
+func TestStatusLogExcerptWithoutLogs(t *testing.T) {
+	// An attempt that could not open its log has no log to read
+	r := NewRun(runners.NewMake("build"))
+	r.Attempts = 1
+	require.Empty(t, statusLogExcerpt(r))
+}
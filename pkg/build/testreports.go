@@ -0,0 +1,194 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestSummary counts the results of the tests found in the reports of a run
+type TestSummary struct {
+	Total    int      // Number of tests found in the reports
+	Passed   int      // Tests that passed
+	Failed   int      // Tests that failed or errored
+	Skipped  int      // Tests that were skipped
+	Failures []string // Names of the failed tests
+}
+
+// Add sums the counts of another summary to this one
+func (ts *TestSummary) Add(other *TestSummary) {
+	ts.Total += other.Total
+	ts.Passed += other.Passed
+	ts.Failed += other.Failed
+	ts.Skipped += other.Skipped
+	ts.Failures = append(ts.Failures, other.Failures...)
+}
+
+// junitSuite is a testsuite element of a JUnit XML report. The same
+// struct parses the testsuites root element as suites can be nested.
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []struct {
+		Name      string    `xml:"name,attr"`
+		ClassName string    `xml:"classname,attr"`
+		Failure   *struct{} `xml:"failure"`
+		Error     *struct{} `xml:"error"`
+		Skipped   *struct{} `xml:"skipped"`
+	} `xml:"testcase"`
+}
+
+func (js *junitSuite) summary() *TestSummary {
+	s := &TestSummary{Failures: []string{}}
+	for _, suite := range js.Suites {
+		s.Add(suite.summary())
+	}
+	for _, tc := range js.Cases {
+		s.Total++
+		switch {
+		case tc.Failure != nil || tc.Error != nil:
+			s.Failed++
+			name := tc.Name
+			if tc.ClassName != "" {
+				name = tc.ClassName + "." + tc.Name
+			}
+			s.Failures = append(s.Failures, name)
+		case tc.Skipped != nil:
+			s.Skipped++
+		default:
+			s.Passed++
+		}
+	}
+	return s
+}
+
+// ParseJUnitReport reads the test results from a JUnit XML report
+func ParseJUnitReport(data []byte) (*TestSummary, error) {
+	suite := &junitSuite{}
+	if err := xml.Unmarshal(data, suite); err != nil {
+		return nil, fmt.Errorf("parsing JUnit XML report: %w", err)
+	}
+	return suite.summary(), nil
+}
+
+// ParseGoTestReport reads the test results from the output
+// of go test -json
+func ParseGoTestReport(data []byte) (*TestSummary, error) {
+	s := &TestSummary{Failures: []string{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		event := struct {
+			Action  string
+			Package string
+			Test    string
+		}{}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("parsing go test JSON event: %w", err)
+		}
+		// Package level events don't count as tests
+		if event.Test == "" {
+			continue
+		}
+		switch event.Action {
+		case "pass":
+			s.Passed++
+		case "fail":
+			s.Failed++
+			s.Failures = append(s.Failures, event.Package+"."+event.Test)
+		case "skip":
+			s.Skipped++
+		default:
+			continue
+		}
+		s.Total++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading go test JSON output: %w", err)
+	}
+	return s, nil
+}
+
+// ParseTestReport reads a test report file. JUnit XML and go test JSON
+// reports are supported, the format is detected from the file contents.
+func ParseTestReport(path string) (*TestSummary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading test report: %w", err)
+	}
+	if strings.HasPrefix(string(bytes.TrimSpace(data)), "<") {
+		return ParseJUnitReport(data)
+	}
+	return ParseGoTestReport(data)
+}
+
+// collectTestReports finds the test reports configured for the run and
+// adds up their results. If the run is set to fail on test failures, a
+// TestsFailedError is returned when any test failed.
+func (dri *defaultRunImplementation) collectTestReports(r *Run) error {
+	if len(r.opts.Tests.Reports) == 0 {
+		return nil
+	}
+	workdir := r.runner.Options().Workdir
+	reports, err := findReports(workdir, r.opts.Tests.Reports)
+	if err != nil {
+		return fmt.Errorf("searching for test reports: %w", err)
+	}
+
+	summary := &TestSummary{Failures: []string{}}
+	for _, report := range reports {
+		s, err := ParseTestReport(filepath.Join(workdir, report))
+		if err != nil {
+			return fmt.Errorf("parsing test report %s: %w", report, err)
+		}
+		summary.Add(s)
+	}
+	r.TestReports = reports
+	r.TestResults = summary
+
+	logrus.Infof(
+		"Found %d tests in %d reports: %d passed, %d failed, %d skipped",
+		summary.Total, len(reports), summary.Passed, summary.Failed, summary.Skipped,
+	)
+
+	if r.opts.Tests.FailOnFailure && summary.Failed > 0 {
+		return &TestsFailedError{Failed: summary.Failed, Failures: summary.Failures}
+	}
+	return nil
+}
+
+// findReports returns the files in the workdir matching the report glob
+// patterns, relative to it and sorted
+func findReports(workdir string, patterns []string) ([]string, error) {
+	reports := []string{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(workdir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("matching reports with %s: %w", pattern, err)
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(workdir, m)
+			if err != nil {
+				return nil, fmt.Errorf("getting report path relative to workdir: %w", err)
+			}
+			reports = append(reports, rel)
+		}
+	}
+	sort.Strings(reports)
+	return reports, nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/build/runners"
+	"github.com/stretchr/testify/require"
+)
+
+const testJUnitReport = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="server" tests="3">
+    <testcase classname="app" name="TestLogin"/>
+    <testcase classname="app" name="TestLogout"><failure message="expected 200">trace</failure></testcase>
+    <testcase classname="app" name="TestSAML"><skipped/></testcase>
+  </testsuite>
+  <testsuite name="store" tests="1">
+    <testcase classname="store" name="TestSave"><error message="panic"/></testcase>
+  </testsuite>
+</testsuites>
+`
+
+const testGoReport = `{"Action":"run","Package":"example.com/pkg","Test":"TestOne"}
+{"Action":"pass","Package":"example.com/pkg","Test":"TestOne","Elapsed":0.01}
+{"Action":"run","Package":"example.com/pkg","Test":"TestTwo"}
+{"Action":"skip","Package":"example.com/pkg","Test":"TestTwo","Elapsed":0}
+{"Action":"pass","Package":"example.com/pkg","Elapsed":0.02}
+`
+
+func TestParseTestReports(t *testing.T) {
+	s, err := ParseJUnitReport([]byte(testJUnitReport))
+	require.NoError(t, err)
+	require.Equal(t, 4, s.Total)
+	require.Equal(t, 1, s.Passed)
+	require.Equal(t, 2, s.Failed)
+	require.Equal(t, 1, s.Skipped)
+	require.Equal(t, []string{"app.TestLogout", "store.TestSave"}, s.Failures)
+
+	s, err = ParseGoTestReport([]byte(testGoReport))
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Total)
+	require.Equal(t, 1, s.Passed)
+	require.Equal(t, 0, s.Failed)
+	require.Equal(t, 1, s.Skipped)
+
+	_, err = ParseGoTestReport([]byte("not json"))
+	require.Error(t, err)
+}
+
+func TestCollectTestReports(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "reports"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "reports", "junit.xml"), []byte(testJUnitReport), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gotest.json"), []byte(testGoReport), os.FileMode(0o644)))
+
+	defaultOpts := *runners.DefaultOptions
+	defer func() { *runners.DefaultOptions = defaultOpts }()
+	runner := runners.NewMake()
+	runner.Options().Workdir = dir
+
+	r := &Run{
+		runner: runner,
+		opts: &RunOptions{
+			Tests: TestsConfig{Reports: []string{"reports/*.xml", "gotest.json"}},
+		},
+	}
+	ri := defaultRunImplementation{}
+	require.NoError(t, ri.collectTestReports(r))
+	require.Equal(t, []string{"gotest.json", filepath.Join("reports", "junit.xml")}, r.TestReports)
+	require.Equal(t, 6, r.TestResults.Total)
+	require.Equal(t, 2, r.TestResults.Passed)
+	require.Equal(t, 2, r.TestResults.Failed)
+	require.Equal(t, 2, r.TestResults.Skipped)
+
+	// Failing on test failures
+	r.opts.Tests.FailOnFailure = true
+	err := ri.collectTestReports(r)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrTestsFailed))
+	var testsErr *TestsFailedError
+	require.True(t, errors.As(err, &testsErr))
+	require.Equal(t, 2, testsErr.Failed)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		size      string
+		expected  ByteSize
+		shouldErr bool
+	}{
+		{"512", 512, false},
+		{"10MB", 10_000_000, false},
+		{"10 mb", 10_000_000, false},
+		{"1.5GiB", 1536 << 20, false},
+		{"2KiB", 2048, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"10 parsecs", 0, true},
+		{"-1MB", 0, true},
+	} {
+		size, err := ParseByteSize(tc.size)
+		if tc.shouldErr {
+			require.Error(t, err, tc.size)
+			continue
+		}
+		require.NoError(t, err, tc.size)
+		require.Equal(t, tc.expected, size, tc.size)
+	}
+	require.Equal(t, "1536MiB", ByteSize(1536<<20).String())
+	require.Equal(t, "1000B", ByteSize(1000).String())
+}
+
+func TestTypedFields(t *testing.T) {
+	limits, err := parseMaterialLimits([]byte("materials:\n  - uri: https://example.com/deps.tar.gz\n    timeout: 1h30m\n    maxSize: 500MB\n  - uri: https://example.com/docs.tar.gz\n"))
+	require.NoError(t, err)
+	require.Equal(t, MaterialLimits{
+		"https://example.com/deps.tar.gz": {Timeout: Duration(90 * time.Minute), MaxSize: ByteSize(500_000_000)},
+	}, limits)
+
+	for _, data := range []string{"- timeout: -5m\n", "- timeout: soon\n", "- maxSize: huge\n"} {
+		_, err := parseMaterialLimits([]byte("materials:\n  " + data))
+		require.Error(t, err, data)
+	}
+
+	// The cache ttl is checked like the typed durations
+	cache := CacheConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte("destination: s3://cache/\nttl: 24h\n"), &cache))
+	require.Equal(t, CacheConfig{Destination: "s3://cache/", TTL: 24 * time.Hour}, cache)
+	require.Error(t, yaml.Unmarshal([]byte("ttl: -24h\n"), &CacheConfig{}))
+	require.Error(t, yaml.Unmarshal([]byte("ttl: a day\n"), &CacheConfig{}))
+}
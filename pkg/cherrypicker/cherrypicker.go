@@ -2,14 +2,16 @@ package cherrypicker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/mattermost/cicd-sdk/pkg/git"
 	"github.com/mattermost/cicd-sdk/pkg/github"
-	"github.com/pkg/errors"
+	"github.com/mattermost/cicd-sdk/pkg/object"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/release-utils/util"
 )
@@ -23,8 +25,14 @@ const (
 
 Cherry pick of #%d on %s.
 
+%s
 /cc  @%s
 
+` + "```release-note\nNONE\n```\n"
+	commitsPRTitleTemplate = "Automated cherry pick of %s on %s"
+	commitsPRBodyTemplate  = `Automated cherry pick of %s on %s
+
+%s
 ` + "```release-note\nNONE\n```\n"
 )
 
@@ -56,8 +64,53 @@ type Options struct {
 	RepoPath  string // Local path to the repository
 	RepoOwner string // Org of the repo we are using
 	RepoName  string // Name of the repository
-	ForkOwner string
+	ForkOwner string // Owner of the fork where the feature branches are pushed. Defaults to RepoOwner
+	ForkName  string // Name of the fork repository. Defaults to RepoName
 	Remote    string
+
+	// GitHub Enterprise Server to run against. Uses github.com when empty
+	GitHubHost        string                    // Host serving the git repositories, eg github.example.com
+	GitHubAPIURL      string                    // URL of the REST API, eg https://github.example.com/api/v3/
+	GitHubUploadURL   string                    // URL of the uploads API. Defaults to the API host
+	GitHubCredentials github.CredentialProvider // API tokens, eg GitHub App installation tokens. Uses the package default when nil
+
+	// Fallbacks when pushing the feature branch to Remote fails
+	Credentials      github.CredentialProvider // Provider of a fresh token to retry the push
+	FallbackRemotes  []Remote                  // Remotes tried in order after the first push fails
+	PatchDestination string                    // Object URL prefix where the commits are uploaded as a patch if all pushes fail
+}
+
+// Remote is a git remote where feature branches can be pushed
+type Remote struct {
+	Name  string // Name of the remote in the local repository
+	Owner string // GitHub org or user owning the repository, the head of the pull requests
+}
+
+// PushError is returned when the feature branch could not be pushed to
+// any of the remotes. If a patch destination was configured, PatchURL
+// points to the uploaded patch with the cherry-picked commits.
+type PushError struct {
+	Branch   string   // Feature branch that failed to push
+	Remotes  []string // Remotes where the push was attempted
+	PatchURL string   // URL of the uploaded patch, empty if none was uploaded
+	Err      error    // Error of the push to the primary remote
+}
+
+func (e *PushError) Error() string {
+	msg := fmt.Sprintf("pushing %s to %s: %v", e.Branch, strings.Join(e.Remotes, ", "), e.Err)
+	if e.PatchURL != "" {
+		msg += fmt.Sprintf(" (patch saved to %s)", e.PatchURL)
+	}
+	return msg
+}
+
+// Is makes the error match ErrPushFailed
+func (e *PushError) Is(target error) bool {
+	return target == ErrPushFailed
+}
+
+func (e *PushError) Unwrap() error {
+	return e.Err
 }
 
 var defaultCherryPickerOpts = &Options{
@@ -76,23 +129,39 @@ type State struct {
 // Actual implementation of the CP interfaces
 type cherryPickerImplementation interface {
 	initialize(context.Context, *State, *Options) error
-	createBranch(*State, *Options, string, *github.PullRequest) (string, error)
+	initializeGitHub(*State, *Options) error
+	createBranch(*State, *Options, string, string) (string, error)
 	cherrypickCommits(*State, *Options, []string, string) error
 	cherrypickMergeCommit(*State, *Options, string, string, int) error
-	pushFeatureBranch(*State, *Options, string) error
+	pushFeatureBranch(*State, *Options, string, string) (string, error)
 	getPullRequest(context.Context, int, *github.Repository) (*github.PullRequest, error)
 	getMergeMode(context.Context, *github.PullRequest) (string, error)
-	cherryPickRebasedPR(context.Context, *State, *Options, *github.PullRequest, string) error
+	cherryPickRebasedPR(context.Context, *State, *Options, *github.PullRequest, string) ([]string, error)
 	createPullRequest(ctx context.Context, ghrepo *github.Repository, featureBranch, branch string,
-		originalPR *github.PullRequest) (*github.PullRequest, error)
+		originalPR *github.PullRequest, commits []pickedCommit) (*github.PullRequest, error)
+	deleteMergedBranches(ctx context.Context, state *State, opts *Options) ([]string, error)
+	getHeadCommits(context.Context, *State, *github.PullRequest) ([]string, error)
+	previewCommits(*State, string, *github.PullRequest, []string) (*Preview, error)
+	resolveCommits(context.Context, *State, string) ([]string, error)
+	createCommitsPullRequest(ctx context.Context, ghrepo *github.Repository, baseBranch, headBranch string,
+		commits []pickedCommit) (*github.PullRequest, error)
+	pickedCommits(state *State, baseBranch, featureBranch string, originals []string) ([]pickedCommit, error)
+}
+
+// pickedCommit maps a commit to the commit created by cherry-picking it
+type pickedCommit struct {
+	original string
+	picked   string
 }
 
 // Initialize checks the environment and populates the state
 func (impl *defaultCPImplementation) initialize(ctx context.Context, state *State, opts *Options) (err error) {
-	state.github = github.New()
+	if err := impl.initializeGitHub(state, opts); err != nil {
+		return err
+	}
 	state.git = git.New()
 
-	state.ghrepo = github.NewRepository(opts.RepoOwner, opts.RepoName)
+	state.ghrepo = state.github.NewRepository(opts.RepoOwner, opts.RepoName)
 
 	// TODO: Add a bit more checks to the current repo state
 
@@ -101,20 +170,21 @@ func (impl *defaultCPImplementation) initialize(ctx context.Context, state *Stat
 	if opts.RepoPath == "" {
 		tmpDir, err2 := os.MkdirTemp("", "git-repo-tmpclone-")
 		if err2 != nil {
-			return errors.Wrap(err, "while cloning repository")
+			return fmt.Errorf("while cloning repository: %w", err2)
 		}
 		opts.RepoPath = tmpDir
 		logrus.Infof("cloning %s/%s to %s", opts.RepoOwner, opts.RepoName, opts.RepoPath)
-		repo, err = state.git.CloneRepo(git.GitHubURL(opts.RepoOwner, opts.RepoName), tmpDir)
+		repo, err = state.git.CloneRepo(git.GitHubHostURL(opts.GitHubHost, opts.RepoOwner, opts.RepoName), tmpDir)
 		if err != nil {
-			return errors.Wrap(err, "cloning repository")
+			return fmt.Errorf("cloning repository: %w", err)
 		}
 		if opts.Remote == "" {
 			opts.Remote = "user-fork"
 		}
 
-		if err := repo.AddRemote(opts.Remote, git.GitHubURL(opts.ForkOwner, opts.RepoName)); err != nil {
-			return errors.Wrap(err, "adding user remote")
+		forkOwner, forkName := forkRepository(opts)
+		if err := repo.AddRemote(opts.Remote, git.GitHubHostURL(opts.GitHubHost, forkOwner, forkName)); err != nil {
+			return fmt.Errorf("adding user remote: %w", err)
 		}
 	} else {
 		// Open an existing repository
@@ -122,8 +192,8 @@ func (impl *defaultCPImplementation) initialize(ctx context.Context, state *Stat
 		repo, err = state.git.OpenRepo(opts.RepoPath)
 	}
 	if err != nil {
-		return errors.Wrapf(
-			err, "opening or cloning repo %s/%s", opts.RepoOwner, opts.RepoName,
+		return fmt.Errorf(
+			"opening or cloning repo %s/%s: %w", opts.RepoOwner, opts.RepoName, err,
 		)
 	}
 
@@ -140,6 +210,21 @@ func (impl *defaultCPImplementation) initialize(ctx context.Context, state *Stat
 	return nil
 }
 
+// initializeGitHub creates the GitHub client of the cherrypicker
+func (impl *defaultCPImplementation) initializeGitHub(state *State, opts *Options) (err error) {
+	// The server and credentials only apply to the client of this
+	// cherrypicker, others may run against another server
+	state.github, err = github.NewClient(&github.Options{
+		Credentials: opts.GitHubCredentials,
+		APIURL:      opts.GitHubAPIURL,
+		UploadURL:   opts.GitHubUploadURL,
+	})
+	if err != nil {
+		return fmt.Errorf("creating GitHub client: %w", err)
+	}
+	return nil
+}
+
 // CreateCherryPickPR creates a cherry-pick PR to the the given branch
 func (cp *CherryPicker) CreateCherryPickPR(prNumber int, branch string) error {
 	return cp.CreateCherryPickPRWithContext(context.Background(), prNumber, branch)
@@ -148,27 +233,29 @@ func (cp *CherryPicker) CreateCherryPickPR(prNumber int, branch string) error {
 // CreateCherryPickPR creates a cherry-pick PR to the the given branch
 func (cp *CherryPicker) CreateCherryPickPRWithContext(ctx context.Context, prNumber int, branch string) error {
 	if err := cp.impl.initialize(ctx, &cp.state, cp.options); err != nil {
-		return errors.Wrap(err, "verifying environment")
+		return fmt.Errorf("verifying environment: %w", err)
 	}
 
 	// Fetch the pull request
 	pr, err := cp.impl.getPullRequest(ctx, prNumber, cp.state.ghrepo)
 	if err != nil {
-		return errors.Wrapf(err, "getting pull request %d", prNumber)
+		return fmt.Errorf("getting pull request %d: %w", prNumber, err)
 	}
 
 	// Next step: Find out how the PR was merged
 	mergeMode, err := cp.impl.getMergeMode(ctx, pr)
 	if err != nil {
-		return errors.Wrapf(err, "getting merge mode for PR #%d", pr.Number)
+		return fmt.Errorf("getting merge mode for PR #%d: %w", pr.Number, err)
 	}
 
 	// Create the CP branch
-	featureBranch, err := cp.impl.createBranch(&cp.state, cp.options, branch, pr)
+	featureBranch, err := cp.impl.createBranch(&cp.state, cp.options, branch, fmt.Sprintf("%d", pr.Number))
 	if err != nil {
-		return errors.Wrap(err, "creating the feature branch")
+		return fmt.Errorf("creating the feature branch: %w", err)
 	}
 
+	// Original commits transplanted to the feature branch
+	originals := []string{pr.MergeCommitSHA}
 	switch mergeMode {
 	case github.MMSQUASH:
 		// The easiest case: PR was squashed. In this case we only need to CP
@@ -176,7 +263,7 @@ func (cp *CherryPicker) CreateCherryPickPRWithContext(ctx context.Context, prNum
 		if err := cp.impl.cherrypickCommits(
 			&cp.state, cp.options, []string{pr.MergeCommitSHA}, featureBranch,
 		); err != nil {
-			return errors.Wrap(err, "cherrypicking squashed commit")
+			return fmt.Errorf("cherrypicking squashed commit: %w", err)
 		}
 	case github.MMMERGE:
 		// Next, if the PR resulted in a merge commit, we only need to cherry-pick
@@ -184,37 +271,45 @@ func (cp *CherryPicker) CreateCherryPickPRWithContext(ctx context.Context, prNum
 		// to generate the diff from:
 		parent, err := pr.PatchTreeID(ctx)
 		if err != nil {
-			return errors.Wrap(err, "searching for parent patch tree")
+			return fmt.Errorf("searching for parent patch tree: %w", err)
 		}
 		if err := cp.impl.cherrypickMergeCommit(
 			&cp.state, cp.options, featureBranch, pr.MergeCommitSHA, parent,
 		); err != nil {
-			return errors.Wrap(err, "cherrypicking merge commit")
+			return fmt.Errorf("cherrypicking merge commit: %w", err)
 		}
 	case github.MMREBASE:
 		// Last case. We are dealing with a rebase. In this case we have to take the
 		// merge commit and go back in the git log to find the previous trees and
 		// CP the commits where they merged
-		if err := cp.impl.cherryPickRebasedPR(
+		originals, err = cp.impl.cherryPickRebasedPR(
 			ctx, &cp.state, cp.options, pr, featureBranch,
-		); err != nil {
-			return errors.Wrap(err, "cherrypicking rebased commit")
+		)
+		if err != nil {
+			return fmt.Errorf("cherrypicking rebased commit: %w", err)
 		}
 	}
 
+	// Record the new commits to list them in the pull request
+	picked, err := cp.impl.pickedCommits(&cp.state, branch, featureBranch, originals)
+	if err != nil {
+		return fmt.Errorf("reading cherry-picked commits: %w", err)
+	}
+
 	// Push the changes back to github
-	if err = cp.impl.pushFeatureBranch(&cp.state, cp.options, featureBranch); err != nil {
-		return errors.Wrap(err, "pushing branch to git remote")
+	headOwner, err := cp.impl.pushFeatureBranch(&cp.state, cp.options, branch, featureBranch)
+	if err != nil {
+		return fmt.Errorf("pushing branch to git remote: %w", err)
 	}
 
 	// Create the pull request
 	headBranch := featureBranch
-	if cp.options.ForkOwner != "" {
-		headBranch = cp.options.ForkOwner + ":" + featureBranch
+	if headOwner != "" {
+		headBranch = headOwner + ":" + featureBranch
 	}
-	pullrequest, err := cp.impl.createPullRequest(ctx, cp.state.ghrepo, branch, headBranch, pr)
+	pullrequest, err := cp.impl.createPullRequest(ctx, cp.state.ghrepo, branch, headBranch, pr, picked)
 	if err != nil {
-		return errors.Wrap(err, "creating pull request in github")
+		return fmt.Errorf("creating pull request in github: %w", err)
 	}
 
 	logrus.Info(fmt.Sprintf("Successfully created pull request #%d", pullrequest.Number))
@@ -222,20 +317,85 @@ func (cp *CherryPicker) CreateCherryPickPRWithContext(ctx context.Context, prNum
 	return nil
 }
 
+// CreateCherryPickPRFromCommits cherry-picks a commit or a range of commits
+// (eg 1a2b3c..4d5e6f) not associated with a pull request onto branch and
+// creates a pull request with them. Use it to backport hotfixes that were
+// pushed directly without a pull request. Merge commits in the range are
+// skipped.
+func (cp *CherryPicker) CreateCherryPickPRFromCommits(ctx context.Context, commits, branch string) error {
+	if err := cp.impl.initialize(ctx, &cp.state, cp.options); err != nil {
+		return fmt.Errorf("verifying environment: %w", err)
+	}
+
+	shas, err := cp.impl.resolveCommits(ctx, &cp.state, commits)
+	if err != nil {
+		return fmt.Errorf("resolving commits %s: %w", commits, err)
+	}
+
+	featureBranch, err := cp.impl.createBranch(&cp.state, cp.options, branch, shortSHA(shas[0]))
+	if err != nil {
+		return fmt.Errorf("creating the feature branch: %w", err)
+	}
+
+	if err := cp.impl.cherrypickCommits(&cp.state, cp.options, shas, featureBranch); err != nil {
+		return fmt.Errorf("cherrypicking %s: %w", commits, err)
+	}
+
+	picked, err := cp.impl.pickedCommits(&cp.state, branch, featureBranch, shas)
+	if err != nil {
+		return fmt.Errorf("reading cherry-picked commits: %w", err)
+	}
+
+	headOwner, err := cp.impl.pushFeatureBranch(&cp.state, cp.options, branch, featureBranch)
+	if err != nil {
+		return fmt.Errorf("pushing branch to git remote: %w", err)
+	}
+
+	headBranch := featureBranch
+	if headOwner != "" {
+		headBranch = headOwner + ":" + featureBranch
+	}
+	pullrequest, err := cp.impl.createCommitsPullRequest(ctx, cp.state.ghrepo, branch, headBranch, picked)
+	if err != nil {
+		return fmt.Errorf("creating pull request in github: %w", err)
+	}
+
+	logrus.Infof("Successfully created pull request #%d with %d commits", pullrequest.Number, len(shas))
+	return nil
+}
+
+// CleanupBranches deletes the cherry-pick feature branches from the fork
+// once their pull requests have been merged. Branches whose pull requests
+// are still open, were closed without merging or cannot be found are kept.
+// Returns the list of deleted branches.
+func (cp *CherryPicker) CleanupBranches(ctx context.Context) ([]string, error) {
+	// Cleaning up only needs the GitHub API, not the repository clone
+	if err := cp.impl.initializeGitHub(&cp.state, cp.options); err != nil {
+		return nil, fmt.Errorf("verifying environment: %w", err)
+	}
+	deleted, err := cp.impl.deleteMergedBranches(ctx, &cp.state, cp.options)
+	if err != nil {
+		return deleted, fmt.Errorf("cleaning up cherry-pick branches: %w", err)
+	}
+	logrus.Infof("Deleted %d merged cherry-pick branches", len(deleted))
+	return deleted, nil
+}
+
 type defaultCPImplementation struct{}
 
 // createBranch creates the new branch for the cherry pick and
-// switches to it. The new branch is created frp, sourceBranch.
+// switches to it. The new branch is created frp, sourceBranch. Its name
+// includes what is being cherry-picked, the PR number or a commit.
 func (impl *defaultCPImplementation) createBranch(
-	state *State, opts *Options, sourceBranch string, pr *github.PullRequest,
+	state *State, opts *Options, sourceBranch, id string,
 ) (branchName string, err error) {
 	// The new name of the branch, we append the date to make it unique
-	branchName = newBranchSlug + fmt.Sprintf("%d", pr.Number) + "-" + fmt.Sprintf("%d", (time.Now().Unix()))
+	branchName = newBranchSlug + id + "-" + fmt.Sprintf("%d", (time.Now().Unix()))
 	if err := state.repo.Checkout(sourceBranch); err != nil {
-		return "", errors.Wrapf(err, "checking out source branch")
+		return "", fmt.Errorf("checking out source branch: %w", err)
 	}
 	if err := state.repo.CreateBranch(branchName); err != nil {
-		return "", errors.Wrap(err, "creating cherry pick branch")
+		return "", fmt.Errorf("creating cherry pick branch: %w", err)
 	}
 
 	logrus.Info("created cherry-pick feature branch " + branchName)
@@ -249,14 +409,14 @@ func (impl *defaultCPImplementation) cherrypickCommits(
 ) (err error) {
 	logrus.Infof("Cherry picking %d commits to branch %s", len(commits), branch)
 	if err := state.repo.CherryPickCommits(commits, branch); err != nil {
-		return errors.Wrapf(err, "cherry picking %d commits to %s", len(commits), branch)
+		return fmt.Errorf("cherry picking %d commits to %s: %w", len(commits), branch, err)
 	}
-	conflicts, _, err := state.repo.HasMergeConflicts()
+	conflicts, files, err := state.repo.HasMergeConflicts()
 	if err != nil {
-		return errors.Wrap(err, "checking for conflicts")
+		return fmt.Errorf("checking for conflicts: %w", err)
 	}
 	if conflicts {
-		return errors.Wrap(err, "conflicts found while cherrypicking")
+		return &ConflictError{Files: files}
 	}
 	return nil
 }
@@ -265,31 +425,124 @@ func (impl *defaultCPImplementation) cherrypickMergeCommit(
 	state *State, opts *Options, branch, commit string, parent int,
 ) (err error) {
 	if err := state.repo.CherryPickMergeCommit(branch, commit, parent); err != nil {
-		return errors.Wrapf(err, "cherry-picking merge commit %s into %s", commit, branch)
+		return fmt.Errorf("cherry-picking merge commit %s into %s: %w", commit, branch, err)
 	}
-	conflicts, _, err := state.repo.HasMergeConflicts()
+	conflicts, files, err := state.repo.HasMergeConflicts()
 	if err != nil {
-		return errors.Wrap(err, "checking for conflicts")
+		return fmt.Errorf("checking for conflicts: %w", err)
 	}
 	if conflicts {
-		return errors.Wrap(err, "conflicts found while cherrypicking")
+		return &ConflictError{Files: files}
 	}
 	return nil
 }
 
-// pushFeatureBranch pushes thw new branch with the CPs to the remote
+// pushFeatureBranch pushes thw new branch with the CPs to the remote. If
+// the push fails, it is retried with the fallbacks defined in the options.
+// It returns the owner of the repository where the branch was pushed.
 func (impl *defaultCPImplementation) pushFeatureBranch(
-	state *State, opts *Options, featureBranch string,
-) error {
+	state *State, opts *Options, baseBranch, featureBranch string,
+) (string, error) {
 	remote := opts.Remote
 	if remote == "" {
 		remote = defaultRemote
 	}
-	if err := state.repo.PushBranch(featureBranch, remote); err != nil {
-		return errors.Wrap(err, "pushing CP feature branch")
+	err := state.repo.PushBranch(featureBranch, remote)
+	if err == nil {
+		logrus.Info(fmt.Sprintf("Successfully pushed %s to remote %s", featureBranch, remote))
+		return opts.ForkOwner, nil
 	}
-	logrus.Info(fmt.Sprintf("Successfully pushed %s to remote %s", featureBranch, remote))
-	return nil
+	logrus.Errorf("Unable to push %s to %s: %v", featureBranch, remote, err)
+	pushErr := &PushError{Branch: featureBranch, Remotes: []string{remote}, Err: err}
+
+	// Retry with a fresh token in case the credentials expired
+	if opts.Credentials != nil {
+		err := impl.pushWithCredentials(state, opts, featureBranch)
+		if err == nil {
+			return opts.ForkOwner, nil
+		}
+		logrus.Errorf("Unable to push %s with fresh credentials: %v", featureBranch, err)
+	}
+
+	for _, fallback := range opts.FallbackRemotes {
+		pushErr.Remotes = append(pushErr.Remotes, fallback.Name)
+		if err := state.repo.PushBranch(featureBranch, fallback.Name); err != nil {
+			logrus.Errorf("Unable to push %s to fallback remote %s: %v", featureBranch, fallback.Name, err)
+			continue
+		}
+		logrus.Infof("Pushed %s to fallback remote %s", featureBranch, fallback.Name)
+		return fallback.Owner, nil
+	}
+
+	// Save the work as a patch so it is not lost
+	if opts.PatchDestination != "" {
+		patchURL, err := impl.uploadPatch(state, opts, baseBranch, featureBranch)
+		if err != nil {
+			logrus.Errorf("Unable to upload patch of %s: %v", featureBranch, err)
+		} else {
+			pushErr.PatchURL = patchURL
+		}
+	}
+	return "", pushErr
+}
+
+// pushWithCredentials pushes the branch to the fork with a token from the
+// credential provider
+func (impl *defaultCPImplementation) pushWithCredentials(
+	state *State, opts *Options, featureBranch string,
+) error {
+	token, err := opts.Credentials.Token()
+	if err != nil {
+		return fmt.Errorf("getting token: %w", err)
+	}
+	owner, name := forkRepository(opts)
+	return state.repo.PushBranchWithToken(
+		featureBranch, git.GitHubHostHTTPSURL(opts.GitHubHost, owner, name), token,
+	)
+}
+
+// forkRepository returns the owner and name of the repository where the
+// feature branches are pushed
+func forkRepository(opts *Options) (owner, name string) {
+	owner, name = opts.ForkOwner, opts.ForkName
+	if owner == "" {
+		owner = opts.RepoOwner
+	}
+	if name == "" {
+		name = opts.RepoName
+	}
+	return owner, name
+}
+
+// uploadPatch writes the cherry-picked commits to a patch file and
+// copies it to the patch destination. Returns the URL of the patch.
+func (impl *defaultCPImplementation) uploadPatch(
+	state *State, opts *Options, baseBranch, featureBranch string,
+) (string, error) {
+	patch, err := state.repo.FormatPatch(baseBranch + ".." + featureBranch)
+	if err != nil {
+		return "", fmt.Errorf("generating patch: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "cherry-pick-patch-")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, featureBranch+".patch")
+	if err := os.WriteFile(path, []byte(patch), os.FileMode(0o644)); err != nil {
+		return "", fmt.Errorf("writing patch file: %w", err)
+	}
+
+	destURL := opts.PatchDestination
+	if !strings.HasSuffix(destURL, "/") {
+		destURL += "/"
+	}
+	destURL += featureBranch + ".patch"
+	if err := object.NewManager().Copy(object.FileURL(path), destURL); err != nil {
+		return "", fmt.Errorf("uploading patch: %w", err)
+	}
+	logrus.Infof("Uploaded cherry-pick patch to %s", destURL)
+	return destURL, nil
 }
 
 // getPullRequest gets the pull request we are cherrypicking
@@ -307,34 +560,157 @@ func (impl *defaultCPImplementation) getMergeMode(ctx context.Context, pr *githu
 // cherryPickRebasedPR
 func (impl *defaultCPImplementation) cherryPickRebasedPR(
 	ctx context.Context, state *State, opts *Options, pr *github.PullRequest, branch string,
-) error {
+) ([]string, error) {
 	// Get the lsit of commits rebased in the PR
 	rebaseCommits, err := pr.GetRebaseCommits(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "while getting commits in rebase from PR #%d", pr.Number)
+		return nil, fmt.Errorf("while getting commits in rebase from PR #%d: %w", pr.Number, err)
 	}
 	// To open a PR we need to make sure we have at least one commit
 	if len(rebaseCommits) == 0 {
-		return errors.Errorf("empty commit list while searching from commits from PR#%d", pr.Number)
+		return nil, fmt.Errorf("empty commit list while searching from commits from PR#%d", pr.Number)
 	}
 
 	if err := impl.cherrypickCommits(
 		state, opts, rebaseCommits, branch,
 	); err != nil {
-		return errors.Wrap(err, "cherrypicking rebased commit")
+		return nil, fmt.Errorf("cherrypicking rebased commit: %w", err)
 	}
-	return nil
+	return rebaseCommits, nil
 }
 
 // createPullRequest opens
 func (impl *defaultCPImplementation) createPullRequest(
 	ctx context.Context, ghrepo *github.Repository, baseBranch, headBranch string,
-	originalPR *github.PullRequest) (*github.PullRequest, error) {
+	originalPR *github.PullRequest, commits []pickedCommit) (*github.PullRequest, error) {
 	// Create the pull request in te repository
 	return ghrepo.CreatePullRequest(
 		ctx, baseBranch, headBranch,
 		fmt.Sprintf(prTitleTemplate, originalPR.Number, baseBranch),
-		fmt.Sprintf(prBodyTemplate, originalPR.Number, baseBranch, originalPR.Number, baseBranch, originalPR.Username),
+		fmt.Sprintf(
+			prBodyTemplate, originalPR.Number, baseBranch, originalPR.Number, baseBranch,
+			commitsTable(commits), originalPR.Username,
+		),
+		&github.NewPullRequestOptions{MaintainerCanModify: true},
+	)
+}
+
+// resolveCommits returns the commits to cherry-pick from a single commit
+// or a commit range, oldest first
+func (impl *defaultCPImplementation) resolveCommits(
+	ctx context.Context, state *State, commits string,
+) ([]string, error) {
+	if strings.Contains(commits, "..") {
+		return state.repo.ListCommits(commits)
+	}
+	sha, _, err := state.repo.ResolveRefContext(ctx, commits)
+	if err != nil {
+		return nil, fmt.Errorf("resolving commit %s: %w", commits, err)
+	}
+	return []string{sha}, nil
+}
+
+// createCommitsPullRequest opens the pull request of commits cherry-picked
+// without an original pull request
+func (impl *defaultCPImplementation) createCommitsPullRequest(
+	ctx context.Context, ghrepo *github.Repository, baseBranch, headBranch string, commits []pickedCommit,
+) (*github.PullRequest, error) {
+	what := shortSHA(commits[0].original)
+	if len(commits) > 1 {
+		what += ".." + shortSHA(commits[len(commits)-1].original)
+	}
+	return ghrepo.CreatePullRequest(
+		ctx, baseBranch, headBranch,
+		fmt.Sprintf(commitsPRTitleTemplate, what, baseBranch),
+		fmt.Sprintf(commitsPRBodyTemplate, what, baseBranch, commitsTable(commits)),
 		&github.NewPullRequestOptions{MaintainerCanModify: true},
 	)
 }
+
+// pickedCommits reads the commits created in the feature branch and pairs
+// them with the original commits they were cherry-picked from
+func (impl *defaultCPImplementation) pickedCommits(
+	state *State, baseBranch, featureBranch string, originals []string,
+) ([]pickedCommit, error) {
+	newCommits, err := state.repo.ListCommits(baseBranch + ".." + featureBranch)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits in feature branch: %w", err)
+	}
+	if len(newCommits) != len(originals) {
+		return nil, fmt.Errorf(
+			"cherry-picking %d commits created %d in %s", len(originals), len(newCommits), featureBranch,
+		)
+	}
+	picked := []pickedCommit{}
+	for i := range originals {
+		picked = append(picked, pickedCommit{original: originals[i], picked: newCommits[i]})
+	}
+	return picked, nil
+}
+
+// commitsTable returns a markdown table mapping the original commits to
+// the cherry-picked ones so reviewers can audit the backport
+func commitsTable(commits []pickedCommit) string {
+	table := "| Original commit | Cherry-picked commit |\n| --- | --- |\n"
+	for _, c := range commits {
+		table += fmt.Sprintf("| %s | %s |\n", c.original, c.picked)
+	}
+	return table
+}
+
+// shortSHA abbreviates a commit SHA for branch names and titles
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// deleteMergedBranches deletes the feature branches whose PRs have merged
+func (impl *defaultCPImplementation) deleteMergedBranches(
+	ctx context.Context, state *State, opts *Options,
+) (deleted []string, err error) {
+	forkOwner, forkName := forkRepository(opts)
+	fork := state.github.NewRepository(forkOwner, forkName)
+	upstream := state.github.NewRepository(opts.RepoOwner, opts.RepoName)
+
+	branches, err := fork.ListBranches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing branches in fork: %w", err)
+	}
+
+	deleted = []string{}
+	for _, branch := range branches {
+		if !strings.HasPrefix(branch, newBranchSlug) {
+			continue
+		}
+		prs, err := upstream.ListPullRequestsByHead(ctx, forkOwner+":"+branch)
+		if err != nil {
+			return deleted, fmt.Errorf("searching pull requests from %s: %w", branch, err)
+		}
+		if len(prs) == 0 {
+			logrus.Infof("No pull requests found from %s, not deleting", branch)
+			continue
+		}
+
+		// Safety check: all PRs from the branch must be merged
+		merged := true
+		for _, pr := range prs {
+			if !pr.IsMerged() {
+				logrus.Infof("PR #%d from %s is %s and not merged, keeping branch", pr.Number, branch, pr.State)
+				merged = false
+				break
+			}
+		}
+		if !merged {
+			continue
+		}
+
+		if err := fork.DeleteBranch(ctx, branch); err != nil {
+			return deleted, fmt.Errorf("deleting branch %s: %w", branch, err)
+		}
+		logrus.Infof("Deleted merged cherry-pick branch %s", branch)
+		deleted = append(deleted, branch)
+	}
+	return deleted, nil
+}
@@ -1,5 +1,109 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
 package cherrypicker
 
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/release-utils/command"
+)
+
+// newTestServer returns a GitHub API serving a pull request, recording
+// the tokens of the requests
+func newTestServer(t *testing.T, tokens *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*tokens = append(*tokens, r.Header.Get("Authorization"))
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"number": 1, "title": r.Host}))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInitializeGitHubClient(t *testing.T) {
+	repoPath := t.TempDir()
+	require.NoError(t, command.NewWithWorkDir(repoPath, "git", "init").RunSilentSuccess())
+
+	// Each cherrypicker calls its own server with its own credentials
+	serverTokens, enterpriseTokens := []string{}, []string{}
+	server, enterprise := newTestServer(t, &serverTokens), newTestServer(t, &enterpriseTokens)
+	pickers := []*CherryPicker{
+		NewWithOptions(&Options{
+			RepoPath: repoPath, RepoOwner: "mattermost", RepoName: "mattermost-server",
+			GitHubAPIURL: server.URL, GitHubCredentials: github.NewRoundRobinCredentials("server-token"),
+		}),
+		NewWithOptions(&Options{
+			RepoPath: repoPath, RepoOwner: "mattermost", RepoName: "mattermost-server",
+			GitHubAPIURL: enterprise.URL, GitHubCredentials: github.NewRoundRobinCredentials("enterprise-token"),
+		}),
+	}
+	for _, cp := range pickers {
+		require.NoError(t, cp.impl.initialize(context.Background(), &cp.state, cp.options))
+	}
+	for _, cp := range pickers {
+		_, err := cp.impl.getPullRequest(context.Background(), 1, cp.state.ghrepo)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"Bearer server-token"}, serverTokens)
+	require.Equal(t, []string{"Bearer enterprise-token"}, enterpriseTokens)
+
+	// Invalid servers fail the initialization
+	cp := NewWithOptions(&Options{RepoPath: repoPath, GitHubAPIURL: "github.example.com"})
+	require.Error(t, cp.impl.initialize(context.Background(), &cp.state, cp.options))
+}
+
+func TestCleanupBranches(t *testing.T) {
+	// The fork, named differently than upstream, has a merged, an open
+	// and an unrelated branch
+	tokens, deletedRefs := []string{}, []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/bot/server-fork/branches":
+			require.NoError(t, json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"name": "master"},
+				{"name": newBranchSlug + "1-1640995200"},
+				{"name": newBranchSlug + "2-1640995200"},
+			}))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/mattermost/mattermost-server/pulls":
+			pr := map[string]interface{}{"number": 10, "state": "open"}
+			if r.URL.Query().Get("head") == "bot:"+newBranchSlug+"1-1640995200" {
+				pr = map[string]interface{}{"number": 11, "state": "closed", "merged": true}
+			}
+			require.NoError(t, json.NewEncoder(w).Encode([]map[string]interface{}{pr}))
+		case r.Method == http.MethodDelete:
+			deletedRefs = append(deletedRefs, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Branches are cleaned up in the Enterprise server of the cherrypicker
+	cp := NewWithOptions(&Options{
+		RepoPath: t.TempDir(), RepoOwner: "mattermost", RepoName: "mattermost-server",
+		ForkOwner: "bot", ForkName: "server-fork",
+		GitHubAPIURL: server.URL, GitHubCredentials: github.NewRoundRobinCredentials("enterprise-token"),
+	})
+	deleted, err := cp.CleanupBranches(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{newBranchSlug + "1-1640995200"}, deleted)
+	require.Equal(t, []string{
+		"/api/v3/repos/bot/server-fork/git/refs/heads/" + newBranchSlug + "1-1640995200",
+	}, deletedRefs)
+	require.NotEmpty(t, tokens)
+	for _, token := range tokens {
+		require.Equal(t, "Bearer enterprise-token", token)
+	}
+}
+
 /*
 func TestGetPRMergeMode(t *testing.T) {
 	impl := defaultCPImplementation{}
@@ -0,0 +1,8 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package cherrypicker backports pull requests to release branches.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt.
+package cherrypicker
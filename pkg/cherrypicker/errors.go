@@ -0,0 +1,35 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package cherrypicker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors to classify cherry-pick failures with errors.Is. The
+// typed errors carry the details and can be extracted with errors.As.
+var (
+	ErrConflicts  = errors.New("conflicts found while cherrypicking")
+	ErrPushFailed = errors.New("pushing feature branch failed")
+)
+
+// ConflictError is returned when the cherry-picked commits do not apply
+// cleanly to the target branch
+type ConflictError struct {
+	Files []string // Files with merge conflicts
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Files) == 0 {
+		return ErrConflicts.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrConflicts, strings.Join(e.Files, ", "))
+}
+
+// Is makes the error match ErrConflicts
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflicts
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package cherrypicker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/sirupsen/logrus"
+)
+
+const previewBranchSlug = "cherry-pick-preview-of-"
+
+// Preview is the result of cherry-picking the commits of a pull request
+// onto a branch to check if they apply, without creating a pull request
+type Preview struct {
+	PullRequest int      // Number of the pull request
+	Branch      string   // Branch the commits were cherry-picked onto
+	Commits     []string // Commits of the pull request cherry-picked, in order
+	Feasible    bool     // True if all the commits applied cleanly
+	Commit      string   // Commit that failed to apply, empty if feasible
+	Conflicts   []string // Files with conflicts when Commit was cherry-picked
+	Error       string   // Error returned by git when Commit failed to apply
+}
+
+// PreviewCherryPick cherry-picks the head commits of a pull request onto
+// a scratch branch created from branch to predict if it can be backported
+// without conflicts. It is meant for pull requests not merged yet, eg to
+// label them as needing a manual backport before they merge.
+//
+// Conflicts are not auto-resolved with the merge strategy of the
+// repository. The scratch branch is deleted and the repository returned
+// to the branch it had checked out once the preview finishes.
+func (cp *CherryPicker) PreviewCherryPick(ctx context.Context, prNumber int, branch string) (*Preview, error) {
+	if err := cp.impl.initialize(ctx, &cp.state, cp.options); err != nil {
+		return nil, fmt.Errorf("verifying environment: %w", err)
+	}
+
+	pr, err := cp.impl.getPullRequest(ctx, prNumber, cp.state.ghrepo)
+	if err != nil {
+		return nil, fmt.Errorf("getting pull request %d: %w", prNumber, err)
+	}
+
+	commits, err := cp.impl.getHeadCommits(ctx, &cp.state, pr)
+	if err != nil {
+		return nil, fmt.Errorf("getting head commits of PR #%d: %w", pr.Number, err)
+	}
+
+	preview, err := cp.impl.previewCommits(&cp.state, branch, pr, commits)
+	if err != nil {
+		return nil, fmt.Errorf("previewing cherry-pick of PR #%d: %w", pr.Number, err)
+	}
+	if preview.Feasible {
+		logrus.Infof("PR #%d can be cherry-picked onto %s", pr.Number, branch)
+	} else {
+		logrus.Infof("PR #%d needs a manual cherry-pick onto %s, commit %s conflicts", pr.Number, branch, preview.Commit)
+	}
+	return preview, nil
+}
+
+// getHeadCommits fetches the head of a pull request from the remote and
+// returns its commits in order. Merge commits are skipped, their changes
+// come from the base branch.
+func (impl *defaultCPImplementation) getHeadCommits(
+	ctx context.Context, state *State, pr *github.PullRequest,
+) ([]string, error) {
+	if _, _, err := state.repo.ResolveRefContext(ctx, fmt.Sprintf("refs/pull/%d/head", pr.Number)); err != nil {
+		return nil, fmt.Errorf("fetching pull request head: %w", err)
+	}
+
+	prCommits, err := pr.GetCommits(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing pull request commits: %w", err)
+	}
+	commits := []string{}
+	for _, c := range prCommits {
+		if len(c.Parents) > 1 {
+			logrus.Infof("Skipping merge commit %s", c.SHA)
+			continue
+		}
+		commits = append(commits, c.SHA)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("PR #%d has no commits to cherry-pick", pr.Number)
+	}
+	return commits, nil
+}
+
+// previewCommits cherry-picks the commits one by one onto a scratch branch
+// until one fails to apply
+func (impl *defaultCPImplementation) previewCommits(
+	state *State, branch string, pr *github.PullRequest, commits []string,
+) (preview *Preview, err error) {
+	originalBranch, err := state.repo.CurrentBranch()
+	if err != nil {
+		logrus.Warnf("Unable to read current branch, will return to %s: %v", branch, err)
+		originalBranch = branch
+	}
+
+	scratchBranch := previewBranchSlug + fmt.Sprintf("%d", pr.Number) + "-" + fmt.Sprintf("%d", time.Now().Unix())
+	if err := state.repo.Checkout(branch); err != nil {
+		return nil, fmt.Errorf("checking out target branch: %w", err)
+	}
+	if err := state.repo.CreateBranch(scratchBranch); err != nil {
+		return nil, fmt.Errorf("creating scratch branch: %w", err)
+	}
+	defer func() {
+		if cerr := state.repo.Checkout(originalBranch); cerr != nil {
+			logrus.Errorf("Unable to return to %s: %v", originalBranch, cerr)
+			return
+		}
+		if derr := state.repo.DeleteBranch(scratchBranch); derr != nil {
+			logrus.Errorf("Unable to delete scratch branch: %v", derr)
+		}
+	}()
+
+	// Conflicts must surface, do not let the strategy resolve them
+	strategy := state.repo.Options().MergeStrategy
+	state.repo.Options().MergeStrategy = ""
+	defer func() { state.repo.Options().MergeStrategy = strategy }()
+
+	preview = &Preview{PullRequest: pr.Number, Branch: branch, Commits: commits, Feasible: true}
+	for _, commit := range commits {
+		cperr := state.repo.CherryPickCommits([]string{commit}, scratchBranch)
+		if cperr == nil {
+			continue
+		}
+		preview.Feasible = false
+		preview.Commit = commit
+		preview.Error = cperr.Error()
+		_, files, err := state.repo.HasMergeConflicts()
+		if err != nil {
+			return nil, fmt.Errorf("checking for conflicts: %w", err)
+		}
+		preview.Conflicts = files
+		if err := state.repo.AbortCherryPick(); err != nil {
+			logrus.Warn(err)
+		}
+		break
+	}
+	return preview, nil
+}
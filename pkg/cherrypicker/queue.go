@@ -0,0 +1,244 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package cherrypicker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrQueueFull is returned when submitting a cherry-pick to a queue that
+// already has the maximum number of requests waiting
+var ErrQueueFull = errors.New("cherry-pick queue is full")
+
+// QueueOptions controls how many cherry-picks a queue runs at once
+type QueueOptions struct {
+	MaxConcurrent int           // Cherry-picks running at the same time across all repositories
+	MaxQueued     int           // Requests waiting to run before Submit fails, zero means no limit
+	MinInterval   time.Duration // Minimum time between the start of two cherry-picks
+}
+
+var defaultQueueOptions = &QueueOptions{
+	MaxConcurrent: 2,
+	MaxQueued:     0,
+	MinInterval:   5 * time.Second,
+}
+
+// Request is a cherry-pick waiting in a queue
+type Request struct {
+	Options     *Options // Options of the cherry-picker, one per request as they get modified when cloning
+	PullRequest int      // Number of the pull request to cherry-pick
+	Branch      string   // Branch where the pull request will be cherry-picked
+}
+
+// QueueStats is a snapshot of the state of a queue, meant to be exported
+// to the metrics collection of the bot
+type QueueStats struct {
+	Queued    int            // Requests waiting to run
+	Running   int            // Cherry-picks running now
+	Completed int            // Cherry-picks that finished successfully
+	Failed    int            // Cherry-picks that failed or were cancelled
+	Repos     map[string]int // Requests queued or running, by owner/name of the repository
+}
+
+// Queue runs cherry-picks requested in bulk, eg when a batch of pull
+// requests gets labeled for backport during a release. Cherry-picks to the
+// same repository run one at a time and in order, the ones to different
+// repositories run in parallel up to the global limit so clones and calls
+// to the GitHub API do not stampede.
+type Queue struct {
+	options *QueueOptions
+	slots   chan struct{}
+	run     func(context.Context, *Request) error
+
+	mu        sync.Mutex
+	repos     map[string]*repoQueue
+	nextStart time.Time
+	stats     QueueStats
+}
+
+// repoQueue holds the pending requests of a repository
+type repoQueue struct {
+	pending []*queuedRequest
+	running bool
+}
+
+type queuedRequest struct {
+	ctx     context.Context
+	request *Request
+	result  chan error
+}
+
+// NewQueue returns a queue with the default options
+func NewQueue() *Queue {
+	return NewQueueWithOptions(defaultQueueOptions)
+}
+
+// NewQueueWithOptions returns a queue configured with opts
+func NewQueueWithOptions(opts *QueueOptions) *Queue {
+	// The queue keeps its own copy, the options of the caller are not modified
+	o := *opts
+	if o.MaxConcurrent < 1 {
+		o.MaxConcurrent = 1
+	}
+	return &Queue{
+		options: &o,
+		slots:   make(chan struct{}, o.MaxConcurrent),
+		run:     runRequest,
+		repos:   map[string]*repoQueue{},
+	}
+}
+
+// Submit adds a cherry-pick to the queue. It returns a channel that gets
+// the result of the cherry-pick once it runs. If ctx is cancelled while
+// the request is waiting, it is dropped and the channel gets the error.
+func (q *Queue) Submit(ctx context.Context, req *Request) (<-chan error, error) {
+	if req.Options == nil {
+		return nil, errors.New("cherry-pick request has no options")
+	}
+	key := req.Options.RepoOwner + "/" + req.Options.RepoName
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.options.MaxQueued > 0 && q.stats.Queued >= q.options.MaxQueued {
+		return nil, ErrQueueFull
+	}
+	qr := &queuedRequest{ctx: ctx, request: req, result: make(chan error, 1)}
+	rq, ok := q.repos[key]
+	if !ok {
+		rq = &repoQueue{pending: []*queuedRequest{}}
+		q.repos[key] = rq
+	}
+	rq.pending = append(rq.pending, qr)
+	q.stats.Queued++
+	logrus.Infof(
+		"Queued cherry-pick of PR #%d on %s to %s (%d waiting)",
+		req.PullRequest, req.Branch, key, q.stats.Queued,
+	)
+	if !rq.running {
+		rq.running = true
+		go q.drain(key, rq)
+	}
+	return qr.result, nil
+}
+
+// Stats returns the current state of the queue
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Repos = map[string]int{}
+	for key, rq := range q.repos {
+		stats.Repos[key] = len(rq.pending)
+		if rq.running {
+			stats.Repos[key]++
+		}
+	}
+	return stats
+}
+
+// drain runs the requests of a repository one after the other until
+// there are none left
+func (q *Queue) drain(key string, rq *repoQueue) {
+	for {
+		q.mu.Lock()
+		if len(rq.pending) == 0 {
+			rq.running = false
+			delete(q.repos, key)
+			q.mu.Unlock()
+			return
+		}
+		qr := rq.pending[0]
+		rq.pending = rq.pending[1:]
+		q.mu.Unlock()
+
+		err := q.execute(qr)
+		q.mu.Lock()
+		if err != nil {
+			q.stats.Failed++
+		} else {
+			q.stats.Completed++
+		}
+		q.mu.Unlock()
+		qr.result <- err
+	}
+}
+
+// execute waits for a free slot and the start interval, then runs the
+// cherry-pick
+func (q *Queue) execute(qr *queuedRequest) error {
+	if err := q.acquire(qr.ctx); err != nil {
+		q.mu.Lock()
+		q.stats.Queued--
+		q.mu.Unlock()
+		return fmt.Errorf("waiting in cherry-pick queue: %w", err)
+	}
+	defer func() { <-q.slots }()
+
+	q.mu.Lock()
+	q.stats.Queued--
+	q.stats.Running++
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.stats.Running--
+		q.mu.Unlock()
+	}()
+	return q.run(qr.ctx, qr.request)
+}
+
+// acquire takes a slot to run a cherry-pick once a slot is free and
+// MinInterval has passed since the last one started
+func (q *Queue) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := q.waitInterval(ctx); err != nil {
+		<-q.slots
+		return err
+	}
+	return nil
+}
+
+// waitInterval blocks until MinInterval has passed since the last
+// cherry-pick started. The start is only reserved once the wait is over,
+// so cancelled requests do not delay the ones behind them.
+func (q *Queue) waitInterval(ctx context.Context) error {
+	for {
+		q.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			q.mu.Unlock()
+			return err
+		}
+		now := time.Now()
+		if !q.nextStart.After(now) {
+			q.nextStart = now.Add(q.options.MinInterval)
+			q.mu.Unlock()
+			return nil
+		}
+		wait := q.nextStart.Sub(now)
+		q.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runRequest creates the cherry-pick pull request of a queued request
+func runRequest(ctx context.Context, req *Request) error {
+	return NewWithOptions(req.Options).CreateCherryPickPRWithContext(ctx, req.PullRequest, req.Branch)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package cherrypicker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewQueueWithOptions(&QueueOptions{MaxConcurrent: 2, MaxQueued: 5})
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxRunning, maxRepoRunning := 0, 0
+	order := []int{}
+	release := make(chan struct{})
+	q.run = func(ctx context.Context, req *Request) error {
+		key := req.Options.RepoOwner + "/" + req.Options.RepoName
+		mu.Lock()
+		running[key]++
+		total := 0
+		for _, n := range running {
+			total += n
+		}
+		if total > maxRunning {
+			maxRunning = total
+		}
+		if running[key] > maxRepoRunning {
+			maxRepoRunning = running[key]
+		}
+		if key == "mattermost/server" {
+			order = append(order, req.PullRequest)
+		}
+		mu.Unlock()
+
+		<-release
+		mu.Lock()
+		running[key]--
+		mu.Unlock()
+		if req.PullRequest == 3 {
+			return errors.New("conflicts found")
+		}
+		return nil
+	}
+
+	results := []<-chan error{}
+	for i, repo := range []string{"server", "server", "server", "webapp", "desktop"} {
+		res, err := q.Submit(context.Background(), &Request{
+			Options: &Options{RepoOwner: "mattermost", RepoName: repo}, PullRequest: i + 1, Branch: "release-7.0",
+		})
+		require.NoError(t, err)
+		results = append(results, res)
+	}
+
+	// The queue is full until a request starts running
+	_, err := q.Submit(context.Background(), &Request{Options: &Options{RepoOwner: "mattermost", RepoName: "server"}})
+	require.True(t, errors.Is(err, ErrQueueFull))
+
+	require.Eventually(t, func() bool { return q.Stats().Running == 2 }, 5*time.Second, 10*time.Millisecond)
+	stats := q.Stats()
+	require.Equal(t, 3, stats.Queued)
+	require.Equal(t, 3, stats.Repos["mattermost/server"])
+
+	close(release)
+	for i, res := range results {
+		err := <-res
+		if i == 2 {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	stats = q.Stats()
+	require.Equal(t, 0, stats.Queued)
+	require.Equal(t, 0, stats.Running)
+	require.Equal(t, 4, stats.Completed)
+	require.Equal(t, 1, stats.Failed)
+	require.Empty(t, stats.Repos)
+	require.Equal(t, 2, maxRunning)
+	require.Equal(t, 1, maxRepoRunning)
+	require.Equal(t, []int{1, 2, 3}, order)
+
+	// Requests are dropped when their context is cancelled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := q.Submit(ctx, &Request{Options: &Options{RepoOwner: "mattermost", RepoName: "server"}})
+	require.NoError(t, err)
+	require.True(t, errors.Is(<-res, context.Canceled))
+}
+
+func TestQueueInterval(t *testing.T) {
+	// The options of the caller are not modified
+	opts := &QueueOptions{MaxConcurrent: 0, MinInterval: 500 * time.Millisecond}
+	q := NewQueueWithOptions(opts)
+	require.Equal(t, 0, opts.MaxConcurrent)
+	require.Equal(t, 1, q.options.MaxConcurrent)
+
+	q = NewQueueWithOptions(&QueueOptions{MaxConcurrent: 3, MinInterval: 500 * time.Millisecond})
+	var mu sync.Mutex
+	started := map[int]time.Time{}
+	q.run = func(ctx context.Context, req *Request) error {
+		mu.Lock()
+		started[req.PullRequest] = time.Now()
+		mu.Unlock()
+		return nil
+	}
+	submit := func(ctx context.Context, pr int, repo string) <-chan error {
+		res, err := q.Submit(ctx, &Request{Options: &Options{RepoOwner: "mattermost", RepoName: repo}, PullRequest: pr})
+		require.NoError(t, err)
+		return res
+	}
+
+	// A request cancelled while waiting for the interval does not delay
+	// the next one
+	start := time.Now()
+	require.NoError(t, <-submit(context.Background(), 1, "server"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := submit(ctx, 2, "webapp")
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	require.True(t, errors.Is(<-cancelled, context.Canceled))
+	require.NoError(t, <-submit(context.Background(), 3, "desktop"))
+
+	require.NotContains(t, started, 2)
+	require.GreaterOrEqual(t, started[3].Sub(start), 400*time.Millisecond)
+	require.Less(t, started[3].Sub(start), 800*time.Millisecond)
+}
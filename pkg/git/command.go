@@ -0,0 +1,73 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrCommandFailed matches, with errors.Is, the errors of git commands
+// that exited with an error
+var ErrCommandFailed = errors.New("git command failed")
+
+// CommandError is returned when a git command fails. It wraps the error
+// returned by the command, use errors.As to read the output of git.
+type CommandError struct {
+	Args   []string // Arguments passed to git
+	Stderr string   // Error output of git
+	Err    error    // Error returned by the command
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("running git %s: %s: %v", strings.Join(e.Args, " "), e.Stderr, e.Err)
+}
+
+// Is makes the error match ErrCommandFailed
+func (e *CommandError) Is(target error) bool {
+	return target == ErrCommandFailed
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// runGit executes git with args in workdir and returns its output. The
+// command is killed if the context is done before it finishes, in that
+// case the returned error wraps the context error.
+func runGit(ctx context.Context, workdir string, args ...string) (string, error) {
+	return runGitEnv(ctx, workdir, nil, args...)
+}
+
+// runGitEnv works like runGit, adding env to the environment of git
+func runGitEnv(ctx context.Context, workdir string, env []string, args ...string) (string, error) {
+	stdout := &bytes.Buffer{}
+	if err := runGitOutput(ctx, workdir, env, stdout, args...); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// runGitOutput works like runGitEnv, writing the output of git to stdout
+// as it runs, eg for binary data
+func runGitOutput(ctx context.Context, workdir string, env []string, stdout io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, gitCommand, args...)
+	cmd.Dir = workdir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("running git %s: %w", strings.Join(args, " "), ctx.Err())
+		}
+		return &CommandError{Args: args, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package git wraps the git operations of the release tools: cloning,
+// branching, cherry picking and pushing.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt.
+package git
@@ -1,18 +1,21 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	gogit "github.com/go-git/go-git/v5"
-	"github.com/pkg/errors"
 	"sigs.k8s.io/release-utils/command"
 	"sigs.k8s.io/release-utils/util"
 )
 
 const (
-	gitCommand       = "git"
-	githubDefaultURL = "git@github.com:%s/%s"
+	gitCommand         = "git"
+	githubDefaultURL   = "git@github.com:%s/%s"
+	githubHTTPSURL     = "https://github.com/%s/%s.git"
+	githubHostURL      = "git@%s:%s/%s"
+	githubHostHTTPSURL = "https://%s/%s/%s.git"
 )
 
 type Git struct {
@@ -41,6 +44,7 @@ type gitImplementation interface {
 	openRepo(path string) (repo *Repository, err error)
 	cloneRepo(url, path string) (repo *Repository, err error)
 	lsRemote(args ...string) (string, error)
+	shallowClone(ctx context.Context, url, path, ref string) (repo *Repository, err error)
 }
 
 func (g *Git) OpenRepo(path string) (repo *Repository, err error) {
@@ -55,13 +59,26 @@ func (g *Git) LsRemote(args ...string) (string, error) {
 	return g.impl.lsRemote(args...)
 }
 
+// ShallowClone clones the repository fetching only the commit that ref
+// points to. The ref can be a branch, tag or commit SHA, if empty the
+// remote HEAD is cloned. The path may exist but must be empty.
+func (g *Git) ShallowClone(url, path, ref string) (repo *Repository, err error) {
+	return g.impl.shallowClone(context.Background(), url, path, ref)
+}
+
+// ShallowCloneContext works like ShallowClone but the git commands are
+// killed if the context is done before the clone finishes
+func (g *Git) ShallowCloneContext(ctx context.Context, url, path, ref string) (repo *Repository, err error) {
+	return g.impl.shallowClone(ctx, url, path, ref)
+}
+
 // OpenOrCloneRepo
 func (g *Git) OpenOrCloneRepo(url, path string) (repo *Repository, err error) {
 	// If we have no path, work in a temp directory
 	if path == "" {
 		path, err = os.MkdirTemp("", "repo-clone-")
 		if err != nil {
-			return nil, errors.Wrap(err, "creating temporary directory")
+			return nil, fmt.Errorf("creating temporary directory: %w", err)
 		}
 	}
 
@@ -77,16 +94,43 @@ func GitHubURL(repoOwner, repoName string) string {
 	return fmt.Sprintf(githubDefaultURL, repoOwner, repoName)
 }
 
+// GitHubHTTPSURL returns the HTTPS clone URL of a repository, used when
+// authenticating with a token instead of an SSH key
+// nolint:revive // Same as GitHubURL
+func GitHubHTTPSURL(repoOwner, repoName string) string {
+	return fmt.Sprintf(githubHTTPSURL, repoOwner, repoName)
+}
+
+// GitHubHostURL returns the SSH URL of a repository in a GitHub Enterprise
+// server running in host. An empty host means github.com.
+// nolint:revive // Same as GitHubURL
+func GitHubHostURL(host, repoOwner, repoName string) string {
+	if host == "" {
+		return GitHubURL(repoOwner, repoName)
+	}
+	return fmt.Sprintf(githubHostURL, host, repoOwner, repoName)
+}
+
+// GitHubHostHTTPSURL returns the HTTPS URL of a repository in a GitHub
+// Enterprise server running in host. An empty host means github.com.
+// nolint:revive // Same as GitHubURL
+func GitHubHostHTTPSURL(host, repoOwner, repoName string) string {
+	if host == "" {
+		return GitHubHTTPSURL(repoOwner, repoName)
+	}
+	return fmt.Sprintf(githubHostHTTPSURL, host, repoOwner, repoName)
+}
+
 type defaultGitImpl struct{}
 
 func (di *defaultGitImpl) openRepo(path string) (repo *Repository, err error) {
 	gogitrepo, err := gogit.PlainOpen(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "opening repository")
+		return nil, fmt.Errorf("opening repository: %w", err)
 	}
-	opts := defaultRepositoryOptions
+	opts := *defaultRepositoryOptions
 	opts.Path = path
-	repo = NewRepositoryWithOptions(opts)
+	repo = NewRepositoryWithOptions(&opts)
 	repo.SetClient(gogitrepo)
 	return repo, nil
 }
@@ -97,11 +141,11 @@ func (di *defaultGitImpl) cloneRepo(url, path string) (repo *Repository, err err
 		URL: url,
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "cloning repository")
+		return nil, fmt.Errorf("cloning repository: %w", err)
 	}
-	opts := defaultRepositoryOptions
+	opts := *defaultRepositoryOptions
 	opts.Path = path
-	repo = NewRepositoryWithOptions(opts)
+	repo = NewRepositoryWithOptions(&opts)
 	repo.SetClient(gogitrepo)
 	return repo, nil
 }
@@ -113,3 +157,25 @@ func (di *defaultGitImpl) lsRemote(args ...string) (string, error) {
 	).RunSuccessOutput()
 	return o.Output(), err
 }
+
+// shallowClone initializes a repository in path and fetches ref from url
+// with a depth of one. Unlike git clone, this works with commit SHAs.
+func (di *defaultGitImpl) shallowClone(ctx context.Context, url, path, ref string) (repo *Repository, err error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := os.MkdirAll(path, os.FileMode(0o755)); err != nil {
+		return nil, fmt.Errorf("creating clone directory: %w", err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", url},
+		{"fetch", "--quiet", "--depth", "1", "origin", ref},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		if _, err := runGit(ctx, path, args...); err != nil {
+			return nil, fmt.Errorf("running git %s: %w", args[0], err)
+		}
+	}
+	return di.openRepo(path)
+}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -59,3 +60,36 @@ func TestLSRemote(t *testing.T) {
 	require.Contains(t, res, "67d05f931c7415ed300009ffb9b6f410f71dd119")
 	require.Contains(t, res, "refs/tags/v6.2.1")
 }
+
+func TestShallowClone(t *testing.T) {
+	remoteDir := createTestRepo(t)
+	defer os.RemoveAll(remoteDir)
+	require.NoError(t, command.NewWithWorkDir(remoteDir, gitCommand, "tag", "v1.0.0").RunSuccess())
+	require.NoError(t, command.NewWithWorkDir(remoteDir, gitCommand, "commit", "--allow-empty", "-m", "Second Commit").RunSuccess())
+
+	impl := defaultGitImpl{}
+	for _, ref := range []string{"", "v1.0.0"} {
+		dir := filepath.Join(t.TempDir(), "clone")
+		_, err := impl.shallowClone(context.Background(), "file://"+remoteDir, dir, ref)
+		require.NoError(t, err)
+		o, err := command.NewWithWorkDir(dir, gitCommand, "log", "--pretty=%s").RunSuccessOutput()
+		require.NoError(t, err)
+		if ref == "" {
+			require.Equal(t, "Second Commit", o.OutputTrimNL())
+		} else {
+			require.Equal(t, "First Commit", o.OutputTrimNL())
+		}
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	dir := createTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	_, err := runGit(context.Background(), dir, "rev-parse", "--verify", "does-not-exist")
+	require.ErrorIs(t, err, ErrCommandFailed)
+	cmdErr := &CommandError{}
+	require.ErrorAs(t, err, &cmdErr)
+	require.Equal(t, []string{"rev-parse", "--verify", "does-not-exist"}, cmdErr.Args)
+	require.NotEmpty(t, cmdErr.Stderr)
+}
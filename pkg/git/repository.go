@@ -1,12 +1,14 @@
 package git
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"strings"
 
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/release-utils/command"
 )
@@ -54,7 +56,7 @@ func (repo *Repository) CreateBranch(branchName string) error {
 func (repo *Repository) HasMergeConflicts() (hasConflicts bool, files []string, err error) {
 	status, err := repo.impl.statusRaw(repo.opts)
 	if err != nil {
-		return false, nil, errors.Wrap(err, "getting repository status")
+		return false, nil, fmt.Errorf("getting repository status: %w", err)
 	}
 	return repo.impl.hasMergeConflicts(repo.opts, status)
 }
@@ -62,7 +64,13 @@ func (repo *Repository) HasMergeConflicts() (hasConflicts bool, files []string,
 // Checkout checks out the reference named `refName` in the repository. Currently
 // works with branches only
 func (repo *Repository) Checkout(refName string) error {
-	return repo.impl.checkout(repo.client, repo.opts, refName)
+	return repo.impl.checkout(context.Background(), repo.client, repo.opts, refName)
+}
+
+// CheckoutContext works like Checkout but git is killed if the context
+// is done before the checkout finishes
+func (repo *Repository) CheckoutContext(ctx context.Context, refName string) error {
+	return repo.impl.checkout(ctx, repo.client, repo.opts, refName)
 }
 
 // CherryPickCommits cherry picks the commits in `commits` to a target branch
@@ -74,10 +82,58 @@ func (repo *Repository) CherryPickMergeCommit(branch, commitSHA string, parent i
 	return repo.impl.cherryPickMergeCommit(repo.client, repo.opts, branch, commitSHA, parent)
 }
 
+// AbortCherryPick cancels a cherry-pick in progress, returning the
+// branch to where it was before it started
+func (repo *Repository) AbortCherryPick() error {
+	return repo.impl.abortCherryPick(repo.opts)
+}
+
+// CurrentBranch returns the name of the branch checked out in the repository
+func (repo *Repository) CurrentBranch() (string, error) {
+	return repo.impl.currentBranch(repo.opts)
+}
+
+// DeleteBranch deletes a local branch, even if it is not merged
+func (repo *Repository) DeleteBranch(branchName string) error {
+	return repo.impl.deleteBranch(repo.opts, branchName)
+}
+
 func (repo *Repository) PushBranch(branch, remote string) error {
 	return repo.impl.pushBranch(repo.client, repo.opts, branch, remote)
 }
 
+// PushBranchWithToken pushes a branch to a repository URL, authenticating
+// with token. The token is passed to git in its environment, it does not
+// show up in the command line or the logs.
+func (repo *Repository) PushBranchWithToken(branch, url, token string) error {
+	return repo.impl.pushBranchWithToken(repo.opts, branch, url, token)
+}
+
+// FormatPatch returns the commits in revRange (eg main..feature) as a
+// patch series in mbox format, to be applied with git am
+func (repo *Repository) FormatPatch(revRange string) (string, error) {
+	return repo.impl.formatPatch(repo.opts, revRange)
+}
+
+// ListCommits returns the SHAs of the commits in revRange (eg v1.0..main),
+// oldest first. Merge commits are not listed.
+func (repo *Repository) ListCommits(revRange string) ([]string, error) {
+	return repo.impl.listCommits(repo.opts, revRange)
+}
+
+// Archive writes a tar archive of the tree of rev to w. The archive only
+// depends on the commit, its files have the commit time as their date
+// and their modes are masked with 0022, whatever the git configuration.
+func (repo *Repository) Archive(rev string, w io.Writer) error {
+	return repo.ArchiveContext(context.Background(), rev, w)
+}
+
+// ArchiveContext works like Archive but git is killed if the context is
+// done before it finishes
+func (repo *Repository) ArchiveContext(ctx context.Context, rev string, w io.Writer) error {
+	return repo.impl.archive(ctx, repo.opts, rev, w)
+}
+
 func (repo *Repository) AddRemote(name, url string) error {
 	return repo.impl.addRemote(repo.client, repo.opts, name, url)
 }
@@ -86,16 +142,46 @@ func (repo *Repository) MainRemoteURL() (string, error) {
 	return repo.impl.getMainRemoteURL(repo.opts)
 }
 
+// ResolveRef returns the commit SHA a branch, tag, remote ref or commit
+// points to and the full name of the reference (empty for commits). If
+// the ref is not found locally, it is fetched from the default remote.
+func (repo *Repository) ResolveRef(ref string) (sha, fullRef string, err error) {
+	return repo.ResolveRefContext(context.Background(), ref)
+}
+
+// ResolveRefContext works like ResolveRef but the git commands are
+// killed if the context is done before they finish
+func (repo *Repository) ResolveRefContext(ctx context.Context, ref string) (sha, fullRef string, err error) {
+	sha, fullRef, err = repo.impl.resolveLocalRef(ctx, repo.opts, ref)
+	if err == nil {
+		return sha, fullRef, nil
+	}
+	if ctx.Err() != nil {
+		return "", "", err
+	}
+	logrus.Infof("Ref %s not found locally, fetching it from %s", ref, repo.opts.DefaultRemote)
+	return repo.impl.fetchRef(ctx, repo.opts, ref)
+}
+
 type repositoryImplementation interface {
 	statusRaw(*RepoOptions) (string, error)
 	createBranch(*gogit.Repository, *RepoOptions, string) error
 	hasMergeConflicts(opts *RepoOptions, rawStatus string) (bool, []string, error)
-	checkout(*gogit.Repository, *RepoOptions, string) error
+	checkout(context.Context, *gogit.Repository, *RepoOptions, string) error
 	cherryPickCommits(client *gogit.Repository, opts *RepoOptions, commits []string, branch string) error
 	pushBranch(client *gogit.Repository, opts *RepoOptions, branch, remote string) error
 	cherryPickMergeCommit(client *gogit.Repository, opts *RepoOptions, branch, commitSHA string, parent int) error
 	addRemote(client *gogit.Repository, opts *RepoOptions, name, url string) error
 	getMainRemoteURL(opts *RepoOptions) (string, error)
+	resolveLocalRef(ctx context.Context, opts *RepoOptions, ref string) (sha, fullRef string, err error)
+	fetchRef(ctx context.Context, opts *RepoOptions, ref string) (sha, fullRef string, err error)
+	abortCherryPick(opts *RepoOptions) error
+	currentBranch(opts *RepoOptions) (string, error)
+	deleteBranch(opts *RepoOptions, branchName string) error
+	pushBranchWithToken(opts *RepoOptions, branch, url, token string) error
+	formatPatch(opts *RepoOptions, revRange string) (string, error)
+	listCommits(opts *RepoOptions, revRange string) ([]string, error)
+	archive(ctx context.Context, opts *RepoOptions, rev string, w io.Writer) error
 }
 
 type defaultRepositoryImpl struct{}
@@ -108,7 +194,7 @@ func (di *defaultRepositoryImpl) statusRaw(opts *RepoOptions) (string, error) {
 		opts.Path, gitCommand, "status", "--porcelain",
 	).RunSuccessOutput()
 	if err != nil {
-		return "", errors.Wrap(err, "while trying to get repo status")
+		return "", fmt.Errorf("while trying to get repo status: %w", err)
 	}
 	return output.Output(), nil
 }
@@ -116,10 +202,10 @@ func (di *defaultRepositoryImpl) statusRaw(opts *RepoOptions) (string, error) {
 // createBranch creates a new Branch in the repo
 func (di *defaultRepositoryImpl) createBranch(client *gogit.Repository, opts *RepoOptions, branchName string) error {
 	logrus.Infof("Creating branch %s at %s", branchName, plumbing.NewBranchReferenceName(branchName))
-	return errors.Wrap(
-		command.NewWithWorkDir(opts.Path, gitCommand, "branch", branchName).RunSilentSuccess(),
-		"creating branch",
-	)
+	if err := command.NewWithWorkDir(opts.Path, gitCommand, "branch", branchName).RunSilentSuccess(); err != nil {
+		return fmt.Errorf("creating branch: %w", err)
+	}
+	return nil
 }
 
 // hasMergeConflicts interprets a rawStatus to determine if
@@ -130,13 +216,19 @@ func (di *defaultRepositoryImpl) hasMergeConflicts(opts *RepoOptions, status str
 	files = []string{}
 	hasConflicts = false
 	for _, line := range strings.Split(status, "\n") {
-		if strings.HasPrefix(line, "U") {
-			logrus.Infof("conflicts detected, cannot merge:\n%s", status)
+		if len(line) < 4 {
+			continue
+		}
+		// Unmerged paths are reported with these XY status codes
+		switch line[:2] {
+		case "DD", "AU", "UD", "UA", "DU", "AA", "UU":
 			hasConflicts = true
+			files = append(files, line[3:])
 		}
 	}
-
-	// TODO: Parse files with conflicts
+	if hasConflicts {
+		logrus.Infof("conflicts detected, cannot merge:\n%s", status)
+	}
 
 	return hasConflicts, files, nil
 }
@@ -145,8 +237,8 @@ func (di *defaultRepositoryImpl) cherryPickCommits(
 	client *gogit.Repository, opts *RepoOptions, commits []string, branch string,
 ) error {
 	// First, checkout to the target branch
-	if err := di.checkout(client, opts, branch); err != nil {
-		return errors.Wrapf(err, "checking out branch %s", branch)
+	if err := di.checkout(context.Background(), client, opts, branch); err != nil {
+		return fmt.Errorf("checking out branch %s: %w", branch, err)
 	}
 	logrus.Infof("Cherry picking %d commits to branch %s", len(commits), branch)
 
@@ -164,7 +256,7 @@ func (di *defaultRepositoryImpl) cherryPickCommits(
 	cmd := command.NewWithWorkDir(
 		opts.Path, gitCommand, append(cmdLine, commits...)...)
 	if err := cmd.RunSilentSuccess(); err != nil {
-		return errors.Wrap(err, "running git cherry-pick")
+		return fmt.Errorf("running git cherry-pick: %w", err)
 	}
 	return nil
 }
@@ -176,19 +268,23 @@ func (di *defaultRepositoryImpl) cherryPickMergeCommit(
 	cmd := command.NewWithWorkDir(
 		opts.Path, gitCommand, "cherry-pick", "-m", fmt.Sprintf("%d", parent), commitSHA,
 	)
-	return errors.Wrap(cmd.RunSuccess(), "running git cherry-pick")
+	if err := cmd.RunSuccess(); err != nil {
+		return fmt.Errorf("running git cherry-pick: %w", err)
+	}
+	return nil
 }
 
 // checkout calls the current worktree and checks out a reference. In the future this
 // function should work with commits, tags and other objects, but currently it only
 // works with
-func (di *defaultRepositoryImpl) checkout(client *gogit.Repository, opts *RepoOptions, refName string) error {
+func (di *defaultRepositoryImpl) checkout(
+	ctx context.Context, client *gogit.Repository, opts *RepoOptions, refName string,
+) error {
 	logrus.Infof("Checking out branch %s", refName)
 	// Switch to the sourceBranch, this ensures it exists and from there we branch
 	// TODO: Return to to go-git implementation
-	if err := command.NewWithWorkDir(
-		opts.Path, gitCommand, "checkout", refName).RunSilentSuccess(); err != nil {
-		return errors.Wrapf(err, "switching to source branch %s", refName)
+	if _, err := runGit(ctx, opts.Path, "checkout", refName); err != nil {
+		return fmt.Errorf("switching to source branch %s: %w", refName, err)
 	}
 	return nil
 }
@@ -206,7 +302,7 @@ func (di *defaultRepositoryImpl) pushBranch(
 	if err := command.NewWithWorkDir(
 		opts.Path, gitCommand, "push", remote, branch,
 	).RunSilentSuccess(); err != nil {
-		return errors.Wrapf(err, "pushing branch %s to remote %s", branch, remote)
+		return fmt.Errorf("pushing branch %s to remote %s: %w", branch, remote, err)
 	}
 	return nil
 }
@@ -220,7 +316,7 @@ func (di *defaultRepositoryImpl) addRemote(
 	if err := command.NewWithWorkDir(
 		opts.Path, gitCommand, "remote", "add", name, url,
 	).RunSilentSuccess(); err != nil {
-		return errors.Wrapf(err, "adding remote %s", name)
+		return fmt.Errorf("adding remote %s: %w", name, err)
 	}
 	return nil
 }
@@ -234,7 +330,7 @@ func (di *defaultRepositoryImpl) getMainRemoteURL(opts *RepoOptions) (string, er
 	}
 	if err != nil {
 		if !strings.Contains(err.Error(), "No such remote") {
-			return "", errors.Wrap(err, "reading remote URL from repository")
+			return "", fmt.Errorf("reading remote URL from repository: %w", err)
 		}
 	}
 
@@ -247,7 +343,132 @@ func (di *defaultRepositoryImpl) getRemoteName(opts *RepoOptions, remoteName str
 		opts.Path, gitCommand, "remote", "get-url", remoteName,
 	).RunSilentSuccessOutput()
 	if err != nil {
-		return "", errors.Wrapf(err, "querying for %s remote URL", remoteName)
+		return "", fmt.Errorf("querying for %s remote URL: %w", remoteName, err)
 	}
 	return url.OutputTrimNL(), nil
 }
+
+// resolveLocalRef resolves a ref to its commit using the objects
+// and references in the local repository
+func (di *defaultRepositoryImpl) resolveLocalRef(
+	ctx context.Context, opts *RepoOptions, ref string,
+) (sha, fullRef string, err error) {
+	sha, err = runGit(ctx, opts.Path, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", "", fmt.Errorf("resolving %s in local repository: %w", ref, err)
+	}
+
+	// Commit SHAs have no symbolic name, the output is empty for them
+	name, err := runGit(ctx, opts.Path, "rev-parse", "--symbolic-full-name", ref)
+	if err != nil {
+		return "", "", fmt.Errorf("reading full name of %s: %w", ref, err)
+	}
+	return sha, name, nil
+}
+
+// fetchRef fetches a ref from the default remote and resolves it. Branches
+// and tags are looked up in the remote first to record their full name.
+func (di *defaultRepositoryImpl) fetchRef(
+	ctx context.Context, opts *RepoOptions, ref string,
+) (sha, fullRef string, err error) {
+	output, err := runGit(ctx, opts.Path, "ls-remote", opts.DefaultRemote, ref)
+	if err != nil {
+		return "", "", fmt.Errorf("listing refs in remote %s: %w", opts.DefaultRemote, err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		// Prefer exact matches of the full name or a branch or tag name
+		if fields[1] == ref || fields[1] == "refs/heads/"+ref || fields[1] == "refs/tags/"+ref {
+			fullRef = fields[1]
+			break
+		}
+	}
+
+	fetchSpec := ref
+	if fullRef != "" {
+		fetchSpec = fullRef
+	}
+	if _, err := runGit(ctx, opts.Path, "fetch", "--quiet", opts.DefaultRemote, fetchSpec); err != nil {
+		return "", "", fmt.Errorf("fetching %s from %s: %w", ref, opts.DefaultRemote, err)
+	}
+
+	commit, err := runGit(ctx, opts.Path, "rev-parse", "--verify", "--quiet", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", "", fmt.Errorf("resolving fetched ref %s: %w", ref, err)
+	}
+	return commit, fullRef, nil
+}
+
+// abortCherryPick runs git cherry-pick --abort
+func (di *defaultRepositoryImpl) abortCherryPick(opts *RepoOptions) error {
+	if _, err := runGit(context.Background(), opts.Path, "cherry-pick", "--abort"); err != nil {
+		return fmt.Errorf("aborting cherry-pick: %w", err)
+	}
+	return nil
+}
+
+// currentBranch returns the short name of the branch HEAD points to
+func (di *defaultRepositoryImpl) currentBranch(opts *RepoOptions) (string, error) {
+	branch, err := runGit(context.Background(), opts.Path, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("reading current branch: %w", err)
+	}
+	return branch, nil
+}
+
+// deleteBranch force deletes a local branch
+func (di *defaultRepositoryImpl) deleteBranch(opts *RepoOptions, branchName string) error {
+	logrus.Infof("Deleting branch %s", branchName)
+	if _, err := runGit(context.Background(), opts.Path, "branch", "-D", branchName); err != nil {
+		return fmt.Errorf("deleting branch %s: %w", branchName, err)
+	}
+	return nil
+}
+
+// pushBranchWithToken pushes a branch to url sending the token in an
+// authorization header set through the git environment
+func (di *defaultRepositoryImpl) pushBranchWithToken(opts *RepoOptions, branch, url, token string) error {
+	logrus.Infof("Pushing branch %s to %s with token authentication", branch, url)
+	header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:"+token))
+	env := []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=" + header}
+	if _, err := runGitEnv(context.Background(), opts.Path, env, "push", url, branch); err != nil {
+		return fmt.Errorf("pushing branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// formatPatch runs git format-patch and returns the patches
+func (di *defaultRepositoryImpl) formatPatch(opts *RepoOptions, revRange string) (string, error) {
+	patch, err := runGit(context.Background(), opts.Path, "format-patch", "--stdout", revRange)
+	if err != nil {
+		return "", fmt.Errorf("formatting patch of %s: %w", revRange, err)
+	}
+	if patch == "" {
+		return "", fmt.Errorf("%s has no commits", revRange)
+	}
+	return patch + "\n", nil
+}
+
+// listCommits runs git rev-list to get the commits in a range
+func (di *defaultRepositoryImpl) listCommits(opts *RepoOptions, revRange string) ([]string, error) {
+	output, err := runGit(context.Background(), opts.Path, "rev-list", "--reverse", "--no-merges", revRange)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits in %s: %w", revRange, err)
+	}
+	if output == "" {
+		return nil, fmt.Errorf("%s has no commits", revRange)
+	}
+	return strings.Fields(output), nil
+}
+
+// archive runs git archive to write a tar of rev
+func (di *defaultRepositoryImpl) archive(ctx context.Context, opts *RepoOptions, rev string, w io.Writer) error {
+	// The file modes must not depend on the tar.umask of the git config
+	if err := runGitOutput(ctx, opts.Path, nil, w, "-c", "tar.umask=0022", "archive", "--format=tar", rev); err != nil {
+		return fmt.Errorf("archiving %s: %w", rev, err)
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	gogit "github.com/go-git/go-git/v5"
@@ -49,7 +52,7 @@ func TestCheckout(t *testing.T) {
 	require.Contains(t, output.Output(), "* main")
 	require.NotContains(t, output.Output(), "* test")
 
-	require.NoError(t, impl.checkout(gogitrepo, opts, "test"))
+	require.NoError(t, impl.checkout(context.Background(), gogitrepo, opts, "test"))
 
 	cmd2 := command.NewWithWorkDir(repoDir, "git", "branch")
 	output, err = cmd2.RunSuccessOutput()
@@ -58,3 +61,135 @@ func TestCheckout(t *testing.T) {
 	require.Contains(t, output.Output(), "* test")
 	require.NotContains(t, output.Output(), "* main")
 }
+
+func TestResolveRef(t *testing.T) {
+	remoteDir := createTestRepo(t)
+	defer os.RemoveAll(remoteDir)
+	require.NoError(t, command.NewWithWorkDir(remoteDir, gitCommand, "tag", "-a", "v1.0.0", "-m", "Release").RunSilentSuccess())
+	tagCommit, err := command.NewWithWorkDir(remoteDir, gitCommand, "rev-parse", "HEAD").RunSilentSuccessOutput()
+	require.NoError(t, err)
+
+	repoDir, err := os.MkdirTemp("", "test-repo-clone-")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	require.NoError(t, command.New(gitCommand, "clone", "--quiet", remoteDir, repoDir).RunSilentSuccess())
+
+	// Add a commit and branch to the remote after cloning
+	require.NoError(t, command.NewWithWorkDir(remoteDir, gitCommand, "checkout", "-b", "feature").RunSilentSuccess())
+	require.NoError(t, command.NewWithWorkDir(remoteDir, gitCommand, "commit", "--allow-empty", "-m", "Feature").RunSilentSuccess())
+	featureCommit, err := command.NewWithWorkDir(remoteDir, gitCommand, "rev-parse", "HEAD").RunSilentSuccessOutput()
+	require.NoError(t, err)
+
+	repo := NewRepositoryWithOptions(&RepoOptions{Path: repoDir, DefaultRemote: "origin"})
+
+	// Annotated tags resolve to the commit
+	sha, fullRef, err := repo.ResolveRef("v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, tagCommit.OutputTrimNL(), sha)
+	require.Equal(t, "refs/tags/v1.0.0", fullRef)
+
+	// Commits have no ref name
+	sha, fullRef, err = repo.ResolveRef(tagCommit.OutputTrimNL())
+	require.NoError(t, err)
+	require.Equal(t, tagCommit.OutputTrimNL(), sha)
+	require.Empty(t, fullRef)
+
+	// Branches not in the clone are fetched
+	sha, fullRef, err = repo.ResolveRef("feature")
+	require.NoError(t, err)
+	require.Equal(t, featureCommit.OutputTrimNL(), sha)
+	require.Equal(t, "refs/heads/feature", fullRef)
+
+	_, _, err = repo.ResolveRef("does-not-exist")
+	require.Error(t, err)
+
+	// Git is not run once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), -1)
+	defer cancel()
+	_, _, err = repo.ResolveRefContext(ctx, "feature")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestCherryPickConflicts(t *testing.T) {
+	repoDir := createTestRepo(t)
+	defer os.RemoveAll(repoDir)
+	git := func(args ...string) string {
+		output, err := command.NewWithWorkDir(repoDir, gitCommand, args...).RunSilentSuccessOutput()
+		require.NoError(t, err, args)
+		return output.OutputTrimNL()
+	}
+	commitFile := func(content string) string {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, "README.md"), []byte(content), os.FileMode(0o644)))
+		git("add", "README.md")
+		git("commit", "-m", content)
+		return git("rev-parse", "HEAD")
+	}
+	commitFile("base\n")
+	git("checkout", "-b", "feature")
+	featureCommit := commitFile("feature\n")
+	git("checkout", "main")
+	commitFile("main\n")
+
+	repo := NewRepositoryWithOptions(&RepoOptions{Path: repoDir, DefaultRemote: "origin"})
+	require.Error(t, repo.CherryPickCommits([]string{featureCommit}, "main"))
+	conflicts, files, err := repo.HasMergeConflicts()
+	require.NoError(t, err)
+	require.True(t, conflicts)
+	require.Equal(t, []string{"README.md"}, files)
+
+	// Aborting returns the branch to its previous state
+	require.NoError(t, repo.AbortCherryPick())
+	conflicts, _, err = repo.HasMergeConflicts()
+	require.NoError(t, err)
+	require.False(t, conflicts)
+	branch, err := repo.CurrentBranch()
+	require.NoError(t, err)
+	require.Equal(t, "main", branch)
+
+	require.NoError(t, repo.DeleteBranch("feature"))
+	require.NotContains(t, git("branch"), "feature")
+}
+
+func TestFormatPatchAndPush(t *testing.T) {
+	repoDir := createTestRepo(t)
+	defer os.RemoveAll(repoDir)
+	git := func(dir string, args ...string) string {
+		output, err := command.NewWithWorkDir(dir, gitCommand, args...).RunSilentSuccessOutput()
+		require.NoError(t, err, args)
+		return output.OutputTrimNL()
+	}
+	git(repoDir, "checkout", "-b", "feature")
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("feature\n"), os.FileMode(0o644)))
+	git(repoDir, "add", "README.md")
+	git(repoDir, "commit", "-m", "Add feature")
+
+	repo := NewRepositoryWithOptions(&RepoOptions{Path: repoDir, DefaultRemote: "origin"})
+	patch, err := repo.FormatPatch("main..feature")
+	require.NoError(t, err)
+	require.Contains(t, patch, "Subject: [PATCH] Add feature")
+	require.Contains(t, patch, "+feature\n")
+	_, err = repo.FormatPatch("feature..main")
+	require.Error(t, err)
+
+	commits, err := repo.ListCommits("main..feature")
+	require.NoError(t, err)
+	require.Equal(t, []string{git(repoDir, "rev-parse", "feature")}, commits)
+	_, err = repo.ListCommits("feature..main")
+	require.Error(t, err)
+
+	// The patch applies on the base branch
+	cloneDir := t.TempDir()
+	git(cloneDir, "clone", "--quiet", "--branch", "main", repoDir, ".")
+	git(cloneDir, "config", "user.email", "user@example.com")
+	git(cloneDir, "config", "user.name", "Example User")
+	require.NoError(t, os.WriteFile(filepath.Join(cloneDir, "feature.patch"), []byte(patch), os.FileMode(0o644)))
+	git(cloneDir, "am", "feature.patch")
+	require.FileExists(t, filepath.Join(cloneDir, "README.md"))
+
+	// Local remotes ignore the token
+	bareDir := t.TempDir()
+	git(bareDir, "init", "--bare", "--quiet")
+	require.NoError(t, repo.PushBranchWithToken("feature", bareDir, "s3cr3t"))
+	require.NotEmpty(t, git(bareDir, "rev-parse", "refs/heads/feature"))
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+// Annotation levels of check run annotations
+const (
+	AnnotationNotice  = "notice"
+	AnnotationWarning = "warning"
+	AnnotationFailure = "failure"
+)
+
+// Conclusions of a completed check run
+const (
+	CheckConclusionSuccess   = "success"
+	CheckConclusionFailure   = "failure"
+	CheckConclusionNeutral   = "neutral"
+	CheckConclusionCancelled = "cancelled"
+	CheckConclusionTimedOut  = "timed_out"
+)
+
+// Statuses of a check run not completed yet
+const (
+	CheckStatusQueued     = "queued"
+	CheckStatusInProgress = "in_progress"
+)
+
+// maxAnnotationsPerRequest is the number of annotations the checks API
+// accepts in each request. The rest have to be sent in updates.
+const maxAnnotationsPerRequest = 50
+
+// CheckRun abstracts a check run on a commit
+type CheckRun struct {
+	ID         int64
+	Name       string
+	HeadSHA    string
+	Status     string
+	Conclusion string
+	HTMLURL    string
+}
+
+// CheckAnnotation marks a line of a file with a message in the check run
+type CheckAnnotation struct {
+	Path      string // Path of the file, relative to the repository root
+	StartLine int
+	EndLine   int    // Defaults to StartLine
+	Level     string // notice, warning or failure
+	Title     string
+	Message   string
+}
+
+// CheckRunOptions are the optional fields when creating a check run
+type CheckRunOptions struct {
+	Title      string // Title of the check run output
+	Summary    string // Summary of the results, supports markdown
+	Text       string // Details of the check run, supports markdown
+	Conclusion string // When set, the check run is created as completed
+	Status     string // Status when there is no conclusion, queued or in_progress. GitHub defaults to queued
+	DetailsURL string // URL with the full details of the check (eg the build log)
+}
@@ -17,6 +17,25 @@ type Commit struct {
 	TreeSHA string       // SHA of the commmit's tree
 	Parents []string     // SHAs of parent commits
 	Files   []CommitFile // List of files modified in this commit
+
+	Verification CommitVerification // Signature verification data from GitHub
+}
+
+// CommitVerification captures the result of the signature verification
+// GitHub performs on the GPG or SSH signature of a commit
+type CommitVerification struct {
+	Verified  bool   // True if GitHub considers the signature valid
+	Reason    string // Verification reason as reported by the API (valid, unsigned, unknown_key, etc)
+	Signature string // The signature block of the commit, it identifies the key that signed it
+	Payload   string // The signed data, to check the signature against
+	Committer string // Login of the GitHub committer, "web-flow" for web commits. It is not the signer
+
+	// SignerKeyID identifies the key that made the signature, read from
+	// Signature: the long key ID of GPG keys (eg 4AEE18F83AFDEB23) or the
+	// SHA256 fingerprint of SSH keys. It is empty for unsigned commits and
+	// signatures it cannot read, like S/MIME ones. Whether the key belongs
+	// to a trusted signer has to be checked against the known keys.
+	SignerKeyID string
 }
 
 // CommitFile abstracts a file changed in a commit
@@ -30,6 +49,24 @@ func (c *Commit) ChangeTree() string {
 	return c.impl.ChangeTree(c.Files)
 }
 
+// IsVerified returns true if the commit signature was verified by GitHub
+func (c *Commit) IsVerified() bool {
+	return c.Verification.Verified
+}
+
+// RequireVerified returns an error if the commit signature is not verified.
+// Policy checks can use it to reject unsigned build points.
+func (c *Commit) RequireVerified() error {
+	if c.Verification.Verified {
+		return nil
+	}
+	reason := c.Verification.Reason
+	if reason == "" {
+		reason = "unsigned"
+	}
+	return &UnverifiedCommitError{SHA: c.SHA, Reason: reason}
+}
+
 type CommitImplementation interface {
 	ChangeTree([]CommitFile) string
 }
@@ -0,0 +1,127 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenExpiryMargin is the time before expiration when refreshable
+// tokens are renewed to avoid using them as they expire
+const tokenExpiryMargin = 5 * time.Minute
+
+// CredentialProvider supplies the tokens used to authenticate requests to
+// the GitHub API. Token is called before every request, so implementations
+// can rotate or refresh tokens transparently.
+type CredentialProvider interface {
+	Token() (string, error)
+}
+
+var (
+	defaultCredentials CredentialProvider
+	credentialsMutex   sync.RWMutex
+)
+
+// SetCredentialProvider sets the credential provider used by all GitHub
+// clients created afterwards. Setting it to nil reverts to reading the
+// token from the GITHUB_TOKEN environment variable.
+func SetCredentialProvider(provider CredentialProvider) {
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+	defaultCredentials = provider
+}
+
+// getCredentialProvider returns the configured credential provider
+func getCredentialProvider() CredentialProvider {
+	credentialsMutex.RLock()
+	defer credentialsMutex.RUnlock()
+	return defaultCredentials
+}
+
+// EnvCredentials reads the token from the environment on every request
+type EnvCredentials struct{}
+
+// Token returns the value of $GITHUB_TOKEN
+func (ec *EnvCredentials) Token() (string, error) {
+	return os.Getenv(githubTknVar), nil
+}
+
+// RoundRobinCredentials rotates requests among a list of tokens to
+// spread the API rate limits
+type RoundRobinCredentials struct {
+	tokens []string
+	next   int
+	mutex  sync.Mutex
+}
+
+// NewRoundRobinCredentials returns a provider that cycles the tokens
+func NewRoundRobinCredentials(tokens ...string) *RoundRobinCredentials {
+	return &RoundRobinCredentials{tokens: tokens}
+}
+
+// Token returns the next token in the list
+func (rr *RoundRobinCredentials) Token() (string, error) {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	if len(rr.tokens) == 0 {
+		return "", ErrNoTokens
+	}
+	tkn := rr.tokens[rr.next%len(rr.tokens)]
+	rr.next = (rr.next + 1) % len(rr.tokens)
+	return tkn, nil
+}
+
+// RefreshFunc fetches a new token and returns it with its expiration time
+type RefreshFunc func() (token string, expiry time.Time, err error)
+
+// RefreshingCredentials caches a token and renews it before it expires.
+// It is intended for short lived tokens such as GitHub App installation
+// tokens.
+type RefreshingCredentials struct {
+	refresh RefreshFunc
+	token   string
+	expiry  time.Time
+	mutex   sync.Mutex
+}
+
+// NewRefreshingCredentials returns a provider that calls refresh when needed
+func NewRefreshingCredentials(refresh RefreshFunc) *RefreshingCredentials {
+	return &RefreshingCredentials{refresh: refresh}
+}
+
+// Token returns the cached token, renewing it if it is about to expire
+func (rc *RefreshingCredentials) Token() (string, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.token != "" && time.Now().Add(tokenExpiryMargin).Before(rc.expiry) {
+		return rc.token, nil
+	}
+	tkn, expiry, err := rc.refresh()
+	if err != nil {
+		return "", fmt.Errorf("refreshing GitHub token: %w", err)
+	}
+	rc.token = tkn
+	rc.expiry = expiry
+	return rc.token, nil
+}
+
+// providerTokenSource adapts a CredentialProvider to an oauth2 token source.
+// The oauth2 transport queries the source before each request.
+type providerTokenSource struct {
+	provider CredentialProvider
+}
+
+// Token returns the next token from the provider
+func (ts *providerTokenSource) Token() (*oauth2.Token, error) {
+	tkn, err := ts.provider.Token()
+	if err != nil {
+		return nil, fmt.Errorf("getting GitHub token: %w", err)
+	}
+	return &oauth2.Token{AccessToken: tkn}, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundRobinCredentials(t *testing.T) {
+	rr := NewRoundRobinCredentials("token1", "token2", "token3")
+	for _, expected := range []string{"token1", "token2", "token3", "token1"} {
+		tkn, err := rr.Token()
+		require.NoError(t, err)
+		require.Equal(t, expected, tkn)
+	}
+
+	// An empty provider must fail
+	_, err := NewRoundRobinCredentials().Token()
+	require.Error(t, err)
+}
+
+func TestRefreshingCredentials(t *testing.T) {
+	calls := 0
+	expiry := time.Now().Add(time.Hour)
+	rc := NewRefreshingCredentials(func() (string, time.Time, error) {
+		calls++
+		return "installation-token", expiry, nil
+	})
+
+	// The token is cached while it is not about to expire
+	for i := 0; i < 3; i++ {
+		tkn, err := rc.Token()
+		require.NoError(t, err)
+		require.Equal(t, "installation-token", tkn)
+	}
+	require.Equal(t, 1, calls)
+
+	// Tokens close to expiration are refreshed
+	expiry = time.Now().Add(time.Minute)
+	rc.expiry = expiry
+	_, err := rc.Token()
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import "time"
+
+// Deployment states accepted by the deployment status API
+const (
+	DeploymentStateError      = "error"
+	DeploymentStateFailure    = "failure"
+	DeploymentStateInactive   = "inactive"
+	DeploymentStateInProgress = "in_progress"
+	DeploymentStateQueued     = "queued"
+	DeploymentStatePending    = "pending"
+	DeploymentStateSuccess    = "success"
+)
+
+// Deployment abstracts a GitHub deployment of a ref to an environment
+type Deployment struct {
+	ID          int64
+	Ref         string
+	SHA         string
+	Task        string
+	Environment string
+	Description string
+	Creator     string
+	CreatedAt   time.Time
+}
+
+// NewDeploymentOptions are the optional fields when creating a deployment
+type NewDeploymentOptions struct {
+	Task             string      // Name of the deployment task. GitHub defaults to "deploy"
+	Description      string      // Short description of the deployment
+	Payload          interface{} // Extra data to attach to the deployment (eg the attestation URL)
+	RequiredContexts []string    // Status contexts to check before deploying. nil skips the check
+	AutoMerge        bool        // Merge the default branch into ref before deploying
+	Production       bool        // Mark the environment as production
+	Transient        bool        // Mark the environment as transient
+}
+
+// DeploymentStatusOptions are the optional fields when setting a deployment status
+type DeploymentStatusOptions struct {
+	Description    string // Short description of the status
+	LogURL         string // URL to the deployment output
+	EnvironmentURL string // URL to access the deployed environment
+	AutoInactive   bool   // Mark previous deployments to the environment as inactive
+}
+
+// Environment is a deployment environment defined in a repository
+type Environment struct {
+	ID      int64
+	Name    string
+	HTMLURL string
+}
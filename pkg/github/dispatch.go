@@ -0,0 +1,23 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+// Event types sent by the SDK in repository_dispatch events
+const (
+	DispatchBuildSucceeded   = "build-succeeded"
+	DispatchReleasePublished = "release-published"
+)
+
+// BuildDispatchPayload is the client payload sent to downstream repositories
+// to notify them of a finished build. GitHub limits the payload to ten top
+// level properties, so keep additions inside Metadata.
+type BuildDispatchPayload struct {
+	Repository    string            `json:"repository"`               // owner/name of the built repository
+	Ref           string            `json:"ref,omitempty"`            // Branch or tag built
+	SHA           string            `json:"sha"`                      // Commit where the build ran
+	Version       string            `json:"version,omitempty"`        // Version string of the release
+	ArtifactsURL  string            `json:"artifacts_url,omitempty"`  // Location of the build artifacts
+	ProvenanceURL string            `json:"provenance_url,omitempty"` // Location of the provenance attestation
+	Metadata      map[string]string `json:"metadata,omitempty"`       // Any other data for the receiving workflow
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package github is the client of the GitHub API used by the bots and
+// release tools.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt. The types returned wrap the go-github ones,
+// which are not part of the stable API.
+package github
@@ -0,0 +1,69 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+var (
+	serverBaseURL   *url.URL
+	serverUploadURL *url.URL
+	serverMutex     sync.RWMutex
+)
+
+// SetServer points the GitHub clients created afterwards to a GitHub
+// Enterprise Server. apiURL is the URL of its REST API, the /api/v3/ path
+// is added if missing. When uploadURL is empty, the uploads API is looked
+// up in the same host. Setting apiURL to an empty string reverts to
+// github.com.
+func SetServer(apiURL, uploadURL string) error {
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	if apiURL == "" {
+		serverBaseURL, serverUploadURL = nil, nil
+		return nil
+	}
+	base, upload, err := serverURLs(apiURL, uploadURL)
+	if err != nil {
+		return err
+	}
+	serverBaseURL, serverUploadURL = base, upload
+	return nil
+}
+
+// serverURLs returns the URLs of the REST and uploads APIs of a GitHub
+// Enterprise Server
+func serverURLs(apiURL, uploadURL string) (base, upload *url.URL, err error) {
+	base, err = url.Parse(apiURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing GitHub API URL: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, nil, fmt.Errorf("GitHub API URL %s must be absolute", apiURL)
+	}
+	if uploadURL == "" {
+		uploadURL = base.Scheme + "://" + base.Host + "/"
+	}
+	client, err := gogithub.NewEnterpriseClient(apiURL, uploadURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuring GitHub Enterprise client: %w", err)
+	}
+	return client.BaseURL, client.UploadURL, nil
+}
+
+// setServerURLs makes client call the configured GitHub server, if any
+func setServerURLs(client *gogithub.Client) {
+	serverMutex.RLock()
+	defer serverMutex.RUnlock()
+	if serverBaseURL == nil {
+		return
+	}
+	base, upload := *serverBaseURL, *serverUploadURL
+	client.BaseURL, client.UploadURL = &base, &upload
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"context"
+	"testing"
+
+	gogithub "github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetServer(t *testing.T) {
+	defer func() { require.NoError(t, SetServer("", "")) }()
+
+	require.NoError(t, SetServer("https://github.example.com", ""))
+	client := (&githubAPIUser{}).GitHubClient()
+	require.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+	require.Equal(t, "https://github.example.com/api/uploads/", client.UploadURL.String())
+
+	require.NoError(t, SetServer("https://github.example.com/api/v3/", "https://uploads.example.com/api/uploads/"))
+	client = (&githubAPIUser{}).GitHubClient()
+	require.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+	require.Equal(t, "https://uploads.example.com/api/uploads/", client.UploadURL.String())
+
+	require.Error(t, SetServer("github.example.com", ""))
+
+	require.NoError(t, SetServer("", ""))
+	client = (&githubAPIUser{}).GitHubClient()
+	require.Equal(t, "https://api.github.com/", client.BaseURL.String())
+}
+
+func TestNewClientServer(t *testing.T) {
+	gh, err := NewClient(&Options{APIURL: "https://github.example.com"})
+	require.NoError(t, err)
+	client := gh.api.GitHubClient()
+	require.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+
+	// The server of a client does not change the package default
+	client = (&githubAPIUser{}).GitHubClient()
+	require.Equal(t, "https://api.github.com/", client.BaseURL.String())
+
+	// Repositories, pull requests and issues keep the settings of the client
+	repo := gh.NewRepository("mattermost", "cicd-sdk")
+	client = repo.impl.(*defaultRepoImplementation).GitHubClient()
+	require.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+	issue := gh.api.NewIssue(&gogithub.Issue{Number: gogithub.Int(1)})
+	client = issue.impl.(*defaultIssueImplementation).GitHubClient()
+	require.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+
+	// Invalid servers are rejected, or fail the API calls
+	_, err = NewClient(&Options{APIURL: "github.example.com"})
+	require.Error(t, err)
+	_, err = NewWithOptions(&Options{APIURL: "github.example.com"}).NewRepository("mattermost", "cicd-sdk").
+		GetPullRequest(context.Background(), 1)
+	require.Error(t, err)
+}
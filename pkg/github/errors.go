@@ -0,0 +1,32 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors to classify GitHub failures with errors.Is. The typed
+// errors carry the details and can be extracted with errors.As.
+var (
+	ErrUnverifiedCommit = errors.New("commit signature is not verified")
+	ErrNoTokens         = errors.New("no tokens defined in round robin credentials")
+)
+
+// UnverifiedCommitError is returned when GitHub did not verify the
+// signature of a commit
+type UnverifiedCommitError struct {
+	SHA    string // SHA of the commit
+	Reason string // Verification reason reported by the API
+}
+
+func (e *UnverifiedCommitError) Error() string {
+	return fmt.Sprintf("commit %s signature is not verified (reason: %s)", e.SHA, e.Reason)
+}
+
+// Is makes the error match ErrUnverifiedCommit
+func (e *UnverifiedCommitError) Is(target error) bool {
+	return target == ErrUnverifiedCommit
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import "time"
+
+// Event types recorded in issue and pull request timelines
+const (
+	EventLabeled         = "labeled"
+	EventUnlabeled       = "unlabeled"
+	EventMilestoned      = "milestoned"
+	EventDemilestoned    = "demilestoned"
+	EventCrossReferenced = "cross-referenced"
+	EventMerged          = "merged"
+	EventClosed          = "closed"
+	EventReopened        = "reopened"
+)
+
+// IssueEvent abstracts an entry in the event list or timeline of
+// an issue or pull request
+type IssueEvent struct {
+	ID        int64
+	Event     string    // Type of the event (labeled, milestoned, merged, etc)
+	Actor     string    // Login of the user that triggered the event
+	CreatedAt time.Time // Time when the event occurred
+	CommitID  string    // SHA of the commit referenced by the event, if any
+	Label     string    // Name of the label for labeled/unlabeled events
+	Milestone string    // Title of the milestone for (de)milestoned events
+
+	// Cross-referenced events record the issue or PR that mentioned this one
+	SourceRepo   string // owner/name of the referencing repository
+	SourceNumber int    // Number of the referencing issue or PR
+}
+
+// FilterEvents returns the events in list of type eventType
+func FilterEvents(list []*IssueEvent, eventType string) []*IssueEvent {
+	filtered := []*IssueEvent{}
+	for _, e := range list {
+		if e.Event == eventType {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// LastLabelEvent returns the last event where label was added to an
+// issue or pull request. If the label was never added, it returns nil.
+func LastLabelEvent(list []*IssueEvent, label string) *IssueEvent {
+	var last *IssueEvent
+	for _, e := range FilterEvents(list, EventLabeled) {
+		if e.Label != label {
+			continue
+		}
+		if last == nil || e.CreatedAt.After(last.CreatedAt) {
+			last = e
+		}
+	}
+	return last
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastLabelEvent(t *testing.T) {
+	now := time.Now()
+	events := []*IssueEvent{
+		{ID: 1, Event: EventLabeled, Actor: "user1", Label: "CherryPick/Approved", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: 2, Event: EventUnlabeled, Actor: "user2", Label: "CherryPick/Approved", CreatedAt: now.Add(-1 * time.Hour)},
+		{ID: 3, Event: EventLabeled, Actor: "user3", Label: "CherryPick/Approved", CreatedAt: now},
+		{ID: 4, Event: EventLabeled, Actor: "user4", Label: "Docs/Needed", CreatedAt: now.Add(time.Hour)},
+		{ID: 5, Event: EventMerged, Actor: "user5", CreatedAt: now.Add(2 * time.Hour)},
+	}
+
+	require.Len(t, FilterEvents(events, EventLabeled), 3)
+	require.Len(t, FilterEvents(events, EventMerged), 1)
+	require.Len(t, FilterEvents(events, EventCrossReferenced), 0)
+
+	e := LastLabelEvent(events, "CherryPick/Approved")
+	require.NotNil(t, e)
+	require.Equal(t, "user3", e.Actor)
+	require.Equal(t, int64(3), e.ID)
+
+	require.Nil(t, LastLabelEvent(events, "Nonexistent"))
+}
@@ -5,6 +5,7 @@ package github
 
 import (
 	"context"
+	"net/http"
 )
 
 const (
@@ -17,6 +18,7 @@ const (
 type GitHub struct {
 	impl    githubImplementation
 	options *Options
+	api     githubAPIUser // Settings of the objects created by the client
 }
 
 // New returns a new GitHub client
@@ -24,15 +26,56 @@ func New() *GitHub {
 	return NewWithOptions(&defaultOptions)
 }
 
+// NewWithOptions returns a GitHub client with options. An invalid server
+// URL makes its API calls fail, use NewClient to check it when creating
+// the client.
 func NewWithOptions(opts *Options) *GitHub {
+	api := githubAPIUser{
+		credentials: opts.Credentials,
+		transport:   opts.Transport,
+	}
+	if opts.APIURL != "" {
+		api.baseURL, api.uploadURL, api.serverErr = serverURLs(opts.APIURL, opts.UploadURL)
+	}
 	gh := &GitHub{
-		impl:    &defaultGithubImplementation{},
+		impl:    &defaultGithubImplementation{githubAPIUser: api.settings()},
 		options: opts,
+		api:     api,
 	}
 	return gh
 }
 
-type Options struct{}
+// NewClient returns a GitHub client with options, or an error if its
+// server URLs are not valid. Unlike SetServer, SetCredentialProvider and
+// SetTransport, the options only apply to this client and the
+// repositories and pull requests it returns.
+func NewClient(opts *Options) (*GitHub, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	gh := NewWithOptions(opts)
+	if gh.api.serverErr != nil {
+		return nil, gh.api.serverErr
+	}
+	return gh, nil
+}
+
+type Options struct {
+	Credentials CredentialProvider // Provider of API tokens. Uses the package default when nil
+	Transport   http.RoundTripper  // HTTP transport for API calls. Uses the package default when nil
+	APIURL      string             // REST API of a GitHub Enterprise Server. Uses the package server when empty
+	UploadURL   string             // Uploads API of the server. Defaults to the API host
+}
+
+// NewRepository returns a repository calling the API with the options of
+// the client
+func (gh *GitHub) NewRepository(owner, name string) *Repository {
+	return &Repository{
+		Owner: owner,
+		Name:  name,
+		impl:  &defaultRepoImplementation{githubAPIUser: gh.api.settings()},
+	}
+}
 
 var defaultOptions = Options{}
 
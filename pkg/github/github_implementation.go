@@ -5,9 +5,9 @@ package github
 
 import (
 	"context"
+	"fmt"
 
 	gogithub "github.com/google/go-github/v39/github"
-	"github.com/pkg/errors"
 )
 
 type defaultGithubImplementation struct {
@@ -19,7 +19,7 @@ func (di *defaultGithubImplementation) getPullRequestFromAPI(
 ) (*PullRequest, error) {
 	ghpr, _, err := di.GitHubClient().PullRequests.Get(ctx, owner, repo, number)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting PR from GitHub API")
+		return nil, fmt.Errorf("getting PR from GitHub API: %w", err)
 	}
 
 	pr := &PullRequest{
@@ -33,6 +33,7 @@ func (di *defaultGithubImplementation) getPullRequestFromAPI(
 		State:               ghpr.GetState(),
 		URL:                 ghpr.GetURL(),
 		CreatedAt:           ghpr.GetCreatedAt(),
+		MergedAt:            ghpr.GetMergedAt(),
 		Merged:              gogithub.Bool(ghpr.GetMerged()),
 		MergeCommitSHA:      ghpr.GetMergeCommitSHA(),
 		MaintainerCanModify: gogithub.Bool(ghpr.GetMaintainerCanModify()),
@@ -15,6 +15,7 @@ func getTestImplementation() *defaultGithubImplementation {
 }
 
 func TestGetPullRequestFromAPI(t *testing.T) {
+	useFixture(t, "pull-request")
 	// Getch a commit from GH and check the variable assignments
 	gh := getTestImplementation()
 	pr, err := gh.getPullRequestFromAPI(context.Background(), "mattermost", "mattermost-server", 1)
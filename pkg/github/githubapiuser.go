@@ -8,33 +8,112 @@ package github
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"sync"
 
 	gogithub "github.com/google/go-github/v39/github"
-
+	"github.com/mattermost/cicd-sdk/pkg/trace"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 )
 
 type githubAPIUser struct {
-	client *gogithub.Client
+	client      *gogithub.Client
+	credentials CredentialProvider // Overrides the package credential provider when set
+	transport   http.RoundTripper  // Overrides the package transport when set
+	baseURL     *url.URL           // Overrides the package server when set
+	uploadURL   *url.URL
+	serverErr   error // Invalid server URL, returned by all the API calls
+}
+
+// settings returns an API user with the same settings, without a client
+func (gau *githubAPIUser) settings() githubAPIUser {
+	return githubAPIUser{
+		credentials: gau.credentials,
+		transport:   gau.transport,
+		baseURL:     gau.baseURL,
+		uploadURL:   gau.uploadURL,
+		serverErr:   gau.serverErr,
+	}
+}
+
+// errorTransport fails all the requests with an error
+type errorTransport struct{ err error }
+
+func (et errorTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, et.err
 }
 
-// getGoGitHubClient returns a go-github client. If the environment
-// contains a GitHub token, the client will use it for authentication
+var (
+	defaultTransport http.RoundTripper
+	transportMutex   sync.RWMutex
+)
+
+// SetTransport sets the HTTP transport used by GitHub clients created
+// afterwards. It is mostly useful to replay recorded API responses in
+// tests. Setting it to nil reverts to the default HTTP transport.
+func SetTransport(transport http.RoundTripper) {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	defaultTransport = transport
+}
+
+// getTransport returns the configured transport
+func getTransport() http.RoundTripper {
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	if defaultTransport == nil {
+		return http.DefaultTransport
+	}
+	return defaultTransport
+}
+
+// getGoGitHubClient returns a go-github client. Requests are authenticated
+// with the tokens from the configured credential provider. If none is set,
+// the client will use the GitHub token from the environment, if defined.
+// The client calls the server of the options or the one set with
+// SetServer, github.com by default.
 func (gau *githubAPIUser) GitHubClient() *gogithub.Client {
 	if gau.client == nil {
-		httpClient := http.DefaultClient
-		tkn := os.Getenv(githubTknVar)
-		if tkn == "" {
-			logrus.Warn("Note: GitHub client will not be authenticated")
-		} else {
-			httpClient = oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(
-				&oauth2.Token{AccessToken: tkn},
-			))
+		transport := gau.transport
+		if transport == nil {
+			transport = getTransport()
+		}
+		if gau.serverErr != nil {
+			transport = errorTransport{gau.serverErr}
+		}
+		// Each API call is a span of the trace in its context
+		transport = &trace.Transport{Base: transport}
+		httpClient := &http.Client{Transport: transport}
+		provider := gau.credentials
+		if provider == nil {
+			provider = getCredentialProvider()
+		}
+		if provider == nil {
+			if os.Getenv(githubTknVar) == "" {
+				logrus.Warn("Note: GitHub client will not be authenticated")
+			} else {
+				provider = &EnvCredentials{}
+			}
+		}
+		if provider != nil {
+			httpClient = &http.Client{
+				Transport: &oauth2.Transport{
+					Source: &providerTokenSource{provider: provider},
+					Base:   transport,
+				},
+			}
 		}
 		gau.client = gogithub.NewClient(httpClient)
+		if gau.baseURL != nil {
+			base, upload := *gau.baseURL, *gau.uploadURL
+			gau.client.BaseURL, gau.client.UploadURL = &base, &upload
+		} else {
+			setServerURLs(gau.client)
+		}
 	}
 	return gau.client
 }
@@ -43,6 +122,20 @@ func (gau *githubAPIUser) NewCommit(rcommit *gogithub.RepositoryCommit) *Commit
 	c := NewCommit()
 	c.SHA = rcommit.GetSHA()
 	c.TreeSHA = rcommit.Commit.GetTree().GetSHA()
+	c.Verification = CommitVerification{
+		Verified:  rcommit.GetCommit().GetVerification().GetVerified(),
+		Reason:    rcommit.GetCommit().GetVerification().GetReason(),
+		Signature: rcommit.GetCommit().GetVerification().GetSignature(),
+		Payload:   rcommit.GetCommit().GetVerification().GetPayload(),
+		Committer: rcommit.GetCommitter().GetLogin(),
+	}
+	if c.Verification.Signature != "" {
+		keyID, err := signatureKeyID(c.Verification.Signature)
+		if err != nil {
+			logrus.Debugf("Unable to read the signing key of commit %s: %v", c.SHA, err)
+		}
+		c.Verification.SignerKeyID = keyID
+	}
 
 	// Circle the commit's parents and record the hashes
 	for _, parent := range rcommit.Parents {
@@ -62,7 +155,7 @@ func (gau *githubAPIUser) NewCommit(rcommit *gogithub.RepositoryCommit) *Commit
 // NewPullRequest builds a PullRequest object from a gogithub PR object
 func (gau *githubAPIUser) NewPullRequest(ghpr *gogithub.PullRequest) *PullRequest {
 	return &PullRequest{
-		impl:                &defaultPRImplementation{},
+		impl:                &defaultPRImplementation{githubAPIUser: gau.settings()},
 		RepoOwner:           ghpr.GetBase().GetRepo().GetOwner().GetLogin(),
 		RepoName:            ghpr.GetBase().GetRepo().GetName(),
 		Number:              ghpr.GetNumber(),
@@ -73,6 +166,7 @@ func (gau *githubAPIUser) NewPullRequest(ghpr *gogithub.PullRequest) *PullReques
 		State:               ghpr.GetState(),
 		URL:                 ghpr.GetURL(),
 		CreatedAt:           ghpr.GetCreatedAt(),
+		MergedAt:            ghpr.GetMergedAt(),
 		Merged:              gogithub.Bool(ghpr.GetMerged()),
 		MergeCommitSHA:      ghpr.GetMergeCommitSHA(),
 		MaintainerCanModify: gogithub.Bool(ghpr.GetMaintainerCanModify()),
@@ -83,7 +177,7 @@ func (gau *githubAPIUser) NewPullRequest(ghpr *gogithub.PullRequest) *PullReques
 
 func (gau *githubAPIUser) NewRepository(ghrepo *gogithub.Repository) *Repository {
 	return &Repository{
-		impl:  &defaultRepoImplementation{},
+		impl:  &defaultRepoImplementation{githubAPIUser: gau.settings()},
 		Owner: ghrepo.GetOwner().GetLogin(),
 		Name:  ghrepo.GetName(),
 	}
@@ -91,7 +185,7 @@ func (gau *githubAPIUser) NewRepository(ghrepo *gogithub.Repository) *Repository
 
 func (gau *githubAPIUser) NewIssue(ghissue *gogithub.Issue) *Issue {
 	return &Issue{
-		impl:      &defaultIssueImplementation{},
+		impl:      &defaultIssueImplementation{githubAPIUser: gau.settings()},
 		Title:     ghissue.GetTitle(),
 		Body:      ghissue.GetBody(),
 		RepoOwner: ghissue.GetRepository().GetOwner().GetLogin(),
@@ -101,3 +195,107 @@ func (gau *githubAPIUser) NewIssue(ghissue *gogithub.Issue) *Issue {
 		State:     ghissue.GetState(),
 	}
 }
+
+// NewDeployment builds a Deployment from a gogithub deployment
+func (gau *githubAPIUser) NewDeployment(ghdeployment *gogithub.Deployment) *Deployment {
+	return &Deployment{
+		ID:          ghdeployment.GetID(),
+		Ref:         ghdeployment.GetRef(),
+		SHA:         ghdeployment.GetSHA(),
+		Task:        ghdeployment.GetTask(),
+		Environment: ghdeployment.GetEnvironment(),
+		Description: ghdeployment.GetDescription(),
+		Creator:     ghdeployment.GetCreator().GetLogin(),
+		CreatedAt:   ghdeployment.GetCreatedAt().Time,
+	}
+}
+
+// NewCheckRun builds a CheckRun from a gogithub check run
+func (gau *githubAPIUser) NewCheckRun(ghcheck *gogithub.CheckRun) *CheckRun {
+	return &CheckRun{
+		ID:         ghcheck.GetID(),
+		Name:       ghcheck.GetName(),
+		HeadSHA:    ghcheck.GetHeadSHA(),
+		Status:     ghcheck.GetStatus(),
+		Conclusion: ghcheck.GetConclusion(),
+		HTMLURL:    ghcheck.GetHTMLURL(),
+	}
+}
+
+// NewIssueEvent builds an IssueEvent from a gogithub issue event
+func (gau *githubAPIUser) NewIssueEvent(ghevent *gogithub.IssueEvent) *IssueEvent {
+	return &IssueEvent{
+		ID:        ghevent.GetID(),
+		Event:     ghevent.GetEvent(),
+		Actor:     ghevent.GetActor().GetLogin(),
+		CreatedAt: ghevent.GetCreatedAt(),
+		CommitID:  ghevent.GetCommitID(),
+		Label:     ghevent.GetLabel().GetName(),
+		Milestone: ghevent.GetMilestone().GetTitle(),
+	}
+}
+
+// NewTimelineEvent builds an IssueEvent from a gogithub timeline entry
+func (gau *githubAPIUser) NewTimelineEvent(ghevent *gogithub.Timeline) *IssueEvent {
+	e := &IssueEvent{
+		ID:        ghevent.GetID(),
+		Event:     ghevent.GetEvent(),
+		Actor:     ghevent.GetActor().GetLogin(),
+		CreatedAt: ghevent.GetCreatedAt(),
+		CommitID:  ghevent.GetCommitID(),
+		Label:     ghevent.GetLabel().GetName(),
+		Milestone: ghevent.GetMilestone().GetTitle(),
+	}
+	if ghevent.GetSource() != nil {
+		e.SourceRepo = ghevent.GetSource().GetIssue().GetRepository().GetFullName()
+		e.SourceNumber = ghevent.GetSource().GetIssue().GetNumber()
+		if e.Actor == "" {
+			e.Actor = ghevent.GetSource().GetActor().GetLogin()
+		}
+	}
+	return e
+}
+
+// listIssueEvents fetches all pages of the event list of an issue or PR
+func (gau *githubAPIUser) listIssueEvents(
+	ctx context.Context, owner, repo string, number int,
+) ([]*IssueEvent, error) {
+	events := []*IssueEvent{}
+	opts := &gogithub.ListOptions{PerPage: 100}
+	for {
+		ghevents, resp, err := gau.GitHubClient().Issues.ListIssueEvents(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing events of #%d: %w", number, err)
+		}
+		for _, e := range ghevents {
+			events = append(events, gau.NewIssueEvent(e))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return events, nil
+}
+
+// listIssueTimeline fetches all pages of the timeline of an issue or PR
+func (gau *githubAPIUser) listIssueTimeline(
+	ctx context.Context, owner, repo string, number int,
+) ([]*IssueEvent, error) {
+	events := []*IssueEvent{}
+	opts := &gogithub.ListOptions{PerPage: 100}
+	for {
+		ghevents, resp, err := gau.GitHubClient().Issues.ListIssueTimeline(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing timeline of #%d: %w", number, err)
+		}
+		for _, e := range ghevents {
+			events = append(events, gau.NewTimelineEvent(e))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return events, nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCommitVerification(t *testing.T) {
+	gau := githubAPIUser{}
+
+	// A signed commit with a valid signature
+	c := gau.NewCommit(&gogithub.RepositoryCommit{
+		SHA: gogithub.String("e970302b4d2756c3e6133bde811c1cd25dd4936a"),
+		Commit: &gogithub.Commit{
+			Verification: &gogithub.SignatureVerification{
+				Verified:  gogithub.Bool(true),
+				Reason:    gogithub.String("valid"),
+				Signature: gogithub.String(testPGPSignature),
+				Payload:   gogithub.String("tree 9fa1d0b3f5b1a1cdfb1cfcb4b0a73e6a5d9a4c11"),
+			},
+		},
+		Committer: &gogithub.User{Login: gogithub.String("web-flow")},
+	})
+	require.True(t, c.IsVerified())
+	require.NoError(t, c.RequireVerified())
+	require.Equal(t, "valid", c.Verification.Reason)
+	require.Equal(t, "tree 9fa1d0b3f5b1a1cdfb1cfcb4b0a73e6a5d9a4c11", c.Verification.Payload)
+	require.Equal(t, "web-flow", c.Verification.Committer)
+	require.Equal(t, "0A9D8A495D81B1BC", c.Verification.SignerKeyID)
+
+	// An unsigned commit must fail the check
+	c = gau.NewCommit(&gogithub.RepositoryCommit{
+		SHA: gogithub.String("69d69d92c2ac690c8de19365a46c9b4cb6ff3bf6"),
+		Commit: &gogithub.Commit{
+			Verification: &gogithub.SignatureVerification{
+				Verified: gogithub.Bool(false),
+				Reason:   gogithub.String("unsigned"),
+			},
+		},
+	})
+	require.False(t, c.IsVerified())
+	err := c.RequireVerified()
+	require.ErrorIs(t, err, ErrUnverifiedCommit)
+	unverified := &UnverifiedCommitError{}
+	require.ErrorAs(t, err, &unverified)
+	require.Equal(t, "unsigned", unverified.Reason)
+}
+
+func TestNewDeployment(t *testing.T) {
+	gau := githubAPIUser{}
+	d := gau.NewDeployment(&gogithub.Deployment{
+		ID:          gogithub.Int64(1234),
+		Ref:         gogithub.String("v6.2.1"),
+		SHA:         gogithub.String("67d05f931c7415ed300009ffb9b6f410f71dd119"),
+		Task:        gogithub.String("deploy"),
+		Environment: gogithub.String("staging"),
+		Creator:     &gogithub.User{Login: gogithub.String("mattermod")},
+	})
+	require.Equal(t, int64(1234), d.ID)
+	require.Equal(t, "v6.2.1", d.Ref)
+	require.Equal(t, "67d05f931c7415ed300009ffb9b6f410f71dd119", d.SHA)
+	require.Equal(t, "staging", d.Environment)
+	require.Equal(t, "mattermod", d.Creator)
+}
+
+func TestNewPullRequestMerged(t *testing.T) {
+	gau := githubAPIUser{}
+
+	// Listed pull requests don't have the merged flag, only the merge time
+	mergedAt := time.Now()
+	pr := gau.NewPullRequest(&gogithub.PullRequest{
+		Number:   gogithub.Int(18746),
+		State:    gogithub.String("closed"),
+		MergedAt: &mergedAt,
+	})
+	require.True(t, pr.IsMerged())
+
+	pr = gau.NewPullRequest(&gogithub.PullRequest{
+		Number: gogithub.Int(18759),
+		State:  gogithub.String("closed"),
+	})
+	require.False(t, pr.IsMerged())
+}
@@ -3,6 +3,11 @@
 
 package github
 
+import (
+	"context"
+	"fmt"
+)
+
 type Issue struct {
 	impl      IssueImplementation
 	Title     string
@@ -15,4 +20,26 @@ type Issue struct {
 	Labels    []string
 }
 
-type IssueImplementation interface{}
+type IssueImplementation interface {
+	getEvents(ctx context.Context, issue *Issue) ([]*IssueEvent, error)
+	getTimeline(ctx context.Context, issue *Issue) ([]*IssueEvent, error)
+}
+
+// GetEvents returns the list of events recorded in the issue
+func (issue *Issue) GetEvents(ctx context.Context) ([]*IssueEvent, error) {
+	events, err := issue.impl.getEvents(ctx, issue)
+	if err != nil {
+		return nil, fmt.Errorf("reading events from issue #%d: %w", issue.Number, err)
+	}
+	return events, nil
+}
+
+// GetTimeline returns the issue timeline. In addition to the issue events,
+// the timeline includes cross references from other issues and PRs.
+func (issue *Issue) GetTimeline(ctx context.Context) ([]*IssueEvent, error) {
+	events, err := issue.impl.getTimeline(ctx, issue)
+	if err != nil {
+		return nil, fmt.Errorf("reading timeline from issue #%d: %w", issue.Number, err)
+	}
+	return events, nil
+}
@@ -3,6 +3,18 @@
 
 package github
 
+import "context"
+
 type defaultIssueImplementation struct {
 	githubAPIUser
 }
+
+// getEvents fetches the issue events from the GitHub API
+func (impl *defaultIssueImplementation) getEvents(ctx context.Context, issue *Issue) ([]*IssueEvent, error) {
+	return impl.githubAPIUser.listIssueEvents(ctx, issue.RepoOwner, issue.RepoName, issue.Number)
+}
+
+// getTimeline fetches the issue timeline from the GitHub API
+func (impl *defaultIssueImplementation) getTimeline(ctx context.Context, issue *Issue) ([]*IssueEvent, error) {
+	return impl.githubAPIUser.listIssueTimeline(ctx, issue.RepoOwner, issue.RepoName, issue.Number)
+}
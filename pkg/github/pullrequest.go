@@ -5,9 +5,10 @@ package github
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,6 +25,7 @@ type PullRequest struct {
 	MilestoneNumber     *int64
 	MilestoneTitle      *string
 	CreatedAt           time.Time
+	MergedAt            time.Time
 	RepoOwner           string
 	RepoName            string
 	FullName            string
@@ -47,6 +49,15 @@ func NewPullRequest() *PullRequest {
 	}
 }
 
+// IsMerged returns true if the pull request was merged. The merged flag is
+// not returned when listing pull requests, so we check the merge time too.
+func (pr *PullRequest) IsMerged() bool {
+	if pr.Merged != nil && *pr.Merged {
+		return true
+	}
+	return !pr.MergedAt.IsZero()
+}
+
 // GetRepository returns the Repository object representing the
 // repo where the PR was filed
 func (pr *PullRequest) GetRepository(ctx context.Context) *Repository {
@@ -61,7 +72,7 @@ func (pr *PullRequest) GetMergeMode(ctx context.Context) (mode string, err error
 	// Get the commits merged by the pull request
 	commits, err := pr.impl.getRebaseCommits(ctx, pr)
 	if err != nil {
-		return "", errors.Wrapf(err, "getting commits from pull request #%d", pr.Number)
+		return "", fmt.Errorf("getting commits from pull request #%d: %w", pr.Number, err)
 	}
 	return pr.impl.getMergeMode(ctx, pr, commits)
 }
@@ -71,7 +82,7 @@ func (pr *PullRequest) GetMergeMode(ctx context.Context) (mode string, err error
 func (pr *PullRequest) GetCommits(ctx context.Context) ([]*Commit, error) {
 	commits, err := pr.impl.getCommits(ctx, pr)
 	if err != nil {
-		return nil, errors.Wrapf(err, "reading commits from PR #%d", pr.Number)
+		return nil, fmt.Errorf("reading commits from PR #%d: %w", pr.Number, err)
 	}
 	return commits, nil
 }
@@ -86,12 +97,12 @@ func (pr *PullRequest) GetRebaseCommits(ctx context.Context) (commitSHAs []strin
 	// First, the merge_commit_sha commit:
 	branchCommit, err := pr.GetRepository(ctx).GetCommit(ctx, pr.MergeCommitSHA)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting branch commit")
+		return nil, fmt.Errorf("getting branch commit: %w", err)
 	}
 
 	prCommits, err := pr.impl.getCommits(ctx, pr)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting commits from PR")
+		return nil, fmt.Errorf("getting commits from PR: %w", err)
 	}
 
 	commitSHAs = []string{}
@@ -102,7 +113,7 @@ func (pr *PullRequest) GetRebaseCommits(ctx context.Context) (commitSHAs []strin
 		prTreeSHA := prCommits[i-1].ChangeTree()
 		branchTreeSha := branchCommit.ChangeTree()
 		if prTreeSHA != branchTreeSha {
-			return nil, errors.Errorf(
+			return nil, fmt.Errorf(
 				"Mismatch in PR and branch hashes in commit #%d PR:%s vs Branch:%s",
 				i, prTreeSHA, branchTreeSha,
 			)
@@ -117,8 +128,8 @@ func (pr *PullRequest) GetRebaseCommits(ctx context.Context) (commitSHAs []strin
 		// the git graph to get the neext commit int th branch
 		branchCommit, err = pr.Repository.GetCommit(ctx, branchCommit.Parents[0])
 		if err != nil {
-			return nil, errors.Wrapf(
-				err, "while fetching branch commit #%d - %s", i, branchCommit.Parents[0],
+			return nil, fmt.Errorf(
+				"while fetching branch commit #%d - %s: %w", i, branchCommit.Parents[0], err,
 			)
 		}
 	}
@@ -129,3 +140,36 @@ func (pr *PullRequest) GetRebaseCommits(ctx context.Context) (commitSHAs []strin
 func (pr *PullRequest) PatchTreeID(ctx context.Context) (parentNr int, err error) {
 	return pr.impl.findPatchTree(ctx, pr)
 }
+
+// GetEvents returns the list of events recorded in the pull request
+func (pr *PullRequest) GetEvents(ctx context.Context) ([]*IssueEvent, error) {
+	events, err := pr.impl.getEvents(ctx, pr)
+	if err != nil {
+		return nil, fmt.Errorf("reading events from PR #%d: %w", pr.Number, err)
+	}
+	return events, nil
+}
+
+// GetTimeline returns the pull request timeline, including cross
+// references from other issues and pull requests
+func (pr *PullRequest) GetTimeline(ctx context.Context) ([]*IssueEvent, error) {
+	events, err := pr.impl.getTimeline(ctx, pr)
+	if err != nil {
+		return nil, fmt.Errorf("reading timeline from PR #%d: %w", pr.Number, err)
+	}
+	return events, nil
+}
+
+// MergedBy returns the login of the user that merged the pull request
+// by looking for the merged event in its event list
+func (pr *PullRequest) MergedBy(ctx context.Context) (string, error) {
+	events, err := pr.GetEvents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting pull request events: %w", err)
+	}
+	merged := FilterEvents(events, EventMerged)
+	if len(merged) == 0 {
+		return "", fmt.Errorf("PR #%d has no merge event", pr.Number)
+	}
+	return merged[len(merged)-1].Actor, nil
+}
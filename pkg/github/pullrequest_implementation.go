@@ -5,10 +5,10 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	gogithub "github.com/google/go-github/v39/github"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,6 +18,8 @@ type PRImplementation interface {
 	getCommits(ctx context.Context, pr *PullRequest) ([]*Commit, error)
 	findPatchTree(ctx context.Context, pr *PullRequest) (parentNr int, err error)
 	getRebaseCommits(ctx context.Context, pr *PullRequest) (commits []*Commit, err error)
+	getEvents(ctx context.Context, pr *PullRequest) ([]*IssueEvent, error)
+	getTimeline(ctx context.Context, pr *PullRequest) ([]*IssueEvent, error)
 }
 
 type defaultPRImplementation struct {
@@ -55,10 +57,10 @@ func (impl *defaultPRImplementation) getMergeMode(
 	// Fetch the PR data from the github API
 	mergeCommit, err := pr.GetRepository(ctx).GetCommit(ctx, pr.MergeCommitSHA)
 	if err != nil {
-		return "", errors.Wrapf(err, "querying GitHub for merge commit %s", pr.MergeCommitSHA)
+		return "", fmt.Errorf("querying GitHub for merge commit %s: %w", pr.MergeCommitSHA, err)
 	}
 	if mergeCommit == nil {
-		return "", errors.Errorf("commit returned empty when querying sha %s", pr.MergeCommitSHA)
+		return "", fmt.Errorf("commit returned empty when querying sha %s", pr.MergeCommitSHA)
 	}
 
 	// If the SHA commit has more than one parent, it is definitely a merge commit.
@@ -114,7 +116,7 @@ func (impl *defaultPRImplementation) getCommits(ctx context.Context, pr *PullReq
 		ctx, pr.RepoOwner, pr.RepoName, pr.Number, &gogithub.ListOptions{},
 	)
 	if err != nil {
-		return nil, errors.Wrapf(err, "querying GitHub for commits in PR %d", pr.Number)
+		return nil, fmt.Errorf("querying GitHub for commits in PR %d: %w", pr.Number, err)
 	}
 
 	list := []*Commit{}
@@ -123,10 +125,10 @@ func (impl *defaultPRImplementation) getCommits(ctx context.Context, pr *PullReq
 			ctx, pr.RepoOwner, pr.RepoName, ghCommit.GetSHA(), &gogithub.ListOptions{},
 		)
 		if err != nil {
-			return nil, errors.Wrapf(err, "querying GitHub for commit %s", ghCommit.GetSHA())
+			return nil, fmt.Errorf("querying GitHub for commit %s: %w", ghCommit.GetSHA(), err)
 		}
 		if ghcommit2 == nil {
-			return nil, errors.Errorf("commit returned empty when querying sha %s", ghCommit.GetSHA())
+			return nil, fmt.Errorf("commit returned empty when querying sha %s", ghCommit.GetSHA())
 		}
 		list = append(list, impl.githubAPIUser.NewCommit(ghcommit2))
 	}
@@ -147,7 +149,7 @@ func (impl *defaultPRImplementation) findPatchTree(
 	// Get the pull request commits
 	commits, err := impl.getCommits(ctx, pr)
 	if err != nil {
-		return 0, errors.Wrap(err, "getting pr commits")
+		return 0, fmt.Errorf("getting pr commits: %w", err)
 	}
 	if len(commits) == 0 {
 		return 0, errors.New("unable to find patch tree, commit list is empty")
@@ -162,15 +164,15 @@ func (impl *defaultPRImplementation) findPatchTree(
 		ctx, pr.RepoOwner, pr.RepoName, pr.MergeCommitSHA, &gogithub.ListOptions{},
 	)
 	if err != nil {
-		return 0, errors.Wrapf(err, "querying GitHub for merge commit %s", pr.MergeCommitSHA)
+		return 0, fmt.Errorf("querying GitHub for merge commit %s: %w", pr.MergeCommitSHA, err)
 	}
 	if repoCommit == nil {
-		return 0, errors.Errorf("commit returned empty when querying sha %s", pr.MergeCommitSHA)
+		return 0, fmt.Errorf("commit returned empty when querying sha %s", pr.MergeCommitSHA)
 	}
 
 	mergeCommit := impl.githubAPIUser.NewCommit(repoCommit)
 	if len(mergeCommit.Parents) == 0 {
-		return 0, errors.Errorf("commit %s has no parents defined", mergeCommit.SHA)
+		return 0, fmt.Errorf("commit %s has no parents defined", mergeCommit.SHA)
 	}
 	// First, get the tree hash from the last commit in the PR
 	prSHA := commits[len(commits)-1].TreeSHA
@@ -182,10 +184,10 @@ func (impl *defaultPRImplementation) findPatchTree(
 		parentCommit, _, err := impl.GitHubClient().Repositories.GetCommit(
 			ctx, pr.RepoOwner, pr.RepoName, parent, &gogithub.ListOptions{})
 		if err != nil {
-			return 0, errors.Wrapf(err, "querying GitHub for parent commit %s", parent)
+			return 0, fmt.Errorf("querying GitHub for parent commit %s: %w", parent, err)
 		}
 		if parentCommit == nil {
-			return 0, errors.Errorf("commit returned empty when querying sha %s", parent)
+			return 0, fmt.Errorf("commit returned empty when querying sha %s", parent)
 		}
 
 		parentTreeSHA := parentCommit.Commit.GetTree().GetSHA()
@@ -197,7 +199,7 @@ func (impl *defaultPRImplementation) findPatchTree(
 	}
 
 	// If not found, we return an error to make sure we don't use 0
-	return 0, errors.Errorf(
+	return 0, fmt.Errorf(
 		"unable to find patch tree of merge commit among %d parents", len(mergeCommit.Parents),
 	)
 }
@@ -213,16 +215,16 @@ func (impl *defaultPRImplementation) getRebaseCommits(
 	// From there we navigate backwards in the history ensuring all commits match
 	// patches from all commits.
 
-	repo := &defaultRepoImplementation{}
+	repo := &defaultRepoImplementation{githubAPIUser: impl.githubAPIUser.settings()}
 	prCommits, err := impl.getCommits(ctx, pr)
 	if err != nil {
-		return nil, errors.Wrap(err, "fetching commits from pr")
+		return nil, fmt.Errorf("fetching commits from pr: %w", err)
 	}
 
 	// First, the merge_commit_sha commit:
 	branchCommit, err := repo.getCommit(ctx, pr.RepoOwner, pr.RepoName, pr.MergeCommitSHA)
 	if err != nil {
-		return nil, errors.Wrapf(err, "querying GitHub for merge commit %s", pr.MergeCommitSHA)
+		return nil, fmt.Errorf("querying GitHub for merge commit %s: %w", pr.MergeCommitSHA, err)
 	}
 	if len(branchCommit.Parents) == 0 {
 		return nil, errors.New("branch commit has no parents")
@@ -241,7 +243,7 @@ func (impl *defaultPRImplementation) getRebaseCommits(
 		prTreeSHA := prCommits[i-1].ChangeTree()
 		branchTreeSHA := branchCommit.ChangeTree()
 		if prTreeSHA != branchTreeSHA {
-			return nil, errors.Errorf(
+			return nil, fmt.Errorf(
 				"Mismatch in checktrees on commit #%d PR:%s vs Branch:%s",
 				i-1, prTreeSHA, branchTreeSHA,
 			)
@@ -258,8 +260,8 @@ func (impl *defaultPRImplementation) getRebaseCommits(
 			ctx, pr.RepoOwner, pr.RepoName, parentSHA,
 		)
 		if err != nil {
-			return nil, errors.Wrapf(
-				err, "while fetching branch commit (prent #%d) %s", i, parentSHA,
+			return nil, fmt.Errorf(
+				"while fetching branch commit (prent #%d) %s: %w", i, parentSHA, err,
 			)
 		}
 	}
@@ -271,3 +273,14 @@ func (impl *defaultPRImplementation) getRebaseCommits(
 
 	return commits, nil
 }
+
+// getEvents fetches the pull request events. GitHub records them in
+// the issue backing the pull request.
+func (impl *defaultPRImplementation) getEvents(ctx context.Context, pr *PullRequest) ([]*IssueEvent, error) {
+	return impl.githubAPIUser.listIssueEvents(ctx, pr.RepoOwner, pr.RepoName, pr.Number)
+}
+
+// getTimeline fetches the timeline of the pull request
+func (impl *defaultPRImplementation) getTimeline(ctx context.Context, pr *PullRequest) ([]*IssueEvent, error) {
+	return impl.githubAPIUser.listIssueTimeline(ctx, pr.RepoOwner, pr.RepoName, pr.Number)
+}
@@ -10,6 +10,7 @@ import (
 )
 
 func TestGetRebaseCommits(t *testing.T) {
+	useFixture(t, "rebase-commits")
 	impl := defaultPRImplementation{}
 	ctx := context.Background()
 
@@ -54,6 +55,7 @@ func TestGetRebaseCommits(t *testing.T) {
 }
 
 func TestFindPatchTree(t *testing.T) {
+	useFixture(t, "patch-tree")
 	impl := defaultPRImplementation{}
 	ctx := context.Background()
 	pr := &PullRequest{
@@ -76,6 +78,7 @@ func TestFindPatchTree(t *testing.T) {
 }
 
 func TestGetRepo(t *testing.T) {
+	useFixture(t, "repository")
 	ctx := context.Background()
 	pr := &PullRequest{
 		impl:      &defaultPRImplementation{},
@@ -90,6 +93,7 @@ func TestGetRepo(t *testing.T) {
 }
 
 func TestGetMergeMethod(t *testing.T) {
+	useFixture(t, "merge-method")
 	repo := NewRepository("mattermost", "mattermost-mobile")
 	ctx := context.Background()
 	pr, err := repo.GetPullRequest(ctx, 5830)
@@ -104,6 +108,7 @@ func TestGetMergeMethod(t *testing.T) {
 }
 
 func TestGetCommits(t *testing.T) {
+	useFixture(t, "get-commits")
 	ctx := context.Background()
 	repo := NewRepository("mattermost", "mattermost-server")
 	pr, err := repo.GetPullRequest(ctx, 18746)
@@ -121,6 +126,7 @@ func TestGetCommits(t *testing.T) {
 }
 
 func TestMergeCommit(t *testing.T) {
+	useFixture(t, "merge-commit")
 	ctx := context.Background()
 	repo := NewRepository("mattermost", "mattermost-server")
 	pr, err := repo.GetPullRequest(ctx, 18746)
@@ -0,0 +1,90 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordFixturesVar is the environment variable that switches the tests
+// to record their fixtures from the live GitHub API
+const recordFixturesVar = "GITHUB_RECORD_FIXTURES"
+
+// useFixture makes the test replay the API responses saved in the named
+// fixture. Run the tests with GITHUB_RECORD_FIXTURES=true to record them
+// again from github.com.
+func useFixture(t *testing.T, name string) {
+	mode := RecorderReplay
+	if os.Getenv(recordFixturesVar) == "true" {
+		mode = RecorderRecord
+	}
+	rec, err := NewRecorder(filepath.Join("testdata", "fixtures", name+".yaml"), mode)
+	require.NoError(t, err)
+	SetTransport(rec)
+	t.Cleanup(func() {
+		SetTransport(nil)
+		require.NoError(t, rec.Save())
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "abc")
+		_, err := w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "recorder-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "fixtures", "test.yaml")
+
+	// Record an interaction from the test server
+	rec, err := NewRecorder(fixture, RecorderRecord)
+	require.NoError(t, err)
+	client := &http.Client{Transport: rec}
+	resp, err := client.Get(server.URL + "/repos/test")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, `{"path": "/repos/test"}`, string(body))
+	require.NoError(t, rec.Save())
+	require.FileExists(t, fixture)
+	require.Equal(t, 1, calls)
+
+	// Replay it without hitting the server
+	rec, err = NewRecorder(fixture, RecorderReplay)
+	require.NoError(t, err)
+	client = &http.Client{Transport: rec}
+	resp, err = client.Get(server.URL + "/repos/test")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, `{"path": "/repos/test"}`, string(body))
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Empty(t, resp.Header.Get("X-Request-Id"))
+	require.Equal(t, 1, calls)
+
+	// Requests not in the fixture fail
+	_, err = client.Get(server.URL + "/repos/other")
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+
+	// Replaying a missing fixture fails
+	_, err = NewRecorder(filepath.Join(dir, "missing.yaml"), RecorderReplay)
+	require.Error(t, err)
+}
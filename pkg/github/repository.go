@@ -3,7 +3,10 @@
 
 package github
 
-import "context"
+import (
+	"context"
+	"errors"
+)
 
 type Repository struct {
 	impl                       repositoryImplementation
@@ -33,6 +36,23 @@ type repositoryImplementation interface {
 	createPullRequest(
 		ctx context.Context, owner, repo, head, base, title, body string, opts *NewPullRequestOptions,
 	) (*PullRequest, error)
+	createTag(ctx context.Context, owner, repo, tag, sha, message string, opts *NewTagOptions) (*Tag, error)
+	listTags(ctx context.Context, owner, repo string) ([]*Tag, error)
+	resolveTag(ctx context.Context, owner, repo, tag string) (*Tag, error)
+	createDeployment(ctx context.Context, owner, repo, ref, environment string, opts *NewDeploymentOptions) (*Deployment, error)
+	createDeploymentStatus(ctx context.Context, owner, repo string, id int64, state string, opts *DeploymentStatusOptions) error
+	listEnvironments(ctx context.Context, owner, repo string) ([]*Environment, error)
+	dispatch(ctx context.Context, owner, repo, eventType string, payload interface{}) error
+	listBranches(ctx context.Context, owner, repo string) ([]string, error)
+	deleteBranch(ctx context.Context, owner, repo, branch string) error
+	listPullRequestsByHead(ctx context.Context, owner, repo, head string) ([]*PullRequest, error)
+	createCheckRun(
+		ctx context.Context, owner, repo, name, sha string, opts *CheckRunOptions, annotations []*CheckAnnotation,
+	) (*CheckRun, error)
+	updateCheckRun(
+		ctx context.Context, owner, repo string, id int64, name string, opts *CheckRunOptions, annotations []*CheckAnnotation,
+	) (*CheckRun, error)
+	createStatus(ctx context.Context, owner, repo, sha, statusContext, state string, opts *CommitStatusOptions) error
 }
 
 type NewPullRequestOptions struct {
@@ -57,3 +77,135 @@ func (repo *Repository) GetCommit(ctx context.Context, sha string) (c *Commit, e
 func (repo *Repository) GetPullRequest(ctx context.Context, number int) (pr *PullRequest, err error) {
 	return repo.impl.getPullRequest(ctx, repo.Owner, repo.Name, number)
 }
+
+// GetIssue fetches an issue from the repository
+func (repo *Repository) GetIssue(ctx context.Context, number int) (issue *Issue, err error) {
+	return repo.impl.getIssue(ctx, repo.Owner, repo.Name, number)
+}
+
+// CreateTag creates an annotated tag pointing to the commit at sha. The tag
+// is created using the Git Data API, so no local clone is required.
+func (repo *Repository) CreateTag(
+	ctx context.Context, tag, sha, message string, opts *NewTagOptions,
+) (*Tag, error) {
+	if opts == nil {
+		opts = &NewTagOptions{}
+	}
+	return repo.impl.createTag(ctx, repo.Owner, repo.Name, tag, sha, message, opts)
+}
+
+// ListTags returns all the tags in the repository
+func (repo *Repository) ListTags(ctx context.Context) ([]*Tag, error) {
+	return repo.impl.listTags(ctx, repo.Owner, repo.Name)
+}
+
+// ResolveTag returns the commit SHA a tag points to
+func (repo *Repository) ResolveTag(ctx context.Context, tag string) (sha string, err error) {
+	t, err := repo.impl.resolveTag(ctx, repo.Owner, repo.Name, tag)
+	if err != nil {
+		return "", err
+	}
+	return t.CommitSHA, nil
+}
+
+// GetTag returns the data of a tag in the repository
+func (repo *Repository) GetTag(ctx context.Context, tag string) (*Tag, error) {
+	return repo.impl.resolveTag(ctx, repo.Owner, repo.Name, tag)
+}
+
+// CreateDeployment creates a deployment of ref to the specified environment
+func (repo *Repository) CreateDeployment(
+	ctx context.Context, ref, environment string, opts *NewDeploymentOptions,
+) (*Deployment, error) {
+	if opts == nil {
+		opts = &NewDeploymentOptions{}
+	}
+	return repo.impl.createDeployment(ctx, repo.Owner, repo.Name, ref, environment, opts)
+}
+
+// SetDeploymentStatus records a new status for the deployment with the specified ID
+func (repo *Repository) SetDeploymentStatus(
+	ctx context.Context, deploymentID int64, state string, opts *DeploymentStatusOptions,
+) error {
+	if opts == nil {
+		opts = &DeploymentStatusOptions{}
+	}
+	return repo.impl.createDeploymentStatus(ctx, repo.Owner, repo.Name, deploymentID, state, opts)
+}
+
+// ListEnvironments returns the deployment environments defined in the repository
+func (repo *Repository) ListEnvironments(ctx context.Context) ([]*Environment, error) {
+	return repo.impl.listEnvironments(ctx, repo.Owner, repo.Name)
+}
+
+// Dispatch sends a repository_dispatch event to the repository to trigger
+// its workflows. The payload is serialized to JSON and sent as the event
+// client_payload, it can be nil.
+func (repo *Repository) Dispatch(ctx context.Context, eventType string, payload interface{}) error {
+	if eventType == "" {
+		return errors.New("unable to send dispatch event, event type is blank")
+	}
+	return repo.impl.dispatch(ctx, repo.Owner, repo.Name, eventType, payload)
+}
+
+// ListBranches returns the names of all branches in the repository
+func (repo *Repository) ListBranches(ctx context.Context) ([]string, error) {
+	return repo.impl.listBranches(ctx, repo.Owner, repo.Name)
+}
+
+// DeleteBranch deletes a branch from the repository
+func (repo *Repository) DeleteBranch(ctx context.Context, branch string) error {
+	return repo.impl.deleteBranch(ctx, repo.Owner, repo.Name, branch)
+}
+
+// ListPullRequestsByHead returns all pull requests, open or closed, filed
+// from the head branch. Branches in forks are specified as owner:branch.
+func (repo *Repository) ListPullRequestsByHead(ctx context.Context, head string) ([]*PullRequest, error) {
+	return repo.impl.listPullRequestsByHead(ctx, repo.Owner, repo.Name, head)
+}
+
+// CreateCheckRun creates a check run named name on the commit at sha. GitHub
+// only allows GitHub Apps to create check runs, so the client needs an
+// installation token. Any number of annotations can be passed, they are
+// sent in batches of the size the API allows.
+func (repo *Repository) CreateCheckRun(
+	ctx context.Context, name, sha string, opts *CheckRunOptions, annotations []*CheckAnnotation,
+) (*CheckRun, error) {
+	if name == "" || sha == "" {
+		return nil, errors.New("check run name and commit sha are required")
+	}
+	if opts == nil {
+		opts = &CheckRunOptions{}
+	}
+	return repo.impl.createCheckRun(ctx, repo.Owner, repo.Name, name, sha, opts, annotations)
+}
+
+// UpdateCheckRun updates the output of the check run with the specified
+// ID, eg to complete a check run created in progress by setting its
+// conclusion. Annotations are added to the ones the check run has.
+func (repo *Repository) UpdateCheckRun(
+	ctx context.Context, id int64, name string, opts *CheckRunOptions, annotations []*CheckAnnotation,
+) (*CheckRun, error) {
+	if id == 0 || name == "" {
+		return nil, errors.New("check run ID and name are required")
+	}
+	if opts == nil {
+		opts = &CheckRunOptions{}
+	}
+	return repo.impl.updateCheckRun(ctx, repo.Owner, repo.Name, id, name, opts, annotations)
+}
+
+// SetCommitStatus sets the state of the status named statusContext on the
+// commit at sha. Unlike check runs, statuses can be set with any token
+// with access to the repository.
+func (repo *Repository) SetCommitStatus(
+	ctx context.Context, sha, statusContext, state string, opts *CommitStatusOptions,
+) error {
+	if sha == "" || statusContext == "" {
+		return errors.New("commit sha and status context are required")
+	}
+	if opts == nil {
+		opts = &CommitStatusOptions{}
+	}
+	return repo.impl.createStatus(ctx, repo.Owner, repo.Name, sha, statusContext, state, opts)
+}
@@ -5,9 +5,12 @@ package github
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	gogithub "github.com/google/go-github/v39/github"
-	"github.com/pkg/errors"
 )
 
 type defaultRepoImplementation struct {
@@ -17,7 +20,7 @@ type defaultRepoImplementation struct {
 func (di *defaultRepoImplementation) getCommit(ctx context.Context, owner, repo, sha string) (*Commit, error) {
 	repoCommit, _, err := di.githubAPIUser.GitHubClient().Repositories.GetCommit(ctx, owner, repo, sha, &gogithub.ListOptions{})
 	if err != nil {
-		return nil, errors.Wrap(err, "fetching commit from github API")
+		return nil, fmt.Errorf("fetching commit from github API: %w", err)
 	}
 	return di.githubAPIUser.NewCommit(repoCommit), nil
 }
@@ -26,7 +29,7 @@ func (di *defaultRepoImplementation) getCommit(ctx context.Context, owner, repo,
 func (di *defaultRepoImplementation) getPullRequest(ctx context.Context, owner, repo string, number int) (*PullRequest, error) {
 	ghPr, _, err := di.githubAPIUser.GitHubClient().PullRequests.Get(ctx, owner, repo, number)
 	if err != nil {
-		return nil, errors.Wrapf(err, "fetching PR #%d from github api", number)
+		return nil, fmt.Errorf("fetching PR #%d from github api: %w", number, err)
 	}
 
 	return di.githubAPIUser.NewPullRequest(ghPr), nil
@@ -36,7 +39,7 @@ func (di *defaultRepoImplementation) getPullRequest(ctx context.Context, owner,
 func (di *defaultRepoImplementation) getIssue(ctx context.Context, owner, repo string, number int) (*Issue, error) {
 	ghIssue, _, err := di.githubAPIUser.GitHubClient().Issues.Get(ctx, owner, repo, number)
 	if err != nil {
-		return nil, errors.Wrapf(err, "fetching issue #%d from github api", number)
+		return nil, fmt.Errorf("fetching issue #%d from github api: %w", number, err)
 	}
 
 	i := di.githubAPIUser.NewIssue(ghIssue)
@@ -59,8 +62,390 @@ func (di *defaultRepoImplementation) createPullRequest(
 		ctx, owner, repo, newPullRequest,
 	)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating pull request")
+		return nil, fmt.Errorf("creating pull request: %w", err)
 	}
 
 	return di.githubAPIUser.NewPullRequest(pullrequest), nil
 }
+
+// createTag creates an annotated tag object and the reference pointing to it
+func (di *defaultRepoImplementation) createTag(
+	ctx context.Context, owner, repo, tag, sha, message string, opts *NewTagOptions,
+) (*Tag, error) {
+	newTag := &gogithub.Tag{
+		Tag:     gogithub.String(tag),
+		Message: gogithub.String(message),
+		Object: &gogithub.GitObject{
+			Type: gogithub.String("commit"),
+			SHA:  gogithub.String(sha),
+		},
+	}
+	if opts.TaggerName != "" {
+		now := time.Now()
+		newTag.Tagger = &gogithub.CommitAuthor{
+			Date:  &now,
+			Name:  gogithub.String(opts.TaggerName),
+			Email: gogithub.String(opts.TaggerEmail),
+		}
+	}
+
+	tagObject, _, err := di.githubAPIUser.GitHubClient().Git.CreateTag(ctx, owner, repo, newTag)
+	if err != nil {
+		return nil, fmt.Errorf("creating tag object for %s: %w", tag, err)
+	}
+
+	// An annotated tag is only visible once a reference points to it
+	if _, _, err := di.githubAPIUser.GitHubClient().Git.CreateRef(ctx, owner, repo, &gogithub.Reference{
+		Ref:    gogithub.String("refs/tags/" + tag),
+		Object: &gogithub.GitObject{SHA: tagObject.SHA},
+	}); err != nil {
+		return nil, fmt.Errorf("creating reference for tag %s: %w", tag, err)
+	}
+
+	return &Tag{
+		Name:      tag,
+		CommitSHA: sha,
+		SHA:       tagObject.GetSHA(),
+		Message:   message,
+	}, nil
+}
+
+// listTags fetches all pages of the repository tag list
+func (di *defaultRepoImplementation) listTags(ctx context.Context, owner, repo string) ([]*Tag, error) {
+	tags := []*Tag{}
+	opts := &gogithub.ListOptions{PerPage: 100}
+	for {
+		ghtags, resp, err := di.githubAPIUser.GitHubClient().Repositories.ListTags(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing repository tags: %w", err)
+		}
+		for _, t := range ghtags {
+			tags = append(tags, &Tag{
+				Name:      t.GetName(),
+				CommitSHA: t.GetCommit().GetSHA(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return tags, nil
+}
+
+// resolveTag reads a tag reference. If the tag is annotated, the tag
+// object is fetched to get the commit it points to.
+func (di *defaultRepoImplementation) resolveTag(ctx context.Context, owner, repo, tag string) (*Tag, error) {
+	tag = strings.TrimPrefix(tag, "refs/tags/")
+	ref, _, err := di.githubAPIUser.GitHubClient().Git.GetRef(ctx, owner, repo, "tags/"+tag)
+	if err != nil {
+		return nil, fmt.Errorf("fetching reference for tag %s: %w", tag, err)
+	}
+
+	// Lightweight tags point directly to the commit
+	if ref.GetObject().GetType() != "tag" {
+		return &Tag{Name: tag, CommitSHA: ref.GetObject().GetSHA()}, nil
+	}
+
+	tagObject, _, err := di.githubAPIUser.GitHubClient().Git.GetTag(ctx, owner, repo, ref.GetObject().GetSHA())
+	if err != nil {
+		return nil, fmt.Errorf("fetching tag object %s: %w", ref.GetObject().GetSHA(), err)
+	}
+	return &Tag{
+		Name:      tag,
+		CommitSHA: tagObject.GetObject().GetSHA(),
+		SHA:       tagObject.GetSHA(),
+		Message:   tagObject.GetMessage(),
+	}, nil
+}
+
+// createDeployment creates a new deployment using the GitHub API
+func (di *defaultRepoImplementation) createDeployment(
+	ctx context.Context, owner, repo, ref, environment string, opts *NewDeploymentOptions,
+) (*Deployment, error) {
+	request := &gogithub.DeploymentRequest{
+		Ref:                   gogithub.String(ref),
+		Environment:           gogithub.String(environment),
+		AutoMerge:             gogithub.Bool(opts.AutoMerge),
+		ProductionEnvironment: gogithub.Bool(opts.Production),
+		TransientEnvironment:  gogithub.Bool(opts.Transient),
+		Payload:               opts.Payload,
+	}
+	if opts.Task != "" {
+		request.Task = gogithub.String(opts.Task)
+	}
+	if opts.Description != "" {
+		request.Description = gogithub.String(opts.Description)
+	}
+
+	// The API runs the status checks unless we send an empty list
+	contexts := opts.RequiredContexts
+	if contexts == nil {
+		contexts = []string{}
+	}
+	request.RequiredContexts = &contexts
+
+	deployment, _, err := di.githubAPIUser.GitHubClient().Repositories.CreateDeployment(ctx, owner, repo, request)
+	if err != nil {
+		return nil, fmt.Errorf("creating deployment of %s to %s: %w", ref, environment, err)
+	}
+	return di.githubAPIUser.NewDeployment(deployment), nil
+}
+
+// createDeploymentStatus sets the state of a deployment
+func (di *defaultRepoImplementation) createDeploymentStatus(
+	ctx context.Context, owner, repo string, id int64, state string, opts *DeploymentStatusOptions,
+) error {
+	request := &gogithub.DeploymentStatusRequest{
+		State:        gogithub.String(state),
+		AutoInactive: gogithub.Bool(opts.AutoInactive),
+	}
+	if opts.Description != "" {
+		request.Description = gogithub.String(opts.Description)
+	}
+	if opts.LogURL != "" {
+		request.LogURL = gogithub.String(opts.LogURL)
+	}
+	if opts.EnvironmentURL != "" {
+		request.EnvironmentURL = gogithub.String(opts.EnvironmentURL)
+	}
+	if _, _, err := di.githubAPIUser.GitHubClient().Repositories.CreateDeploymentStatus(
+		ctx, owner, repo, id, request,
+	); err != nil {
+		return fmt.Errorf("setting status of deployment %d to %s: %w", id, state, err)
+	}
+	return nil
+}
+
+// listEnvironments returns the environments configured in the repository
+func (di *defaultRepoImplementation) listEnvironments(ctx context.Context, owner, repo string) ([]*Environment, error) {
+	resp, _, err := di.githubAPIUser.GitHubClient().Repositories.ListEnvironments(ctx, owner, repo)
+	if err != nil {
+		return nil, fmt.Errorf("listing repository environments: %w", err)
+	}
+	envs := []*Environment{}
+	for _, e := range resp.Environments {
+		envs = append(envs, &Environment{
+			ID:      e.GetID(),
+			Name:    e.GetName(),
+			HTMLURL: e.GetHTMLURL(),
+		})
+	}
+	return envs, nil
+}
+
+// dispatch creates a repository_dispatch event in the repository
+func (di *defaultRepoImplementation) dispatch(
+	ctx context.Context, owner, repo, eventType string, payload interface{},
+) error {
+	opts := gogithub.DispatchRequestOptions{EventType: eventType}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshaling dispatch event payload: %w", err)
+		}
+		raw := json.RawMessage(data)
+		opts.ClientPayload = &raw
+	}
+	if _, _, err := di.githubAPIUser.GitHubClient().Repositories.Dispatch(ctx, owner, repo, opts); err != nil {
+		return fmt.Errorf("sending %s dispatch event to %s/%s: %w", eventType, owner, repo, err)
+	}
+	return nil
+}
+
+// listBranches fetches all pages of the repository branch list
+func (di *defaultRepoImplementation) listBranches(ctx context.Context, owner, repo string) ([]string, error) {
+	branches := []string{}
+	opts := &gogithub.BranchListOptions{ListOptions: gogithub.ListOptions{PerPage: 100}}
+	for {
+		ghbranches, resp, err := di.githubAPIUser.GitHubClient().Repositories.ListBranches(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing branches of %s/%s: %w", owner, repo, err)
+		}
+		for _, b := range ghbranches {
+			branches = append(branches, b.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return branches, nil
+}
+
+// deleteBranch removes the branch reference from the repository
+func (di *defaultRepoImplementation) deleteBranch(ctx context.Context, owner, repo, branch string) error {
+	if _, err := di.githubAPIUser.GitHubClient().Git.DeleteRef(ctx, owner, repo, "heads/"+branch); err != nil {
+		return fmt.Errorf("deleting branch %s from %s/%s: %w", branch, owner, repo, err)
+	}
+	return nil
+}
+
+// listPullRequestsByHead lists the pull requests filed from a head branch
+func (di *defaultRepoImplementation) listPullRequestsByHead(
+	ctx context.Context, owner, repo, head string,
+) ([]*PullRequest, error) {
+	prs := []*PullRequest{}
+	opts := &gogithub.PullRequestListOptions{
+		State:       "all",
+		Head:        head,
+		ListOptions: gogithub.ListOptions{PerPage: 100},
+	}
+	for {
+		ghprs, resp, err := di.githubAPIUser.GitHubClient().PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing pull requests from %s: %w", head, err)
+		}
+		for _, pr := range ghprs {
+			prs = append(prs, di.githubAPIUser.NewPullRequest(pr))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return prs, nil
+}
+
+// checkRunOutput returns the output of a check run from its options
+func checkRunOutput(name string, opts *CheckRunOptions) *gogithub.CheckRunOutput {
+	output := &gogithub.CheckRunOutput{
+		Title:   gogithub.String(opts.Title),
+		Summary: gogithub.String(opts.Summary),
+	}
+	if opts.Title == "" {
+		output.Title = gogithub.String(name)
+	}
+	if opts.Text != "" {
+		output.Text = gogithub.String(opts.Text)
+	}
+	return output
+}
+
+// createCheckRun creates a check run. The first batch of annotations is
+// sent with the new check run, the rest are added updating it.
+func (di *defaultRepoImplementation) createCheckRun(
+	ctx context.Context, owner, repo, name, sha string, opts *CheckRunOptions, annotations []*CheckAnnotation,
+) (*CheckRun, error) {
+	output := checkRunOutput(name, opts)
+	batch, rest := annotationBatch(annotations)
+	output.Annotations = batch
+	request := gogithub.CreateCheckRunOptions{
+		Name:    name,
+		HeadSHA: sha,
+		Output:  output,
+	}
+	if opts.DetailsURL != "" {
+		request.DetailsURL = gogithub.String(opts.DetailsURL)
+	}
+	if opts.Conclusion != "" {
+		request.Status = gogithub.String("completed")
+		request.Conclusion = gogithub.String(opts.Conclusion)
+		request.CompletedAt = &gogithub.Timestamp{Time: time.Now()}
+	} else if opts.Status != "" {
+		request.Status = gogithub.String(opts.Status)
+	}
+
+	check, _, err := di.githubAPIUser.GitHubClient().Checks.CreateCheckRun(ctx, owner, repo, request)
+	if err != nil {
+		return nil, fmt.Errorf("creating check run %s: %w", name, err)
+	}
+
+	for len(rest) > 0 {
+		batch, rest = annotationBatch(rest)
+		output.Annotations = batch
+		if _, _, err := di.githubAPIUser.GitHubClient().Checks.UpdateCheckRun(
+			ctx, owner, repo, check.GetID(), gogithub.UpdateCheckRunOptions{Name: name, Output: output},
+		); err != nil {
+			return nil, fmt.Errorf("adding annotations to check run %s: %w", name, err)
+		}
+	}
+	return di.githubAPIUser.NewCheckRun(check), nil
+}
+
+// updateCheckRun updates a check run, sending the annotations in as many
+// requests as needed
+func (di *defaultRepoImplementation) updateCheckRun(
+	ctx context.Context, owner, repo string, id int64, name string, opts *CheckRunOptions, annotations []*CheckAnnotation,
+) (*CheckRun, error) {
+	output := checkRunOutput(name, opts)
+	batch, rest := annotationBatch(annotations)
+	output.Annotations = batch
+	request := gogithub.UpdateCheckRunOptions{Name: name, Output: output}
+	if opts.DetailsURL != "" {
+		request.DetailsURL = gogithub.String(opts.DetailsURL)
+	}
+	if opts.Conclusion != "" {
+		request.Status = gogithub.String("completed")
+		request.Conclusion = gogithub.String(opts.Conclusion)
+		request.CompletedAt = &gogithub.Timestamp{Time: time.Now()}
+	} else if opts.Status != "" {
+		request.Status = gogithub.String(opts.Status)
+	}
+
+	check, _, err := di.githubAPIUser.GitHubClient().Checks.UpdateCheckRun(ctx, owner, repo, id, request)
+	if err != nil {
+		return nil, fmt.Errorf("updating check run %s: %w", name, err)
+	}
+	for len(rest) > 0 {
+		batch, rest = annotationBatch(rest)
+		output.Annotations = batch
+		if _, _, err := di.githubAPIUser.GitHubClient().Checks.UpdateCheckRun(
+			ctx, owner, repo, id, gogithub.UpdateCheckRunOptions{Name: name, Output: output},
+		); err != nil {
+			return nil, fmt.Errorf("adding annotations to check run %s: %w", name, err)
+		}
+	}
+	return di.githubAPIUser.NewCheckRun(check), nil
+}
+
+// createStatus sets a commit status
+func (di *defaultRepoImplementation) createStatus(
+	ctx context.Context, owner, repo, sha, statusContext, state string, opts *CommitStatusOptions,
+) error {
+	status := &gogithub.RepoStatus{
+		State:   gogithub.String(state),
+		Context: gogithub.String(statusContext),
+	}
+	if opts.Description != "" {
+		description := opts.Description
+		if len(description) > maxStatusDescription {
+			description = description[:maxStatusDescription-3] + "..."
+		}
+		status.Description = gogithub.String(description)
+	}
+	if opts.TargetURL != "" {
+		status.TargetURL = gogithub.String(opts.TargetURL)
+	}
+	if _, _, err := di.githubAPIUser.GitHubClient().Repositories.CreateStatus(ctx, owner, repo, sha, status); err != nil {
+		return fmt.Errorf("setting status %s of commit %s to %s: %w", statusContext, sha, state, err)
+	}
+	return nil
+}
+
+// annotationBatch converts the annotations that fit in a request and
+// returns the ones left
+func annotationBatch(annotations []*CheckAnnotation) (batch []*gogithub.CheckRunAnnotation, rest []*CheckAnnotation) {
+	if len(annotations) > maxAnnotationsPerRequest {
+		annotations, rest = annotations[:maxAnnotationsPerRequest], annotations[maxAnnotationsPerRequest:]
+	}
+	batch = []*gogithub.CheckRunAnnotation{}
+	for _, a := range annotations {
+		endLine := a.EndLine
+		if endLine == 0 {
+			endLine = a.StartLine
+		}
+		ghAnnotation := &gogithub.CheckRunAnnotation{
+			Path:            gogithub.String(a.Path),
+			StartLine:       gogithub.Int(a.StartLine),
+			EndLine:         gogithub.Int(endLine),
+			AnnotationLevel: gogithub.String(a.Level),
+			Message:         gogithub.String(a.Message),
+		}
+		if a.Title != "" {
+			ghAnnotation.Title = gogithub.String(a.Title)
+		}
+		batch = append(batch, ghAnnotation)
+	}
+	return batch, rest
+}
@@ -14,6 +14,7 @@ func getTestRepoImpl() repositoryImplementation {
 }
 
 func TestGetIssue(t *testing.T) {
+	useFixture(t, "get-issue")
 	impl := getTestRepoImpl()
 	issue, err := impl.getIssue(context.Background(), "mattermost", "mattermost-server", 57)
 
@@ -24,5 +25,75 @@ func TestGetIssue(t *testing.T) {
 	require.Equal(t, "mattermost", issue.RepoOwner)
 
 	require.Equal(t, "jeremy-flusin", issue.Username)
-	// issue, err :=
+}
+
+func TestResolveTag(t *testing.T) {
+	useFixture(t, "resolve-tag")
+	impl := getTestRepoImpl()
+	tag, err := impl.resolveTag(context.Background(), "mattermost", "mattermost-server", "v6.2.1")
+	require.NoError(t, err)
+	require.Equal(t, "v6.2.1", tag.Name)
+	require.Equal(t, "67d05f931c7415ed300009ffb9b6f410f71dd119", tag.CommitSHA)
+}
+
+func TestCreateCheckRun(t *testing.T) {
+	useFixture(t, "check-run")
+	const sha = "0f9ae8a6c1d2b3e4f5a60718293a4b5c6d7e8f90"
+
+	// More annotations than fit in a request are sent in an update
+	annotations := []*CheckAnnotation{}
+	for i := 1; i <= 60; i++ {
+		annotations = append(annotations, &CheckAnnotation{
+			Path: "pkg/build/run.go", StartLine: i, Level: AnnotationWarning, Message: "unused variable",
+		})
+	}
+	repo := NewRepository("mattermost", "cicd-sdk")
+	check, err := repo.CreateCheckRun(context.Background(), "mmbuild", sha, &CheckRunOptions{
+		Summary: "Build failed", Conclusion: CheckConclusionFailure,
+	}, annotations)
+	require.NoError(t, err)
+	require.Equal(t, int64(4790128561), check.ID)
+	require.Equal(t, sha, check.HeadSHA)
+	require.Equal(t, CheckConclusionFailure, check.Conclusion)
+
+	batch, rest := annotationBatch(annotations)
+	require.Len(t, batch, maxAnnotationsPerRequest)
+	require.Len(t, rest, 10)
+	require.Equal(t, 1, batch[0].GetEndLine())
+
+	_, err = repo.CreateCheckRun(context.Background(), "mmbuild", "", nil, nil)
+	require.Error(t, err)
+}
+
+func TestUpdateCheckRun(t *testing.T) {
+	useFixture(t, "check-run-update")
+	const sha = "0f9ae8a6c1d2b3e4f5a60718293a4b5c6d7e8f90"
+
+	repo := NewRepository("mattermost", "cicd-sdk")
+	check, err := repo.CreateCheckRun(context.Background(), "matterbuild", sha, &CheckRunOptions{
+		Summary: "Build running", Status: CheckStatusInProgress,
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, CheckStatusInProgress, check.Status)
+
+	check, err = repo.UpdateCheckRun(context.Background(), check.ID, "matterbuild", &CheckRunOptions{
+		Summary: "Build succeeded", Conclusion: CheckConclusionSuccess,
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "completed", check.Status)
+	require.Equal(t, CheckConclusionSuccess, check.Conclusion)
+
+	_, err = repo.UpdateCheckRun(context.Background(), 0, "matterbuild", nil, nil)
+	require.Error(t, err)
+}
+
+func TestSetCommitStatus(t *testing.T) {
+	useFixture(t, "commit-status")
+	const sha = "0f9ae8a6c1d2b3e4f5a60718293a4b5c6d7e8f90"
+
+	repo := NewRepository("mattermost", "cicd-sdk")
+	require.NoError(t, repo.SetCommitStatus(context.Background(), sha, "matterbuild", CommitStatePending, &CommitStatusOptions{
+		Description: "Build make-0000 running", TargetURL: "https://ci.example.com/jobs/1",
+	}))
+	require.Error(t, repo.SetCommitStatus(context.Background(), "", "matterbuild", CommitStatePending, nil))
 }
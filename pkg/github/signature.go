@@ -0,0 +1,177 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureMagic  = "SSHSIG"
+
+	pgpSignaturePacket            = 2
+	pgpIssuerSubpacket            = 16
+	pgpIssuerFingerprintSubpacket = 33
+)
+
+// signatureKeyID returns the ID of the key that made an armored commit
+// signature: the long key ID of GPG keys, like GitHub shows them, or the
+// SHA256 fingerprint of SSH keys.
+func signatureKeyID(signature string) (string, error) {
+	signature = strings.TrimSpace(signature)
+	switch {
+	case strings.HasPrefix(signature, pgpSignatureHeader):
+		data, err := dearmor(signature)
+		if err != nil {
+			return "", err
+		}
+		return pgpSignatureKeyID(data)
+	case strings.HasPrefix(signature, sshSignatureHeader):
+		data, err := dearmor(signature)
+		if err != nil {
+			return "", err
+		}
+		return sshSignatureKeyID(data)
+	}
+	return "", errors.New("unsupported signature format")
+}
+
+// dearmor decodes the body of an armored block. Armor headers and the
+// checksum line of OpenPGP blocks are skipped.
+func dearmor(armored string) ([]byte, error) {
+	lines := strings.Split(strings.ReplaceAll(armored, "\r\n", "\n"), "\n")
+	body := ""
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "-----END"):
+			data, err := base64.StdEncoding.DecodeString(body)
+			if err != nil {
+				return nil, fmt.Errorf("decoding signature: %w", err)
+			}
+			return data, nil
+		case line == "", strings.HasPrefix(line, "="), strings.Contains(line, ": "):
+			continue
+		}
+		body += line
+	}
+	return nil, errors.New("signature has no end line")
+}
+
+// pgpSignatureKeyID reads the issuer of an OpenPGP signature packet
+func pgpSignatureKeyID(data []byte) (string, error) {
+	if len(data) < 2 || data[0]&0x80 == 0 {
+		return "", errors.New("invalid OpenPGP packet")
+	}
+	var tag int
+	var body []byte
+	if data[0]&0x40 != 0 {
+		// New format packet
+		tag = int(data[0] & 0x3f)
+		length, n, err := pgpLength(data[1:])
+		if err != nil {
+			return "", err
+		}
+		body = data[1+n:]
+		if length < len(body) {
+			body = body[:length]
+		}
+	} else {
+		// Old format packet, its length takes 1, 2 or 4 bytes
+		tag = int(data[0]>>2) & 0x0f
+		n := 1 << (data[0] & 0x03)
+		if n > 4 || len(data) < 1+n {
+			return "", errors.New("invalid OpenPGP packet length")
+		}
+		body = data[1+n:]
+	}
+	if tag != pgpSignaturePacket {
+		return "", fmt.Errorf("OpenPGP packet %d is not a signature", tag)
+	}
+
+	switch {
+	case len(body) >= 15 && body[0] == 3:
+		// Version 3 signatures have the key ID after the creation time
+		return fmt.Sprintf("%X", body[7:15]), nil
+	case len(body) >= 6 && body[0] == 4:
+		rest := body[4:]
+		for i := 0; i < 2; i++ {
+			if len(rest) < 2 {
+				break
+			}
+			size := int(binary.BigEndian.Uint16(rest))
+			if len(rest) < 2+size {
+				return "", errors.New("invalid OpenPGP signature subpackets")
+			}
+			if id := pgpIssuer(rest[2 : 2+size]); id != "" {
+				return id, nil
+			}
+			rest = rest[2+size:]
+		}
+		return "", errors.New("signature does not name its issuer")
+	}
+	return "", errors.New("unsupported OpenPGP signature version")
+}
+
+// pgpIssuer returns the key ID in the issuer or issuer fingerprint
+// subpackets of a signature
+func pgpIssuer(subpackets []byte) string {
+	for len(subpackets) > 0 {
+		length, n, err := pgpLength(subpackets)
+		if err != nil || length < 1 || len(subpackets) < n+length {
+			return ""
+		}
+		packet := subpackets[n : n+length]
+		subpackets = subpackets[n+length:]
+		switch packet[0] & 0x7f {
+		case pgpIssuerSubpacket:
+			if len(packet) == 9 {
+				return fmt.Sprintf("%X", packet[1:])
+			}
+		case pgpIssuerFingerprintSubpacket:
+			// The key ID is the end of a version 4 fingerprint
+			if len(packet) == 22 && packet[1] == 4 {
+				return fmt.Sprintf("%X", packet[14:])
+			}
+		}
+	}
+	return ""
+}
+
+// pgpLength reads an OpenPGP length, returning it and the bytes it takes
+func pgpLength(data []byte) (length, n int, err error) {
+	switch {
+	case len(data) >= 1 && data[0] < 192:
+		return int(data[0]), 1, nil
+	case len(data) >= 2 && data[0] < 255:
+		return (int(data[0])-192)<<8 + int(data[1]) + 192, 2, nil
+	case len(data) >= 5 && data[0] == 255:
+		return int(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	}
+	return 0, 0, errors.New("invalid OpenPGP length")
+}
+
+// sshSignatureKeyID returns the fingerprint of the public key in an SSH
+// signature
+func sshSignatureKeyID(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte(sshSignatureMagic)) || len(data) < len(sshSignatureMagic)+8 {
+		return "", errors.New("invalid SSH signature")
+	}
+	// The magic is followed by the version and the public key
+	rest := data[len(sshSignatureMagic)+4:]
+	size := int(binary.BigEndian.Uint32(rest))
+	if len(rest) < 4+size {
+		return "", errors.New("invalid SSH signature public key")
+	}
+	sum := sha256.Sum256(rest[4 : 4+size])
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
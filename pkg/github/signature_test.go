@@ -0,0 +1,51 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPGPSignature = `-----BEGIN PGP SIGNATURE-----
+
+iHUEABYIAB0WIQTB3rZkE0QxBHQJYsEKnYpJXYGxvAUCatHBSAAKCRAKnYpJXYGx
+vIkyAQCTKe/UT2swleGDBkcuS/MfXoAkUT5tCxjoh6qpa28W3AD/b0ov3XH6TIcn
+Ta9CZK18OSERKy+4o4Q8XEC3RfhJbg0=
+=qUsb
+-----END PGP SIGNATURE-----
+`
+	testSSHSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgWKluEFoObiudz8QsrG4VuwpX1u
+ce7vvJFqSNQdYndLkAAAADZ2l0AAAAAAAAAAZzaGE1MTIAAABTAAAAC3NzaC1lZDI1NTE5
+AAAAQK0SATe/xoPiYf98rvsobEWiWvYsb2FrdCQE0ALaGiizwSyf5vvYhOaAvL5R35aYgI
+xlMRqmcSCkt9i7SRRPbQc=
+-----END SSH SIGNATURE-----
+`
+)
+
+func TestSignatureKeyID(t *testing.T) {
+	// The long key ID of the GPG key, as listed by gpg --keyid-format long
+	keyID, err := signatureKeyID(testPGPSignature)
+	require.NoError(t, err)
+	require.Equal(t, "0A9D8A495D81B1BC", keyID)
+
+	// The fingerprint of the SSH key, as listed by ssh-keygen -l
+	keyID, err = signatureKeyID(testSSHSignature)
+	require.NoError(t, err)
+	require.Equal(t, "SHA256:T9iZkhR8/g3ic5sciMDYsyga/e7dFV1NpQ5BY6RHYmI", keyID)
+
+	for _, signature := range []string{
+		"",
+		"-----BEGIN SIGNED MESSAGE-----\nMIAGCSqGSIb3DQEHAqCAMIACAQEx\n-----END SIGNED MESSAGE-----\n",
+		"-----BEGIN PGP SIGNATURE-----\n\niHUEABYIAB0WIQTB3rZk\n",
+		"-----BEGIN PGP SIGNATURE-----\n\nAAAA\n-----END PGP SIGNATURE-----\n",
+		"-----BEGIN SSH SIGNATURE-----\nU1NIU0lHAAAAAQAAADM=\n-----END SSH SIGNATURE-----\n",
+	} {
+		_, err := signatureKeyID(signature)
+		require.Error(t, err, signature)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+// Commit status states accepted by the statuses API
+const (
+	CommitStatePending = "pending"
+	CommitStateSuccess = "success"
+	CommitStateFailure = "failure"
+	CommitStateError   = "error"
+)
+
+// maxStatusDescription is the longest description the statuses API accepts
+const maxStatusDescription = 140
+
+// CommitStatusOptions are the optional fields when setting a commit status
+type CommitStatusOptions struct {
+	Description string // Short description of the status, truncated to what GitHub accepts
+	TargetURL   string // URL with the details of the status, eg the build log
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package github
+
+// Tag abstracts a git tag in a GitHub repository
+type Tag struct {
+	Name      string // Name of the tag, without the refs/tags/ prefix
+	CommitSHA string // SHA of the commit the tag points to
+	SHA       string // SHA of the annotated tag object, blank for lightweight tags
+	Message   string // Annotation message
+}
+
+// NewTagOptions control how annotated tags are created
+type NewTagOptions struct {
+	TaggerName  string // Name of the tag author. If blank GitHub records the token owner
+	TaggerEmail string // Email address of the tag author
+}
@@ -3,6 +3,11 @@
 
 package backends
 
+import (
+	"context"
+	"time"
+)
+
 type Options struct {
 	ServiceOptions interface{}
 }
@@ -14,3 +19,28 @@ type Backend interface {
 	PathExists(string) (bool, error)
 	GetObjectHash(string) (map[string]string, error)
 }
+
+// WriteChecker is implemented by the backends which can tell if a write
+// would fail before attempting it, eg for lack of credentials
+type WriteChecker interface {
+	CheckWrite(nodeURL string) error
+}
+
+// ObjectInfo describes an object found when listing a prefix
+type ObjectInfo struct {
+	URL      string    // URL of the object
+	Size     int64     // Size of the object in bytes
+	Modified time.Time // Last time the object was written
+}
+
+// Lister is implemented by the backends which can list the objects under
+// a prefix, eg all the files of a bucket path
+type Lister interface {
+	List(prefixURL string) ([]ObjectInfo, error)
+}
+
+// ContextCopier is implemented by the backends which can stop a copy when
+// a context is done. The context also carries the trace of the copy.
+type ContextCopier interface {
+	CopyObjectContext(ctx context.Context, srcURL, destURL string) error
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Copies between backends follow the same semantics: a URL ending with a
+// slash is a prefix (a directory in the local filesystem) and any other
+// URL names an object. Copying to a prefix creates an object inside it
+// named like the source, copying to an object URL creates that exact
+// object. Only objects can be copied, not prefixes.
+
+// IsPrefixURL returns true if the URL is a prefix, ie it ends with a slash
+func IsPrefixURL(objectURL string) bool {
+	if !strings.HasPrefix(objectURL, URLPrefixFilesystem) {
+		if i := strings.IndexAny(objectURL, "?#"); i >= 0 {
+			objectURL = objectURL[:i]
+		}
+	}
+	return strings.HasSuffix(objectURL, "/")
+}
+
+// ObjectName returns the name of the object a URL points to, the last
+// element of its path. The revision and .git extension of git URLs are
+// not part of the name, git archives are named like repo.tar.gz.
+func ObjectName(objectURL string) string {
+	if strings.HasPrefix(objectURL, URLPrefixGitArchive) {
+		return archiveName(objectURL)
+	}
+	if strings.HasPrefix(objectURL, URLPrefixGit) {
+		objectURL = strings.TrimSuffix(revRegex.ReplaceAllString(objectURL, ""), ".git")
+	}
+	if !strings.HasPrefix(objectURL, URLPrefixFilesystem) {
+		if i := strings.IndexAny(objectURL, "?#"); i >= 0 {
+			objectURL = objectURL[:i]
+		}
+	}
+	if i := strings.Index(objectURL, "://"); i >= 0 {
+		objectURL = objectURL[i+3:]
+	}
+	// URLs without a path have no object name
+	if !strings.Contains(objectURL, "/") || strings.HasSuffix(objectURL, "/") {
+		return ""
+	}
+	return path.Base(objectURL)
+}
+
+// ResolveDestination returns the URL of the object created when copying
+// srcURL to destURL. When the destination is a prefix, the object is
+// created inside it with the name of the source.
+func ResolveDestination(srcURL, destURL string) (string, error) {
+	if IsPrefixURL(srcURL) {
+		return "", fmt.Errorf("%s is a prefix, only objects can be copied", srcURL)
+	}
+	if !IsPrefixURL(destURL) {
+		return destURL, nil
+	}
+	name := ObjectName(srcURL)
+	if name == "" {
+		return "", fmt.Errorf(
+			"unable to copy %s to prefix %s, the source URL has no object name", srcURL, destURL,
+		)
+	}
+	if i := strings.IndexAny(destURL, "?#"); i >= 0 && !strings.HasPrefix(destURL, URLPrefixFilesystem) {
+		return destURL[:i] + name + destURL[i:], nil
+	}
+	return destURL + name, nil
+}
+
+// localDestination returns the local path of a file URL where an object
+// will be written, creating its parent directories. Existing directories
+// are rejected: copying into them requires a prefix URL.
+func localDestination(destURL string) (string, error) {
+	destPath := filepath.Join(string(filepath.Separator), strings.TrimPrefix(destURL, URLPrefixFilesystem))
+	if s, err := os.Stat(destPath); err == nil && s.IsDir() {
+		return "", fmt.Errorf(
+			"destination %s is a directory, end the URL with a slash to copy into it", destURL,
+		)
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), os.FileMode(0o755)); err != nil {
+		return "", fmt.Errorf("creating destination directory: %w", err)
+	}
+	return destPath, nil
+}
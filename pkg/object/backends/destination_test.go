@@ -0,0 +1,60 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDestination(t *testing.T) {
+	for _, tc := range []struct {
+		src, dest, expected string
+		shouldErr           bool
+	}{
+		{"file://tmp/app.tgz", "s3://bucket/releases/app.tgz", "s3://bucket/releases/app.tgz", false},
+		{"file://tmp/app.tgz", "s3://bucket/releases/", "s3://bucket/releases/app.tgz", false},
+		{"s3://bucket/releases/app.tgz", "file://tmp/", "file://tmp/app.tgz", false},
+		{"https://example.com/dl/deps.tgz?token=x", "file://tmp/deps/", "file://tmp/deps/deps.tgz", false},
+		{"git+https://github.com/mattermost/cicd-sdk.git@46305d50a15717e2d224e38f2f2bdc9027a7cbc7", "file://tmp/", "file://tmp/cicd-sdk", false},
+		{"file://tmp/dist/", "s3://bucket/dist/", "", true}, // Prefixes cannot be copied
+		{"https://example.com/", "file://tmp/", "", true},   // No object name
+		{"https://example.com", "file://tmp/", "", true},
+	} {
+		res, err := ResolveDestination(tc.src, tc.dest)
+		if tc.shouldErr {
+			require.Error(t, err, tc.src)
+			continue
+		}
+		require.NoError(t, err, tc.src)
+		require.Equal(t, tc.expected, res)
+	}
+}
+
+func TestFilesystemCopyDestinations(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app.tgz")
+	require.NoError(t, os.WriteFile(src, []byte("app"), os.FileMode(0o644)))
+	fileURL := func(path string) string {
+		return URLPrefixFilesystem + strings.TrimPrefix(path, "/")
+	}
+	fs := NewFilesystemWithOptions(&Options{})
+
+	// Objects are copied to the exact path, creating its directories
+	require.NoError(t, fs.CopyObject(fileURL(src), fileURL(filepath.Join(dir, "out", "renamed.tgz"))))
+	require.FileExists(t, filepath.Join(dir, "out", "renamed.tgz"))
+
+	// Copying to a prefix keeps the source name
+	require.NoError(t, fs.CopyObject(fileURL(src), fileURL(filepath.Join(dir, "prefix"))+"/"))
+	require.FileExists(t, filepath.Join(dir, "prefix", "app.tgz"))
+
+	// An existing directory without the trailing slash is ambiguous
+	err := fs.CopyObject(fileURL(src), fileURL(filepath.Join(dir, "prefix")))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "end the URL with a slash")
+}
@@ -0,0 +1,8 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package backends implements the storage systems of the object manager.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt. Most callers only need the object package.
+package backends
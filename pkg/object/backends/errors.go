@@ -0,0 +1,29 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoCredentials is matched by the errors of writes to object stores
+// which require credentials when there are none
+var ErrNoCredentials = errors.New("writing requires credentials")
+
+// CredentialsError is returned when writing to a URL requires
+// credentials and the backend sends anonymous requests
+type CredentialsError struct {
+	URL    string
+	Reason string // Why the requests are anonymous
+}
+
+func (e *CredentialsError) Error() string {
+	return fmt.Sprintf("writing to %s requires credentials: %s", e.URL, e.Reason)
+}
+
+// Is makes the error match ErrNoCredentials
+func (e *CredentialsError) Is(target error) bool {
+	return target == ErrNoCredentials
+}
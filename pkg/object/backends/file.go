@@ -4,12 +4,15 @@
 package backends
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/release-utils/hash"
 	"sigs.k8s.io/release-utils/util"
@@ -34,29 +37,36 @@ func (fsb *Filesystem) Prefixes() []string {
 }
 
 func (fsb *Filesystem) CopyObject(srcURL, destURL string) error {
+	destURL, err := ResolveDestination(srcURL, destURL)
+	if err != nil {
+		return err
+	}
 	srcPath := filepath.Join(string(filepath.Separator), strings.TrimPrefix(srcURL, URLPrefixFilesystem))
-	destPath := filepath.Join(string(filepath.Separator), strings.TrimPrefix(destURL, URLPrefixFilesystem))
-
-	logrus.Infof("Copying %s to %s in local filesystem", srcPath, destPath)
 
 	sourceFileStat, err := os.Stat(srcPath)
 	if err != nil {
-		return errors.Wrap(err, "reading source stat info")
+		return fmt.Errorf("reading source stat info: %w", err)
 	}
 
 	if !sourceFileStat.Mode().IsRegular() {
-		return errors.Errorf("%s is not a regular file.", srcURL)
+		return fmt.Errorf("%s is not a regular file.", srcURL)
 	}
 
+	destPath, err := localDestination(destURL)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Copying %s to %s in local filesystem", srcPath, destPath)
+
 	source, err := os.Open(srcPath)
 	if err != nil {
-		return errors.Wrap(err, "opening source file")
+		return fmt.Errorf("opening source file: %w", err)
 	}
 	defer source.Close()
 
 	destination, err := os.Create(destPath)
 	if err != nil {
-		return errors.Wrap(err, "creating destination file")
+		return fmt.Errorf("creating destination file: %w", err)
 	}
 	defer destination.Close()
 
@@ -64,18 +74,36 @@ func (fsb *Filesystem) CopyObject(srcURL, destURL string) error {
 	for {
 		n, err := source.Read(buf)
 		if err != nil && err != io.EOF {
-			return errors.Wrap(err, "reading source file")
+			return fmt.Errorf("reading source file: %w", err)
 		}
 		if n == 0 {
 			break
 		}
 		if _, err := destination.Write(buf[:n]); err != nil {
-			return errors.Wrap(err, "writing buffer to destination file")
+			return fmt.Errorf("writing buffer to destination file: %w", err)
 		}
 	}
 	return err
 }
 
+// CopyObjectContext copies a file, failing if it is larger than the size
+// limit of ctx
+func (fsb *Filesystem) CopyObjectContext(ctx context.Context, srcURL, destURL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if MaxSize(ctx) > 0 {
+		info, err := os.Stat(filepath.Join(string(filepath.Separator), strings.TrimPrefix(srcURL, URLPrefixFilesystem)))
+		if err != nil {
+			return fmt.Errorf("reading source stat info: %w", err)
+		}
+		if err := checkSize(ctx, srcURL, info.Size()); err != nil {
+			return err
+		}
+	}
+	return fsb.CopyObject(srcURL, destURL)
+}
+
 func (fsb *Filesystem) PathExists(path string) (bool, error) {
 	path = "/" + strings.TrimPrefix(path, URLPrefixFilesystem)
 	return util.Exists(path), nil
@@ -95,10 +123,48 @@ func (fsb *Filesystem) GetObjectHash(objectURL string) (hashes map[string]string
 	for algo, fn := range fs {
 		h, err := fn(objectURL)
 		if err != nil {
-			return nil, errors.Wrapf(err, "generating %s for object", objectURL)
+			return nil, fmt.Errorf("generating %s for object: %w", objectURL, err)
 		}
 		hashes[algo] = h
 	}
 
 	return hashes, nil
 }
+
+// List returns the files under a prefix. Like in buckets, the prefix does
+// not need to be a directory: file://tmp/builds/7. lists the files in
+// /tmp/builds starting with 7.
+func (fsb *Filesystem) List(prefixURL string) ([]ObjectInfo, error) {
+	prefix := "/" + strings.TrimPrefix(prefixURL, URLPrefixFilesystem)
+	root := prefix
+	if info, err := os.Stat(prefix); err != nil || !info.IsDir() {
+		root = filepath.Dir(prefix)
+	}
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Prefixes without objects are not an error
+			if errors.Is(err, fs.ErrNotExist) && path == root {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("reading file info: %w", err)
+		}
+		objects = append(objects, ObjectInfo{
+			URL:      URLPrefixFilesystem + strings.TrimPrefix(filepath.ToSlash(path), "/"),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking %s: %w", root, err)
+	}
+	return objects, nil
+}
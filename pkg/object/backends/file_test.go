@@ -4,7 +4,12 @@
 package backends
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -30,6 +35,11 @@ func TestFileCopy(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Equal(t, "4f1c9c524e24694bbcaafb91ed55e504f29bd2b6df67cdfb481e412a3816bb46", hashValue)
+
+	// Files larger than the size limit are not copied
+	err = fs.CopyObjectContext(WithMaxSize(context.Background(), 4), tmp1.Name(), tmp2.Name())
+	require.True(t, errors.Is(err, ErrTooLarge))
+	require.NoError(t, fs.CopyObjectContext(WithMaxSize(context.Background(), 10), tmp1.Name(), tmp2.Name()))
 }
 
 // TestFileHash tests creating an object (a file) an returning its hashes
@@ -49,3 +59,37 @@ func TestFileHash(t *testing.T) {
 		"sha512": "39456c46b5bb4a2e764452241d4104e155fad4d98ccc3070baec57b6d7bc03a1ac081b6ab928f1719c7c7d81190da3ce5434466f71ee66887420c4406d68f7b9",
 	})
 }
+
+func TestFileList(t *testing.T) {
+	fs := NewFilesystemWithOptions(&Options{})
+	dir := t.TempDir()
+	for _, name := range []string{"7.1/provenance.json", "7.1/server.tar.gz", "7.2/provenance.json", "8.0/provenance.json"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), os.FileMode(0o644)))
+	}
+	prefix := URLPrefixFilesystem + strings.TrimPrefix(filepath.ToSlash(dir), "/")
+
+	// Directories are listed recursively
+	objects, err := fs.List(prefix + "/")
+	require.NoError(t, err)
+	require.Len(t, objects, 4)
+
+	// Prefixes do not need to be directories
+	objects, err = fs.List(prefix + "/7.")
+	require.NoError(t, err)
+	urls := []string{}
+	for _, o := range objects {
+		urls = append(urls, o.URL)
+		require.NotZero(t, o.Size)
+		require.False(t, o.Modified.IsZero())
+	}
+	sort.Strings(urls)
+	require.Equal(t, []string{
+		prefix + "/7.1/provenance.json", prefix + "/7.1/server.tar.gz", prefix + "/7.2/provenance.json",
+	}, urls)
+
+	// Listing a missing prefix returns no objects
+	objects, err = fs.List(prefix + "/missing/")
+	require.NoError(t, err)
+	require.Empty(t, objects)
+}
@@ -4,11 +4,12 @@
 package backends
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
 	"strings"
 
 	"github.com/mattermost/cicd-sdk/pkg/git"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -51,13 +52,13 @@ func (g *ObjectBackendGit) copyRemoteToLocal(source, destURL string) error {
 		strings.TrimPrefix(source, "git+"), strings.TrimPrefix(destURL, "file:/"),
 	)
 	if err != nil {
-		return errors.Wrap(err, "performing git clone")
+		return fmt.Errorf("performing git clone: %w", err)
 	}
 
 	// If we hava revision, clone it
 	if rev != "" {
 		if err := repo.Checkout(rev); err != nil {
-			return errors.Wrapf(err, "checking out revision %s", rev)
+			return fmt.Errorf("checking out revision %s: %w", rev, err)
 		}
 	}
 	return nil
@@ -72,7 +73,14 @@ func (g *ObjectBackendGit) PathExists(nodeURL string) (bool, error) {
 	return false, errors.New("Path exists not implemented yet")
 }
 
+// CopyObject clones a repository. The destination is the directory of
+// the clone or, if it is a prefix, the directory where it is cloned into
+// a subdirectory named like the repository.
 func (g *ObjectBackendGit) CopyObject(srcURL, destURL string) error {
+	destURL, err := ResolveDestination(srcURL, destURL)
+	if err != nil {
+		return err
+	}
 	if strings.HasPrefix(srcURL, URLPrefixFilesystem) {
 		return g.copyLocalToRemote(srcURL, destURL)
 	}
@@ -96,7 +104,7 @@ func (g *ObjectBackendGit) GetObjectHash(objectURL string) (hashes map[string]st
 	gc := git.New()
 	output, err := gc.LsRemote(objectURL, "HEAD")
 	if err != nil {
-		return nil, errors.Wrap(err, "querying remote for HEAD hash")
+		return nil, fmt.Errorf("querying remote for HEAD hash: %w", err)
 	}
 	parts := strings.Fields(output)
 	return map[string]string{"sha1": parts[0]}, nil
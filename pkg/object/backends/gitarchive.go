@@ -0,0 +1,182 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/git"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/hash"
+)
+
+// URLPrefixGitArchive is the prefix of the URLs of repository snapshots,
+// eg gitarchive+https://github.com/mattermost/cicd-sdk.git@v1.0.0
+const URLPrefixGitArchive = "gitarchive+"
+
+// gitArchiveExtension is appended to the repository name to name archives
+const gitArchiveExtension = ".tar.gz"
+
+// ObjectBackendGitArchive fetches the tree of a repository at a revision
+// as a tar.gz file. Archives of the same commit are identical, byte for
+// byte, so their digest can pin a source snapshot.
+type ObjectBackendGitArchive struct{}
+
+func NewGitArchiveWithOptions(opts *Options) *ObjectBackendGitArchive {
+	return &ObjectBackendGitArchive{}
+}
+
+func (ga *ObjectBackendGitArchive) Prefixes() []string {
+	return []string{URLPrefixGitArchive}
+}
+
+func (ga *ObjectBackendGitArchive) URLPrefix() string {
+	return URLPrefixGitArchive
+}
+
+// splitArchiveURL returns the repository URL and the revision of an
+// archive URL. The revision follows the last @ in the path of the
+// repository, eg repo.git@release-7.1, and defaults to HEAD.
+func splitArchiveURL(objectURL string) (repoURL, rev string) {
+	repoURL = strings.TrimPrefix(objectURL, URLPrefixGitArchive)
+	// The path starts after the host, or after the colon of scp-like
+	// URLs, so users in the host part are not taken as revisions
+	pathStart := strings.Index(repoURL, ":")
+	if i := strings.Index(repoURL, "://"); i >= 0 {
+		pathStart = i + 3 + strings.Index(repoURL[i+3:], "/")
+	}
+	if i := strings.LastIndex(repoURL, "@"); pathStart >= 0 && i > pathStart {
+		return repoURL[:i], repoURL[i+1:]
+	}
+	return repoURL, "HEAD"
+}
+
+// archiveName returns the name of the archive of a repository
+func archiveName(objectURL string) string {
+	repoURL, _ := splitArchiveURL(objectURL)
+	name := ObjectName(URLPrefixGit + repoURL)
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return ""
+	}
+	return name + gitArchiveExtension
+}
+
+// neutralAttributes disables the attributes that change what git archive
+// writes: export-subst expands placeholders like $Format:%ar$, which
+// depend on the time and the refs of the clone, and export-ignore leaves
+// files out of the snapshot.
+const neutralAttributes = "* -export-subst -export-ignore\n"
+
+// writeArchive fetches the revision of the repository and writes its
+// tar.gz archive to path. Git is killed if ctx is done before it finishes.
+func (ga *ObjectBackendGitArchive) writeArchive(ctx context.Context, objectURL, path string) error {
+	repoURL, rev := splitArchiveURL(objectURL)
+	dir, err := os.MkdirTemp("", "git-archive-")
+	if err != nil {
+		return fmt.Errorf("creating clone directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logrus.Infof("Fetching %s at %s to archive it", repoURL, rev)
+	repo, err := git.New().ShallowCloneContext(ctx, repoURL, dir, rev)
+	if err != nil {
+		return fmt.Errorf("fetching %s from %s: %w", rev, repoURL, err)
+	}
+
+	// The attributes of info/attributes override the .gitattributes files
+	// of the tree, so the archive has the files as they are committed
+	infoDir := filepath.Join(dir, ".git", "info")
+	if err := os.MkdirAll(infoDir, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating attributes directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(infoDir, "attributes"), []byte(neutralAttributes), os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing archive attributes: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating archive file: %w", err)
+	}
+	defer f.Close()
+	// The gzip header has no name nor time, to only depend on the tar
+	zw := gzip.NewWriter(f)
+	if err := repo.ArchiveContext(ctx, "HEAD", zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compressing archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing archive file: %w", err)
+	}
+	return nil
+}
+
+// CopyObject writes the archive of a repository. Copies to a prefix
+// create a file named after the repository, eg cicd-sdk.tar.gz.
+func (ga *ObjectBackendGitArchive) CopyObject(srcURL, destURL string) error {
+	return ga.CopyObjectContext(context.Background(), srcURL, destURL)
+}
+
+// CopyObjectContext works like CopyObject but the git commands are killed
+// if ctx is done before the archive is written
+func (ga *ObjectBackendGitArchive) CopyObjectContext(ctx context.Context, srcURL, destURL string) error {
+	destURL, err := ResolveDestination(srcURL, destURL)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(srcURL, URLPrefixFilesystem) {
+		return errors.New("Git archives can only be downloaded")
+	}
+	if !strings.HasPrefix(destURL, URLPrefixFilesystem) {
+		return errors.New("Cloud to cloud copy is not supported yet")
+	}
+	destPath, err := localDestination(destURL)
+	if err != nil {
+		return err
+	}
+	return ga.writeArchive(ctx, srcURL, destPath)
+}
+
+// PathExists checks if a path exists in the repository
+func (ga *ObjectBackendGitArchive) PathExists(nodeURL string) (bool, error) {
+	return false, errors.New("Path exists not implemented yet")
+}
+
+// GetObjectHash returns the hashes of the archive. There is no way to
+// know them without building it, so the repository is fetched.
+func (ga *ObjectBackendGitArchive) GetObjectHash(objectURL string) (map[string]string, error) {
+	f, err := os.CreateTemp("", "git-archive-hashing-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := ga.writeArchive(context.Background(), objectURL, f.Name()); err != nil {
+		return nil, fmt.Errorf("archiving repository: %w", err)
+	}
+
+	hashes := map[string]string{}
+	for algo, fn := range map[string]func(string) (string, error){
+		"sha1":   hash.SHA1ForFile,
+		"sha256": hash.SHA256ForFile,
+		"sha512": hash.SHA512ForFile,
+	} {
+		h, err := fn(f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("generating %s for object: %w", objectURL, err)
+		}
+		hashes[algo] = h
+	}
+	return hashes, nil
+}
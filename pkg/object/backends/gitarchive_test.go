@@ -0,0 +1,149 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/release-utils/command"
+)
+
+func TestSplitArchiveURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, repo, rev string
+	}{
+		{"gitarchive+https://github.com/mattermost/cicd-sdk.git", "https://github.com/mattermost/cicd-sdk.git", "HEAD"},
+		{"gitarchive+https://github.com/mattermost/cicd-sdk.git@v1.0.0", "https://github.com/mattermost/cicd-sdk.git", "v1.0.0"},
+		{"gitarchive+https://github.com/mattermost/cicd-sdk@release/7.1", "https://github.com/mattermost/cicd-sdk", "release/7.1"},
+		{"gitarchive+ssh://git@github.com/mattermost/cicd-sdk.git", "ssh://git@github.com/mattermost/cicd-sdk.git", "HEAD"},
+		{"gitarchive+git@github.com:mattermost/cicd-sdk.git@main", "git@github.com:mattermost/cicd-sdk.git", "main"},
+		{"gitarchive+file:///src/repo@61781b88e2aa98de64860ac2fd14384bf0224f53", "file:///src/repo", "61781b88e2aa98de64860ac2fd14384bf0224f53"},
+	} {
+		repo, rev := splitArchiveURL(tc.url)
+		require.Equal(t, tc.repo, repo, tc.url)
+		require.Equal(t, tc.rev, rev, tc.url)
+	}
+	require.Equal(t, "cicd-sdk.tar.gz", ObjectName("gitarchive+https://github.com/mattermost/cicd-sdk.git@v1.0.0"))
+	require.Equal(t, "cicd-sdk.tar.gz", ObjectName("gitarchive+git@github.com:mattermost/cicd-sdk.git@main"))
+}
+
+func TestGitArchiveCopy(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "README.md"), []byte("# Test\n"), os.FileMode(0o644)))
+	for _, args := range [][]string{
+		{"init", "--initial-branch=main"},
+		{"config", "user.email", "user@example.com"},
+		{"config", "user.name", "Example User"},
+		{"add", "README.md"},
+		{"commit", "-m", "Add README"},
+		{"tag", "v1.0.0"},
+	} {
+		require.NoError(t, command.NewWithWorkDir(repo, "git", args...).RunSilentSuccess())
+	}
+	head, err := command.NewWithWorkDir(repo, "git", "rev-parse", "HEAD").RunSilentSuccessOutput()
+	require.NoError(t, err)
+
+	// Copies to a prefix are named after the repository
+	ga := NewGitArchiveWithOptions(&Options{})
+	dest := t.TempDir()
+	require.NoError(t, ga.CopyObject("gitarchive+file://"+repo+"@v1.0.0", "file://"+dest+"/"))
+	path := filepath.Join(dest, filepath.Base(repo)+".tar.gz")
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	names := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			names = append(names, hdr.Name)
+		}
+	}
+	require.Equal(t, []string{"README.md"}, names)
+
+	// Archives of the same commit are identical, whatever the revision
+	// names it and the time they are built
+	tagged, err := ga.GetObjectHash("gitarchive+file://" + repo + "@v1.0.0")
+	require.NoError(t, err)
+	pinned, err := ga.GetObjectHash("gitarchive+file://" + repo + "@" + head.OutputTrimNL())
+	require.NoError(t, err)
+	require.Equal(t, tagged, pinned)
+	require.Len(t, tagged, 3)
+
+	// New commits change the archive
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "README.md"), []byte("# Changed\n"), os.FileMode(0o644)))
+	require.NoError(t, command.NewWithWorkDir(repo, "git", "commit", "-am", "Change README").RunSilentSuccess())
+	latest, err := ga.GetObjectHash("gitarchive+file://" + repo)
+	require.NoError(t, err)
+	require.NotEqual(t, tagged["sha256"], latest["sha256"])
+
+	require.Error(t, ga.CopyObject("file://"+path, "gitarchive+file://"+repo))
+}
+
+func TestGitArchiveAttributes(t *testing.T) {
+	repo := t.TempDir()
+	for name, content := range map[string]string{
+		".gitattributes": "README.md export-subst\nnotes.txt export-ignore\n",
+		"README.md":      "Built from $Format:%ar$\n",
+		"notes.txt":      "Notes\n",
+		"build.sh":       "#!/bin/sh\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(repo, name), []byte(content), os.FileMode(0o644)))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(repo, "build.sh"), os.FileMode(0o755)))
+	for _, args := range [][]string{
+		{"init", "--initial-branch=main"},
+		{"config", "user.email", "user@example.com"},
+		{"config", "user.name", "Example User"},
+		{"add", "-A"},
+		{"commit", "-m", "Add files"},
+	} {
+		require.NoError(t, command.NewWithWorkDir(repo, "git", args...).RunSilentSuccess())
+	}
+
+	// The archive has the files as committed, whatever their attributes,
+	// with their modes masked with 0022
+	ga := NewGitArchiveWithOptions(&Options{})
+	dest := t.TempDir()
+	require.NoError(t, ga.CopyObject("gitarchive+file://"+repo, "file://"+dest+"/"))
+	f, err := os.Open(filepath.Join(dest, filepath.Base(repo)+".tar.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	files := map[string]string{}
+	modes := map[string]int64{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+		modes[hdr.Name] = hdr.Mode
+	}
+	require.Equal(t, "Built from $Format:%ar$\n", files["README.md"])
+	require.Contains(t, files, "notes.txt")
+	require.Equal(t, int64(0o644), modes["README.md"])
+	require.Equal(t, int64(0o755), modes["build.sh"])
+
+	// Canceled copies stop
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, ga.CopyObjectContext(ctx, "gitarchive+file://"+repo, "file://"+dest+"/"))
+}
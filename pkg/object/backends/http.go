@@ -1,28 +1,233 @@
 package backends
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/pkg/errors"
+	"github.com/mattermost/cicd-sdk/pkg/trace"
 	"sigs.k8s.io/release-utils/hash"
-	"sigs.k8s.io/release-utils/util"
 )
 
 const (
 	URLPrefixHTTP  = "http://"
 	URLPrefixHTTPS = "https://"
+
+	// Environment variables with basic auth credentials for HTTP requests.
+	// They are only sent over https to the hosts HTTPAuthHostsVar lists
+	// (comma separated), never when it is not set.
+	HTTPUsernameVar  = "MMBUILD_HTTP_USERNAME"
+	HTTPPasswordVar  = "MMBUILD_HTTP_PASSWORD"
+	HTTPAuthHostsVar = "MMBUILD_HTTP_AUTH_HOSTS"
 )
 
-type ObjectBackendHTTP struct{}
+// HTTPOptions configure the HTTP backend. Set them in the backend
+// Options.ServiceOptions.
+type HTTPOptions struct {
+	// Headers added to requests, keyed by URL prefix. When several
+	// prefixes match a URL, the headers of the longest one win.
+	Headers map[string]map[string]string
+
+	// NetrcPath is the .netrc file read to find credentials. If empty,
+	// $NETRC or ~/.netrc are used.
+	NetrcPath string
+}
+
+type ObjectBackendHTTP struct {
+	opts   HTTPOptions
+	client *http.Client
+}
 
 func NewHTTPWithOptions(opts *Options) *ObjectBackendHTTP {
 	// Create the new configuration for the client
-	return &ObjectBackendHTTP{}
+	h := &ObjectBackendHTTP{}
+	h.client = &http.Client{Transport: &trace.Transport{}, CheckRedirect: h.checkRedirect}
+	if opts != nil {
+		if httpOpts, ok := opts.ServiceOptions.(*HTTPOptions); ok && httpOpts != nil {
+			h.opts = *httpOpts
+		}
+	}
+	return h
+}
+
+// newRequest returns a request to objectURL with the configured headers.
+// If the headers do not set an Authorization header, credentials from the
+// environment or the .netrc file are added as basic auth.
+func (h *ObjectBackendHTTP) newRequest(method, objectURL string) (*http.Request, error) {
+	req, err := http.NewRequest(method, objectURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+
+	for _, prefix := range h.headerPrefixes(objectURL) {
+		for k, v := range h.opts.Headers[prefix] {
+			req.Header.Set(k, v)
+		}
+	}
+	if req.Header.Get("Authorization") != "" {
+		return req, nil
+	}
+
+	if login, password, ok := h.credentials(req.URL); ok {
+		req.SetBasicAuth(login, password)
+	}
+	return req, nil
+}
+
+// headerPrefixes returns the prefixes of the configured headers matching
+// objectURL, shortest first
+func (h *ObjectBackendHTTP) headerPrefixes(objectURL string) []string {
+	prefixes := []string{}
+	for prefix := range h.opts.Headers {
+		if strings.HasPrefix(objectURL, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+	return prefixes
+}
+
+// checkRedirect drops the credentials of requests redirected to another
+// host or to plain http, including the configured headers that do not
+// match the new URL
+func (h *ObjectBackendHTTP) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Scheme == "https" && strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		return nil
+	}
+	req.Header.Del("Authorization")
+	matching := map[string]bool{}
+	for _, prefix := range h.headerPrefixes(req.URL.String()) {
+		for k := range h.opts.Headers[prefix] {
+			matching[http.CanonicalHeaderKey(k)] = true
+		}
+	}
+	for _, headers := range h.opts.Headers {
+		for k := range headers {
+			if !matching[http.CanonicalHeaderKey(k)] {
+				req.Header.Del(k)
+			}
+		}
+	}
+	return nil
+}
+
+// credentials returns the basic auth credentials for a URL: from the
+// environment for the hosts in HTTPAuthHostsVar or, if not set there, from
+// the entry of the host in the .netrc file. The default .netrc entry is
+// only used for the hosts in HTTPAuthHostsVar. No credentials are sent
+// over plain http.
+func (h *ObjectBackendHTTP) credentials(u *url.URL) (login, password string, ok bool) {
+	if u.Scheme != "https" {
+		return "", "", false
+	}
+	host := u.Hostname()
+	allowed := authHostAllowed(host)
+	if os.Getenv(HTTPUsernameVar) != "" && allowed {
+		return os.Getenv(HTTPUsernameVar), os.Getenv(HTTPPasswordVar), true
+	}
+
+	path := h.opts.NetrcPath
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+	return netrcCredentials(string(data), host, allowed)
+}
+
+// authHostAllowed returns true if host is in HTTPAuthHostsVar, so the
+// environment credentials can be sent to it
+func authHostAllowed(host string) bool {
+	for _, h := range strings.Split(os.Getenv(HTTPAuthHostsVar), ",") {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(h), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// netrcCredentials looks up the login and password of host in the contents
+// of a .netrc file. If useDefault is true, the default entry is used when
+// no machine matches.
+func netrcCredentials(data, host string, useDefault bool) (login, password string, ok bool) {
+	var defLogin, defPassword string
+	var hasDefault, inHost, inDefault bool
+
+	// Macro definitions run until the next empty line, they are skipped
+	tokens := []string{}
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, field)
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if inHost {
+				return login, password, true
+			}
+			inDefault = false
+			if i+1 < len(tokens) {
+				i++
+				inHost = strings.EqualFold(tokens[i], host)
+			}
+		case "default":
+			if inHost {
+				return login, password, true
+			}
+			inDefault, hasDefault = true, true
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			switch {
+			case inHost && tokens[i-1] == "login":
+				login = tokens[i]
+			case inHost && tokens[i-1] == "password":
+				password = tokens[i]
+			case inDefault && tokens[i-1] == "login":
+				defLogin = tokens[i]
+			case inDefault && tokens[i-1] == "password":
+				defPassword = tokens[i]
+			}
+		}
+	}
+	if inHost {
+		return login, password, true
+	}
+	return defLogin, defPassword, hasDefault && useDefault
 }
 
 func (h *ObjectBackendHTTP) Prefixes() []string {
@@ -36,58 +241,62 @@ func (h *ObjectBackendHTTP) URLPrefix() string {
 	return URLPrefixHTTPS
 }
 
-func (h *ObjectBackendHTTP) CopyObject(srcURL, destURL string) (err error) {
+func (h *ObjectBackendHTTP) CopyObject(srcURL, destURL string) error {
+	return h.CopyObjectContext(context.Background(), srcURL, destURL)
+}
+
+// CopyObjectContext downloads an object, the request is canceled when ctx
+// is done
+func (h *ObjectBackendHTTP) CopyObjectContext(ctx context.Context, srcURL, destURL string) (err error) {
 	if strings.HasPrefix(srcURL, URLPrefixFilesystem) {
 		return errors.New("unable to upload to http server")
 	}
 	if strings.HasPrefix(destURL, URLPrefixFilesystem) {
-		// Read the path from the URL
-		path := "/" + strings.TrimPrefix(destURL, URLPrefixFilesystem)
+		destURL, err = ResolveDestination(srcURL, destURL)
+		if err != nil {
+			return err
+		}
+		var path string
+		path, err = localDestination(destURL)
+		if err != nil {
+			return err
+		}
 		var localFile *os.File
-		if util.Exists(path) {
-			s, err := os.Stat(path)
-			if err != nil {
-				return errors.Wrap(err, "checking destination path")
-			}
-
-			if s.IsDir() {
-				u, err := url.Parse(srcURL)
-				if err != nil {
-					return errors.Wrap(err, "parsing source URL")
-				}
-				filename := filepath.Base(u.Path)
-				if filename == "" {
-					filename = "index"
-				}
-				path = filepath.Join(path, filename)
-			}
-			localFile, err = os.Create(path)
-			if err != nil {
-				return errors.Wrap(err, "creating destination file")
-			}
-		} else {
-			// Create the file
-			localFile, err = os.Create(path)
+		localFile, err = os.Create(path)
+		if err != nil {
+			return fmt.Errorf("creating destination file: %w", err)
+		}
+		// Failed downloads, eg over the size limit, leave no partial file
+		defer func() {
+			localFile.Close()
 			if err != nil {
-				return err
+				os.Remove(path)
 			}
-		}
-		defer localFile.Close()
+		}()
 
 		// Fetch the URL
-		resp, err := http.Get(srcURL) //nolint:gosec // This is supposed to be variable
+		req, err := h.newRequest(http.MethodGet, srcURL)
+		if err != nil {
+			return err
+		}
+		resp, err := h.client.Do(req.WithContext(ctx))
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != 200 {
-			return errors.Errorf("got http error %d when downloading object", resp.StatusCode)
+			return fmt.Errorf("got http error %d when downloading object", resp.StatusCode)
+		}
+
+		// Servers may not send the length, the body is limited too
+		if err := checkSize(ctx, srcURL, resp.ContentLength); err != nil {
+			return err
 		}
 
 		// Write the body to file
-		if _, err = io.Copy(localFile, resp.Body); err != nil {
-			return errors.Wrap(err, "writing data to local file")
+		if _, err = io.Copy(localFile, newLimitedReader(ctx, resp.Body, srcURL)); err != nil {
+			return fmt.Errorf("writing data to local file: %w", err)
 		}
 		return nil
 	}
@@ -95,9 +304,13 @@ func (h *ObjectBackendHTTP) CopyObject(srcURL, destURL string) (err error) {
 }
 
 func (h *ObjectBackendHTTP) PathExists(objectURL string) (bool, error) {
-	resp, err := http.Head(objectURL) //nolint:gosec // This is supposed to be variable
+	req, err := h.newRequest(http.MethodHead, objectURL)
+	if err != nil {
+		return false, err
+	}
+	resp, err := h.client.Do(req)
 	if err != nil {
-		return false, errors.Wrap(err, "checking if remote URL exists")
+		return false, fmt.Errorf("checking if remote URL exists: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -108,18 +321,18 @@ func (h *ObjectBackendHTTP) PathExists(objectURL string) (bool, error) {
 		return true, nil
 	}
 
-	return false, errors.Errorf("unable to interpret HTTP response code %d", resp.StatusCode)
+	return false, fmt.Errorf("unable to interpret HTTP response code %d", resp.StatusCode)
 }
 
 func (h *ObjectBackendHTTP) GetObjectHash(objectURL string) (hashes map[string]string, err error) {
 	// Download to a temporary directory to check
 	f, err := os.CreateTemp("", "temp-downloader-")
 	if err != nil {
-		return nil, errors.Wrap(err, "creating temp file")
+		return nil, fmt.Errorf("creating temp file: %w", err)
 	}
 
 	if err := h.CopyObject(objectURL, URLPrefixFilesystem+f.Name()[1:]); err != nil {
-		return nil, errors.Wrap(err, "downloading temporary file")
+		return nil, fmt.Errorf("downloading temporary file: %w", err)
 	}
 
 	fs := map[string]func(string) (string, error){
@@ -132,7 +345,7 @@ func (h *ObjectBackendHTTP) GetObjectHash(objectURL string) (hashes map[string]s
 	for algo, fn := range fs {
 		h, err := fn(f.Name())
 		if err != nil {
-			return nil, errors.Wrapf(err, "generating %s for object", objectURL)
+			return nil, fmt.Errorf("generating %s for object: %w", objectURL, err)
 		}
 		hashes[algo] = h
 	}
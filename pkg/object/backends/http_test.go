@@ -0,0 +1,160 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetrcCredentials(t *testing.T) {
+	netrc := `machine example.com login user1 password pass1
+machine private.example.com
+  login user2
+  macdef init
+  cd /pub
+  password ignored
+
+  password pass2
+default login anonymous password guest
+`
+	for _, tc := range []struct {
+		host, login, password string
+		ok                    bool
+	}{
+		{"example.com", "user1", "pass1", true},
+		{"private.example.com", "user2", "pass2", true},
+		{"other.example.com", "anonymous", "guest", true},
+	} {
+		login, password, ok := netrcCredentials(netrc, tc.host, true)
+		require.Equal(t, tc.ok, ok, tc.host)
+		require.Equal(t, tc.login, login, tc.host)
+		require.Equal(t, tc.password, password, tc.host)
+	}
+
+	_, _, ok := netrcCredentials("machine example.com login user1 password pass1", "other.com", true)
+	require.False(t, ok)
+
+	// The default entry is only used when allowed
+	_, _, ok = netrcCredentials(netrc, "other.example.com", false)
+	require.False(t, ok)
+	login, _, ok := netrcCredentials(netrc, "example.com", false)
+	require.True(t, ok)
+	require.Equal(t, "user1", login)
+}
+
+func TestHTTPCredentials(t *testing.T) {
+	var gotAuth, gotToken string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotToken = r.Header.Get("Private-Token")
+		w.Write([]byte("material")) //nolint:errcheck
+	}))
+	defer server.Close()
+	newBackend := func(opts *HTTPOptions) *ObjectBackendHTTP {
+		h := NewHTTPWithOptions(&Options{ServiceOptions: opts})
+		h.client.Transport = server.Client().Transport
+		return h
+	}
+
+	dir := t.TempDir()
+	netrc := filepath.Join(dir, "netrc")
+	require.NoError(t, os.WriteFile(netrc, []byte("machine 127.0.0.1 login netrcuser password netrcpass\n"), os.FileMode(0o600)))
+	t.Setenv(HTTPUsernameVar, "")
+	t.Setenv(HTTPAuthHostsVar, "")
+
+	dest := URLPrefixFilesystem + filepath.Join(dir, "material")[1:]
+
+	// Credentials are read from the netrc entry of the host
+	h := newBackend(&HTTPOptions{NetrcPath: netrc})
+	require.NoError(t, h.CopyObject(server.URL+"/material", dest))
+	require.Equal(t, "Basic bmV0cmN1c2VyOm5ldHJjcGFzcw==", gotAuth)
+
+	// Environment credentials are only sent to the allowed hosts
+	t.Setenv(HTTPUsernameVar, "envuser")
+	t.Setenv(HTTPPasswordVar, "envpass")
+	require.NoError(t, h.CopyObject(server.URL+"/material", dest))
+	require.Equal(t, "Basic bmV0cmN1c2VyOm5ldHJjcGFzcw==", gotAuth)
+	t.Setenv(HTTPAuthHostsVar, "example.com, 127.0.0.1")
+	exists, err := h.PathExists(server.URL + "/material")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, "Basic ZW52dXNlcjplbnZwYXNz", gotAuth)
+
+	// No credentials are sent over plain http
+	plain := httptest.NewServer(server.Config.Handler)
+	defer plain.Close()
+	require.NoError(t, NewHTTPWithOptions(&Options{ServiceOptions: &HTTPOptions{NetrcPath: netrc}}).CopyObject(plain.URL+"/material", dest))
+	require.Empty(t, gotAuth)
+
+	// Or to the hosts requests are redirected to
+	redirect := httptest.NewTLSServer(http.RedirectHandler(plain.URL+"/material", http.StatusFound))
+	defer redirect.Close()
+	h = newBackend(&HTTPOptions{Headers: map[string]map[string]string{
+		redirect.URL: {"Private-Token": "secret", "Authorization": "Bearer token"},
+	}})
+	h.client.Transport = redirect.Client().Transport
+	require.NoError(t, h.CopyObject(redirect.URL+"/material", dest))
+	require.Empty(t, gotAuth)
+	require.Empty(t, gotToken)
+	t.Setenv(HTTPAuthHostsVar, "")
+
+	// Headers are sent to the matching URLs, an Authorization header
+	// disables the other credential sources
+	h = newBackend(&HTTPOptions{
+		NetrcPath: netrc,
+		Headers: map[string]map[string]string{
+			server.URL:               {"Private-Token": "general", "Authorization": "Bearer token"},
+			server.URL + "/material": {"Private-Token": "specific"},
+			"https://example.com/":   {"Private-Token": "other"},
+		},
+	})
+	require.NoError(t, h.CopyObject(server.URL+"/material", dest))
+	require.Equal(t, "Bearer token", gotAuth)
+	require.Equal(t, "specific", gotToken)
+
+	data, err := os.ReadFile(filepath.Join(dir, "material"))
+	require.NoError(t, err)
+	require.Equal(t, "material", string(data))
+}
+
+func TestHTTPMaxSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// Flushing before writing everything sends no length
+			w.Write([]byte("1234")) //nolint:errcheck
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("567890")) //nolint:errcheck
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "material")
+	dest := URLPrefixFilesystem + path[1:]
+	h := NewHTTPWithOptions(nil)
+
+	// Objects within the limit are downloaded
+	require.NoError(t, h.CopyObjectContext(WithMaxSize(context.Background(), 6), server.URL+"/sized", dest))
+
+	// Larger ones fail, whether the server sends their length or not, and
+	// leave no partial file
+	err := h.CopyObjectContext(WithMaxSize(context.Background(), 5), server.URL+"/sized", dest)
+	require.True(t, errors.Is(err, ErrTooLarge))
+	require.NoFileExists(t, path)
+	err = h.CopyObjectContext(WithMaxSize(context.Background(), 8), server.URL+"/chunked", dest)
+	require.True(t, errors.Is(err, ErrTooLarge), err)
+	var tooLarge *TooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, int64(8), tooLarge.Limit)
+	require.NoFileExists(t, path)
+
+	// Without a limit, any size is accepted
+	require.NoError(t, h.CopyObjectContext(WithMaxSize(context.Background(), 0), server.URL+"/chunked", dest))
+}
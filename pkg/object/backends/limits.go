@@ -0,0 +1,109 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooLarge is matched by the errors of downloads larger than the size
+// limit of their context
+var ErrTooLarge = errors.New("object is larger than the size limit")
+
+// TooLargeError is returned when a download exceeds its size limit
+type TooLargeError struct {
+	URL   string
+	Limit int64 // Size limit in bytes
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s is larger than the %d bytes download limit", e.URL, e.Limit)
+}
+
+// Is makes the error match ErrTooLarge
+func (e *TooLargeError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+type maxSizeKey struct{}
+
+// WithMaxSize returns a context limiting the size of the objects
+// downloaded with it by the ContextCopier backends. The limit is checked
+// while the data is received, so copies of larger objects stop as soon as
+// they cross it. Zero or negative sizes remove the limit.
+func WithMaxSize(ctx context.Context, size int64) context.Context {
+	return context.WithValue(ctx, maxSizeKey{}, size)
+}
+
+// MaxSize returns the download size limit of a context, zero if it has
+// none
+func MaxSize(ctx context.Context) int64 {
+	if size, ok := ctx.Value(maxSizeKey{}).(int64); ok && size > 0 {
+		return size
+	}
+	return 0
+}
+
+// checkSize returns a TooLargeError if a known object size is over the
+// limit of ctx
+func checkSize(ctx context.Context, objectURL string, size int64) error {
+	if limit := MaxSize(ctx); limit > 0 && size > limit {
+		return &TooLargeError{URL: objectURL, Limit: limit}
+	}
+	return nil
+}
+
+// limitedReader reads from r until more than limit bytes are read, then
+// fails with a TooLargeError
+type limitedReader struct {
+	r     io.Reader
+	url   string
+	limit int64
+	read  int64
+}
+
+// newLimitedReader returns r limited to the download size of ctx
+func newLimitedReader(ctx context.Context, r io.Reader, objectURL string) io.Reader {
+	limit := MaxSize(ctx)
+	if limit == 0 {
+		return r
+	}
+	return &limitedReader{r: r, url: objectURL, limit: limit}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+	if lr.read > lr.limit {
+		return n, &TooLargeError{URL: lr.url, Limit: lr.limit}
+	}
+	return n, err
+}
+
+// limitedWriterAt fails the writes past the limit with a TooLargeError,
+// for downloads writing parts of the object concurrently
+type limitedWriterAt struct {
+	w     io.WriterAt
+	url   string
+	limit int64
+}
+
+// newLimitedWriterAt returns w limited to the download size of ctx
+func newLimitedWriterAt(ctx context.Context, w io.WriterAt, objectURL string) io.WriterAt {
+	limit := MaxSize(ctx)
+	if limit == 0 {
+		return w
+	}
+	return &limitedWriterAt{w: w, url: objectURL, limit: limit}
+}
+
+func (lw *limitedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > lw.limit {
+		return 0, &TooLargeError{URL: lw.url, Limit: lw.limit}
+	}
+	return lw.w.WriteAt(p, off)
+}
@@ -4,10 +4,14 @@
 package backends
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -15,34 +19,190 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	s3go "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/release-utils/hash"
-	"sigs.k8s.io/release-utils/util"
 )
 
 const URLPrefixS3 = "s3://"
 
+// sessionMu serializes the creation of sessions. When AWS_CA_BUNDLE is
+// set, the SDK modifies the transport of the default HTTP client.
+var sessionMu sync.Mutex
+
+// S3Options configure the S3 backend. Set them in the backend
+// Options.ServiceOptions.
+type S3Options struct {
+	// Region used for the buckets whose region is not known. If empty,
+	// AWS_DEFAULT_REGION is used.
+	Region string
+
+	// BucketRegions sets the region of buckets, keyed by bucket name.
+	// They take precedence over the detected regions.
+	BucketRegions map[string]string
+
+	// DisableRegionDetection turns off looking up the region of the
+	// buckets, all of them are then in Region unless set in BucketRegions.
+	// Detection is always off with a custom endpoint (AWS_ENDPOINT_URL).
+	DisableRegionDetection bool
+
+	// Profile is the shared configuration profile to read the credentials
+	// from. If empty, AWS_PROFILE or the default profile is used.
+	Profile string
+
+	// Anonymous sends unsigned requests without looking up credentials,
+	// eg to download from public buckets. Uploads fail when it is set.
+	Anonymous bool
+}
+
 type ObjectBackendS3 struct {
-	session session.Session
+	opts  S3Options
+	conf  aws.Config
+	creds *credentials.Credentials // Credential chain of the default session
+
+	credsOnce sync.Once
+	credsErr  error // Why requests are anonymous, nil if they are signed
+
+	mu       sync.Mutex
+	regions  map[string]string           // Detected regions, keyed by bucket
+	sessions map[string]*session.Session // Sessions, keyed by region
 }
 
 func NewS3WithOptions(opts *Options) *ObjectBackendS3 {
+	s3Opts := S3Options{}
+	if opts != nil {
+		if o, ok := opts.ServiceOptions.(*S3Options); ok && o != nil {
+			s3Opts = *o
+		}
+	}
+	if s3Opts.Region == "" {
+		s3Opts.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
 	// Create the new configuration for the client
 	conf := &aws.Config{
-		Region: aws.String(os.Getenv("AWS_DEFAULT_REGION")),
+		Region: aws.String(s3Opts.Region),
 	}
 
-	if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
-		logrus.Infof("No AWS credentials found in the environment, using anonnymous client")
-		conf.Credentials = credentials.AnonymousCredentials
+	// Use a custom endpoint when defined, eg to talk to a MinIO server
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		logrus.Infof("Using custom S3 endpoint %s", endpoint)
+		conf.Endpoint = aws.String(endpoint)
+		conf.S3ForcePathStyle = aws.Bool(true)
+		s3Opts.DisableRegionDetection = true
 	}
-	sess := session.Must(session.NewSession(conf))
+
+	// The session sets up the credential chain: environment, shared
+	// profile and EC2 or ECS roles. It is only looked up when used.
+	sessOpts := session.Options{Config: *conf, Profile: s3Opts.Profile}
+	if s3Opts.Profile != "" {
+		sessOpts.SharedConfigState = session.SharedConfigEnable
+	}
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sess := session.Must(session.NewSessionWithOptions(sessOpts))
 	return &ObjectBackendS3{
-		session: *sess,
+		opts:     s3Opts,
+		conf:     *conf,
+		creds:    sess.Config.Credentials,
+		regions:  map[string]string{},
+		sessions: map[string]*session.Session{},
 	}
 }
 
+// Anonymous returns true if the requests to S3 are not signed, because
+// the options say so or because the credential chain found no
+// credentials. The chain is only looked up once.
+func (s3 *ObjectBackendS3) Anonymous() bool {
+	s3.credsOnce.Do(func() {
+		if s3.opts.Anonymous {
+			s3.credsErr = errors.New("anonymous access is set in the options")
+			return
+		}
+		if _, err := s3.creds.Get(); err != nil {
+			logrus.Infof("No AWS credentials found, using anonymous requests to read from S3")
+			logrus.Debugf("AWS credential chain: %v", err)
+			s3.credsErr = errors.New("none were found in the environment, the shared profile or the instance role")
+		}
+	})
+	return s3.credsErr != nil
+}
+
+// CheckWrite returns a CredentialsError if writing to a URL would fail
+// because the requests are anonymous, to fail before doing any work.
+func (s3 *ObjectBackendS3) CheckWrite(nodeURL string) error {
+	if s3.Anonymous() {
+		return &CredentialsError{URL: nodeURL, Reason: s3.credsErr.Error()}
+	}
+	return nil
+}
+
+// BucketRegion returns the region of a bucket: the one set in the
+// options, or the one detected from S3, or the default region if it
+// cannot be detected. Detected regions are cached.
+func (s3 *ObjectBackendS3) BucketRegion(bucket string) string {
+	if region, ok := s3.opts.BucketRegions[bucket]; ok && region != "" {
+		return region
+	}
+	if s3.opts.DisableRegionDetection {
+		return s3.opts.Region
+	}
+
+	hint := s3.opts.Region
+	if hint == "" {
+		hint = "us-east-1"
+	}
+	sess, err := s3.regionSession(hint)
+	if err != nil {
+		logrus.Warnf("Unable to detect the region of bucket %s, using %q: %v", bucket, s3.opts.Region, err)
+		return s3.opts.Region
+	}
+
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+	if region, ok := s3.regions[bucket]; ok {
+		return region
+	}
+	region, err := s3manager.GetBucketRegion(aws.BackgroundContext(), sess, bucket, hint)
+	if err != nil {
+		logrus.Warnf("Unable to detect the region of bucket %s, using %q: %v", bucket, s3.opts.Region, err)
+		region = s3.opts.Region
+	} else if region != s3.opts.Region {
+		logrus.Infof("Bucket %s is in region %s", bucket, region)
+	}
+	s3.regions[bucket] = region
+	return region
+}
+
+// bucketSession returns the session to talk to the region of a bucket
+func (s3 *ObjectBackendS3) bucketSession(bucket string) (*session.Session, error) {
+	return s3.regionSession(s3.BucketRegion(bucket))
+}
+
+// regionSession returns the session to talk to a region, anonymous if
+// there are no credentials
+func (s3 *ObjectBackendS3) regionSession(region string) (*session.Session, error) {
+	anonymous := s3.Anonymous()
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+	if sess, ok := s3.sessions[region]; ok {
+		return sess, nil
+	}
+	conf := s3.conf
+	conf.Region = aws.String(region)
+	conf.Credentials = s3.creds
+	if anonymous {
+		conf.Credentials = credentials.AnonymousCredentials
+	}
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sess, err := session.NewSession(&conf)
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 session for region %s: %w", region, err)
+	}
+	s3.sessions[region] = sess
+	return sess, nil
+}
+
 func (s3 *ObjectBackendS3) Prefixes() []string {
 	return []string{URLPrefixS3}
 }
@@ -54,86 +214,101 @@ func (s3 *ObjectBackendS3) URLPrefix() string {
 func (s3 *ObjectBackendS3) splitBucketPath(locationURL string) (bucket, path string, err error) {
 	u, err := url.Parse(locationURL)
 	if err != nil {
-		return bucket, path, errors.Wrap(err, "parsing source URL")
+		return bucket, path, fmt.Errorf("parsing source URL: %w", err)
 	}
 	return u.Host, u.Path, nil
 }
 
 // copyRemoteLocal downloads a file from a bucket to the local filesystem
-func (s3 *ObjectBackendS3) copyRemoteToLocal(source, destURL string) error {
-	destPath := filepath.Join(string(filepath.Separator), strings.TrimPrefix(destURL, URLPrefixFilesystem))
+func (s3 *ObjectBackendS3) copyRemoteToLocal(ctx context.Context, source, destURL string) (err error) {
+	destPath, err := localDestination(destURL)
+	if err != nil {
+		return err
+	}
 	bucket, path, err := s3.splitBucketPath(source)
 	if err != nil {
-		return errors.Wrap(err, "parsing source URL")
+		return fmt.Errorf("parsing source URL: %w", err)
 	}
-	downloader := s3manager.NewDownloader(&s3.session)
-
-	var f *os.File
-	if util.Exists(destPath) {
-		s, err := os.Stat(destPath)
-		if err != nil {
-			return errors.Wrap(err, "checking destination path")
-		}
+	sess, err := s3.bucketSession(bucket)
+	if err != nil {
+		return err
+	}
+	downloader := s3manager.NewDownloader(sess)
 
-		if s.IsDir() {
-			u, err := url.Parse(source)
-			if err != nil {
-				return errors.Wrap(err, "parsing source URL")
-			}
-			filename := filepath.Base(u.Path)
-			if filename == "" {
-				filename = "index"
-			}
-			destPath = filepath.Join(destPath, filename)
-		}
-		f, err = os.Create(destPath)
-		if err != nil {
-			return errors.Wrap(err, "creating destination file")
-		}
-	} else {
-		f, err = os.Create(destPath)
+	f, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("creating destination file: %w", err)
+	}
+	// Failed downloads, eg over the size limit, leave no partial file
+	defer func() {
+		f.Close()
 		if err != nil {
-			return errors.Wrap(err, "opening destination file "+destPath)
+			os.Remove(destPath)
 		}
-	}
+	}()
 	// Write the contents of S3 Object to the file
-	n, err := downloader.Download(f, &s3go.GetObjectInput{
+	n, err := downloader.DownloadWithContext(ctx, newLimitedWriterAt(ctx, f, source), &s3go.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(path),
 	})
 	if err != nil {
-		return errors.Wrapf(err, "failed to download file %s from %s", path, bucket)
+		var tooLarge *TooLargeError
+		if errors.As(err, &tooLarge) {
+			return tooLarge
+		}
+		return fmt.Errorf("failed to download file %s from %s: %w", path, bucket, err)
 	}
 	logrus.Infof("Downloaded %d bytes to %s", n, destURL)
 	return nil
 }
 
 // copyLocalToRemote copies a localfile to an s3 bucket
-func (s3 *ObjectBackendS3) copyLocalToRemote(sourceURL, destURL string) error {
+func (s3 *ObjectBackendS3) copyLocalToRemote(ctx context.Context, sourceURL, destURL string) error {
 	srcPath := filepath.Join(string(filepath.Separator), strings.TrimPrefix(sourceURL, URLPrefixFilesystem))
-	uploader := s3manager.NewUploader(&s3.session)
 	bucket, path, err := s3.splitBucketPath(destURL)
 	if err != nil {
-		return errors.Wrap(err, "parsing source URL")
+		return fmt.Errorf("parsing source URL: %w", err)
+	}
+	// Anonymous uploads fail with access errors, explain why instead
+	if err := s3.CheckWrite(destURL); err != nil {
+		return err
+	}
+	sess, err := s3.bucketSession(bucket)
+	if err != nil {
+		return err
 	}
+	uploader := s3manager.NewUploader(sess)
 	f, err := os.Open(srcPath)
 	if err != nil {
-		return errors.Wrap(err, "opening local file")
+		return fmt.Errorf("opening local file: %w", err)
 	}
-	_, err = uploader.Upload(&s3manager.UploadInput{
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(path),
 		Body:   f,
 	})
-	return errors.Wrap(err, "uploading file")
+	if err != nil {
+		return fmt.Errorf("uploading file: %w", err)
+	}
+	return nil
 }
 
 func (s3 *ObjectBackendS3) CopyObject(srcURL, destURL string) error {
+	return s3.CopyObjectContext(context.Background(), srcURL, destURL)
+}
+
+// CopyObjectContext uploads or downloads an object, the transfer is
+// aborted when ctx is done
+func (s3 *ObjectBackendS3) CopyObjectContext(ctx context.Context, srcURL, destURL string) error {
+	destURL, err := ResolveDestination(srcURL, destURL)
+	if err != nil {
+		return err
+	}
 	if strings.HasPrefix(srcURL, URLPrefixFilesystem) {
-		return s3.copyLocalToRemote(srcURL, destURL)
+		return s3.copyLocalToRemote(ctx, srcURL, destURL)
 	}
 	if strings.HasPrefix(destURL, URLPrefixFilesystem) {
-		return s3.copyRemoteToLocal(srcURL, destURL)
+		return s3.copyRemoteToLocal(ctx, srcURL, destURL)
 	}
 	return errors.New("Cloud to cloud copy is not supported yet")
 }
@@ -142,9 +317,13 @@ func (s3 *ObjectBackendS3) CopyObject(srcURL, destURL string) error {
 func (s3 *ObjectBackendS3) PathExists(nodeURL string) (bool, error) {
 	bucket, path, err := s3.splitBucketPath(nodeURL)
 	if err != nil {
-		return false, errors.Wrap(err, "parsing node URL")
+		return false, fmt.Errorf("parsing node URL: %w", err)
+	}
+	sess, err := s3.bucketSession(bucket)
+	if err != nil {
+		return false, err
 	}
-	client := s3go.New(&s3.session)
+	client := s3go.New(sess)
 	logrus.Debugf("Checking if %s exists in %s", path, bucket)
 	if _, err := client.HeadObject(&s3go.HeadObjectInput{
 		Bucket: aws.String(bucket),
@@ -163,18 +342,48 @@ func (s3 *ObjectBackendS3) PathExists(nodeURL string) (bool, error) {
 	return true, nil
 }
 
+// List returns the objects of a bucket with keys starting with the path
+// of prefixURL
+func (s3 *ObjectBackendS3) List(prefixURL string) ([]ObjectInfo, error) {
+	bucket, path, err := s3.splitBucketPath(prefixURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing prefix URL: %w", err)
+	}
+	sess, err := s3.bucketSession(bucket)
+	if err != nil {
+		return nil, err
+	}
+	objects := []ObjectInfo{}
+	if err := s3go.New(sess).ListObjectsV2Pages(&s3go.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(strings.TrimPrefix(path, "/")),
+	}, func(page *s3go.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				URL:      URLPrefixS3 + bucket + "/" + aws.StringValue(o.Key),
+				Size:     aws.Int64Value(o.Size),
+				Modified: aws.TimeValue(o.LastModified),
+			})
+		}
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("listing objects in %s: %w", bucket, err)
+	}
+	return objects, nil
+}
+
 // GetObjectHash returns a hash of a remote object. In S3, there are no
 // APIs to get the file hash so we have to download and sum.
 func (s3 *ObjectBackendS3) GetObjectHash(objectURL string) (hashes map[string]string, err error) {
 	// Create a temporary directory to store the file
 	f, err := os.CreateTemp("", "object-hashing-")
 	if err != nil {
-		return nil, errors.Wrap(err, "creating temporary file")
+		return nil, fmt.Errorf("creating temporary file: %w", err)
 	}
 	defer os.Remove(f.Name())
 
-	if err := s3.copyRemoteToLocal(objectURL, "file:/"+f.Name()); err != nil {
-		return nil, errors.Wrap(err, "downloading obkect from s3")
+	if err := s3.copyRemoteToLocal(context.Background(), objectURL, "file:/"+f.Name()); err != nil {
+		return nil, fmt.Errorf("downloading obkect from s3: %w", err)
 	}
 
 	fs := map[string]func(string) (string, error){
@@ -187,7 +396,7 @@ func (s3 *ObjectBackendS3) GetObjectHash(objectURL string) (hashes map[string]st
 	for algo, fn := range fs {
 		h, err := fn(f.Name())
 		if err != nil {
-			return nil, errors.Wrapf(err, "generating %s for object", objectURL)
+			return nil, fmt.Errorf("generating %s for object: %w", objectURL, err)
 		}
 		hashes[algo] = h
 	}
@@ -1,9 +1,12 @@
 package backends
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/stretchr/testify/require"
 )
 
@@ -37,3 +40,79 @@ func TestS3Hash(t *testing.T) {
 		"sha512": "1d5fe438ec97daf208d9e34cb9814834d40c540f65096e6ff5fcc19ac1c3084bfc05bbc911ceb32271089a8f71c8dc9eabf2c7b8146f79a6596e38ff8ee36f2a",
 	})
 }
+
+func TestS3BucketRegion(t *testing.T) {
+	s3 := NewS3WithOptions(&Options{ServiceOptions: &S3Options{
+		Region:                 "us-east-1",
+		BucketRegions:          map[string]string{"releases-eu": "eu-west-1"},
+		DisableRegionDetection: true,
+	}})
+	require.Equal(t, "eu-west-1", s3.BucketRegion("releases-eu"))
+	require.Equal(t, "us-east-1", s3.BucketRegion("releases"))
+
+	sess, err := s3.bucketSession("releases-eu")
+	require.NoError(t, err)
+	require.Equal(t, "eu-west-1", *sess.Config.Region)
+	sess2, err := s3.bucketSession("releases-eu")
+	require.NoError(t, err)
+	require.Same(t, sess, sess2)
+	sess, err = s3.bucketSession("releases")
+	require.NoError(t, err)
+	require.Equal(t, "us-east-1", *sess.Config.Region)
+}
+
+func TestS3Credentials(t *testing.T) {
+	// Keep the credential chain away from the real environment
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	noDetection := &S3Options{Region: "us-east-1", DisableRegionDetection: true}
+
+	// Without credentials, requests are anonymous and uploads fail early
+	s3 := NewS3WithOptions(&Options{ServiceOptions: noDetection})
+	require.True(t, s3.Anonymous())
+	sess, err := s3.bucketSession("releases")
+	require.NoError(t, err)
+	require.Same(t, credentials.AnonymousCredentials, sess.Config.Credentials)
+	src := filepath.Join(dir, "app.bin")
+	require.NoError(t, os.WriteFile(src, []byte("app"), os.FileMode(0o644)))
+	err = s3.CopyObject("file://"+src, "s3://releases/app.bin")
+	require.True(t, errors.Is(err, ErrNoCredentials))
+	var credsErr *CredentialsError
+	require.True(t, errors.As(err, &credsErr))
+	require.Equal(t, "s3://releases/app.bin", credsErr.URL)
+
+	// Credentials in the environment are used
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	s3 = NewS3WithOptions(&Options{ServiceOptions: noDetection})
+	require.False(t, s3.Anonymous())
+	require.NoError(t, s3.CheckWrite("s3://releases/app.bin"))
+
+	// Unless the options want anonymous requests
+	anonymous := *noDetection
+	anonymous.Anonymous = true
+	s3 = NewS3WithOptions(&Options{ServiceOptions: &anonymous})
+	require.True(t, s3.Anonymous())
+	require.ErrorIs(t, s3.CheckWrite("s3://releases/app.bin"), ErrNoCredentials)
+
+	// Credentials can come from a shared profile
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "credentials"), []byte(
+		"[builder]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = secret\n",
+	), os.FileMode(0o600)))
+	profile := *noDetection
+	profile.Profile = "builder"
+	s3 = NewS3WithOptions(&Options{ServiceOptions: &profile})
+	require.False(t, s3.Anonymous())
+	sess, err = s3.bucketSession("releases")
+	require.NoError(t, err)
+	value, err := sess.Config.Credentials.Get()
+	require.NoError(t, err)
+	require.Equal(t, "AKIDPROFILE", value.AccessKeyID)
+}
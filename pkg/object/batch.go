@@ -0,0 +1,147 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultCopyConcurrency is the number of copies of a batch executed at
+// the same time when the manager does not define it
+const DefaultCopyConcurrency = 4
+
+// CopySpec is a copy operation of a batch
+type CopySpec struct {
+	Source      string `yaml:"source" json:"source"`           // Object URL to copy from
+	Destination string `yaml:"destination" json:"destination"` // Object URL to copy to
+}
+
+// CopyResult is the outcome of a copy of a batch
+type CopyResult struct {
+	Spec     CopySpec
+	Error    error         // Error returned by the copy, nil if it succeeded
+	Duration time.Duration // Time the copy took
+}
+
+// CopyBatchResult holds the results of a batch of copies, in the same
+// order as the specs
+type CopyBatchResult struct {
+	Results   []CopyResult
+	Succeeded int
+	Failed    int
+	Duration  time.Duration // Time the whole batch took
+}
+
+// Err returns the error of the first failed copy of the batch, or nil
+// if all copies succeeded
+func (br *CopyBatchResult) Err() error {
+	for _, r := range br.Results {
+		if r.Error != nil {
+			return &CopyError{Spec: r.Spec, Err: r.Error, Failed: br.Failed}
+		}
+	}
+	return nil
+}
+
+// CopyError is returned by CopyBatchResult.Err() when copies failed
+type CopyError struct {
+	Spec   CopySpec // First copy that failed
+	Err    error    // Error of the first failed copy
+	Failed int      // Number of copies that failed in the batch
+}
+
+func (e *CopyError) Error() string {
+	return fmt.Sprintf(
+		"%d copies failed, copying %s to %s: %v", e.Failed, e.Spec.Source, e.Spec.Destination, e.Err,
+	)
+}
+
+// Is makes the error match ErrCopyFailed
+func (e *CopyError) Is(target error) bool {
+	return target == ErrCopyFailed
+}
+
+// Unwrap returns the error of the first failed copy
+func (e *CopyError) Unwrap() error {
+	return e.Err
+}
+
+// ParseCopyManifest reads a list of copy specs from YAML or JSON data:
+//
+//   - source: file://tmp/build/app.tar.gz
+//     destination: s3://bucket/app/app.tar.gz
+func ParseCopyManifest(data []byte) ([]CopySpec, error) {
+	specs := []CopySpec{}
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("parsing copy manifest: %w", err)
+	}
+	for i, s := range specs {
+		if s.Source == "" || s.Destination == "" {
+			return nil, fmt.Errorf("copy #%d in manifest needs a source and a destination", i)
+		}
+	}
+	return specs, nil
+}
+
+// CopyBatch executes a list of copies. Up to the manager Concurrency
+// copies run at the same time. All copies are attempted even if some
+// fail, check the result Err() to find out if any of them failed.
+func (om *Manager) CopyBatch(specs []CopySpec) *CopyBatchResult {
+	return om.CopyBatchContext(context.Background(), specs)
+}
+
+// CopyBatchContext works like CopyBatch but stops starting copies once
+// ctx is done. Copies already running finish, unless their backend can
+// stop them, the ones not started fail with the context error.
+func (om *Manager) CopyBatchContext(ctx context.Context, specs []CopySpec) *CopyBatchResult {
+	start := time.Now()
+	result := &CopyBatchResult{Results: make([]CopyResult, len(specs))}
+	workers := om.Concurrency
+	if workers <= 0 {
+		workers = DefaultCopyConcurrency
+	}
+
+	logrus.Infof("Copying %d objects, %d at a time", len(specs), workers)
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := ctx.Err(); err != nil {
+				result.Results[i] = CopyResult{Spec: specs[i], Error: err}
+				return
+			}
+			copyStart := time.Now()
+			err := om.CopyContext(ctx, specs[i].Source, specs[i].Destination)
+			result.Results[i] = CopyResult{Spec: specs[i], Error: err, Duration: time.Since(copyStart)}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, r := range result.Results {
+		if r.Error != nil {
+			result.Failed++
+			logrus.Errorf("Copy of %s to %s failed: %v", r.Spec.Source, r.Spec.Destination, r.Error)
+		} else {
+			result.Succeeded++
+		}
+	}
+	result.Duration = time.Since(start)
+	logrus.Infof(
+		"Batch copy finished in %s: %d succeeded, %d failed",
+		result.Duration.Round(time.Millisecond), result.Succeeded, result.Failed,
+	)
+	return result
+}
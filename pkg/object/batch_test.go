@@ -0,0 +1,82 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyBatch(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	specs := []CopySpec{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), os.FileMode(0o644)))
+		specs = append(specs, CopySpec{
+			Source: FileURL(filepath.Join(src, name)), Destination: FileURL(filepath.Join(dst, name)),
+		})
+	}
+
+	om := NewManager()
+	om.Concurrency = 3
+	res := om.CopyBatch(specs)
+	require.NoError(t, res.Err())
+	require.Equal(t, 10, res.Succeeded)
+	require.Zero(t, res.Failed)
+	require.Len(t, res.Results, 10)
+	for i, r := range res.Results {
+		require.Equal(t, specs[i], r.Spec)
+		data, err := os.ReadFile(filepath.Join(dst, fmt.Sprintf("file%d.txt", i)))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("file%d.txt", i), string(data))
+	}
+
+	// All copies are attempted, the error reports the first failure
+	specs[2].Source = FileURL(filepath.Join(src, "missing"))
+	specs[7].Source = FileURL(filepath.Join(src, "missing-too"))
+	res = om.CopyBatch(specs)
+	require.Equal(t, 8, res.Succeeded)
+	require.Equal(t, 2, res.Failed)
+	var copyErr *CopyError
+	require.True(t, errors.As(res.Err(), &copyErr))
+	require.Equal(t, specs[2], copyErr.Spec)
+	require.Equal(t, 2, copyErr.Failed)
+
+	// Copies do not start once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res = om.CopyBatchContext(ctx, specs)
+	require.Equal(t, 10, res.Failed)
+	require.True(t, errors.Is(res.Err(), context.Canceled))
+}
+
+func TestParseCopyManifest(t *testing.T) {
+	specs, err := ParseCopyManifest([]byte(`
+- source: file://tmp/app.tgz
+  destination: s3://bucket/app.tgz
+- source: file://tmp/app.sha256
+  destination: s3://bucket/app.sha256
+`))
+	require.NoError(t, err)
+	require.Equal(t, []CopySpec{
+		{Source: "file://tmp/app.tgz", Destination: "s3://bucket/app.tgz"},
+		{Source: "file://tmp/app.sha256", Destination: "s3://bucket/app.sha256"},
+	}, specs)
+
+	// JSON manifests work too
+	specs, err = ParseCopyManifest([]byte(`[{"source": "file://a", "destination": "file://b"}]`))
+	require.NoError(t, err)
+	require.Len(t, specs, 1)
+
+	_, err = ParseCopyManifest([]byte(`[{"source": "file://a"}]`))
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"sync"
+	"time"
+)
+
+// existsCache keeps the results of PathExists for a short time to avoid
+// checking the same objects again, eg when looking for many artifacts
+// in a destination. Errors are not cached.
+type existsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]existsEntry
+	now     func() time.Time
+}
+
+type existsEntry struct {
+	exists  bool
+	expires time.Time
+}
+
+func newExistsCache(ttl time.Duration) *existsCache {
+	return &existsCache{ttl: ttl, entries: map[string]existsEntry{}, now: time.Now}
+}
+
+// cacheKey returns the key of an object URL, its normalized form when
+// it can be parsed so equivalent URLs share the entry
+func cacheKey(objectURL string) string {
+	if normalized, err := NormalizeURL(objectURL); err == nil {
+		return normalized
+	}
+	return objectURL
+}
+
+// get returns the cached result for an object URL, if not expired
+func (c *existsCache) get(objectURL string) (exists, ok bool) {
+	key := cacheKey(objectURL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	if c.now().After(entry.expires) {
+		delete(c.entries, key)
+		return false, false
+	}
+	return entry.exists, true
+}
+
+// set stores the result of checking an object URL
+func (c *existsCache) set(objectURL string, exists bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(objectURL)] = existsEntry{exists: exists, expires: c.now().Add(c.ttl)}
+}
+
+// invalidate removes the cached result of an object URL, eg after
+// copying to it
+func (c *existsCache) invalidate(objectURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, cacheKey(objectURL))
+}
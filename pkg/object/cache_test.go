@@ -0,0 +1,54 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathExistsCache(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	require.NoError(t, os.WriteFile(src, []byte("data"), os.FileMode(0o644)))
+
+	now := time.Now()
+	om := NewManagerWithOptions(&Options{ExistsCacheTTL: time.Minute})
+	om.exists.now = func() time.Time { return now }
+
+	exists, err := om.PathExists(FileURL(dst))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Results are reused, also for equivalent URLs
+	require.NoError(t, os.WriteFile(dst, []byte("data"), os.FileMode(0o644)))
+	exists, err = om.PathExists("file://" + dst)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// ... until they expire
+	now = now.Add(2 * time.Minute)
+	exists, err = om.PathExists(FileURL(dst))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Copying to an object invalidates its entry
+	require.NoError(t, os.Remove(dst))
+	now = now.Add(2 * time.Minute)
+	exists, err = om.PathExists(FileURL(dst))
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.NoError(t, om.Copy(FileURL(src), FileURL(dst)))
+	exists, err = om.PathExists(FileURL(dst))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Managers without TTL do not cache
+	require.Nil(t, NewManager().exists)
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"sigs.k8s.io/release-utils/hash"
+)
+
+// checksumAlgorithms maps the length of the hex digests found in checksum
+// files to their algorithm
+var checksumAlgorithms = map[int]string{40: "sha1", 64: "sha256", 128: "sha512"}
+
+// ChecksumEntry is a line of a checksum file
+type ChecksumEntry struct {
+	Name      string // File name, empty if the file only has the digest
+	Algorithm string // sha1, sha256 or sha512, guessed from the digest length
+	Digest    string // Hex encoded digest
+}
+
+// ChecksumMismatchError is returned when an object does not match the
+// digest published in its checksum file
+type ChecksumMismatchError struct {
+	URL       string // URL of the object
+	Algorithm string
+	Expected  string // Digest in the checksum file
+	Actual    string // Digest of the object
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s %s is %s, the checksum file expects %s", e.URL, e.Algorithm, e.Actual, e.Expected)
+}
+
+// Is makes the error match ErrChecksumMismatch
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// ParseChecksumFile reads the entries of a checksum file in the format
+// written by sha256sum and friends: one digest per line followed by the
+// file name, which is prefixed with an asterisk in binary mode. Files
+// with a bare digest are supported too.
+func ParseChecksumFile(data []byte) ([]ChecksumEntry, error) {
+	entries := []ChecksumEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		digest := strings.ToLower(fields[0])
+		algo, ok := checksumAlgorithms[len(digest)]
+		if !ok || strings.Trim(digest, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("line %d of checksum file does not start with a digest", n)
+		}
+		entry := ChecksumEntry{Algorithm: algo, Digest: digest}
+		if len(fields) == 2 {
+			entry.Name = strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading checksum file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("checksum file has no entries")
+	}
+	return entries, nil
+}
+
+// LookupChecksum returns the entry of the file name in a checksum file.
+// Names are compared without their directories. A file with a single
+// unnamed entry matches any name.
+func LookupChecksum(entries []ChecksumEntry, name string) (*ChecksumEntry, error) {
+	if len(entries) == 1 && entries[0].Name == "" {
+		return &entries[0], nil
+	}
+	for i := range entries {
+		if path.Base(filepath.ToSlash(entries[i].Name)) == name {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("checksum file has no entry for %s", name)
+}
+
+// FetchChecksum downloads a checksum file and returns the digest it
+// publishes for the object at objectURL, as a digest set
+func (om *Manager) FetchChecksum(objectURL, checksumURL string) (map[string]string, error) {
+	name := backends.ObjectName(objectURL)
+	if name == "" {
+		return nil, fmt.Errorf("unable to look up checksum, %s has no object name", objectURL)
+	}
+
+	dir, err := os.MkdirTemp("", "checksum-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	checksumPath := filepath.Join(dir, "checksums")
+	if err := om.Copy(checksumURL, FileURL(checksumPath)); err != nil {
+		return nil, fmt.Errorf("downloading checksum file %s: %w", checksumURL, err)
+	}
+	data, err := os.ReadFile(checksumPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading checksum file: %w", err)
+	}
+	entries, err := ParseChecksumFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", checksumURL, err)
+	}
+	entry, err := LookupChecksum(entries, name)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", checksumURL, err)
+	}
+	return map[string]string{entry.Algorithm: entry.Digest}, nil
+}
+
+// VerifyChecksum downloads an object and its sidecar checksum file and
+// checks the object matches the published digest. It returns the digest
+// set of the object, or a *ChecksumMismatchError if it does not match.
+func (om *Manager) VerifyChecksum(objectURL, checksumURL string) (map[string]string, error) {
+	expected, err := om.FetchChecksum(objectURL, checksumURL)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "checksum-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	objectPath := filepath.Join(dir, "object")
+	if err := om.Copy(objectURL, FileURL(objectPath)); err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", objectURL, err)
+	}
+
+	fns := map[string]func(string) (string, error){
+		"sha1":   hash.SHA1ForFile,
+		"sha256": hash.SHA256ForFile,
+		"sha512": hash.SHA512ForFile,
+	}
+	for algo, digest := range expected {
+		actual, err := fns[algo](objectPath)
+		if err != nil {
+			return nil, fmt.Errorf("hashing %s: %w", objectURL, err)
+		}
+		if actual != digest {
+			return nil, &ChecksumMismatchError{URL: objectURL, Algorithm: algo, Expected: digest, Actual: actual}
+		}
+	}
+	return expected, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "4b4a0f2fe1f2f5dfcd7468d0f10d6fd3e1fd1f1b6e2af7fbd7ab5fe64d4d0e2f"
+
+func TestParseChecksumFile(t *testing.T) {
+	entries, err := ParseChecksumFile([]byte(
+		"# Release checksums\n" +
+			testDigest + "  mattermost-7.1.0-linux-amd64.tar.gz\n" +
+			testDigest + " *dist/mmctl\n",
+	))
+	require.NoError(t, err)
+	require.Equal(t, []ChecksumEntry{
+		{Name: "mattermost-7.1.0-linux-amd64.tar.gz", Algorithm: "sha256", Digest: testDigest},
+		{Name: "dist/mmctl", Algorithm: "sha256", Digest: testDigest},
+	}, entries)
+
+	// Entries are found by their base name
+	e, err := LookupChecksum(entries, "mmctl")
+	require.NoError(t, err)
+	require.Equal(t, "dist/mmctl", e.Name)
+	_, err = LookupChecksum(entries, "missing.tar.gz")
+	require.Error(t, err)
+
+	// A bare digest matches any file
+	entries, err = ParseChecksumFile([]byte(testDigest + "\n"))
+	require.NoError(t, err)
+	_, err = LookupChecksum(entries, "anything")
+	require.NoError(t, err)
+
+	for _, data := range []string{"", "not-a-digest  file.tgz\n", "abc123  file.tgz\n"} {
+		_, err := ParseChecksumFile([]byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "mattermost.tar.gz")
+	require.NoError(t, os.WriteFile(artifact, []byte("mattermost server\n"), os.FileMode(0o644)))
+	digest, err := NewManager().GetObjectHash(FileURL(artifact))
+	require.NoError(t, err)
+	checksums := filepath.Join(dir, "SHA256SUMS")
+	require.NoError(t, os.WriteFile(
+		checksums, []byte(digest["sha256"]+"  mattermost.tar.gz\n"), os.FileMode(0o644),
+	))
+
+	om := NewManager()
+	hashes, err := om.VerifyChecksum(FileURL(artifact), FileURL(checksums))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"sha256": digest["sha256"]}, hashes)
+
+	// Modified artifacts fail to verify
+	require.NoError(t, os.WriteFile(artifact, []byte("tampered\n"), os.FileMode(0o644)))
+	_, err = om.VerifyChecksum(FileURL(artifact), FileURL(checksums))
+	var mismatch *ChecksumMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	require.Equal(t, digest["sha256"], mismatch.Expected)
+}
@@ -0,0 +1,9 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package object copies files and directories between the filesystem
+// and object stores, addressed by URL.
+//
+// API stability: the exported API of this package is stable (v1) and is
+// recorded in api/v1.txt, the backends it supports can only grow.
+package object
@@ -0,0 +1,33 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors to classify object failures with errors.Is. The typed
+// errors carry the details and can be extracted with errors.As.
+var (
+	ErrNoBackend        = errors.New("no backend enabled for URL")
+	ErrChecksumMismatch = errors.New("object does not match its checksum")
+	ErrCopyFailed       = errors.New("copying objects failed")
+	ErrListUnsupported  = errors.New("backend cannot list objects")
+)
+
+// NoBackendError is returned when none of the enabled backends handles
+// the scheme of an object URL
+type NoBackendError struct {
+	URL string
+}
+
+func (e *NoBackendError) Error() string {
+	return fmt.Sprintf("No backend enabled for URL %s", e.URL)
+}
+
+// Is makes the error match ErrNoBackend
+func (e *NoBackendError) Is(target error) bool {
+	return target == ErrNoBackend
+}
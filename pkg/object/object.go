@@ -1,25 +1,50 @@
 // Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
 // See License.txt for license information.
+
 package object
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/mattermost/cicd-sdk/pkg/object/backends"
-	"github.com/pkg/errors"
+	"github.com/mattermost/cicd-sdk/pkg/trace"
 	"github.com/sirupsen/logrus"
 )
 
 // Manager
 type Manager struct {
-	impl     ManagerImplementation
-	Backends []backends.Backend
+	impl        ManagerImplementation
+	Backends    []backends.Backend
+	Concurrency int // Copies of a batch run at the same time, DefaultCopyConcurrency if zero
+	exists      *existsCache
 }
 
 const URLPrefixFilesystem = "file://"
 
+// Options configure the backends of the object manager
+type Options struct {
+	HTTP *backends.HTTPOptions // Headers and credentials of the HTTP backend
+	S3   *backends.S3Options   // Regions of the S3 buckets
+
+	// ExistsCacheTTL is the time the results of PathExists are cached.
+	// Zero disables the cache.
+	ExistsCacheTTL time.Duration
+}
+
 // NewObjectManager returns a new object manager with default options
 func NewManager() *Manager {
+	return NewManagerWithOptions(&Options{})
+}
+
+// NewManagerWithOptions returns a new object manager with its backends
+// configured from opts
+func NewManagerWithOptions(opts *Options) *Manager {
 	// Return a new object manager. It always includesd a file handler
 	om := &Manager{
 		impl:     &defaultManagerImpl{},
@@ -28,42 +53,93 @@ func NewManager() *Manager {
 	// Add the implemented backends
 	om.Backends = append(om.Backends,
 		backends.NewFilesystemWithOptions(&backends.Options{}),
-		backends.NewS3WithOptions(&backends.Options{}),
+		backends.NewS3WithOptions(&backends.Options{ServiceOptions: opts.S3}),
 		backends.NewGitWithOptions(&backends.Options{}),
-		backends.NewHTTPWithOptions(&backends.Options{}),
+		backends.NewGitArchiveWithOptions(&backends.Options{}),
+		backends.NewHTTPWithOptions(&backends.Options{ServiceOptions: opts.HTTP}),
 	)
+	if opts.ExistsCacheTTL > 0 {
+		om.exists = newExistsCache(opts.ExistsCacheTTL)
+	}
 	return om
 }
 
-// PathExists returns a bool that indicates if a path exists or not
+// PathExists returns a bool that indicates if a path exists or not. If
+// the manager has an exists cache, recent results are reused.
 func (om *Manager) PathExists(path string) (bool, error) {
+	if om.exists != nil {
+		if exists, ok := om.exists.get(path); ok {
+			return exists, nil
+		}
+	}
+
 	pathBackend, err := om.impl.GetURLBackend(om.Backends, path)
 	if err != nil {
-		return false, errors.Wrap(err, "getting URL backend")
+		return false, fmt.Errorf("getting URL backend: %w", err)
 	}
+	if pathBackend == nil {
+		return false, &NoBackendError{URL: path}
+	}
+
+	exists, err := pathBackend.PathExists(path)
+	if err != nil {
+		return false, err
+	}
+	if om.exists != nil {
+		om.exists.set(path, exists)
+	}
+	return exists, nil
+}
+
+// Copy copies an object from a srcURL to a destination URL. If the
+// destination ends with a slash, it is a prefix (or directory) and the
+// object is copied into it keeping the name of the source.
+func (om *Manager) Copy(srcURL, destURL string) error {
+	return om.CopyContext(context.Background(), srcURL, destURL)
+}
 
-	return pathBackend.PathExists(path)
+// traceURL returns a URL without the credentials it may carry, the user
+// info and the query string (eg presigned URLs), to record it in a span
+func traceURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	return u.String()
 }
 
-// Copy copies an object from a srcURL to a destination URL
-func (om *Manager) Copy(srcURL, destURL string) (err error) {
+// CopyContext works like Copy, within a span of the trace in ctx. The
+// backends implementing backends.ContextCopier stop the copy when ctx is
+// done.
+func (om *Manager) CopyContext(ctx context.Context, srcURL, destURL string) (err error) {
+	ctx, span := trace.Start(ctx, "object.copy", trace.String("source", traceURL(srcURL)), trace.String("destination", traceURL(destURL)))
+	defer func() { span.End(err) }()
 	if srcURL == "" {
 		return errors.New("unable to transfer file, no src url defined")
 	}
+	// Copies to a prefix create an object named like the source
+	destURL, err = backends.ResolveDestination(srcURL, destURL)
+	if err != nil {
+		return fmt.Errorf("resolving copy destination: %w", err)
+	}
 	logrus.Infof("Transferring data from %s to %s", srcURL, destURL)
 	srcBackend, err := om.impl.GetURLBackend(om.Backends, srcURL)
 	if err != nil {
-		return errors.Wrap(err, "getting backend for destination URL")
+		return fmt.Errorf("getting backend for destination URL: %w", err)
 	}
 	if srcBackend == nil {
-		return errors.Errorf("No backend enabled for URL %s", srcURL)
+		return &NoBackendError{URL: srcURL}
 	}
 	dstBackend, err := om.impl.GetURLBackend(om.Backends, destURL)
 	if err != nil {
-		return errors.Wrap(err, "getting backend for destination backend")
+		return fmt.Errorf("getting backend for destination backend: %w", err)
 	}
 	if dstBackend == nil {
-		return errors.Errorf("No backend enabled for URL %s", destURL)
+		return &NoBackendError{URL: destURL}
 	}
 
 	// For now, we err no cloud to cloud copy operations
@@ -71,17 +147,65 @@ func (om *Manager) Copy(srcURL, destURL string) (err error) {
 		return errors.New("cloud to cloud operations are not yet supported")
 	}
 
+	// The destination changes, forget if it existed
+	if om.exists != nil {
+		defer om.exists.invalidate(destURL)
+	}
+
+	be := dstBackend
 	if (srcBackend).URLPrefix() != URLPrefixFilesystem {
-		return (srcBackend).CopyObject(srcURL, destURL)
+		be = srcBackend
+	}
+	if copier, ok := be.(backends.ContextCopier); ok {
+		return copier.CopyObjectContext(ctx, srcURL, destURL)
+	}
+	return be.CopyObject(srcURL, destURL)
+}
+
+// CheckWrite returns an error if the backend of a URL knows that writing
+// to it would fail, eg with anonymous S3 requests. It does not write.
+func (om *Manager) CheckWrite(nodeURL string) error {
+	be, err := om.impl.GetURLBackend(om.Backends, nodeURL)
+	if err != nil {
+		return fmt.Errorf("getting backend for URL: %w", err)
+	}
+	if be == nil {
+		return &NoBackendError{URL: nodeURL}
+	}
+	if checker, ok := be.(backends.WriteChecker); ok {
+		return checker.CheckWrite(nodeURL)
+	}
+	return nil
+}
+
+// List returns the objects under a prefix URL, including the ones in
+// nested prefixes, sorted by URL. It fails with ErrListUnsupported if the
+// backend of the URL cannot list objects.
+func (om *Manager) List(prefixURL string) ([]backends.ObjectInfo, error) {
+	be, err := om.impl.GetURLBackend(om.Backends, prefixURL)
+	if err != nil {
+		return nil, fmt.Errorf("getting backend for URL: %w", err)
+	}
+	if be == nil {
+		return nil, &NoBackendError{URL: prefixURL}
+	}
+	lister, ok := be.(backends.Lister)
+	if !ok {
+		return nil, fmt.Errorf("listing %s: %w", prefixURL, ErrListUnsupported)
+	}
+	objects, err := lister.List(prefixURL)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", prefixURL, err)
 	}
-	return (dstBackend).CopyObject(srcURL, destURL)
+	sort.Slice(objects, func(i, j int) bool { return objects[i].URL < objects[j].URL })
+	return objects, nil
 }
 
 // GetObjectHash returns the available hashes for an object
 func (om *Manager) GetObjectHash(objectURL string) (map[string]string, error) {
 	be, err := om.impl.GetURLBackend(om.Backends, objectURL)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting backend for URL")
+		return nil, fmt.Errorf("getting backend for URL: %w", err)
 	}
 	return be.GetObjectHash(objectURL)
 }
@@ -1,9 +1,16 @@
 package object
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/mattermost/cicd-sdk/pkg/object/backends"
+	"github.com/mattermost/cicd-sdk/pkg/trace"
 	"github.com/stretchr/testify/require"
 	"sigs.k8s.io/release-utils/hash"
 )
@@ -31,6 +38,88 @@ func TestCopyLocal(t *testing.T) {
 	require.Equal(t, hash1, hash2)
 }
 
+func TestCopyNoBackend(t *testing.T) {
+	err := NewManager().Copy("nope://bucket/file", "file://tmp/file")
+	require.ErrorIs(t, err, ErrNoBackend)
+	require.EqualError(t, err, "No backend enabled for URL nope://bucket/file")
+}
+
+func TestCopyContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("material data"))
+	}))
+	defer server.Close()
+	rec := trace.NewRecorder()
+	trace.SetTracer(rec)
+	defer trace.SetTracer(nil)
+
+	// The copy is a span, child of the span in the context, and so is
+	// the request of the HTTP backend
+	dest := filepath.Join(t.TempDir(), "material.bin")
+	ctx, span := trace.Start(context.Background(), "test")
+	require.NoError(t, NewManager().CopyContext(ctx, server.URL+"/material.bin", FileURL(dest)))
+	span.End(nil)
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "material data", string(data))
+
+	root, ok := rec.Find("test")
+	require.True(t, ok)
+	copySpan, ok := rec.Find("object.copy")
+	require.True(t, ok)
+	require.Equal(t, root.ID, copySpan.Parent)
+	require.Equal(t, server.URL+"/material.bin", copySpan.Attributes["source"])
+	request, ok := rec.Find("http.GET")
+	require.True(t, ok)
+	require.Equal(t, copySpan.ID, request.Parent)
+	require.Equal(t, "200 OK", request.Attributes["http.status"])
+
+	// Credentials in the URLs are not recorded
+	signed := strings.Replace(server.URL, "://", "://bot:hunter2@", 1) + "/material.bin?X-Amz-Signature=s3cr3t"
+	require.NoError(t, NewManager().Copy(signed, FileURL(dest)))
+	copySpan = rec.Spans()[len(rec.Spans())-1]
+	require.Equal(t, "object.copy", copySpan.Name)
+	require.Equal(t, server.URL+"/material.bin", copySpan.Attributes["source"])
+
+	// Copies stop when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = NewManager().CopyContext(ctx, server.URL+"/material.bin", FileURL(dest))
+	require.ErrorIs(t, err, context.Canceled)
+	copySpan = rec.Spans()[len(rec.Spans())-1]
+	require.Equal(t, "object.copy", copySpan.Name)
+	require.ErrorIs(t, copySpan.Err, context.Canceled)
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), os.FileMode(0o644)))
+	}
+	objects, err := NewManager().List(FileURL(dir) + "/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	require.Equal(t, FileURL(filepath.Join(dir, "a.txt")), objects[0].URL)
+	require.Equal(t, FileURL(filepath.Join(dir, "b.txt")), objects[1].URL)
+
+	// Backends without listing support fail
+	_, err = NewManager().List("https://example.com/builds/")
+	require.ErrorIs(t, err, ErrListUnsupported)
+	_, err = NewManager().List("nope://bucket/")
+	require.ErrorIs(t, err, ErrNoBackend)
+}
+
+func TestCheckWrite(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	om := NewManager()
+	require.NoError(t, om.CheckWrite("file:///tmp/file"))
+	require.ErrorIs(t, om.CheckWrite("s3://bucket/file"), backends.ErrNoCredentials)
+	require.ErrorIs(t, om.CheckWrite("nope://bucket/file"), ErrNoBackend)
+}
+
 func TestCopyS3(t *testing.T) {
 	os.Setenv("AWS_DEFAULT_REGION", "us-east-1")
 	om := NewManager()
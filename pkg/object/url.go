@@ -0,0 +1,133 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// objectURL is an object URL split in its parts. URLs are not parsed
+// with net/url as it would escape the characters in the path, which
+// backends like S3 take literally.
+type objectURL struct {
+	scheme string // Scheme, eg s3 or git+https
+	host   string // Host or bucket, empty in file URLs
+	path   string // Path, always starting with a slash
+	query  string // Query string and fragment, including the ? or #
+}
+
+// splitURL splits an object URL in its parts
+func splitURL(rawURL string) (*objectURL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	i := strings.Index(rawURL, "://")
+	if i <= 0 {
+		return nil, fmt.Errorf("%q is not an object URL, it has no scheme", rawURL)
+	}
+	u := &objectURL{scheme: strings.ToLower(rawURL[:i])}
+	rest := rawURL[i+3:]
+
+	// File URLs have no host, the rest is the path
+	if u.scheme+"://" == URLPrefixFilesystem {
+		u.path = "/" + strings.TrimLeft(rest, "/")
+		return u, nil
+	}
+
+	if j := strings.IndexAny(rest, "?#"); j >= 0 {
+		rest, u.query = rest[:j], rest[j:]
+	}
+	if j := strings.Index(rest, "/"); j >= 0 {
+		rest, u.path = rest[:j], rest[j:]
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("object URL %q has no host", rawURL)
+	}
+	u.host = strings.ToLower(rest)
+	return u, nil
+}
+
+// String returns the URL. File URLs are written as the repository
+// backends expect them: file:// followed by the path without its root.
+func (u *objectURL) String() string {
+	if u.scheme+"://" == URLPrefixFilesystem {
+		return URLPrefixFilesystem + strings.TrimPrefix(u.path, "/")
+	}
+	return u.scheme + "://" + u.host + u.path + u.query
+}
+
+// cleanURLPath cleans a URL path keeping its trailing slash, which marks
+// directories in some backends
+func cleanURLPath(p string) string {
+	if p == "" || p == "/" {
+		return p
+	}
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// NormalizeURL returns the canonical form of an object URL: the scheme
+// and host are lowercased and the path is cleaned of duplicate slashes
+// and dot segments. A trailing slash is kept.
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := splitURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.path = cleanURLPath(u.path)
+	return u.String(), nil
+}
+
+// JoinURL appends path elements to an object URL. Elements are joined
+// with forward slashes in every OS. It fails if the elements would move
+// the path out of the base URL, eg with "..".
+func JoinURL(base string, elem ...string) (string, error) {
+	u, err := splitURL(base)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(elem))
+	for i, e := range elem {
+		parts[i] = filepath.ToSlash(e)
+	}
+	rel := path.Join(parts...)
+	if rel == "" || rel == "." {
+		u.path = cleanURLPath(u.path)
+		return u.String(), nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("joining %q to %s goes out of the base URL", strings.Join(elem, ", "), base)
+	}
+	u.path = cleanURLPath(strings.TrimSuffix(u.path, "/") + "/" + strings.TrimPrefix(rel, "/"))
+	return u.String(), nil
+}
+
+// FileURL returns the object URL of a local path. Relative paths are
+// resolved from the current directory.
+func FileURL(localPath string) string {
+	if abs, err := filepath.Abs(localPath); err == nil {
+		localPath = abs
+	}
+	return URLPrefixFilesystem + strings.TrimPrefix(filepath.ToSlash(localPath), "/")
+}
+
+// ValidateURL checks an object URL is well formed and one of the backends
+// of the manager can handle it
+func (om *Manager) ValidateURL(rawURL string) error {
+	if _, err := splitURL(rawURL); err != nil {
+		return err
+	}
+	backend, err := om.impl.GetURLBackend(om.Backends, strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("getting URL backend: %w", err)
+	}
+	if backend == nil {
+		return &NoBackendError{URL: rawURL}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package object
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, expected string
+		shouldErr     bool
+	}{
+		{"S3://Bucket//dir/./sub/../file.tgz", "s3://bucket/dir/file.tgz", false},
+		{"s3://bucket/dir/", "s3://bucket/dir/", false},
+		{"s3://bucket", "s3://bucket", false},
+		{"https://example.com/a//b?x=1&y=2", "https://example.com/a/b?x=1&y=2", false},
+		{"git+https://github.com/mattermost/cicd-sdk", "git+https://github.com/mattermost/cicd-sdk", false},
+		{"file://tmp//dir/file", "file://tmp/dir/file", false},
+		{"file:///tmp/dir/file", "file://tmp/dir/file", false},
+		{"s3://bucket/dir with spaces/${MMBUILD_STAGEPATH}", "s3://bucket/dir with spaces/${MMBUILD_STAGEPATH}", false},
+		{"/tmp/file", "", true},
+		{"s3:///dir", "", true},
+	} {
+		res, err := NormalizeURL(tc.url)
+		if tc.shouldErr {
+			require.Error(t, err, tc.url)
+			continue
+		}
+		require.NoError(t, err, tc.url)
+		require.Equal(t, tc.expected, res, tc.url)
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	for _, tc := range []struct {
+		base      string
+		elem      []string
+		expected  string
+		shouldErr bool
+	}{
+		{"s3://bucket/dir", []string{"stage", "file.tgz"}, "s3://bucket/dir/stage/file.tgz", false},
+		{"s3://bucket/dir/", []string{"/stage/", "sub/file.tgz"}, "s3://bucket/dir/stage/sub/file.tgz", false},
+		{"s3://bucket", []string{"file.tgz"}, "s3://bucket/file.tgz", false},
+		{"https://example.com/repo?token=x", []string{"file"}, "https://example.com/repo/file?token=x", false},
+		{"file://tmp/out", []string{"a", "b"}, "file://tmp/out/a/b", false},
+		{"s3://bucket/dir", []string{}, "s3://bucket/dir", false},
+		{"s3://bucket/dir", []string{"sub/../file"}, "s3://bucket/dir/file", false},
+		{"s3://bucket/dir", []string{"../other"}, "", true},
+		{"s3://bucket/dir", []string{"sub", "../../other"}, "", true},
+		{"bucket/dir", []string{"file"}, "", true},
+	} {
+		res, err := JoinURL(tc.base, tc.elem...)
+		if tc.shouldErr {
+			require.Error(t, err, tc.base)
+			continue
+		}
+		require.NoError(t, err, tc.base)
+		require.Equal(t, tc.expected, res, tc.base)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	require.Equal(t, "file://tmp/dir/file", FileURL("/tmp/dir/file"))
+}
+
+func TestValidateURL(t *testing.T) {
+	om := NewManager()
+	require.NoError(t, om.ValidateURL("s3://bucket/dir"))
+	require.NoError(t, om.ValidateURL("https://example.com/file"))
+	require.NoError(t, om.ValidateURL("file://tmp/file"))
+	require.Error(t, om.ValidateURL("ftp://example.com/file"))
+	require.Error(t, om.ValidateURL("example.com/file"))
+}
@@ -0,0 +1,97 @@
+package replacement
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setFile is the format of a stand-alone replacements file
+type setFile struct {
+	Replacements []struct {
+		Tag           string   `yaml:"tag"`
+		Value         string   `yaml:"value"`
+		Paths         []string `yaml:"paths"`
+		Required      bool     `yaml:"required"`
+		RequiredPaths bool     `yaml:"requiredPaths"`
+		NoSymlinks    bool     `yaml:"noSymlinks"`
+		ValueFrom     struct {
+			Env string `yaml:"env"`
+		} `yaml:"valueFrom"`
+	} `yaml:"replacements"`
+}
+
+// LoadSet reads a set of replacements from a YAML file, for uses of the
+// replacements outside of a build like cutting a branch or bumping the
+// version in the docs. The paths of the replacements are relative to the
+// directory of the file.
+func LoadSet(path string) (Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading replacements file: %w", err)
+	}
+	s, err := ParseSet(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolving replacements directory: %w", err)
+	}
+	for i := range s {
+		s[i].Workdir = dir
+	}
+	return s, nil
+}
+
+// ParseSet parses a set of replacements from YAML data:
+//
+//	replacements:
+//	  - tag: "%VERSION%"
+//	    valueFrom:
+//	      env: VERSION
+//	    paths: ["version.go", "docs/install.md"]
+//	    required: true
+//
+// Values can be set in the file or read from an environment variable.
+// The set is checked for tag collisions.
+func ParseSet(data []byte) (Set, error) {
+	f := &setFile{}
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("unmarshaling replacements: %w", err)
+	}
+	s := Set{}
+	for i, r := range f.Replacements {
+		if r.Tag == "" {
+			return nil, fmt.Errorf("replacement #%d: %w", i, errNoTag)
+		}
+		value := r.Value
+		if r.ValueFrom.Env != "" {
+			if r.Value != "" {
+				return nil, fmt.Errorf("replacement #%d sets a value and a value source", i)
+			}
+			v, ok := os.LookupEnv(r.ValueFrom.Env)
+			if !ok {
+				return nil, fmt.Errorf("replacement #%d value variable %s is not set", i, r.ValueFrom.Env)
+			}
+			value = v
+		}
+		rep := Replacement{
+			Tag:           r.Tag,
+			Value:         value,
+			Paths:         r.Paths,
+			Required:      r.Required,
+			PathsRequired: r.RequiredPaths,
+		}
+		if r.NoSymlinks {
+			rep.Symlinks = SymlinksRefuse
+		}
+		s = append(s, rep)
+	}
+	if err := s.CheckCollisions(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
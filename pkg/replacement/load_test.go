@@ -0,0 +1,48 @@
+package replacement
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSet(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "install.md"), []byte("Install %VERSION% from %BRANCH%\n"), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "replacements.yaml"), []byte(`replacements:
+  - tag: "%VERSION%"
+    valueFrom:
+      env: TEST_VERSION
+    paths: ["docs/install.md"]
+    required: true
+  - tag: "%BRANCH%"
+    value: release-7.1
+    paths: ["docs/install.md"]
+`), os.FileMode(0o644)))
+	t.Setenv("TEST_VERSION", "7.1.0")
+
+	// Paths are relative to the file and values are read from the environment
+	s, err := LoadSet(filepath.Join(dir, "replacements.yaml"))
+	require.NoError(t, err)
+	require.Len(t, s, 2)
+	require.Equal(t, "7.1.0", s[0].Value)
+	require.True(t, s[0].Required)
+	require.NoError(t, s.Apply())
+	data, err := os.ReadFile(filepath.Join(dir, "docs", "install.md"))
+	require.NoError(t, err)
+	require.Equal(t, "Install 7.1.0 from release-7.1\n", string(data))
+
+	for i, tc := range []string{
+		"replacements:\n  - value: x\n", // No tag
+		"replacements:\n  - tag: X\n    value: x\n    valueFrom:\n      env: TEST_VERSION\n", // Value and source
+		"replacements:\n  - tag: X\n    valueFrom:\n      env: TEST_UNSET_VARIABLE\n",        // Variable not set
+		"replacements:\n  - tag: X\n    paths: [a]\n  - tag: X\n    paths: [a]\n",            // Tag collision
+		"replacements: [",
+	} {
+		_, err := ParseSet([]byte(tc))
+		require.Error(t, err, "test case #%d", i)
+	}
+}
@@ -3,10 +3,15 @@ package replacement
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -14,8 +19,33 @@ const (
 	maxScanSize = 3145728
 )
 
+// TagDelimiter encloses the tags that follow the delimiter convention,
+// eg %VERSION%. Delimited tags cannot be found inside one another.
+const TagDelimiter = "%"
+
 var errNoTag = errors.New("the replacement has no tag defined")
 
+// ErrSymlink is returned when a path of a replacement that refuses
+// symlinks is a symbolic link
+var ErrSymlink = errors.New("path is a symbolic link")
+
+// ErrOutsideWorkdir is returned when a path of a replacement, or the file
+// a symbolic link points to, is not inside the replacement Workdir
+var ErrOutsideWorkdir = errors.New("path is outside the working directory")
+
+// SymlinkMode controls what a replacement does with paths that are
+// symbolic links
+type SymlinkMode int
+
+const (
+	SymlinksFollow SymlinkMode = iota // Replace the tag in the file the link points to, if it is inside the Workdir
+	SymlinksRefuse                    // Fail with ErrSymlink
+)
+
+// ErrAlreadyApplied is returned when a replacement with FailOnReapply set
+// finds it was already applied to a file
+var ErrAlreadyApplied = errors.New("replacement already applied")
+
 // Replacements
 type Replacement struct {
 	Tag           string
@@ -23,30 +53,243 @@ type Replacement struct {
 	Paths         []string
 	PathsRequired bool // If true, the replacement will fail if path is not found
 	Required      bool
-	Workdir       string
+	Secret        bool        // The value comes from a secret, it must not appear in the artifacts
+	Workdir       string      // Directory the paths are relative to. When set, files outside of it are never modified
+	Symlinks      SymlinkMode // What to do with paths that are symbolic links. Defaults to following them
+	StateFile     string      // File recording the applied replacements, relative to Workdir. Replacements found in it are not applied twice
+	FailOnReapply bool        // Fail with ErrAlreadyApplied instead of skipping replacements recorded in the state file
+}
+
+// State is the content of a replacements state file. It records the tags
+// replaced in each file and the digest of the file after the last
+// replacement, so running them again on the unchanged file is detected.
+type State struct {
+	Applied []AppliedReplacement `json:"applied"`
+}
+
+// AppliedReplacement is a replacement recorded in a state file
+type AppliedReplacement struct {
+	Tag    string `json:"tag"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // Digest of the file after the replacement
+}
+
+// find returns the record of tag replaced in path, or nil
+func (st *State) find(tag, path string) *AppliedReplacement {
+	for i := range st.Applied {
+		if st.Applied[i].Tag == tag && st.Applied[i].Path == path {
+			return &st.Applied[i]
+		}
+	}
+	return nil
+}
+
+// statePath returns the path of the state file
+func (r *Replacement) statePath() string {
+	return filepath.Join(r.Workdir, r.StateFile)
+}
+
+// readState reads the state file of the replacement. A missing file is
+// an empty state.
+func (r *Replacement) readState() (*State, error) {
+	st := &State{Applied: []AppliedReplacement{}}
+	data, err := os.ReadFile(r.statePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		return nil, fmt.Errorf("reading replacements state file: %w", err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("parsing replacements state file %s: %w", r.StateFile, err)
+	}
+	return st, nil
+}
+
+// writeState writes the state file of the replacement
+func (r *Replacement) writeState(st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling replacements state: %w", err)
+	}
+	if err := os.WriteFile(r.statePath(), data, os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing replacements state file: %w", err)
+	}
+	return nil
 }
 
 type Set []Replacement
 
+// IsDelimited returns true if the tag follows the delimiter convention
+func IsDelimited(tag string) bool {
+	return len(tag) > 2*len(TagDelimiter) &&
+		strings.HasPrefix(tag, TagDelimiter) && strings.HasSuffix(tag, TagDelimiter) &&
+		!strings.Contains(tag[len(TagDelimiter):len(tag)-len(TagDelimiter)], TagDelimiter)
+}
+
+// Sorted returns the replacements ordered by tag length, longest first.
+// Applying them in this order replaces a tag before any shorter tag
+// found inside it. Replacements with tags of the same length keep their
+// order.
+func (s Set) Sorted() Set {
+	sorted := append(Set(nil), s...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Tag) > len(sorted[j].Tag)
+	})
+	return sorted
+}
+
+// Apply applies the replacements of the set, longest tag first
+func (s Set) Apply() error {
+	_, err := s.ApplyChanges()
+	return err
+}
+
+// ApplyChanges applies the replacements of the set, longest tag first,
+// and returns the changes they made, in order
+func (s Set) ApplyChanges() ([]Change, error) {
+	changes := []Change{}
+	sorted := s.Sorted()
+	for i := range sorted {
+		r := &sorted[i]
+		c, err := r.ApplyChanges()
+		if err != nil {
+			return nil, fmt.Errorf("applying replacement of %s: %w", r.Tag, err)
+		}
+		changes = append(changes, c...)
+	}
+	return changes, nil
+}
+
+// CheckCollisions returns an error if two replacements modifying the same
+// path have the same tag, as only the first one applied would replace it.
+// Tags found inside other ones are not collisions, the longest tag is
+// applied first.
+func (s Set) CheckCollisions() error {
+	for i := range s {
+		for j := i + 1; j < len(s); j++ {
+			if s[i].Tag == "" || s[i].Tag != s[j].Tag {
+				continue
+			}
+			if path, ok := s[i].sharedPath(&s[j]); ok {
+				return fmt.Errorf(
+					"replacement tag %q is defined twice for %s", s[i].Tag, path,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// checkInWorkdir returns ErrOutsideWorkdir if the file modified when
+// replacing path, after following its symbolic links, is not inside the
+// workdir of the replacement. Missing paths are checked when opened.
+func (r *Replacement) checkInWorkdir(path string) error {
+	if r.Workdir == "" {
+		return nil
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("resolving path %s: %w", path, err)
+	}
+	root, err := filepath.EvalSymlinks(r.Workdir)
+	if err != nil {
+		return fmt.Errorf("resolving working directory: %w", err)
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: %w", path, ErrOutsideWorkdir)
+	}
+	return nil
+}
+
+// sharedPath returns a path modified by both replacements, if any
+func (r *Replacement) sharedPath(other *Replacement) (string, bool) {
+	for _, p := range r.Paths {
+		for _, op := range other.Paths {
+			if filepath.Join(r.Workdir, p) == filepath.Join(other.Workdir, op) {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Change is a file modified by a replacement
+type Change struct {
+	Tag    string `json:"tag"`    // Tag of the replacement
+	Path   string `json:"path"`   // Path of the file, as defined in the replacement
+	Before string `json:"before"` // SHA256 digest of the file before the replacement
+	After  string `json:"after"`  // SHA256 digest of the file after the replacement
+}
+
 func (r *Replacement) Apply() (err error) {
+	_, err = r.replace(true)
+	return err
+}
+
+// ApplyChanges applies the replacement and returns the files it modified
+// with their digests before and after
+func (r *Replacement) ApplyChanges() ([]Change, error) {
+	return r.replace(true)
+}
+
+// Plan checks the replacement can be applied and returns the paths it
+// would modify, without writing them
+func (r *Replacement) Plan() (paths []string, err error) {
+	changes, err := r.replace(false)
+	if err != nil {
+		return nil, err
+	}
+	paths = []string{}
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	return paths, nil
+}
+
+// replace substitutes the tag in the replacement paths, returning the
+// changes to the files where it was found. The files are only modified if
+// write is true.
+func (r *Replacement) replace(write bool) (modified []Change, err error) {
 	if r.Tag == "" {
-		return errNoTag
+		return nil, errNoTag
 	}
+	modified = []Change{}
 
-	for _, path := range r.Paths {
-		logrus.Infof("Replacing tags in %s", path)
+	var state *State
+	if r.StateFile != "" {
+		state, err = r.readState()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rpath := range r.Paths {
+		logrus.Infof("Replacing tags in %s", rpath)
+		path := rpath
 		if r.Workdir != "" {
-			path = filepath.Join(r.Workdir, path)
+			path = filepath.Join(r.Workdir, rpath)
+		}
+		linkData, err := os.Lstat(path)
+		if err == nil && linkData.Mode()&os.ModeSymlink != 0 && r.Symlinks == SymlinksRefuse {
+			return nil, fmt.Errorf("%s: %w", path, ErrSymlink)
+		}
+		if err := r.checkInWorkdir(path); err != nil {
+			return nil, err
 		}
 		fileData, err := os.Stat(path)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				if r.PathsRequired {
-					return errors.Errorf("required path %s not found", path)
+					return nil, fmt.Errorf("required path %s not found", path)
 				}
 				continue
 			} else {
-				return errors.Wrapf(err, "while checking path %s", path)
+				return nil, fmt.Errorf("while checking path %s: %w", path, err)
 			}
 		}
 
@@ -57,27 +300,95 @@ func (r *Replacement) Apply() (err error) {
 
 		fileContents, err := os.ReadFile(path)
 		if err != nil {
-			return errors.Wrap(err, "opening file to replace tags")
+			return nil, fmt.Errorf("opening file to replace tags: %w", err)
 		}
 		originalSum := sha256.Sum256(fileContents)
 
+		// Skip the file if the state records this same replacement
+		if state != nil {
+			if applied := state.find(r.Tag, rpath); applied != nil && applied.SHA256 == hex.EncodeToString(originalSum[:]) {
+				if r.FailOnReapply {
+					return nil, fmt.Errorf("replacing %s in %s: %w", r.Tag, rpath, ErrAlreadyApplied)
+				}
+				logrus.Infof("Tag '%s' was already replaced in %s, skipping", r.Tag, rpath)
+				continue
+			}
+		}
+
 		newData := bytes.ReplaceAll(fileContents, []byte(r.Tag), []byte(r.Value))
 		newSum := sha256.Sum256(newData)
 
 		// Check if anything was modified
 		if newSum == originalSum {
 			if r.Required {
-				return errors.New("replacement is required, but no data was modified")
+				return nil, errors.New("replacement is required, but no data was modified")
 			}
 			logrus.Debugf("No data modified for tag '%s' in path %s", r.Tag, path)
 			continue
 		}
 
+		modified = append(modified, Change{
+			Tag: r.Tag, Path: rpath,
+			Before: hex.EncodeToString(originalSum[:]), After: hex.EncodeToString(newSum[:]),
+		})
+		if !write {
+			continue
+		}
+
 		// Write the modified data
-		if err := os.WriteFile(path, newData, fileData.Mode()); err != nil {
-			return errors.Wrap(err, "writing replaced file")
+		if err := writeInPlace(path, newData, fileData); err != nil {
+			return nil, fmt.Errorf("writing replaced file: %w", err)
+		}
+
+		// Record the new digest of the file. Replacements recorded with
+		// the digest it had before are still applied in the new data.
+		if state != nil {
+			digest := hex.EncodeToString(newSum[:])
+			for i := range state.Applied {
+				if state.Applied[i].Path == rpath && state.Applied[i].SHA256 == hex.EncodeToString(originalSum[:]) {
+					state.Applied[i].SHA256 = digest
+				}
+			}
+			if applied := state.find(r.Tag, rpath); applied != nil {
+				applied.SHA256 = digest
+			} else {
+				state.Applied = append(state.Applied, AppliedReplacement{Tag: r.Tag, Path: rpath, SHA256: digest})
+			}
+			if err := r.writeState(state); err != nil {
+				return nil, err
+			}
 		}
 	}
+	return modified, nil
+}
+
+// writeInPlace overwrites the contents of the file at path, keeping its
+// inode so the owner, extended attributes and hard links are preserved.
+// Read only files are made writable for the owner while they are written
+// and get their original mode back after.
+func writeInPlace(path string, data []byte, info os.FileInfo) (err error) {
+	mode := info.Mode().Perm()
+	if mode&0o200 == 0 {
+		if err := os.Chmod(path, mode|0o200); err != nil {
+			return fmt.Errorf("making file writable: %w", err)
+		}
+		defer func() {
+			if cerr := os.Chmod(path, info.Mode()); cerr != nil && err == nil {
+				err = fmt.Errorf("restoring file mode: %w", cerr)
+			}
+		}()
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("writing file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
+	}
 	return nil
 }
 
@@ -89,7 +400,7 @@ func (r *Replacement) IsPathReplaced(path string) (bool, error) {
 
 	fileContents, err := os.ReadFile(path)
 	if err != nil {
-		return false, errors.Wrap(err, "opening file to replace tags")
+		return false, fmt.Errorf("opening file to replace tags: %w", err)
 	}
 
 	return !bytes.Contains(fileContents, []byte(r.Tag)), nil
@@ -107,11 +418,11 @@ func (r *Replacement) Check() (bool, error) {
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				if r.PathsRequired {
-					return false, errors.Errorf("required path %s not found", path)
+					return false, fmt.Errorf("required path %s not found", path)
 				}
 				continue
 			} else {
-				return false, errors.Wrapf(err, "while checking path %s", path)
+				return false, fmt.Errorf("while checking path %s: %w", path, err)
 			}
 		}
 
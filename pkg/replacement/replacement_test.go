@@ -1,8 +1,10 @@
 package replacement
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -130,6 +132,33 @@ func TestCheck(t *testing.T) {
 	require.True(t, res)
 }
 
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/tagged.txt", []byte(replacementTestText), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(dir+"/clean.txt", []byte("Nothing to see here\n"), os.FileMode(0o644)))
+	r := Replacement{
+		Tag:     "TEST",
+		Value:   "modified",
+		Paths:   []string{"tagged.txt", "clean.txt", "missing.txt"},
+		Workdir: dir,
+	}
+
+	// Only the files with the tag would be modified
+	paths, err := r.Plan()
+	require.NoError(t, err)
+	require.Equal(t, []string{"tagged.txt"}, paths)
+
+	// Planning does not modify the files
+	data, err := os.ReadFile(dir + "/tagged.txt")
+	require.NoError(t, err)
+	require.Equal(t, replacementTestText, string(data))
+
+	// Plans fail like the replacement would
+	r.PathsRequired = true
+	_, err = r.Plan()
+	require.Error(t, err)
+}
+
 func TestCorruption(t *testing.T) {
 	// Create a file with a string
 	f, err := os.CreateTemp("", "temp-replacer-test-")
@@ -153,3 +182,144 @@ func TestCorruption(t *testing.T) {
 	require.NoError(t, err, "reading replaced data")
 	require.Equal(t, []byte("In my experience,\nthere's no such thing as luck.\n"), rdata)
 }
+
+func TestSetOrder(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/version.txt", []byte("VERSION_MAJOR.VERSION\n"), os.FileMode(0o644)))
+
+	// The longest tag is replaced first, whatever the order of the set
+	s := Set{
+		{Tag: "VERSION", Value: "7.1.0", Paths: []string{"version.txt"}, Workdir: dir},
+		{Tag: "VERSION_MAJOR", Value: "7", Paths: []string{"version.txt"}, Workdir: dir},
+	}
+	require.Equal(t, "VERSION_MAJOR", s.Sorted()[0].Tag)
+	require.Equal(t, "VERSION", s[0].Tag)
+	require.NoError(t, s.Apply())
+	data, err := os.ReadFile(dir + "/version.txt")
+	require.NoError(t, err)
+	require.Equal(t, "7.7.1.0\n", string(data))
+}
+
+func TestCheckCollisions(t *testing.T) {
+	for i, tc := range []struct {
+		set         Set
+		shouldError bool
+	}{
+		// Overlapping tags in the same file are applied longest first
+		{Set{{Tag: "VERSION", Paths: []string{"a.txt"}}, {Tag: "VERSION_MAJOR", Paths: []string{"b.txt", "a.txt"}}}, false},
+		// The same tag twice
+		{Set{{Tag: "VERSION", Paths: []string{"a.txt"}}, {Tag: "VERSION", Paths: []string{"./a.txt"}}}, true},
+		// The same tag in different files
+		{Set{{Tag: "VERSION", Paths: []string{"a.txt"}}, {Tag: "VERSION", Paths: []string{"b.txt"}}}, false},
+		// Different tags in the same file
+		{Set{{Tag: "%VERSION%", Paths: []string{"a.txt"}}, {Tag: "%VERSION_MAJOR%", Paths: []string{"a.txt"}}}, false},
+	} {
+		err := tc.set.CheckCollisions()
+		if tc.shouldError {
+			require.Error(t, err, fmt.Sprintf("test case #%d", i))
+		} else {
+			require.NoError(t, err, fmt.Sprintf("test case #%d", i))
+		}
+	}
+}
+
+func TestIsDelimited(t *testing.T) {
+	require.True(t, IsDelimited("%VERSION%"))
+	require.False(t, IsDelimited("VERSION"))
+	require.False(t, IsDelimited("%VERSION"))
+	require.False(t, IsDelimited("%%"))
+	require.False(t, IsDelimited("%VER%SION%"))
+}
+
+func TestStateFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/version.txt", []byte("%MAJOR%.%MINOR%\n"), os.FileMode(0o644)))
+	s := Set{
+		{Tag: "%MAJOR%", Value: "7", Paths: []string{"version.txt"}, Required: true, Workdir: dir, StateFile: "state.json"},
+		{Tag: "%MINOR%", Value: "1", Paths: []string{"version.txt"}, Required: true, Workdir: dir, StateFile: "state.json"},
+	}
+	require.NoError(t, s.Apply())
+	require.FileExists(t, dir+"/state.json")
+
+	// Applying the required replacements again skips them
+	require.NoError(t, s.Apply())
+	data, err := os.ReadFile(dir + "/version.txt")
+	require.NoError(t, err)
+	require.Equal(t, "7.1\n", string(data))
+
+	// Or fails if the replacements cannot be reapplied
+	s[0].FailOnReapply = true
+	err = s[0].Apply()
+	require.True(t, errors.Is(err, ErrAlreadyApplied))
+
+	// Files modified after the replacement are processed again
+	require.NoError(t, os.WriteFile(dir+"/version.txt", []byte("%MAJOR%.%MINOR%\n"), os.FileMode(0o644)))
+	require.NoError(t, s.Apply())
+	data, err = os.ReadFile(dir + "/version.txt")
+	require.NoError(t, err)
+	require.Equal(t, "7.1\n", string(data))
+
+	// Without the state file, reapplying fails the required replacements
+	s = Set{{Tag: "%MAJOR%", Value: "7", Paths: []string{"version.txt"}, Required: true, Workdir: dir}}
+	require.Error(t, s.Apply())
+}
+
+func TestApplyReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/version.txt"
+	require.NoError(t, os.WriteFile(path, []byte("VERSION\n"), os.FileMode(0o644)))
+	require.NoError(t, os.Chmod(path, os.FileMode(0o444)))
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// Read only files are replaced and keep their mode and inode
+	r := Replacement{Tag: "VERSION", Value: "7.1.0", Paths: []string{"version.txt"}, Workdir: dir}
+	require.NoError(t, r.Apply())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "7.1.0\n", string(data))
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o444), after.Mode().Perm())
+	require.True(t, os.SameFile(before, after))
+}
+
+func TestApplySymlinks(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/target.txt", []byte("VERSION\n"), os.FileMode(0o644)))
+	require.NoError(t, os.Symlink("target.txt", dir+"/link.txt"))
+	r := Replacement{Tag: "VERSION", Value: "7.1.0", Paths: []string{"link.txt"}, Workdir: dir}
+
+	// Links can be refused
+	r.Symlinks = SymlinksRefuse
+	require.True(t, errors.Is(r.Apply(), ErrSymlink))
+	_, err := r.Plan()
+	require.True(t, errors.Is(err, ErrSymlink))
+
+	// By default the target is replaced and the link is kept
+	r.Symlinks = SymlinksFollow
+	require.NoError(t, r.Apply())
+	data, err := os.ReadFile(dir + "/target.txt")
+	require.NoError(t, err)
+	require.Equal(t, "7.1.0\n", string(data))
+	info, err := os.Lstat(dir + "/link.txt")
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	// Files outside of the workdir are never modified, through a link
+	// or a relative path
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(outside+"/passwd", []byte("VERSION\n"), os.FileMode(0o644)))
+	require.NoError(t, os.Symlink(outside+"/passwd", dir+"/escape.txt"))
+	rel, err := filepath.Rel(dir, outside+"/passwd")
+	require.NoError(t, err)
+	for _, path := range []string{"escape.txt", rel} {
+		r := Replacement{Tag: "VERSION", Value: "7.1.0", Paths: []string{path}, Workdir: dir}
+		require.True(t, errors.Is(r.Apply(), ErrOutsideWorkdir), path)
+		_, err = r.Plan()
+		require.True(t, errors.Is(err, ErrOutsideWorkdir), path)
+	}
+	data, err = os.ReadFile(outside + "/passwd")
+	require.NoError(t, err)
+	require.Equal(t, "VERSION\n", string(data))
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package snapshot records the state of the files of a directory tree, to
+// find out what changed in it. The build uses it to discover the artifacts
+// produced by a run. Snapshots of large trees are cheap without digests;
+// with them, Update only hashes the files whose metadata changed.
+//
+// API stability: experimental, the API may change in minor versions.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHashConcurrency is the number of files hashed at the same time
+// when the options do not define it
+const DefaultHashConcurrency = 8
+
+// Entry is the state of a file in a snapshot
+type Entry struct {
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"modTime"`
+	Mode    fs.FileMode `json:"mode"`
+	SHA256  string      `json:"sha256,omitempty"` // Digest of the contents, only set when hashing
+	Link    string      `json:"link,omitempty"`   // Target of a symbolic link
+}
+
+// Options control what a snapshot records
+type Options struct {
+	Paths       []string // Directories or files to record, relative to the root. The whole root when empty
+	Exclude     []string // Patterns of names of files and directories skipped, eg .git or *.log
+	Hash        bool     // Compute the SHA256 of the regular files
+	Concurrency int      // Number of files hashed at the same time. Defaults to DefaultHashConcurrency
+}
+
+// Snapshot records the files under a directory at a point in time
+type Snapshot struct {
+	Root    string           `json:"root"`
+	Time    time.Time        `json:"time"`
+	Hashed  bool             `json:"hashed"`  // True if the entries have their SHA256
+	Entries map[string]Entry `json:"entries"` // Files by path relative to the root, with forward slashes
+}
+
+// Take records the files under root. Paths that do not exist are
+// skipped, so a snapshot can include directories the build will create.
+func Take(root string, opts *Options) (*Snapshot, error) {
+	return take(root, opts, nil)
+}
+
+// Update takes a new snapshot of the same root reusing the digests of the
+// files whose size, modification time and mode did not change, so only
+// the modified files are hashed again.
+func (s *Snapshot) Update(opts *Options) (*Snapshot, error) {
+	return take(s.Root, opts, s)
+}
+
+func take(root string, opts *Options, prev *Snapshot) (*Snapshot, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &Snapshot{
+		Root:    root,
+		Time:    time.Now(),
+		Hashed:  opts.Hash,
+		Entries: map[string]Entry{},
+	}
+	paths := opts.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	toHash := []string{}
+	for _, p := range paths {
+		start := filepath.Join(root, p)
+		if _, err := os.Lstat(start); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != start && excluded(d.Name(), opts.Exclude) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			e := Entry{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+			if info.Mode()&fs.ModeSymlink != 0 {
+				if e.Link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			}
+			if opts.Hash && info.Mode().IsRegular() {
+				if old, ok := prev.entry(rel); ok && old.SHA256 != "" && sameState(old, e) {
+					e.SHA256 = old.SHA256
+				} else {
+					toHash = append(toHash, rel)
+				}
+			}
+			s.Entries[rel] = e
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("walking %s: %w", p, err)
+		}
+	}
+
+	if err := s.hash(toHash, opts.Concurrency); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hash computes the digests of the files, several at a time
+func (s *Snapshot) hash(paths []string, workers int) error {
+	if workers <= 0 {
+		workers = DefaultHashConcurrency
+	}
+	digests := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			digests[i], errs[i] = fileDigest(filepath.Join(s.Root, filepath.FromSlash(paths[i])))
+		}(i)
+	}
+	wg.Wait()
+	for i, path := range paths {
+		if errs[i] != nil {
+			return fmt.Errorf("hashing %s: %w", path, errs[i])
+		}
+		e := s.Entries[path]
+		e.SHA256 = digests[i]
+		s.Entries[path] = e
+	}
+	return nil
+}
+
+// Paths returns the paths of the files in the snapshot, sorted
+func (s *Snapshot) Paths() []string {
+	paths := make([]string, 0, len(s.Entries))
+	for p := range s.Entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *Snapshot) entry(path string) (Entry, bool) {
+	if s == nil {
+		return Entry{}, false
+	}
+	e, ok := s.Entries[path]
+	return e, ok
+}
+
+// Diff are the differences between two snapshots. Paths are sorted.
+type Diff struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// Diff compares the snapshot with a later one. When both have digests,
+// files are modified if their contents changed. Otherwise, if their size,
+// modification time, mode or link target changed.
+func (s *Snapshot) Diff(later *Snapshot) *Diff {
+	d := &Diff{Added: []string{}, Modified: []string{}, Removed: []string{}}
+	useHash := s.Hashed && later.Hashed
+	for path, e := range later.Entries {
+		old, ok := s.Entries[path]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, path)
+		case useHash && (old.SHA256 != e.SHA256 || old.Link != e.Link || old.Mode != e.Mode):
+			d.Modified = append(d.Modified, path)
+		case !useHash && !sameState(old, e):
+			d.Modified = append(d.Modified, path)
+		}
+	}
+	for path := range s.Entries {
+		if _, ok := later.Entries[path]; !ok {
+			d.Removed = append(d.Removed, path)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Modified)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// Changed returns the paths added or modified, sorted
+func (d *Diff) Changed() []string {
+	changed := append(append([]string{}, d.Added...), d.Modified...)
+	sort.Strings(changed)
+	return changed
+}
+
+// Empty returns true if the snapshots have the same files
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Removed) == 0
+}
+
+// sameState returns true if the file metadata did not change
+func sameState(a, b Entry) bool {
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime) && a.Mode == b.Mode && a.Link == b.Link
+}
+
+// excluded returns true if the name matches one of the patterns
+func excluded(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t testing.TB, root, path, content string) {
+	full := filepath.Join(root, filepath.FromSlash(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(full, []byte(content), os.FileMode(0o644)))
+}
+
+func TestTake(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "dist/app.tar.gz", "app")
+	writeFile(t, root, "src/main.go", "package main")
+	writeFile(t, root, ".git/HEAD", "ref: refs/heads/main")
+	writeFile(t, root, "build.log", "log")
+	require.NoError(t, os.Symlink("app.tar.gz", filepath.Join(root, "dist", "latest.tar.gz")))
+
+	s, err := Take(root, &Options{Exclude: []string{".git", "*.log"}, Hash: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"dist/app.tar.gz", "dist/latest.tar.gz", "src/main.go"}, s.Paths())
+	require.Equal(t, "a172cedcae47474b615c54d510a5d84a8dea3032e958587430b413538be3f333", s.Entries["dist/app.tar.gz"].SHA256)
+	require.Equal(t, int64(3), s.Entries["dist/app.tar.gz"].Size)
+	require.Equal(t, "app.tar.gz", s.Entries["dist/latest.tar.gz"].Link)
+	require.Empty(t, s.Entries["dist/latest.tar.gz"].SHA256)
+
+	// Only the paths set are recorded, missing ones are skipped
+	s, err = Take(root, &Options{Paths: []string{"dist", "bin"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"dist/app.tar.gz", "dist/latest.tar.gz"}, s.Paths())
+	require.Empty(t, s.Entries["dist/app.tar.gz"].SHA256)
+}
+
+func TestDiff(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "same.txt", "same")
+	writeFile(t, root, "touched.txt", "touched")
+	writeFile(t, root, "changed.txt", "v1")
+	writeFile(t, root, "removed.txt", "removed")
+
+	for _, hash := range []bool{false, true} {
+		before, err := Take(root, &Options{Hash: hash})
+		require.NoError(t, err)
+
+		later := time.Now().Add(time.Hour)
+		writeFile(t, root, "changed.txt", "v2")
+		require.NoError(t, os.Chtimes(filepath.Join(root, "changed.txt"), later, later))
+		require.NoError(t, os.Chtimes(filepath.Join(root, "touched.txt"), later, later))
+		require.NoError(t, os.Remove(filepath.Join(root, "removed.txt")))
+		writeFile(t, root, "added.txt", "added")
+
+		after, err := before.Update(&Options{Hash: hash})
+		require.NoError(t, err)
+		d := before.Diff(after)
+		require.Equal(t, []string{"added.txt"}, d.Added)
+		require.Equal(t, []string{"removed.txt"}, d.Removed)
+		if hash {
+			// With digests, only content changes count
+			require.Equal(t, []string{"changed.txt"}, d.Modified)
+		} else {
+			require.Equal(t, []string{"changed.txt", "touched.txt"}, d.Modified)
+		}
+		require.Equal(t, append(d.Added, d.Modified...), d.Changed())
+		require.False(t, d.Empty())
+		require.True(t, after.Diff(after).Empty())
+
+		// Restore the tree for the next pass
+		require.NoError(t, os.Remove(filepath.Join(root, "added.txt")))
+		writeFile(t, root, "removed.txt", "removed")
+		writeFile(t, root, "changed.txt", "v1")
+	}
+}
+
+func TestUpdateReusesDigests(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a.txt", "a")
+	writeFile(t, root, "b.txt", "b")
+	before, err := Take(root, &Options{Hash: true})
+	require.NoError(t, err)
+
+	// A digest is only computed again if the metadata changed, so a
+	// doctored digest survives an update when the file did not change
+	e := before.Entries["a.txt"]
+	e.SHA256 = "reused"
+	before.Entries["a.txt"] = e
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "b.txt"), later, later))
+
+	after, err := before.Update(&Options{Hash: true})
+	require.NoError(t, err)
+	require.Equal(t, "reused", after.Entries["a.txt"].SHA256)
+	require.Equal(t, before.Entries["b.txt"].SHA256, after.Entries["b.txt"].SHA256)
+	require.True(t, after.Entries["b.txt"].ModTime.Equal(later))
+}
+
+// makeTree writes a tree shaped like a large source repository: dirs
+// directories with files files each
+func makeTree(b *testing.B, dirs, files int) string {
+	root := b.TempDir()
+	for d := 0; d < dirs; d++ {
+		for f := 0; f < files; f++ {
+			writeFile(b, root, fmt.Sprintf("pkg%03d/sub/file%03d.go", d, f), fmt.Sprintf("package pkg%d // %d\n", d, f))
+		}
+	}
+	return root
+}
+
+func BenchmarkTake(b *testing.B) {
+	root := makeTree(b, 200, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Take(root, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTakeHash(b *testing.B) {
+	root := makeTree(b, 200, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Take(root, &Options{Hash: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateHash(b *testing.B) {
+	root := makeTree(b, 200, 100)
+	s, err := Take(root, &Options{Hash: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Update(&Options{Hash: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	root := makeTree(b, 200, 100)
+	before, err := Take(root, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	writeFile(b, root, "pkg000/sub/new.go", "package pkg0\n")
+	after, err := before.Update(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before.Diff(after)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package testharness
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/release-utils/command"
+)
+
+const gitCommand = "git"
+
+// GitDaemon serves bare repositories over the git:// protocol
+type GitDaemon struct {
+	basePath string
+	port     int
+}
+
+func startGitDaemon(t testing.TB) *GitDaemon {
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		t.Skip("git binary not found, skipping test")
+	}
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gd := &GitDaemon{basePath: t.TempDir(), port: port}
+
+	cmd := exec.Command( //nolint:gosec // Arguments are controlled by the harness
+		gitCommand, "daemon", "--export-all", "--reuseaddr", "--enable=receive-pack",
+		"--listen=127.0.0.1", fmt.Sprintf("--port=%d", port), "--base-path="+gd.basePath, gd.basePath,
+	)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(fmt.Errorf("starting git daemon: %w", err))
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+	})
+	if err := waitForPort(fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatal(fmt.Errorf("waiting for git daemon: %w", err))
+	}
+	return gd
+}
+
+// URL returns the git:// URL of a repository served by the daemon
+func (gd *GitDaemon) URL(name string) string {
+	return fmt.Sprintf("git://127.0.0.1:%d/%s.git", gd.port, name)
+}
+
+// Path returns the path to the bare repository in the filesystem
+func (gd *GitDaemon) Path(name string) string {
+	return filepath.Join(gd.basePath, name+".git")
+}
+
+// CreateRepo creates a bare repository named name. The files map is
+// committed to its main branch. It returns the URL to clone it.
+func (gd *GitDaemon) CreateRepo(name string, files map[string]string) (string, error) {
+	workdir, err := os.MkdirTemp("", "harness-repo-")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	for path, content := range files {
+		fullPath := filepath.Join(workdir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), os.FileMode(0o755)); err != nil {
+			return "", fmt.Errorf("creating directory for %s: %w", path, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), os.FileMode(0o644)); err != nil {
+			return "", fmt.Errorf("writing %s: %w", path, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "--initial-branch=main"},
+		{"config", "user.email", "harness@example.com"},
+		{"config", "user.name", "Test Harness"},
+		{"add", "--all"},
+		{"commit", "--allow-empty", "-m", "Initial commit"},
+		{"clone", "--bare", workdir, gd.Path(name)},
+	} {
+		if err := command.NewWithWorkDir(workdir, gitCommand, args...).RunSilentSuccess(); err != nil {
+			return "", fmt.Errorf("running git %s: %w", args[0], err)
+		}
+	}
+	return gd.URL(name), nil
+}
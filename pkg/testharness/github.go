@@ -0,0 +1,82 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/sirupsen/logrus"
+)
+
+// githubAPIHost is the host the GitHub clients send requests to
+const githubAPIHost = "api.github.com"
+
+// GitHubServer is a stub of the GitHub API. While it runs, all GitHub
+// clients created by the github package send their requests to it.
+// Responses are defined by registering handlers for API paths.
+type GitHubServer struct {
+	server *httptest.Server
+	mux    *http.ServeMux
+}
+
+func startGitHubServer(t testing.TB) *GitHubServer {
+	gs := &GitHubServer{mux: http.NewServeMux()}
+	gs.server = httptest.NewServer(gs.mux)
+	github.SetTransport(gs.Transport())
+	t.Cleanup(func() {
+		github.SetTransport(nil)
+		gs.server.Close()
+	})
+	return gs
+}
+
+// URL returns the base URL of the stub server
+func (gs *GitHubServer) URL() string {
+	return gs.server.URL
+}
+
+// Handle registers a handler for an API path, eg /repos/owner/repo/pulls/1
+func (gs *GitHubServer) Handle(path string, handler http.HandlerFunc) {
+	gs.mux.HandleFunc(path, handler)
+}
+
+// HandleJSON registers a path that responds with the JSON encoding of data
+func (gs *GitHubServer) HandleJSON(path string, data interface{}) {
+	gs.Handle(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			logrus.Error(err)
+		}
+	})
+}
+
+// Transport returns an http.RoundTripper that sends the requests to
+// api.github.com to the stub server
+func (gs *GitHubServer) Transport() http.RoundTripper {
+	return &githubRedirectTransport{server: gs.server}
+}
+
+// githubRedirectTransport rewrites the GitHub API host to the stub server
+type githubRedirectTransport struct {
+	server *httptest.Server
+}
+
+func (rt *githubRedirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == githubAPIHost {
+		stubURL, err := url.Parse(rt.server.URL)
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.URL.Scheme = stubURL.Scheme
+		req.URL.Host = stubURL.Host
+		req.Host = stubURL.Host
+	}
+	return rt.server.Client().Transport.RoundTrip(req)
+}
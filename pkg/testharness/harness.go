@@ -0,0 +1,86 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package testharness starts local replacements of the services used by
+// the SDK so that builds, transfers and cherry-picks can be tested
+// without network access. It is meant to be used from tests, both in
+// this module and by its consumers:
+//
+//	h := testharness.New(t)
+//	gh := h.GitHub()      // Stub of the GitHub API
+//	gd := h.GitDaemon()   // git:// server for test repositories
+//	s3 := h.S3()          // MinIO server for s3:// URLs
+package testharness
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// serviceStartTimeout is the time to wait for a service to accept connections
+const serviceStartTimeout = 15 * time.Second
+
+// Harness holds the services started for a test. Services are started
+// on first use and stopped when the test finishes.
+type Harness struct {
+	t         testing.TB
+	github    *GitHubServer
+	gitDaemon *GitDaemon
+	s3        *MinIO
+}
+
+// New returns a new harness bound to a test
+func New(t testing.TB) *Harness {
+	return &Harness{t: t}
+}
+
+// GitHub returns the GitHub API stub, starting it if needed
+func (h *Harness) GitHub() *GitHubServer {
+	if h.github == nil {
+		h.github = startGitHubServer(h.t)
+	}
+	return h.github
+}
+
+// GitDaemon returns the git daemon, starting it if needed
+func (h *Harness) GitDaemon() *GitDaemon {
+	if h.gitDaemon == nil {
+		h.gitDaemon = startGitDaemon(h.t)
+	}
+	return h.gitDaemon
+}
+
+// S3 returns the MinIO server, starting it if needed. The test is
+// skipped if the minio binary is not available.
+func (h *Harness) S3() *MinIO {
+	if h.s3 == nil {
+		h.s3 = startMinIO(h.t)
+	}
+	return h.s3
+}
+
+// freePort returns a TCP port available on the loopback interface
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("opening listener to find a free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForPort blocks until address accepts connections or the timeout expires
+func waitForPort(address string) error {
+	deadline := time.Now().Add(serviceStartTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for %s", address)
+}
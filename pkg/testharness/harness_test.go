@@ -0,0 +1,73 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package testharness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/cicd-sdk/pkg/git"
+	"github.com/mattermost/cicd-sdk/pkg/github"
+	"github.com/mattermost/cicd-sdk/pkg/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitHubServer(t *testing.T) {
+	h := New(t)
+	h.GitHub().HandleJSON("/repos/mattermost/test-repo/pulls/42", map[string]interface{}{
+		"number":           42,
+		"state":            "closed",
+		"merged":           true,
+		"merge_commit_sha": "1501b6ec05947d308ad4125d762db3ecd625a826",
+		"user":             map[string]string{"login": "harness"},
+		"base": map[string]interface{}{
+			"repo": map[string]interface{}{"name": "test-repo", "owner": map[string]string{"login": "mattermost"}},
+		},
+	})
+
+	pr, err := github.NewRepository("mattermost", "test-repo").GetPullRequest(context.Background(), 42)
+	require.NoError(t, err)
+	require.Equal(t, 42, pr.Number)
+	require.Equal(t, "harness", pr.Username)
+	require.Equal(t, "1501b6ec05947d308ad4125d762db3ecd625a826", pr.MergeCommitSHA)
+	require.True(t, pr.IsMerged())
+
+	// Paths not registered return a 404
+	_, err = github.NewRepository("mattermost", "test-repo").GetPullRequest(context.Background(), 1)
+	require.Error(t, err)
+}
+
+func TestGitDaemon(t *testing.T) {
+	h := New(t)
+	url, err := h.GitDaemon().CreateRepo("test-repo", map[string]string{
+		"README.md": "# Test Repository\n",
+		"Makefile":  "build:\n\techo build\n",
+	})
+	require.NoError(t, err)
+	require.DirExists(t, h.GitDaemon().Path("test-repo"))
+
+	dir := t.TempDir()
+	_, err = git.New().CloneRepo(url, dir)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, "README.md"))
+	require.FileExists(t, filepath.Join(dir, "Makefile"))
+}
+
+func TestMinIO(t *testing.T) {
+	h := New(t)
+	require.NoError(t, h.S3().CreateBucket("harness-bucket"))
+
+	f, err := os.CreateTemp("", "harness-s3-")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, os.WriteFile(f.Name(), []byte("test data"), os.FileMode(0o644)))
+
+	om := object.NewManager()
+	require.NoError(t, om.Copy("file:/"+f.Name(), "s3://harness-bucket/test.txt"))
+	exists, err := om.PathExists("s3://harness-bucket/test.txt")
+	require.NoError(t, err)
+	require.True(t, exists)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package testharness
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	s3go "github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	minioCommand   = "minio"
+	minioBinaryVar = "MINIO_BINARY" // Path to the minio binary when not in $PATH
+	minioUser      = "harness"
+	minioPassword  = "harness-secret"
+	minioRegion    = "us-east-1"
+)
+
+// MinIO runs a MinIO server. While it runs, the AWS variables in the
+// environment point the s3:// object backend to it.
+type MinIO struct {
+	endpoint string
+}
+
+func startMinIO(t testing.TB) *MinIO {
+	binary := os.Getenv(minioBinaryVar)
+	if binary == "" {
+		var err error
+		binary, err = exec.LookPath(minioCommand)
+		if err != nil {
+			t.Skip("minio binary not found, skipping test")
+		}
+	}
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	m := &MinIO{endpoint: "http://" + address}
+
+	cmd := exec.Command(binary, "server", "--quiet", "--address", address, t.TempDir()) //nolint:gosec // Test binary
+	cmd.Env = append(os.Environ(), "MINIO_ROOT_USER="+minioUser, "MINIO_ROOT_PASSWORD="+minioPassword)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(fmt.Errorf("starting minio: %w", err))
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+	})
+	if err := waitForPort(address); err != nil {
+		t.Fatal(fmt.Errorf("waiting for minio: %w", err))
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", minioUser)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", minioPassword)
+	t.Setenv("AWS_DEFAULT_REGION", minioRegion)
+	t.Setenv("AWS_ENDPOINT_URL", m.endpoint)
+	return m
+}
+
+// Endpoint returns the URL of the MinIO server
+func (m *MinIO) Endpoint() string {
+	return m.endpoint
+}
+
+// CreateBucket creates a bucket in the server
+func (m *MinIO) CreateBucket(name string) error {
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String(minioRegion),
+		Endpoint:         aws.String(m.endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials(minioUser, minioPassword, ""),
+	})
+	if err != nil {
+		return fmt.Errorf("creating S3 session: %w", err)
+	}
+	if _, err := s3go.New(sess).CreateBucket(&s3go.CreateBucketInput{Bucket: aws.String(name)}); err != nil {
+		return fmt.Errorf("creating bucket %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is a span finished while a Recorder was the tracer
+type RecordedSpan struct {
+	ID         int
+	Parent     int    // ID of the parent span, zero for root spans
+	TraceID    string // W3C trace ID, shared by the spans of a trace
+	SpanID     string // W3C ID of the span
+	Name       string
+	Attributes map[string]string
+	Start      time.Time
+	End        time.Time
+	Err        error // Error the operation failed with
+}
+
+// Recorder is a tracer keeping the spans in memory, to check the
+// instrumentation in tests. It propagates the spans as W3C traceparent
+// headers.
+type Recorder struct {
+	mu    sync.Mutex
+	next  int
+	spans []RecordedSpan
+}
+
+type recorderKey struct{}
+
+// NewRecorder returns a recorder without spans
+func NewRecorder() *Recorder {
+	return &Recorder{spans: []RecordedSpan{}}
+}
+
+// Start begins a span, recorded when it ends
+func (rec *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	rec.mu.Lock()
+	rec.next++
+	span := &recorderSpan{
+		recorder: rec,
+		data: RecordedSpan{
+			ID: rec.next, Name: name, Attributes: map[string]string{}, Start: time.Now(),
+		},
+	}
+	rec.mu.Unlock()
+	span.data.SpanID = randomID(8)
+	if parent, ok := ctx.Value(recorderKey{}).(*recorderSpan); ok && parent.recorder == rec {
+		span.data.Parent = parent.data.ID
+		span.data.TraceID = parent.data.TraceID
+	} else {
+		span.data.TraceID = randomID(16)
+	}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, recorderKey{}, span), span
+}
+
+// Inject sets the traceparent header of the span in ctx
+func (rec *Recorder) Inject(ctx context.Context, header http.Header) {
+	span, ok := ctx.Value(recorderKey{}).(*recorderSpan)
+	if !ok || span.recorder != rec {
+		return
+	}
+	header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", span.data.TraceID, span.data.SpanID))
+}
+
+// randomID returns n random bytes in hex, the format of the W3C IDs
+func randomID(n int) string {
+	id := make([]byte, n)
+	if _, err := rand.Read(id); err != nil {
+		// Not unique, but still a valid ID
+		id[0] = 1
+	}
+	return hex.EncodeToString(id)
+}
+
+// Spans returns the spans finished so far, in the order they ended
+func (rec *Recorder) Spans() []RecordedSpan {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]RecordedSpan{}, rec.spans...)
+}
+
+// Find returns the first finished span with a name
+func (rec *Recorder) Find(name string) (RecordedSpan, bool) {
+	for _, s := range rec.Spans() {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return RecordedSpan{}, false
+}
+
+type recorderSpan struct {
+	recorder *Recorder
+	mu       sync.Mutex
+	data     RecordedSpan
+}
+
+func (s *recorderSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		s.data.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recorderSpan) End(err error) {
+	s.mu.Lock()
+	s.data.End = time.Now()
+	s.data.Err = err
+	data := s.data
+	data.Attributes = map[string]string{}
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.spans = append(s.recorder.spans, data)
+}
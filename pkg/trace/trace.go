@@ -0,0 +1,125 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package trace records the spans of the operations of the SDK, like the
+// phases of a build or the copies of objects, in a tracing system. The
+// SDK does not depend on a tracing library: a Tracer adapts one, eg
+// OpenTelemetry, and is set for the whole process with SetTracer. Until
+// one is set, spans are not recorded.
+package trace
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Attribute is a key and value describing a span, eg run=make-0001
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// String returns an attribute with a key and value
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans in a tracing system
+type Tracer interface {
+	// Start begins a span named after an operation, child of the span in
+	// ctx if there is one. The returned context carries the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced
+type Span interface {
+	// SetAttributes adds attributes to the span
+	SetAttributes(attrs ...Attribute)
+	// End finishes the span, recording the error the operation failed
+	// with if it is not nil
+	End(err error)
+}
+
+// Propagator is implemented by the tracers that can pass the span in a
+// context to other services. Transport injects it in the headers of the
+// requests it sends, eg as a W3C traceparent header.
+type Propagator interface {
+	// Inject writes the span in ctx to the headers of a request
+	Inject(ctx context.Context, header http.Header)
+}
+
+var (
+	defaultTracer Tracer = noopTracer{}
+	tracerMutex   sync.RWMutex
+)
+
+// SetTracer sets the tracer recording the spans of the SDK. Setting it to
+// nil stops recording them.
+func SetTracer(tracer Tracer) {
+	tracerMutex.Lock()
+	defer tracerMutex.Unlock()
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	defaultTracer = tracer
+}
+
+// getTracer returns the configured tracer
+func getTracer() Tracer {
+	tracerMutex.RLock()
+	defer tracerMutex.RUnlock()
+	return defaultTracer
+}
+
+// Start begins a span with the tracer set with SetTracer. Callers must end
+// the returned span:
+//
+//	ctx, span := trace.Start(ctx, "object.copy", trace.String("source", src))
+//	defer func() { span.End(err) }()
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return getTracer().Start(ctx, name, attrs...)
+}
+
+// Transport is an HTTP transport recording a span for each request, child
+// of the span in the request context. If the tracer is a Propagator, the
+// span is injected in the request headers so the server joins the trace.
+type Transport struct {
+	Base http.RoundTripper // Transport sending the requests. http.DefaultTransport if nil
+}
+
+// RoundTrip sends the request within a span named after its method
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(req.Context(), "http."+req.Method,
+		String("http.method", req.Method), String("http.host", req.URL.Host), String("http.path", req.URL.Path),
+	)
+	req = req.Clone(ctx)
+	if p, ok := getTracer().(Propagator); ok {
+		p.Inject(ctx, req.Header)
+	}
+	resp, err := base.RoundTrip(req)
+	if err == nil {
+		span.SetAttributes(String("http.status", resp.Status))
+	}
+	span.End(err)
+	return resp, err
+}
+
+// noopTracer does not record spans
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) End(error)                  {}
@@ -0,0 +1,84 @@
+// Copyright (c) 2021-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart(t *testing.T) {
+	// Without a tracer, spans are not recorded
+	ctx, span := Start(context.Background(), "noop")
+	require.NotNil(t, ctx)
+	span.SetAttributes(String("key", "value"))
+	span.End(nil)
+
+	rec := NewRecorder()
+	SetTracer(rec)
+	defer SetTracer(nil)
+
+	ctx, parent := Start(context.Background(), "parent", String("run", "make-0001"))
+	_, child := Start(ctx, "child")
+	child.SetAttributes(String("attempt", "1"))
+	child.End(errors.New("runner failed"))
+	parent.End(nil)
+
+	spans := rec.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, spans[1].ID, spans[0].Parent)
+	require.Equal(t, map[string]string{"attempt": "1"}, spans[0].Attributes)
+	require.EqualError(t, spans[0].Err, "runner failed")
+	require.Equal(t, "parent", spans[1].Name)
+	require.Zero(t, spans[1].Parent)
+	require.Equal(t, map[string]string{"run": "make-0001"}, spans[1].Attributes)
+	require.NoError(t, spans[1].Err)
+
+	// Reverting to the default tracer stops recording
+	SetTracer(nil)
+	_, span = Start(context.Background(), "after")
+	span.End(nil)
+	require.Len(t, rec.Spans(), 2)
+}
+
+func TestTransport(t *testing.T) {
+	traceparent := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	rec := NewRecorder()
+	SetTracer(rec)
+	defer SetTracer(nil)
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, server.URL+"/repos/mattermost/cicd-sdk", http.NoBody)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: &Transport{}}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	parent.End(nil)
+
+	span, ok := rec.Find("http.HEAD")
+	require.True(t, ok)
+	p, ok := rec.Find("parent")
+	require.True(t, ok)
+	require.Equal(t, p.ID, span.Parent)
+	require.Equal(t, "/repos/mattermost/cicd-sdk", span.Attributes["http.path"])
+	require.Equal(t, "404 Not Found", span.Attributes["http.status"])
+
+	// The server gets the request span as W3C trace context
+	require.Equal(t, p.TraceID, span.TraceID)
+	require.Len(t, span.TraceID, 32)
+	require.Len(t, span.SpanID, 16)
+	require.Equal(t, "00-"+span.TraceID+"-"+span.SpanID+"-01", traceparent)
+	require.Empty(t, req.Header.Get("traceparent"))
+}